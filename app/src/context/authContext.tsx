@@ -42,7 +42,7 @@ export const AuthProvider = ({ children }: { children: ReactNode }) => {
     refreshing = true;
     refreshPromise = (async () => {
       try {
-        const res = await axios.get(`${API_URL}/v1/refresh`, { withCredentials: true });
+        const res = await axios.post(`${API_URL}/v1/auth/refresh`, {}, { withCredentials: true });
         setToken(res.data.token);
         localStorage.setItem("token", res.data.token);
       } catch {
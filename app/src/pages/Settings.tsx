@@ -47,6 +47,7 @@ const Settings = () => {
 
   const [activeTab, setActiveTab] = useState("account");
   const [apiKey, setApiKey] = useState("");
+  const [apiKeyPrefix, setApiKeyPrefix] = useState("");
   const [mockPaymentProcessing, setMockPaymentProcessing] = useState(false);
   const [userEmail, setUserEmail] = useState("");
   const [username, setUsername] = useState("");
@@ -93,6 +94,7 @@ const Settings = () => {
           setUserEmail(response.data.email || "");
           setUsername(response.data.username || "");
           setApiKey(response.data.api_key || "");
+          setApiKeyPrefix(response.data.api_key_prefix || "");
         }
       } catch (error) {
         console.error("Failed to fetch user info:", error);
@@ -334,12 +336,14 @@ const Settings = () => {
           <Card>
             <CardHeader>
               <CardTitle>API Keys</CardTitle>
-              <CardDescription>Use this key to connect your training agent</CardDescription>
+              <CardDescription>
+                Use this key to connect your training agent. It is only shown once; regenerate it if you lost it.
+              </CardDescription>
             </CardHeader>
             <CardContent className="space-y-4">
               <div className="flex gap-2">
-                <Input value={apiKey} readOnly />
-                <Button variant="outline" size="icon" onClick={copyApiKey}>
+                <Input value={apiKey || (apiKeyPrefix && `${apiKeyPrefix}…`)} readOnly />
+                <Button variant="outline" size="icon" onClick={copyApiKey} disabled={!apiKey}>
                   <Copy className="h-4 w-4" />
                 </Button>
               </div>
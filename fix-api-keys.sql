@@ -16,18 +16,20 @@ BEGIN
     END IF;
 END $$;
 
--- Generate API keys for users that don't have one
+-- Generate API keys for users that don't have one. Keys that were already hashed
+-- (api_key_hash) are kept; the generated ones are hashed on their first use.
 UPDATE users
 SET api_key = 'sk_live_' || substr(md5(random()::text || email), 1, 24)
-WHERE api_key IS NULL OR api_key = '';
+WHERE (api_key IS NULL OR api_key = '') AND api_key_hash IS NULL;
 
 -- Show all users with their API keys
 SELECT
     id,
     email,
     username,
-    SUBSTRING(api_key, 1, 12) || '...' as api_key_preview,
+    COALESCE(api_key_prefix, SUBSTRING(api_key, 1, 12)) || '...' as api_key_preview,
     CASE
+        WHEN api_key_hash IS NOT NULL THEN '✅ HASHED'
         WHEN api_key IS NULL THEN '❌ NULL'
         WHEN api_key = '' THEN '❌ EMPTY'
         ELSE '✅ SET'
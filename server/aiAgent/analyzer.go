@@ -2,6 +2,7 @@ package aiAgent
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -61,8 +62,25 @@ func (a *Agent) buildAnalysisPrompt(progress *TrainingProgress) string {
 		sb.WriteString(fmt.Sprintf("- Duration: %s\n", duration.Round(time.Second)))
 	}
 	sb.WriteString(fmt.Sprintf("- Model Path: %s\n", progress.ModelPath))
+	if progress.EarlyStop != nil {
+		sb.WriteString(fmt.Sprintf("- Stopped Early: %s\n", progress.EarlyStop.Message))
+	}
 	sb.WriteString("\n")
 
+	// Hyperparameters the training was started with
+	if len(progress.Hyperparameters) > 0 {
+		sb.WriteString("## Hyperparameters\n")
+		keys := make([]string, 0, len(progress.Hyperparameters))
+		for key := range progress.Hyperparameters {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sb.WriteString(fmt.Sprintf("- %s: %s\n", key, FormatHyperparameter(progress.Hyperparameters[key])))
+		}
+		sb.WriteString("\n")
+	}
+
 	// Metrics progression
 	if len(progress.Metrics) > 0 {
 		sb.WriteString("## Training Metrics Progression\n\n")
@@ -150,6 +168,9 @@ func (a *Agent) extractMetricsSummary(progress *TrainingProgress) map[string]int
 	summary["status"] = progress.Status
 	summary["total_epochs"] = progress.TotalEpochs
 	summary["completed_epochs"] = progress.CurrentEpoch
+	if len(progress.Hyperparameters) > 0 {
+		summary["hyperparameters"] = progress.Hyperparameters
+	}
 
 	if progress.EndTime != nil {
 		duration := progress.EndTime.Sub(progress.StartTime)
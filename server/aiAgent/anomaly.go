@@ -0,0 +1,279 @@
+package aiAgent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of anomalies found in live training metrics
+const (
+	AnomalyNaNLoss          = "nan_loss"
+	AnomalyExplodingLoss    = "exploding_loss"
+	AnomalyFrozenLoss       = "frozen_loss"
+	AnomalyAccuracyCollapse = "accuracy_collapse"
+	AnomalyMetricRegression = "metric_regression"
+)
+
+// NonFiniteLossKey is set in CustomMetrics when a script reports a NaN or infinite loss.
+// The loss itself is left at zero because NaN cannot be sent as JSON.
+const NonFiniteLossKey = "non_finite_loss"
+
+// minCollapseAccuracy is the best accuracy a run must reach before a drop counts as a collapse
+const minCollapseAccuracy = 0.2
+
+// nonFiniteLossPattern matches log lines such as "loss: nan" or "Train Loss: inf"
+var nonFiniteLossPattern = regexp.MustCompile(`(?i)loss[:=\s]+(-?(?:nan|inf(?:inity)?))\b`)
+
+// nonFiniteJSONLiteral matches the NaN/Infinity literals Python's json module writes
+var nonFiniteJSONLiteral = regexp.MustCompile(`([:\[,]\s*)(-?Infinity|NaN)(\s*[,}\]])`)
+
+// AnomalyPolicy configures the anomaly detector of a model's trainings
+type AnomalyPolicy struct {
+	AutoStop        bool    `json:"auto_stop"`        // Stop the run when an anomaly is detected
+	FrozenEpochs    int     `json:"frozen_epochs"`    // Epochs without any loss change before the loss counts as frozen
+	ExplodingFactor float64 `json:"exploding_factor"` // Loss this many times above its best counts as exploding
+	AccuracyDrop    float64 `json:"accuracy_drop"`    // Fraction of the best accuracy (or primary metric) lost that counts as a collapse
+	// Metric is the model's primary metric. Metrics other than accuracy are watched for regressions
+	// of AccuracyDrop in their own direction.
+	Metric PrimaryMetric `json:"metric"`
+}
+
+// DefaultAnomalyPolicy is used for trainings of models without their own policy
+func DefaultAnomalyPolicy() AnomalyPolicy {
+	return AnomalyPolicy{FrozenEpochs: 5, ExplodingFactor: 10, AccuracyDrop: 0.5, Metric: DefaultPrimaryMetric()}
+}
+
+// TrainingAnomaly is a problem found in a training's metrics
+type TrainingAnomaly struct {
+	Kind        string    `json:"kind"`
+	Message     string    `json:"message"`
+	Epoch       int       `json:"epoch"`
+	DetectedAt  time.Time `json:"detected_at"`
+	AutoStopped bool      `json:"auto_stopped"`
+}
+
+// AnomalyCallback is told about every anomaly, e.g. to notify the training's owner
+type AnomalyCallback func(trainingID string, userID int, anomaly TrainingAnomaly)
+
+var anomalyCallback AnomalyCallback
+
+// SetAnomalyCallback sets the function called for each detected anomaly
+func SetAnomalyCallback(callback AnomalyCallback) {
+	anomalyCallback = callback
+}
+
+// anomalyDetector watches the metrics of one training. Each kind of anomaly is reported once per run.
+type anomalyDetector struct {
+	policy       AnomalyPolicy
+	bestLoss     float64
+	lastLoss     float64
+	lastEpoch    int
+	unchanged    int
+	bestAccuracy float64
+	bestMetric   *float64 // Best value of a primary metric other than accuracy
+	reported     map[string]bool
+}
+
+func newAnomalyDetector(policy AnomalyPolicy) *anomalyDetector {
+	return &anomalyDetector{policy: policy, reported: make(map[string]bool)}
+}
+
+// observe checks a new metrics line and returns the anomalies it reveals
+func (d *anomalyDetector) observe(m TrainingMetrics) []TrainingAnomaly {
+	var found []TrainingAnomaly
+	report := func(kind, message string) {
+		if d.reported[kind] {
+			return
+		}
+		d.reported[kind] = true
+		found = append(found, TrainingAnomaly{Kind: kind, Message: message, Epoch: m.Epoch, DetectedAt: time.Now()})
+	}
+
+	if value, ok := m.CustomMetrics[NonFiniteLossKey].(string); ok {
+		report(AnomalyNaNLoss, fmt.Sprintf("Loss became %s at epoch %d", value, m.Epoch))
+		return found
+	}
+
+	loss := m.TrainLoss
+	if loss == 0 {
+		loss = m.ValLoss
+	}
+	if loss > 0 {
+		if d.bestLoss > 0 && loss > d.bestLoss*d.policy.ExplodingFactor {
+			report(AnomalyExplodingLoss, fmt.Sprintf("Loss exploded to %.4g at epoch %d, %.0fx its best of %.4g", loss, m.Epoch, loss/d.bestLoss, d.bestLoss))
+		}
+		if d.bestLoss == 0 || loss < d.bestLoss {
+			d.bestLoss = loss
+		}
+
+		// Scripts may report several lines per epoch, so only compare across epochs
+		if m.Epoch > d.lastEpoch && d.lastEpoch > 0 {
+			if math.Abs(loss-d.lastLoss) <= 1e-7*math.Max(1, math.Abs(d.lastLoss)) {
+				d.unchanged++
+			} else {
+				d.unchanged = 0
+			}
+			if d.unchanged >= d.policy.FrozenEpochs {
+				report(AnomalyFrozenLoss, fmt.Sprintf("Loss has not changed from %.4g for %d epochs", loss, d.unchanged))
+			}
+		}
+		if m.Epoch > d.lastEpoch {
+			d.lastEpoch = m.Epoch
+		}
+		d.lastLoss = loss
+	}
+
+	if metric := d.policy.Metric; !metric.IsAccuracy() {
+		if value, ok := metric.Value(m); ok {
+			if d.bestMetric != nil && d.regressed(value) {
+				report(AnomalyMetricRegression, fmt.Sprintf("%s regressed to %.4g at epoch %d from a best of %.4g", metric.Name, value, m.Epoch, *d.bestMetric))
+			}
+			if d.bestMetric == nil || metric.Better(value, *d.bestMetric) {
+				d.bestMetric = &value
+			}
+		}
+		return found
+	}
+
+	accuracy := m.ValAccuracy
+	if accuracy == 0 {
+		accuracy = m.TrainAccuracy
+	}
+	if accuracy > 0 {
+		if d.bestAccuracy >= minCollapseAccuracy && accuracy < d.bestAccuracy*(1-d.policy.AccuracyDrop) {
+			report(AnomalyAccuracyCollapse, fmt.Sprintf("Accuracy collapsed to %.1f%% at epoch %d from a best of %.1f%%", accuracy*100, m.Epoch, d.bestAccuracy*100))
+		}
+		if accuracy > d.bestAccuracy {
+			d.bestAccuracy = accuracy
+		}
+	}
+
+	return found
+}
+
+// regressed reports whether a primary metric value lost more than the policy's drop from the best value
+func (d *anomalyDetector) regressed(value float64) bool {
+	best := *d.bestMetric
+	if best <= 0 {
+		return false
+	}
+	if d.policy.Metric.Direction == MetricLowerIsBetter {
+		return value > best/(1-d.policy.AccuracyDrop)
+	}
+	return value < best*(1-d.policy.AccuracyDrop)
+}
+
+// SetAnomalyPolicy replaces the anomaly policy of a training and sets its primary metric
+func (tp *TrainingProgress) SetAnomalyPolicy(policy AnomalyPolicy) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.anomalyDetector = newAnomalyDetector(policy)
+	tp.setPrimaryMetricLocked(policy.Metric)
+}
+
+// setPrimaryMetricLocked sets the metric of record of a training. The caller must hold tp.mu.
+func (tp *TrainingProgress) setPrimaryMetricLocked(metric PrimaryMetric) {
+	if metric.Name == "" {
+		metric = DefaultPrimaryMetric()
+	}
+	tp.PrimaryMetric = &metric
+}
+
+// GetPrimaryMetric returns the metric of record of a training, accuracy unless its model declared another
+func (tp *TrainingProgress) GetPrimaryMetric() PrimaryMetric {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	if tp.PrimaryMetric == nil {
+		return DefaultPrimaryMetric()
+	}
+	return *tp.PrimaryMetric
+}
+
+// detectAnomaliesLocked runs the anomaly detector on a new metrics line. The caller must hold tp.mu.
+func (tp *TrainingProgress) detectAnomaliesLocked(metrics TrainingMetrics) []TrainingAnomaly {
+	if tp.anomalyDetector == nil {
+		tp.anomalyDetector = newAnomalyDetector(DefaultAnomalyPolicy())
+	}
+	anomalies := tp.anomalyDetector.observe(metrics)
+	if len(anomalies) > 0 && tp.anomalyDetector.policy.AutoStop {
+		for i := range anomalies {
+			anomalies[i].AutoStopped = true
+		}
+		if tp.anomalyStopReason == "" {
+			tp.anomalyStopReason = anomalies[0].Message
+		}
+	}
+	tp.Anomalies = append(tp.Anomalies, anomalies...)
+	return anomalies
+}
+
+// reportAnomalies broadcasts anomalies as "training_anomaly" events and passes them to the anomaly callback
+func reportAnomalies(trainingID string, userID int, anomalies []TrainingAnomaly) {
+	for _, anomaly := range anomalies {
+		println("🚨 [ANOMALY]", trainingID+":", anomaly.Message)
+		if broadcastCallback != nil {
+			broadcastCallback(trainingID, "training_anomaly", anomaly)
+		}
+		if anomalyCallback != nil {
+			anomalyCallback(trainingID, userID, anomaly)
+		}
+	}
+}
+
+// stopForAnomaly cancels a server training whose policy auto-stops on anomalies
+func (t *Trainer) stopForAnomaly(trainingID string) {
+	t.jobs.mu.Lock()
+	defer t.jobs.mu.Unlock()
+	if job, ok := t.jobs.running[trainingID]; ok && !job.evicted {
+		println("🛑 [ANOMALY] Stopping training", trainingID)
+		job.cancel()
+	}
+}
+
+// handleAnomalies reports anomalies of a server training and stops it when its policy says so
+func (t *Trainer) handleAnomalies(trainingID string, progress *TrainingProgress, anomalies []TrainingAnomaly) {
+	if len(anomalies) == 0 {
+		return
+	}
+	reportAnomalies(trainingID, progress.UserID, anomalies)
+	if anomalies[0].AutoStopped {
+		t.stopForAnomaly(trainingID)
+	}
+}
+
+// AnomalyStopReason returns why a training was stopped by the anomaly detector, or ""
+func (tp *TrainingProgress) AnomalyStopReason() string {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.anomalyStopReason
+}
+
+// MarkNonFiniteLoss flags metrics with NonFiniteLossKey when their log line reports a NaN or infinite loss
+func MarkNonFiniteLoss(line string, metrics *TrainingMetrics) bool {
+	matches := nonFiniteLossPattern.FindStringSubmatch(line)
+	if len(matches) != 2 {
+		return false
+	}
+	if metrics.CustomMetrics == nil {
+		metrics.CustomMetrics = make(map[string]interface{})
+	}
+	metrics.CustomMetrics[NonFiniteLossKey] = strings.ToLower(matches[1])
+	return true
+}
+
+// decodeProgressJSON decodes a PROGRESS payload. NaN and Infinity literals, which Python's json
+// module writes but JSON does not allow, are decoded as strings.
+func decodeProgressJSON(jsonStr string, data *map[string]interface{}) error {
+	err := json.Unmarshal([]byte(jsonStr), data)
+	if err == nil || !nonFiniteJSONLiteral.MatchString(jsonStr) {
+		return err
+	}
+	// Replace twice because adjacent literals share the separator between them
+	quoted := nonFiniteJSONLiteral.ReplaceAllString(jsonStr, `$1"$2"$3`)
+	quoted = nonFiniteJSONLiteral.ReplaceAllString(quoted, `$1"$2"$3`)
+	return json.Unmarshal([]byte(quoted), data)
+}
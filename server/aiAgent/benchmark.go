@@ -0,0 +1,72 @@
+package aiAgent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// BenchmarkSuiteVersion identifies the workloads of the agent benchmark. Agents report the
+// version they ran; scores of different versions are not comparable.
+const BenchmarkSuiteVersion = "v1"
+
+// Throughputs of the reference machine, which scores 100
+const (
+	referenceMatmulGFLOPS     = 100.0
+	referenceCNNSamplesPerSec = 1000.0
+)
+
+// BenchmarkResult is the outcome of the benchmark suite on a training agent: the FP32 matrix
+// multiply throughput and the training throughput of a small CNN, combined into one score
+type BenchmarkResult struct {
+	Suite            string    `json:"suite"`
+	Device           string    `json:"device"`
+	MatmulGFLOPS     float64   `json:"matmul_gflops"`
+	CNNSamplesPerSec float64   `json:"cnn_samples_per_sec,omitempty"`
+	DurationSeconds  float64   `json:"duration_seconds"`
+	Score            float64   `json:"score"`
+	CompletedAt      time.Time `json:"completed_at"`
+}
+
+// ParseBenchmarkResult decodes the data of an agent's benchmark_result message and scores it
+func ParseBenchmarkResult(data []byte) (*BenchmarkResult, error) {
+	var result BenchmarkResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid benchmark result: %w", err)
+	}
+	if result.Suite != BenchmarkSuiteVersion {
+		return nil, fmt.Errorf("unsupported benchmark suite %q (expected %s)", result.Suite, BenchmarkSuiteVersion)
+	}
+	if !(result.MatmulGFLOPS > 0) || math.IsInf(result.MatmulGFLOPS, 0) {
+		return nil, fmt.Errorf("benchmark result has no matmul_gflops")
+	}
+	if result.CNNSamplesPerSec < 0 || math.IsNaN(result.CNNSamplesPerSec) || math.IsInf(result.CNNSamplesPerSec, 0) {
+		return nil, fmt.Errorf("invalid cnn_samples_per_sec")
+	}
+	if result.DurationSeconds < 0 || math.IsNaN(result.DurationSeconds) {
+		result.DurationSeconds = 0
+	}
+	result.Device = strings.TrimSpace(result.Device)
+	if len(result.Device) > 255 {
+		result.Device = result.Device[:255]
+	}
+	result.Score = BenchmarkScore(result.MatmulGFLOPS, result.CNNSamplesPerSec)
+	result.CompletedAt = time.Now()
+	return &result, nil
+}
+
+// BenchmarkScore combines the workload throughputs into one score, the geometric mean of the
+// ratios to the reference machine times 100. Agents that could not run the CNN workload are
+// scored on the matrix multiply alone.
+func BenchmarkScore(matmulGFLOPS, cnnSamplesPerSec float64) float64 {
+	if matmulGFLOPS <= 0 {
+		return 0
+	}
+	score := matmulGFLOPS / referenceMatmulGFLOPS
+	if cnnSamplesPerSec > 0 {
+		score = math.Sqrt(score * cnnSamplesPerSec / referenceCNNSamplesPerSec)
+	}
+	return math.Round(score*1000) / 10
+}
@@ -0,0 +1,223 @@
+package aiAgent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/repository"
+)
+
+// Checkpoint environment variables of the deployment.
+// TRAINING_CHECKPOINT_GLOB lists comma-separated glob patterns, relative to the model folder, of
+// the checkpoint files server trainings save. TRAINING_CHECKPOINT_KEEP is how many checkpoints of
+// a training are kept (3 by default, 0 keeps all). aimanage.json's "checkpoints" overrides both.
+const (
+	TrainingCheckpointGlobEnv = "TRAINING_CHECKPOINT_GLOB"
+	TrainingCheckpointKeepEnv = "TRAINING_CHECKPOINT_KEEP"
+)
+
+// CheckpointPathEnv is the checkpoint a restarted training resumes from. It is passed along with
+// AIMANAGE_RESUME_CHECKPOINT, which preempted and interrupted trainings resume with.
+const CheckpointPathEnv = "CHECKPOINT_PATH"
+
+const (
+	defaultCheckpointGlob = "checkpoints/*,checkpoint*.pt,checkpoint*.pth,checkpoint*.h5,*.ckpt"
+	defaultCheckpointKeep = 3
+)
+
+// CheckpointConfig is the "checkpoints" section of aimanage.json
+type CheckpointConfig struct {
+	// Glob are patterns of checkpoint files relative to the model folder, e.g. "ckpt/epoch_*.pt"
+	Glob []string `json:"glob,omitempty"`
+	// Keep is how many checkpoints are kept, 0 keeps all
+	Keep *int `json:"keep,omitempty"`
+}
+
+// checkpointSettings returns the checkpoint patterns of a model and how many checkpoints are kept
+func checkpointSettings(config *CheckpointConfig) ([]string, int) {
+	glob := os.Getenv(TrainingCheckpointGlobEnv)
+	if glob == "" {
+		glob = defaultCheckpointGlob
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(glob, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	keep := defaultCheckpointKeep
+	if n, err := strconv.Atoi(os.Getenv(TrainingCheckpointKeepEnv)); err == nil && n >= 0 {
+		keep = n
+	}
+
+	if config != nil {
+		if len(config.Glob) > 0 {
+			patterns = config.Glob
+		}
+		if config.Keep != nil && *config.Keep >= 0 {
+			keep = *config.Keep
+		}
+	}
+	return patterns, keep
+}
+
+// checkpointTracker finds the checkpoint files a training writes in its model folder
+type checkpointTracker struct {
+	dir      string
+	patterns []string
+	keep     int
+	// since skips the files of earlier trainings
+	since time.Time
+	mu    sync.Mutex
+	seen  map[string]time.Time
+}
+
+func newCheckpointTracker(dir string, config *CheckpointConfig) *checkpointTracker {
+	patterns, keep := checkpointSettings(config)
+	return &checkpointTracker{
+		dir:      dir,
+		patterns: patterns,
+		keep:     keep,
+		// Some filesystems store modification times in whole seconds
+		since: time.Now().Truncate(time.Second),
+		seen:  map[string]time.Time{},
+	}
+}
+
+// scan returns the checkpoint files written or rewritten since the last scan, oldest first
+func (c *checkpointTracker) scan() []CheckpointInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type found struct {
+		checkpoint CheckpointInfo
+		modTime    time.Time
+	}
+	var files []found
+	for _, pattern := range c.patterns {
+		matches, err := filepath.Glob(filepath.Join(c.dir, pattern))
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() || info.ModTime().Before(c.since) {
+				continue
+			}
+			if last, ok := c.seen[match]; ok && !info.ModTime().After(last) {
+				continue
+			}
+			c.seen[match] = info.ModTime()
+			rel, err := filepath.Rel(c.dir, match)
+			if err != nil {
+				continue
+			}
+			files = append(files, found{CheckpointInfo{Path: filepath.ToSlash(rel), SizeBytes: info.Size()}, info.ModTime()})
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	checkpoints := make([]CheckpointInfo, len(files))
+	for i, file := range files {
+		checkpoints[i] = file.checkpoint
+	}
+	return checkpoints
+}
+
+// resolve returns the file of a checkpoint path as the script gave it, and whether it is inside
+// the model folder. Only those are ever deleted.
+func (c *checkpointTracker) resolve(path string) (string, bool) {
+	file := path
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(c.dir, filepath.FromSlash(path))
+	}
+	rel, err := filepath.Rel(c.dir, file)
+	return file, err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// detectCheckpoints records the checkpoint files the training saved since the last scan with the
+// current epoch
+func (tp *TrainingProgress) detectCheckpoints() {
+	tp.mu.RLock()
+	tracker, epoch := tp.checkpointScan, tp.CurrentEpoch
+	tp.mu.RUnlock()
+	if tracker == nil {
+		return
+	}
+	for _, checkpoint := range tracker.scan() {
+		checkpoint.Epoch = epoch
+		tp.recordCheckpoint(checkpoint)
+	}
+}
+
+// recordCheckpoint records a checkpoint of a server training, stores it so the training can be
+// restarted from it, and streams it to its viewers. Beyond the kept number, the oldest checkpoints
+// that are not the best are deleted.
+func (tp *TrainingProgress) recordCheckpoint(checkpoint CheckpointInfo) {
+	tp.mu.Lock()
+	tracker, trainingID := tp.checkpointScan, tp.TrainingID
+	if tracker != nil && checkpoint.SizeBytes == 0 {
+		if file, ok := tracker.resolve(checkpoint.Path); ok {
+			if info, err := os.Stat(file); err == nil {
+				checkpoint.SizeBytes = info.Size()
+			}
+		}
+	}
+	// A checkpoint saved again under the same path becomes the latest
+	checkpoints := make([]CheckpointInfo, 0, len(tp.Checkpoints)+1)
+	for _, existing := range tp.Checkpoints {
+		if existing.Path != checkpoint.Path {
+			checkpoints = append(checkpoints, existing)
+		}
+	}
+	checkpoints = append(checkpoints, checkpoint)
+
+	var pruned []CheckpointInfo
+	if tracker != nil && tracker.keep > 0 {
+		excess := 0
+		for _, c := range checkpoints {
+			if !c.IsBest {
+				excess++
+			}
+		}
+		excess -= tracker.keep
+		kept := checkpoints[:0]
+		for _, c := range checkpoints {
+			if excess > 0 && !c.IsBest {
+				pruned = append(pruned, c)
+				excess--
+				continue
+			}
+			kept = append(kept, c)
+		}
+		checkpoints = kept
+	}
+	tp.Checkpoints = checkpoints
+	tp.mu.Unlock()
+
+	ctx := context.Background()
+	if err := repository.RecordTrainingCheckpoint(ctx, trainingID, checkpoint.Path, checkpoint.Epoch, checkpoint.IsBest, checkpoint.SizeBytes); err != nil {
+		println("⚠️  [CHECKPOINT] Failed to store checkpoint:", err.Error())
+	}
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "checkpoint", checkpoint)
+	}
+
+	for _, old := range pruned {
+		if file, ok := tracker.resolve(old.Path); ok {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				println("⚠️  [CHECKPOINT] Failed to delete old checkpoint:", err.Error())
+			}
+		}
+		if err := repository.DeleteTrainingCheckpoint(ctx, trainingID, old.Path); err != nil {
+			println("⚠️  [CHECKPOINT] Failed to forget old checkpoint:", err.Error())
+		}
+		println("🧹 [CHECKPOINT] Pruned checkpoint", old.Path, "of training", trainingID)
+	}
+}
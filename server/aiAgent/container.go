@@ -0,0 +1,223 @@
+package aiAgent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Executors server trainings run with. Host runs the scripts as processes of the server; docker
+// and podman run each script in its own container, with only the model folder mounted.
+const (
+	ExecutorHost   = "host"
+	ExecutorDocker = "docker"
+	ExecutorPodman = "podman"
+)
+
+// Container environment variables of the deployment.
+// TRAINING_EXECUTOR selects the executor (host by default). TRAINING_CONTAINER_CPUS and
+// TRAINING_CONTAINER_MEMORY limit each container (e.g. "4" and "16g"; unlimited when unset).
+// TRAINING_CONTAINER_IMAGE is the image of scripts using neither PyTorch nor TensorFlow, which use
+// TRAINING_CONTAINER_IMAGE_PYTORCH and TRAINING_CONTAINER_IMAGE_TENSORFLOW.
+const (
+	TrainingExecutorEnv                 = "TRAINING_EXECUTOR"
+	TrainingContainerCPUsEnv            = "TRAINING_CONTAINER_CPUS"
+	TrainingContainerMemoryEnv          = "TRAINING_CONTAINER_MEMORY"
+	TrainingContainerImageEnv           = "TRAINING_CONTAINER_IMAGE"
+	TrainingContainerImagePyTorchEnv    = "TRAINING_CONTAINER_IMAGE_PYTORCH"
+	TrainingContainerImageTensorFlowEnv = "TRAINING_CONTAINER_IMAGE_TENSORFLOW"
+)
+
+// Images used when the deployment does not name one
+const (
+	defaultContainerImage           = "python:3.11-slim"
+	defaultContainerImagePyTorch    = "pytorch/pytorch:2.3.1-cuda12.1-cudnn8-runtime"
+	defaultContainerImageTensorFlow = "tensorflow/tensorflow:2.16.1-gpu"
+)
+
+// containerPidsLimit bounds the processes of a training container, against fork bombs
+const containerPidsLimit = 4096
+
+// containerPython is the interpreter of the training images; the server's python_command is a
+// host path that does not exist in them
+const containerPython = "python3"
+
+var containerNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+var warnExecutorOnce sync.Once
+
+// TrainingExecutor returns the executor of server trainings
+func TrainingExecutor() string {
+	switch executor := strings.ToLower(strings.TrimSpace(os.Getenv(TrainingExecutorEnv))); executor {
+	case "", ExecutorHost:
+		return ExecutorHost
+	case ExecutorDocker, ExecutorPodman:
+		return executor
+	default:
+		warnExecutorOnce.Do(func() {
+			log.Printf("⚠️  Unknown %s %q, running trainings on the host", TrainingExecutorEnv, executor)
+		})
+		return ExecutorHost
+	}
+}
+
+// ContainerImage returns the image of trainings using framework ("pytorch", "tensorflow" or none)
+func ContainerImage(framework string) string {
+	env, image := TrainingContainerImageEnv, defaultContainerImage
+	switch framework {
+	case "pytorch":
+		env, image = TrainingContainerImagePyTorchEnv, defaultContainerImagePyTorch
+	case "tensorflow":
+		env, image = TrainingContainerImageTensorFlowEnv, defaultContainerImageTensorFlow
+	}
+	if configured := strings.TrimSpace(os.Getenv(env)); configured != "" {
+		return configured
+	}
+	return image
+}
+
+// trainingContainer describes the container a training's scripts run in. Paths are mounted at
+// the same path as on the host, so the paths the server hands the script stay valid.
+type trainingContainer struct {
+	Executor string
+	Name     string
+	Image    string
+	// WorkingDir is the model folder, mounted read-write
+	WorkingDir string
+	// Mounts are further host paths the script reads or writes, mounted read-write
+	Mounts []string
+	// Env is the script's environment; the server's own is not passed on
+	Env []string
+	GPU *GPUAllocation
+	// Network is a network mode: open uses the default network, none none at all and allowlist
+	// the host's so the script can reach the egress proxy on the loopback interface
+	Network string
+}
+
+// trainingContainer returns the container of a training's scripts, with the image of its framework
+func (t *Trainer) trainingContainer(executor, trainingID string, req TrainingRequest, absWorkingDir string) trainingContainer {
+	framework := ""
+	if requirements, err := t.TrainingRequirements(req.FolderName, req.ScriptName); err == nil {
+		framework = requirements.Framework
+	}
+	return trainingContainer{
+		Executor:   executor,
+		Name:       "aimanage-" + containerNameUnsafe.ReplaceAllString(trainingID, "-"),
+		Image:      ContainerImage(framework),
+		WorkingDir: absWorkingDir,
+		Network:    NetworkModeOpen,
+	}
+}
+
+// command returns the command running args in the container. The CLI stays attached, forwarding
+// SIGTERM to the script and streaming its output.
+func (c trainingContainer) command(ctx context.Context, args ...string) *exec.Cmd {
+	run := []string{
+		"run", "--rm", "--init",
+		"--name", c.Name,
+		"--user", fmt.Sprintf("%d:%d", os.Geteuid(), os.Getegid()),
+		"--security-opt", "no-new-privileges",
+		"--cap-drop", "ALL",
+		"--pids-limit", fmt.Sprint(containerPidsLimit),
+		"--volume", c.WorkingDir + ":" + c.WorkingDir,
+		"--workdir", c.WorkingDir,
+	}
+	for _, mount := range c.Mounts {
+		run = append(run, "--volume", mount+":"+mount)
+	}
+	if cpus := strings.TrimSpace(os.Getenv(TrainingContainerCPUsEnv)); cpus != "" {
+		run = append(run, "--cpus", cpus)
+	}
+	if memory := strings.TrimSpace(os.Getenv(TrainingContainerMemoryEnv)); memory != "" {
+		run = append(run, "--memory", memory)
+	}
+	if c.GPU != nil {
+		// Only the assigned device is visible, so CUDA_VISIBLE_DEVICES is not needed
+		if c.Executor == ExecutorPodman {
+			run = append(run, "--device", "nvidia.com/gpu="+c.GPU.Device.ID)
+		} else {
+			run = append(run, "--gpus", "device="+c.GPU.Device.ID)
+		}
+	}
+	switch c.Network {
+	case NetworkModeNone:
+		run = append(run, "--network", "none")
+	case NetworkModeAllowlist:
+		run = append(run, "--network", "host")
+	}
+	for _, kv := range c.Env {
+		run = append(run, "--env", kv)
+	}
+	run = append(run, c.Image)
+	run = append(run, args...)
+	return exec.CommandContext(ctx, c.Executor, run...)
+}
+
+// remove deletes the container if it outlived its CLI, e.g. when the CLI was killed after the
+// grace period
+func (c trainingContainer) remove() {
+	exec.Command(c.Executor, "rm", "--force", c.Name).Run()
+}
+
+// pythonOutput runs python with args in a container without network and returns its stdout.
+// task tells the container apart from the training's own.
+func (c trainingContainer) pythonOutput(ctx context.Context, task string, args ...string) ([]byte, error) {
+	c.Network = NetworkModeNone
+	c.Name += "-" + task
+	defer c.remove()
+	return c.command(ctx, append([]string{containerPython}, args...)...).Output()
+}
+
+// withMount returns the container with path mounted too, unless the working directory holds it
+func (c trainingContainer) withMount(path string) trainingContainer {
+	if rel, err := filepath.Rel(c.WorkingDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return c
+	}
+	c.Mounts = append(append([]string{}, c.Mounts...), path)
+	return c
+}
+
+// pythonRunner runs python with args and returns its stdout
+type pythonRunner func(ctx context.Context, args ...string) ([]byte, error)
+
+// hostPython runs the pythonCmd interpreter of the server in workingDir with env
+func hostPython(pythonCmd, workingDir string, env []string) pythonRunner {
+	if pythonCmd == "" {
+		pythonCmd = "python3"
+	}
+	return func(ctx context.Context, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, pythonCmd, args...)
+		cmd.Dir = workingDir
+		cmd.Env = env
+		return cmd.Output()
+	}
+}
+
+// runPython returns how the server runs python for a training after its scripts finished, like
+// the ONNX export: on the host, or in a container of the training's image without network.
+// task names the container.
+func (t *Trainer) runPython(trainingID, task string, req TrainingRequest, absWorkingDir string, mounts ...string) pythonRunner {
+	var env []string
+	for key, val := range req.Env {
+		env = append(env, fmt.Sprintf("%s=%s", key, val))
+	}
+	executor := TrainingExecutor()
+	if executor == ExecutorHost {
+		return hostPython(req.PythonCommand, absWorkingDir, append(os.Environ(), env...))
+	}
+
+	container := t.trainingContainer(executor, trainingID, req, absWorkingDir)
+	container.Env = env
+	for _, mount := range mounts {
+		container = container.withMount(mount)
+	}
+	return func(ctx context.Context, args ...string) ([]byte, error) {
+		return container.pythonOutput(ctx, task, args...)
+	}
+}
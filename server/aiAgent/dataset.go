@@ -0,0 +1,535 @@
+package aiAgent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dataset types InspectDataset detects
+const (
+	DatasetCOCO         = "coco"          // COCO annotation files with their images
+	DatasetImageFolders = "image_folders" // one folder of images per class
+	DatasetCSV          = "csv"           // CSV or TSV tables
+	DatasetNone         = "none"          // no dataset, the script may download its data
+)
+
+const (
+	// maxVerifiedImages is how many images an inspection checks for corruption; the others are counted
+	maxVerifiedImages = 5000
+	// maxCSVRows is how many rows of each CSV file an inspection reads
+	maxCSVRows = 1000000
+	// maxCOCOSize is the size of the largest JSON file read as COCO annotations
+	maxCOCOSize = 200 << 20
+	// maxLabelValues is how many distinct values a CSV column may have to be reported as classes
+	maxLabelValues = 100
+	// maxListedCorruptFiles is how many corrupt files a summary lists
+	maxListedCorruptFiles = 100
+	// brokenCorruptRatio is the share of corrupt files above which a dataset is broken
+	brokenCorruptRatio = 0.1
+	// imbalanceRatio is how many times larger than the smallest class the largest may be before a warning
+	imbalanceRatio = 10
+)
+
+// imageExtensions are the file extensions of images, lower case
+var imageExtensions = map[string]bool{
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "bmp": true, "webp": true, "tif": true, "tiff": true,
+}
+
+// splitNames are folder and file name parts that name a dataset split
+var splitNames = map[string]string{
+	"train": "train", "training": "train",
+	"val": "validation", "valid": "validation", "validation": "validation",
+	"test": "test", "testing": "test",
+}
+
+// labelColumns are the CSV header names of label columns, lower case
+var labelColumns = map[string]bool{
+	"label": true, "labels": true, "class": true, "target": true, "y": true, "category": true,
+}
+
+// skippedDirs are folders of a model that hold its environment or training outputs, never its dataset
+var skippedDirs = map[string]bool{
+	"__pycache__": true, "venv": true, "node_modules": true, "site-packages": true,
+	"runs": true, "checkpoints": true, "outputs": true, "results": true, "logs": true,
+}
+
+// CorruptFile is a dataset file that could not be read
+type CorruptFile struct {
+	Path   string `json:"path"` // relative to the model folder
+	Reason string `json:"reason"`
+}
+
+// DatasetSummary describes the dataset found in a model folder
+type DatasetSummary struct {
+	Type      string         `json:"type"`
+	Samples   int            `json:"samples"`
+	Classes   map[string]int `json:"classes"`          // samples (annotations for COCO) per class
+	Splits    map[string]int `json:"splits,omitempty"` // samples per train, validation and test split
+	Files     int            `json:"files"`            // dataset files, such as images and tables
+	TotalSize int64          `json:"total_size"`
+	// Corrupt counts every corrupt file, CorruptFiles lists the first of them
+	Corrupt      int           `json:"corrupt"`
+	CorruptFiles []CorruptFile `json:"corrupt_files"`
+	Warnings     []string      `json:"warnings"`
+	// Broken is set when the dataset looks unusable for training, as explained by the warnings
+	Broken      bool      `json:"broken"`
+	InspectedAt time.Time `json:"inspected_at"`
+}
+
+// datasetFile is a file of the model folder, with its path relative to the folder
+type datasetFile struct {
+	FileInfo
+	Rel string
+}
+
+// InspectDataset scans a model folder for a COCO, image folder or CSV dataset and summarizes it:
+// samples per class and split, files that cannot be read, and warnings when it looks broken
+func (dn *DirectoryNavigator) InspectDataset(folderName string) (*DatasetSummary, error) {
+	dirInfo, err := dn.OpenDirectory(folderName)
+	if err != nil {
+		return nil, err
+	}
+
+	var images, tables, annotations []datasetFile
+	for _, file := range dirInfo.Files {
+		rel, err := filepath.Rel(dirInfo.Path, file.Path)
+		if err != nil || inSkippedDir(rel) {
+			continue
+		}
+		f := datasetFile{FileInfo: file, Rel: filepath.ToSlash(rel)}
+		switch ext := strings.ToLower(file.Extension); {
+		case imageExtensions[ext]:
+			images = append(images, f)
+		case ext == "csv" || ext == "tsv":
+			tables = append(tables, f)
+		case ext == "json" && file.Size <= maxCOCOSize:
+			annotations = append(annotations, f)
+		}
+	}
+
+	summary := &DatasetSummary{
+		Type:         DatasetNone,
+		Classes:      map[string]int{},
+		CorruptFiles: []CorruptFile{},
+		Warnings:     []string{},
+		InspectedAt:  time.Now(),
+	}
+	if !summary.inspectCOCO(annotations, images) && !summary.inspectImageFolders(images) {
+		summary.inspectCSV(tables)
+	}
+	summary.checkHealth()
+	return summary, nil
+}
+
+// inSkippedDir reports whether a relative path is inside a hidden or environment folder
+func inSkippedDir(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for _, dir := range parts[:len(parts)-1] {
+		if strings.HasPrefix(dir, ".") || skippedDirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// addCorrupt records a corrupt file
+func (s *DatasetSummary) addCorrupt(rel, reason string) {
+	s.Corrupt++
+	if len(s.CorruptFiles) < maxListedCorruptFiles {
+		s.CorruptFiles = append(s.CorruptFiles, CorruptFile{Path: rel, Reason: reason})
+	}
+}
+
+// warnf adds a warning
+func (s *DatasetSummary) warnf(format string, args ...interface{}) {
+	s.Warnings = append(s.Warnings, fmt.Sprintf(format, args...))
+}
+
+// addSplit counts samples of the split named by a path, if any
+func (s *DatasetSummary) addSplit(rel string, samples int) {
+	split := splitOf(rel)
+	if split == "" {
+		return
+	}
+	if s.Splits == nil {
+		s.Splits = map[string]int{}
+	}
+	s.Splits[split] += samples
+}
+
+// splitOf returns the split named by a folder of a relative path or by its file name, "" for none
+func splitOf(rel string) string {
+	parts := strings.Split(rel, "/")
+	for _, dir := range parts[:len(parts)-1] {
+		if split, ok := splitNames[strings.ToLower(dir)]; ok {
+			return split
+		}
+	}
+	name := strings.ToLower(strings.TrimSuffix(parts[len(parts)-1], filepath.Ext(rel)))
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if split, ok := splitNames[strings.TrimRight(word, "0123456789")]; ok {
+			return split
+		}
+	}
+	return ""
+}
+
+// verifyImages checks the images for corruption, up to maxVerifiedImages of them
+func (s *DatasetSummary) verifyImages(images []datasetFile) {
+	for i, img := range images {
+		s.Files++
+		s.TotalSize += img.Size
+		if i >= maxVerifiedImages {
+			continue
+		}
+		if err := verifyImage(img); err != nil {
+			s.addCorrupt(img.Rel, err.Error())
+		}
+	}
+	if len(images) > maxVerifiedImages {
+		s.warnf("Only the first %d of %d images were checked for corruption", maxVerifiedImages, len(images))
+	}
+}
+
+// verifyImage decodes the header of an image and checks that JPEG and PNG files are complete.
+// Other formats are only checked for being empty.
+func verifyImage(img datasetFile) error {
+	if img.Size == 0 {
+		return errors.New("empty file")
+	}
+	ext := strings.ToLower(img.Extension)
+	if ext != "jpg" && ext != "jpeg" && ext != "png" && ext != "gif" {
+		return nil
+	}
+
+	f, err := os.Open(img.Path)
+	if err != nil {
+		return fmt.Errorf("cannot open: %v", err)
+	}
+	defer f.Close()
+
+	if _, _, err := image.DecodeConfig(bufio.NewReader(f)); err != nil {
+		return fmt.Errorf("cannot decode: %v", err)
+	}
+
+	// Truncated uploads keep a valid header, so check the end markers too
+	var trailer []byte
+	switch ext {
+	case "jpg", "jpeg":
+		trailer = []byte{0xFF, 0xD9}
+	case "png":
+		trailer = []byte("IEND\xAE\x42\x60\x82")
+	default:
+		return nil
+	}
+	if img.Size < int64(len(trailer)) {
+		return errors.New("truncated")
+	}
+	// Some encoders pad JPEG files after their end marker
+	tailSize := int64(64)
+	if img.Size < tailSize {
+		tailSize = img.Size
+	}
+	tail := make([]byte, tailSize)
+	if _, err := f.ReadAt(tail, img.Size-int64(len(tail))); err != nil {
+		return fmt.Errorf("cannot read: %v", err)
+	}
+	if !bytes.Contains(tail, trailer) {
+		return errors.New("truncated")
+	}
+	return nil
+}
+
+// cocoFile is the part of a COCO annotation file an inspection reads
+type cocoFile struct {
+	Images *[]struct {
+		ID       int64  `json:"id"`
+		FileName string `json:"file_name"`
+	} `json:"images"`
+	Annotations *[]struct {
+		ImageID    int64 `json:"image_id"`
+		CategoryID int64 `json:"category_id"`
+	} `json:"annotations"`
+	Categories *[]struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"categories"`
+}
+
+// inspectCOCO summarizes the COCO annotation files among files and the images they list. It
+// reports whether there were any.
+func (s *DatasetSummary) inspectCOCO(files, images []datasetFile) bool {
+	byName := make(map[string]datasetFile, len(images))
+	for _, img := range images {
+		byName[filepath.Base(img.Rel)] = img
+	}
+
+	var listed []datasetFile
+	seen := map[string]bool{}
+	found := false
+	for _, file := range files {
+		var coco cocoFile
+		data, err := os.ReadFile(file.Path)
+		if err != nil || json.Unmarshal(data, &coco) != nil ||
+			coco.Images == nil || coco.Annotations == nil || coco.Categories == nil {
+			continue
+		}
+		found = true
+		s.Type = DatasetCOCO
+		s.Files++
+		s.TotalSize += file.Size
+
+		categories := make(map[int64]string, len(*coco.Categories))
+		for _, category := range *coco.Categories {
+			categories[category.ID] = category.Name
+			if _, ok := s.Classes[category.Name]; !ok {
+				s.Classes[category.Name] = 0
+			}
+		}
+		imageIDs := make(map[int64]bool, len(*coco.Images))
+		missing := 0
+		for _, img := range *coco.Images {
+			imageIDs[img.ID] = true
+			onDisk, ok := byName[filepath.Base(img.FileName)]
+			if !ok {
+				missing++
+				continue
+			}
+			if !seen[onDisk.Rel] {
+				seen[onDisk.Rel] = true
+				listed = append(listed, onDisk)
+			}
+		}
+		s.Samples += len(*coco.Images)
+		s.addSplit(file.Rel, len(*coco.Images))
+
+		orphans := 0
+		for _, annotation := range *coco.Annotations {
+			name, ok := categories[annotation.CategoryID]
+			if !ok || !imageIDs[annotation.ImageID] {
+				orphans++
+				continue
+			}
+			s.Classes[name]++
+		}
+
+		if missing > 0 {
+			s.warnf("%d of the %d images listed in %s are missing", missing, len(*coco.Images), file.Rel)
+			if float64(missing) > brokenCorruptRatio*float64(len(*coco.Images)) {
+				s.Broken = true
+			}
+		}
+		if orphans > 0 {
+			s.warnf("%d annotations in %s refer to unknown images or categories", orphans, file.Rel)
+		}
+	}
+	if found {
+		s.verifyImages(listed)
+	}
+	return found
+}
+
+// inspectImageFolders summarizes images stored in one folder per class, such as train/cat/1.jpg.
+// Images at the top of the model folder, such as its picture, are not part of it. It reports
+// whether there were any.
+func (s *DatasetSummary) inspectImageFolders(images []datasetFile) bool {
+	var dataset []datasetFile
+	for _, img := range images {
+		if strings.Contains(img.Rel, "/") {
+			dataset = append(dataset, img)
+		}
+	}
+	if len(dataset) == 0 {
+		return false
+	}
+	s.Type = DatasetImageFolders
+
+	unlabeled := 0
+	classesBySplit := map[string]map[string]bool{}
+	for _, img := range dataset {
+		s.Samples++
+		s.addSplit(img.Rel, 1)
+
+		dir := filepath.Base(filepath.Dir(img.Rel))
+		if _, isSplit := splitNames[strings.ToLower(dir)]; isSplit {
+			unlabeled++
+			continue
+		}
+		s.Classes[dir]++
+		split := splitOf(img.Rel)
+		if classesBySplit[split] == nil {
+			classesBySplit[split] = map[string]bool{}
+		}
+		classesBySplit[split][dir] = true
+	}
+	s.verifyImages(dataset)
+
+	if unlabeled > 0 {
+		s.warnf("%d images are not in a class folder", unlabeled)
+	}
+	for split, classes := range classesBySplit {
+		if split == "" {
+			continue
+		}
+		var missing []string
+		for class := range s.Classes {
+			if !classes[class] {
+				missing = append(missing, class)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			s.warnf("The %s split has no images of %s", split, strings.Join(missing, ", "))
+		}
+	}
+	return true
+}
+
+// inspectCSV summarizes CSV and TSV tables. Classes are counted from a column named like a label,
+// or from the last column when it has few distinct values.
+func (s *DatasetSummary) inspectCSV(tables []datasetFile) {
+	if len(tables) == 0 {
+		return
+	}
+	s.Type = DatasetCSV
+
+	for _, table := range tables {
+		s.Files++
+		s.TotalSize += table.Size
+
+		rows, malformed, classes, err := readTable(table)
+		if err != nil {
+			s.addCorrupt(table.Rel, err.Error())
+			continue
+		}
+		if rows == 0 {
+			s.addCorrupt(table.Rel, "no data rows")
+			continue
+		}
+		s.Samples += rows
+		s.addSplit(table.Rel, rows)
+		for class, n := range classes {
+			s.Classes[class] += n
+		}
+		if malformed > 0 {
+			s.warnf("%d rows of %s do not have as many columns as its header", malformed, table.Rel)
+		}
+		if rows >= maxCSVRows {
+			s.warnf("Only the first %d rows of %s were read", maxCSVRows, table.Rel)
+		}
+	}
+}
+
+// readTable counts the data rows of a CSV or TSV file, the rows whose column count differs from
+// the header, and the rows of each class of its label column
+func readTable(table datasetFile) (int, int, map[string]int, error) {
+	f, err := os.Open(table.Path)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("cannot open: %v", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(bufio.NewReader(f))
+	if strings.EqualFold(table.Extension, "tsv") {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return 0, 0, nil, nil
+	}
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("cannot parse: %v", err)
+	}
+	columns := len(header)
+	label, named := columns-1, false
+	for i, name := range header {
+		if labelColumns[strings.ToLower(strings.TrimSpace(name))] {
+			label, named = i, true
+			break
+		}
+	}
+
+	rows, malformed := 0, 0
+	classes := map[string]int{}
+	for rows < maxCSVRows {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, malformed, nil, fmt.Errorf("cannot parse row %d: %v", rows+2, err)
+		}
+		rows++
+		if len(record) != columns {
+			malformed++
+			continue
+		}
+		if classes != nil {
+			classes[strings.TrimSpace(record[label])]++
+			if len(classes) > maxLabelValues {
+				// A continuous target, not classes
+				classes = nil
+			}
+		}
+	}
+	// The last column is only a label if its values repeat
+	if !named && classes != nil && len(classes) > rows/2 {
+		classes = nil
+	}
+	return rows, malformed, classes, nil
+}
+
+// checkHealth warns about datasets that look unusable: without samples, with many corrupt files,
+// with a single class or with very unbalanced classes
+func (s *DatasetSummary) checkHealth() {
+	if s.Type == DatasetNone {
+		return
+	}
+	if s.Samples == 0 {
+		s.warnf("No samples were found in the %s dataset", s.Type)
+		s.Broken = true
+	}
+	if s.Corrupt > 0 {
+		s.warnf("%d of %d dataset files are corrupt", s.Corrupt, s.Files)
+		if float64(s.Corrupt) > brokenCorruptRatio*float64(s.Files) {
+			s.Broken = true
+		}
+	}
+
+	if len(s.Classes) == 1 {
+		s.warnf("The dataset has a single class")
+	}
+	smallest, largest := 0, 0
+	for class, n := range s.Classes {
+		if n == 0 {
+			s.warnf("Class %s has no samples", class)
+			continue
+		}
+		if smallest == 0 || n < smallest {
+			smallest = n
+		}
+		if n > largest {
+			largest = n
+		}
+	}
+	if smallest > 0 && largest > imbalanceRatio*smallest {
+		s.warnf("Classes are unbalanced: the largest has %d samples, the smallest %d", largest, smallest)
+	}
+}
@@ -104,7 +104,8 @@ func (dn *DirectoryNavigator) ListDirectories() ([]string, error) {
 	}
 
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// Hidden folders, such as the staging area of uploads, are not model folders
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			directories = append(directories, entry.Name())
 		}
 	}
@@ -0,0 +1,159 @@
+package aiAgent
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reasons a training stopped early
+const (
+	EarlyStopTargetReached = "target_reached"
+	EarlyStopNoImprovement = "no_improvement"
+)
+
+// EarlyStopping stops a training once its validation accuracy reaches a target or its loss stopped
+// improving. The run then counts as completed.
+type EarlyStopping struct {
+	TargetAccuracy float64 `json:"target_accuracy,omitempty"` // Validation accuracy to stop at, in percent
+	Patience       int     `json:"patience,omitempty"`        // Epochs without a better loss before stopping
+	MinDelta       float64 `json:"min_delta,omitempty"`       // Smallest loss decrease that counts as better
+}
+
+// Validate checks that the early stopping options are usable
+func (e EarlyStopping) Validate() error {
+	if e.TargetAccuracy < 0 || e.TargetAccuracy > 100 {
+		return fmt.Errorf("early_stopping.target_accuracy must be a percentage between 0 and 100")
+	}
+	if e.Patience < 0 {
+		return fmt.Errorf("early_stopping.patience must not be negative")
+	}
+	if e.MinDelta < 0 {
+		return fmt.Errorf("early_stopping.min_delta must not be negative")
+	}
+	if e.TargetAccuracy == 0 && e.Patience == 0 {
+		return fmt.Errorf("early_stopping needs a target_accuracy or a patience")
+	}
+	return nil
+}
+
+// EarlyStop records why and when a training was stopped early
+type EarlyStop struct {
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Epoch     int       `json:"epoch"`
+	StoppedAt time.Time `json:"stopped_at"`
+}
+
+// EarlyStopCallback is told when a training is stopped early, e.g. to stop it on its agent
+type EarlyStopCallback func(trainingID string, userID int, stop EarlyStop)
+
+var earlyStopCallback EarlyStopCallback
+
+// SetEarlyStopCallback sets the function called when a training is stopped early
+func SetEarlyStopCallback(callback EarlyStopCallback) {
+	earlyStopCallback = callback
+}
+
+// earlyStopper watches the metrics of one training for the conditions of its early stopping options
+type earlyStopper struct {
+	options     EarlyStopping
+	bestLoss    float64
+	bestEpoch   int
+	lastEpoch   int
+	hasBestLoss bool
+}
+
+// observe checks a new metrics line and returns the early stop it calls for, if any
+func (s *earlyStopper) observe(m TrainingMetrics) *EarlyStop {
+	stop := func(reason, message string) *EarlyStop {
+		return &EarlyStop{Reason: reason, Message: message, Epoch: m.Epoch, StoppedAt: time.Now()}
+	}
+
+	// Accuracies are kept in the 0-1 range
+	if target := s.options.TargetAccuracy; target > 0 && m.ValAccuracy > 0 && m.ValAccuracy*100 >= target {
+		return stop(EarlyStopTargetReached, fmt.Sprintf("Validation accuracy reached %.2f%% at epoch %d, the target was %.2f%%", m.ValAccuracy*100, m.Epoch, target))
+	}
+
+	if s.options.Patience == 0 {
+		return nil
+	}
+	loss := m.ValLoss
+	if loss == 0 {
+		loss = m.TrainLoss
+	}
+	if loss <= 0 || m.Epoch <= 0 {
+		return nil
+	}
+	if !s.hasBestLoss || loss < s.bestLoss-s.options.MinDelta {
+		s.bestLoss, s.bestEpoch, s.hasBestLoss = loss, m.Epoch, true
+	}
+	if m.Epoch > s.lastEpoch {
+		s.lastEpoch = m.Epoch
+	}
+	// Scripts may report several lines per epoch, so patience counts epochs
+	if s.lastEpoch-s.bestEpoch >= s.options.Patience {
+		return stop(EarlyStopNoImprovement, fmt.Sprintf("Loss has not improved on %.4g (epoch %d) for %d epochs", s.bestLoss, s.bestEpoch, s.lastEpoch-s.bestEpoch))
+	}
+	return nil
+}
+
+// SetEarlyStopping sets the early stopping options of a training, nil to never stop it early
+func (tp *TrainingProgress) SetEarlyStopping(options *EarlyStopping) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.EarlyStopping = options
+	tp.earlyStopper = nil
+	if options != nil {
+		tp.earlyStopper = &earlyStopper{options: *options}
+	}
+}
+
+// checkEarlyStopLocked runs the early stopper on a new metrics line and returns the early stop it
+// decided, once per run. The caller must hold tp.mu.
+func (tp *TrainingProgress) checkEarlyStopLocked(metrics TrainingMetrics) *EarlyStop {
+	if tp.earlyStopper == nil || tp.EarlyStop != nil {
+		return nil
+	}
+	stop := tp.earlyStopper.observe(metrics)
+	if stop != nil {
+		tp.EarlyStop = stop
+	}
+	return stop
+}
+
+// EarlyStopped returns why a training was stopped early, or nil
+func (tp *TrainingProgress) EarlyStopped() *EarlyStop {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.EarlyStop
+}
+
+// reportEarlyStop broadcasts an early stop as a "training_early_stop" event and passes it to the
+// early stop callback
+func reportEarlyStop(trainingID string, userID int, stop *EarlyStop) {
+	if stop == nil {
+		return
+	}
+	println("🏁 [EARLY STOP]", trainingID+":", stop.Message)
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "training_early_stop", stop)
+	}
+	if earlyStopCallback != nil {
+		earlyStopCallback(trainingID, userID, *stop)
+	}
+}
+
+// handleEarlyStop reports the early stop of a server training and sends its script SIGTERM
+func (t *Trainer) handleEarlyStop(trainingID string, progress *TrainingProgress, stop *EarlyStop) {
+	if stop == nil {
+		return
+	}
+	reportEarlyStop(trainingID, progress.UserID, stop)
+
+	t.jobs.mu.Lock()
+	defer t.jobs.mu.Unlock()
+	if job, ok := t.jobs.running[trainingID]; ok && !job.evicted {
+		println("🛑 [EARLY STOP] Stopping training", trainingID)
+		job.cancel()
+	}
+}
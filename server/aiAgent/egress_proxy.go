@@ -0,0 +1,139 @@
+package aiAgent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// egressDialTimeout bounds the connections the egress proxy opens for a training
+const egressDialTimeout = 30 * time.Second
+
+// egressProxy is the HTTP proxy an allowlist training's traffic goes through. It tunnels CONNECT
+// requests and forwards plain HTTP requests to allowed hosts, and records every attempt.
+type egressProxy struct {
+	listener net.Listener
+	server   *http.Server
+	policy   NetworkPolicy
+	progress *TrainingProgress
+}
+
+// startEgressProxy listens on a loopback port for the trainings of progress
+func startEgressProxy(policy NetworkPolicy, progress *TrainingProgress) (*egressProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start egress proxy: %w", err)
+	}
+	p := &egressProxy{listener: listener, policy: policy, progress: progress}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 10 * time.Second}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// URL is the proxy URL to give the training
+func (p *egressProxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Env returns the variables pointing HTTP clients (pip, requests, urllib, curl, huggingface_hub) at the proxy
+func (p *egressProxy) Env() []string {
+	url := p.URL()
+	return []string{
+		"HTTP_PROXY=" + url, "HTTPS_PROXY=" + url,
+		"http_proxy=" + url, "https_proxy=" + url,
+		"NO_PROXY=", "no_proxy=",
+	}
+}
+
+// Close stops the proxy and its open tunnels
+func (p *egressProxy) Close() {
+	p.server.Close()
+}
+
+// allow checks and records a connection to hostport
+func (p *egressProxy) allow(hostport, defaultPort string) bool {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, defaultPort
+	}
+	allowed := p.policy.Allows(host)
+	p.progress.RecordEgressAttempt(host, port, allowed)
+	if !allowed {
+		fmt.Printf("🚫 [EGRESS] %s blocked connection to %s:%s\n", p.progress.TrainingID, host, port)
+	}
+	return allowed
+}
+
+func (p *egressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if r.URL.Host == "" {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+	if !p.allow(r.URL.Host, "80") {
+		http.Error(w, "blocked by the training network policy", http.StatusForbidden)
+		return
+	}
+
+	out := r.Clone(context.Background())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	out.Header.Del("Proxy-Authorization")
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel connects a CONNECT request to its allowed destination
+func (p *egressProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	if !p.allow(r.Host, "443") {
+		http.Error(w, "blocked by the training network policy", http.StatusForbidden)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", r.Host, egressDialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+	go func() {
+		defer upstream.Close()
+		if n := buffered.Reader.Buffered(); n > 0 {
+			data, _ := buffered.Reader.Peek(n)
+			upstream.Write(data)
+		}
+		io.Copy(upstream, client)
+	}()
+	go func() {
+		defer client.Close()
+		io.Copy(client, upstream)
+	}()
+}
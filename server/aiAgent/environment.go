@@ -0,0 +1,169 @@
+package aiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"server/internal/repository"
+)
+
+// Where an environment snapshot was captured
+const (
+	EnvironmentSourceServer = "server"
+	EnvironmentSourceAgent  = "agent"
+)
+
+// environmentCaptureTimeout bounds the pip freeze and CUDA detection after a training
+const environmentCaptureTimeout = 90 * time.Second
+
+// EnvironmentCaptureScript prints the Python version, platform, CUDA version and
+// pip freeze of the interpreter running it as one JSON object.
+// The training agent runs the same script with the interpreter it trained with.
+const EnvironmentCaptureScript = `
+import json, platform, re, subprocess, sys
+info = {"python_version": platform.python_version(), "platform": platform.platform(), "packages": [], "cuda_version": None}
+try:
+    out = subprocess.run([sys.executable, "-m", "pip", "freeze"], capture_output=True, text=True, timeout=60)
+    info["packages"] = [l.strip() for l in out.stdout.splitlines() if l.strip()]
+except Exception:
+    pass
+try:
+    import torch
+    info["cuda_version"] = torch.version.cuda
+except Exception:
+    pass
+if not info["cuda_version"]:
+    try:
+        out = subprocess.run(["nvcc", "--version"], capture_output=True, text=True, timeout=10)
+        m = re.search(r"release ([0-9.]+)", out.stdout)
+        info["cuda_version"] = m.group(1) if m else None
+    except Exception:
+        pass
+print(json.dumps(info))
+`
+
+// EnvironmentSnapshot is the environment a training ran in
+type EnvironmentSnapshot struct {
+	Source        string    `json:"source"`
+	PythonVersion string    `json:"python_version"`
+	CUDAVersion   string    `json:"cuda_version,omitempty"`
+	Platform      string    `json:"platform,omitempty"`
+	Packages      []string  `json:"packages"`
+	CapturedAt    time.Time `json:"captured_at"`
+}
+
+// ParseEnvironmentSnapshot decodes the output of EnvironmentCaptureScript (or the agent's
+// "environment" object), ignoring anything printed before the JSON line
+func ParseEnvironmentSnapshot(data []byte, source string) (*EnvironmentSnapshot, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var raw struct {
+		PythonVersion string   `json:"python_version"`
+		CUDAVersion   *string  `json:"cuda_version"`
+		Platform      string   `json:"platform"`
+		Packages      []string `json:"packages"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(lines[len(lines)-1])), &raw); err != nil {
+		return nil, fmt.Errorf("invalid environment snapshot: %w", err)
+	}
+	if raw.PythonVersion == "" {
+		return nil, fmt.Errorf("environment snapshot has no python_version")
+	}
+
+	snapshot := &EnvironmentSnapshot{
+		Source:        source,
+		PythonVersion: raw.PythonVersion,
+		Platform:      raw.Platform,
+		Packages:      raw.Packages,
+		CapturedAt:    time.Now(),
+	}
+	if raw.CUDAVersion != nil {
+		snapshot.CUDAVersion = *raw.CUDAVersion
+	}
+	if snapshot.Packages == nil {
+		snapshot.Packages = []string{}
+	}
+	return snapshot, nil
+}
+
+// CaptureEnvironment runs EnvironmentCaptureScript with the given interpreter
+func CaptureEnvironment(ctx context.Context, pythonCmd, workingDir string, env []string) (*EnvironmentSnapshot, error) {
+	return captureEnvironment(ctx, hostPython(pythonCmd, workingDir, env))
+}
+
+// captureEnvironment is CaptureEnvironment with the interpreter run by run
+func captureEnvironment(ctx context.Context, run pythonRunner) (*EnvironmentSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, environmentCaptureTimeout)
+	defer cancel()
+
+	output, err := run(ctx, "-c", EnvironmentCaptureScript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture environment: %w", err)
+	}
+	return ParseEnvironmentSnapshot(output, EnvironmentSourceServer)
+}
+
+// SetEnvironment stores the environment snapshot of a run
+func (tp *TrainingProgress) SetEnvironment(snapshot *EnvironmentSnapshot) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.Environment = snapshot
+}
+
+// GetEnvironment returns the environment snapshot of a run, or nil if none was captured
+func (tp *TrainingProgress) GetEnvironment() *EnvironmentSnapshot {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.Environment
+}
+
+// SaveEnvironment persists an environment snapshot for a training run
+func SaveEnvironment(ctx context.Context, trainingID string, snapshot *EnvironmentSnapshot) error {
+	return repository.SaveTrainingEnvironment(ctx, trainingID, snapshot.Source, snapshot.PythonVersion,
+		snapshot.CUDAVersion, snapshot.Platform, snapshot.Packages)
+}
+
+// captureRunEnvironment records the environment of a successful server training
+func (t *Trainer) captureRunEnvironment(trainingID string, req TrainingRequest, absWorkingDir string, progress *TrainingProgress) {
+	snapshot, err := captureEnvironment(context.Background(), t.runPython(trainingID, "environment", req, absWorkingDir))
+	if err != nil {
+		println("⚠️  [EXECUTE] Could not capture environment:", err.Error())
+		return
+	}
+	progress.SetEnvironment(snapshot)
+	println(fmt.Sprintf("📦 [EXECUTE] Captured environment: Python %s, %d packages", snapshot.PythonVersion, len(snapshot.Packages)))
+
+	if err := SaveEnvironment(context.Background(), trainingID, snapshot); err != nil {
+		println("⚠️  [EXECUTE] Failed to save environment:", err.Error())
+	}
+}
+
+// RequirementsLock renders a pinned requirements file for the environment.
+// Requirements that point to local files or editable installs cannot be reinstalled
+// elsewhere and are kept as comments.
+func RequirementsLock(trainingID string, snapshot *EnvironmentSnapshot) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# requirements.lock for training %s\n", trainingID)
+	fmt.Fprintf(&b, "# Python %s", snapshot.PythonVersion)
+	if snapshot.CUDAVersion != "" {
+		fmt.Fprintf(&b, " | CUDA %s", snapshot.CUDAVersion)
+	}
+	if snapshot.Platform != "" {
+		fmt.Fprintf(&b, " | %s", snapshot.Platform)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "# Captured on the %s at %s\n", snapshot.Source, snapshot.CapturedAt.UTC().Format(time.RFC3339))
+	b.WriteString("# Reproduce with: python -m pip install -r requirements.lock\n\n")
+
+	for _, pkg := range snapshot.Packages {
+		if strings.HasPrefix(pkg, "-e ") || strings.Contains(pkg, " @ file://") {
+			fmt.Fprintf(&b, "# not installable from an index: %s\n", pkg)
+			continue
+		}
+		b.WriteString(pkg)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
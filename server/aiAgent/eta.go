@@ -0,0 +1,97 @@
+package aiAgent
+
+import (
+	"math"
+	"time"
+)
+
+// etaSmoothing is the weight of the newest epoch duration in the smoothed average
+const etaSmoothing = 0.3
+
+// etaEstimator keeps a smoothed average of epoch durations to estimate when a training finishes
+type etaEstimator struct {
+	lastEpoch   int
+	lastEpochAt time.Time
+	avgEpoch    time.Duration
+}
+
+// observe records that epoch was reached at now. Several lines for the same epoch are ignored,
+// and an epoch counter that goes back (e.g. a new pipeline stage) starts a new baseline.
+func (e *etaEstimator) observe(epoch int, now time.Time, start time.Time) {
+	if epoch <= 0 || epoch == e.lastEpoch {
+		return
+	}
+	if epoch < e.lastEpoch {
+		e.lastEpoch, e.lastEpochAt = epoch, now
+		return
+	}
+
+	// Without a baseline yet, count from the start of the run
+	since := e.lastEpochAt
+	if since.IsZero() {
+		since = start
+	}
+	if since.IsZero() || !now.After(since) {
+		e.lastEpoch, e.lastEpochAt = epoch, now
+		return
+	}
+
+	duration := now.Sub(since) / time.Duration(epoch-e.lastEpoch)
+	if e.avgEpoch == 0 {
+		e.avgEpoch = duration
+	} else {
+		e.avgEpoch = time.Duration(etaSmoothing*float64(duration) + (1-etaSmoothing)*float64(e.avgEpoch))
+	}
+	e.lastEpoch, e.lastEpochAt = epoch, now
+}
+
+// restart moves the baseline to now, so time spent queued or preempted does not count as an epoch
+func (e *etaEstimator) restart(now time.Time) {
+	e.lastEpochAt = now
+}
+
+// remaining estimates the time left until totalEpochs, counted from the last observed epoch
+func (e *etaEstimator) remaining(totalEpochs int) (time.Duration, bool) {
+	if e.avgEpoch <= 0 || totalEpochs <= 0 || e.lastEpoch <= 0 {
+		return 0, false
+	}
+	left := totalEpochs - e.lastEpoch
+	if left < 0 {
+		left = 0
+	}
+	return time.Duration(left) * e.avgEpoch, true
+}
+
+// updateETALocked recomputes the estimated time remaining after a metrics update. The caller must hold tp.mu.
+func (tp *TrainingProgress) updateETALocked(epoch int) {
+	now := time.Now()
+	tp.eta.observe(epoch, now, tp.StartTime)
+	remaining, ok := tp.eta.remaining(tp.TotalEpochs)
+	if !ok {
+		return
+	}
+	seconds := int(math.Round(remaining.Seconds()))
+	completion := tp.eta.lastEpochAt.Add(remaining)
+	tp.ETASeconds = &seconds
+	tp.EstimatedCompletion = &completion
+}
+
+// clearETALocked removes the estimate once a training has stopped. The caller must hold tp.mu.
+func (tp *TrainingProgress) clearETALocked() {
+	tp.ETASeconds = nil
+	tp.EstimatedCompletion = nil
+}
+
+// progressUpdateLocked builds the payload of a "progress" broadcast. The caller must hold tp.mu.
+func (tp *TrainingProgress) progressUpdateLocked() map[string]interface{} {
+	update := map[string]interface{}{
+		"status":        tp.Status,
+		"current_epoch": tp.CurrentEpoch,
+		"total_epochs":  tp.TotalEpochs,
+	}
+	if tp.ETASeconds != nil {
+		update["eta_seconds"] = *tp.ETASeconds
+		update["estimated_completion"] = tp.EstimatedCompletion
+	}
+	return update
+}
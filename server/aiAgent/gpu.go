@@ -0,0 +1,209 @@
+package aiAgent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GPU configuration environment variables.
+// TRAINING_GPUS overrides discovery with a comma-separated list of device indexes or UUIDs.
+// TRAINING_USE_MIG=true schedules jobs onto MIG partitions instead of whole GPUs.
+// TRAINING_JOBS_PER_GPU is how many jobs a device takes before the next device is preferred.
+const (
+	TrainingGPUsEnv       = "TRAINING_GPUS"
+	TrainingUseMIGEnv     = "TRAINING_USE_MIG"
+	TrainingJobsPerGPUEnv = "TRAINING_JOBS_PER_GPU"
+)
+
+// GPUDevice is a schedulable device: a whole GPU or a MIG partition
+type GPUDevice struct {
+	ID        string `json:"id"` // Value used in CUDA_VISIBLE_DEVICES
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	UUID      string `json:"uuid,omitempty"`
+	MIG       bool   `json:"mig"`
+	ParentGPU int    `json:"parent_gpu"`
+}
+
+// GPUAllocation is the device a training was scheduled on
+type GPUAllocation struct {
+	Device GPUDevice `json:"device"`
+	// Shared is true when every device was busy and the job was placed next to another one
+	Shared bool `json:"shared"`
+}
+
+// GPUStatus is the occupancy of a device
+type GPUStatus struct {
+	GPUDevice
+	ActiveJobs int `json:"active_jobs"`
+	Capacity   int `json:"capacity"`
+}
+
+// GPUAllocator assigns trainings to GPUs and tracks per-device occupancy
+type GPUAllocator struct {
+	once       sync.Once
+	devices    []GPUDevice
+	jobsPerGPU int
+	occupancy  map[string]map[string]bool // device ID -> training IDs
+	mu         sync.Mutex
+}
+
+// NewGPUAllocator creates an allocator; devices are discovered on first use
+func NewGPUAllocator() *GPUAllocator {
+	return &GPUAllocator{occupancy: make(map[string]map[string]bool)}
+}
+
+var (
+	nvidiaGPULine = regexp.MustCompile(`^GPU (\d+): (.+?) \(UUID: ([^)]+)\)`)
+	nvidiaMIGLine = regexp.MustCompile(`^\s+MIG (.+?)\s+Device\s+(\d+): \(UUID: ([^)]+)\)`)
+)
+
+// parseNvidiaSMIList parses `nvidia-smi -L` output into whole GPUs and their MIG partitions
+func parseNvidiaSMIList(output string, useMIG bool) []GPUDevice {
+	var gpus []GPUDevice
+	migs := make(map[int][]GPUDevice)
+
+	current := -1
+	for _, line := range strings.Split(output, "\n") {
+		if m := nvidiaGPULine.FindStringSubmatch(line); m != nil {
+			index, _ := strconv.Atoi(m[1])
+			current = index
+			gpus = append(gpus, GPUDevice{ID: m[1], Index: index, Name: m[2], UUID: m[3], ParentGPU: index})
+			continue
+		}
+		if m := nvidiaMIGLine.FindStringSubmatch(line); m != nil && current >= 0 {
+			index, _ := strconv.Atoi(m[2])
+			migs[current] = append(migs[current], GPUDevice{
+				ID:        m[3], // MIG devices are selected by UUID
+				Index:     index,
+				Name:      "MIG " + m[1],
+				UUID:      m[3],
+				MIG:       true,
+				ParentGPU: current,
+			})
+		}
+	}
+
+	if !useMIG {
+		return gpus
+	}
+	var devices []GPUDevice
+	for _, gpu := range gpus {
+		if partitions := migs[gpu.Index]; len(partitions) > 0 {
+			devices = append(devices, partitions...)
+		} else {
+			devices = append(devices, gpu)
+		}
+	}
+	return devices
+}
+
+func (a *GPUAllocator) discover() {
+	a.jobsPerGPU = 1
+	if n, err := strconv.Atoi(os.Getenv(TrainingJobsPerGPUEnv)); err == nil && n > 0 {
+		a.jobsPerGPU = n
+	}
+
+	if configured := strings.TrimSpace(os.Getenv(TrainingGPUsEnv)); configured != "" {
+		for i, id := range strings.Split(configured, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			device := GPUDevice{ID: id, Index: i, Name: "GPU " + id, ParentGPU: i}
+			if strings.HasPrefix(id, "MIG-") {
+				device.MIG, device.UUID, device.Name = true, id, "MIG "+id
+			}
+			a.devices = append(a.devices, device)
+		}
+		println("🎮 [GPU] Using", len(a.devices), "configured devices from", TrainingGPUsEnv)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "nvidia-smi", "-L").Output()
+	if err != nil {
+		println("ℹ️  [GPU] No NVIDIA GPUs found, trainings run without a GPU assignment")
+		return
+	}
+	useMIG, _ := strconv.ParseBool(os.Getenv(TrainingUseMIGEnv))
+	a.devices = parseNvidiaSMIList(string(output), useMIG)
+	println("🎮 [GPU] Discovered", len(a.devices), "devices (MIG:", useMIG, ")")
+}
+
+// Acquire assigns the least occupied device to a training. It returns nil when there are no GPUs.
+func (a *GPUAllocator) Acquire(trainingID string) *GPUAllocation {
+	a.once.Do(a.discover)
+	if len(a.devices) == 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	best := 0
+	for i, device := range a.devices {
+		if len(a.occupancy[device.ID]) < len(a.occupancy[a.devices[best].ID]) {
+			best = i
+		}
+	}
+	device := a.devices[best]
+	if a.occupancy[device.ID] == nil {
+		a.occupancy[device.ID] = make(map[string]bool)
+	}
+	shared := len(a.occupancy[device.ID]) >= a.jobsPerGPU
+	a.occupancy[device.ID][trainingID] = true
+
+	if shared {
+		println("⚠️  [GPU] All devices are busy, sharing", device.Name, "with training", trainingID)
+	} else {
+		println("🎮 [GPU] Assigned", device.Name, "to training", trainingID)
+	}
+	return &GPUAllocation{Device: device, Shared: shared}
+}
+
+// Release frees the device held by a training
+func (a *GPUAllocator) Release(trainingID string, allocation *GPUAllocation) {
+	if allocation == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.occupancy[allocation.Device.ID], trainingID)
+}
+
+// Status returns the occupancy of every device
+func (a *GPUAllocator) Status() []GPUStatus {
+	a.once.Do(a.discover)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	statuses := make([]GPUStatus, 0, len(a.devices))
+	for _, device := range a.devices {
+		statuses = append(statuses, GPUStatus{
+			GPUDevice:  device,
+			ActiveJobs: len(a.occupancy[device.ID]),
+			Capacity:   a.jobsPerGPU,
+		})
+	}
+	return statuses
+}
+
+// Capacity is how many jobs the devices take before they are shared, 0 when there are no GPUs
+func (a *GPUAllocator) Capacity() int {
+	a.once.Do(a.discover)
+	return len(a.devices) * a.jobsPerGPU
+}
+
+// GPUStatus returns the occupancy of the server's GPUs
+func (t *Trainer) GPUStatus() []GPUStatus {
+	return t.gpus.Status()
+}
@@ -0,0 +1,177 @@
+package aiAgent
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// AgentHardware is the hardware an agent reported in its system info
+type AgentHardware struct {
+	Hostname       string  `json:"hostname"`
+	Platform       string  `json:"platform"`
+	PythonVersion  string  `json:"python_version,omitempty"`
+	PyTorchVersion string  `json:"pytorch_version,omitempty"`
+	CUDAAvailable  bool    `json:"cuda_available"`
+	GPUCount       int     `json:"gpu_count"`
+	GPUName        string  `json:"gpu_name,omitempty"`
+	GPUMemoryGB    float64 `json:"gpu_memory_gb,omitempty"`
+	CPUCount       int     `json:"cpu_count,omitempty"`
+	// MemoryGB is the machine's RAM, 0 when the agent did not report it
+	MemoryGB float64 `json:"memory_gb,omitempty"`
+}
+
+// ParseAgentHardware reads the system info of an agent. Missing or malformed fields stay zero.
+func ParseAgentHardware(info map[string]interface{}) AgentHardware {
+	text := func(key string) string {
+		value, _ := info[key].(string)
+		return strings.TrimSpace(value)
+	}
+	number := func(key string) float64 {
+		switch value := info[key].(type) {
+		case float64:
+			return value
+		case int:
+			return float64(value)
+		}
+		return 0
+	}
+
+	hardware := AgentHardware{
+		Hostname:       text("hostname"),
+		Platform:       text("platform"),
+		PythonVersion:  text("python_version"),
+		PyTorchVersion: text("pytorch_version"),
+		GPUCount:       int(number("gpu_count")),
+		GPUName:        text("gpu_name"),
+		GPUMemoryGB:    number("gpu_memory_gb"),
+		CPUCount:       int(number("cpu_count")),
+		MemoryGB:       number("memory_gb"),
+	}
+	if hardware.Platform == "" {
+		hardware.Platform = text("os")
+	}
+	if cuda, ok := info["cuda_available"].(bool); ok {
+		hardware.CUDAAvailable = cuda
+	} else {
+		hardware.CUDAAvailable = hardware.GPUCount > 0
+	}
+	if !hardware.CUDAAvailable {
+		hardware.GPUCount = 0
+	}
+	if hardware.GPUName == "None" {
+		hardware.GPUName = ""
+	}
+	return hardware
+}
+
+// ServerHardware returns the hardware server trainings run on
+func (t *Trainer) ServerHardware() AgentHardware {
+	hardware := AgentHardware{Platform: runtime.GOOS, CPUCount: runtime.NumCPU()}
+	for _, device := range t.gpus.Status() {
+		hardware.GPUCount++
+		if hardware.GPUName == "" {
+			hardware.GPUName = device.Name
+		}
+	}
+	hardware.CUDAAvailable = hardware.GPUCount > 0
+	return hardware
+}
+
+// HardwareRequirements is what a training needs from the machine it runs on. aimanage.json can
+// declare them under "hardware"; otherwise they are inferred from the training scripts.
+type HardwareRequirements struct {
+	// CUDA trainings cannot run without a CUDA GPU
+	CUDA        bool    `json:"cuda,omitempty"`
+	MinGPUs     int     `json:"min_gpus,omitempty"`
+	MinMemoryGB float64 `json:"min_memory_gb,omitempty"`
+	// PreferGPU trainings run anywhere but are faster on a GPU
+	PreferGPU bool   `json:"prefer_gpu,omitempty"`
+	Framework string `json:"framework,omitempty"`
+	// Source is "config" when aimanage.json declares the requirements, "script" when they were inferred
+	Source string `json:"source,omitempty"`
+}
+
+// Satisfies returns why the hardware cannot run a training with the requirements, or nil if it can.
+// Memory the machine did not report is not checked.
+func (h AgentHardware) Satisfies(req HardwareRequirements) error {
+	if req.CUDA && !h.CUDAAvailable {
+		return fmt.Errorf("needs a CUDA GPU")
+	}
+	if req.MinGPUs > 0 && h.GPUCount < req.MinGPUs {
+		return fmt.Errorf("needs %d GPUs, has %d", req.MinGPUs, h.GPUCount)
+	}
+	if req.MinMemoryGB > 0 && h.MemoryGB > 0 && h.MemoryGB < req.MinMemoryGB {
+		return fmt.Errorf("needs %.0f GB of memory, has %.0f GB", req.MinMemoryGB, h.MemoryGB)
+	}
+	return nil
+}
+
+var (
+	pytorchImport    = regexp.MustCompile(`(?m)^\s*(import|from)\s+torch\b`)
+	tensorflowImport = regexp.MustCompile(`(?m)^\s*(import|from)\s+(tensorflow|keras)\b`)
+	cudaUse          = regexp.MustCompile(`\.cuda\(|["']cuda(:\d+)?["']`)
+)
+
+// InferHardwareRequirements guesses what a training script needs. PyTorch and TensorFlow scripts
+// prefer a GPU, and PyTorch scripts that move work to CUDA without checking it is available need one.
+func InferHardwareRequirements(script string) HardwareRequirements {
+	req := HardwareRequirements{Source: "script"}
+	switch {
+	case pytorchImport.MatchString(script):
+		req.Framework = "pytorch"
+		req.PreferGPU = true
+		req.CUDA = cudaUse.MatchString(script) && !strings.Contains(script, "cuda.is_available()")
+	case tensorflowImport.MatchString(script):
+		req.Framework = "tensorflow"
+		req.PreferGPU = true
+	}
+	return req
+}
+
+// merge combines the requirements of two scripts of the same training
+func (r HardwareRequirements) merge(other HardwareRequirements) HardwareRequirements {
+	r.CUDA = r.CUDA || other.CUDA
+	r.PreferGPU = r.PreferGPU || other.PreferGPU
+	if r.Framework == "" {
+		r.Framework = other.Framework
+	}
+	return r
+}
+
+// TrainingRequirements returns the hardware requirements of training scriptName in a model
+// folder, or of every stage when aimanage.json declares a pipeline
+func (t *Trainer) TrainingRequirements(folderName, scriptName string) (HardwareRequirements, error) {
+	config, err := LoadModelConfig(filepath.Join(t.navigator.BaseUploadPath, folderName))
+	if err != nil {
+		return HardwareRequirements{}, err
+	}
+	if config != nil && config.Hardware != nil {
+		req := *config.Hardware
+		req.Source = "config"
+		if req.MinGPUs > 0 {
+			req.CUDA = true
+		}
+		return req, nil
+	}
+
+	scripts := []string{scriptName}
+	if config != nil && config.Pipeline != nil {
+		scripts = scripts[:0]
+		for _, stage := range config.Pipeline.Stages {
+			scripts = append(scripts, stage.Script)
+		}
+	}
+	req := HardwareRequirements{Source: "script"}
+	for _, script := range scripts {
+		content, err := t.navigator.GetFileContent(folderName, script)
+		if err != nil {
+			// The trainer reports missing scripts once the training starts
+			continue
+		}
+		req = req.merge(InferHardwareRequirements(string(content)))
+	}
+	return req, nil
+}
@@ -0,0 +1,152 @@
+package aiAgent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Hyperparameters are passed to training scripts as JSON in HyperparametersEnv and in the file named
+// by HyperparametersFileEnv, and also as "--key value" flags with HyperparameterFormatArgs
+const (
+	HyperparametersEnv     = "AIMANAGE_HYPERPARAMETERS"
+	HyperparametersFileEnv = "AIMANAGE_HYPERPARAMETERS_FILE"
+
+	HyperparameterFormatJSON = "json"
+	HyperparameterFormatArgs = "args"
+)
+
+// maxHyperparameters is the most hyperparameters a training can be started with
+const maxHyperparameters = 50
+
+// hyperparameterKey is the form of hyperparameter names, which must also be valid flag names
+var hyperparameterKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,63}$`)
+
+// hyperparameterRange bounds a well-known hyperparameter
+type hyperparameterRange struct {
+	integer  bool
+	min, max float64
+	minOpen  bool
+}
+
+// knownHyperparameters are the hyperparameters whose type and range are checked
+var knownHyperparameters = map[string]hyperparameterRange{
+	"epochs":        {integer: true, min: 1, max: 100000},
+	"batch_size":    {integer: true, min: 1, max: 1 << 20},
+	"learning_rate": {min: 0, max: 10, minOpen: true},
+}
+
+// ValidateHyperparameters checks the hyperparameters of a training and the format they are passed
+// in, and returns them normalized: epochs and batch_size are integers, learning_rate a number and
+// other keys strings, numbers or booleans.
+func ValidateHyperparameters(params map[string]interface{}, format string) (map[string]interface{}, error) {
+	if format != "" && format != HyperparameterFormatJSON && format != HyperparameterFormatArgs {
+		return nil, fmt.Errorf("hyperparameter_format must be '%s' or '%s'", HyperparameterFormatJSON, HyperparameterFormatArgs)
+	}
+	if len(params) > maxHyperparameters {
+		return nil, fmt.Errorf("at most %d hyperparameters are allowed", maxHyperparameters)
+	}
+
+	normalized := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if !hyperparameterKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid hyperparameter name %q: use letters, digits, '_', '.' and '-', starting with a letter", key)
+		}
+
+		switch v := value.(type) {
+		case string:
+			if len(v) > 1024 {
+				return nil, fmt.Errorf("hyperparameter %s is longer than 1024 characters", key)
+			}
+		case bool:
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("hyperparameter %s must be a finite number", key)
+			}
+		case int:
+			value = float64(v)
+		default:
+			return nil, fmt.Errorf("hyperparameter %s must be a string, number or boolean", key)
+		}
+
+		if bounds, ok := knownHyperparameters[key]; ok {
+			number, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("hyperparameter %s must be a number", key)
+			}
+			if bounds.integer && number != math.Trunc(number) {
+				return nil, fmt.Errorf("hyperparameter %s must be an integer", key)
+			}
+			if bounds.minOpen && (number <= bounds.min || number > bounds.max) {
+				return nil, fmt.Errorf("hyperparameter %s must be above %g and at most %g", key, bounds.min, bounds.max)
+			}
+			if number < bounds.min || number > bounds.max {
+				return nil, fmt.Errorf("hyperparameter %s must be between %g and %g", key, bounds.min, bounds.max)
+			}
+			if bounds.integer {
+				value = int(number)
+			}
+		}
+		normalized[key] = value
+	}
+	return normalized, nil
+}
+
+// FormatHyperparameter returns the text of a hyperparameter value, as passed in a flag
+func FormatHyperparameter(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// HyperparameterArgs returns the hyperparameters as "--key value" flags sorted by key. True
+// booleans are bare flags and false ones are left out.
+func HyperparameterArgs(params map[string]interface{}) []string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		switch v := params[key].(type) {
+		case bool:
+			if v {
+				args = append(args, "--"+key)
+			}
+		default:
+			args = append(args, "--"+key, FormatHyperparameter(v))
+		}
+	}
+	return args
+}
+
+// writeHyperparametersFile writes the hyperparameters of a training to a JSON file in a new
+// temporary folder, which the caller removes once the training ended
+func writeHyperparametersFile(params map[string]interface{}) (string, error) {
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode hyperparameters: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "aimanage-hyperparameters-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create hyperparameters folder: %w", err)
+	}
+	path := filepath.Join(dir, "hyperparameters.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to write hyperparameters file: %w", err)
+	}
+	return path, nil
+}
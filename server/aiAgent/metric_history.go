@@ -0,0 +1,42 @@
+package aiAgent
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"server/internal/repository"
+)
+
+// trainingIDSuffix is the "_<unix time>" appended to a folder name to build a training ID
+var trainingIDSuffix = regexp.MustCompile(`_\d+$`)
+
+// ModelNameFromTrainingID returns the model folder a training ID was built from
+func ModelNameFromTrainingID(trainingID string) string {
+	return trainingIDSuffix.ReplaceAllString(trainingID, "")
+}
+
+// recordMetricHistory stores a metrics line in the background so past runs can be charted.
+// Only numeric custom metrics are kept.
+func recordMetricHistory(trainingID string, userID int, metrics TrainingMetrics) {
+	if trainingID == "" || userID == 0 {
+		return
+	}
+
+	custom := make(map[string]interface{})
+	for name, value := range metrics.CustomMetrics {
+		if number, ok := value.(float64); ok {
+			custom[name] = number
+		}
+	}
+	recordedAt := time.Now()
+
+	go func() {
+		err := repository.RecordTrainingMetrics(context.Background(), trainingID, userID, ModelNameFromTrainingID(trainingID),
+			metrics.Epoch, metrics.TotalEpochs, metrics.TrainLoss, metrics.ValLoss, metrics.TrainAccuracy, metrics.ValAccuracy,
+			metrics.TestAccuracy, custom, recordedAt)
+		if err != nil {
+			println("⚠️  [METRICS] Failed to store metric history of", trainingID+":", err.Error())
+		}
+	}()
+}
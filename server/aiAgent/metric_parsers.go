@@ -0,0 +1,94 @@
+package aiAgent
+
+import (
+	"server/internal/metricparse"
+)
+
+// OutputMetrics is what a line of training output reported: the payload of a PROGRESS line, or
+// metrics read by one of the training's parsers
+type OutputMetrics struct {
+	// Progress is the payload of a PROGRESS line, for ParseProgressLine. Metrics is nil then.
+	Progress string
+	Metrics  *TrainingMetrics
+	// Parser names the parser that read the line, e.g. "keras" or "custom: <pattern name>"
+	Parser string
+}
+
+// SetMetricPatterns makes the training try a model's custom metric patterns before the built-in
+// parsers. Patterns that do not compile are ignored.
+func (tp *TrainingProgress) SetMetricPatterns(patterns []metricparse.Pattern) {
+	chain, err := metricparse.New(patterns)
+	if err != nil {
+		println("⚠️  [METRICS] Ignoring invalid metric patterns:", err.Error())
+		chain, _ = metricparse.New(nil)
+	}
+	tp.mu.Lock()
+	tp.metricParser = chain
+	tp.mu.Unlock()
+}
+
+// ParseOutput reads the metrics of a line of training output with the training's parsers. Lines
+// reporting a NaN or infinite loss are flagged with NonFiniteLossKey even if no parser read them.
+func (tp *TrainingProgress) ParseOutput(line string) []OutputMetrics {
+	tp.mu.Lock()
+	if tp.metricParser == nil {
+		tp.metricParser, _ = metricparse.New(nil)
+	}
+	chain := tp.metricParser
+	tp.mu.Unlock()
+
+	var outputs []OutputMetrics
+	for _, result := range chain.Parse(line) {
+		if result.Parser == "progress" {
+			outputs = append(outputs, OutputMetrics{Progress: result.Progress, Parser: result.Parser})
+			continue
+		}
+		metrics := metricsFromResult(result)
+		MarkNonFiniteLoss(line, metrics)
+		outputs = append(outputs, OutputMetrics{Metrics: metrics, Parser: result.Parser})
+	}
+	if len(outputs) == 0 {
+		metrics := &TrainingMetrics{CustomMetrics: make(map[string]interface{})}
+		if MarkNonFiniteLoss(line, metrics) {
+			outputs = append(outputs, OutputMetrics{Metrics: metrics, Parser: "generic"})
+		}
+	}
+	return outputs
+}
+
+// metricsFromResult converts what a parser read into training metrics. Accuracies above 1 are
+// percentages; test loss is reported as validation loss when there is none, like in PROGRESS lines.
+func metricsFromResult(result metricparse.Result) *TrainingMetrics {
+	metrics := &TrainingMetrics{
+		Epoch:         result.Epoch,
+		TotalEpochs:   result.TotalEpochs,
+		CustomMetrics: make(map[string]interface{}),
+	}
+	fraction := func(v float64) float64 {
+		if v > 1 {
+			return v / 100
+		}
+		return v
+	}
+	for name, value := range result.Values {
+		switch name {
+		case metricparse.TrainLoss:
+			metrics.TrainLoss = value
+		case metricparse.ValLoss:
+			metrics.ValLoss = value
+		case metricparse.TrainAccuracy:
+			metrics.TrainAccuracy = fraction(value)
+		case metricparse.ValAccuracy:
+			metrics.ValAccuracy = fraction(value)
+		case metricparse.TestAccuracy:
+			metrics.TestAccuracy = fraction(value)
+		case metricparse.TestLoss:
+		default:
+			metrics.CustomMetrics[name] = value
+		}
+	}
+	if _, ok := result.Values[metricparse.ValLoss]; !ok {
+		metrics.ValLoss = result.Values[metricparse.TestLoss]
+	}
+	return metrics
+}
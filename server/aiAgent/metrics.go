@@ -48,6 +48,13 @@ type DetailedMetrics struct {
 	AverageValAccuracy     float64 `json:"average_val_accuracy"`
 	ValAccuracyImprovement float64 `json:"val_accuracy_improvement_percent"`
 
+	// Primary Metric: the metric of record of the model, accuracy unless it declared another
+	PrimaryMetric            PrimaryMetric `json:"primary_metric"`
+	InitialPrimaryMetric     float64       `json:"initial_primary_metric"`
+	FinalPrimaryMetric       float64       `json:"final_primary_metric"`
+	BestPrimaryMetric        float64       `json:"best_primary_metric"`
+	PrimaryMetricImprovement float64       `json:"primary_metric_improvement_percent"` // Positive when the metric got better
+
 	// Test Metrics (if available)
 	TestAccuracy float64 `json:"test_accuracy,omitempty"`
 	TestLoss     float64 `json:"test_loss,omitempty"`
@@ -64,11 +71,12 @@ type DetailedMetrics struct {
 	PerformanceLevel string  `json:"performance_level"` // "excellent", "good", "fair", "poor"
 
 	// Chart Data (ready for React charts)
-	EpochData          []EpochMetric `json:"epoch_data"`
-	LossHistory        []float64     `json:"loss_history"`
-	ValLossHistory     []float64     `json:"val_loss_history"`
-	AccuracyHistory    []float64     `json:"accuracy_history"`
-	ValAccuracyHistory []float64     `json:"val_accuracy_history"`
+	EpochData            []EpochMetric `json:"epoch_data"`
+	LossHistory          []float64     `json:"loss_history"`
+	ValLossHistory       []float64     `json:"val_loss_history"`
+	AccuracyHistory      []float64     `json:"accuracy_history"`
+	ValAccuracyHistory   []float64     `json:"val_accuracy_history"`
+	PrimaryMetricHistory []float64     `json:"primary_metric_history"`
 
 	// Insights & Recommendations
 	Insights        []string `json:"insights"`
@@ -78,6 +86,10 @@ type DetailedMetrics struct {
 	// Model Files
 	ModelPath     string `json:"model_path,omitempty"`
 	HasCheckpoint bool   `json:"has_checkpoint"`
+
+	// Resource usage of the run, for graphs next to the loss curves
+	Resources       *ResourceSummary `json:"resources,omitempty"`
+	ResourceHistory []ResourceSample `json:"resource_history"`
 }
 
 // EpochMetric represents metrics for a single epoch (chart-ready)
@@ -93,20 +105,24 @@ type EpochMetric struct {
 // GenerateDetailedMetrics creates comprehensive metrics from training progress
 func GenerateDetailedMetrics(progress *TrainingProgress) *DetailedMetrics {
 	metrics := &DetailedMetrics{
-		TrainingStatus:     string(progress.Status),
-		StartTime:          progress.StartTime,
-		CompletedEpochs:    progress.CurrentEpoch,
-		TotalEpochs:        progress.TotalEpochs,
-		EpochData:          []EpochMetric{},
-		LossHistory:        []float64{},
-		ValLossHistory:     []float64{},
-		AccuracyHistory:    []float64{},
-		ValAccuracyHistory: []float64{},
-		Insights:           []string{},
-		Warnings:           []string{},
-		Recommendations:    []string{},
-		ModelPath:          progress.ModelPath,
-	}
+		TrainingStatus:       string(progress.Status),
+		StartTime:            progress.StartTime,
+		CompletedEpochs:      progress.CurrentEpoch,
+		TotalEpochs:          progress.TotalEpochs,
+		EpochData:            []EpochMetric{},
+		LossHistory:          []float64{},
+		ValLossHistory:       []float64{},
+		AccuracyHistory:      []float64{},
+		ValAccuracyHistory:   []float64{},
+		PrimaryMetric:        progress.GetPrimaryMetric(),
+		PrimaryMetricHistory: []float64{},
+		Insights:             []string{},
+		Warnings:             []string{},
+		Recommendations:      []string{},
+		ModelPath:            progress.ModelPath,
+		ResourceHistory:      progress.ResourceHistory(),
+	}
+	metrics.Resources = SummarizeResources(metrics.ResourceHistory)
 
 	if progress.EndTime != nil {
 		metrics.EndTime = *progress.EndTime
@@ -164,7 +180,7 @@ func GenerateDetailedMetrics(progress *TrainingProgress) *DetailedMetrics {
 	}
 	sort.Ints(sortedEpochs)
 
-	var trainLosses, valLosses, trainAccs, valAccs []float64
+	var trainLosses, valLosses, trainAccs, valAccs, primaryValues []float64
 
 	// Process deduplicated metrics
 	for _, epoch := range sortedEpochs {
@@ -194,7 +210,11 @@ func GenerateDetailedMetrics(progress *TrainingProgress) *DetailedMetrics {
 			valAccs = append(valAccs, m.ValAccuracy*100)
 			metrics.ValAccuracyHistory = append(metrics.ValAccuracyHistory, m.ValAccuracy*100)
 		}
+		if value, ok := metrics.PrimaryMetric.Value(*m); ok {
+			primaryValues = append(primaryValues, value)
+		}
 	}
+	metrics.PrimaryMetricHistory = append(metrics.PrimaryMetricHistory, primaryValues...)
 
 	// Calculate loss statistics
 	if len(trainLosses) > 0 {
@@ -246,6 +266,32 @@ func GenerateDetailedMetrics(progress *TrainingProgress) *DetailedMetrics {
 		}
 	}
 
+	// Calculate primary metric statistics; the final value of a finished training is the one of record
+	if len(primaryValues) > 0 {
+		metrics.InitialPrimaryMetric = primaryValues[0]
+		metrics.FinalPrimaryMetric = primaryValues[len(primaryValues)-1]
+		metrics.BestPrimaryMetric = primaryValues[0]
+		for _, value := range primaryValues[1:] {
+			if metrics.PrimaryMetric.Better(value, metrics.BestPrimaryMetric) {
+				metrics.BestPrimaryMetric = value
+			}
+		}
+	}
+	if final, ok := metrics.PrimaryMetric.Final(progress); ok {
+		if len(primaryValues) == 0 {
+			metrics.InitialPrimaryMetric = final
+			metrics.BestPrimaryMetric = final
+		}
+		metrics.FinalPrimaryMetric = final
+	}
+	if metrics.InitialPrimaryMetric != 0 {
+		change := (metrics.FinalPrimaryMetric - metrics.InitialPrimaryMetric) / math.Abs(metrics.InitialPrimaryMetric) * 100
+		if metrics.PrimaryMetric.Direction == MetricLowerIsBetter {
+			change = -change
+		}
+		metrics.PrimaryMetricImprovement = change
+	}
+
 	// Add test metrics if available
 	if progress.FinalMetrics != nil {
 		if progress.FinalMetrics.TestAccuracy > 0 {
@@ -287,8 +333,8 @@ func analyzeTrainingBehavior(metrics *DetailedMetrics, trainLosses, valLosses, t
 		}
 	}
 
-	// Check underfitting
-	if metrics.FinalAccuracy < 60 && metrics.FinalValAccuracy < 60 {
+	// Check underfitting (accuracy models only, other metrics have no absolute scale)
+	if metrics.PrimaryMetric.IsAccuracy() && metrics.FinalAccuracy < 60 && metrics.FinalValAccuracy < 60 {
 		metrics.IsUnderfitting = true
 		metrics.Warnings = append(metrics.Warnings, "Model may be underfitting (low accuracy on both train and validation)")
 	}
@@ -316,8 +362,17 @@ func generateInsights(metrics *DetailedMetrics, progress *TrainingProgress) {
 		metrics.Recommendations = append(metrics.Recommendations, "Increase number of epochs or adjust learning rate")
 	}
 
-	// Accuracy insights
-	if metrics.FinalValAccuracy > 90 {
+	// Primary metric insights: only accuracy has thresholds, other metrics are judged by their improvement
+	if !metrics.PrimaryMetric.IsAccuracy() {
+		metrics.Insights = append(metrics.Insights, fmt.Sprintf("Best %s: %.4g (final %.4g)",
+			metrics.PrimaryMetric, metrics.BestPrimaryMetric, metrics.FinalPrimaryMetric))
+		if metrics.PrimaryMetricImprovement > 0 {
+			metrics.Insights = append(metrics.Insights, fmt.Sprintf("%s improved by %.1f%%", metrics.PrimaryMetric.Name, metrics.PrimaryMetricImprovement))
+		} else if len(metrics.PrimaryMetricHistory) > 1 {
+			metrics.Warnings = append(metrics.Warnings, fmt.Sprintf("%s did not improve during training", metrics.PrimaryMetric.Name))
+			metrics.Recommendations = append(metrics.Recommendations, "Review data quality and model architecture")
+		}
+	} else if metrics.FinalValAccuracy > 90 {
 		metrics.Insights = append(metrics.Insights, fmt.Sprintf("Excellent validation accuracy: %.2f%%", metrics.FinalValAccuracy))
 	} else if metrics.FinalValAccuracy > 80 {
 		metrics.Insights = append(metrics.Insights, fmt.Sprintf("Good validation accuracy: %.2f%%", metrics.FinalValAccuracy))
@@ -360,8 +415,10 @@ func generateInsights(metrics *DetailedMetrics, progress *TrainingProgress) {
 func calculateOverallScore(metrics *DetailedMetrics) float64 {
 	score := 0.0
 
-	// Accuracy contribution (40 points)
-	if metrics.FinalValAccuracy > 0 {
+	// Primary metric contribution (40 points): accuracy as is, other metrics by their improvement
+	if !metrics.PrimaryMetric.IsAccuracy() {
+		score += math.Max(0, math.Min(metrics.PrimaryMetricImprovement, 100)) * 0.4
+	} else if metrics.FinalValAccuracy > 0 {
 		score += metrics.FinalValAccuracy * 0.4
 	}
 
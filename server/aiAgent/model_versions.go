@@ -0,0 +1,124 @@
+package aiAgent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"server/internal/repository"
+)
+
+// ModelVersionsDir holds, inside the uploads directory, a copy of the trained model of every model
+// version by model ID and version, so retraining never overwrites a previous version
+const ModelVersionsDir = "model_versions"
+
+// LatestMetrics returns the final metrics of a training, or its most recent metrics line when the
+// script reported no final metrics
+func (tp *TrainingProgress) LatestMetrics() *TrainingMetrics {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	if tp.FinalMetrics != nil {
+		metrics := *tp.FinalMetrics
+		return &metrics
+	}
+	if len(tp.Metrics) > 0 {
+		metrics := tp.Metrics[len(tp.Metrics)-1]
+		return &metrics
+	}
+	return nil
+}
+
+// RecordModelVersion records a completed training as the new active version of the models named
+// modelName and copies its trained model at modelPath (relative to uploadsDir) into the version.
+// Trained models that stayed on an agent's machine are recorded without a copy. Failures are logged.
+func RecordModelVersion(ctx context.Context, uploadsDir, modelName, trainingID, modelPath string, accuracy *float64, progress *TrainingProgress) {
+	metric := progress.GetPrimaryMetric()
+	var metricValue *float64
+	if value, ok := metric.Final(progress); ok {
+		metricValue = &value
+	}
+	snapshot := map[string]interface{}{}
+	if final := progress.LatestMetrics(); final != nil {
+		snapshot["final_metrics"] = final
+	}
+
+	versions, err := repository.CreateModelVersions(ctx, modelName, repository.NewModelVersion{
+		TrainingID:         trainingID,
+		SourcePath:         modelPath,
+		AccuracyScore:      accuracy,
+		PrimaryMetric:      metric.Name,
+		PrimaryMetricValue: metricValue,
+		Metrics:            snapshot,
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to record a version of model %s: %v", modelName, err)
+		return
+	}
+
+	source := filepath.Join(uploadsDir, modelPath)
+	if modelPath == "" || filepath.IsAbs(modelPath) {
+		source = ""
+	} else if info, err := os.Stat(source); err != nil || info.IsDir() {
+		source = ""
+	}
+	for _, version := range versions {
+		versionID, _ := version["id"].(int)
+		modelID, _ := version["model_id"].(int)
+		number, _ := version["version"].(int)
+		if source == "" {
+			log.Printf("📦 Recorded version %d of model %d without a copy of %q", number, modelID, modelPath)
+			continue
+		}
+
+		rel := filepath.Join(ModelVersionsDir, strconv.Itoa(modelID), strconv.Itoa(number), filepath.Base(modelPath))
+		size, sum, err := copyModelArtifact(source, filepath.Join(uploadsDir, rel))
+		if err != nil {
+			log.Printf("⚠️  Failed to copy the trained model of version %d of model %d: %v", number, modelID, err)
+			continue
+		}
+		if err := repository.SetModelVersionArtifact(ctx, versionID, filepath.ToSlash(rel), size, sum); err != nil {
+			log.Printf("⚠️  %v", err)
+			continue
+		}
+		// The ONNX export follows the version, so activating it later restores both formats
+		if export, ok := CurrentONNXExport(source); ok {
+			if _, _, err := copyModelArtifact(export, ONNXPath(filepath.Join(uploadsDir, rel))); err != nil {
+				log.Printf("⚠️  Failed to copy the ONNX export of version %d of model %d: %v", number, modelID, err)
+			}
+		}
+		log.Printf("📦 Recorded version %d of model %d: %s", number, modelID, rel)
+	}
+}
+
+// copyModelArtifact copies a trained model file and returns its size and SHA-256
+func copyModelArtifact(source, dest string) (int64, string, error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return 0, "", err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return 0, "", err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+		return 0, "", fmt.Errorf("failed to copy %s: %w", source, err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
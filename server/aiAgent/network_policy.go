@@ -0,0 +1,231 @@
+package aiAgent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"server/internal/repository"
+)
+
+// Network modes of server training sandboxes.
+// Open trainings use the server's network as is. None runs the script in its own network
+// namespace with only a loopback interface. Allowlist sends the script's traffic through an
+// egress proxy that only lets the allowed hosts through.
+const (
+	NetworkModeOpen      = "open"
+	NetworkModeNone      = "none"
+	NetworkModeAllowlist = "allowlist"
+)
+
+// Network policy environment variables of the deployment.
+// TRAINING_NETWORK_MODE is the mode of every server training (open by default); organizations
+// can only make it stricter. TRAINING_ALLOWED_HOSTS is the comma separated allowlist, where
+// "*.example.com" matches the subdomains of example.com.
+const (
+	TrainingNetworkModeEnv  = "TRAINING_NETWORK_MODE"
+	TrainingAllowedHostsEnv = "TRAINING_ALLOWED_HOSTS"
+)
+
+// maxEgressAttempts bounds the distinct destinations recorded per training
+const maxEgressAttempts = 200
+
+// NetworkPolicy restricts the network access of a server training
+type NetworkPolicy struct {
+	Mode         string   `json:"mode"`
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+	// Source is where the policy comes from: "deployment" or "organization:<id>"
+	Source string `json:"source,omitempty"`
+}
+
+// EgressAttempt is a destination a training connected or tried to connect to under a restricted policy
+type EgressAttempt struct {
+	Host      string    `json:"host"`
+	Port      string    `json:"port,omitempty"`
+	Allowed   bool      `json:"allowed"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// networkModeRank orders the modes from the most to the least permissive
+var networkModeRank = map[string]int{
+	NetworkModeOpen:      0,
+	NetworkModeAllowlist: 1,
+	NetworkModeNone:      2,
+}
+
+// ValidNetworkMode reports whether mode is a network mode
+func ValidNetworkMode(mode string) bool {
+	_, ok := networkModeRank[mode]
+	return ok
+}
+
+// NormalizeAllowedHosts lowercases and deduplicates an allowlist, rejecting entries that are not host names
+func NormalizeAllowedHosts(hosts []string) ([]string, error) {
+	seen := make(map[string]bool, len(hosts))
+	normalized := []string{}
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" || seen[host] {
+			continue
+		}
+		if !allowedHostPattern.MatchString(host) {
+			return nil, fmt.Errorf("%q is not a host name (use example.com or *.example.com)", host)
+		}
+		seen[host] = true
+		normalized = append(normalized, host)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+var allowedHostPattern = regexp.MustCompile(`^(\*\.)?[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// DeploymentNetworkPolicy returns the network policy the deployment applies to every server training
+func DeploymentNetworkPolicy() NetworkPolicy {
+	policy := NetworkPolicy{Mode: NetworkModeOpen, Source: "deployment"}
+	if mode := strings.ToLower(strings.TrimSpace(os.Getenv(TrainingNetworkModeEnv))); mode != "" {
+		if !ValidNetworkMode(mode) {
+			// Fail closed on a typo rather than leaving trainings on the network
+			fmt.Printf("⚠️  Invalid %s %q, server trainings run without network\n", TrainingNetworkModeEnv, mode)
+			mode = NetworkModeNone
+		}
+		policy.Mode = mode
+	}
+	if policy.Mode == NetworkModeAllowlist {
+		hosts, err := NormalizeAllowedHosts(strings.Split(os.Getenv(TrainingAllowedHostsEnv), ","))
+		if err != nil {
+			fmt.Printf("⚠️  Invalid %s: %v\n", TrainingAllowedHostsEnv, err)
+		}
+		policy.AllowedHosts = hosts
+	}
+	return policy
+}
+
+// Restricted reports whether the policy limits the network at all
+func (p NetworkPolicy) Restricted() bool {
+	return p.Mode == NetworkModeNone || p.Mode == NetworkModeAllowlist
+}
+
+// Allows reports whether the policy lets a training connect to host
+func (p NetworkPolicy) Allows(host string) bool {
+	switch p.Mode {
+	case NetworkModeNone:
+		return false
+	case NetworkModeAllowlist:
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		for _, allowed := range p.AllowedHosts {
+			if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+				if strings.HasSuffix(host, suffix) {
+					return true
+				}
+			} else if host == allowed {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// Stricter returns the stricter of two policies. Two allowlists only allow the hosts both allow.
+func (p NetworkPolicy) Stricter(other NetworkPolicy) NetworkPolicy {
+	if networkModeRank[other.Mode] > networkModeRank[p.Mode] {
+		return other
+	}
+	if networkModeRank[other.Mode] < networkModeRank[p.Mode] || p.Mode != NetworkModeAllowlist {
+		return p
+	}
+
+	both := []string{}
+	for _, host := range p.AllowedHosts {
+		for _, otherHost := range other.AllowedHosts {
+			if host == otherHost {
+				both = append(both, host)
+				break
+			}
+		}
+	}
+	return NetworkPolicy{Mode: NetworkModeAllowlist, AllowedHosts: both, Source: p.Source + "," + other.Source}
+}
+
+// RecordEgressAttempt adds a connection attempt of the training to its run record
+func (tp *TrainingProgress) RecordEgressAttempt(host, port string, allowed bool) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	now := time.Now()
+	for i := range tp.EgressAttempts {
+		attempt := &tp.EgressAttempts[i]
+		if attempt.Host == host && attempt.Port == port && attempt.Allowed == allowed {
+			attempt.Count++
+			attempt.LastSeen = now
+			return
+		}
+	}
+	if len(tp.EgressAttempts) >= maxEgressAttempts {
+		return
+	}
+	tp.EgressAttempts = append(tp.EgressAttempts, EgressAttempt{
+		Host: host, Port: port, Allowed: allowed, Count: 1, FirstSeen: now, LastSeen: now,
+	})
+}
+
+// EgressLog returns a copy of the egress attempts of the training
+func (tp *TrainingProgress) EgressLog() []EgressAttempt {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return append([]EgressAttempt(nil), tp.EgressAttempts...)
+}
+
+// blockedEgressPatterns find the destination of connection errors Python prints when a training
+// without network tries to reach a host (urllib3/requests, pip and socket errors)
+var blockedEgressPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`host='([^']+)', port=(\d+)`),
+	regexp.MustCompile(`Failed to resolve '([^']+)'`),
+	regexp.MustCompile(`connection to ([A-Za-z0-9.-]+) timed out`),
+}
+
+var networkErrorPattern = regexp.MustCompile(`(?i)network is unreachable|temporary failure in name resolution|name or service not known|failed to resolve|nodename nor servname`)
+
+// detectBlockedEgress records the connection attempt behind a network error in an output line of
+// a training that runs without network, where there is no proxy to see it
+func (tp *TrainingProgress) detectBlockedEgress(line string) {
+	tp.mu.RLock()
+	policy := tp.NetworkPolicy
+	tp.mu.RUnlock()
+	if policy == nil || policy.Mode != NetworkModeNone || !networkErrorPattern.MatchString(line) {
+		return
+	}
+
+	for _, pattern := range blockedEgressPatterns {
+		if match := pattern.FindStringSubmatch(line); match != nil {
+			port := ""
+			if len(match) > 2 {
+				port = match[2]
+			}
+			tp.RecordEgressAttempt(match[1], port, false)
+			return
+		}
+	}
+	tp.RecordEgressAttempt("unknown", "", false)
+}
+
+// saveEgressAttempts stores the egress attempts of a finished training in its run record
+func saveEgressAttempts(trainingID string, progress *TrainingProgress) {
+	progress.mu.RLock()
+	restricted := progress.NetworkPolicy != nil && progress.NetworkPolicy.Restricted()
+	progress.mu.RUnlock()
+	if !restricted {
+		return
+	}
+	if err := repository.SaveTrainingRunEgressAttempts(context.Background(), trainingID, progress.EgressLog()); err != nil {
+		fmt.Printf("⚠️  Failed to store the egress attempts of %s: %v\n", trainingID, err)
+	}
+}
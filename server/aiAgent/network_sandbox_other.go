@@ -0,0 +1,13 @@
+//go:build !linux
+
+package aiAgent
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// isolateNetwork needs Linux network namespaces; elsewhere trainings without network refuse to run
+func isolateNetwork(cmd *exec.Cmd) error {
+	return fmt.Errorf("the %s network mode needs a Linux server", NetworkModeNone)
+}
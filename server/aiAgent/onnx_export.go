@@ -0,0 +1,243 @@
+package aiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ONNX export environment variables.
+// TRAINING_ONNX_EXPORT=false turns the export of trained models to ONNX off.
+// ONNX_INPUT_SHAPE (e.g. "1,3,224,224") is the input shape PyTorch models are traced with. Trainings
+// set it in their env when it cannot be told from the model's first layer.
+const (
+	ONNXExportEnv     = "TRAINING_ONNX_EXPORT"
+	ONNXInputShapeEnv = "ONNX_INPUT_SHAPE"
+)
+
+// Outcomes of an ONNX export
+const (
+	ONNXExported = "exported"
+	ONNXSkipped  = "skipped"
+	ONNXFailed   = "failed"
+)
+
+// onnxExportTimeout bounds the conversion of a trained model
+const onnxExportTimeout = 10 * time.Minute
+
+// ONNXExportScript converts the trained model given as its first argument to ONNX, written to its
+// second argument, and prints the outcome as one JSON object. PyTorch models need torch (with onnx),
+// Keras models tf2onnx and scikit-learn models skl2onnx in the training environment.
+// The training agent runs the same script with the interpreter it trained with.
+const ONNXExportScript = `
+import json, os, sys
+src, dst = sys.argv[1], sys.argv[2]
+ext = os.path.splitext(src)[1].lower()
+tmp = dst + ".tmp"
+result = {"status": "skipped", "framework": None, "reason": None}
+
+def input_shape(model):
+    shape = os.environ.get("ONNX_INPUT_SHAPE", "").strip()
+    if shape:
+        return tuple(int(d) for d in shape.replace("x", ",").split(",") if d.strip())
+    import torch.nn as nn
+    for layer in model.modules():
+        if isinstance(layer, nn.Linear):
+            return (1, layer.in_features)
+        if isinstance(layer, nn.Conv1d):
+            return (1, layer.in_channels, 128)
+        if isinstance(layer, nn.Conv2d):
+            return (1, layer.in_channels, 224, 224)
+        if isinstance(layer, nn.Conv3d):
+            return (1, layer.in_channels, 16, 112, 112)
+    raise ValueError("cannot tell the input shape of the model, set ONNX_INPUT_SHAPE")
+
+try:
+    if ext in (".pt", ".pth"):
+        result["framework"] = "pytorch"
+        import torch
+        try:
+            model = torch.jit.load(src, map_location="cpu")
+        except Exception:
+            model = torch.load(src, map_location="cpu", weights_only=False)
+        if not isinstance(model, torch.nn.Module):
+            result["reason"] = "the file holds weights only, save the whole model to export it"
+        else:
+            model.eval()
+            dummy = torch.randn(*input_shape(model))
+            torch.onnx.export(model, dummy, tmp, input_names=["input"], output_names=["output"],
+                              dynamic_axes={"input": {0: "batch"}, "output": {0: "batch"}})
+            result["status"] = "exported"
+    elif ext in (".h5", ".keras"):
+        result["framework"] = "tensorflow"
+        import tensorflow as tf, tf2onnx
+        model = tf.keras.models.load_model(src)
+        tf2onnx.convert.from_keras(model, output_path=tmp)
+        result["status"] = "exported"
+    elif ext in (".pkl", ".joblib"):
+        result["framework"] = "sklearn"
+        try:
+            import joblib
+            model = joblib.load(src)
+        except ImportError:
+            import pickle
+            with open(src, "rb") as f:
+                model = pickle.load(f)
+        from skl2onnx import to_onnx
+        from skl2onnx.common.data_types import FloatTensorType
+        features = getattr(model, "n_features_in_", None)
+        if features is None:
+            raise ValueError("the model has no n_features_in_, fit it before saving")
+        onx = to_onnx(model, initial_types=[("input", FloatTensorType([None, int(features)]))])
+        with open(tmp, "wb") as f:
+            f.write(onx.SerializeToString())
+        result["status"] = "exported"
+    else:
+        result["reason"] = "no ONNX converter for %s files" % (ext or "extensionless")
+except Exception as e:
+    result["status"] = "failed"
+    result["reason"] = "%s: %s" % (type(e).__name__, e)
+if result["status"] == "exported":
+    os.replace(tmp, dst)
+elif os.path.exists(tmp):
+    os.remove(tmp)
+print(json.dumps(result))
+`
+
+// ONNXExport is the outcome of exporting a trained model to ONNX
+type ONNXExport struct {
+	Status    string `json:"status"`
+	Framework string `json:"framework,omitempty"`
+	Path      string `json:"path,omitempty"` // Relative to the uploads folder
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ONNXExportEnabled reports whether trained models are exported to ONNX
+func ONNXExportEnabled() bool {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(ONNXExportEnv)))
+	return value != "false" && value != "0"
+}
+
+// ONNXPath returns where the ONNX export of a trained model file is stored: next to it, with the
+// .onnx extension. It returns "" for models that already are ONNX.
+func ONNXPath(modelPath string) string {
+	ext := filepath.Ext(modelPath)
+	if strings.EqualFold(ext, ".onnx") {
+		return ""
+	}
+	return strings.TrimSuffix(modelPath, ext) + ".onnx"
+}
+
+// CurrentONNXExport returns the ONNX export of the trained model file at modelPath. Exports older
+// than the model were made for a previous training and are ignored.
+func CurrentONNXExport(modelPath string) (string, bool) {
+	onnxPath := ONNXPath(modelPath)
+	if onnxPath == "" {
+		return "", false
+	}
+	model, err := os.Stat(modelPath)
+	if err != nil {
+		return "", false
+	}
+	export, err := os.Stat(onnxPath)
+	if err != nil || export.IsDir() || export.ModTime().Before(model.ModTime()) {
+		return "", false
+	}
+	return onnxPath, true
+}
+
+// ParseONNXExport decodes the output of ONNXExportScript, ignoring anything printed before the JSON line
+func ParseONNXExport(data []byte) (*ONNXExport, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var raw struct {
+		Status    string  `json:"status"`
+		Framework *string `json:"framework"`
+		Reason    *string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(lines[len(lines)-1])), &raw); err != nil {
+		return nil, fmt.Errorf("invalid ONNX export result: %w", err)
+	}
+	switch raw.Status {
+	case ONNXExported, ONNXSkipped, ONNXFailed:
+	default:
+		return nil, fmt.Errorf("invalid ONNX export status %q", raw.Status)
+	}
+
+	export := &ONNXExport{Status: raw.Status}
+	if raw.Framework != nil {
+		export.Framework = *raw.Framework
+	}
+	if raw.Reason != nil {
+		export.Reason = *raw.Reason
+	}
+	return export, nil
+}
+
+// ExportONNX runs ONNXExportScript with the given interpreter to write the ONNX export of the
+// trained model file at modelPath next to it. A current export, e.g. one the training script
+// wrote itself, is kept.
+func ExportONNX(ctx context.Context, pythonCmd, workingDir string, env []string, modelPath string) (*ONNXExport, error) {
+	return exportONNX(ctx, hostPython(pythonCmd, workingDir, env), modelPath)
+}
+
+// exportONNX is ExportONNX with the interpreter run by run
+func exportONNX(ctx context.Context, run pythonRunner, modelPath string) (*ONNXExport, error) {
+	onnxPath := ONNXPath(modelPath)
+	if onnxPath == "" {
+		return &ONNXExport{Status: ONNXSkipped, Framework: "onnx", Reason: "the model already is ONNX"}, nil
+	}
+	if _, ok := CurrentONNXExport(modelPath); ok {
+		return &ONNXExport{Status: ONNXExported, Reason: "exported by the training script"}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, onnxExportTimeout)
+	defer cancel()
+
+	output, err := run(ctx, "-c", ONNXExportScript, modelPath, onnxPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export to ONNX: %w", err)
+	}
+	return ParseONNXExport(output)
+}
+
+// exportRunONNX exports the trained model of a successful server training to ONNX with the
+// interpreter and env it trained with. modelPath is relative to the uploads folder.
+func (t *Trainer) exportRunONNX(trainingID string, req TrainingRequest, modelPath string, progress *TrainingProgress) {
+	if !ONNXExportEnabled() || modelPath == "" || filepath.IsAbs(modelPath) {
+		return
+	}
+	workingDir, err := filepath.Abs(filepath.Join(t.navigator.BaseUploadPath, req.FolderName))
+	if err != nil {
+		println("⚠️  [EXECUTE] Could not export to ONNX:", err.Error())
+		return
+	}
+	absModelPath, err := filepath.Abs(filepath.Join(t.navigator.BaseUploadPath, modelPath))
+	if err != nil {
+		println("⚠️  [EXECUTE] Could not export to ONNX:", err.Error())
+		return
+	}
+	run := t.runPython(trainingID, "onnx", req, workingDir, filepath.Dir(absModelPath))
+	export, err := exportONNX(context.Background(), run, absModelPath)
+	if err != nil {
+		export = &ONNXExport{Status: ONNXFailed, Reason: err.Error()}
+	}
+	if export.Status == ONNXExported {
+		export.Path = ONNXPath(modelPath)
+		println("📦 [EXECUTE] Exported trained model to ONNX:", export.Path)
+		progress.AddLog("Exported the trained model to ONNX: " + export.Path)
+	} else {
+		println(fmt.Sprintf("⚠️  [EXECUTE] Trained model of %s was not exported to ONNX (%s): %s", trainingID, export.Status, export.Reason))
+		progress.AddLog(fmt.Sprintf("ONNX export %s: %s", export.Status, export.Reason))
+	}
+	progress.SetONNXExport(export)
+}
+
+// SetONNXExport stores the outcome of the ONNX export of a run
+func (tp *TrainingProgress) SetONNXExport(export *ONNXExport) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.ONNXExport = export
+}
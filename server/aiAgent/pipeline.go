@@ -0,0 +1,242 @@
+package aiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ModelConfigFile is the optional per-model config file in the model folder
+const ModelConfigFile = "aimanage.json"
+
+// StatusSkipped is used for pipeline stages whose dependencies did not complete
+const StatusSkipped TrainingStatus = "skipped"
+
+// ModelConfig is the content of aimanage.json
+type ModelConfig struct {
+	Pipeline *PipelineConfig       `json:"pipeline,omitempty"`
+	Hardware *HardwareRequirements `json:"hardware,omitempty"`
+	// Checkpoints overrides which checkpoint files are detected and how many are kept
+	Checkpoints *CheckpointConfig `json:"checkpoints,omitempty"`
+	// TensorBoard tells where the script writes TensorBoard event files
+	TensorBoard *TensorBoardConfig `json:"tensorboard,omitempty"`
+}
+
+// PipelineConfig declares the stages of a training pipeline
+type PipelineConfig struct {
+	Stages []PipelineStage `json:"stages"`
+}
+
+// PipelineStage is a single script in a pipeline.
+// A stage without depends_on runs after the previous stage; use an empty list to run it without dependencies.
+type PipelineStage struct {
+	Name      string            `json:"name"`
+	Script    string            `json:"script"`
+	Args      []string          `json:"args,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	DependsOn *[]string         `json:"depends_on,omitempty"`
+}
+
+// StageProgress tracks a single pipeline stage
+type StageProgress struct {
+	Name         string            `json:"name"`
+	Script       string            `json:"script"`
+	DependsOn    []string          `json:"depends_on"`
+	Status       TrainingStatus    `json:"status"`
+	StartTime    *time.Time        `json:"start_time,omitempty"`
+	EndTime      *time.Time        `json:"end_time,omitempty"`
+	Logs         []string          `json:"logs"`
+	Metrics      []TrainingMetrics `json:"metrics"`
+	ErrorMessage string            `json:"error_message,omitempty"`
+}
+
+// LoadModelConfig reads aimanage.json from a model folder. It returns nil if the file does not exist.
+func LoadModelConfig(folderPath string) (*ModelConfig, error) {
+	data, err := os.ReadFile(filepath.Join(folderPath, ModelConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", ModelConfigFile, err)
+	}
+
+	var config ModelConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ModelConfigFile, err)
+	}
+	return &config, nil
+}
+
+// dependencies returns the resolved dependencies of the stage at index i
+func (p *PipelineConfig) dependencies(i int) []string {
+	stage := p.Stages[i]
+	if stage.DependsOn != nil {
+		return *stage.DependsOn
+	}
+	if i == 0 {
+		return []string{}
+	}
+	return []string{p.Stages[i-1].Name}
+}
+
+// Order validates the pipeline and returns its stages in execution order.
+// Stages run one at a time; among ready stages the declaration order is kept.
+func (p *PipelineConfig) Order() ([]PipelineStage, [][]string, error) {
+	if len(p.Stages) == 0 {
+		return nil, nil, fmt.Errorf("pipeline has no stages")
+	}
+
+	index := make(map[string]int, len(p.Stages))
+	for i, stage := range p.Stages {
+		if stage.Name == "" {
+			return nil, nil, fmt.Errorf("stage %d has no name", i+1)
+		}
+		if stage.Script == "" {
+			return nil, nil, fmt.Errorf("stage '%s' has no script", stage.Name)
+		}
+		if _, exists := index[stage.Name]; exists {
+			return nil, nil, fmt.Errorf("duplicate stage name '%s'", stage.Name)
+		}
+		index[stage.Name] = i
+	}
+
+	deps := make([][]string, len(p.Stages))
+	for i := range p.Stages {
+		deps[i] = p.dependencies(i)
+		for _, dep := range deps[i] {
+			if _, ok := index[dep]; !ok {
+				return nil, nil, fmt.Errorf("stage '%s' depends on unknown stage '%s'", p.Stages[i].Name, dep)
+			}
+		}
+	}
+
+	done := make(map[string]bool, len(p.Stages))
+	var ordered []PipelineStage
+	var orderedDeps [][]string
+	for len(ordered) < len(p.Stages) {
+		progressed := false
+		for i, stage := range p.Stages {
+			if done[stage.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range deps[i] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[stage.Name] = true
+				ordered = append(ordered, stage)
+				orderedDeps = append(orderedDeps, deps[i])
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			return nil, nil, fmt.Errorf("pipeline has a dependency cycle")
+		}
+	}
+
+	return ordered, orderedDeps, nil
+}
+
+// currentStageLocked returns the running stage. The caller must hold tp.mu.
+func (tp *TrainingProgress) currentStageLocked() *StageProgress {
+	if tp.CurrentStage == "" {
+		return nil
+	}
+	for _, stage := range tp.Stages {
+		if stage.Name == tp.CurrentStage {
+			return stage
+		}
+	}
+	return nil
+}
+
+// setStageStatus updates a stage and broadcasts the stage boundary
+func (t *Trainer) setStageStatus(progress *TrainingProgress, trainingID string, index int, status TrainingStatus, errorMessage string) {
+	progress.mu.Lock()
+	stage := progress.Stages[index]
+	now := time.Now()
+	stage.Status = status
+	stage.ErrorMessage = errorMessage
+	switch status {
+	case StatusRunning:
+		stage.StartTime = &now
+		progress.CurrentStage = stage.Name
+	case StatusCompleted, StatusFailed, StatusSkipped:
+		if stage.StartTime != nil {
+			stage.EndTime = &now
+		}
+		if progress.CurrentStage == stage.Name {
+			progress.CurrentStage = ""
+		}
+	}
+	update := map[string]interface{}{
+		"stage":         stage.Name,
+		"index":         index,
+		"total_stages":  len(progress.Stages),
+		"status":        status,
+		"error_message": errorMessage,
+	}
+	progress.mu.Unlock()
+
+	println(fmt.Sprintf("🧩 [PIPELINE] Stage %d/%d '%s': %s", index+1, len(progress.Stages), stage.Name, status))
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "stage", update)
+	}
+}
+
+// runPipeline runs every stage in order. A stage whose dependencies did not
+// complete is skipped; the training fails if any stage failed.
+func (t *Trainer) runPipeline(ctx context.Context, trainingID string, req TrainingRequest, absWorkingDir string, stages []PipelineStage, progress *TrainingProgress) error {
+	completed := make(map[string]bool, len(stages))
+	var firstErr error
+
+	for i, stage := range stages {
+		progress.mu.RLock()
+		deps := progress.Stages[i].DependsOn
+		// Stages completed before a preemptible training was evicted are not run again
+		done := progress.Stages[i].Status == StatusCompleted
+		progress.mu.RUnlock()
+		if done {
+			completed[stage.Name] = true
+			continue
+		}
+
+		missing := ""
+		for _, dep := range deps {
+			if !completed[dep] {
+				missing = dep
+				break
+			}
+		}
+		if missing != "" {
+			t.setStageStatus(progress, trainingID, i, StatusSkipped, fmt.Sprintf("dependency '%s' did not complete", missing))
+			continue
+		}
+
+		if ctx.Err() != nil {
+			t.setStageStatus(progress, trainingID, i, StatusSkipped, "training was cancelled")
+			continue
+		}
+
+		t.setStageStatus(progress, trainingID, i, StatusRunning, "")
+		if err := t.runScript(ctx, trainingID, req, absWorkingDir, stage.Script, stage.Args, stage.Env, progress); err != nil {
+			t.setStageStatus(progress, trainingID, i, StatusFailed, err.Error())
+			if firstErr == nil {
+				firstErr = fmt.Errorf("stage '%s' failed: %w", stage.Name, err)
+			}
+			continue
+		}
+		t.setStageStatus(progress, trainingID, i, StatusCompleted, "")
+		completed[stage.Name] = true
+	}
+
+	return firstErr
+}
@@ -0,0 +1,310 @@
+package aiAgent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"server/internal/repository"
+)
+
+// Execution modes for server trainings.
+// Preemptible trainings cost fewer credits but may be evicted when an on-demand training needs capacity.
+const (
+	ExecutionModeOnDemand    = "on_demand"
+	ExecutionModePreemptible = "preemptible"
+)
+
+// StatusPreempted is used while an evicted training waits to be resumed
+const StatusPreempted TrainingStatus = "preempted"
+
+// Preemption environment variables.
+// TRAINING_MAX_CONCURRENT is how many server trainings run at once (defaults to the GPU capacity, unlimited without GPUs).
+// PREEMPTION_GRACE_PERIOD is how many seconds an evicted script has to save a checkpoint after SIGTERM.
+// AIMANAGE_RESUME_CHECKPOINT and AIMANAGE_RESUME_COUNT are passed to a resumed script.
+const (
+	TrainingMaxConcurrentEnv = "TRAINING_MAX_CONCURRENT"
+	PreemptionGracePeriodEnv = "PREEMPTION_GRACE_PERIOD"
+	ResumeCheckpointEnv      = "AIMANAGE_RESUME_CHECKPOINT"
+	ResumeCountEnv           = "AIMANAGE_RESUME_COUNT"
+)
+
+const defaultPreemptionGracePeriod = 30 * time.Second
+
+// PreemptionRecord is an eviction of a preemptible training
+type PreemptionRecord struct {
+	EvictedAt  time.Time  `json:"evicted_at"`
+	ResumedAt  *time.Time `json:"resumed_at,omitempty"`
+	Checkpoint string     `json:"checkpoint,omitempty"`
+	Reason     string     `json:"reason"`
+	recordID   int
+}
+
+// preemptionGracePeriod returns how long a script may take to exit after SIGTERM
+func preemptionGracePeriod() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv(PreemptionGracePeriodEnv)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultPreemptionGracePeriod
+}
+
+// runningJob is a server training that holds a capacity slot
+type runningJob struct {
+	mode      string
+	startedAt time.Time
+	cancel    context.CancelFunc
+	evicted   bool
+	// interrupted is set for trainings stopped because the server shuts down
+	interrupted bool
+}
+
+// queuedJob is a preemptible training waiting for capacity
+type queuedJob struct {
+	ctx        context.Context
+	trainingID string
+	req        TrainingRequest
+	progress   *TrainingProgress
+}
+
+// jobScheduler tracks capacity slots, evicts preemptible trainings and resumes them
+type jobScheduler struct {
+	once     sync.Once
+	capacity int // 0 means unlimited
+	running  map[string]*runningJob
+	queue    []queuedJob
+	closing  bool // Set by Shutdown, no training starts afterwards
+	mu       sync.Mutex
+}
+
+func newJobScheduler() *jobScheduler {
+	return &jobScheduler{running: make(map[string]*runningJob)}
+}
+
+func (s *jobScheduler) init(gpus *GPUAllocator) {
+	s.once.Do(func() {
+		s.capacity = gpus.Capacity()
+		if n, err := strconv.Atoi(os.Getenv(TrainingMaxConcurrentEnv)); err == nil && n >= 0 {
+			s.capacity = n
+		}
+		println("📐 [SCHEDULER] Server training capacity:", s.capacity, "(0 = unlimited)")
+	})
+}
+
+// hasCapacityLocked reports whether another training can start. The caller must hold s.mu.
+func (s *jobScheduler) hasCapacityLocked() bool {
+	if s.capacity == 0 {
+		return true
+	}
+	active := 0
+	for _, job := range s.running {
+		if !job.evicted {
+			active++
+		}
+	}
+	return active < s.capacity
+}
+
+// launch starts a training, evicting a preemptible one for on-demand work when the server is full.
+// A preemptible training that does not fit is queued until capacity frees.
+func (t *Trainer) launch(ctx context.Context, trainingID string, req TrainingRequest, progress *TrainingProgress) {
+	t.jobs.init(t.gpus)
+
+	t.jobs.mu.Lock()
+	if t.jobs.closing {
+		t.jobs.mu.Unlock()
+		t.markInterrupted(trainingID, req, progress)
+		reportUsage(trainingID, progress)
+		return
+	}
+	if !t.jobs.hasCapacityLocked() {
+		if req.ExecutionMode == ExecutionModePreemptible {
+			t.jobs.queue = append(t.jobs.queue, queuedJob{ctx: ctx, trainingID: trainingID, req: req, progress: progress})
+			t.jobs.mu.Unlock()
+			println("⏸️  [SCHEDULER] No capacity, queued preemptible training", trainingID)
+			if broadcastCallback != nil {
+				broadcastCallback(trainingID, "status", map[string]interface{}{
+					"status":        StatusPending,
+					"error_message": "",
+					"queued":        true,
+				})
+			}
+			return
+		}
+		t.evictLocked(fmt.Sprintf("capacity needed for on-demand training %s", trainingID))
+	}
+	t.startLocked(ctx, trainingID, req, progress)
+	t.jobs.mu.Unlock()
+}
+
+// startLocked takes a capacity slot and runs the training. The caller must hold t.jobs.mu.
+func (t *Trainer) startLocked(ctx context.Context, trainingID string, req TrainingRequest, progress *TrainingProgress) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	t.jobs.running[trainingID] = &runningJob{mode: req.ExecutionMode, startedAt: time.Now(), cancel: cancel}
+	go func() {
+		t.executeTraining(attemptCtx, trainingID, req, progress)
+		evicted, interrupted := t.stopReason(trainingID)
+		cancel()
+		switch {
+		case interrupted:
+			// The credits of the attempt are settled now; resuming it starts a new training
+			t.markInterrupted(trainingID, req, progress)
+			reportUsage(trainingID, progress)
+		case evicted:
+			t.markPreempted(ctx, trainingID, req, progress)
+		default:
+			reportUsage(trainingID, progress)
+		}
+		t.finishJob(trainingID)
+	}()
+}
+
+// evictLocked stops the most recently started preemptible training, which loses the least work.
+// The caller must hold t.jobs.mu.
+func (t *Trainer) evictLocked(reason string) bool {
+	var victimID string
+	var victim *runningJob
+	for id, job := range t.jobs.running {
+		if job.mode != ExecutionModePreemptible || job.evicted {
+			continue
+		}
+		if victim == nil || job.startedAt.After(victim.startedAt) {
+			victimID, victim = id, job
+		}
+	}
+	if victim == nil {
+		println("⚠️  [SCHEDULER] Server is full and no preemptible training can be evicted")
+		return false
+	}
+
+	println("🛑 [SCHEDULER] Evicting preemptible training", victimID, "-", reason)
+	victim.evicted = true
+	t.mu.RLock()
+	if progress, ok := t.activeTraining[victimID]; ok {
+		progress.mu.Lock()
+		progress.preemptReason = reason
+		progress.mu.Unlock()
+	}
+	t.mu.RUnlock()
+	// Cancelling sends SIGTERM; the script is killed if it is still running after the grace period
+	victim.cancel()
+	return true
+}
+
+// wasEvicted reports whether the running attempt of a training was evicted or interrupted
+func (t *Trainer) wasEvicted(trainingID string) bool {
+	evicted, _ := t.stopReason(trainingID)
+	return evicted
+}
+
+// stopReason reports whether the running attempt of a training was stopped by the scheduler, and
+// whether that was because the server shuts down
+func (t *Trainer) stopReason(trainingID string) (evicted, interrupted bool) {
+	t.jobs.mu.Lock()
+	defer t.jobs.mu.Unlock()
+	job, ok := t.jobs.running[trainingID]
+	if !ok {
+		return false, false
+	}
+	return job.evicted, job.interrupted
+}
+
+// finishJob frees a training's slot and resumes queued trainings that now fit
+func (t *Trainer) finishJob(trainingID string) {
+	t.jobs.mu.Lock()
+	defer t.jobs.mu.Unlock()
+	delete(t.jobs.running, trainingID)
+
+	for !t.jobs.closing && len(t.jobs.queue) > 0 && t.jobs.hasCapacityLocked() {
+		next := t.jobs.queue[0]
+		t.jobs.queue = t.jobs.queue[1:]
+		t.resumeLocked(next)
+	}
+}
+
+// markPreempted records an eviction and queues the training to resume from its last checkpoint
+func (t *Trainer) markPreempted(ctx context.Context, trainingID string, req TrainingRequest, progress *TrainingProgress) {
+	progress.mu.Lock()
+	record := PreemptionRecord{EvictedAt: time.Now(), Reason: progress.preemptReason}
+	if len(progress.Checkpoints) > 0 {
+		record.Checkpoint = progress.Checkpoints[len(progress.Checkpoints)-1].Path
+	}
+	progress.Status = StatusPreempted
+	progress.preemptReason = ""
+	progress.clearETALocked()
+	progress.mu.Unlock()
+
+	id, err := repository.RecordTrainingPreemption(context.Background(), trainingID, record.Checkpoint, record.Reason)
+	if err != nil {
+		println("⚠️  [SCHEDULER] Failed to record preemption:", err.Error())
+	}
+	record.recordID = id
+
+	progress.mu.Lock()
+	progress.Preemptions = append(progress.Preemptions, record)
+	progress.mu.Unlock()
+
+	println("⏸️  [SCHEDULER] Training", trainingID, "preempted, last checkpoint:", record.Checkpoint)
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "status", map[string]interface{}{
+			"status":        StatusPreempted,
+			"error_message": "",
+			"checkpoint":    record.Checkpoint,
+			"reason":        record.Reason,
+		})
+	}
+
+	t.jobs.mu.Lock()
+	t.jobs.queue = append(t.jobs.queue, queuedJob{ctx: ctx, trainingID: trainingID, req: req, progress: progress})
+	t.jobs.mu.Unlock()
+}
+
+// resumeLocked restarts a queued training, passing it the checkpoint it was evicted at.
+// The caller must hold t.jobs.mu.
+func (t *Trainer) resumeLocked(job queuedJob) {
+	progress := job.progress
+	req := job.req
+
+	progress.mu.Lock()
+	resumes := len(progress.Preemptions)
+	var checkpoint string
+	var recordID int
+	if resumes > 0 {
+		now := time.Now()
+		last := &progress.Preemptions[resumes-1]
+		last.ResumedAt = &now
+		checkpoint, recordID = last.Checkpoint, last.recordID
+	}
+	progress.EndTime = nil
+	// Completed pipeline stages are kept, the others run again
+	for _, stage := range progress.Stages {
+		if stage.Status != StatusCompleted {
+			stage.Status = StatusPending
+			stage.ErrorMessage = ""
+		}
+	}
+	progress.mu.Unlock()
+
+	if resumes > 0 {
+		env := make(map[string]string, len(req.Env)+2)
+		for key, val := range req.Env {
+			env[key] = val
+		}
+		env[ResumeCheckpointEnv] = checkpoint
+		env[ResumeCountEnv] = strconv.Itoa(resumes)
+		req.Env = env
+
+		if recordID > 0 {
+			if err := repository.MarkTrainingPreemptionResumed(context.Background(), recordID); err != nil {
+				println("⚠️  [SCHEDULER] Failed to record resume:", err.Error())
+			}
+		}
+		println("▶️  [SCHEDULER] Resuming training", job.trainingID, "from checkpoint:", checkpoint)
+	} else {
+		println("▶️  [SCHEDULER] Starting queued training", job.trainingID)
+	}
+
+	t.startLocked(job.ctx, job.trainingID, req, progress)
+}
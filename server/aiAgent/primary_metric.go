@@ -0,0 +1,126 @@
+package aiAgent
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Directions of a primary metric
+const (
+	MetricHigherIsBetter = "higher"
+	MetricLowerIsBetter  = "lower"
+)
+
+// AccuracyMetric is the default primary metric: the test, validation or train accuracy as a percentage
+const AccuracyMetric = "accuracy"
+
+// primaryMetricName matches metric names scripts can report as PROGRESS fields or custom metrics
+var primaryMetricName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.@-]{0,63}$`)
+
+// lowerIsBetterMetrics are the metrics whose direction defaults to lower when none is given
+var lowerIsBetterMetrics = map[string]bool{
+	"loss": true, "train_loss": true, "val_loss": true, "test_loss": true,
+	"rmse": true, "mse": true, "mae": true, "mape": true, "wer": true, "cer": true, "perplexity": true,
+}
+
+// PrimaryMetric is a model's metric of record: the metric its trainings are judged, compared and
+// listed by, and whether higher or lower values are better
+type PrimaryMetric struct {
+	Name      string `json:"name"`
+	Direction string `json:"direction"`
+}
+
+// DefaultPrimaryMetric is used for models that did not declare a primary metric
+func DefaultPrimaryMetric() PrimaryMetric {
+	return PrimaryMetric{Name: AccuracyMetric, Direction: MetricHigherIsBetter}
+}
+
+// NewPrimaryMetric validates a metric name and direction. An empty direction defaults to lower for
+// well-known error and loss metrics and to higher otherwise.
+func NewPrimaryMetric(name, direction string) (PrimaryMetric, error) {
+	name = strings.TrimSpace(name)
+	if !primaryMetricName.MatchString(name) {
+		return PrimaryMetric{}, fmt.Errorf("metric name must start with a letter and contain at most 64 letters, digits, '_', '.', '@' or '-'")
+	}
+	switch direction {
+	case "":
+		direction = MetricHigherIsBetter
+		if lowerIsBetterMetrics[strings.ToLower(name)] {
+			direction = MetricLowerIsBetter
+		}
+	case MetricHigherIsBetter, MetricLowerIsBetter:
+	default:
+		return PrimaryMetric{}, fmt.Errorf("direction must be %s or %s", MetricHigherIsBetter, MetricLowerIsBetter)
+	}
+	return PrimaryMetric{Name: name, Direction: direction}, nil
+}
+
+// IsAccuracy reports whether the metric is the default accuracy
+func (p PrimaryMetric) IsAccuracy() bool {
+	return p.Name == "" || p.Name == AccuracyMetric
+}
+
+// Better reports whether value a is better than value b
+func (p PrimaryMetric) Better(a, b float64) bool {
+	if p.Direction == MetricLowerIsBetter {
+		return a < b
+	}
+	return a > b
+}
+
+// Value reads the metric from a metrics line. Accuracy prefers the test, then validation, then train
+// accuracy and is returned as a percentage; other metrics are read from the PROGRESS fields or the
+// custom metrics as reported.
+func (p PrimaryMetric) Value(m TrainingMetrics) (float64, bool) {
+	switch p.Name {
+	case "", AccuracyMetric:
+		for _, acc := range []float64{m.TestAccuracy, m.ValAccuracy, m.TrainAccuracy} {
+			if acc > 0 {
+				return acc * 100, true
+			}
+		}
+		return 0, false
+	case "train_loss":
+		return m.TrainLoss, m.TrainLoss > 0
+	case "val_loss":
+		return m.ValLoss, m.ValLoss > 0
+	case "train_accuracy":
+		return m.TrainAccuracy * 100, m.TrainAccuracy > 0
+	case "val_accuracy":
+		return m.ValAccuracy * 100, m.ValAccuracy > 0
+	case "test_accuracy":
+		return m.TestAccuracy * 100, m.TestAccuracy > 0
+	}
+	switch v := m.CustomMetrics[p.Name].(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// Final returns the metric of a finished training: from its final metrics if they have it, else from
+// the most recent metrics line that does
+func (p PrimaryMetric) Final(progress *TrainingProgress) (float64, bool) {
+	if progress.FinalMetrics != nil {
+		if v, ok := p.Value(*progress.FinalMetrics); ok {
+			return v, true
+		}
+	}
+	for i := len(progress.Metrics) - 1; i >= 0; i-- {
+		if v, ok := p.Value(progress.Metrics[i]); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// String formats the metric for messages, e.g. "rmse (lower is better)"
+func (p PrimaryMetric) String() string {
+	if p.Direction == MetricLowerIsBetter {
+		return p.Name + " (lower is better)"
+	}
+	return p.Name + " (higher is better)"
+}
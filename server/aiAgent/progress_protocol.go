@@ -0,0 +1,327 @@
+package aiAgent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PROGRESS protocol versions.
+// v1: epoch, total_epochs, losses, accuracies and status.
+// v2: adds "version", custom "metrics", training "stage" and inline "artifacts".
+const (
+	ProgressProtocolV1     = 1
+	ProgressProtocolV2     = 2
+	LatestProgressProtocol = ProgressProtocolV2
+)
+
+// ProgressProtocolEnv tells training scripts the newest protocol version the server accepts
+const ProgressProtocolEnv = "AIMANAGE_PROGRESS_PROTOCOL"
+
+// Fields allowed in a v1 PROGRESS message
+var progressV1Fields = map[string]string{
+	"epoch":          "integer",
+	"total_epochs":   "integer",
+	"train_loss":     "number",
+	"val_loss":       "number",
+	"test_loss":      "number",
+	"loss":           "number",
+	"train_accuracy": "number",
+	"val_accuracy":   "number",
+	"test_accuracy":  "number",
+	"accuracy":       "number",
+	"status":         "string",
+}
+
+// Fields added in v2
+var progressV2Fields = map[string]string{
+	"version":   "integer",
+	"metrics":   "object",
+	"stage":     "string",
+	"artifacts": "array",
+}
+
+// ProgressSchemas returns JSON schemas for every supported PROGRESS protocol version
+func ProgressSchemas() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	for version := ProgressProtocolV1; version <= LatestProgressProtocol; version++ {
+		properties := make(map[string]interface{})
+		for field, typ := range progressFieldsFor(version) {
+			properties[field] = map[string]interface{}{"type": typ}
+		}
+		properties["status"] = map[string]interface{}{"type": "string", "enum": []string{"training", "completed"}}
+		for _, field := range []string{"train_accuracy", "val_accuracy", "test_accuracy", "accuracy"} {
+			properties[field] = map[string]interface{}{"type": "number", "minimum": 0, "maximum": 100}
+		}
+		if version >= ProgressProtocolV2 {
+			properties["version"] = map[string]interface{}{"type": "integer", "const": version}
+			properties["metrics"] = map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": map[string]interface{}{"type": "number"},
+			}
+			properties["artifacts"] = map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"path"},
+					"properties": map[string]interface{}{
+						"path":        map[string]interface{}{"type": "string"},
+						"type":        map[string]interface{}{"type": "string", "enum": sortedArtifactTypes()},
+						"name":        map[string]interface{}{"type": "string"},
+						"description": map[string]interface{}{"type": "string"},
+					},
+				},
+			}
+		}
+
+		schema := map[string]interface{}{
+			"$schema":              "https://json-schema.org/draft/2020-12/schema",
+			"title":                fmt.Sprintf("PROGRESS message v%d", version),
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if version >= ProgressProtocolV2 {
+			schema["required"] = []string{"version"}
+		}
+		schemas[fmt.Sprintf("v%d", version)] = schema
+	}
+	return schemas
+}
+
+func progressFieldsFor(version int) map[string]string {
+	fields := make(map[string]string, len(progressV1Fields)+len(progressV2Fields))
+	for field, typ := range progressV1Fields {
+		fields[field] = typ
+	}
+	if version >= ProgressProtocolV2 {
+		for field, typ := range progressV2Fields {
+			fields[field] = typ
+		}
+	}
+	return fields
+}
+
+func sortedArtifactTypes() []string {
+	types := make([]string, 0, len(artifactTypes))
+	for t := range artifactTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DeclaredProgressVersion returns the protocol version a PROGRESS payload declares (v1 if none)
+func DeclaredProgressVersion(data map[string]interface{}) int {
+	if v, ok := data["version"].(float64); ok && v >= 1 {
+		return int(v)
+	}
+	return ProgressProtocolV1
+}
+
+// NegotiateProgressVersion picks the version used for a run from what the script declared
+func NegotiateProgressVersion(declared int) int {
+	if declared > LatestProgressProtocol {
+		return LatestProgressProtocol
+	}
+	if declared < ProgressProtocolV1 {
+		return ProgressProtocolV1
+	}
+	return declared
+}
+
+// ValidateProgressMessage checks a decoded PROGRESS payload against the schema for a version
+func ValidateProgressMessage(data map[string]interface{}, version int) (errors []string, warnings []string) {
+	fields := progressFieldsFor(version)
+
+	names := make([]string, 0, len(data))
+	for field := range data {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	for _, field := range names {
+		value := data[field]
+		typ, known := fields[field]
+		if !known {
+			if _, isV2 := progressV2Fields[field]; isV2 {
+				warnings = append(warnings, fmt.Sprintf("'%s' requires protocol v2 and is ignored (add \"version\": 2)", field))
+			} else {
+				warnings = append(warnings, fmt.Sprintf("unknown field '%s' is ignored", field))
+			}
+			continue
+		}
+		if !matchesJSONType(value, typ) {
+			errors = append(errors, fmt.Sprintf("'%s' must be %s %s", field, article(typ), typ))
+		}
+	}
+
+	if _, ok := data["epoch"]; !ok {
+		warnings = append(warnings, "'epoch' is missing")
+	}
+	if _, ok := data["total_epochs"]; !ok {
+		warnings = append(warnings, "'total_epochs' is missing")
+	}
+
+	if v, ok := data["status"]; ok {
+		if status, isString := v.(string); isString && status != "training" && status != "completed" {
+			errors = append(errors, "'status' must be \"training\" or \"completed\"")
+		}
+	} else {
+		warnings = append(warnings, "'status' is missing")
+	}
+
+	for _, field := range []string{"train_accuracy", "val_accuracy", "test_accuracy", "accuracy"} {
+		if v, ok := data[field].(float64); ok {
+			if v < 0 || v > 100 {
+				errors = append(errors, fmt.Sprintf("'%s' must be a percentage between 0 and 100", field))
+			} else if v > 0 && v <= 1 {
+				warnings = append(warnings, fmt.Sprintf("'%s' looks like a 0-1 fraction; report accuracy as a percentage", field))
+			}
+		}
+	}
+
+	if version < ProgressProtocolV2 {
+		return errors, warnings
+	}
+
+	if declared := DeclaredProgressVersion(data); declared > LatestProgressProtocol {
+		warnings = append(warnings, fmt.Sprintf("protocol v%d is not supported, parsing as v%d", declared, LatestProgressProtocol))
+	}
+	if custom, ok := data["metrics"].(map[string]interface{}); ok {
+		for name, value := range custom {
+			if _, isNumber := value.(float64); !isNumber {
+				errors = append(errors, fmt.Sprintf("custom metric '%s' must be a number", name))
+			}
+		}
+	}
+	if stage, ok := data["stage"].(string); ok && strings.TrimSpace(stage) == "" {
+		errors = append(errors, "'stage' must not be empty")
+	}
+	if items, ok := data["artifacts"].([]interface{}); ok {
+		for i, item := range items {
+			artifact, isObject := item.(map[string]interface{})
+			if !isObject {
+				errors = append(errors, fmt.Sprintf("artifacts[%d] must be an object", i))
+				continue
+			}
+			if path, _ := artifact["path"].(string); path == "" {
+				errors = append(errors, fmt.Sprintf("artifacts[%d].path is required", i))
+			}
+			if t, ok := artifact["type"]; ok {
+				if s, isString := t.(string); !isString || !artifactTypes[s] {
+					errors = append(errors, fmt.Sprintf("artifacts[%d].type must be one of %s", i, strings.Join(sortedArtifactTypes(), ", ")))
+				}
+			}
+		}
+	}
+
+	return errors, warnings
+}
+
+func matchesJSONType(value interface{}, typ string) bool {
+	switch typ {
+	case "integer":
+		return isWholeNumber(value)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+func article(typ string) string {
+	if strings.IndexAny(typ[:1], "aeiou") == 0 {
+		return "an"
+	}
+	return "a"
+}
+
+// progressArtifactsFromData extracts inline artifacts from a v2 PROGRESS payload
+func progressArtifactsFromData(data map[string]interface{}) []ArtifactInfo {
+	items, ok := data["artifacts"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var artifacts []ArtifactInfo
+	for _, item := range items {
+		raw, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		artifact := ArtifactInfo{Type: "other"}
+		artifact.Path, _ = raw["path"].(string)
+		if t, ok := raw["type"].(string); ok && artifactTypes[t] {
+			artifact.Type = t
+		}
+		artifact.Name, _ = raw["name"].(string)
+		artifact.Description, _ = raw["description"].(string)
+		if artifact.Path != "" {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts
+}
+
+// ParseProgressLine validates and parses the JSON payload of a PROGRESS line for this run.
+// The first PROGRESS line fixes the run's protocol version; later lines are parsed with it
+// so parser behavior does not change halfway through a training.
+func (tp *TrainingProgress) ParseProgressLine(jsonStr string) (*TrainingMetrics, []ArtifactInfo) {
+	var data map[string]interface{}
+	if err := decodeProgressJSON(jsonStr, &data); err != nil {
+		println("⚠️  [PROGRESS] Ignoring line, payload is not a JSON object:", err.Error())
+		return nil, nil
+	}
+
+	declared := DeclaredProgressVersion(data)
+
+	tp.mu.Lock()
+	first := tp.ProtocolVersion == 0
+	if first {
+		tp.ProtocolVersion = NegotiateProgressVersion(declared)
+		println(fmt.Sprintf("🤝 [PROGRESS] Using protocol v%d (script declared v%d)", tp.ProtocolVersion, declared))
+	}
+	version := tp.ProtocolVersion
+	tp.mu.Unlock()
+
+	if !first && declared != version && NegotiateProgressVersion(declared) != version {
+		println(fmt.Sprintf("⚠️  [PROGRESS] Line declares v%d but this run uses v%d, parsing as v%d", declared, version, version))
+	}
+
+	errors, warnings := ValidateProgressMessage(data, version)
+	for _, e := range errors {
+		println("❌ [PROGRESS] Invalid field:", e)
+	}
+	if first {
+		// Warnings repeat on every line, so only log them once per run
+		for _, w := range warnings {
+			println("⚠️  [PROGRESS]", w)
+		}
+	}
+
+	var artifacts []ArtifactInfo
+	if version >= ProgressProtocolV2 {
+		artifacts = progressArtifactsFromData(data)
+	}
+	return progressMetricsFromData(data, version), artifacts
+}
+
+// ParseProgressPayload parses a PROGRESS payload without run state, negotiating the version from the line itself
+func ParseProgressPayload(jsonStr string) (*TrainingMetrics, int) {
+	var data map[string]interface{}
+	if err := decodeProgressJSON(jsonStr, &data); err != nil {
+		return nil, 0
+	}
+	version := NegotiateProgressVersion(DeclaredProgressVersion(data))
+	return progressMetricsFromData(data, version), version
+}
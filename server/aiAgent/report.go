@@ -0,0 +1,245 @@
+package aiAgent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"server/internal/metricparse"
+)
+
+// Line prefixes training scripts print to stdout to report progress.
+// The Python SDK served from /sdk/python emits exactly these formats.
+const (
+	ProgressPrefix   = metricparse.ProgressPrefix
+	CheckpointPrefix = "CHECKPOINT:"
+	ArtifactPrefix   = "ARTIFACT:"
+)
+
+// Report line kinds
+const (
+	ReportKindProgress   = "progress"
+	ReportKindCheckpoint = "checkpoint"
+	ReportKindArtifact   = "artifact"
+	ReportKindLog        = "log"
+)
+
+// Artifact types accepted in ARTIFACT lines
+var artifactTypes = map[string]bool{
+	"model":      true,
+	"checkpoint": true,
+	"metrics":    true,
+	"plot":       true,
+	"log":        true,
+	"other":      true,
+}
+
+// CheckpointInfo is a checkpoint registered by a training script
+type CheckpointInfo struct {
+	Path    string                 `json:"path"`
+	Epoch   int                    `json:"epoch,omitempty"`
+	IsBest  bool                   `json:"is_best,omitempty"`
+	Metrics map[string]interface{} `json:"metrics,omitempty"`
+	// SizeBytes is set for checkpoints of server trainings
+	SizeBytes int64 `json:"size_bytes,omitempty"`
+}
+
+// ArtifactInfo is an output file declared by a training script
+type ArtifactInfo struct {
+	Path        string `json:"path"`
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ReportLineResult is the validation result for a single output line
+type ReportLineResult struct {
+	LineNumber int      `json:"line_number"`
+	Line       string   `json:"line"`
+	Kind       string   `json:"kind"`
+	Valid      bool     `json:"valid"`
+	Errors     []string `json:"errors,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// ReportValidationSummary summarises the validation of a script's output
+type ReportValidationSummary struct {
+	TotalLines      int  `json:"total_lines"`
+	ProgressLines   int  `json:"progress_lines"`
+	CheckpointLines int  `json:"checkpoint_lines"`
+	ArtifactLines   int  `json:"artifact_lines"`
+	InvalidLines    int  `json:"invalid_lines"`
+	HasCompletion   bool `json:"has_completion"`
+	HasAccuracy     bool `json:"has_accuracy"`
+	ProtocolVersion int  `json:"protocol_version"`
+	Valid           bool `json:"valid"`
+}
+
+// ParseCheckpointLine parses a CHECKPOINT line, returning false if the line is not a valid checkpoint
+func ParseCheckpointLine(line string) (*CheckpointInfo, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, CheckpointPrefix) {
+		return nil, false
+	}
+
+	var checkpoint CheckpointInfo
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, CheckpointPrefix))), &checkpoint); err != nil {
+		return nil, false
+	}
+	if checkpoint.Path == "" {
+		return nil, false
+	}
+	return &checkpoint, true
+}
+
+// ParseArtifactLine parses an ARTIFACT line, returning false if the line is not a valid artifact
+func ParseArtifactLine(line string) (*ArtifactInfo, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, ArtifactPrefix) {
+		return nil, false
+	}
+
+	var artifact ArtifactInfo
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, ArtifactPrefix))), &artifact); err != nil {
+		return nil, false
+	}
+	if artifact.Path == "" {
+		return nil, false
+	}
+	if artifact.Type == "" {
+		artifact.Type = "other"
+	}
+	return &artifact, true
+}
+
+// ValidateReportLine checks a single output line against the report line schema.
+// PROGRESS lines are checked against the given protocol version.
+func ValidateReportLine(lineNumber int, line string, version int) ReportLineResult {
+	trimmed := strings.TrimSpace(line)
+	result := ReportLineResult{LineNumber: lineNumber, Line: line, Kind: ReportKindLog, Valid: true}
+
+	var prefix string
+	switch {
+	case strings.HasPrefix(trimmed, ProgressPrefix):
+		result.Kind, prefix = ReportKindProgress, ProgressPrefix
+	case strings.HasPrefix(trimmed, CheckpointPrefix):
+		result.Kind, prefix = ReportKindCheckpoint, CheckpointPrefix
+	case strings.HasPrefix(trimmed, ArtifactPrefix):
+		result.Kind, prefix = ReportKindArtifact, ArtifactPrefix
+	default:
+		if strings.Contains(strings.ToUpper(trimmed), "PROGRESS") && strings.Contains(trimmed, "{") {
+			result.Warnings = append(result.Warnings, "line looks like a PROGRESS report but does not start with 'PROGRESS:'")
+		}
+		return result
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(trimmed, prefix))), &data); err != nil {
+		result.Valid = false
+		result.Errors = append(result.Errors, fmt.Sprintf("payload is not a JSON object: %v", err))
+		return result
+	}
+
+	switch result.Kind {
+	case ReportKindProgress:
+		errors, warnings := ValidateProgressMessage(data, version)
+		result.Errors = append(result.Errors, errors...)
+		result.Warnings = append(result.Warnings, warnings...)
+	case ReportKindCheckpoint:
+		requireString(data, "path", &result)
+		if v, ok := data["epoch"]; ok && !isWholeNumber(v) {
+			result.Errors = append(result.Errors, "'epoch' must be an integer")
+		}
+		if v, ok := data["is_best"]; ok {
+			if _, isBool := v.(bool); !isBool {
+				result.Errors = append(result.Errors, "'is_best' must be a boolean")
+			}
+		}
+		if v, ok := data["metrics"]; ok {
+			if _, isObject := v.(map[string]interface{}); !isObject {
+				result.Errors = append(result.Errors, "'metrics' must be an object")
+			}
+		}
+	case ReportKindArtifact:
+		requireString(data, "path", &result)
+		if v, ok := data["type"]; ok {
+			if t, isString := v.(string); !isString || !artifactTypes[t] {
+				result.Errors = append(result.Errors, "'type' must be one of model, checkpoint, metrics, plot, log, other")
+			}
+		} else {
+			result.Warnings = append(result.Warnings, "'type' is missing, defaulting to 'other'")
+		}
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+func requireString(data map[string]interface{}, field string, result *ReportLineResult) {
+	if v, ok := data[field].(string); !ok || v == "" {
+		result.Errors = append(result.Errors, fmt.Sprintf("'%s' is required and must be a non-empty string", field))
+	}
+}
+
+func isWholeNumber(v interface{}) bool {
+	f, ok := v.(float64)
+	return ok && f == float64(int64(f))
+}
+
+// ValidateReportOutput validates every line of a script's output and summarises the result.
+// The protocol version is negotiated from the first PROGRESS line, as it is for a real run.
+func ValidateReportOutput(output string) ([]ReportLineResult, ReportValidationSummary) {
+	var results []ReportLineResult
+	var summary ReportValidationSummary
+	run := &TrainingProgress{}
+
+	for i, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		summary.TotalLines++
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ProgressPrefix) && summary.ProtocolVersion == 0 {
+			var data map[string]interface{}
+			if json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(trimmed, ProgressPrefix))), &data) == nil {
+				summary.ProtocolVersion = NegotiateProgressVersion(DeclaredProgressVersion(data))
+				run.ProtocolVersion = summary.ProtocolVersion
+			}
+		}
+
+		result := ValidateReportLine(i+1, line, summary.ProtocolVersion)
+		switch result.Kind {
+		case ReportKindProgress:
+			summary.ProgressLines++
+			if metrics, _ := run.ParseProgressLine(strings.TrimSpace(strings.TrimPrefix(trimmed, ProgressPrefix))); metrics != nil {
+				if status, ok := metrics.CustomMetrics["status"].(string); ok && status == "completed" {
+					summary.HasCompletion = true
+				}
+				if metrics.TestAccuracy > 0 || metrics.ValAccuracy > 0 || metrics.TrainAccuracy > 0 {
+					summary.HasAccuracy = true
+				}
+			} else if result.Valid {
+				result.Warnings = append(result.Warnings, "line is ignored because it has no epoch, loss or accuracy")
+			}
+		case ReportKindCheckpoint:
+			summary.CheckpointLines++
+		case ReportKindArtifact:
+			summary.ArtifactLines++
+		}
+		if !result.Valid {
+			summary.InvalidLines++
+		}
+
+		// Plain log lines without warnings are not interesting to report back
+		if result.Kind != ReportKindLog || len(result.Warnings) > 0 {
+			results = append(results, result)
+		}
+	}
+
+	if summary.ProtocolVersion == 0 {
+		summary.ProtocolVersion = ProgressProtocolV1
+	}
+	summary.Valid = summary.InvalidLines == 0 && summary.ProgressLines > 0
+	return results, summary
+}
@@ -0,0 +1,298 @@
+package aiAgent
+
+import (
+	"context"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrainingResourceIntervalEnv is how often, in seconds, the resource usage of server trainings is
+// sampled (default 5)
+const TrainingResourceIntervalEnv = "TRAINING_RESOURCE_INTERVAL_SECONDS"
+
+const (
+	defaultResourceInterval = 5 * time.Second
+	// maxResourceSamples bounds the samples kept per training. Beyond it every other sample is
+	// dropped, so long runs keep their whole timeline at a coarser resolution.
+	maxResourceSamples = 720
+)
+
+// ResourceSample is the resource usage of a training's processes at one point in time.
+// Fields the machine could not measure are nil.
+type ResourceSample struct {
+	Time time.Time `json:"time"`
+	// CPUPercent is 100 per fully used core
+	CPUPercent *float64 `json:"cpu_percent,omitempty"`
+	// MemoryMB is the resident memory of the training's processes
+	MemoryMB *float64 `json:"memory_mb,omitempty"`
+	// GPUUtilization and GPUMemoryMB are those of the device the training runs on, which may be
+	// shared with other trainings
+	GPUUtilization *float64 `json:"gpu_utilization,omitempty"`
+	GPUMemoryMB    *float64 `json:"gpu_memory_mb,omitempty"`
+}
+
+// ResourceSummary aggregates the resource samples of a training
+type ResourceSummary struct {
+	Samples           int      `json:"samples"`
+	AverageCPUPercent *float64 `json:"average_cpu_percent,omitempty"`
+	PeakCPUPercent    *float64 `json:"peak_cpu_percent,omitempty"`
+	PeakMemoryMB      *float64 `json:"peak_memory_mb,omitempty"`
+	AverageGPUUtil    *float64 `json:"average_gpu_utilization,omitempty"`
+	PeakGPUUtil       *float64 `json:"peak_gpu_utilization,omitempty"`
+	PeakGPUMemoryMB   *float64 `json:"peak_gpu_memory_mb,omitempty"`
+}
+
+// resourceInterval returns how often server trainings are sampled
+func resourceInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv(TrainingResourceIntervalEnv)); err == nil && seconds >= 1 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultResourceInterval
+}
+
+// ParseResourceSample reads a sample reported by an agent. Missing or negative values are left nil.
+func ParseResourceSample(data map[string]interface{}) ResourceSample {
+	value := func(key string) *float64 {
+		if v, ok := data[key].(float64); ok && v >= 0 && !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return &v
+		}
+		return nil
+	}
+	return ResourceSample{
+		Time:           time.Now(),
+		CPUPercent:     value("cpu_percent"),
+		MemoryMB:       value("memory_mb"),
+		GPUUtilization: value("gpu_utilization"),
+		GPUMemoryMB:    value("gpu_memory_mb"),
+	}
+}
+
+// AddResourceSample records the resource usage of the training and streams it to its viewers
+func (tp *TrainingProgress) AddResourceSample(sample ResourceSample) {
+	tp.mu.Lock()
+	tp.Resources = append(tp.Resources, sample)
+	if len(tp.Resources) > maxResourceSamples {
+		thinned := tp.Resources[:0]
+		for i, s := range tp.Resources {
+			if i%2 == 1 || i == len(tp.Resources)-1 {
+				thinned = append(thinned, s)
+			}
+		}
+		tp.Resources = thinned
+	}
+	trainingID := tp.TrainingID
+	tp.mu.Unlock()
+
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "resources", sample)
+	}
+}
+
+// ResourceHistory returns a copy of the resource samples of the training
+func (tp *TrainingProgress) ResourceHistory() []ResourceSample {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return append([]ResourceSample{}, tp.Resources...)
+}
+
+// latestResourcesLocked returns the most recent sample, nil before the first one
+func (tp *TrainingProgress) latestResourcesLocked() *ResourceSample {
+	if n := len(tp.Resources); n > 0 {
+		latest := tp.Resources[n-1]
+		return &latest
+	}
+	return nil
+}
+
+// SummarizeResources aggregates resource samples, nil when there are none
+func SummarizeResources(samples []ResourceSample) *ResourceSummary {
+	if len(samples) == 0 {
+		return nil
+	}
+	type series struct {
+		sum, peak float64
+		n         int
+	}
+	add := func(s *series, v *float64) {
+		if v == nil {
+			return
+		}
+		s.sum += *v
+		s.n++
+		s.peak = math.Max(s.peak, *v)
+	}
+	var cpu, memory, gpu, gpuMemory series
+	for _, sample := range samples {
+		add(&cpu, sample.CPUPercent)
+		add(&memory, sample.MemoryMB)
+		add(&gpu, sample.GPUUtilization)
+		add(&gpuMemory, sample.GPUMemoryMB)
+	}
+	average := func(s series) *float64 {
+		if s.n == 0 {
+			return nil
+		}
+		v := roundTo(s.sum/float64(s.n), 1)
+		return &v
+	}
+	peak := func(s series) *float64 {
+		if s.n == 0 {
+			return nil
+		}
+		v := roundTo(s.peak, 1)
+		return &v
+	}
+	return &ResourceSummary{
+		Samples:           len(samples),
+		AverageCPUPercent: average(cpu),
+		PeakCPUPercent:    peak(cpu),
+		PeakMemoryMB:      peak(memory),
+		AverageGPUUtil:    average(gpu),
+		PeakGPUUtil:       peak(gpu),
+		PeakGPUMemoryMB:   peak(gpuMemory),
+	}
+}
+
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// processSampler measures the CPU and memory of a training's processes
+type processSampler interface {
+	sample(ctx context.Context) (cpuPercent, memoryMB *float64)
+}
+
+// monitorResources samples a running training until stop is called. With a container, the
+// container is measured instead of the CLI process pid.
+func monitorResources(pid int, container *trainingContainer, gpu *GPUAllocation, progress *TrainingProgress) (stop func()) {
+	var processes processSampler
+	if container != nil {
+		processes = &containerStatsSampler{executor: container.Executor, name: container.Name}
+	} else {
+		processes = newProcessTreeSampler(pid)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(resourceInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			sample := ResourceSample{Time: time.Now()}
+			sample.CPUPercent, sample.MemoryMB = processes.sample(ctx)
+			if gpu != nil {
+				sample.GPUUtilization, sample.GPUMemoryMB = sampleGPU(ctx, gpu.Device)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if sample.CPUPercent != nil || sample.MemoryMB != nil || sample.GPUUtilization != nil || sample.GPUMemoryMB != nil {
+				progress.AddResourceSample(sample)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// sampleGPU reads the utilization and used memory of a device with nvidia-smi. MIG partitions
+// report no utilization.
+func sampleGPU(ctx context.Context, device GPUDevice) (utilization, memoryMB *float64) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	id := device.UUID
+	if id == "" {
+		id = device.ID
+	}
+	if device.MIG {
+		id = strconv.Itoa(device.ParentGPU)
+	}
+	output, err := exec.CommandContext(ctx, "nvidia-smi", "--query-gpu=utilization.gpu,memory.used",
+		"--format=csv,noheader,nounits", "-i", id).Output()
+	if err != nil {
+		return nil, nil
+	}
+	fields := strings.Split(strings.TrimSpace(string(output)), ",")
+	if len(fields) != 2 {
+		return nil, nil
+	}
+	parse := func(s string) *float64 {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return &v
+		}
+		return nil
+	}
+	if device.MIG {
+		// The parent GPU's utilization covers every partition
+		return nil, parse(fields[1])
+	}
+	return parse(fields[0]), parse(fields[1])
+}
+
+// containerStatsSampler measures a training container with `docker stats` or `podman stats`
+type containerStatsSampler struct {
+	executor string
+	name     string
+}
+
+func (s *containerStatsSampler) sample(ctx context.Context) (*float64, *float64) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, s.executor, "stats", "--no-stream", "--format",
+		"{{.CPUPerc}};{{.MemUsage}}", s.name).Output()
+	if err != nil {
+		return nil, nil
+	}
+	cpuField, memField, ok := strings.Cut(strings.TrimSpace(string(output)), ";")
+	if !ok {
+		return nil, nil
+	}
+	var cpu, memory *float64
+	if v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(cpuField), "%"), 64); err == nil {
+		cpu = &v
+	}
+	// MemUsage is "<used> / <limit>", e.g. "1.5GiB / 16GiB"
+	used, _, _ := strings.Cut(memField, "/")
+	if v, ok := parseByteSize(strings.TrimSpace(used)); ok {
+		mb := v / (1 << 20)
+		memory = &mb
+	}
+	return cpu, memory
+}
+
+// byteUnits are the suffixes docker and podman print sizes with
+var byteUnits = []struct {
+	suffix string
+	scale  float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+// parseByteSize reads sizes like "512MiB", "1.5GB" or "300kB"
+func parseByteSize(s string) (float64, bool) {
+	for _, unit := range byteUnits {
+		if number, ok := strings.CutSuffix(s, unit.suffix); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil {
+				return 0, false
+			}
+			return v * unit.scale, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package aiAgent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/<pid>/stat, which is 100 on every
+// Linux architecture the server runs on
+const clockTicks = 100
+
+// processTreeSampler measures a process and its descendants from /proc
+type processTreeSampler struct {
+	root     int
+	pageSize float64
+	lastCPU  float64
+	lastTime time.Time
+}
+
+func newProcessTreeSampler(pid int) processSampler {
+	return &processTreeSampler{root: pid, pageSize: float64(os.Getpagesize())}
+}
+
+// procStat is what the sampler reads from /proc/<pid>/stat
+type procStat struct {
+	ppid     int
+	cpuTicks float64
+	rssPages float64
+}
+
+// readProcStat parses /proc/<pid>/stat. The command name is in parentheses and may contain
+// spaces, so fields are counted from the last closing parenthesis.
+func readProcStat(pid string) (procStat, bool) {
+	data, err := os.ReadFile(filepath.Join("/proc", pid, "stat"))
+	if err != nil {
+		return procStat{}, false
+	}
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return procStat{}, false
+	}
+	// Fields after the name start at field 3 (state); ppid is 4, utime 14, stime 15, rss 24
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return procStat{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseFloat(fields[11], 64)
+	stime, _ := strconv.ParseFloat(fields[12], 64)
+	rss, _ := strconv.ParseFloat(fields[21], 64)
+	return procStat{ppid: ppid, cpuTicks: utime + stime, rssPages: rss}, true
+}
+
+func (s *processTreeSampler) sample(ctx context.Context) (*float64, *float64) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, nil
+	}
+	stats := map[int]procStat{}
+	children := map[int][]int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if stat, ok := readProcStat(entry.Name()); ok {
+			stats[pid] = stat
+			children[stat.ppid] = append(children[stat.ppid], pid)
+		}
+	}
+	if _, ok := stats[s.root]; !ok {
+		return nil, nil
+	}
+
+	// Children that exited are no longer counted, so CPU time can go down between samples
+	var cpuTicks, rssPages float64
+	queue := []int{s.root}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		cpuTicks += stats[pid].cpuTicks
+		rssPages += stats[pid].rssPages
+		queue = append(queue, children[pid]...)
+	}
+	memory := rssPages * s.pageSize / (1 << 20)
+
+	now := time.Now()
+	cpuSeconds := cpuTicks / clockTicks
+	var cpu *float64
+	if !s.lastTime.IsZero() && cpuSeconds >= s.lastCPU {
+		v := roundTo((cpuSeconds-s.lastCPU)/now.Sub(s.lastTime).Seconds()*100, 1)
+		cpu = &v
+	}
+	s.lastCPU, s.lastTime = cpuSeconds, now
+	return cpu, &memory
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package aiAgent
+
+import "context"
+
+// processTreeSampler needs /proc; elsewhere only GPUs are sampled
+type processTreeSampler struct{}
+
+func newProcessTreeSampler(pid int) processSampler {
+	return processTreeSampler{}
+}
+
+func (processTreeSampler) sample(ctx context.Context) (*float64, *float64) {
+	return nil, nil
+}
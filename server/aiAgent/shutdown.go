@@ -0,0 +1,121 @@
+package aiAgent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"server/internal/repository"
+)
+
+// StatusInterrupted is used for server trainings stopped because the server shut down. They are
+// recorded in interrupted_trainings and can be resumed from their last checkpoint.
+const StatusInterrupted TrainingStatus = "interrupted"
+
+// ErrShuttingDown is returned for trainings started while the server shuts down
+var ErrShuttingDown = errors.New("the server is shutting down, try again in a moment")
+
+// ShutdownTimeout is how long Shutdown may need: the grace period scripts have to save a checkpoint
+// after SIGTERM, and time to record the interrupted trainings and settle their credits
+func ShutdownTimeout() time.Duration {
+	return preemptionGracePeriod() + 10*time.Second
+}
+
+// Shutdown stops every server training, like an eviction, and records them as interrupted so their
+// owners can resume them once the server is back. Trainings started afterwards are refused. It
+// returns once the scripts exited and the credits of the interrupted trainings were settled, or
+// when ctx is done.
+func (t *Trainer) Shutdown(ctx context.Context) error {
+	t.jobs.mu.Lock()
+	t.jobs.closing = true
+	for trainingID, job := range t.jobs.running {
+		println("🛑 [SCHEDULER] Interrupting training", trainingID, "for shutdown")
+		job.evicted = true
+		job.interrupted = true
+		// Cancelling sends SIGTERM; the script is killed if it is still running after the grace period
+		job.cancel()
+	}
+	queued := t.jobs.queue
+	t.jobs.queue = nil
+	t.jobs.mu.Unlock()
+
+	for _, job := range queued {
+		t.markInterrupted(job.trainingID, job.req, job.progress)
+		reportUsage(job.trainingID, job.progress)
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		t.jobs.mu.Lock()
+		running := len(t.jobs.running)
+		t.jobs.mu.Unlock()
+		if running == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d trainings did not stop: %w", running, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	settled := make(chan struct{})
+	go func() {
+		usageReports.Wait()
+		close(settled)
+	}()
+	select {
+	case <-settled:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("credits of interrupted trainings were not settled: %w", ctx.Err())
+	}
+}
+
+// closing reports whether the trainer was shut down
+func (t *Trainer) closing() bool {
+	t.jobs.mu.Lock()
+	defer t.jobs.mu.Unlock()
+	return t.jobs.closing
+}
+
+// markInterrupted records a training stopped by a shutdown with the request and last checkpoint
+// it resumes from
+func (t *Trainer) markInterrupted(trainingID string, req TrainingRequest, progress *TrainingProgress) {
+	progress.mu.Lock()
+	var checkpoint string
+	if len(progress.Checkpoints) > 0 {
+		checkpoint = progress.Checkpoints[len(progress.Checkpoints)-1].Path
+	} else if n := len(progress.Preemptions); n > 0 {
+		checkpoint = progress.Preemptions[n-1].Checkpoint
+	}
+	progress.Status = StatusInterrupted
+	progress.ErrorMessage = "Interrupted by a server shutdown"
+	progress.clearETALocked()
+	if progress.EndTime == nil {
+		endTime := time.Now()
+		progress.EndTime = &endTime
+	}
+	userID, runSeconds := progress.UserID, progress.RunSeconds
+	progress.mu.Unlock()
+
+	request, err := json.Marshal(req)
+	if err == nil {
+		err = repository.RecordInterruptedTraining(context.Background(), trainingID, userID, request, checkpoint, runSeconds)
+	}
+	if err != nil {
+		println("⚠️  [SCHEDULER] Failed to record interrupted training:", err.Error())
+	}
+
+	println("⏸️  [SCHEDULER] Training", trainingID, "interrupted, last checkpoint:", checkpoint)
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "status", map[string]interface{}{
+			"status":        StatusInterrupted,
+			"error_message": "Interrupted by a server shutdown",
+			"checkpoint":    checkpoint,
+		})
+	}
+}
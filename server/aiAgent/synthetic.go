@@ -0,0 +1,87 @@
+package aiAgent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// SyntheticTraining generates the stdout of a plausible training script for load tests: batch
+// log lines followed by a PROGRESS v2 line per epoch, with loss decaying and accuracy rising
+// towards a plateau plus some noise
+type SyntheticTraining struct {
+	rng          *rand.Rand
+	epoch        int
+	totalEpochs  int
+	batchLines   int
+	finalLoss    float64
+	initialLoss  float64
+	plateau      float64
+	learningRate float64
+}
+
+// NewSyntheticTraining returns a generator for totalEpochs epochs that prints batchLines log
+// lines per epoch. The same seed always produces the same run.
+func NewSyntheticTraining(seed int64, totalEpochs, batchLines int) *SyntheticTraining {
+	rng := rand.New(rand.NewSource(seed))
+	return &SyntheticTraining{
+		rng:          rng,
+		totalEpochs:  totalEpochs,
+		batchLines:   batchLines,
+		initialLoss:  1.5 + rng.Float64(),
+		finalLoss:    0.05 + 0.2*rng.Float64(),
+		plateau:      0.75 + 0.2*rng.Float64(),
+		learningRate: 0.001,
+	}
+}
+
+// Done reports whether every epoch was generated
+func (s *SyntheticTraining) Done() bool {
+	return s.epoch >= s.totalEpochs
+}
+
+// NextEpoch returns the lines printed during the next epoch, the last one being its PROGRESS
+// line, or nil once the run is done
+func (s *SyntheticTraining) NextEpoch() []string {
+	if s.Done() {
+		return nil
+	}
+	s.epoch++
+
+	// Fraction of the run completed, drives the learning curves
+	done := float64(s.epoch) / float64(s.totalEpochs)
+	decay := math.Exp(-4 * done)
+	loss := s.finalLoss + (s.initialLoss-s.finalLoss)*decay
+	accuracy := s.plateau * (1 - decay)
+
+	lines := make([]string, 0, s.batchLines+1)
+	for batch := 1; batch <= s.batchLines; batch++ {
+		batchLoss := loss * (1 + 0.1*(s.rng.Float64()-0.5)) * (1 + 0.2*float64(s.batchLines-batch)/float64(s.batchLines))
+		lines = append(lines, fmt.Sprintf("Epoch %d/%d [batch %d/%d] loss: %.4f", s.epoch, s.totalEpochs, batch, s.batchLines, batchLoss))
+	}
+
+	if s.epoch%10 == 0 {
+		s.learningRate /= 2
+	}
+	status := "training"
+	if s.Done() {
+		status = "completed"
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"version":        ProgressProtocolV2,
+		"epoch":          s.epoch,
+		"total_epochs":   s.totalEpochs,
+		"train_loss":     round4(loss * (1 + 0.05*(s.rng.Float64()-0.5))),
+		"val_loss":       round4(loss * (1.1 + 0.1*s.rng.Float64())),
+		"train_accuracy": round4(math.Min(1, accuracy*(1.02+0.02*s.rng.Float64()))),
+		"val_accuracy":   round4(accuracy * (1 + 0.03*(s.rng.Float64()-0.5))),
+		"status":         status,
+		"metrics":        map[string]float64{"learning_rate": s.learningRate},
+	})
+	return append(lines, ProgressPrefix+" "+string(payload))
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
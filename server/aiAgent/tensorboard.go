@@ -0,0 +1,476 @@
+package aiAgent
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// TrainingTensorBoardEnv set to false stops reading the TensorBoard event files of server trainings
+const TrainingTensorBoardEnv = "TRAINING_TENSORBOARD"
+
+const (
+	// tensorBoardInterval is how often event files are read while a training runs
+	tensorBoardInterval = 10 * time.Second
+	// tensorBoardMaxDepth bounds how deep the log folder is searched for event files
+	tensorBoardMaxDepth = 4
+	// maxTensorBoardSteps bounds the steps merged per training, for scripts logging every batch
+	maxTensorBoardSteps = 5000
+)
+
+// TensorBoardConfig is the "tensorboard" section of aimanage.json
+type TensorBoardConfig struct {
+	// LogDir is the folder, relative to the model folder, the script writes event files to.
+	// The whole model folder is searched when it is empty.
+	LogDir string `json:"log_dir,omitempty"`
+}
+
+// errCorruptRecord is returned for TFRecords whose checksum does not match
+var errCorruptRecord = errors.New("corrupt TFRecord")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// maskedCRC is the checksum TFRecord files store
+func maskedCRC(data []byte) uint32 {
+	crc := crc32.Checksum(data, castagnoli)
+	return ((crc >> 15) | (crc << 17)) + 0xa282ead8
+}
+
+// readTFRecords calls record for each complete record of a TFRecord file from offset, and returns
+// the offset after the last one. A record still being written is left for the next read.
+func readTFRecords(path string, offset int64, record func([]byte)) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	header := make([]byte, 12)
+	footer := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			return offset, nil
+		}
+		if binary.LittleEndian.Uint32(header[8:]) != maskedCRC(header[:8]) {
+			return offset, errCorruptRecord
+		}
+		length := binary.LittleEndian.Uint64(header[:8])
+		if length > 64<<20 {
+			return offset, errCorruptRecord
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(f, data); err != nil {
+			return offset, nil
+		}
+		if _, err := io.ReadFull(f, footer); err != nil {
+			return offset, nil
+		}
+		if binary.LittleEndian.Uint32(footer) != maskedCRC(data) {
+			return offset, errCorruptRecord
+		}
+		record(data)
+		offset += int64(len(header)) + int64(length) + int64(len(footer))
+	}
+}
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoFields calls field for each field of a protobuf message. Varint and fixed values are
+// passed in v, length-delimited ones in b.
+func protoFields(msg []byte, field func(num, wireType int, v uint64, b []byte)) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errCorruptRecord
+		}
+		msg = msg[n:]
+		num, wireType := int(key>>3), int(key&7)
+		switch wireType {
+		case wireVarint:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return errCorruptRecord
+			}
+			msg = msg[n:]
+			field(num, wireType, v, nil)
+		case wireFixed64:
+			if len(msg) < 8 {
+				return errCorruptRecord
+			}
+			field(num, wireType, binary.LittleEndian.Uint64(msg), nil)
+			msg = msg[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < length {
+				return errCorruptRecord
+			}
+			field(num, wireType, 0, msg[n:n+int(length)])
+			msg = msg[n+int(length):]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return errCorruptRecord
+			}
+			field(num, wireType, uint64(binary.LittleEndian.Uint32(msg)), nil)
+			msg = msg[4:]
+		default:
+			return errCorruptRecord
+		}
+	}
+	return nil
+}
+
+// tensorBoardScalar is a scalar summary of an event file
+type tensorBoardScalar struct {
+	Tag   string
+	Value float64
+}
+
+// parseEvent returns the step and scalar summaries of an Event message. Scalars are written as
+// simple values (PyTorch, TF1) or as single-value float tensors of the scalars plugin (TF2).
+func parseEvent(data []byte) (int64, []tensorBoardScalar) {
+	var step int64
+	var scalars []tensorBoardScalar
+	protoFields(data, func(num, wireType int, v uint64, b []byte) {
+		switch {
+		case num == 2 && wireType == wireVarint: // step
+			step = int64(v)
+		case num == 5 && wireType == wireBytes: // summary
+			protoFields(b, func(num, wireType int, _ uint64, value []byte) {
+				if num == 1 && wireType == wireBytes {
+					if scalar, ok := parseSummaryValue(value); ok {
+						scalars = append(scalars, scalar)
+					}
+				}
+			})
+		}
+	})
+	return step, scalars
+}
+
+// parseSummaryValue reads a Summary.Value, returning false for non-scalar summaries
+func parseSummaryValue(data []byte) (tensorBoardScalar, bool) {
+	var scalar tensorBoardScalar
+	var plugin string
+	var values []float64
+	hasSimple := false
+	protoFields(data, func(num, wireType int, v uint64, b []byte) {
+		switch {
+		case num == 1 && wireType == wireBytes: // tag
+			scalar.Tag = string(b)
+		case num == 2 && wireType == wireFixed32: // simple_value
+			scalar.Value = float32Value(uint32(v))
+			hasSimple = true
+		case num == 8 && wireType == wireBytes: // tensor
+			values = tensorValues(b)
+		case num == 9 && wireType == wireBytes: // metadata.plugin_data.plugin_name
+			protoFields(b, func(num, wireType int, _ uint64, pluginData []byte) {
+				if num == 1 && wireType == wireBytes {
+					protoFields(pluginData, func(num, wireType int, _ uint64, name []byte) {
+						if num == 1 && wireType == wireBytes {
+							plugin = string(name)
+						}
+					})
+				}
+			})
+		}
+	})
+	if scalar.Tag == "" {
+		return scalar, false
+	}
+	if hasSimple {
+		return scalar, true
+	}
+	if (plugin == "" || plugin == "scalars") && len(values) == 1 {
+		scalar.Value = values[0]
+		return scalar, true
+	}
+	return scalar, false
+}
+
+// float32Value converts the bits of a float32 to the float64 printed the same, so 0.9 does not
+// become 0.8999999761581421
+func float32Value(bits uint32) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(math.Float32frombits(bits)), 'g', -1, 32), 64)
+	return v
+}
+
+// TensorFlow data types of scalar tensors
+const (
+	dtFloat  = 1
+	dtDouble = 2
+)
+
+// tensorValues returns the values of a float or double TensorProto
+func tensorValues(data []byte) []float64 {
+	var dtype uint64
+	var content []byte
+	var values []float64
+	protoFields(data, func(num, wireType int, v uint64, b []byte) {
+		switch {
+		case num == 1 && wireType == wireVarint:
+			dtype = v
+		case num == 4 && wireType == wireBytes: // tensor_content
+			content = b
+		case num == 5 && wireType == wireFixed32: // float_val
+			values = append(values, float32Value(uint32(v)))
+		case num == 5 && wireType == wireBytes: // packed float_val
+			for ; len(b) >= 4; b = b[4:] {
+				values = append(values, float32Value(binary.LittleEndian.Uint32(b)))
+			}
+		case num == 6 && wireType == wireFixed64: // double_val
+			values = append(values, math.Float64frombits(v))
+		case num == 6 && wireType == wireBytes: // packed double_val
+			for ; len(b) >= 8; b = b[8:] {
+				values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			}
+		}
+	})
+	switch {
+	case dtype == dtFloat && content != nil:
+		for ; len(content) >= 4; content = content[4:] {
+			values = append(values, float32Value(binary.LittleEndian.Uint32(content)))
+		}
+	case dtype == dtDouble && content != nil:
+		for ; len(content) >= 8; content = content[8:] {
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(content)))
+		}
+	case dtype != dtFloat && dtype != dtDouble:
+		return nil
+	}
+	return values
+}
+
+// applyTensorBoardScalar merges a scalar into metrics. The split (train, validation or test) and
+// the kind (loss or accuracy) are read from the run folder and the tag, e.g. "Loss/train" or
+// Keras' "validation/epoch_accuracy". Other scalars become custom metrics.
+func applyTensorBoardScalar(metrics *TrainingMetrics, run string, scalar tensorBoardScalar) {
+	words := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(run+"/"+scalar.Tag), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+	split := "train"
+	switch {
+	case words["val"] || words["valid"] || words["validation"]:
+		split = "val"
+	case words["test"]:
+		split = "test"
+	}
+	value := scalar.Value
+	switch {
+	case words["loss"]:
+		switch split {
+		case "train":
+			metrics.TrainLoss = value
+		case "val":
+			metrics.ValLoss = value
+		case "test":
+			if metrics.ValLoss == 0 {
+				metrics.ValLoss = value // Use ValLoss field for test loss
+			}
+		}
+	case words["acc"] || words["accuracy"]:
+		if value > 1 {
+			value /= 100
+		}
+		switch split {
+		case "train":
+			metrics.TrainAccuracy = value
+		case "val":
+			metrics.ValAccuracy = value
+		case "test":
+			metrics.TestAccuracy = value
+		}
+	default:
+		if metrics.CustomMetrics == nil {
+			metrics.CustomMetrics = make(map[string]interface{})
+		}
+		name := scalar.Tag
+		if run != "" {
+			name = run + "/" + name
+		}
+		metrics.CustomMetrics[name] = value
+	}
+}
+
+// tensorBoardReader merges the scalars of the event files a training writes into its metrics
+type tensorBoardReader struct {
+	dir string
+	// since skips the event files of earlier trainings
+	since   time.Time
+	offsets map[string]int64
+	steps   map[int64]*TrainingMetrics
+	// emitted is the highest step merged so far, -1 before the first
+	emitted int64
+	merged  int
+	// off is set once the script reports metrics itself, or the event files are unreadable
+	off bool
+}
+
+func newTensorBoardReader(absWorkingDir string, config *TensorBoardConfig) *tensorBoardReader {
+	dir := absWorkingDir
+	if config != nil && config.LogDir != "" {
+		dir = filepath.Join(absWorkingDir, filepath.Clean("/"+config.LogDir))
+	}
+	return &tensorBoardReader{
+		dir:     dir,
+		since:   time.Now().Truncate(time.Second),
+		offsets: map[string]int64{},
+		steps:   map[int64]*TrainingMetrics{},
+		emitted: -1,
+	}
+}
+
+// eventFiles returns the event files written since the training started
+func (r *tensorBoardReader) eventFiles() []string {
+	var files []string
+	filepath.WalkDir(r.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if rel, err := filepath.Rel(r.dir, path); err == nil && rel != "." &&
+				(strings.Count(rel, string(filepath.Separator)) >= tensorBoardMaxDepth || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.Contains(d.Name(), "tfevents") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !info.ModTime().Before(r.since) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// read collects the scalars written since the last read and returns the steps that are complete:
+// those before the latest step, or every step once the training ended
+func (r *tensorBoardReader) read(final bool) []TrainingMetrics {
+	latest := r.emitted
+	for _, file := range r.eventFiles() {
+		run, _ := filepath.Rel(r.dir, filepath.Dir(file))
+		if run == "." {
+			run = ""
+		}
+		run = filepath.ToSlash(run)
+		offset, err := readTFRecords(file, r.offsets[file], func(record []byte) {
+			step, scalars := parseEvent(record)
+			if len(scalars) == 0 || step <= r.emitted {
+				return
+			}
+			metrics, ok := r.steps[step]
+			if !ok {
+				if len(r.steps)+r.merged >= maxTensorBoardSteps {
+					return
+				}
+				metrics = &TrainingMetrics{Epoch: int(step)}
+				r.steps[step] = metrics
+			}
+			for _, scalar := range scalars {
+				// Keras also logs every batch, the epoch scalars are enough for charts
+				if strings.HasPrefix(scalar.Tag, "batch_") {
+					continue
+				}
+				applyTensorBoardScalar(metrics, run, scalar)
+			}
+			if step > latest {
+				latest = step
+			}
+		})
+		if err != nil {
+			println("⚠️  [TENSORBOARD] Stopped reading", file+":", err.Error())
+		}
+		r.offsets[file] = offset
+	}
+
+	var complete []int64
+	for step := range r.steps {
+		if final || step < latest {
+			complete = append(complete, step)
+		}
+	}
+	sort.Slice(complete, func(i, j int) bool { return complete[i] < complete[j] })
+	metrics := make([]TrainingMetrics, 0, len(complete))
+	for _, step := range complete {
+		metrics = append(metrics, *r.steps[step])
+		delete(r.steps, step)
+		r.emitted = step
+		r.merged++
+	}
+	return metrics
+}
+
+// watchTensorBoard merges the TensorBoard scalars of a server training into its metrics while it
+// runs, unless the script reports metrics itself. stop reads the events written until the end.
+func (t *Trainer) watchTensorBoard(trainingID string, absWorkingDir string, req TrainingRequest, progress *TrainingProgress) (stop func()) {
+	if strings.EqualFold(os.Getenv(TrainingTensorBoardEnv), "false") {
+		return func() {}
+	}
+	reader := newTensorBoardReader(absWorkingDir, req.tensorBoard)
+
+	ingest := func(final bool) {
+		if reader.off {
+			return
+		}
+		progress.mu.RLock()
+		scriptMetrics := reader.merged == 0 && len(progress.Metrics) > 0
+		progress.mu.RUnlock()
+		if scriptMetrics {
+			reader.off = true
+			return
+		}
+		metrics := reader.read(final)
+		if len(metrics) > 0 && reader.merged == len(metrics) {
+			println("📈 [TENSORBOARD] Reading metrics of training", trainingID, "from event files in", reader.dir)
+		}
+		for i := range metrics {
+			t.addMetrics(trainingID, progress, &metrics[i])
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(tensorBoardInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ingest(false)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		ingest(true)
+	}
+}
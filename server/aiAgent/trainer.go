@@ -10,12 +10,12 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"server/internal/metricparse"
 	"server/internal/repository"
 )
 
@@ -50,10 +50,13 @@ type TrainingMetrics struct {
 	TestAccuracy  float64                `json:"test_accuracy,omitempty"`
 	Duration      time.Duration          `json:"duration"`
 	CustomMetrics map[string]interface{} `json:"custom_metrics,omitempty"`
+	// Resources is the latest resource sample when the metrics were reported
+	Resources *ResourceSample `json:"resources,omitempty"`
 }
 
 // TrainingProgress tracks the progress of a training session
 type TrainingProgress struct {
+	TrainingID   string            `json:"training_id,omitempty"`
 	UserID       int               `json:"user_id"` // User who owns this training
 	Status       TrainingStatus    `json:"status"`
 	CurrentEpoch int               `json:"current_epoch"`
@@ -65,23 +68,100 @@ type TrainingProgress struct {
 	FinalMetrics *TrainingMetrics  `json:"final_metrics,omitempty"`
 	ErrorMessage string            `json:"error_message,omitempty"`
 	ModelPath    string            `json:"model_path,omitempty"`
+	Checkpoints  []CheckpointInfo  `json:"checkpoints,omitempty"`
+	Artifacts    []ArtifactInfo    `json:"artifacts,omitempty"`
+	// Stages is set for pipeline trainings declared in aimanage.json
+	Stages       []*StageProgress `json:"stages,omitempty"`
+	CurrentStage string           `json:"current_stage,omitempty"`
+	// ProtocolVersion is the PROGRESS protocol version negotiated for this run (0 until the first PROGRESS line)
+	ProtocolVersion int `json:"protocol_version,omitempty"`
+	// Environment is captured after a successful run
+	Environment *EnvironmentSnapshot `json:"environment,omitempty"`
+	// ONNXExport is the outcome of exporting the trained model of a successful run to ONNX
+	ONNXExport *ONNXExport `json:"onnx_export,omitempty"`
+	// GPU is the device a server training was scheduled on
+	GPU *GPUAllocation `json:"gpu,omitempty"`
+	// HardwareTier is the tier the training is priced at; RunSeconds is the time it has held a slot
+	HardwareTier string `json:"hardware_tier,omitempty"`
+	RunSeconds   int    `json:"run_seconds,omitempty"`
+	runTime      time.Duration
+	// ExecutionMode is on_demand or preemptible; Preemptions lists the evictions of a preemptible run
+	ExecutionMode string             `json:"execution_mode,omitempty"`
+	Preemptions   []PreemptionRecord `json:"preemptions,omitempty"`
+	preemptReason string
+	// PrimaryMetric is the metric of record of the trained model (accuracy when nil)
+	PrimaryMetric *PrimaryMetric `json:"primary_metric,omitempty"`
+	// NetworkPolicy is the network access of a server training; EgressAttempts are the
+	// destinations it reached or was blocked from under a restricted policy
+	NetworkPolicy  *NetworkPolicy  `json:"network_policy,omitempty"`
+	EgressAttempts []EgressAttempt `json:"egress_attempts,omitempty"`
+	// Hyperparameters the training was started with
+	Hyperparameters map[string]interface{} `json:"hyperparameters,omitempty"`
+	// LogOffset is the line number of Logs[0]; the lines before it were moved to the log file
+	LogOffset int `json:"log_offset,omitempty"`
+	logFile   *logFile
+	logLimit  int
+	// EarlyStopping are the training's early stopping options; EarlyStop is set once they stopped it
+	EarlyStopping *EarlyStopping `json:"early_stopping,omitempty"`
+	EarlyStop     *EarlyStop     `json:"early_stop,omitempty"`
+	earlyStopper  *earlyStopper
+	// Anomalies found in the metrics by the anomaly detector
+	Anomalies         []TrainingAnomaly `json:"anomalies,omitempty"`
+	anomalyDetector   *anomalyDetector
+	anomalyStopReason string
+	// ETASeconds and EstimatedCompletion estimate when the run finishes from its smoothed epoch duration
+	ETASeconds          *int       `json:"eta_seconds,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+	eta                 etaEstimator
+	// Resources are the sampled CPU, memory and GPU usage of the run
+	Resources []ResourceSample `json:"resources,omitempty"`
+	// checkpointScan finds the checkpoint files of a server training
+	checkpointScan *checkpointTracker
+	// metricParser reads the metrics of the training's output lines
+	metricParser *metricparse.Chain
 	mu           sync.RWMutex
 }
 
 // TrainingRequest represents a request to train a model
 type TrainingRequest struct {
-	UserID        int               `json:"user_id"` // User who owns this training
+	UserID        int               `json:"user_id"`            // User who owns this training
+	ModelID       int               `json:"model_id,omitempty"` // Optional, needed to train a model shared with you
 	FolderName    string            `json:"folder_name"`
-	ScriptName    string            `json:"script_name"`    // e.g., "train.py"
-	PythonCommand string            `json:"python_command"` // e.g., "python3" or "python"
-	Args          []string          `json:"args,omitempty"` // Additional arguments
-	Env           map[string]string `json:"env,omitempty"`  // Environment variables
+	ScriptName    string            `json:"script_name"`              // e.g., "train.py"
+	PythonCommand string            `json:"python_command"`           // e.g., "python3" or "python"
+	Args          []string          `json:"args,omitempty"`           // Additional arguments
+	Env           map[string]string `json:"env,omitempty"`            // Environment variables
+	ExecutionMode string            `json:"execution_mode,omitempty"` // "on_demand" (default) or "preemptible"
+	AgentID       string            `json:"agent_id,omitempty"`       // The user's agent to train on, the idle one with the most GPUs when empty
+	Placement     string            `json:"placement,omitempty"`      // "auto" (default) picks an agent or the server by hardware, "agent" or "server" forces one
+	AnomalyPolicy *AnomalyPolicy    `json:"-"`                        // The model's anomaly policy, defaults apply when nil
+	NetworkPolicy *NetworkPolicy    `json:"-"`                        // Network access of the training, the deployment's when nil
+	// MetricPatterns are the model's custom metric patterns, tried before the built-in parsers
+	MetricPatterns []metricparse.Pattern `json:"-"`
+
+	// IgnoreDatasetWarnings starts the training even if the model's dataset looks broken
+	IgnoreDatasetWarnings bool `json:"ignore_dataset_warnings,omitempty"`
+
+	// Hyperparameters such as epochs, batch_size and learning_rate, passed to the script as JSON
+	// and, with HyperparameterFormat "args", as command line flags
+	Hyperparameters      map[string]interface{} `json:"hyperparameters,omitempty"`
+	HyperparameterFormat string                 `json:"hyperparameter_format,omitempty"` // "json" (default) or "args"
+
+	// EarlyStopping stops the training once a target validation accuracy is reached or the loss
+	// stopped improving
+	EarlyStopping *EarlyStopping `json:"early_stopping,omitempty"`
+
+	pipeline    []PipelineStage    // Stages from aimanage.json, in execution order
+	checkpoints *CheckpointConfig  // Checkpoint settings from aimanage.json
+	tensorBoard *TensorBoardConfig // TensorBoard settings from aimanage.json
 }
 
 // Trainer handles model training execution
 type Trainer struct {
 	navigator      *DirectoryNavigator
 	activeTraining map[string]*TrainingProgress
+	gpus           *GPUAllocator
+	jobs           *jobScheduler
 	mu             sync.RWMutex
 }
 
@@ -90,11 +170,17 @@ func NewTrainer(navigator *DirectoryNavigator) *Trainer {
 	return &Trainer{
 		navigator:      navigator,
 		activeTraining: make(map[string]*TrainingProgress),
+		gpus:           NewGPUAllocator(),
+		jobs:           newJobScheduler(),
 	}
 }
 
 // StartTraining starts a training job
 func (t *Trainer) StartTraining(ctx context.Context, req TrainingRequest) (*TrainingProgress, error) {
+	if t.closing() {
+		return nil, ErrShuttingDown
+	}
+
 	println("📂 [TRAINER] Validating folder:", req.FolderName)
 
 	// Validate folder exists
@@ -104,15 +190,71 @@ func (t *Trainer) StartTraining(ctx context.Context, req TrainingRequest) (*Trai
 	}
 	println("✅ [TRAINER] Folder exists")
 
-	// Get full path to script
-	scriptPath := filepath.Join(t.navigator.BaseUploadPath, req.FolderName, req.ScriptName)
-	println("📄 [TRAINER] Looking for script at:", scriptPath)
+	// A pipeline declared in aimanage.json replaces the single training script
+	folderPath := filepath.Join(t.navigator.BaseUploadPath, req.FolderName)
+	config, err := LoadModelConfig(folderPath)
+	if err != nil {
+		println("❌ [TRAINER] Invalid model config:", err.Error())
+		return nil, err
+	}
+
+	var stages []*StageProgress
+	if config != nil && config.Pipeline != nil {
+		ordered, deps, err := config.Pipeline.Order()
+		if err != nil {
+			println("❌ [TRAINER] Invalid pipeline:", err.Error())
+			return nil, fmt.Errorf("invalid pipeline in %s: %w", ModelConfigFile, err)
+		}
+		for i, stage := range ordered {
+			scriptPath := filepath.Join(folderPath, stage.Script)
+			if _, err := os.Stat(scriptPath); err != nil {
+				println("❌ [TRAINER] Stage script not found:", scriptPath)
+				return nil, fmt.Errorf("script '%s' for stage '%s' not found: %w", stage.Script, stage.Name, err)
+			}
+			stages = append(stages, &StageProgress{
+				Name:      stage.Name,
+				Script:    stage.Script,
+				DependsOn: deps[i],
+				Status:    StatusPending,
+				Logs:      []string{},
+				Metrics:   []TrainingMetrics{},
+			})
+		}
+		req.pipeline = ordered
+		println("🧩 [TRAINER] Pipeline with", len(stages), "stages")
+	} else {
+		// Get full path to script
+		scriptPath := filepath.Join(folderPath, req.ScriptName)
+		println("📄 [TRAINER] Looking for script at:", scriptPath)
+
+		if _, err := os.Stat(scriptPath); err != nil {
+			println("❌ [TRAINER] Script not found:", scriptPath)
+			return nil, fmt.Errorf("training script '%s' not found: %w", req.ScriptName, err)
+		}
+		println("✅ [TRAINER] Script found")
+	}
+
+	if config != nil {
+		req.checkpoints = config.Checkpoints
+		req.tensorBoard = config.TensorBoard
+	}
 
-	if _, err := os.Stat(scriptPath); err != nil {
-		println("❌ [TRAINER] Script not found:", scriptPath)
-		return nil, fmt.Errorf("training script '%s' not found: %w", req.ScriptName, err)
+	if req.ExecutionMode == "" {
+		req.ExecutionMode = ExecutionModeOnDemand
+	}
+	if req.ExecutionMode != ExecutionModeOnDemand && req.ExecutionMode != ExecutionModePreemptible {
+		return nil, fmt.Errorf("execution_mode must be '%s' or '%s'", ExecutionModeOnDemand, ExecutionModePreemptible)
+	}
+	hyperparameters, err := ValidateHyperparameters(req.Hyperparameters, req.HyperparameterFormat)
+	if err != nil {
+		return nil, err
+	}
+	req.Hyperparameters = hyperparameters
+	if req.EarlyStopping != nil {
+		if err := req.EarlyStopping.Validate(); err != nil {
+			return nil, err
+		}
 	}
-	println("✅ [TRAINER] Script found")
 
 	// Create progress tracker
 	progress := &TrainingProgress{
@@ -122,10 +264,26 @@ func (t *Trainer) StartTraining(ctx context.Context, req TrainingRequest) (*Trai
 		Logs:        []string{},
 		Metrics:     []TrainingMetrics{},
 		TotalEpochs: 0,
+		Stages:      stages,
+
+		ExecutionMode:   req.ExecutionMode,
+		Hyperparameters: req.Hyperparameters,
 	}
+	networkPolicy := DeploymentNetworkPolicy()
+	if req.NetworkPolicy != nil {
+		networkPolicy = networkPolicy.Stricter(*req.NetworkPolicy)
+	}
+	progress.NetworkPolicy = &networkPolicy
+	if req.AnomalyPolicy != nil {
+		progress.anomalyDetector = newAnomalyDetector(*req.AnomalyPolicy)
+		progress.setPrimaryMetricLocked(req.AnomalyPolicy.Metric)
+	}
+	progress.SetEarlyStopping(req.EarlyStopping)
+	progress.SetMetricPatterns(req.MetricPatterns)
 
 	// Store in active trainings
 	trainingID := fmt.Sprintf("%s_%d", req.FolderName, time.Now().Unix())
+	progress.TrainingID = trainingID
 	println("🆔 [TRAINER] Training ID:", trainingID)
 
 	t.mu.Lock()
@@ -136,7 +294,7 @@ func (t *Trainer) StartTraining(ctx context.Context, req TrainingRequest) (*Trai
 
 	// Start training in background
 	println("🚀 [TRAINER] Starting training in background goroutine")
-	go t.executeTraining(ctx, trainingID, req, progress)
+	t.launch(ctx, trainingID, req, progress)
 
 	return progress, nil
 }
@@ -181,58 +339,23 @@ func (t *Trainer) executeTraining(ctx context.Context, trainingID string, req Tr
 							progress.mu.Lock()
 							progress.ModelPath = relPath
 
-							// Extract final accuracy from training progress
-							// Note: Database expects percentage format (e.g., 95.50), but metrics are in 0-1 range
+							// Extract final accuracy and the model's primary metric from training progress
+							// Note: Database expects accuracy in percentage format (e.g., 95.50), but metrics are in 0-1 range
 							var finalAccuracy *float64
-							// Prefer FinalMetrics if available, then last metric from Metrics array
-							if progress.FinalMetrics != nil {
-								// Use FinalMetrics (prefer test > val > train)
-								if progress.FinalMetrics.TestAccuracy > 0 {
-									acc := progress.FinalMetrics.TestAccuracy * 100 // Convert 0-1 range to percentage
-									finalAccuracy = &acc
-									println(fmt.Sprintf("📊 [EXECUTE] Using FinalMetrics test accuracy: %.2f%%", acc))
-								} else if progress.FinalMetrics.ValAccuracy > 0 {
-									acc := progress.FinalMetrics.ValAccuracy * 100 // Convert 0-1 range to percentage
-									finalAccuracy = &acc
-									println(fmt.Sprintf("📊 [EXECUTE] Using FinalMetrics validation accuracy: %.2f%%", acc))
-								} else if progress.FinalMetrics.TrainAccuracy > 0 {
-									acc := progress.FinalMetrics.TrainAccuracy * 100 // Convert 0-1 range to percentage
-									finalAccuracy = &acc
-									println(fmt.Sprintf("📊 [EXECUTE] Using FinalMetrics train accuracy: %.2f%%", acc))
-								}
+							if acc, ok := DefaultPrimaryMetric().Final(progress); ok {
+								finalAccuracy = &acc
+								println(fmt.Sprintf("📊 [EXECUTE] Final accuracy: %.2f%%", acc))
 							}
-							// Fallback: search through all metrics (reverse order) to find the most recent accuracy
-							if finalAccuracy == nil && len(progress.Metrics) > 0 {
-								// Search from end to beginning to find the most recent metric with accuracy
-								for i := len(progress.Metrics) - 1; i >= 0; i-- {
-									metric := progress.Metrics[i]
-									if metric.TestAccuracy > 0 {
-										acc := metric.TestAccuracy * 100 // Convert 0-1 range to percentage
-										finalAccuracy = &acc
-										println(fmt.Sprintf("📊 [EXECUTE] Using metric[%d] test accuracy: %.2f%%", i, acc))
-										break
-									} else if metric.ValAccuracy > 0 {
-										acc := metric.ValAccuracy * 100 // Convert 0-1 range to percentage
-										finalAccuracy = &acc
-										println(fmt.Sprintf("📊 [EXECUTE] Using metric[%d] validation accuracy: %.2f%%", i, acc))
-										break
-									} else if metric.TrainAccuracy > 0 {
-										acc := metric.TrainAccuracy * 100 // Convert 0-1 range to percentage
-										finalAccuracy = &acc
-										println(fmt.Sprintf("📊 [EXECUTE] Using metric[%d] train accuracy: %.2f%%", i, acc))
-										break
-									}
-								}
+							primaryMetric := DefaultPrimaryMetric()
+							if progress.PrimaryMetric != nil {
+								primaryMetric = *progress.PrimaryMetric
 							}
-							if finalAccuracy == nil {
-								println("⚠️  [EXECUTE] No accuracy found in training progress")
-								println(fmt.Sprintf("   FinalMetrics: %v", progress.FinalMetrics != nil))
-								if progress.FinalMetrics != nil {
-									println(fmt.Sprintf("   FinalMetrics.TestAccuracy: %.4f", progress.FinalMetrics.TestAccuracy))
-									println(fmt.Sprintf("   FinalMetrics.ValAccuracy: %.4f", progress.FinalMetrics.ValAccuracy))
-									println(fmt.Sprintf("   FinalMetrics.TrainAccuracy: %.4f", progress.FinalMetrics.TrainAccuracy))
-								}
-								println(fmt.Sprintf("   Total metrics: %d", len(progress.Metrics)))
+							var finalMetric *float64
+							if value, ok := primaryMetric.Final(progress); ok {
+								finalMetric = &value
+								println(fmt.Sprintf("📊 [EXECUTE] Final %s: %.4g", primaryMetric.Name, value))
+							} else {
+								println(fmt.Sprintf("⚠️  [EXECUTE] No %s found in training progress (%d metrics)", primaryMetric.Name, len(progress.Metrics)))
 							}
 							progress.mu.Unlock()
 
@@ -249,6 +372,17 @@ func (t *Trainer) executeTraining(ctx context.Context, trainingID string, req Tr
 									println("✅ [EXECUTE] Database updated with trained model path")
 								}
 							}
+							if finalMetric != nil {
+								if err := repository.UpdateModelPrimaryMetricValue(dbCtx, req.FolderName, *finalMetric); err != nil {
+									println("⚠️  [EXECUTE] Failed to store the primary metric:", err.Error())
+								}
+							}
+
+							// Offer the trained model in a framework-independent format too
+							t.exportRunONNX(trainingID, req, relPath, progress)
+
+							// Keep this training as a new version so retraining never loses the previous model
+							RecordModelVersion(dbCtx, t.navigator.BaseUploadPath, req.FolderName, trainingID, relPath, finalAccuracy, progress)
 						}
 					} else {
 						println("ℹ️  [EXECUTE] No new model files detected")
@@ -265,18 +399,28 @@ func (t *Trainer) executeTraining(ctx context.Context, trainingID string, req Tr
 					"status":        StatusCompleted,
 					"error_message": "",
 					"model_path":    progress.ModelPath,
+					"onnx_export":   progress.ONNXExport,
 				})
 			}
 		}
 		progress.mu.Unlock()
+		saveEgressAttempts(trainingID, progress)
 		println("\n═══════════════════════════════════════")
 		println("🏁 [EXECUTE] Training execution finished")
 		println("═══════════════════════════════════════\n")
 	}()
 
+	// Schedule concurrent jobs onto distinct GPUs
+	gpu := t.gpus.Acquire(trainingID)
+	defer t.gpus.Release(trainingID, gpu)
+	runStart := time.Now()
+	defer func() { progress.addRunTime(time.Since(runStart), gpu) }()
+
 	// Update status
 	progress.mu.Lock()
 	progress.Status = StatusRunning
+	progress.GPU = gpu
+	progress.eta.restart(time.Now())
 	progress.mu.Unlock()
 	println("▶️  [EXECUTE] Status changed to RUNNING")
 
@@ -285,6 +429,7 @@ func (t *Trainer) executeTraining(ctx context.Context, trainingID string, req Tr
 		broadcastCallback(trainingID, "status", map[string]interface{}{
 			"status":        StatusRunning,
 			"error_message": "",
+			"gpu":           gpu,
 		})
 	}
 
@@ -295,61 +440,181 @@ func (t *Trainer) executeTraining(ctx context.Context, trainingID string, req Tr
 		t.setError(progress, trainingID, fmt.Errorf("failed to resolve working directory: %w", err))
 		return
 	}
+	progress.mu.Lock()
+	progress.checkpointScan = newCheckpointTracker(absWorkingDir, req.checkpoints)
+	progress.mu.Unlock()
 
+	// Scripts that only write TensorBoard event files still get charts
+	stopTensorBoard := t.watchTensorBoard(trainingID, absWorkingDir, req, progress)
+	if len(req.pipeline) > 0 {
+		err = t.runPipeline(ctx, trainingID, req, absWorkingDir, req.pipeline, progress)
+	} else {
+		err = t.runScript(ctx, trainingID, req, absWorkingDir, req.ScriptName, req.Args, nil, progress)
+	}
+	stopTensorBoard()
+	// Checkpoints saved after the last epoch, or while the script was stopping
+	progress.detectCheckpoints()
+	if t.wasEvicted(trainingID) {
+		// The scheduler records the eviction and resumes the training later
+		return
+	}
+	if reason := progress.AnomalyStopReason(); reason != "" {
+		t.setError(progress, trainingID, fmt.Errorf("stopped by anomaly detection: %s", reason))
+		return
+	}
+	// A training stopped early completes with the model it saved so far
+	if stop := progress.EarlyStopped(); stop != nil {
+		progress.AddLog("Stopped early: " + stop.Message)
+		err = nil
+	}
+	if err != nil {
+		t.setError(progress, trainingID, err)
+		return
+	}
+
+	// Record the exact environment so the run can be reproduced
+	t.captureRunEnvironment(trainingID, req, absWorkingDir, progress)
+
+	// Training completed successfully
+	progress.mu.Lock()
+	progress.Status = StatusCompleted
+	progress.clearETALocked()
+	progress.mu.Unlock()
+}
+
+// runScript runs a single python script in the model folder and streams its output into progress
+func (t *Trainer) runScript(ctx context.Context, trainingID string, req TrainingRequest, absWorkingDir string, scriptName string, scriptArgs []string, stageEnv map[string]string, progress *TrainingProgress) error {
 	// Always use direct python execution (skip wrapper scripts to avoid package compilation)
 	pythonCmd := req.PythonCommand
 	if pythonCmd == "" {
 		pythonCmd = "python3"
 	}
 
-	scriptPath := filepath.Join(absWorkingDir, req.ScriptName)
+	scriptPath := filepath.Join(absWorkingDir, scriptName)
+	if req.HyperparameterFormat == HyperparameterFormatArgs {
+		scriptArgs = append(append([]string{}, scriptArgs...), HyperparameterArgs(req.Hyperparameters)...)
+	}
 
 	println("📍 [EXECUTE] Working directory:", absWorkingDir)
 	println("🐍 [EXECUTE] Python command:", pythonCmd)
 	println("📜 [EXECUTE] Script path:", scriptPath)
 
 	// Use only the script name since we're setting the working directory
-	args := append([]string{req.ScriptName}, req.Args...)
-	println("🔧 [EXECUTE] Full command:", pythonCmd, args)
-
-	cmd := exec.CommandContext(ctx, pythonCmd, args...)
-	cmd.Dir = absWorkingDir
+	args := append([]string{scriptName}, scriptArgs...)
+	executor := TrainingExecutor()
+	println("🔧 [EXECUTE] Full command:", pythonCmd, args, "on", executor)
 
 	// Set environment variables
-	cmd.Env = os.Environ()
 	// Force Python unbuffered output for real-time logs
-	cmd.Env = append(cmd.Env, "PYTHONUNBUFFERED=1")
+	env := []string{"PYTHONUNBUFFERED=1"}
 	// Optional hints for standardized model saving (users can use or ignore)
-	cmd.Env = append(cmd.Env, fmt.Sprintf("MODEL_OUTPUT_DIR=%s", filepath.Join(absWorkingDir, "saved_models")))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("MODEL_NAME=%s", req.FolderName))
+	env = append(env, fmt.Sprintf("MODEL_OUTPUT_DIR=%s", filepath.Join(absWorkingDir, "saved_models")))
+	env = append(env, fmt.Sprintf("MODEL_NAME=%s", req.FolderName))
+	// Newest PROGRESS protocol version the server understands
+	env = append(env, fmt.Sprintf("%s=%d", ProgressProtocolEnv, LatestProgressProtocol))
+	// Pin the job to its assigned GPU or MIG partition
+	progress.mu.RLock()
+	gpu := progress.GPU
+	progress.mu.RUnlock()
+	if gpu != nil && executor == ExecutorHost {
+		env = append(env, "CUDA_VISIBLE_DEVICES="+gpu.Device.ID)
+	}
 	for key, val := range req.Env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, val))
+		env = append(env, fmt.Sprintf("%s=%s", key, val))
+	}
+	for key, val := range stageEnv {
+		env = append(env, fmt.Sprintf("%s=%s", key, val))
+	}
+	// Hyperparameters are readable as JSON from the environment or from a file
+	var paramsDir string
+	if len(req.Hyperparameters) > 0 {
+		params, err := json.Marshal(req.Hyperparameters)
+		if err != nil {
+			return fmt.Errorf("failed to encode hyperparameters: %w", err)
+		}
+		paramsFile, err := writeHyperparametersFile(req.Hyperparameters)
+		if err != nil {
+			return err
+		}
+		paramsDir = filepath.Dir(paramsFile)
+		defer os.RemoveAll(paramsDir)
+		env = append(env, HyperparametersEnv+"="+string(params), HyperparametersFileEnv+"="+paramsFile)
+	}
+
+	// Restrict the network of the script to the training's policy
+	progress.mu.RLock()
+	networkPolicy := progress.NetworkPolicy
+	progress.mu.RUnlock()
+	networkMode := NetworkModeOpen
+	if networkPolicy != nil {
+		networkMode = networkPolicy.Mode
+		if networkMode == NetworkModeAllowlist {
+			proxy, err := startEgressProxy(*networkPolicy, progress)
+			if err != nil {
+				return err
+			}
+			defer proxy.Close()
+			env = append(env, proxy.Env()...)
+			println("🔒 [EXECUTE] Network limited to", strings.Join(networkPolicy.AllowedHosts, ", "))
+		}
+	}
+
+	var cmd *exec.Cmd
+	var container *trainingContainer
+	if executor == ExecutorHost {
+		cmd = exec.CommandContext(ctx, pythonCmd, args...)
+		cmd.Dir = absWorkingDir
+		cmd.Env = append(os.Environ(), env...)
+		if networkMode == NetworkModeNone {
+			if err := isolateNetwork(cmd); err != nil {
+				return err
+			}
+		}
+	} else {
+		run := t.trainingContainer(executor, trainingID, req, absWorkingDir)
+		run.Env = env
+		run.GPU = gpu
+		run.Network = networkMode
+		if paramsDir != "" {
+			run = run.withMount(paramsDir)
+		}
+		container = &run
+		cmd = run.command(ctx, append([]string{containerPython}, args...)...)
+		defer run.remove()
+		println("📦 [EXECUTE] Running in", executor, "container", run.Name, "with image", run.Image)
 	}
+	if networkMode == NetworkModeNone {
+		println("🔒 [EXECUTE] Running without network")
+	}
+	// On cancellation (e.g. eviction of a preemptible training) give the script time to checkpoint
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = preemptionGracePeriod()
 
 	// Create pipes for stdout and stderr
 	println("📡 [EXECUTE] Creating output pipes...")
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		println("❌ [EXECUTE] Failed to create stdout pipe:", err.Error())
-		t.setError(progress, trainingID, fmt.Errorf("failed to create stdout pipe: %w", err))
-		return
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		println("❌ [EXECUTE] Failed to create stderr pipe:", err.Error())
-		t.setError(progress, trainingID, fmt.Errorf("failed to create stderr pipe: %w", err))
-		return
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
 	// Start command
 	println("🚀 [EXECUTE] Starting Python process...")
 	if err := cmd.Start(); err != nil {
 		println("❌ [EXECUTE] Failed to start process:", err.Error())
-		t.setError(progress, trainingID, fmt.Errorf("failed to start training: %w", err))
-		return
+		return fmt.Errorf("failed to start training: %w", err)
 	}
 	println("✅ [EXECUTE] Python process started successfully!")
+	stopMonitoring := monitorResources(cmd.Process.Pid, container, gpu, progress)
+	defer stopMonitoring()
 
 	// Read output in goroutines
 	var wg sync.WaitGroup
@@ -373,14 +638,10 @@ func (t *Trainer) executeTraining(ctx context.Context, trainingID string, req Tr
 	println("⏳ [EXECUTE] Waiting for process to complete...")
 	if err := cmd.Wait(); err != nil {
 		println("❌ [EXECUTE] Process failed:", err.Error())
-		t.setError(progress, trainingID, fmt.Errorf("training failed: %w", err))
-		return
+		return fmt.Errorf("training failed: %w", err)
 	}
 
-	// Training completed successfully
-	progress.mu.Lock()
-	progress.Status = StatusCompleted
-	progress.mu.Unlock()
+	return nil
 }
 
 // readOutput reads and processes output from the training script
@@ -406,111 +667,158 @@ func (t *Trainer) readOutput(reader io.Reader, progress *TrainingProgress, train
 
 		// Add to logs
 		progress.mu.Lock()
-		progress.Logs = append(progress.Logs, line)
+		progress.appendLogLocked(line)
+		stageName := ""
+		if stage := progress.currentStageLocked(); stage != nil {
+			stage.Logs = trimLogs(append(stage.Logs, line), progress.logLimit)
+			stageName = stage.Name
+		}
 		progress.mu.Unlock()
+		progress.detectBlockedEgress(line)
 
 		// Broadcast log line
 		if broadcastCallback != nil {
 			broadcastCallback(trainingID, "log", map[string]interface{}{
 				"message":  line,
 				"is_error": isError,
+				"stage":    stageName,
 			})
 		}
 
-		// Try to parse PROGRESS JSON lines first (more reliable)
-		if strings.HasPrefix(line, "PROGRESS:") {
-			jsonStr := strings.TrimPrefix(line, "PROGRESS:")
-			jsonStr = strings.TrimSpace(jsonStr)
-			if metrics := t.parseProgressJSON(jsonStr); metrics != nil {
-				println("📊 [METRICS] Parsed from JSON:", fmt.Sprintf("Epoch %d/%d, Loss: %.4f, Train Acc: %.2f%%, Test Acc: %.2f%%",
-					metrics.Epoch, metrics.TotalEpochs, metrics.TrainLoss, metrics.TrainAccuracy*100, metrics.TestAccuracy*100))
-
-				progress.mu.Lock()
-				progress.Metrics = append(progress.Metrics, *metrics)
-				progress.CurrentEpoch = metrics.Epoch
-				if metrics.TotalEpochs > progress.TotalEpochs {
-					progress.TotalEpochs = metrics.TotalEpochs
-				}
-				// Store final metrics if:
-				// 1. Status is "completed"
-				// 2. This is the last epoch
-				// 3. Has any accuracy
-				isCompleted := false
-				if metrics.CustomMetrics != nil {
-					if status, ok := metrics.CustomMetrics["status"].(string); ok && status == "completed" {
-						isCompleted = true
-					}
-				}
-				if isCompleted || metrics.TestAccuracy > 0 || metrics.ValAccuracy > 0 || metrics.TrainAccuracy > 0 ||
-					(metrics.Epoch == metrics.TotalEpochs && metrics.TotalEpochs > 0) {
-					progress.SetFinalMetrics(metrics)
-					if isCompleted {
-						println(fmt.Sprintf("📊 [METRICS] Set FinalMetrics (status=completed) with accuracy: Test=%.2f%%, Val=%.2f%%, Train=%.2f%%",
-							metrics.TestAccuracy*100, metrics.ValAccuracy*100, metrics.TrainAccuracy*100))
-					}
-				}
-				progress.mu.Unlock()
-
-				// Broadcast metrics update
-				if broadcastCallback != nil {
-					broadcastCallback(trainingID, "metrics", metrics)
-				}
+		// Checkpoints and artifacts declared by the script
+		if checkpoint, ok := ParseCheckpointLine(line); ok {
+			progress.recordCheckpoint(*checkpoint)
+			continue
+		}
+		if artifact, ok := ParseArtifactLine(line); ok {
+			progress.AddArtifact(*artifact)
+			if broadcastCallback != nil {
+				broadcastCallback(trainingID, "artifact", artifact)
+			}
+			continue
+		}
 
-				// Broadcast progress update
-				if broadcastCallback != nil {
-					progress.mu.RLock()
-					broadcastCallback(trainingID, "progress", map[string]interface{}{
-						"status":        progress.Status,
-						"current_epoch": progress.CurrentEpoch,
-						"total_epochs":  progress.TotalEpochs,
-					})
-					progress.mu.RUnlock()
-				}
+		// PROGRESS lines, then the model's own patterns and the output of known frameworks
+		for _, output := range progress.ParseOutput(line) {
+			if output.Metrics == nil {
+				t.addProgressLine(trainingID, progress, output.Progress)
 				continue
 			}
-		}
+			println("📊 [METRICS] Parsed by", output.Parser+":", fmt.Sprintf("Epoch %d/%d, Loss: %.4f, Acc: %.2f%%",
+				output.Metrics.Epoch, output.Metrics.TotalEpochs, output.Metrics.TrainLoss, output.Metrics.TrainAccuracy*100))
 
-		// Try to parse metrics from the line using regex patterns
-		if metrics := t.parseMetrics(line); metrics != nil {
-			println("📊 [METRICS] Parsed:", fmt.Sprintf("Epoch %d/%d, Loss: %.4f, Acc: %.2f%%",
-				metrics.Epoch, metrics.TotalEpochs, metrics.TrainLoss, metrics.TrainAccuracy*100))
+			t.addMetrics(trainingID, progress, output.Metrics)
+		}
+	}
 
-			progress.mu.Lock()
-			progress.Metrics = append(progress.Metrics, *metrics)
-			progress.CurrentEpoch = metrics.Epoch
-			if metrics.TotalEpochs > progress.TotalEpochs {
-				progress.TotalEpochs = metrics.TotalEpochs
-			}
-			progress.mu.Unlock()
+	println("📡 [OUTPUT]", streamType, "reader finished. Total lines:", lineCount)
+}
 
-			// Broadcast metrics update
-			if broadcastCallback != nil {
-				broadcastCallback(trainingID, "metrics", metrics)
-			}
+// addProgressLine records the metrics and artifacts of a PROGRESS line of a server training, and
+// streams them to its viewers
+func (t *Trainer) addProgressLine(trainingID string, progress *TrainingProgress, jsonStr string) {
+	metrics, artifacts := progress.ParseProgressLine(jsonStr)
+	for _, artifact := range artifacts {
+		progress.AddArtifact(artifact)
+		if broadcastCallback != nil {
+			broadcastCallback(trainingID, "artifact", artifact)
+		}
+	}
+	if metrics == nil {
+		return
+	}
+	println("📊 [METRICS] Parsed from JSON:", fmt.Sprintf("Epoch %d/%d, Loss: %.4f, Train Acc: %.2f%%, Test Acc: %.2f%%",
+		metrics.Epoch, metrics.TotalEpochs, metrics.TrainLoss, metrics.TrainAccuracy*100, metrics.TestAccuracy*100))
 
-			// Broadcast progress update
-			if broadcastCallback != nil {
-				progress.mu.RLock()
-				broadcastCallback(trainingID, "progress", map[string]interface{}{
-					"status":        progress.Status,
-					"current_epoch": progress.CurrentEpoch,
-					"total_epochs":  progress.TotalEpochs,
-				})
-				progress.mu.RUnlock()
-			}
+	progress.mu.Lock()
+	metrics.Resources = progress.latestResourcesLocked()
+	progress.Metrics = append(progress.Metrics, *metrics)
+	if stage := progress.currentStageLocked(); stage != nil {
+		stage.Metrics = append(stage.Metrics, *metrics)
+	}
+	progress.CurrentEpoch = metrics.Epoch
+	if metrics.TotalEpochs > progress.TotalEpochs {
+		progress.TotalEpochs = metrics.TotalEpochs
+	}
+	// Store final metrics if:
+	// 1. Status is "completed"
+	// 2. This is the last epoch
+	// 3. Has any accuracy
+	isCompleted := false
+	if metrics.CustomMetrics != nil {
+		if status, ok := metrics.CustomMetrics["status"].(string); ok && status == "completed" {
+			isCompleted = true
+		}
+	}
+	if isCompleted || metrics.TestAccuracy > 0 || metrics.ValAccuracy > 0 || metrics.TrainAccuracy > 0 ||
+		(metrics.Epoch == metrics.TotalEpochs && metrics.TotalEpochs > 0) {
+		// progress.mu is already held here, so set the field directly
+		progress.FinalMetrics = metrics
+		if isCompleted {
+			println(fmt.Sprintf("📊 [METRICS] Set FinalMetrics (status=completed) with accuracy: Test=%.2f%%, Val=%.2f%%, Train=%.2f%%",
+				metrics.TestAccuracy*100, metrics.ValAccuracy*100, metrics.TrainAccuracy*100))
 		}
 	}
+	progress.updateETALocked(metrics.Epoch)
+	anomalies := progress.detectAnomaliesLocked(*metrics)
+	earlyStop := progress.checkEarlyStopLocked(*metrics)
+	progress.mu.Unlock()
+	recordMetricHistory(trainingID, progress.UserID, *metrics)
+	t.handleAnomalies(trainingID, progress, anomalies)
+	t.handleEarlyStop(trainingID, progress, earlyStop)
+	progress.detectCheckpoints()
 
-	println("📡 [OUTPUT]", streamType, "reader finished. Total lines:", lineCount)
+	// Broadcast metrics update
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "metrics", metrics)
+	}
+
+	// Broadcast progress update
+	if broadcastCallback != nil {
+		progress.mu.RLock()
+		broadcastCallback(trainingID, "progress", progress.progressUpdateLocked())
+		progress.mu.RUnlock()
+	}
 }
 
-// parseProgressJSON parses metrics from a PROGRESS JSON line
-func (t *Trainer) parseProgressJSON(jsonStr string) *TrainingMetrics {
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
-		return nil
+// addMetrics records metrics of a server training that its script did not report in a PROGRESS
+// line, and streams them to its viewers
+func (t *Trainer) addMetrics(trainingID string, progress *TrainingProgress, metrics *TrainingMetrics) {
+	progress.mu.Lock()
+	metrics.Resources = progress.latestResourcesLocked()
+	progress.Metrics = append(progress.Metrics, *metrics)
+	if stage := progress.currentStageLocked(); stage != nil {
+		stage.Metrics = append(stage.Metrics, *metrics)
+	}
+	progress.CurrentEpoch = metrics.Epoch
+	if metrics.TotalEpochs > progress.TotalEpochs {
+		progress.TotalEpochs = metrics.TotalEpochs
+	}
+	progress.updateETALocked(metrics.Epoch)
+	anomalies := progress.detectAnomaliesLocked(*metrics)
+	earlyStop := progress.checkEarlyStopLocked(*metrics)
+	progress.mu.Unlock()
+	recordMetricHistory(trainingID, progress.UserID, *metrics)
+	t.handleAnomalies(trainingID, progress, anomalies)
+	t.handleEarlyStop(trainingID, progress, earlyStop)
+	progress.detectCheckpoints()
+
+	// Broadcast metrics update
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "metrics", metrics)
 	}
 
+	// Broadcast progress update
+	if broadcastCallback != nil {
+		progress.mu.RLock()
+		broadcastCallback(trainingID, "progress", progress.progressUpdateLocked())
+		progress.mu.RUnlock()
+	}
+}
+
+// progressMetricsFromData extracts metrics from a decoded PROGRESS payload.
+// Protocol v2 fields (custom metrics and stage) are only read for v2 runs.
+func progressMetricsFromData(data map[string]interface{}, version int) *TrainingMetrics {
 	metrics := &TrainingMetrics{
 		CustomMetrics: make(map[string]interface{}),
 	}
@@ -575,6 +883,14 @@ func (t *Trainer) parseProgressJSON(jsonStr string) *TrainingMetrics {
 		}
 	}
 
+	// NaN and Infinity losses arrive as strings, see decodeProgressJSON
+	for _, field := range []string{"train_loss", "val_loss", "test_loss", "loss"} {
+		if value, ok := data[field].(string); ok && (value == "NaN" || strings.HasSuffix(value, "Infinity")) {
+			metrics.CustomMetrics[NonFiniteLossKey] = strings.ToLower(value)
+			return metrics
+		}
+	}
+
 	// Extract generic "loss" field if specific loss fields are not present
 	if metrics.TrainLoss == 0 {
 		if loss, ok := data["loss"].(float64); ok {
@@ -591,66 +907,24 @@ func (t *Trainer) parseProgressJSON(jsonStr string) *TrainingMetrics {
 		metrics.CustomMetrics["status"] = status
 	}
 
-	// Only return if we found useful data
-	if metrics.Epoch > 0 || metrics.TrainLoss > 0 || metrics.TrainAccuracy > 0 || metrics.TestAccuracy > 0 || metrics.ValAccuracy > 0 {
-		return metrics
-	}
-
-	return nil
-}
-
-// parseMetrics attempts to extract metrics from a log line
-func (t *Trainer) parseMetrics(line string) *TrainingMetrics {
-	metrics := &TrainingMetrics{
-		CustomMetrics: make(map[string]interface{}),
-	}
-
-	// Pattern: Epoch 1/10, Train Loss: 0.5432
-	epochPattern := regexp.MustCompile(`Epoch\s+(\d+)[/:](\d+)`)
-	if matches := epochPattern.FindStringSubmatch(line); len(matches) == 3 {
-		epoch, _ := strconv.Atoi(matches[1])
-		total, _ := strconv.Atoi(matches[2])
-		metrics.Epoch = epoch
-		metrics.TotalEpochs = total
-	}
-
-	// Pattern: Train Loss: 0.5432 or loss: 0.5432
-	lossPattern := regexp.MustCompile(`(?i)(train\s*)?loss[:\s]+([0-9.]+)`)
-	if matches := lossPattern.FindStringSubmatch(line); len(matches) == 3 {
-		loss, _ := strconv.ParseFloat(matches[2], 64)
-		metrics.TrainLoss = loss
-	}
-
-	// Pattern: Val Loss: 0.4321 or validation loss: 0.4321
-	valLossPattern := regexp.MustCompile(`(?i)(val|validation)\s*loss[:\s]+([0-9.]+)`)
-	if matches := valLossPattern.FindStringSubmatch(line); len(matches) == 3 {
-		valLoss, _ := strconv.ParseFloat(matches[2], 64)
-		metrics.ValLoss = valLoss
-	}
-
-	// Pattern: Accuracy: 0.95 or Train Accuracy: 95%
-	accPattern := regexp.MustCompile(`(?i)(train\s*)?acc(?:uracy)?[:\s]+([0-9.]+)%?`)
-	if matches := accPattern.FindStringSubmatch(line); len(matches) == 3 {
-		acc, _ := strconv.ParseFloat(matches[2], 64)
-		// Convert to 0-1 range if it's a percentage
-		if acc > 1 {
-			acc = acc / 100
+	hasCustom := false
+	if version >= ProgressProtocolV2 {
+		if custom, ok := data["metrics"].(map[string]interface{}); ok {
+			for name, value := range custom {
+				if v, ok := value.(float64); ok {
+					metrics.CustomMetrics[name] = v
+					hasCustom = true
+				}
+			}
 		}
-		metrics.TrainAccuracy = acc
-	}
-
-	// Pattern: Val Accuracy: 0.93
-	valAccPattern := regexp.MustCompile(`(?i)(val|validation)\s*acc(?:uracy)?[:\s]+([0-9.]+)%?`)
-	if matches := valAccPattern.FindStringSubmatch(line); len(matches) == 3 {
-		valAcc, _ := strconv.ParseFloat(matches[2], 64)
-		if valAcc > 1 {
-			valAcc = valAcc / 100
+		if stage, ok := data["stage"].(string); ok && stage != "" {
+			metrics.CustomMetrics["stage"] = stage
+			hasCustom = true
 		}
-		metrics.ValAccuracy = valAcc
 	}
 
-	// Only return metrics if we found something useful
-	if metrics.Epoch > 0 || metrics.TrainLoss > 0 || metrics.TrainAccuracy > 0 {
+	// Only return if we found useful data
+	if metrics.Epoch > 0 || metrics.TrainLoss > 0 || metrics.TrainAccuracy > 0 || metrics.TestAccuracy > 0 || metrics.ValAccuracy > 0 || hasCustom {
 		return metrics
 	}
 
@@ -663,6 +937,7 @@ func (t *Trainer) setError(progress *TrainingProgress, trainingID string, err er
 	defer progress.mu.Unlock()
 	progress.Status = StatusFailed
 	progress.ErrorMessage = err.Error()
+	progress.clearETALocked()
 	endTime := time.Now()
 	progress.EndTime = &endTime
 
@@ -716,6 +991,38 @@ func (t *Trainer) GetTrainingsByUserID(userID int) map[string]*TrainingProgress
 	return result
 }
 
+// ProgressSnapshot is a consistent copy of the live state of a training
+type ProgressSnapshot struct {
+	Status       TrainingStatus
+	CurrentEpoch int
+	TotalEpochs  int
+	StartTime    time.Time
+	CurrentStage string
+	Preemptions  int
+	// Latest is the most recent metrics line, nil until the script reports one
+	Latest *TrainingMetrics
+}
+
+// Snapshot returns the current state of a training without holding its lock
+func (tp *TrainingProgress) Snapshot() ProgressSnapshot {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	snapshot := ProgressSnapshot{
+		Status:       tp.Status,
+		CurrentEpoch: tp.CurrentEpoch,
+		TotalEpochs:  tp.TotalEpochs,
+		StartTime:    tp.StartTime,
+		CurrentStage: tp.CurrentStage,
+		Preemptions:  len(tp.Preemptions),
+	}
+	if n := len(tp.Metrics); n > 0 {
+		latest := tp.Metrics[n-1]
+		snapshot.Latest = &latest
+	}
+	return snapshot
+}
+
 // CleanupOldTrainings removes completed training jobs older than the specified duration
 func (t *Trainer) CleanupOldTrainings(olderThan time.Duration) {
 	t.mu.Lock()
@@ -725,6 +1032,7 @@ func (t *Trainer) CleanupOldTrainings(olderThan time.Duration) {
 	for id, progress := range t.activeTraining {
 		if progress.EndTime != nil && now.Sub(*progress.EndTime) > olderThan {
 			delete(t.activeTraining, id)
+			progress.removeLogFile()
 		}
 	}
 }
@@ -735,10 +1043,11 @@ func (t *Trainer) ClearModelTrainings(modelName string) int {
 	defer t.mu.Unlock()
 
 	count := 0
-	for id := range t.activeTraining {
+	for id, progress := range t.activeTraining {
 		// Training IDs are formatted as "{modelName}_{timestamp}"
 		if strings.HasPrefix(id, modelName+"_") {
 			delete(t.activeTraining, id)
+			progress.removeLogFile()
 			count++
 		}
 	}
@@ -953,18 +1262,33 @@ func toLower(c byte) byte {
 func (tp *TrainingProgress) AddLog(log string) {
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
-	tp.Logs = append(tp.Logs, log)
+	tp.appendLogLocked(log)
 }
 
 // AddMetrics adds training metrics and updates current epoch
 func (tp *TrainingProgress) AddMetrics(metrics TrainingMetrics) {
 	tp.mu.Lock()
-	defer tp.mu.Unlock()
+	if metrics.Resources == nil {
+		metrics.Resources = tp.latestResourcesLocked()
+	}
 	tp.Metrics = append(tp.Metrics, metrics)
 	tp.CurrentEpoch = metrics.Epoch
 	if metrics.TotalEpochs > tp.TotalEpochs {
 		tp.TotalEpochs = metrics.TotalEpochs
 	}
+	tp.updateETALocked(metrics.Epoch)
+	anomalies := tp.detectAnomaliesLocked(metrics)
+	earlyStop := tp.checkEarlyStopLocked(metrics)
+	trainingID, userID := tp.TrainingID, tp.UserID
+	update := tp.progressUpdateLocked()
+	tp.mu.Unlock()
+
+	recordMetricHistory(trainingID, userID, metrics)
+	if broadcastCallback != nil {
+		broadcastCallback(trainingID, "progress", update)
+	}
+	reportAnomalies(trainingID, userID, anomalies)
+	reportEarlyStop(trainingID, userID, earlyStop)
 }
 
 // MarkCompleted marks the training as completed
@@ -972,6 +1296,7 @@ func (tp *TrainingProgress) MarkCompleted() {
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
 	tp.Status = StatusCompleted
+	tp.clearETALocked()
 	now := time.Now()
 	tp.EndTime = &now
 }
@@ -982,6 +1307,7 @@ func (tp *TrainingProgress) MarkFailed(errorMsg string) {
 	defer tp.mu.Unlock()
 	tp.Status = StatusFailed
 	tp.ErrorMessage = errorMsg
+	tp.clearETALocked()
 	now := time.Now()
 	tp.EndTime = &now
 }
@@ -993,6 +1319,20 @@ func (tp *TrainingProgress) SetModelPath(modelPath string) {
 	tp.ModelPath = modelPath
 }
 
+// AddCheckpoint records a checkpoint registered by the training script
+func (tp *TrainingProgress) AddCheckpoint(checkpoint CheckpointInfo) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.Checkpoints = append(tp.Checkpoints, checkpoint)
+}
+
+// AddArtifact records an artifact declared by the training script
+func (tp *TrainingProgress) AddArtifact(artifact ArtifactInfo) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.Artifacts = append(tp.Artifacts, artifact)
+}
+
 // SetFinalMetrics sets the final training metrics
 func (tp *TrainingProgress) SetFinalMetrics(metrics *TrainingMetrics) {
 	tp.mu.Lock()
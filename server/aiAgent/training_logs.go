@@ -0,0 +1,223 @@
+package aiAgent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Training log environment variables.
+// TRAINING_LOG_MEMORY_LINES is how many of the latest log lines of a training are kept in memory (2000 by default).
+// TRAINING_LOG_DIR is where the older lines are written (a folder in the system's temporary directory by default).
+const (
+	TrainingLogMemoryLinesEnv = "TRAINING_LOG_MEMORY_LINES"
+	TrainingLogDirEnv         = "TRAINING_LOG_DIR"
+)
+
+const defaultLogMemoryLines = 2000
+
+// logIndexInterval is how many lines apart the index of a log file records their offsets
+const logIndexInterval = 1000
+
+// logMemoryLines returns how many log lines of a training are kept in memory
+func logMemoryLines() int {
+	if n, err := strconv.Atoi(os.Getenv(TrainingLogMemoryLinesEnv)); err == nil && n >= 100 {
+		return n
+	}
+	return defaultLogMemoryLines
+}
+
+// logDir returns the folder the log lines that no longer fit in memory are written to
+func logDir() string {
+	if dir := strings.TrimSpace(os.Getenv(TrainingLogDirEnv)); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "aimanage-training-logs")
+}
+
+// logFile holds the oldest log lines of a training, which were moved out of memory
+type logFile struct {
+	path  string
+	lines int
+	size  int64
+	// index[i] is the offset of line i*logIndexInterval
+	index []int64
+	// failed is set once writing failed; the lines moved out of memory since are lost
+	failed bool
+}
+
+// appendLogLocked adds a log line to the training. Once more lines than the memory limit are
+// kept, the oldest quarter of them is moved to the training's log file. The caller must hold tp.mu.
+func (tp *TrainingProgress) appendLogLocked(line string) {
+	tp.Logs = append(tp.Logs, line)
+	if tp.logLimit == 0 {
+		tp.logLimit = logMemoryLines()
+	}
+	if len(tp.Logs) <= tp.logLimit {
+		return
+	}
+
+	// Move lines in batches rather than one by one
+	n := len(tp.Logs) - tp.logLimit + tp.logLimit/4
+	if err := tp.writeLogFileLocked(tp.Logs[:n]); err != nil {
+		log.Printf("⚠️  Failed to write the log of training %s to disk, dropping %d lines: %v", tp.TrainingID, n, err)
+	}
+	tp.Logs = append([]string(nil), tp.Logs[n:]...)
+	tp.LogOffset += n
+}
+
+// writeLogFileLocked appends lines to the training's log file, creating it first. The caller must hold tp.mu.
+func (tp *TrainingProgress) writeLogFileLocked(lines []string) error {
+	if tp.logFile == nil {
+		dir := logDir()
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			tp.logFile = &logFile{failed: true}
+			return fmt.Errorf("failed to create log folder: %w", err)
+		}
+		name := strings.NewReplacer("/", "_", "\\", "_").Replace(tp.TrainingID)
+		f, err := os.CreateTemp(dir, name+"-*.log")
+		if err != nil {
+			tp.logFile = &logFile{failed: true}
+			return fmt.Errorf("failed to create log file: %w", err)
+		}
+		f.Close()
+		tp.logFile = &logFile{path: f.Name()}
+	}
+	lf := tp.logFile
+	if lf.failed {
+		// Line numbers would no longer match the file
+		return fmt.Errorf("the log file is incomplete")
+	}
+
+	f, err := os.OpenFile(lf.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		lf.failed = true
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	size, index, count := lf.size, lf.index, lf.lines
+	for _, line := range lines {
+		if count%logIndexInterval == 0 {
+			index = append(index, size)
+		}
+		n, _ := w.WriteString(strings.ReplaceAll(line, "\n", " ") + "\n")
+		size += int64(n)
+		count++
+	}
+	if err := w.Flush(); err != nil {
+		lf.failed = true
+		return fmt.Errorf("failed to write log file: %w", err)
+	}
+	lf.size, lf.index, lf.lines = size, index, count
+	return nil
+}
+
+// LogLines returns how many log lines the training has, in memory and on disk
+func (tp *TrainingProgress) LogLines() int {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.LogOffset + len(tp.Logs)
+}
+
+// ReadLogs returns up to limit log lines of the training starting at line since (0 is the first),
+// reading the lines no longer kept in memory from disk, and the number of lines the training has
+func (tp *TrainingProgress) ReadLogs(since, limit int) ([]string, int, error) {
+	tp.mu.RLock()
+	offset := tp.LogOffset
+	total := offset + len(tp.Logs)
+	if since < 0 {
+		since = 0
+	}
+	end := total
+	if limit >= 0 && since+limit < end {
+		end = since + limit
+	}
+	if since >= end {
+		tp.mu.RUnlock()
+		return []string{}, total, nil
+	}
+
+	var memory []string
+	if end > offset {
+		from := since - offset
+		if from < 0 {
+			from = 0
+		}
+		memory = append(memory, tp.Logs[from:end-offset]...)
+	}
+	var lf logFile
+	if tp.logFile != nil {
+		lf = *tp.logFile
+		lf.index = append([]int64(nil), tp.logFile.index...)
+	}
+	tp.mu.RUnlock()
+
+	lines := make([]string, 0, end-since)
+	if since < offset {
+		// The file only grows, so the lines before offset stay where they are
+		count := offset - since
+		if end < offset {
+			count = end - since
+		}
+		fromFile, err := lf.read(since, count)
+		if err != nil {
+			return nil, total, err
+		}
+		lines = append(lines, fromFile...)
+	}
+	return append(lines, memory...), total, nil
+}
+
+// read returns count lines of the log file starting at line from
+func (lf logFile) read(from, count int) ([]string, error) {
+	if lf.failed || from >= lf.lines {
+		return nil, fmt.Errorf("log lines %d to %d are no longer available", from, from+count)
+	}
+	f, err := os.Open(lf.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+
+	block := from / logIndexInterval
+	if _, err := f.Seek(lf.index[block], io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read log file: %w", err)
+	}
+	reader := bufio.NewReader(f)
+	lines := make([]string, 0, count)
+	for i := block * logIndexInterval; i < from+count && i < lf.lines; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log file: %w", err)
+		}
+		if i >= from {
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+	}
+	return lines, nil
+}
+
+// removeLogFile deletes the training's log file once the training is forgotten
+func (tp *TrainingProgress) removeLogFile() {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.logFile != nil && tp.logFile.path != "" {
+		os.Remove(tp.logFile.path)
+	}
+	tp.logFile = nil
+}
+
+// trimLogs keeps the last limit lines of logs
+func trimLogs(logs []string, limit int) []string {
+	if limit <= 0 || len(logs) <= limit+limit/4 {
+		return logs
+	}
+	return append([]string(nil), logs[len(logs)-limit:]...)
+}
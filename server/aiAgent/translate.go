@@ -0,0 +1,54 @@
+package aiAgent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ListingText is the translatable text of a marketplace listing
+type ListingText struct {
+	Description      string `json:"description"`
+	ShortDescription string `json:"short_description"`
+}
+
+// TranslateListing translates a listing's text from sourceLocale to targetLocale (BCP 47 tags)
+func (c *GeminiClient) TranslateListing(text ListingText, sourceLocale, targetLocale string) (*ListingText, error) {
+	source, err := json.Marshal(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal listing text: %w", err)
+	}
+
+	prompt := fmt.Sprintf(`Translate the text of this machine learning model marketplace listing from the language with BCP 47 tag %q to the language with BCP 47 tag %q.
+Keep Markdown formatting, code, model names, framework names and metric names unchanged.
+Reply with only a JSON object with the same keys ("description" and "short_description"), leaving empty values empty.
+
+%s`, sourceLocale, targetLocale, source)
+
+	response, err := c.SendPrompt(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate with Gemini: %w", err)
+	}
+
+	var translated ListingText
+	if err := json.Unmarshal([]byte(stripCodeFence(response)), &translated); err != nil {
+		return nil, fmt.Errorf("failed to parse translation: %w", err)
+	}
+	if translated.Description == "" {
+		return nil, fmt.Errorf("translation has no description")
+	}
+	return &translated, nil
+}
+
+// stripCodeFence removes the Markdown code fence Gemini often wraps JSON replies in
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if newline := strings.Index(s, "\n"); newline >= 0 {
+		s = s[newline+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
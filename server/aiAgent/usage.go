@@ -0,0 +1,109 @@
+package aiAgent
+
+import (
+	"sync"
+	"time"
+)
+
+// Hardware tiers server trainings are priced by.
+// GPU trainings hold a whole device, MIG trainings a partition of one and CPU trainings run
+// on a server without GPUs.
+const (
+	HardwareTierCPU = "cpu"
+	HardwareTierMIG = "mig"
+	HardwareTierGPU = "gpu"
+)
+
+// HardwareTiers lists the hardware tiers from the cheapest to the most expensive
+var HardwareTiers = []string{HardwareTierCPU, HardwareTierMIG, HardwareTierGPU}
+
+// ValidHardwareTier reports whether tier is a hardware tier
+func ValidHardwareTier(tier string) bool {
+	for _, t := range HardwareTiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// hardwareTier returns the tier of a GPU allocation, cpu when the training had no GPU
+func hardwareTier(gpu *GPUAllocation) string {
+	switch {
+	case gpu == nil:
+		return HardwareTierCPU
+	case gpu.Device.MIG:
+		return HardwareTierMIG
+	default:
+		return HardwareTierGPU
+	}
+}
+
+// ExpectedHardwareTier returns the tier a training started now runs on
+func (t *Trainer) ExpectedHardwareTier() string {
+	for _, device := range t.gpus.Status() {
+		if device.MIG {
+			return HardwareTierMIG
+		}
+		return HardwareTierGPU
+	}
+	return HardwareTierCPU
+}
+
+// TrainingUsage is the compute a server training used, reported once it ends
+type TrainingUsage struct {
+	TrainingID    string
+	UserID        int
+	ExecutionMode string
+	HardwareTier  string
+	Status        TrainingStatus
+	// RunTime is the time the training held a slot, without the time it waited after evictions
+	RunTime time.Duration
+}
+
+// UsageCallback is told about the usage of every server training that ended, e.g. to charge its
+// credits. HardwareTier is empty for trainings that never ran.
+type UsageCallback func(usage TrainingUsage)
+
+var usageCallback UsageCallback
+
+// usageReports tracks the usage callbacks that are running, which Shutdown waits for
+var usageReports sync.WaitGroup
+
+// SetUsageCallback sets the function called with the usage of each finished server training
+func SetUsageCallback(callback UsageCallback) {
+	usageCallback = callback
+}
+
+// addRunTime adds the running time of an attempt on gpu to the training
+func (tp *TrainingProgress) addRunTime(d time.Duration, gpu *GPUAllocation) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.runTime += d
+	tp.RunSeconds = int(tp.runTime.Seconds())
+	tp.HardwareTier = hardwareTier(gpu)
+}
+
+// reportUsage hands the usage of a training that will not be resumed to the usage callback
+func reportUsage(trainingID string, progress *TrainingProgress) {
+	if usageCallback == nil {
+		return
+	}
+	progress.mu.RLock()
+	usage := TrainingUsage{
+		TrainingID:    trainingID,
+		UserID:        progress.UserID,
+		ExecutionMode: progress.ExecutionMode,
+		HardwareTier:  progress.HardwareTier,
+		Status:        progress.Status,
+		RunTime:       progress.runTime,
+	}
+	progress.mu.RUnlock()
+	// Trainings that never got a slot, e.g. stopped while queued, are reported with no hardware
+	// tier so that the credits reserved for them are refunded
+	usageReports.Add(1)
+	go func() {
+		defer usageReports.Done()
+		usageCallback(usage)
+	}()
+}
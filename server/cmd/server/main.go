@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"server/aiAgent"
 	"server/internal/models"
 	"server/internal/service"
 
@@ -18,7 +25,11 @@ func main() {
 		log.Println("✅ Loaded environment variables from .env file")
 	}
 
-	// Connect to PostgreSQL with retry
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	// Connect to PostgreSQL with retry and apply pending migrations
 	if err := models.ConnectWithRetry(); err != nil {
 		log.Fatal("Failed to connect to PostgreSQL after multiple attempts:", err)
 	}
@@ -30,7 +41,30 @@ func main() {
 	log.Println("✅ PostgreSQL connection verified!")
 
 	router := service.NewRouter()
+	server := &http.Server{Addr: ":8081", Handler: router}
+
+	// Close WebSocket clients and drain requests on SIGINT or SIGTERM
+	go func() {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+
+		log.Println("🛑 Shutting down...")
+		// Scripts get their grace period to save a checkpoint before the trainings are recorded as interrupted
+		trainingCtx, cancelTrainings := context.WithTimeout(context.Background(), aiAgent.ShutdownTimeout())
+		service.StopTrainings(trainingCtx)
+		cancelTrainings()
+		service.CloseWebSockets()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("⚠️  Shutdown did not complete: %v", err)
+		}
+	}()
+
 	log.Println("Server running on port localhost:8081")
-	log.Fatal(http.ListenAndServe(":8081", router))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
 }
 
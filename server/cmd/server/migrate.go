@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"server/internal/models"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+  up           apply every pending migration
+  down [n]     revert the last n migrations (default 1)
+  version      print the migration version of the database
+  force <v>    record version v as applied without running anything`
+
+// runMigrate runs `server migrate <command>` and returns the exit code. It connects without
+// ConnectWithRetry so migrations only run when asked for.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err := models.Connect(); err != nil {
+		log.Printf("❌ Failed to connect to PostgreSQL: %v", err)
+		return 1
+	}
+	defer models.Pool.Close()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := models.Migrate(ctx)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			return 1
+		}
+		log.Printf("✅ Applied %d migrations", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "down takes a positive number of migrations")
+				return 2
+			}
+			steps = n
+		}
+		reverted, err := models.MigrateDown(ctx, steps)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			return 1
+		}
+		log.Printf("✅ Reverted %d migrations", reverted)
+	case "version":
+		version, dirty, err := models.MigrationVersion(ctx)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			return 1
+		}
+		if dirty {
+			fmt.Printf("%d (dirty)\n", version)
+		} else {
+			fmt.Println(version)
+		}
+	case "force":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "force takes the version to record")
+			return 2
+		}
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "force takes the version to record")
+			return 2
+		}
+		if err := models.ForceMigrationVersion(ctx, version); err != nil {
+			log.Printf("❌ %v", err)
+			return 1
+		}
+		log.Printf("✅ Database marked as version %d", version)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Apple's identity token issuer and signing keys
+const (
+	AppleIssuer  = "https://appleid.apple.com"
+	appleKeysURL = AppleIssuer + "/auth/keys"
+)
+
+const (
+	appleKeysMaxAge       = 24 * time.Hour
+	appleKeysMinRefresh   = time.Minute // Unknown key IDs refetch the keys at most this often
+	appleKeysFetchTimeout = 10 * time.Second
+)
+
+// AppleIDClaims are the claims of a verified Apple identity token. Subject is the user's stable
+// Apple ID; Email is a private relay address when the user chose to hide their email.
+type AppleIDClaims struct {
+	Email          string      `json:"email"`
+	EmailVerified  interface{} `json:"email_verified"`   // Apple sends "true" or true
+	IsPrivateEmail interface{} `json:"is_private_email"` // Same
+	Nonce          string      `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// HasVerifiedEmail reports whether Apple verified the token's email
+func (c *AppleIDClaims) HasVerifiedEmail() bool {
+	return c.Email != "" && (c.EmailVerified == true || c.EmailVerified == "true")
+}
+
+// appleKeys caches Apple's public signing keys by key ID
+var appleKeys struct {
+	sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// fetchAppleKeys downloads Apple's JSON Web Key Set
+func fetchAppleKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, appleKeysFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, appleKeysURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Apple keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch Apple keys: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode Apple keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("Apple returned no RSA keys")
+	}
+	return keys, nil
+}
+
+// appleKey returns Apple's public key with an ID, refetching the keys when they are old or the
+// ID is unknown, as happens after Apple rotates them
+func appleKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	appleKeys.Lock()
+	defer appleKeys.Unlock()
+
+	key, ok := appleKeys.keys[kid]
+	age := time.Since(appleKeys.fetchedAt)
+	if ok && age < appleKeysMaxAge {
+		return key, nil
+	}
+	if !ok && age < appleKeysMinRefresh {
+		return nil, fmt.Errorf("unknown Apple key %q", kid)
+	}
+
+	keys, err := fetchAppleKeys(ctx)
+	if err != nil {
+		if ok {
+			// Keep using a known key while Apple cannot be reached
+			return key, nil
+		}
+		return nil, err
+	}
+	appleKeys.keys, appleKeys.fetchedAt = keys, time.Now()
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown Apple key %q", kid)
+	}
+	return key, nil
+}
+
+// VerifyAppleIDToken checks that an Apple identity token is signed by Apple, issued for clientID
+// and not expired, and returns its claims. A non-empty nonce must match the token's.
+func VerifyAppleIDToken(ctx context.Context, idToken, clientID, nonce string) (*AppleIDClaims, error) {
+	if clientID == "" {
+		return nil, errors.New("APPLE_CLIENT_ID is not set")
+	}
+	claims := &AppleIDClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return appleKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(AppleIssuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	if nonce != "" && claims.Nonce != nonce {
+		return nil, errors.New("token nonce does not match")
+	}
+	return claims, nil
+}
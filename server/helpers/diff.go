@@ -0,0 +1,201 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is how many unchanged lines surround each change in a unified diff
+const diffContextLines = 3
+
+// maxDiffEdits bounds the work of a diff; texts further apart are reported as fully replaced
+const maxDiffEdits = 2000
+
+// diffLine is a line of a diff: ' ' kept, '-' removed from the old text, '+' added in the new one
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// UnifiedDiff returns the differences between two texts in unified diff format, or "" when they
+// are equal. fromName and toName label the texts in the header.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	// Line numbers in the old and new text where each diff line falls
+	oldLine, newLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	oldLine[0], newLine[0] = 1, 1
+	for i, line := range lines {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if line.op != '+' {
+			oldLine[i+1]++
+		}
+		if line.op != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		// A hunk spans changes separated by fewer than two contexts of kept lines
+		start := max(0, i-diffContextLines)
+		end := i
+		for kept := 0; end < len(lines) && kept <= 2*diffContextLines; end++ {
+			if lines[end].op == ' ' {
+				kept++
+			} else {
+				kept = 0
+			}
+		}
+		// Trim trailing kept lines to one context
+		for end > i && lines[end-1].op == ' ' {
+			end--
+		}
+		end = min(len(lines), end+diffContextLines)
+
+		oldCount, newCount := oldLine[end]-oldLine[start], newLine[end]-newLine[start]
+		oldStart, newStart := oldLine[start], newLine[start]
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, line := range lines[start:end] {
+			out.WriteByte(line.op)
+			out.WriteString(line.text)
+			out.WriteByte('\n')
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// splitLines splits a text into lines without their line breaks
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script turning a into b with Myers' algorithm
+func diffLines(a, b []string) []diffLine {
+	// Common prefix and suffix are kept as they are
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, text := range a[:prefix] {
+		lines = append(lines, diffLine{' ', text})
+	}
+	lines = append(lines, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', text})
+	}
+	return lines
+}
+
+// myersDiff diffs two texts without a common prefix or suffix
+func myersDiff(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	replaced := func() []diffLine {
+		lines := make([]diffLine, 0, n+m)
+		for _, text := range a {
+			lines = append(lines, diffLine{'-', text})
+		}
+		for _, text := range b {
+			lines = append(lines, diffLine{'+', text})
+		}
+		return lines
+	}
+	if n == 0 || m == 0 {
+		return replaced()
+	}
+
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds v[-d-1..d+1] as it was before step d, to walk the edits back
+	trace := [][]int{}
+	edits := -1
+	for d := 0; d <= limit && edits < 0; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				edits = d
+				break
+			}
+		}
+	}
+	if edits < 0 {
+		return replaced()
+	}
+
+	reversed := make([]diffLine, 0, n+m)
+	x, y := n, m
+	for d := edits; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, diffLine{'+', b[y-1]})
+			y--
+		} else {
+			reversed = append(reversed, diffLine{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, diffLine{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	lines := make([]diffLine, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines
+}
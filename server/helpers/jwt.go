@@ -18,13 +18,22 @@ var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 type Claims struct {
 	Email  string `json:"email"`
 	UserID string `json:"userID"`
+	// SessionID is the family ID of the sign-in session the token was issued for. Revoking the
+	// session rejects the token before it expires. Empty for tokens not tied to a session.
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
 func GenerateJWT(email string, userID int) (string, error) {
+	return GenerateSessionJWT(email, userID, "")
+}
+
+// GenerateSessionJWT generates a JWT for a sign-in session, identified by its family ID
+func GenerateSessionJWT(email string, userID int, sessionID string) (string, error) {
 	claims := Claims{
-		Email:  email,
-		UserID: strconv.Itoa(userID),
+		Email:     email,
+		UserID:    strconv.Itoa(userID),
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // valid for 24h
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
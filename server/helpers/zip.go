@@ -2,19 +2,154 @@ package helpers
 
 import (
 	"archive/zip"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
+// Limits applied by Unzip
+const (
+	DefaultMaxUnzipBytes = 10 << 30 // 10 GB uncompressed
+	DefaultMaxUnzipFiles = 100000
+)
+
+// UnzipLimits bounds what an archive may extract to, against zip bombs
+type UnzipLimits struct {
+	// MaxBytes is the total uncompressed size of the files
+	MaxBytes int64
+	// MaxFiles is the number of entries, folders included
+	MaxFiles int
+}
+
+// DefaultUnzipLimits returns the limits Unzip uses
+func DefaultUnzipLimits() UnzipLimits {
+	return UnzipLimits{MaxBytes: DefaultMaxUnzipBytes, MaxFiles: DefaultMaxUnzipFiles}
+}
+
+// ZipIssue is an entry of an archive, or the archive as a whole, that cannot be extracted safely
+type ZipIssue struct {
+	Entry   string `json:"entry,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// ZipReport is the outcome of the validation of an archive
+type ZipReport struct {
+	Files             int        `json:"files"`
+	UncompressedBytes int64      `json:"uncompressed_bytes"`
+	Issues            []ZipIssue `json:"issues"`
+}
+
+// Valid reports whether the archive can be extracted
+func (r *ZipReport) Valid() bool {
+	return len(r.Issues) == 0
+}
+
+// maxReportedIssues bounds the issues listed for archives with many bad entries
+const maxReportedIssues = 50
+
+func (r *ZipReport) add(entry, problem string) {
+	if len(r.Issues) < maxReportedIssues {
+		r.Issues = append(r.Issues, ZipIssue{Entry: entry, Problem: problem})
+	}
+}
+
+// UnsafeZipError is returned by UnzipWithLimits for archives that fail validation
+type UnsafeZipError struct {
+	Report *ZipReport
+}
+
+func (e *UnsafeZipError) Error() string {
+	if len(e.Report.Issues) == 0 {
+		return "unsafe zip"
+	}
+	first := e.Report.Issues[0]
+	if first.Entry == "" {
+		return "unsafe zip: " + first.Problem
+	}
+	return fmt.Sprintf("unsafe zip: %s: %s", first.Entry, first.Problem)
+}
+
+// errLimitExceeded is returned when an entry inflates to more than its header declared
+var errLimitExceeded = errors.New("entry is larger than its declared size")
+
+// ValidateZip checks an archive without extracting it: entries must stay inside the folder they
+// are extracted to, be regular files or folders, and stay within limits by their declared sizes
+func ValidateZip(src string, limits UnzipLimits) (*ZipReport, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return validateZip(&r.Reader, limits), nil
+}
+
+func validateZip(r *zip.Reader, limits UnzipLimits) *ZipReport {
+	report := &ZipReport{Issues: []ZipIssue{}}
+	for _, f := range r.File {
+		name := filepath.ToSlash(f.Name)
+		clean := path.Clean(name)
+		switch {
+		case name == "":
+			report.add(f.Name, "empty name")
+		case path.IsAbs(name) || filepath.IsAbs(f.Name) || filepath.VolumeName(f.Name) != "":
+			report.add(f.Name, "absolute path")
+		case clean == ".." || strings.HasPrefix(clean, "../"):
+			report.add(f.Name, "path escapes the extraction folder")
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode&fs.ModeSymlink != 0:
+			report.add(f.Name, "symbolic link")
+		case !mode.IsRegular() && !mode.IsDir():
+			report.add(f.Name, "not a regular file or folder")
+		}
+
+		report.Files++
+		if !mode.IsDir() {
+			report.UncompressedBytes += int64(f.UncompressedSize64)
+		}
+	}
+
+	if limits.MaxFiles > 0 && report.Files > limits.MaxFiles {
+		report.add("", fmt.Sprintf("%d entries, more than the limit of %d", report.Files, limits.MaxFiles))
+	}
+	if limits.MaxBytes > 0 && report.UncompressedBytes > limits.MaxBytes {
+		report.add("", fmt.Sprintf("%d bytes uncompressed, more than the limit of %d", report.UncompressedBytes, limits.MaxBytes))
+	}
+	return report
+}
+
+// Unzip extracts an archive into dest with the default limits. If every entry is under a common
+// root folder, the folder is stripped.
 func Unzip(src, dest string) error {
+	return UnzipWithLimits(src, dest, DefaultUnzipLimits())
+}
+
+// UnzipWithLimits extracts an archive into dest like Unzip. Archives failing ValidateZip are not
+// extracted and return an *UnsafeZipError with the report. Sizes are enforced while inflating
+// too, as entry headers can understate them.
+func UnzipWithLimits(src, dest string, limits UnzipLimits) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
 
+	if report := validateZip(&r.Reader, limits); !report.Valid() {
+		return &UnsafeZipError{Report: report}
+	}
+
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
 	// Detect if all files are under a common root directory
 	var rootDir string
 	if len(r.File) > 0 {
@@ -35,21 +170,27 @@ func Unzip(src, dest string) error {
 		}
 	}
 
+	var written int64
 	for _, f := range r.File {
 		// Strip the root directory if detected
-		extractPath := f.Name
+		extractPath := filepath.ToSlash(f.Name)
 		if rootDir != "" {
-			extractPath = strings.TrimPrefix(filepath.ToSlash(f.Name), rootDir)
+			extractPath = strings.TrimPrefix(extractPath, rootDir)
 			// Skip if it's the root directory itself
 			if extractPath == "" {
 				continue
 			}
 		}
 
-		fpath := filepath.Join(dest, extractPath)
+		fpath := filepath.Join(absDest, filepath.FromSlash(extractPath))
+		if fpath != absDest && !strings.HasPrefix(fpath, absDest+string(os.PathSeparator)) {
+			return &UnsafeZipError{Report: &ZipReport{Issues: []ZipIssue{{Entry: f.Name, Problem: "path escapes the extraction folder"}}}}
+		}
 
 		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, os.ModePerm)
+			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -57,23 +198,47 @@ func Unzip(src, dest string) error {
 			return err
 		}
 
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return err
+		// Permissions come from the archive, but never setuid, setgid or sticky bits
+		n, err := extractZipFile(f, fpath, f.Mode().Perm())
+		written += n
+		if errors.Is(err, errLimitExceeded) {
+			return &UnsafeZipError{Report: &ZipReport{Issues: []ZipIssue{{Entry: f.Name, Problem: err.Error()}}}}
 		}
-		rc, err := f.Open()
 		if err != nil {
 			return err
 		}
+		if limits.MaxBytes > 0 && written > limits.MaxBytes {
+			return &UnsafeZipError{Report: &ZipReport{Issues: []ZipIssue{{Problem: fmt.Sprintf("more than %d bytes uncompressed", limits.MaxBytes)}}}}
+		}
+	}
+	return nil
+}
 
-		_, err = io.Copy(outFile, rc)
+// extractZipFile writes an entry to fpath, refusing to inflate it past its declared size
+func extractZipFile(f *zip.File, fpath string, perm fs.FileMode) (int64, error) {
+	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, err
+	}
+	defer outFile.Close()
 
-		outFile.Close()
-		rc.Close()
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
 
-		if err != nil {
-			return err
-		}
+	n, err := io.Copy(outFile, io.LimitReader(rc, int64(f.UncompressedSize64)+1))
+	// Once the entry is open, archive/zip only fails reading with ErrFormat when it inflates past
+	// its declared size
+	if errors.Is(err, zip.ErrFormat) {
+		return n, errLimitExceeded
 	}
-	return nil
+	if err != nil {
+		return n, err
+	}
+	if n > int64(f.UncompressedSize64) {
+		return n, errLimitExceeded
+	}
+	return n, outFile.Close()
 }
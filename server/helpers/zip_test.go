@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zipEntry is a file of an archive built by buildZip
+type zipEntry struct {
+	name string
+	body []byte
+	mode fs.FileMode
+}
+
+// buildZip returns a deflated archive of the entries
+func buildZip(t *testing.T, entries []zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			header.SetMode(e.mode)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(e.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeZip saves an archive to a temporary file and returns its path
+func writeZip(t *testing.T, archive []byte) string {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(src, archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func manyEntries(n int) []zipEntry {
+	entries := make([]zipEntry, n)
+	for i := range entries {
+		entries[i] = zipEntry{name: "data/" + strings.Repeat("f", i+1), body: []byte("x")}
+	}
+	return entries
+}
+
+func TestValidateZip(t *testing.T) {
+	limits := UnzipLimits{MaxBytes: 1 << 20, MaxFiles: 10}
+
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		problem string // Part of the first issue, "" for a valid archive
+	}{
+		{name: "valid", entries: []zipEntry{{name: "model/", mode: fs.ModeDir | 0o755}, {name: "model/train.py", body: []byte("print(1)")}}},
+		{name: "parent path", entries: []zipEntry{{name: "../evil.sh", body: []byte("x")}}, problem: "escapes"},
+		{name: "nested parent path", entries: []zipEntry{{name: "model/../../evil.sh", body: []byte("x")}}, problem: "escapes"},
+		{name: "absolute path", entries: []zipEntry{{name: "/etc/cron.d/evil", body: []byte("x")}}, problem: "absolute path"},
+		{name: "symbolic link", entries: []zipEntry{{name: "link", body: []byte("/etc/passwd"), mode: fs.ModeSymlink | 0o777}}, problem: "symbolic link"},
+		{name: "oversized entry", entries: []zipEntry{{name: "big.bin", body: make([]byte, limits.MaxBytes+1)}}, problem: "bytes uncompressed"},
+		{name: "bomb ratio", entries: []zipEntry{{name: "a.bin", body: make([]byte, 600<<10)}, {name: "b.bin", body: make([]byte, 600<<10)}}, problem: "bytes uncompressed"},
+		{name: "too many entries", entries: manyEntries(limits.MaxFiles + 1), problem: "entries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := ValidateZip(writeZip(t, buildZip(t, tt.entries)), limits)
+			if err != nil {
+				t.Fatalf("ValidateZip: %v", err)
+			}
+			if tt.problem == "" {
+				if !report.Valid() {
+					t.Fatalf("valid archive got issues %+v", report.Issues)
+				}
+				return
+			}
+			if report.Valid() {
+				t.Fatalf("archive was accepted, want an issue about %q", tt.problem)
+			}
+			if !strings.Contains(report.Issues[0].Problem, tt.problem) {
+				t.Errorf("issue %q, want one about %q", report.Issues[0].Problem, tt.problem)
+			}
+		})
+	}
+}
+
+func TestUnzipWithLimitsRejectsUnsafeArchives(t *testing.T) {
+	limits := UnzipLimits{MaxBytes: 1 << 20, MaxFiles: 10}
+
+	tests := []struct {
+		name    string
+		entries []zipEntry
+	}{
+		{name: "parent path", entries: []zipEntry{{name: "model/train.py", body: []byte("x")}, {name: "../evil.sh", body: []byte("x")}}},
+		{name: "absolute path", entries: []zipEntry{{name: "/tmp/evil.sh", body: []byte("x")}}},
+		{name: "oversized entry", entries: []zipEntry{{name: "big.bin", body: make([]byte, limits.MaxBytes+1)}}},
+		{name: "too many entries", entries: manyEntries(limits.MaxFiles + 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dest := filepath.Join(dir, "out")
+			err := UnzipWithLimits(writeZip(t, buildZip(t, tt.entries)), dest, limits)
+			var unsafe *UnsafeZipError
+			if !errors.As(err, &unsafe) {
+				t.Fatalf("UnzipWithLimits = %v, want an *UnsafeZipError", err)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Errorf("unsafe archive was extracted to %s", dest)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil.sh")); !os.IsNotExist(err) {
+				t.Error("entry was written outside the extraction folder")
+			}
+		})
+	}
+}
+
+// TestUnzipWithLimitsUnderstatedSize extracts a bomb whose header declares a few bytes for an entry
+// inflating to a megabyte, which validation cannot see
+func TestUnzipWithLimitsUnderstatedSize(t *testing.T) {
+	body := make([]byte, 1<<20)
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(body)
+	fw.Close()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	out, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "bomb.bin",
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(body),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Write(compressed.Bytes())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = UnzipWithLimits(writeZip(t, buf.Bytes()), t.TempDir(), UnzipLimits{MaxBytes: 1 << 10, MaxFiles: 10})
+	var unsafe *UnsafeZipError
+	if !errors.As(err, &unsafe) {
+		t.Fatalf("UnzipWithLimits = %v, want an *UnsafeZipError", err)
+	}
+}
+
+func TestUnzipWithLimitsStripsRootFolder(t *testing.T) {
+	archive := buildZip(t, []zipEntry{
+		{name: "model/", mode: fs.ModeDir | 0o755},
+		{name: "model/train.py", body: []byte("print(1)")},
+		{name: "model/data/labels.txt", body: []byte("cat")},
+	})
+	dest := t.TempDir()
+	if err := UnzipWithLimits(writeZip(t, archive), dest, DefaultUnzipLimits()); err != nil {
+		t.Fatalf("UnzipWithLimits: %v", err)
+	}
+	for _, name := range []string{"train.py", "data/labels.txt"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+			t.Errorf("%s was not extracted: %v", name, err)
+		}
+	}
+}
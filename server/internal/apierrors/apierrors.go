@@ -0,0 +1,132 @@
+// Package apierrors writes the error responses of the API. Every error has the same JSON shape:
+//
+//	{"success": false, "error": {"code": "not_found", "message": "Model not found", "details": {...}, "request_id": "..."}}
+//
+// Clients branch on the code, which never changes, and may show the message to users. Details
+// are optional and specific to the code. The request ID matches the X-Request-ID response header,
+// so users can quote it when reporting a problem.
+package apierrors
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID of a request, set by the RequestID middleware
+const RequestIDHeader = "X-Request-ID"
+
+// Codes of errors named after their HTTP status, used when no more specific code applies
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodePaymentRequired      = "payment_required"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeGone                 = "gone"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeUnprocessable        = "unprocessable_entity"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+	CodeNotImplemented       = "not_implemented"
+	CodeBadGateway           = "bad_gateway"
+	CodeUnavailable          = "service_unavailable"
+	CodeGatewayTimeout       = "gateway_timeout"
+)
+
+// Specific error codes, with the details they carry
+const (
+	CodeSessionRevoked       = "session_revoked"           // The access token's session was signed out
+	CodeAccountSuspended     = "account_suspended"         // The user's account is suspended
+	CodeTermsRequired        = "terms_acceptance_required" // pending_documents
+	CodeWeakPassword         = "weak_password"             // password: the policy evaluation
+	CodeValidationFailed     = "validation_failed"         // fields: the problem of each invalid field
+	CodeUploadRejected       = "upload_rejected"           // validation: the archive's report, when it was validated
+	CodeUploadIncomplete     = "upload_incomplete"         // missing_chunks
+	CodeChecksumMismatch     = "checksum_mismatch"         // sha256: the checksum of what was received
+	CodeInsufficientCredits  = "insufficient_credits"      // credit_estimate, remaining_credits
+	CodeTrainingNotAllowed   = "training_not_allowed"      // approval_required, or hint and placement
+	CodeInsufficientHardware = "insufficient_hardware"     // placement
+	CodeDatasetBroken        = "dataset_broken"            // dataset_warnings, dataset_summary, hint
+)
+
+// codesByStatus maps HTTP statuses to their generic code
+var codesByStatus = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusPaymentRequired:       CodePaymentRequired,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusGone:                  CodeGone,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusNotImplemented:        CodeNotImplemented,
+	http.StatusBadGateway:            CodeBadGateway,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusGatewayTimeout:        CodeGatewayTimeout,
+}
+
+// CodeForStatus returns the generic code of an HTTP status
+func CodeForStatus(status int) string {
+	if code, ok := codesByStatus[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Error is an error returned to API clients with its HTTP status
+type Error struct {
+	Status  int                    `json:"-"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// New creates an error with a code
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// WithDetails returns a copy of the error with details
+func (e *Error) WithDetails(details map[string]interface{}) *Error {
+	withDetails := *e
+	withDetails.Details = details
+	return &withDetails
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Write writes an error response, with the request ID of the RequestID middleware
+func Write(w http.ResponseWriter, err *Error) {
+	body := struct {
+		*Error
+		RequestID string `json:"request_id,omitempty"`
+	}{err, w.Header().Get(RequestIDHeader)}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   body,
+	})
+}
+
+// Respond writes an error response with the generic code of its status. It replaces http.Error.
+func Respond(w http.ResponseWriter, status int, message string) {
+	Write(w, New(status, CodeForStatus(status), message))
+}
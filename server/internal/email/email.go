@@ -2,9 +2,11 @@ package email
 
 import (
 	"fmt"
+	"html"
 	"log"
 	"net/smtp"
 	"os"
+	"strings"
 )
 
 type EmailService struct {
@@ -170,3 +172,238 @@ func (es *EmailService) SendWelcomeEmail(to, username string) error {
 	log.Printf("✅ Welcome email sent to %s", to)
 	return nil
 }
+
+// SendNotificationEmail sends a notification with a link back to the platform
+func (es *EmailService) SendNotificationEmail(to, username, title, text, link string) error {
+	if es.From == "" || es.Password == "" {
+		log.Println("⚠️  SMTP credentials not configured, skipping email send")
+		return fmt.Errorf("SMTP credentials not configured")
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+
+	subject := title + " - AIManage"
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background-color: #4F46E5; color: white; padding: 20px; text-align: center; border-radius: 5px 5px 0 0; }
+        .content { background-color: #f9f9f9; padding: 30px; border-radius: 0 0 5px 5px; }
+        .button { display: inline-block; padding: 12px 30px; background-color: #4F46E5; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+        .footer { text-align: center; margin-top: 20px; color: #666; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>%s</h1>
+        </div>
+        <div class="content">
+            <p>Hi %s,</p>
+            <p>%s</p>
+            <p style="text-align: center;">
+                <a href="%s%s" class="button">View on AIManage</a>
+            </p>
+        </div>
+        <div class="footer">
+            <p>You are receiving this email because you enabled alerts for this item.</p>
+            <p>&copy; 2024 AIManage. All rights reserved.</p>
+        </div>
+    </div>
+</body>
+</html>
+`, html.EscapeString(title), html.EscapeString(username), html.EscapeString(text), baseURL, link)
+
+	// Compose message
+	message := []byte(
+		"From: " + es.From + "\r\n" +
+			"To: " + to + "\r\n" +
+			"Subject: " + subject + "\r\n" +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: text/html; charset=UTF-8\r\n" +
+			"\r\n" +
+			body + "\r\n")
+
+	// Set up authentication
+	auth := smtp.PlainAuth("", es.From, es.Password, es.SMTPHost)
+
+	// Send email
+	addr := es.SMTPHost + ":" + es.SMTPPort
+	err := smtp.SendMail(addr, auth, es.From, []string{to}, message)
+	if err != nil {
+		log.Printf("❌ Failed to send notification email to %s: %v", to, err)
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("✅ Notification email sent to %s", to)
+	return nil
+}
+
+// SendPasswordResetEmail sends a password reset link to the user
+func (es *EmailService) SendPasswordResetEmail(to, username, token string) error {
+	if es.From == "" || es.Password == "" {
+		log.Println("⚠️  SMTP credentials not configured, skipping email send")
+		return fmt.Errorf("SMTP credentials not configured")
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+
+	resetLink := fmt.Sprintf("%s/reset-password?token=%s", baseURL, token)
+
+	subject := "Reset Your Password - AIManage"
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background-color: #4F46E5; color: white; padding: 20px; text-align: center; border-radius: 5px 5px 0 0; }
+        .content { background-color: #f9f9f9; padding: 30px; border-radius: 0 0 5px 5px; }
+        .button { display: inline-block; padding: 12px 30px; background-color: #4F46E5; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+        .footer { text-align: center; margin-top: 20px; color: #666; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Reset Your Password</h1>
+        </div>
+        <div class="content">
+            <p>Hi %s,</p>
+            <p>We received a request to reset the password of your AIManage account.</p>
+            <p style="text-align: center;">
+                <a href="%s" class="button">Choose a New Password</a>
+            </p>
+            <p>Or copy and paste this link into your browser:</p>
+            <p style="word-break: break-all; background-color: #e9ecef; padding: 10px; border-radius: 3px;">%s</p>
+            <p>This link will expire in 1 hour. Resetting your password signs you out everywhere.</p>
+            <p>If you didn't ask to reset your password, please ignore this email.</p>
+        </div>
+        <div class="footer">
+            <p>&copy; 2024 AIManage. All rights reserved.</p>
+        </div>
+    </div>
+</body>
+</html>
+`, html.EscapeString(username), resetLink, resetLink)
+
+	// Compose message
+	message := []byte(
+		"From: " + es.From + "\r\n" +
+			"To: " + to + "\r\n" +
+			"Subject: " + subject + "\r\n" +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: text/html; charset=UTF-8\r\n" +
+			"\r\n" +
+			body + "\r\n")
+
+	// Set up authentication
+	auth := smtp.PlainAuth("", es.From, es.Password, es.SMTPHost)
+
+	// Send email
+	addr := es.SMTPHost + ":" + es.SMTPPort
+	err := smtp.SendMail(addr, auth, es.From, []string{to}, message)
+	if err != nil {
+		log.Printf("❌ Failed to send password reset email to %s: %v", to, err)
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("✅ Password reset email sent to %s", to)
+	return nil
+}
+
+// ReportRow is a labelled value in a report email; rows without a value are section headings
+type ReportRow struct {
+	Label string
+	Value string
+}
+
+// SendReportEmail sends a report as a table of labelled values with a link back to the platform
+func (es *EmailService) SendReportEmail(to, username, title string, rows []ReportRow, link string) error {
+	if es.From == "" || es.Password == "" {
+		log.Println("⚠️  SMTP credentials not configured, skipping email send")
+		return fmt.Errorf("SMTP credentials not configured")
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+
+	var table strings.Builder
+	for _, row := range rows {
+		if row.Value == "" {
+			fmt.Fprintf(&table, `<tr><th colspan="2">%s</th></tr>`, html.EscapeString(row.Label))
+			continue
+		}
+		fmt.Fprintf(&table, `<tr><td>%s</td><td class="value">%s</td></tr>`, html.EscapeString(row.Label), html.EscapeString(row.Value))
+	}
+
+	subject := title + " - AIManage"
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background-color: #4F46E5; color: white; padding: 20px; text-align: center; border-radius: 5px 5px 0 0; }
+        .content { background-color: #f9f9f9; padding: 30px; border-radius: 0 0 5px 5px; }
+        table { width: 100%%; border-collapse: collapse; }
+        th { text-align: left; padding-top: 16px; border-bottom: 1px solid #ddd; }
+        td { padding: 4px 0; }
+        .value { text-align: right; font-weight: bold; }
+        .button { display: inline-block; padding: 12px 30px; background-color: #4F46E5; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+        .footer { text-align: center; margin-top: 20px; color: #666; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>%s</h1>
+        </div>
+        <div class="content">
+            <p>Hi %s,</p>
+            <table>%s</table>
+            <p style="text-align: center;">
+                <a href="%s%s" class="button">View on AIManage</a>
+            </p>
+        </div>
+        <div class="footer">
+            <p>You are receiving this email because you are an AIManage administrator.</p>
+            <p>&copy; 2024 AIManage. All rights reserved.</p>
+        </div>
+    </div>
+</body>
+</html>
+`, html.EscapeString(title), html.EscapeString(username), table.String(), baseURL, link)
+
+	message := []byte(
+		"From: " + es.From + "\r\n" +
+			"To: " + to + "\r\n" +
+			"Subject: " + subject + "\r\n" +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: text/html; charset=UTF-8\r\n" +
+			"\r\n" +
+			body + "\r\n")
+
+	auth := smtp.PlainAuth("", es.From, es.Password, es.SMTPHost)
+	addr := es.SMTPHost + ":" + es.SMTPPort
+	if err := smtp.SendMail(addr, auth, es.From, []string{to}, message); err != nil {
+		log.Printf("❌ Failed to send report email to %s: %v", to, err)
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("✅ Report email sent to %s", to)
+	return nil
+}
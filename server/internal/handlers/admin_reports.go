@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/apierrors"
+	"server/internal/email"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// topStorageConsumers is how many users the weekly report lists by storage used
+const topStorageConsumers = 10
+
+// reportCount is a number at the end of a report period and how much it grew during the period
+type reportCount struct {
+	New   int64 `json:"new"`
+	Total int64 `json:"total"`
+}
+
+// storageConsumer is a user and the storage their model folders use
+type storageConsumer struct {
+	UserID   int    `json:"user_id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// weeklyReport summarizes a week of platform growth for admins. Growth fields compare with the
+// previous week's report and are nil when there is none.
+type weeklyReport struct {
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	GeneratedAt time.Time `json:"generated_at"`
+
+	Users     reportCount `json:"users"`
+	Models    reportCount `json:"models"`
+	Trainings struct {
+		Server int64 `json:"server"`
+		Agent  int64 `json:"agent"`
+	} `json:"trainings"`
+
+	Storage struct {
+		TotalBytes   int64             `json:"total_bytes"`
+		GrowthBytes  *int64            `json:"growth_bytes"`
+		TopConsumers []storageConsumer `json:"top_consumers"`
+	} `json:"storage"`
+
+	Revenue struct {
+		// MRRCents is the monthly price of the active paid subscriptions, as synced from Stripe
+		MRRCents       int64            `json:"mrr_cents"`
+		MRRGrowthCents *int64           `json:"mrr_growth_cents"`
+		Subscribers    map[string]int64 `json:"subscribers"`
+	} `json:"revenue"`
+
+	Requests struct {
+		Total        int64   `json:"total"`
+		ClientErrors int64   `json:"client_errors"`
+		ServerErrors int64   `json:"server_errors"`
+		ErrorRate    float64 `json:"error_rate"` // Share of requests answered with a 5xx
+	} `json:"requests"`
+}
+
+// reportWeekStart returns the Monday 00:00 UTC that starts the week of t
+func reportWeekStart(t time.Time) time.Time {
+	day := t.UTC().Truncate(24 * time.Hour)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// folderSize sums the size of the files under a folder
+func folderSize(folder string) int64 {
+	var total int64
+	filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// storageByOwner returns the users whose server-side model folders use the most storage
+func storageByOwner(ctx context.Context) ([]storageConsumer, error) {
+	rows, err := repository.GetModelFoldersByOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	consumers := map[int]*storageConsumer{}
+	for _, row := range rows {
+		userID := getIntField(row, "user_id", 0)
+		consumer, ok := consumers[userID]
+		if !ok {
+			consumer = &storageConsumer{UserID: userID, Email: getStringField(row, "email", ""), Username: getStringField(row, "username", "")}
+			consumers[userID] = consumer
+		}
+		folders, _ := row["folder"].([]interface{})
+		for _, f := range folders {
+			folder, ok := f.(string)
+			if !ok || !strings.HasPrefix(filepath.Clean(folder), "uploads") {
+				// Local-mode models live on the user's machine
+				continue
+			}
+			consumer.Bytes += folderSize(folder)
+		}
+	}
+
+	top := make([]storageConsumer, 0, len(consumers))
+	for _, consumer := range consumers {
+		if consumer.Bytes > 0 {
+			top = append(top, *consumer)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool { return top[i].Bytes > top[j].Bytes })
+	if len(top) > topStorageConsumers {
+		top = top[:topStorageConsumers]
+	}
+	return top, nil
+}
+
+// buildWeeklyReport summarizes the week starting at periodStart
+func buildWeeklyReport(ctx context.Context, periodStart time.Time) (*weeklyReport, error) {
+	report := &weeklyReport{PeriodStart: periodStart, PeriodEnd: periodStart.AddDate(0, 0, 7), GeneratedAt: time.Now().UTC()}
+
+	growth, err := repository.GetGrowthCounts(ctx, report.PeriodStart, report.PeriodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count growth: %w", err)
+	}
+	count := func(field string) int64 { return int64(getIntField(growth, field, 0)) }
+	report.Users = reportCount{New: count("new_users"), Total: count("total_users")}
+	report.Models = reportCount{New: count("new_models"), Total: count("total_models")}
+	report.Trainings.Server = count("server_trainings")
+	report.Trainings.Agent = count("agent_trainings")
+
+	report.Storage.TotalBytes = folderSize(uploadsBaseDir())
+	if report.Storage.TopConsumers, err = storageByOwner(ctx); err != nil {
+		return nil, fmt.Errorf("failed to measure storage: %w", err)
+	}
+
+	subscriptions, err := repository.GetActiveSubscriptionCounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subscriptions: %w", err)
+	}
+	report.Revenue.Subscribers = map[string]int64{}
+	for _, row := range subscriptions {
+		tier := getStringField(row, "tier", "")
+		subscribers := int64(getIntField(row, "subscribers", 0))
+		report.Revenue.Subscribers[tier] = subscribers
+		report.Revenue.MRRCents += subscriptionPrices[tier] * subscribers
+	}
+
+	requests, err := repository.GetRequestStats(ctx, report.PeriodStart, report.PeriodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load request stats: %w", err)
+	}
+	report.Requests.Total = int64(getIntField(requests, "requests", 0))
+	report.Requests.ClientErrors = int64(getIntField(requests, "client_errors", 0))
+	report.Requests.ServerErrors = int64(getIntField(requests, "server_errors", 0))
+	if report.Requests.Total > 0 {
+		report.Requests.ErrorRate = float64(report.Requests.ServerErrors) / float64(report.Requests.Total)
+	}
+
+	previous, err := repository.GetAdminReport(ctx, repository.AdminReportWeekly, periodStart.AddDate(0, 0, -7))
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to load the previous report: %w", err)
+	}
+	if err == nil {
+		var last weeklyReport
+		if data, err := json.Marshal(previous["report"]); err == nil && json.Unmarshal(data, &last) == nil {
+			storageGrowth := report.Storage.TotalBytes - last.Storage.TotalBytes
+			mrrGrowth := report.Revenue.MRRCents - last.Revenue.MRRCents
+			report.Storage.GrowthBytes = &storageGrowth
+			report.Revenue.MRRGrowthCents = &mrrGrowth
+		}
+	}
+	return report, nil
+}
+
+// formatBytes renders a size like 1.5 GB
+func formatBytes(size int64) string {
+	value, units := float64(size), []string{"B", "KB", "MB", "GB", "TB"}
+	unit := 0
+	for (value >= 1024 || value <= -1024) && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// signed prefixes growth with + when positive
+func signed(value string, positive bool) string {
+	if positive {
+		return "+" + value
+	}
+	return value
+}
+
+// reportEmailRows lays out a report for the admin email
+func reportEmailRows(report *weeklyReport) []email.ReportRow {
+	rows := []email.ReportRow{
+		{Label: "Growth"},
+		{Label: "New users", Value: fmt.Sprintf("%d (%d total)", report.Users.New, report.Users.Total)},
+		{Label: "New models", Value: fmt.Sprintf("%d (%d total)", report.Models.New, report.Models.Total)},
+		{Label: "Server trainings", Value: strconv.FormatInt(report.Trainings.Server, 10)},
+		{Label: "Agent trainings", Value: strconv.FormatInt(report.Trainings.Agent, 10)},
+		{Label: "Storage"},
+		{Label: "Total", Value: formatBytes(report.Storage.TotalBytes)},
+	}
+	if growth := report.Storage.GrowthBytes; growth != nil {
+		rows = append(rows, email.ReportRow{Label: "Change", Value: signed(formatBytes(*growth), *growth > 0)})
+	}
+	for _, consumer := range report.Storage.TopConsumers {
+		rows = append(rows, email.ReportRow{Label: consumer.Email, Value: formatBytes(consumer.Bytes)})
+	}
+
+	rows = append(rows,
+		email.ReportRow{Label: "Revenue"},
+		email.ReportRow{Label: "MRR", Value: fmt.Sprintf("$%.2f", float64(report.Revenue.MRRCents)/100)},
+	)
+	if growth := report.Revenue.MRRGrowthCents; growth != nil {
+		rows = append(rows, email.ReportRow{Label: "MRR growth", Value: signed(fmt.Sprintf("$%.2f", float64(*growth)/100), *growth > 0)})
+	}
+	for _, tier := range []string{TierBasic, TierPro, TierEnterprise} {
+		rows = append(rows, email.ReportRow{Label: strings.ToUpper(tier[:1]) + tier[1:] + " subscribers", Value: strconv.FormatInt(report.Revenue.Subscribers[tier], 10)})
+	}
+
+	return append(rows,
+		email.ReportRow{Label: "Errors"},
+		email.ReportRow{Label: "Requests", Value: strconv.FormatInt(report.Requests.Total, 10)},
+		email.ReportRow{Label: "4xx responses", Value: strconv.FormatInt(report.Requests.ClientErrors, 10)},
+		email.ReportRow{Label: "5xx responses", Value: fmt.Sprintf("%d (%.2f%%)", report.Requests.ServerErrors, report.Requests.ErrorRate*100)},
+	)
+}
+
+// generateWeeklyReport builds, stores and emails to the admins the report of the last full week,
+// unless it exists already
+func generateWeeklyReport(ctx context.Context) error {
+	periodStart := reportWeekStart(time.Now()).AddDate(0, 0, -7)
+	if _, err := repository.GetAdminReport(ctx, repository.AdminReportWeekly, periodStart); err != pgx.ErrNoRows {
+		return err
+	}
+
+	report, err := buildWeeklyReport(ctx, periodStart)
+	if err != nil {
+		return err
+	}
+	reportID, err := repository.SaveAdminReport(ctx, repository.AdminReportWeekly, report.PeriodStart, report.PeriodEnd, report)
+	if err != nil || reportID == 0 {
+		return err
+	}
+	log.Printf("📊 Weekly report of %s generated", periodStart.Format("2006-01-02"))
+
+	admins, err := repository.GetAdminUsers(ctx)
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("Weekly report: %s – %s", report.PeriodStart.Format("Jan 2"), report.PeriodEnd.AddDate(0, 0, -1).Format("Jan 2, 2006"))
+	rows := reportEmailRows(report)
+	sent := false
+	for _, admin := range admins {
+		if err := email.NewEmailService().SendReportEmail(getStringField(admin, "email", ""), getStringField(admin, "username", ""), title, rows, "/admin/reports"); err == nil {
+			sent = true
+		}
+	}
+	if sent {
+		return repository.MarkAdminReportEmailed(ctx, reportID)
+	}
+	return nil
+}
+
+// flushRequestStats adds the request counts collected by the middleware to the database
+func flushRequestStats(ctx context.Context) {
+	for hour, stats := range middlewares.TakeRequestStats() {
+		if err := repository.AddRequestStats(ctx, hour, stats.Requests, stats.ClientErrors, stats.ServerErrors); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+}
+
+// StartAdminReports stores request counts every minute and generates the weekly admin report once
+// the week is over
+func StartAdminReports() {
+	go func() {
+		for {
+			flushRequestStats(context.Background())
+			time.Sleep(time.Minute)
+		}
+	}()
+	go func() {
+		for {
+			if err := generateWeeklyReport(context.Background()); err != nil {
+				log.Printf("⚠️  Weekly admin report failed: %v", err)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// GetWeeklyReportsHandler returns the latest weekly admin reports, newest first. weeks sets how
+// many (12 by default, up to 104).
+func GetWeeklyReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	weeks := 12
+	if raw := r.URL.Query().Get("weeks"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 104 {
+			apierrors.Respond(w, http.StatusBadRequest, "weeks must be between 1 and 104")
+			return
+		}
+		weeks = n
+	}
+
+	reports, err := repository.GetAdminReports(r.Context(), repository.AdminReportWeekly, weeks)
+	if err != nil {
+		log.Printf("❌ Failed to get weekly reports: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve reports")
+		return
+	}
+	if reports == nil {
+		reports = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"reports": reports,
+	})
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/apierrors"
+	"server/internal/email"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	maxSuspensionReasonLength = 2000
+	maxCreditAdjustment       = 100000
+)
+
+// RequireAdmin lets only platform administrators through. It must run after JWTGuard, and the
+// handlers behind it can take the admin's ID from the context.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireAdmin(w, r); !ok {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsUserSuspended reports whether a user's account is suspended, for RejectSuspendedUsers
+func IsUserSuspended(ctx context.Context, userID int) (bool, error) {
+	return repository.IsUserSuspended(ctx, userID)
+}
+
+// allowSignIn refuses to open a session for a suspended account, writing the error response
+func allowSignIn(w http.ResponseWriter, r *http.Request, userID int) bool {
+	suspended, err := repository.IsUserSuspended(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to check suspension of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
+		return false
+	}
+	if suspended {
+		apierrors.Respond(w, http.StatusForbidden, "This account has been suspended")
+		return false
+	}
+	return true
+}
+
+// adminTargetUserID reads the {userId} of an admin route, writing the error response when invalid
+func adminTargetUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil || userID <= 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return userID, true
+}
+
+// GetAdminUsersHandler lists users for admins, filtered by ?q= (email or username), ?role= and
+// ?suspended=true|false
+func GetAdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := repository.AdminUserFilter{Query: strings.TrimSpace(query.Get("q"))}
+	switch role := query.Get("role"); role {
+	case "", repository.RoleUser, repository.RoleAdmin:
+		filter.Role = role
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, "role must be user or admin")
+		return
+	}
+	if raw := query.Get("suspended"); raw != "" {
+		suspended, err := strconv.ParseBool(raw)
+		if err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "suspended must be true or false")
+			return
+		}
+		filter.Suspended = &suspended
+	}
+
+	page, pageSize := parsePagination(r)
+	users, total, err := repository.GetUsersForAdmin(r.Context(), filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get users: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+	if users == nil {
+		users = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"users":     users,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// UpdateUserRoleHandler sets a user's role with {"role": "user" | "admin"}. Admins cannot
+// change their own role, so there is always one left.
+func UpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	userID, ok := adminTargetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Role != repository.RoleUser && req.Role != repository.RoleAdmin {
+		apierrors.Respond(w, http.StatusBadRequest, "role must be user or admin")
+		return
+	}
+	if userID == adminID {
+		apierrors.Respond(w, http.StatusBadRequest, "You cannot change your own role")
+		return
+	}
+
+	found, err := repository.SetUserRole(r.Context(), userID, req.Role)
+	if err != nil {
+		log.Printf("❌ Failed to set role of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update role")
+		return
+	}
+	if !found {
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+	log.Printf("👤 Admin %d set the role of user %d to %s", adminID, userID, req.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"user_id": userID,
+		"role":    req.Role,
+	})
+}
+
+// SuspendUserHandler suspends an account with {"reason": "..."}. The user is signed out, can no
+// longer sign in or use the API, and gets an email with the reason.
+func SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	userID, ok := adminTargetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+	if len(req.Reason) > maxSuspensionReasonLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("reason cannot be longer than %d characters", maxSuspensionReasonLength))
+		return
+	}
+	if userID == adminID {
+		apierrors.Respond(w, http.StatusBadRequest, "You cannot suspend yourself")
+		return
+	}
+
+	user, err := repository.SuspendUser(r.Context(), userID, adminID, req.Reason)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "User not found")
+			return
+		}
+		log.Printf("❌ Failed to suspend user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to suspend user")
+		return
+	}
+	log.Printf("🚫 Admin %d suspended user %d: %s", adminID, userID, req.Reason)
+
+	go func() {
+		if err := email.NewEmailService().SendNotificationEmail(getStringField(user, "email", ""), getStringField(user, "username", ""),
+			"Your account was suspended", fmt.Sprintf("Reason: %s. Contact support to contest the decision.", req.Reason), ""); err != nil {
+			log.Printf("⚠️  Failed to email suspension to user %d: %v", userID, err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"user_id":   userID,
+		"suspended": true,
+	})
+}
+
+// UnsuspendUserHandler lifts the suspension of an account
+func UnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	userID, ok := adminTargetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	lifted, err := repository.UnsuspendUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to unsuspend user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to unsuspend user")
+		return
+	}
+	if !lifted {
+		apierrors.Respond(w, http.StatusNotFound, "User not found or not suspended")
+		return
+	}
+	log.Printf("✅ Admin %d lifted the suspension of user %d", adminID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"user_id":   userID,
+		"suspended": false,
+	})
+}
+
+// GetUserCreditAdjustmentsHandler returns the credit adjustments admins made to a user
+func GetUserCreditAdjustmentsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTargetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	adjustments, err := repository.GetCreditAdjustments(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get credit adjustments of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve credit adjustments")
+		return
+	}
+	if adjustments == nil {
+		adjustments = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"user_id":     userID,
+		"adjustments": adjustments,
+	})
+}
+
+// AdjustUserCreditsHandler adds to or removes from a user's training credits with
+// {"delta": 10, "reason": "..."}. Every adjustment is recorded with the admin and the reason.
+func AdjustUserCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	userID, ok := adminTargetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Delta  int    `json:"delta"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Delta == 0 || req.Delta > maxCreditAdjustment || req.Delta < -maxCreditAdjustment {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("delta must be a non-zero number of credits between -%d and %d", maxCreditAdjustment, maxCreditAdjustment))
+		return
+	}
+	if req.Reason == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+
+	balance, err := repository.AdjustTrainingCredits(r.Context(), userID, adminID, req.Delta, req.Reason)
+	if err != nil {
+		switch {
+		case err == pgx.ErrNoRows:
+			apierrors.Respond(w, http.StatusNotFound, "User not found")
+		case errors.Is(err, repository.ErrInsufficientCredits):
+			apierrors.Respond(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("❌ Failed to adjust credits of user %d: %v", userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to adjust credits")
+		}
+		return
+	}
+	log.Printf("💳 Admin %d adjusted the credits of user %d by %d: %s", adminID, userID, req.Delta, req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":          true,
+		"user_id":          userID,
+		"delta":            req.Delta,
+		"training_credits": balance,
+	})
+}
+
+// GetAdminTrainingsHandler lists the trainings of every user, filtered by ?user_id=, ?model_id=
+// and ?training_type=server|agent. Trainings tracked by this server include their live status.
+func GetAdminTrainingsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter repository.AdminTrainingFilter
+	for name, target := range map[string]*int{"user_id": &filter.UserID, "model_id": &filter.ModelID} {
+		if raw := query.Get(name); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil || id <= 0 {
+				apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s", name))
+				return
+			}
+			*target = id
+		}
+	}
+	switch trainingType := query.Get("training_type"); trainingType {
+	case "", "server", "agent":
+		filter.TrainingType = trainingType
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, "training_type must be server or agent")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	runs, total, err := repository.GetTrainingRunsForAdmin(r.Context(), filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get trainings: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve trainings")
+		return
+	}
+	if runs == nil {
+		runs = []map[string]interface{}{}
+	}
+
+	if trainer := GetGlobalTrainer(); trainer != nil {
+		for _, run := range runs {
+			if progress, err := trainer.GetProgress(getStringField(run, "training_id", "")); err == nil && progress != nil {
+				run["status"] = progress.Status
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"trainings": runs,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
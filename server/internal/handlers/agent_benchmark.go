@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+	"server/internal/ws"
+)
+
+// benchmarkTimeout is how long an agent may take to report its benchmark before it is considered lost
+const benchmarkTimeout = 10 * time.Minute
+
+// maxAgentBenchmarks bounds the benchmark history returned to a user
+const maxAgentBenchmarks = 50
+
+// agentName identifies an agent among its owner's by the hostname it reports
+func agentName(systemInfo map[string]interface{}) string {
+	if hostname, _ := systemInfo["hostname"].(string); strings.TrimSpace(hostname) != "" {
+		return strings.TrimSpace(hostname)
+	}
+	return "agent"
+}
+
+// benchmarking reports whether the agent is running its benchmark. The caller holds ac.mu.
+func (ac *AgentConnection) benchmarking() bool {
+	return ac.IsBenchmarking && time.Since(ac.benchmarkStartedAt) < benchmarkTimeout
+}
+
+// benchmarkFromRow converts an agent_benchmarks row into a result
+func benchmarkFromRow(row map[string]interface{}) *aiAgent.BenchmarkResult {
+	result := &aiAgent.BenchmarkResult{}
+	result.Suite, _ = row["suite"].(string)
+	result.Device, _ = row["device"].(string)
+	result.MatmulGFLOPS, _ = row["matmul_gflops"].(float64)
+	result.CNNSamplesPerSec, _ = row["cnn_samples_per_sec"].(float64)
+	result.DurationSeconds, _ = row["duration_seconds"].(float64)
+	result.Score, _ = row["score"].(float64)
+	result.CompletedAt, _ = row["created_at"].(time.Time)
+	return result
+}
+
+// loadLatestBenchmark restores the agent's stored benchmark after it reconnects
+func (ac *AgentConnection) loadLatestBenchmark() {
+	ac.mu.Lock()
+	name := ac.displayName()
+	ac.mu.Unlock()
+
+	row, err := repository.GetLatestAgentBenchmark(context.Background(), ac.UserID, name, aiAgent.BenchmarkSuiteVersion)
+	if err != nil {
+		return
+	}
+	ac.mu.Lock()
+	if ac.Benchmark == nil {
+		ac.Benchmark = benchmarkFromRow(row)
+	}
+	ac.mu.Unlock()
+}
+
+// saveBenchmark stores the result of a benchmark_result message and sends it to the user's browser
+func (ac *AgentConnection) saveBenchmark(data interface{}) {
+	ac.mu.Lock()
+	ac.IsBenchmarking = false
+	systemInfo := ac.SystemInfo
+	name := ac.displayName()
+	ac.mu.Unlock()
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("⚠️  Invalid benchmark result from %s: %v", ac.UserEmail, err)
+		return
+	}
+	result, err := aiAgent.ParseBenchmarkResult(payload)
+	if err != nil {
+		log.Printf("⚠️  Invalid benchmark result from %s: %v", ac.UserEmail, err)
+		ws.BroadcastToUser(ac.UserID, map[string]interface{}{
+			"type": "agent_benchmark",
+			"data": map[string]interface{}{
+				"status":        "failed",
+				"error_message": err.Error(),
+			},
+		})
+		return
+	}
+
+	ac.mu.Lock()
+	ac.Benchmark = result
+	ac.mu.Unlock()
+	log.Printf("🏁 Agent benchmark for %s: score %.1f (%.1f GFLOPS, %.0f CNN samples/s on %s)",
+		ac.UserEmail, result.Score, result.MatmulGFLOPS, result.CNNSamplesPerSec, result.Device)
+
+	if err := repository.SaveAgentBenchmark(context.Background(), ac.UserID, name, result.Suite, result.Device,
+		result.MatmulGFLOPS, result.CNNSamplesPerSec, result.DurationSeconds, result.Score, systemInfo); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+
+	ws.BroadcastToUser(ac.UserID, map[string]interface{}{
+		"type": "agent_benchmark",
+		"data": map[string]interface{}{
+			"status":    "completed",
+			"benchmark": result,
+		},
+	})
+}
+
+// StartAgentBenchmark asks the user's agent trainings go to by default to run the benchmark suite.
+// The result arrives asynchronously as a benchmark_result message.
+func StartAgentBenchmark(userEmail string) error {
+	agent, err := selectAgent(userEmail, "")
+	if err != nil {
+		return err
+	}
+
+	agent.mu.Lock()
+	if agent.IsTraining {
+		agent.mu.Unlock()
+		return fmt.Errorf("agent is training a model, benchmark it once the training finishes")
+	}
+	if agent.benchmarking() {
+		agent.mu.Unlock()
+		return fmt.Errorf("agent is already running its benchmark")
+	}
+	agent.IsBenchmarking = true
+	agent.benchmarkStartedAt = time.Now()
+	agent.mu.Unlock()
+
+	if err := agent.SendMessage(map[string]interface{}{
+		"type": "benchmark",
+		"data": map[string]interface{}{"suite": aiAgent.BenchmarkSuiteVersion},
+	}); err != nil {
+		agent.mu.Lock()
+		agent.IsBenchmarking = false
+		agent.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// AgentBenchmark returns the latest benchmark of the user's agent trainings go to by default, or nil
+// if it has none. Placement decisions use its score to compare agents with each other and with
+// server training.
+func AgentBenchmark(userEmail string) *aiAgent.BenchmarkResult {
+	agent, err := selectAgent(userEmail, "")
+	if err != nil {
+		return nil
+	}
+
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	return agent.Benchmark
+}
+
+// RunAgentBenchmarkHandler starts the benchmark suite on the user's agent
+func RunAgentBenchmarkHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if !IsAgentConnected(userEmail) {
+		apierrors.Respond(w, http.StatusConflict, "No training agent connected")
+		return
+	}
+	if err := StartAgentBenchmark(userEmail); err != nil {
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	}
+	log.Printf("🏁 Benchmark requested from the agent of %s", userEmail)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Benchmark started on your agent",
+		"suite":   aiAgent.BenchmarkSuiteVersion,
+	})
+}
+
+// GetAgentBenchmarksHandler lists the benchmark history of the user's agents
+func GetAgentBenchmarksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	benchmarks, err := repository.GetAgentBenchmarks(r.Context(), userID, maxAgentBenchmarks)
+	if err != nil {
+		log.Printf("❌ Failed to get agent benchmarks of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve agent benchmarks")
+		return
+	}
+	if benchmarks == nil {
+		benchmarks = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"benchmarks": benchmarks,
+	})
+}
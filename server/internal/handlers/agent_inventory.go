@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+	"server/internal/ws"
+)
+
+const (
+	// maxInventoryTrainings bounds the training history stored per agent
+	maxInventoryTrainings = 500
+	// maxInventoryArtifacts bounds the model files stored per agent
+	maxInventoryArtifacts = 5000
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// agentTrainingRecord is a training in the history an agent reports
+type agentTrainingRecord struct {
+	TrainingID string   `json:"training_id"`
+	FolderPath string   `json:"folder_path"`
+	ScriptName string   `json:"script_name"`
+	Status     string   `json:"status"`
+	ModelPath  string   `json:"model_path"`
+	StartedAt  *float64 `json:"started_at"`
+	FinishedAt *float64 `json:"finished_at"`
+}
+
+// agentArtifact is a model file on an agent's machine. Times are Unix timestamps.
+type agentArtifact struct {
+	Path       string   `json:"path"`
+	SizeBytes  int64    `json:"size_bytes"`
+	SHA256     string   `json:"sha256"`
+	ModifiedAt *float64 `json:"modified_at"`
+	TrainingID string   `json:"training_id"`
+	ServerPath string   `json:"server_path"`
+}
+
+// register records the agent under its name, or the hostname it reported, and asks it for its inventory
+func (ac *AgentConnection) register() {
+	ac.mu.Lock()
+	systemInfo := ac.SystemInfo
+	name := ac.displayName()
+	ac.mu.Unlock()
+
+	agentID, err := repository.RegisterAgent(context.Background(), ac.UserID, name, systemInfo)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	ac.mu.Lock()
+	ac.AgentID = agentID
+	ac.mu.Unlock()
+
+	if err := ac.SendMessage(map[string]interface{}{"type": "inventory_request"}); err != nil {
+		log.Printf("⚠️  Failed to request inventory: %v", err)
+	}
+}
+
+// saveInventory stores the training history and artifacts of an inventory message. Malformed
+// records are dropped rather than failing the whole inventory.
+func (ac *AgentConnection) saveInventory(data interface{}) {
+	ac.mu.Lock()
+	agentID := ac.AgentID
+	ac.mu.Unlock()
+	if agentID == 0 {
+		log.Printf("⚠️  Inventory from unregistered agent of %s ignored", ac.UserEmail)
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("⚠️  Invalid inventory from %s: %v", ac.UserEmail, err)
+		return
+	}
+	var inventory struct {
+		Trainings []agentTrainingRecord `json:"trainings"`
+		Artifacts []agentArtifact       `json:"artifacts"`
+	}
+	if err := json.Unmarshal(payload, &inventory); err != nil {
+		log.Printf("⚠️  Invalid inventory from %s: %v", ac.UserEmail, err)
+		return
+	}
+
+	trainings := []agentTrainingRecord{}
+	seenTrainings := map[string]bool{}
+	for _, training := range inventory.Trainings {
+		if training.TrainingID == "" || len(training.TrainingID) > 255 || seenTrainings[training.TrainingID] {
+			continue
+		}
+		switch training.Status {
+		case "running", "completed", "failed":
+		default:
+			continue
+		}
+		seenTrainings[training.TrainingID] = true
+		trainings = append(trainings, training)
+	}
+	if len(trainings) > maxInventoryTrainings {
+		trainings = trainings[len(trainings)-maxInventoryTrainings:]
+	}
+
+	artifacts := []agentArtifact{}
+	seenPaths := map[string]bool{}
+	for _, artifact := range inventory.Artifacts {
+		artifact.SHA256 = strings.ToLower(artifact.SHA256)
+		if artifact.Path == "" || seenPaths[artifact.Path] || artifact.SizeBytes < 0 || !sha256Pattern.MatchString(artifact.SHA256) {
+			continue
+		}
+		if len(artifact.TrainingID) > 255 {
+			artifact.TrainingID = ""
+		}
+		seenPaths[artifact.Path] = true
+		artifacts = append(artifacts, artifact)
+		if len(artifacts) == maxInventoryArtifacts {
+			break
+		}
+	}
+
+	trainingsJSON, _ := json.Marshal(trainings)
+	artifactsJSON, _ := json.Marshal(artifacts)
+	if err := repository.ReplaceAgentInventory(context.Background(), agentID, trainingsJSON, artifactsJSON); err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	log.Printf("📦 Inventory of agent %d (%s): %d trainings, %d artifacts", agentID, ac.UserEmail, len(trainings), len(artifacts))
+
+	ws.BroadcastToUser(ac.UserID, map[string]interface{}{
+		"type": "agent_inventory",
+		"data": map[string]interface{}{
+			"agent_id":        agentID,
+			"trainings_count": len(trainings),
+			"artifacts_count": len(artifacts),
+		},
+	})
+}
+
+// artifactUploaded records where the agent uploaded an artifact the user asked for
+func (ac *AgentConnection) artifactUploaded(path, serverPath string) {
+	ac.mu.Lock()
+	agentID := ac.AgentID
+	ac.mu.Unlock()
+
+	if err := repository.SetAgentArtifactServerPath(context.Background(), agentID, path, serverPath); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	log.Printf("📤 Agent %d uploaded %s to %s", agentID, path, serverPath)
+
+	ws.BroadcastToUser(ac.UserID, map[string]interface{}{
+		"type": "agent_artifact_upload",
+		"data": map[string]interface{}{
+			"agent_id":    agentID,
+			"path":        path,
+			"status":      "completed",
+			"server_path": serverPath,
+		},
+	})
+}
+
+// connectedAgent returns the connection of the user's agent with the given ID, if it is connected
+func connectedAgent(userID, agentID int) *AgentConnection {
+	for _, ac := range agentManager.all() {
+		ac.mu.Lock()
+		match := ac.UserID == userID && ac.AgentID == agentID
+		ac.mu.Unlock()
+		if match {
+			return ac
+		}
+	}
+	return nil
+}
+
+// userAgentFromRequest loads the agent in the {id} URL parameter, writing the error response if
+// it is not one of the user's
+func userAgentFromRequest(w http.ResponseWriter, r *http.Request) (int, int, map[string]interface{}, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return 0, 0, nil, false
+	}
+	agentID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid agent ID")
+		return 0, 0, nil, false
+	}
+
+	agent, err := repository.GetAgent(r.Context(), agentID, userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Agent not found")
+			return 0, 0, nil, false
+		}
+		log.Printf("❌ Failed to get agent %d: %v", agentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve agent")
+		return 0, 0, nil, false
+	}
+	return userID, agentID, agent, true
+}
+
+// GetAgentsHandler lists the agents the user has connected. Agents not seen for the user's
+// stale_after_days are left out unless ?include_stale=true.
+func GetAgentsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	agents, err := repository.GetUserAgents(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get agents of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve agents")
+		return
+	}
+	policy := userAgentStalenessPolicy(r.Context(), userID)
+	includeStale := r.URL.Query().Get("include_stale") == "true"
+	now := time.Now()
+	listed := []map[string]interface{}{}
+	hidden := 0
+	for _, agent := range agents {
+		annotateAgentSeen(agent, connectedAgent(userID, getIntField(agent, "id", 0)) != nil, policy, now)
+		if agent["stale"] == true && !includeStale {
+			hidden++
+			continue
+		}
+		listed = append(listed, agent)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":          true,
+		"agents":           listed,
+		"stale_hidden":     hidden,
+		"stale_after_days": policy.StaleAfterDays,
+	})
+}
+
+// GetAgentInventoryHandler returns the training history and model files of one of the user's
+// agents, showing which files exist only on that machine
+func GetAgentInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, agentID, agent, ok := userAgentFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	trainings, err := repository.GetAgentTrainings(r.Context(), agentID)
+	if err != nil {
+		log.Printf("❌ Failed to get trainings of agent %d: %v", agentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve agent inventory")
+		return
+	}
+	artifacts, err := repository.GetAgentArtifacts(r.Context(), agentID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to get artifacts of agent %d: %v", agentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve agent inventory")
+		return
+	}
+	if trainings == nil {
+		trainings = []map[string]interface{}{}
+	}
+	if artifacts == nil {
+		artifacts = []map[string]interface{}{}
+	}
+
+	onlyHere := 0
+	for _, artifact := range artifacts {
+		onServer, _ := artifact["on_server"].(bool)
+		artifact["only_on_agent"] = !onServer && getIntField(artifact, "other_agents", 0) == 0
+		if artifact["only_on_agent"] == true {
+			onlyHere++
+		}
+	}
+	annotateAgentSeen(agent, connectedAgent(userID, agentID) != nil, userAgentStalenessPolicy(r.Context(), userID), time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"agent":           agent,
+		"trainings":       trainings,
+		"artifacts":       artifacts,
+		"only_on_agent":   onlyHere,
+		"artifacts_count": len(artifacts),
+		"trainings_count": len(trainings),
+	})
+}
+
+// UploadAgentArtifactsHandler asks a connected agent to upload model files the server is missing:
+// the artifact_ids given, or every artifact not on the server yet
+func UploadAgentArtifactsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, agentID, _, ok := userAgentFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ArtifactIDs []int `json:"artifact_ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	conn := connectedAgent(userID, agentID)
+	if conn == nil {
+		apierrors.Respond(w, http.StatusConflict, "Agent is not connected")
+		return
+	}
+
+	artifacts, err := repository.GetAgentArtifacts(r.Context(), agentID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to get artifacts of agent %d: %v", agentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve agent inventory")
+		return
+	}
+	trainings, err := repository.GetAgentTrainings(r.Context(), agentID)
+	if err != nil {
+		log.Printf("❌ Failed to get trainings of agent %d: %v", agentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve agent inventory")
+		return
+	}
+
+	requested := map[int]bool{}
+	for _, id := range req.ArtifactIDs {
+		requested[id] = true
+	}
+	selected := []map[string]interface{}{}
+	for _, artifact := range artifacts {
+		id := getIntField(artifact, "id", 0)
+		if len(req.ArtifactIDs) > 0 {
+			if requested[id] {
+				delete(requested, id)
+				selected = append(selected, artifact)
+			}
+		} else if onServer, _ := artifact["on_server"].(bool); !onServer {
+			selected = append(selected, artifact)
+		}
+	}
+	if len(requested) > 0 {
+		apierrors.Respond(w, http.StatusNotFound, "Some artifacts are not in this agent's inventory")
+		return
+	}
+
+	queued := []string{}
+	for _, artifact := range selected {
+		path := getStringField(artifact, "path", "")
+		trainingID := getStringField(artifact, "training_id", "")
+		if trainingID == "" {
+			trainingID = artifactTraining(path, trainings)
+		}
+		modelName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if trainingID != "" {
+			modelName = extractModelName(trainingID)
+		}
+
+		if err := conn.SendMessage(map[string]interface{}{
+			"type": "upload_artifact",
+			"data": map[string]interface{}{
+				"path":        path,
+				"training_id": trainingID,
+				"model_name":  modelName,
+			},
+		}); err != nil {
+			log.Printf("⚠️  Failed to request upload of %s from agent %d: %v", path, agentID, err)
+			apierrors.Respond(w, http.StatusBadGateway, "Failed to reach the agent")
+			return
+		}
+		queued = append(queued, path)
+	}
+	log.Printf("📤 Requested %d artifact uploads from agent %d", len(queued), agentID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"queued":  queued,
+	})
+}
+
+// artifactTraining returns the training whose folder holds an artifact, preferring the deepest
+// folder and then the latest training
+func artifactTraining(path string, trainings []map[string]interface{}) string {
+	best, bestLen := "", 0
+	for _, training := range trainings {
+		folder := strings.TrimRight(getStringField(training, "folder_path", ""), "/\\")
+		if folder == "" || !strings.HasPrefix(path, folder) || len(path) <= len(folder) || !strings.ContainsRune("/\\", rune(path[len(folder)])) {
+			continue
+		}
+		if len(folder) > bestLen {
+			best, bestLen = getStringField(training, "training_id", ""), len(folder)
+		}
+	}
+	return best
+}
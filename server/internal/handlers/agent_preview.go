@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"server/helpers"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/ws"
+)
+
+// previewTTL is how long an agent keeps a preview session loaded after its last prediction
+const previewTTL = 15 * time.Minute
+
+// previewStartTimeout is how long an agent may take to load the model of a preview session
+const previewStartTimeout = 2 * time.Minute
+
+// previewPredictionTimeout is how long a prediction request waits for the agent's answer
+const previewPredictionTimeout = 30 * time.Second
+
+// maxPreviewInputSize limits the inputs of a prediction relayed to an agent
+const maxPreviewInputSize = 1 << 20 // 1 MB
+
+// Errors of preview sessions
+var (
+	errNoAgent          = errors.New("no training agent connected")
+	errNoPreview        = errors.New("start a preview and wait until it is ready")
+	errPreviewTimeout   = errors.New("the agent did not answer in time")
+	errPreviewNoContact = errors.New("failed to reach the agent")
+)
+
+// Preview session statuses
+const (
+	previewStarting = "starting"
+	previewReady    = "ready"
+)
+
+// agentPreview is an inference session the agent hosts for the model of one of its trainings.
+// Predictions are relayed over the agent's WebSocket, so the weights never leave its machine.
+type agentPreview struct {
+	ID         string    `json:"preview_id"`
+	TrainingID string    `json:"training_id"`
+	Status     string    `json:"status"`
+	Framework  string    `json:"framework,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// pending are the prediction requests waiting for the agent, by request ID
+	pending map[string]chan previewReply
+}
+
+// previewReply is the agent's answer to a prediction request
+type previewReply struct {
+	Outputs interface{}
+	Error   string
+}
+
+// activePreview returns the agent's preview session unless it expired. The caller holds ac.mu.
+func (ac *AgentConnection) activePreview() *agentPreview {
+	p := ac.preview
+	if p == nil {
+		return nil
+	}
+	if p.Status == previewStarting && time.Since(p.StartedAt) > previewStartTimeout || time.Now().After(p.ExpiresAt) {
+		ac.endPreview()
+		return nil
+	}
+	return p
+}
+
+// endPreview drops the agent's preview session and fails its pending predictions. The caller holds ac.mu.
+func (ac *AgentConnection) endPreview() {
+	if ac.preview == nil {
+		return
+	}
+	for _, reply := range ac.preview.pending {
+		reply <- previewReply{Error: "the preview session ended"}
+	}
+	ac.preview = nil
+}
+
+// previewUpdate handles the preview_ready, preview_failed and preview_stopped messages of the agent
+func (ac *AgentConnection) previewUpdate(msgType string, msg map[string]interface{}) {
+	previewID, _ := msg["preview_id"].(string)
+	errorMessage, _ := msg["error"].(string)
+
+	ac.mu.Lock()
+	p := ac.preview
+	if p == nil || p.ID != previewID {
+		ac.mu.Unlock()
+		return
+	}
+	data := map[string]interface{}{
+		"preview_id":  p.ID,
+		"training_id": p.TrainingID,
+	}
+	switch msgType {
+	case "preview_ready":
+		p.Status = previewReady
+		p.Framework, _ = msg["framework"].(string)
+		p.ExpiresAt = time.Now().Add(previewTTL)
+		data["status"] = previewReady
+		data["framework"] = p.Framework
+		data["expires_at"] = p.ExpiresAt
+		log.Printf("🔮 Preview of training %s ready on the agent of %s", p.TrainingID, ac.UserEmail)
+	case "preview_failed":
+		ac.endPreview()
+		data["status"] = "failed"
+		data["error_message"] = errorMessage
+		log.Printf("❌ Agent of %s could not start the preview of training %s: %s", ac.UserEmail, p.TrainingID, errorMessage)
+	default:
+		ac.endPreview()
+		data["status"] = "stopped"
+	}
+	ac.mu.Unlock()
+
+	ws.BroadcastToUser(ac.UserID, map[string]interface{}{
+		"type": "agent_preview",
+		"data": data,
+	})
+}
+
+// previewPrediction hands the agent's preview_prediction message to the request waiting for it
+func (ac *AgentConnection) previewPrediction(msg map[string]interface{}) {
+	requestID, _ := msg["request_id"].(string)
+	errorMessage, _ := msg["error"].(string)
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.preview == nil {
+		return
+	}
+	if reply, ok := ac.preview.pending[requestID]; ok {
+		delete(ac.preview.pending, requestID)
+		reply <- previewReply{Outputs: msg["outputs"], Error: errorMessage}
+	}
+}
+
+// agentOfUser returns the user's agent hosting a preview, or else the one trainings go to by
+// default, or nil when none is connected
+func agentOfUser(userEmail string) *AgentConnection {
+	for _, agent := range userAgents(userEmail) {
+		agent.mu.Lock()
+		previewing := agent.activePreview() != nil
+		agent.mu.Unlock()
+		if previewing {
+			return agent
+		}
+	}
+	agent, err := selectAgent(userEmail, "")
+	if err != nil {
+		return nil
+	}
+	return agent
+}
+
+// StartAgentPreview asks the user's agent to load the model of one of its trainings for previews,
+// replacing any previous session. The session is ready once the agent_preview event says so.
+func StartAgentPreview(userEmail, trainingID string) (agentPreview, error) {
+	agent := agentOfUser(userEmail)
+	if agent == nil {
+		return agentPreview{}, errNoAgent
+	}
+	previewID, err := helpers.GenerateRandomString(16)
+	if err != nil {
+		return agentPreview{}, err
+	}
+
+	agent.mu.Lock()
+	if agent.IsTraining {
+		agent.mu.Unlock()
+		return agentPreview{}, fmt.Errorf("agent is training a model, preview once the training finishes")
+	}
+	agent.endPreview()
+	now := time.Now()
+	preview := &agentPreview{
+		ID:         previewID,
+		TrainingID: trainingID,
+		Status:     previewStarting,
+		StartedAt:  now,
+		ExpiresAt:  now.Add(previewTTL),
+		pending:    make(map[string]chan previewReply),
+	}
+	agent.preview = preview
+	snapshot := *preview
+	agent.mu.Unlock()
+
+	if err := agent.SendMessage(map[string]interface{}{
+		"type": "preview_start",
+		"data": map[string]interface{}{
+			"preview_id":  previewID,
+			"training_id": trainingID,
+			"ttl_seconds": int(previewTTL.Seconds()),
+		},
+	}); err != nil {
+		agent.mu.Lock()
+		if agent.preview == preview {
+			agent.preview = nil
+		}
+		agent.mu.Unlock()
+		log.Printf("❌ Failed to ask the agent of %s for a preview: %v", userEmail, err)
+		return agentPreview{}, errPreviewNoContact
+	}
+	log.Printf("🔮 Preview of training %s requested from the agent of %s", trainingID, userEmail)
+	return snapshot, nil
+}
+
+// PredictWithAgentPreview relays inputs to the model the user's agent is previewing and waits for its outputs
+func PredictWithAgentPreview(ctx context.Context, userEmail string, inputs interface{}) (interface{}, error) {
+	agent := agentOfUser(userEmail)
+	if agent == nil {
+		return nil, errNoAgent
+	}
+	requestID, err := helpers.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := make(chan previewReply, 1)
+	agent.mu.Lock()
+	preview := agent.activePreview()
+	if preview == nil || preview.Status != previewReady {
+		agent.mu.Unlock()
+		return nil, errNoPreview
+	}
+	preview.pending[requestID] = reply
+	preview.ExpiresAt = time.Now().Add(previewTTL)
+	previewID := preview.ID
+	agent.mu.Unlock()
+
+	forget := func() {
+		agent.mu.Lock()
+		if agent.preview != nil {
+			delete(agent.preview.pending, requestID)
+		}
+		agent.mu.Unlock()
+	}
+
+	if err := agent.SendMessage(map[string]interface{}{
+		"type": "preview_predict",
+		"data": map[string]interface{}{
+			"preview_id": previewID,
+			"request_id": requestID,
+			"inputs":     inputs,
+		},
+	}); err != nil {
+		forget()
+		log.Printf("❌ Failed to relay a prediction to the agent of %s: %v", userEmail, err)
+		return nil, errPreviewNoContact
+	}
+
+	select {
+	case result := <-reply:
+		if result.Error != "" {
+			return nil, fmt.Errorf("prediction failed: %s", result.Error)
+		}
+		return result.Outputs, nil
+	case <-time.After(previewPredictionTimeout):
+		forget()
+		return nil, errPreviewTimeout
+	case <-ctx.Done():
+		forget()
+		return nil, ctx.Err()
+	}
+}
+
+// StopAgentPreview ends the preview session of the user's agent and asks it to unload the model
+func StopAgentPreview(userEmail string) {
+	agent := agentOfUser(userEmail)
+	if agent == nil {
+		return
+	}
+
+	agent.mu.Lock()
+	previewID := ""
+	if agent.preview != nil {
+		previewID = agent.preview.ID
+	}
+	agent.endPreview()
+	agent.mu.Unlock()
+
+	if previewID == "" {
+		return
+	}
+	if err := agent.SendMessage(map[string]interface{}{
+		"type": "preview_stop",
+		"data": map[string]interface{}{"preview_id": previewID},
+	}); err != nil {
+		log.Printf("⚠️  Failed to stop the preview on the agent of %s: %v", userEmail, err)
+	}
+}
+
+// StartAgentPreviewHandler starts a preview session for {"training_id": ...} on the user's agent
+func StartAgentPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		TrainingID string `json:"training_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TrainingID == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "training_id is required")
+		return
+	}
+
+	preview, err := StartAgentPreview(userEmail, req.TrainingID)
+	if errors.Is(err, errPreviewNoContact) {
+		apierrors.Respond(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if err != nil {
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"preview": preview,
+	})
+}
+
+// GetAgentPreviewHandler returns the preview session of the user's agent, if any
+func GetAgentPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var preview *agentPreview
+	if agent := agentOfUser(userEmail); agent != nil {
+		agent.mu.Lock()
+		if p := agent.activePreview(); p != nil {
+			copied := *p
+			preview = &copied
+		}
+		agent.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"preview": preview,
+	})
+}
+
+// AgentPreviewPredictHandler relays {"inputs": ...} to the model the user's agent is previewing
+// and returns its outputs
+func AgentPreviewPredictHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Inputs interface{} `json:"inputs"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPreviewInputSize)).Decode(&req); err != nil || req.Inputs == nil {
+		apierrors.Respond(w, http.StatusBadRequest, "inputs are required")
+		return
+	}
+
+	outputs, err := PredictWithAgentPreview(r.Context(), userEmail, req.Inputs)
+	switch {
+	case errors.Is(err, errNoAgent), errors.Is(err, errNoPreview):
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, errPreviewTimeout):
+		apierrors.Respond(w, http.StatusGatewayTimeout, err.Error())
+		return
+	case errors.Is(err, context.Canceled):
+		return
+	case err != nil:
+		apierrors.Respond(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"outputs": outputs,
+	})
+}
+
+// StopAgentPreviewHandler ends the preview session of the user's agent
+func StopAgentPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	StopAgentPreview(userEmail)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
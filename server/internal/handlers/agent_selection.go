@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"server/aiAgent"
+	"server/internal/ws"
+)
+
+// agentNamePattern is what agents may send as agent_id in their handshake
+var agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var (
+	errAgentNotConnected = errors.New("agent is not connected")
+	errNoSuitableAgent   = errors.New("no connected agent has the hardware this training needs")
+)
+
+// validAgentName reports whether name can identify an agent
+func validAgentName(name string) bool {
+	return agentNamePattern.MatchString(name)
+}
+
+// add registers a connected agent, returning the connection it replaces under the same name, if any
+func (m *AgentManager) add(ac *AgentConnection) *AgentConnection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	agents := m.agents[ac.UserEmail]
+	if agents == nil {
+		agents = make(map[string]*AgentConnection)
+		m.agents[ac.UserEmail] = agents
+	}
+	replaced := agents[ac.Name]
+	agents[ac.Name] = ac
+	return replaced
+}
+
+// remove unregisters a disconnected agent unless a newer connection replaced it, and reports
+// whether it did
+func (m *AgentManager) remove(ac *AgentConnection) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	agents := m.agents[ac.UserEmail]
+	if agents[ac.Name] != ac {
+		return false
+	}
+	delete(agents, ac.Name)
+	if len(agents) == 0 {
+		delete(m.agents, ac.UserEmail)
+	}
+	return true
+}
+
+// all returns every connected agent
+func (m *AgentManager) all() []*AgentConnection {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	all := []*AgentConnection{}
+	for _, agents := range m.agents {
+		for _, ac := range agents {
+			all = append(all, ac)
+		}
+	}
+	return all
+}
+
+// userAgents returns the connected agents of a user sorted by name
+func userAgents(userEmail string) []*AgentConnection {
+	agentManager.mu.RLock()
+	agents := make([]*AgentConnection, 0, len(agentManager.agents[userEmail]))
+	for _, ac := range agentManager.agents[userEmail] {
+		agents = append(agents, ac)
+	}
+	agentManager.mu.RUnlock()
+
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
+
+// alive reports whether the agent answered pings recently. The caller holds ac.mu.
+func (ac *AgentConnection) alive() bool {
+	return time.Since(ac.LastPing) < 2*time.Minute
+}
+
+// idle reports whether the agent can take a training now. The caller holds ac.mu.
+func (ac *AgentConnection) idle() bool {
+	return !ac.IsTraining && ac.queuedTrainingID == "" && !ac.benchmarking()
+}
+
+// displayName is the name the agent is stored and shown under: its agent_id, or the hostname it
+// reported when it sent none. The caller holds ac.mu.
+func (ac *AgentConnection) displayName() string {
+	if ac.Name != "" {
+		return ac.Name
+	}
+	return agentName(ac.SystemInfo)
+}
+
+// selectAgent returns the user's connected agent named name. Without a name it prefers idle
+// agents, then the ones with the most GPUs, then the best benchmark score.
+func selectAgent(userEmail, name string) (*AgentConnection, error) {
+	agent, _, err := rankAgents(userEmail, name, nil)
+	return agent, err
+}
+
+// rankAgents selects an agent like selectAgent among the ones whose hardware meets needs, when
+// set, and returns why the agents left out cannot run the training
+func rankAgents(userEmail, name string, needs *aiAgent.HardwareRequirements) (*AgentConnection, map[string]string, error) {
+	type candidate struct {
+		agent *AgentConnection
+		idle  bool
+		gpus  int
+		score float64
+		name  string
+	}
+
+	candidates := []candidate{}
+	rejected := map[string]string{}
+	connected := false
+	for _, ac := range userAgents(userEmail) {
+		ac.mu.Lock()
+		if ac.alive() && (name == "" || ac.Name == name || ac.displayName() == name) {
+			connected = true
+			if !slices.Contains(ac.Scopes, APIKeyScopeStartTraining) {
+				rejected[ac.displayName()] = fmt.Sprintf("its API key lacks the %s scope", APIKeyScopeStartTraining)
+				ac.mu.Unlock()
+				continue
+			}
+			if needs != nil {
+				if err := ac.Hardware.Satisfies(*needs); err != nil {
+					rejected[ac.displayName()] = err.Error()
+					ac.mu.Unlock()
+					continue
+				}
+			}
+			c := candidate{agent: ac, idle: ac.idle(), gpus: ac.Hardware.GPUCount, name: ac.displayName()}
+			if ac.Benchmark != nil {
+				c.score = ac.Benchmark.Score
+			}
+			candidates = append(candidates, c)
+		}
+		ac.mu.Unlock()
+	}
+	if len(candidates) == 0 {
+		switch {
+		case connected:
+			return nil, rejected, errNoSuitableAgent
+		case name != "":
+			return nil, rejected, fmt.Errorf("%w: %s", errAgentNotConnected, name)
+		}
+		return nil, rejected, errNoAgent
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.idle != b.idle {
+			return a.idle
+		}
+		if a.gpus != b.gpus {
+			return a.gpus > b.gpus
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.name < b.name
+	})
+	return candidates[0].agent, rejected, nil
+}
+
+// agentStatus describes one of the user's connected agents
+type agentStatus struct {
+	AgentID    string                   `json:"agent_id"`
+	Status     string                   `json:"status"`
+	TrainingID string                   `json:"training_id,omitempty"`
+	Hardware   aiAgent.AgentHardware    `json:"hardware"`
+	SystemInfo map[string]interface{}   `json:"system_info"`
+	Benchmark  *aiAgent.BenchmarkResult `json:"benchmark"`
+	LastPing   time.Time                `json:"last_ping"`
+}
+
+// broadcastStatus sends the agent's current status to its user's clients
+func (ac *AgentConnection) broadcastStatus() {
+	ac.mu.Lock()
+	status := ac.status()
+	ac.mu.Unlock()
+	ws.BroadcastAgentStatus(ac.UserID, map[string]interface{}{
+		"connected":    true,
+		"status":       status.Status,
+		"agent_id":     ac.Name,
+		"training_id":  status.TrainingID,
+		"system_info":  status.SystemInfo,
+		"last_seen_at": time.Now(),
+	})
+}
+
+// status returns the agent's status. The caller holds ac.mu.
+func (ac *AgentConnection) status() agentStatus {
+	status, trainingID := "connected", ""
+	if ac.IsTraining {
+		status, trainingID = "training", ac.TrainingID
+	} else if ac.benchmarking() {
+		status = "benchmarking"
+	}
+	return agentStatus{
+		AgentID:    ac.displayName(),
+		Status:     status,
+		TrainingID: trainingID,
+		Hardware:   ac.Hardware,
+		SystemInfo: ac.SystemInfo,
+		Benchmark:  ac.Benchmark,
+		LastPing:   ac.LastPing,
+	}
+}
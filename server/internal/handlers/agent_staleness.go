@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Agent staleness environment variables.
+// AGENT_STALE_AFTER_DAYS hides agents not seen for that many days from selection lists (14 by default).
+// AGENT_OFFLINE_ALERT_MINUTES is how long an agent may stay offline with a queued or running
+// training before its user is notified (10 by default). AGENT_PURGE_AFTER_DAYS forgets agents not
+// seen for that many days with their inventory (90 by default, 0 never purges).
+// Users can override the first two with PUT /agents/staleness-policy.
+const (
+	AgentStaleAfterDaysEnv      = "AGENT_STALE_AFTER_DAYS"
+	AgentOfflineAlertMinutesEnv = "AGENT_OFFLINE_ALERT_MINUTES"
+	AgentPurgeAfterDaysEnv      = "AGENT_PURGE_AFTER_DAYS"
+)
+
+const (
+	defaultAgentStaleAfterDays      = 14
+	defaultAgentOfflineAlertMinutes = 10
+	defaultAgentPurgeAfterDays      = 90
+	// agentLastSeenInterval is how often a connected agent's last seen time is stored
+	agentLastSeenInterval = 5 * time.Minute
+)
+
+// agentStalenessPolicy is when a user's agents count as stale and when they are told about an
+// offline agent holding a training. OfflineAlertMinutes 0 disables the alert.
+type agentStalenessPolicy struct {
+	StaleAfterDays      int `json:"stale_after_days"`
+	OfflineAlertMinutes int `json:"offline_alert_minutes"`
+}
+
+// defaultAgentStalenessPolicy returns the deployment's staleness policy
+func defaultAgentStalenessPolicy() agentStalenessPolicy {
+	policy := agentStalenessPolicy{StaleAfterDays: envInt(AgentStaleAfterDaysEnv, defaultAgentStaleAfterDays)}
+	if os.Getenv(AgentOfflineAlertMinutesEnv) != "0" {
+		policy.OfflineAlertMinutes = envInt(AgentOfflineAlertMinutesEnv, defaultAgentOfflineAlertMinutes)
+	}
+	return policy
+}
+
+// userAgentStalenessPolicy returns the user's staleness policy, the deployment's where they kept it
+func userAgentStalenessPolicy(ctx context.Context, userID int) agentStalenessPolicy {
+	policy := defaultAgentStalenessPolicy()
+	row, err := repository.GetAgentStalenessPolicy(ctx, userID)
+	if err != nil {
+		log.Printf("⚠️  Failed to get the agent staleness policy of user %d: %v", userID, err)
+		return policy
+	}
+	if days := getIntField(row, "agent_stale_after_days", 0); days > 0 {
+		policy.StaleAfterDays = days
+	}
+	if minutes, ok := row["agent_offline_alert_minutes"]; ok && minutes != nil {
+		policy.OfflineAlertMinutes = getIntField(row, "agent_offline_alert_minutes", policy.OfflineAlertMinutes)
+	}
+	return policy
+}
+
+// annotateAgentSeen sets last_seen_at and stale on a stored agent. Connected agents are seen now.
+func annotateAgentSeen(agent map[string]interface{}, connected bool, policy agentStalenessPolicy, now time.Time) {
+	agent["connected"] = connected
+	if connected {
+		agent["last_seen_at"] = now
+	}
+	lastSeen, _ := agent["last_seen_at"].(time.Time)
+	agent["stale"] = !connected && now.Sub(lastSeen) > time.Duration(policy.StaleAfterDays)*24*time.Hour
+}
+
+// touchLastSeen stores that the agent is still connected, at most every agentLastSeenInterval
+// unless force is set
+func (ac *AgentConnection) touchLastSeen(force bool) {
+	ac.mu.Lock()
+	agentID := ac.AgentID
+	due := force || time.Since(ac.lastSeenSaved) >= agentLastSeenInterval
+	if agentID != 0 && due {
+		ac.lastSeenSaved = time.Now()
+	}
+	ac.mu.Unlock()
+	if agentID == 0 || !due {
+		return
+	}
+	if err := repository.TouchAgent(context.Background(), agentID); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+}
+
+// heldTrainings returns the training queued on the agent and the one it is running. The caller
+// must hold ac.mu.
+func (ac *AgentConnection) heldTrainings() []string {
+	trainings := []string{}
+	if ac.queuedTrainingID != "" {
+		trainings = append(trainings, ac.queuedTrainingID)
+	}
+	if ac.IsTraining && ac.TrainingID != "" && ac.TrainingID != ac.queuedTrainingID {
+		trainings = append(trainings, ac.TrainingID)
+	}
+	return trainings
+}
+
+// alertOfflineTrainings notifies the user when their agent disconnected with a queued or running
+// training and is not back after their offline alert delay
+func (ac *AgentConnection) alertOfflineTrainings() {
+	ac.mu.Lock()
+	trainings := ac.heldTrainings()
+	name := ac.displayName()
+	ac.mu.Unlock()
+	if len(trainings) == 0 {
+		return
+	}
+
+	policy := userAgentStalenessPolicy(context.Background(), ac.UserID)
+	if policy.OfflineAlertMinutes == 0 {
+		return
+	}
+	delay := time.Duration(policy.OfflineAlertMinutes) * time.Minute
+	disconnectedAt := time.Now()
+
+	time.AfterFunc(delay, func() {
+		if _, err := selectAgent(ac.UserEmail, name); err == nil {
+			return
+		}
+		log.Printf("📴 Agent %s of %s offline with trainings %v", name, ac.UserEmail, trainings)
+		notifyUser(context.Background(), ac.UserID, Notification{
+			Type:  NotificationAgentOffline,
+			Title: "Your training agent is offline",
+			Message: fmt.Sprintf("%s disconnected at %s while holding %d training(s). Restart the agent to continue, or start them again on the server.",
+				name, disconnectedAt.UTC().Format(time.RFC1123), len(trainings)),
+			Link: "/agents",
+			Data: map[string]interface{}{
+				"agent_name":      name,
+				"training_ids":    trainings,
+				"disconnected_at": disconnectedAt,
+			},
+		}, "", "")
+	})
+}
+
+// StartAgentPurge forgets agents not seen for AGENT_PURGE_AFTER_DAYS now and once a day
+func StartAgentPurge() {
+	if os.Getenv(AgentPurgeAfterDaysEnv) == "0" {
+		log.Printf("ℹ️  Stale agent purge disabled")
+		return
+	}
+	days := envInt(AgentPurgeAfterDaysEnv, defaultAgentPurgeAfterDays)
+	go func() {
+		for {
+			deleted, err := repository.PurgeStaleAgents(context.Background(), time.Now().AddDate(0, 0, -days))
+			if err != nil {
+				log.Printf("⚠️  %v", err)
+			} else if deleted > 0 {
+				log.Printf("🧹 Forgot %d agents not seen for %d days", deleted, days)
+			}
+			time.Sleep(24 * time.Hour)
+		}
+	}()
+}
+
+// GetAgentStalenessPolicyHandler returns the user's agent staleness policy and the deployment's defaults
+func GetAgentStalenessPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"policy":   userAgentStalenessPolicy(r.Context(), userID),
+		"defaults": defaultAgentStalenessPolicy(),
+	})
+}
+
+// UpdateAgentStalenessPolicyHandler sets the user's agent staleness policy.
+// {"stale_after_days": 30, "offline_alert_minutes": 0}; null or a missing field restores the default.
+func UpdateAgentStalenessPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		StaleAfterDays      *int `json:"stale_after_days"`
+		OfflineAlertMinutes *int `json:"offline_alert_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.StaleAfterDays != nil && (*req.StaleAfterDays < 1 || *req.StaleAfterDays > 3650) {
+		apierrors.Respond(w, http.StatusBadRequest, "stale_after_days must be between 1 and 3650")
+		return
+	}
+	if req.OfflineAlertMinutes != nil && (*req.OfflineAlertMinutes < 0 || *req.OfflineAlertMinutes > 7*24*60) {
+		apierrors.Respond(w, http.StatusBadRequest, "offline_alert_minutes must be between 0 and 10080")
+		return
+	}
+
+	if err := repository.SetAgentStalenessPolicy(r.Context(), userID, req.StaleAfterDays, req.OfflineAlertMinutes); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update staleness policy")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"policy":  userAgentStalenessPolicy(r.Context(), userID),
+	})
+}
+
+// DeleteAgentHandler forgets one of the user's agents and its inventory. Connected agents cannot
+// be deleted; the machine registers again the next time it connects.
+func DeleteAgentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, agentID, _, ok := userAgentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if connectedAgent(userID, agentID) != nil {
+		apierrors.Respond(w, http.StatusConflict, "Agent is connected, stop it before deleting it")
+		return
+	}
+
+	if _, err := repository.DeleteAgent(r.Context(), agentID, userID); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to delete agent")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
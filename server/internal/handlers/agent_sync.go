@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// agentSyncGrant lets the agent running a training download the model folder it trains on
+type agentSyncGrant struct {
+	UserID int
+	Folder string // Absolute path of the model folder on the server
+}
+
+// agentSyncGrants holds the folders agent trainings may sync until they finish
+var agentSyncGrants sync.Map // training ID -> agentSyncGrant
+
+// syncManifestEntry is a file of a model folder, as the agent compares it with its copy
+type syncManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Mode   uint32 `json:"mode"`
+}
+
+// fileHashCache keeps the checksums of model files so repeated syncs only hash changed files
+var fileHashCache = struct {
+	sync.Mutex
+	entries map[string]cachedFileHash
+}{entries: map[string]cachedFileHash{}}
+
+type cachedFileHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// syncSkippedDirs are folders never sent to agents
+var syncSkippedDirs = map[string]bool{".git": true, "__pycache__": true, ".ipynb_checkpoints": true}
+
+// fileSHA256 returns the checksum of a file, reusing the cached one while its size and mtime are unchanged
+func fileSHA256(path string, info fs.FileInfo) (string, error) {
+	fileHashCache.Lock()
+	cached, ok := fileHashCache.entries[path]
+	fileHashCache.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	fileHashCache.Lock()
+	fileHashCache.entries[path] = cachedFileHash{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	fileHashCache.Unlock()
+	return sum, nil
+}
+
+// buildSyncManifest lists the regular files of a model folder with their checksums. Symlinks
+// and caches are skipped.
+func buildSyncManifest(folder string) ([]syncManifestEntry, error) {
+	entries := []syncManifestEntry{}
+	err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != folder && syncSkippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(path, info)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, syncManifestEntry{
+			Path:   filepath.ToSlash(rel),
+			Size:   info.Size(),
+			SHA256: sum,
+			Mode:   uint32(info.Mode().Perm()),
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// grantAgentSync lets the agent of a training sync its model folder and returns the sync
+// instructions sent with the train command, or nil if the folder is not on the server
+func grantAgentSync(trainingID string, userID int, folderName string) map[string]interface{} {
+	folder, err := filepath.Abs(filepath.Join(uploadsBaseDir(), folderName))
+	if err != nil {
+		return nil
+	}
+	if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+		return nil
+	}
+	agentSyncGrants.Store(trainingID, agentSyncGrant{UserID: userID, Folder: folder})
+	return map[string]interface{}{
+		"folder":       filepath.Base(folder),
+		"manifest_url": fmt.Sprintf("/v1/agent/sync/%s/manifest", trainingID),
+		"files_url":    fmt.Sprintf("/v1/agent/sync/%s/files/", trainingID),
+	}
+}
+
+// agentSyncGrantFromRequest authenticates the agent by its API key and returns the sync grant
+// of the training in the URL
+func agentSyncGrantFromRequest(w http.ResponseWriter, r *http.Request) (agentSyncGrant, bool) {
+	apiKey := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if apiKey == "" {
+		apierrors.Respond(w, http.StatusUnauthorized, "API key required")
+		return agentSyncGrant{}, false
+	}
+	user, err := repository.GetUserByApiKey(r.Context(), apiKey)
+	if err != nil || user == nil {
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid API key")
+		return agentSyncGrant{}, false
+	}
+	if !apiKeyHasScope(*user, APIKeyScopeAgentConnect) {
+		apierrors.Respond(w, http.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", APIKeyScopeAgentConnect))
+		return agentSyncGrant{}, false
+	}
+	userID := getIntField(*user, "id", 0)
+
+	value, ok := agentSyncGrants.Load(chi.URLParam(r, "trainingId"))
+	if !ok || value.(agentSyncGrant).UserID != userID {
+		apierrors.Respond(w, http.StatusNotFound, "No folder to sync for this training")
+		return agentSyncGrant{}, false
+	}
+	return value.(agentSyncGrant), true
+}
+
+// AgentSyncManifestHandler lists the files of the model folder a training syncs, with their
+// checksums, so the agent only downloads files that differ from its copy
+func AgentSyncManifestHandler(w http.ResponseWriter, r *http.Request) {
+	grant, ok := agentSyncGrantFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := buildSyncManifest(grant.Folder)
+	if err != nil {
+		log.Printf("❌ Failed to build sync manifest of %s: %v", grant.Folder, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to list model folder")
+		return
+	}
+	var totalBytes int64
+	for _, entry := range entries {
+		totalBytes += entry.Size
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"files":       entries,
+		"total_bytes": totalBytes,
+	})
+}
+
+// AgentSyncFileHandler serves one file of the model folder a training syncs
+func AgentSyncFileHandler(w http.ResponseWriter, r *http.Request) {
+	grant, ok := agentSyncGrantFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rel := filepath.FromSlash(chi.URLParam(r, "*"))
+	path := filepath.Join(grant.Folder, rel)
+	if rel == "" || !strings.HasPrefix(path, grant.Folder+string(filepath.Separator)) {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid file path")
+		return
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if syncSkippedDirs[part] {
+			apierrors.Respond(w, http.StatusNotFound, "File not found")
+			return
+		}
+	}
+	// Symlinks are not synced, so neither the file nor a folder on its way may be one
+	realFolder, err := filepath.EvalSymlinks(grant.Folder)
+	if err != nil {
+		apierrors.Respond(w, http.StatusNotFound, "File not found")
+		return
+	}
+	if real, err := filepath.EvalSymlinks(path); err != nil || real != filepath.Join(realFolder, rel) {
+		apierrors.Respond(w, http.StatusNotFound, "File not found")
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		apierrors.Respond(w, http.StatusNotFound, "File not found")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		apierrors.Respond(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	if sum, err := fileSHA256(path, info); err == nil {
+		w.Header().Set("X-Content-SHA256", sum)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
@@ -7,12 +7,12 @@ import (
 	"log"
 	"net/http"
 	"regexp"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/metricparse"
 	"server/internal/middlewares"
 	"server/internal/repository"
 	"server/internal/ws"
@@ -30,24 +30,47 @@ var upgrader = websocket.Upgrader{
 
 // AgentConnection represents a connected training agent
 type AgentConnection struct {
-	Conn       *websocket.Conn
-	UserEmail  string
-	ApiKey     string
+	Conn      *websocket.Conn
+	UserEmail string
+	// Name tells the agent apart from the user's other agents, from agent_id in the handshake.
+	// Agents that sent none share the empty name, so only one of them stays connected.
+	Name   string
+	ApiKey string
+	// Scopes are the scopes of the API key the agent connected with
+	Scopes     []string
 	LastPing   time.Time
 	IsTraining bool
+	TrainingID string // Training the agent is running, if any
 	SystemInfo map[string]interface{}
-	UserID     int
-	mu         sync.Mutex
+	// Hardware is the typed form of SystemInfo that placement decisions use
+	Hardware aiAgent.AgentHardware
+	UserID   int
+	mu       sync.Mutex
+
+	// AgentID identifies the machine among the user's agents once it reported its system info
+	AgentID int
+	// lastSeenSaved is when the agent's last seen time was last stored
+	lastSeenSaved time.Time
+	// queuedTrainingID is the training sent to the agent that it has not reported started yet
+	queuedTrainingID string
+
+	// Benchmark is the agent's latest benchmark result, if it ever ran one
+	Benchmark          *aiAgent.BenchmarkResult
+	IsBenchmarking     bool
+	benchmarkStartedAt time.Time
+
+	// preview is the inference session the agent hosts for the web UI, if any
+	preview *agentPreview
 }
 
 // AgentManager manages all connected agents
 type AgentManager struct {
-	agents map[string]*AgentConnection // key: user email
+	agents map[string]map[string]*AgentConnection // key: user email, then agent name
 	mu     sync.RWMutex
 }
 
 var agentManager = &AgentManager{
-	agents: make(map[string]*AgentConnection),
+	agents: make(map[string]map[string]*AgentConnection),
 }
 
 // Global trainer reference for storing remote training progress
@@ -71,7 +94,7 @@ func AgentWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	apiKey := r.URL.Query().Get("api_key")
 	if apiKey == "" {
 		log.Printf("❌ Connection rejected: No API key provided")
-		http.Error(w, "API key required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "API key required")
 		return
 	}
 
@@ -82,23 +105,35 @@ func AgentWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("🔑 Validating API key: %s", apiKeyPrefix)
 
+	agentID := r.URL.Query().Get("agent_id")
+	if agentID != "" && !validAgentName(agentID) {
+		log.Printf("❌ Connection rejected: Invalid agent ID %q", agentID)
+		apierrors.Respond(w, http.StatusBadRequest, "agent_id must be 1 to 64 letters, digits, dots, dashes or underscores")
+		return
+	}
+
 	// Validate API key and get user
 	user, err := repository.GetUserByApiKey(context.Background(), apiKey)
 	if err != nil {
 		log.Printf("❌ Database error while validating API key: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 	if user == nil {
 		log.Printf("❌ Invalid API key - no user found")
-		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+	if !apiKeyHasScope(*user, APIKeyScopeAgentConnect) {
+		log.Printf("❌ Connection rejected: API key lacks the %s scope", APIKeyScopeAgentConnect)
+		apierrors.Respond(w, http.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", APIKeyScopeAgentConnect))
 		return
 	}
 
 	userEmail, ok := (*user)["email"].(string)
 	if !ok {
 		log.Printf("❌ User email not found in database result")
-		http.Error(w, "Invalid user data", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Invalid user data")
 		return
 	}
 
@@ -112,7 +147,7 @@ func AgentWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 			userID = int(id32)
 		} else {
 			log.Printf("❌ Could not convert user ID to int")
-			http.Error(w, "Invalid user ID", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Invalid user ID")
 			return
 		}
 	}
@@ -128,7 +163,9 @@ func AgentWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	agent := &AgentConnection{
 		Conn:       conn,
 		UserEmail:  userEmail,
+		Name:       agentID,
 		ApiKey:     apiKey,
+		Scopes:     userAPIKeyScopes(*user),
 		LastPing:   time.Now(),
 		IsTraining: false,
 		SystemInfo: nil,
@@ -136,17 +173,19 @@ func AgentWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Register agent
-	agentManager.mu.Lock()
-	agentManager.agents[userEmail] = agent
-	agentManager.mu.Unlock()
+	if replaced := agentManager.add(agent); replaced != nil {
+		log.Printf("⚠️  Agent %q of %s replaced by a new connection", agentID, userEmail)
+	}
 
-	log.Printf("✅ Agent connected: %s", userEmail)
+	log.Printf("✅ Agent connected: %s (%q)", userEmail, agentID)
 
 	// Broadcast agent connected status to all WebSocket clients for this user
 	ws.BroadcastAgentStatus(userID, map[string]interface{}{
-		"connected":   true,
-		"status":      "connected",
-		"system_info": nil, // Will be updated when system_info arrives
+		"connected":    true,
+		"status":       "connected",
+		"agent_id":     agentID,
+		"system_info":  nil, // Will be updated when system_info arrives
+		"last_seen_at": time.Now(),
 	})
 
 	// Send welcome message
@@ -179,17 +218,27 @@ func AgentWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 func (ac *AgentConnection) HandleMessages() {
 	defer func() {
 		// Cleanup on disconnect
-		agentManager.mu.Lock()
-		delete(agentManager.agents, ac.UserEmail)
-		agentManager.mu.Unlock()
+		removed := agentManager.remove(ac)
 		ac.Conn.Close()
-		log.Printf("👋 Agent disconnected: %s", ac.UserEmail)
+		log.Printf("👋 Agent disconnected: %s (%q)", ac.UserEmail, ac.Name)
 
-		// Broadcast agent disconnected status
+		ac.mu.Lock()
+		ac.endPreview()
+		ac.mu.Unlock()
+
+		ac.touchLastSeen(true)
+		ac.alertOfflineTrainings()
+
+		// Broadcast agent disconnected status, unless a new connection of the agent already took over
+		if !removed {
+			return
+		}
 		ws.BroadcastAgentStatus(ac.UserID, map[string]interface{}{
-			"connected":   false,
-			"status":      "disconnected",
-			"system_info": nil,
+			"connected":    IsAgentConnected(ac.UserEmail),
+			"status":       "disconnected",
+			"agent_id":     ac.Name,
+			"system_info":  nil,
+			"last_seen_at": time.Now(),
 		})
 	}()
 
@@ -245,23 +294,72 @@ func (ac *AgentConnection) HandleMessages() {
 			ac.mu.Lock()
 			if dataMap, ok := data.(map[string]interface{}); ok {
 				ac.SystemInfo = dataMap
+				ac.Hardware = aiAgent.ParseAgentHardware(dataMap)
 			}
 			ac.mu.Unlock()
 
 			// Broadcast updated agent status with system info
-			ws.BroadcastAgentStatus(ac.UserID, map[string]interface{}{
-				"connected":   true,
-				"status":      "connected",
-				"system_info": data,
+			ac.broadcastStatus()
+
+			// The agent's name or hostname identifies it, so it can be registered and its stored benchmark loaded now
+			ac.register()
+			ac.loadLatestBenchmark()
+
+		case "inventory":
+			ac.saveInventory(msg["data"])
+
+		case "artifact_uploaded":
+			path, _ := msg["path"].(string)
+			serverPath, _ := msg["server_path"].(string)
+			ac.artifactUploaded(path, serverPath)
+
+		case "artifact_upload_failed":
+			path, _ := msg["path"].(string)
+			errorMessage, _ := msg["error"].(string)
+			log.Printf("❌ Agent failed to upload %s: %s", path, errorMessage)
+			ws.BroadcastToUser(ac.UserID, map[string]interface{}{
+				"type": "agent_artifact_upload",
+				"data": map[string]interface{}{
+					"agent_id":      ac.AgentID,
+					"path":          path,
+					"status":        "failed",
+					"error_message": errorMessage,
+				},
 			})
 
-		case "training_started":
+		case "benchmark_result":
+			ac.saveBenchmark(msg["data"])
+
+		case "benchmark_failed":
 			ac.mu.Lock()
-			ac.IsTraining = true
+			ac.IsBenchmarking = false
 			ac.mu.Unlock()
+			errorMessage, _ := msg["error"].(string)
+			log.Printf("❌ Agent benchmark failed for %s: %s", ac.UserEmail, errorMessage)
+			ws.BroadcastToUser(ac.UserID, map[string]interface{}{
+				"type": "agent_benchmark",
+				"data": map[string]interface{}{
+					"status":        "failed",
+					"error_message": errorMessage,
+				},
+			})
+
+		case "preview_ready", "preview_failed", "preview_stopped":
+			ac.previewUpdate(msgType, msg)
+
+		case "preview_prediction":
+			ac.previewPrediction(msg)
+
+		case "training_started":
 			trainingIDInterface := msg["training_id"]
 			trainingID, _ := trainingIDInterface.(string)
+			ac.mu.Lock()
+			ac.IsTraining = true
+			ac.TrainingID = trainingID
+			ac.clearQueuedTraining(trainingID)
+			ac.mu.Unlock()
 			log.Printf("🚀 Training started: %v", trainingID)
+			ac.broadcastStatus()
 
 			// Create training progress entry in trainer
 			if globalTrainer != nil && trainingID != "" {
@@ -299,12 +397,24 @@ func (ac *AgentConnection) HandleMessages() {
 				},
 			})
 
+		case "training_resources":
+			trainingID, _ := msg["training_id"].(string)
+			resources, _ := msg["resources"].(map[string]interface{})
+			if globalTrainer != nil && trainingID != "" && resources != nil {
+				// AddResourceSample streams the sample to the training's viewers
+				if progress, err := globalTrainer.GetProgress(trainingID); err == nil {
+					progress.AddResourceSample(aiAgent.ParseResourceSample(resources))
+				}
+			}
+
 		case "training_completed":
+			trainingIDInterface := msg["training_id"]
+			trainingID, _ := trainingIDInterface.(string)
 			ac.mu.Lock()
 			ac.IsTraining = false
+			ac.clearQueuedTraining(trainingID)
 			ac.mu.Unlock()
-			trainingIDInterface := msg["training_id"]
-			trainingID, _ := trainingIDInterface.(string)
+			ac.broadcastStatus()
 			modelPathInterface := msg["model_path"]
 			modelPath, _ := modelPathInterface.(string)
 			log.Printf("✅ Training completed: %v", trainingID)
@@ -312,11 +422,21 @@ func (ac *AgentConnection) HandleMessages() {
 				log.Printf("💾 Trained model path: %v", modelPath)
 			}
 
+			agentSyncGrants.Delete(trainingID)
+
 			// Mark training as completed and update database with model path
 			if globalTrainer != nil && trainingID != "" {
 				markRemoteTrainingCompleted(trainingID, modelPath)
 			}
 
+			// Store the environment the agent trained in
+			if environment, ok := msg["environment"]; ok && environment != nil && trainingID != "" {
+				saveRemoteEnvironment(trainingID, environment)
+			}
+			if export, ok := msg["onnx_export"]; ok && export != nil && trainingID != "" {
+				saveRemoteONNXExport(trainingID, export)
+			}
+
 			// Broadcast training completed to frontend
 			ws.BroadcastToUser(ac.UserID, map[string]interface{}{
 				"type": "training_update",
@@ -325,19 +445,39 @@ func (ac *AgentConnection) HandleMessages() {
 					"status":      "completed",
 					"message":     "Training completed successfully!",
 					"model_path":  modelPath,
+					"onnx_export": msg["onnx_export"],
 				},
 			})
 
 		case "training_failed":
+			trainingIDInterface := msg["training_id"]
+			trainingID, _ := trainingIDInterface.(string)
 			ac.mu.Lock()
 			ac.IsTraining = false
+			ac.clearQueuedTraining(trainingID)
 			ac.mu.Unlock()
-			trainingIDInterface := msg["training_id"]
-			trainingID, _ := trainingIDInterface.(string)
+			ac.broadcastStatus()
 			errorInterface := msg["error"]
 			error, _ := errorInterface.(string)
 			log.Printf("❌ Training failed: %v - %v", trainingID, error)
 
+			agentSyncGrants.Delete(trainingID)
+
+			// Agents that do not know early stops report the stopped script as failed
+			if globalTrainer != nil && trainingID != "" && remoteEarlyStop(trainingID) != nil {
+				log.Printf("🏁 Training %v was stopped early", trainingID)
+				markRemoteTrainingCompleted(trainingID, "")
+				ws.BroadcastToUser(ac.UserID, map[string]interface{}{
+					"type": "training_update",
+					"data": map[string]interface{}{
+						"training_id": trainingID,
+						"status":      "completed",
+						"message":     "Training stopped early",
+					},
+				})
+				break
+			}
+
 			// Mark training as failed
 			if globalTrainer != nil && trainingID != "" {
 				markRemoteTrainingFailed(trainingID, error)
@@ -418,85 +558,147 @@ func (ac *AgentConnection) PingLoop() {
 			return
 		}
 		ac.mu.Unlock()
+		ac.touchLastSeen(false)
 	}
 }
 
-// StartRemoteTraining sends a training command to the user's agent
-func StartRemoteTraining(userEmail string, trainingData map[string]interface{}) error {
-	agentManager.mu.RLock()
-	agent, exists := agentManager.agents[userEmail]
-	agentManager.mu.RUnlock()
-
-	if !exists {
-		return fmt.Errorf("no agent connected for user: %s", userEmail)
+// StartRemoteTraining sends a training command to the user's agent named target, or to their
+// idle agent with the most GPUs when target is empty. It returns the name of the agent it chose.
+func StartRemoteTraining(userEmail, target string, trainingData map[string]interface{}) (string, error) {
+	agent, err := selectAgent(userEmail, target)
+	if err != nil {
+		return "", err
 	}
 
 	agent.mu.Lock()
-	if agent.IsTraining {
+	if agent.IsTraining || agent.queuedTrainingID != "" {
 		agent.mu.Unlock()
-		return fmt.Errorf("agent is already training a model")
+		return "", fmt.Errorf("agent is already training a model")
 	}
+	if agent.benchmarking() {
+		agent.mu.Unlock()
+		return "", fmt.Errorf("agent is running its benchmark, try again once it finishes")
+	}
+	trainingID, _ := trainingData["training_id"].(string)
+	agent.queuedTrainingID = trainingID
+	name := agent.displayName()
 	agent.mu.Unlock()
 
-	return agent.SendMessage(map[string]interface{}{
+	err = agent.SendMessage(map[string]interface{}{
 		"type": "train",
 		"data": trainingData,
 	})
+	if err != nil {
+		agent.mu.Lock()
+		agent.clearQueuedTraining(trainingID)
+		agent.mu.Unlock()
+		return "", err
+	}
+	return name, nil
 }
 
-// IsAgentConnected checks if a user has an agent connected
-func IsAgentConnected(userEmail string) bool {
-	agentManager.mu.RLock()
-	defer agentManager.mu.RUnlock()
+// clearQueuedTraining forgets the queued training once the agent reported it. The caller must hold ac.mu.
+func (ac *AgentConnection) clearQueuedTraining(trainingID string) {
+	if ac.queuedTrainingID == trainingID {
+		ac.queuedTrainingID = ""
+	}
+}
+
+// StopRemoteTraining tells the agent running a training to stop it.
+// It returns false if none of the user's agents is running the training.
+func StopRemoteTraining(userID int, trainingID string) bool {
+	return sendRemoteStop(userID, trainingID, map[string]interface{}{"type": "stop"})
+}
 
-	agent, exists := agentManager.agents[userEmail]
-	if !exists {
+// sendRemoteStop sends a stop message to the agent of userID running a training
+func sendRemoteStop(userID int, trainingID string, message map[string]interface{}) bool {
+	var agent *AgentConnection
+	for _, ac := range agentManager.all() {
+		ac.mu.Lock()
+		running := ac.UserID == userID && ac.IsTraining && ac.TrainingID == trainingID
+		ac.mu.Unlock()
+		if running {
+			agent = ac
+			break
+		}
+	}
+
+	if agent == nil {
+		return false
+	}
+	if err := agent.SendMessage(message); err != nil {
+		log.Printf("⚠️  Failed to stop agent training %s: %v", trainingID, err)
 		return false
 	}
+	return true
+}
 
-	// Check if agent is alive
-	agent.mu.Lock()
-	defer agent.mu.Unlock()
-	return time.Since(agent.LastPing) < 2*time.Minute
+// IsAgentConnected checks if a user has an agent connected
+func IsAgentConnected(userEmail string) bool {
+	for _, agent := range userAgents(userEmail) {
+		agent.mu.Lock()
+		alive := agent.alive()
+		agent.mu.Unlock()
+		if alive {
+			return true
+		}
+	}
+	return false
 }
 
-// GetAgentStatus returns the status of a user's agent
+// GetAgentStatus returns the status of a user's agents. The top-level fields describe the agent
+// trainings go to by default, agents lists every connected one.
 func GetAgentStatusHandler(w http.ResponseWriter, r *http.Request) {
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	isConnected := IsAgentConnected(userEmail)
 
-	var status string
+	status := "disconnected"
 	var systemInfo interface{}
+	var benchmark *aiAgent.BenchmarkResult
+	var name string
 
-	agentManager.mu.RLock()
-	agent, exists := agentManager.agents[userEmail]
-	agentManager.mu.RUnlock()
-
-	if exists && isConnected {
+	agents := []agentStatus{}
+	for _, agent := range userAgents(userEmail) {
 		agent.mu.Lock()
-		status = "connected"
-		if agent.IsTraining {
-			status = "training"
+		if agent.alive() {
+			agents = append(agents, agent.status())
 		}
-		systemInfo = agent.SystemInfo
 		agent.mu.Unlock()
-	} else {
-		status = "disconnected"
 	}
+	if agent, err := selectAgent(userEmail, ""); err == nil {
+		agent.mu.Lock()
+		current := agent.status()
+		agent.mu.Unlock()
+		status, systemInfo, benchmark, name = current.Status, current.SystemInfo, current.Benchmark, current.AgentID
+	}
+
+	log.Printf("📊 Agent status for %s: connected=%v, status=%s, agents=%d", userEmail, isConnected, status, len(agents))
 
-	log.Printf("📊 Agent status for %s: connected=%v, status=%s", userEmail, isConnected, status)
+	// Disconnected agents report when the user's agents were last seen
+	var lastSeen interface{}
+	if isConnected {
+		lastSeen = time.Now()
+	} else if userID, ok := r.Context().Value(middlewares.UserIDKey).(int); ok {
+		if agents, err := repository.GetUserAgents(r.Context(), userID); err == nil && len(agents) > 0 {
+			lastSeen = agents[0]["last_seen_at"]
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":     true,
-		"status":      status,
-		"connected":   isConnected,
-		"system_info": systemInfo,
+		"success":      true,
+		"status":       status,
+		"connected":    isConnected,
+		"agent_id":     name,
+		"system_info":  systemInfo,
+		"benchmark":    benchmark,
+		"last_seen_at": lastSeen,
+		"agents":       agents,
 	})
 }
 
@@ -504,6 +706,7 @@ func GetAgentStatusHandler(w http.ResponseWriter, r *http.Request) {
 
 func createRemoteTrainingProgress(trainingID string, userID int) {
 	progress := &aiAgent.TrainingProgress{
+		TrainingID:  trainingID,
 		UserID:      userID,
 		Status:      aiAgent.StatusRunning,
 		StartTime:   time.Now(),
@@ -512,6 +715,20 @@ func createRemoteTrainingProgress(trainingID string, userID int) {
 		TotalEpochs: 0,
 	}
 
+	if policy, ok := pendingAnomalyPolicies.LoadAndDelete(trainingID); ok {
+		progress.SetAnomalyPolicy(policy.(aiAgent.AnomalyPolicy))
+	}
+	if patterns, ok := pendingMetricPatterns.LoadAndDelete(trainingID); ok {
+		progress.SetMetricPatterns(patterns.([]metricparse.Pattern))
+	}
+	if params, ok := pendingHyperparameters.LoadAndDelete(trainingID); ok {
+		progress.Hyperparameters = params.(map[string]interface{})
+	}
+	if options, ok := pendingEarlyStopping.LoadAndDelete(trainingID); ok {
+		earlyStopping := options.(aiAgent.EarlyStopping)
+		progress.SetEarlyStopping(&earlyStopping)
+	}
+
 	globalTrainer.StoreTrainingProgress(trainingID, progress)
 	log.Printf("📊 Created remote training progress: %s for user %d", trainingID, userID)
 }
@@ -526,41 +743,59 @@ func updateRemoteTrainingProgress(trainingID string, output string) {
 	// Add log
 	progress.AddLog(output)
 
-	// Try to parse PROGRESS JSON lines first (more reliable)
-	if strings.HasPrefix(output, "PROGRESS:") {
-		jsonStr := strings.TrimPrefix(output, "PROGRESS:")
-		jsonStr = strings.TrimSpace(jsonStr)
-		if metrics := parseProgressJSONFromOutput(jsonStr); metrics != nil {
-			progress.AddMetrics(*metrics)
-			log.Printf("📈 Parsed metrics from JSON: Epoch %d/%d, Loss: %.4f, Train Acc: %.2f%%, Test Acc: %.2f%%",
-				metrics.Epoch, metrics.TotalEpochs, metrics.TrainLoss, metrics.TrainAccuracy*100, metrics.TestAccuracy*100)
-			// Store final metrics if:
-			// 1. Status is "completed"
-			// 2. This is the last epoch
-			// 3. Has any accuracy
-			isCompleted := false
-			if metrics.CustomMetrics != nil {
-				if status, ok := metrics.CustomMetrics["status"].(string); ok && status == "completed" {
-					isCompleted = true
-				}
-			}
-			if isCompleted || metrics.TestAccuracy > 0 || metrics.ValAccuracy > 0 || metrics.TrainAccuracy > 0 ||
-				(metrics.Epoch == metrics.TotalEpochs && metrics.TotalEpochs > 0) {
-				progress.SetFinalMetrics(metrics)
-				if isCompleted {
-					log.Printf("📊 Set FinalMetrics (status=completed) with accuracy: Test=%.2f%%, Val=%.2f%%, Train=%.2f%%",
-						metrics.TestAccuracy*100, metrics.ValAccuracy*100, metrics.TrainAccuracy*100)
-				}
-			}
-			return
+	// Checkpoints and artifacts declared by the script
+	if checkpoint, ok := aiAgent.ParseCheckpointLine(output); ok {
+		progress.AddCheckpoint(*checkpoint)
+		log.Printf("💾 Registered checkpoint for %s: %s", trainingID, checkpoint.Path)
+		return
+	}
+	if artifact, ok := aiAgent.ParseArtifactLine(output); ok {
+		progress.AddArtifact(*artifact)
+		log.Printf("📦 Registered %s artifact for %s: %s", artifact.Type, trainingID, artifact.Path)
+		return
+	}
+
+	// PROGRESS lines, then the model's own patterns and the output of known frameworks
+	for _, parsed := range progress.ParseOutput(output) {
+		if parsed.Metrics == nil {
+			addRemoteProgressLine(progress, parsed.Progress)
+			continue
 		}
+		progress.AddMetrics(*parsed.Metrics)
+		log.Printf("📈 Parsed metrics with %s: Epoch %d/%d, Loss: %.4f",
+			parsed.Parser, parsed.Metrics.Epoch, parsed.Metrics.TotalEpochs, parsed.Metrics.TrainLoss)
 	}
+}
 
-	// Try to parse metrics from output using regex patterns
-	if metrics := parseMetricsFromOutput(output); metrics != nil {
-		progress.AddMetrics(*metrics)
-		log.Printf("📈 Parsed metrics: Epoch %d/%d, Loss: %.4f",
-			metrics.Epoch, metrics.TotalEpochs, metrics.TrainLoss)
+// addRemoteProgressLine records the metrics and artifacts of a PROGRESS line of an agent training
+func addRemoteProgressLine(progress *aiAgent.TrainingProgress, jsonStr string) {
+	metrics, artifacts := progress.ParseProgressLine(jsonStr)
+	for _, artifact := range artifacts {
+		progress.AddArtifact(artifact)
+	}
+	if metrics == nil {
+		return
+	}
+	progress.AddMetrics(*metrics)
+	log.Printf("📈 Parsed metrics from JSON: Epoch %d/%d, Loss: %.4f, Train Acc: %.2f%%, Test Acc: %.2f%%",
+		metrics.Epoch, metrics.TotalEpochs, metrics.TrainLoss, metrics.TrainAccuracy*100, metrics.TestAccuracy*100)
+	// Store final metrics if:
+	// 1. Status is "completed"
+	// 2. This is the last epoch
+	// 3. Has any accuracy
+	isCompleted := false
+	if metrics.CustomMetrics != nil {
+		if status, ok := metrics.CustomMetrics["status"].(string); ok && status == "completed" {
+			isCompleted = true
+		}
+	}
+	if isCompleted || metrics.TestAccuracy > 0 || metrics.ValAccuracy > 0 || metrics.TrainAccuracy > 0 ||
+		(metrics.Epoch == metrics.TotalEpochs && metrics.TotalEpochs > 0) {
+		progress.SetFinalMetrics(metrics)
+		if isCompleted {
+			log.Printf("📊 Set FinalMetrics (status=completed) with accuracy: Test=%.2f%%, Val=%.2f%%, Train=%.2f%%",
+				metrics.TestAccuracy*100, metrics.ValAccuracy*100, metrics.TrainAccuracy*100)
+		}
 	}
 }
 
@@ -581,58 +816,20 @@ func markRemoteTrainingCompleted(trainingID string, modelPath string) {
 	}
 	log.Printf("🔍 Extracted model name '%s' from training ID '%s'", modelName, trainingID)
 
-	// Extract final accuracy from training progress
-	// Note: Database expects percentage format (e.g., 95.50), but metrics are in 0-1 range
+	// Extract final accuracy and the model's primary metric from training progress
+	// Note: Database expects accuracy in percentage format (e.g., 95.50), but metrics are in 0-1 range
 	var finalAccuracy *float64
-	// Prefer FinalMetrics if available, then last metric from Metrics array
-	if progress.FinalMetrics != nil {
-		// Use FinalMetrics (prefer test > val > train)
-		if progress.FinalMetrics.TestAccuracy > 0 {
-			acc := progress.FinalMetrics.TestAccuracy * 100 // Convert 0-1 range to percentage
-			finalAccuracy = &acc
-			log.Printf("📊 Using FinalMetrics test accuracy: %.2f%%", acc)
-		} else if progress.FinalMetrics.ValAccuracy > 0 {
-			acc := progress.FinalMetrics.ValAccuracy * 100 // Convert 0-1 range to percentage
-			finalAccuracy = &acc
-			log.Printf("📊 Using FinalMetrics validation accuracy: %.2f%%", acc)
-		} else if progress.FinalMetrics.TrainAccuracy > 0 {
-			acc := progress.FinalMetrics.TrainAccuracy * 100 // Convert 0-1 range to percentage
-			finalAccuracy = &acc
-			log.Printf("📊 Using FinalMetrics train accuracy: %.2f%%", acc)
-		}
-	}
-	// Fallback: search through all metrics (reverse order) to find the most recent accuracy
-	if finalAccuracy == nil && len(progress.Metrics) > 0 {
-		// Search from end to beginning to find the most recent metric with accuracy
-		for i := len(progress.Metrics) - 1; i >= 0; i-- {
-			metric := progress.Metrics[i]
-			if metric.TestAccuracy > 0 {
-				acc := metric.TestAccuracy * 100 // Convert 0-1 range to percentage
-				finalAccuracy = &acc
-				log.Printf("📊 Using metric[%d] test accuracy: %.2f%%", i, acc)
-				break
-			} else if metric.ValAccuracy > 0 {
-				acc := metric.ValAccuracy * 100 // Convert 0-1 range to percentage
-				finalAccuracy = &acc
-				log.Printf("📊 Using metric[%d] validation accuracy: %.2f%%", i, acc)
-				break
-			} else if metric.TrainAccuracy > 0 {
-				acc := metric.TrainAccuracy * 100 // Convert 0-1 range to percentage
-				finalAccuracy = &acc
-				log.Printf("📊 Using metric[%d] train accuracy: %.2f%%", i, acc)
-				break
-			}
-		}
-	}
-	if finalAccuracy == nil {
-		log.Printf("⚠️  No accuracy found in training progress")
-		log.Printf("   FinalMetrics: %v", progress.FinalMetrics != nil)
-		if progress.FinalMetrics != nil {
-			log.Printf("   FinalMetrics.TestAccuracy: %.4f", progress.FinalMetrics.TestAccuracy)
-			log.Printf("   FinalMetrics.ValAccuracy: %.4f", progress.FinalMetrics.ValAccuracy)
-			log.Printf("   FinalMetrics.TrainAccuracy: %.4f", progress.FinalMetrics.TrainAccuracy)
-		}
-		log.Printf("   Total metrics: %d", len(progress.Metrics))
+	if acc, ok := aiAgent.DefaultPrimaryMetric().Final(progress); ok {
+		finalAccuracy = &acc
+		log.Printf("📊 Final accuracy: %.2f%%", acc)
+	}
+	primaryMetric := progress.GetPrimaryMetric()
+	var finalMetric *float64
+	if value, ok := primaryMetric.Final(progress); ok {
+		finalMetric = &value
+		log.Printf("📊 Final %s: %.4g", primaryMetric.Name, value)
+	} else {
+		log.Printf("⚠️  No %s found in training progress (%d metrics)", primaryMetric.Name, len(progress.Metrics))
 	}
 
 	// Set model path if provided
@@ -660,6 +857,16 @@ func markRemoteTrainingCompleted(trainingID string, modelPath string) {
 			log.Printf("✅ Database updated with accuracy (%.2f%%) for model: %s", *finalAccuracy, modelName)
 		}
 	}
+	if finalMetric != nil {
+		if err := repository.UpdateModelPrimaryMetricValue(context.Background(), modelName, *finalMetric); err != nil {
+			log.Printf("⚠️  Failed to store the primary metric of model %s: %v", modelName, err)
+		}
+	}
+
+	// Keep this training as a new version so retraining never loses the previous model
+	if modelPath != "" {
+		aiAgent.RecordModelVersion(context.Background(), uploadsBaseDir(), modelName, trainingID, modelPath, finalAccuracy, progress)
+	}
 
 	log.Printf("✅ Marked training as completed: %s", trainingID)
 }
@@ -685,150 +892,3 @@ func markRemoteTrainingFailed(trainingID string, errorMsg string) {
 	progress.MarkFailed(errorMsg)
 	log.Printf("❌ Marked training as failed: %s - %s", trainingID, errorMsg)
 }
-
-func parseProgressJSONFromOutput(jsonStr string) *aiAgent.TrainingMetrics {
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
-		return nil
-	}
-
-	metrics := &aiAgent.TrainingMetrics{}
-
-	// Extract epoch
-	if epoch, ok := data["epoch"].(float64); ok {
-		metrics.Epoch = int(epoch)
-	}
-	if totalEpochs, ok := data["total_epochs"].(float64); ok {
-		metrics.TotalEpochs = int(totalEpochs)
-	}
-
-	// Extract losses
-	if trainLoss, ok := data["train_loss"].(float64); ok {
-		metrics.TrainLoss = trainLoss
-	}
-	if valLoss, ok := data["val_loss"].(float64); ok {
-		metrics.ValLoss = valLoss
-	}
-	if testLoss, ok := data["test_loss"].(float64); ok {
-		metrics.ValLoss = testLoss // Use ValLoss field for test loss
-	}
-
-	// Extract accuracies (convert from percentage to 0-1 range if needed)
-	if trainAcc, ok := data["train_accuracy"].(float64); ok {
-		if trainAcc > 1 {
-			metrics.TrainAccuracy = trainAcc / 100
-		} else {
-			metrics.TrainAccuracy = trainAcc
-		}
-	}
-	if valAcc, ok := data["val_accuracy"].(float64); ok {
-		if valAcc > 1 {
-			metrics.ValAccuracy = valAcc / 100
-		} else {
-			metrics.ValAccuracy = valAcc
-		}
-	}
-	if testAcc, ok := data["test_accuracy"].(float64); ok {
-		if testAcc > 1 {
-			metrics.TestAccuracy = testAcc / 100
-		} else {
-			metrics.TestAccuracy = testAcc
-		}
-	}
-	// Handle generic "accuracy" field (typically used for final/test accuracy)
-	if acc, ok := data["accuracy"].(float64); ok {
-		// Convert from percentage to 0-1 range if needed
-		if acc > 1 {
-			acc = acc / 100
-		}
-		// Generic accuracy typically represents test/final accuracy
-		// Prefer TestAccuracy, but fall back to TrainAccuracy if TestAccuracy already set from test_accuracy field
-		if metrics.TestAccuracy == 0 {
-			metrics.TestAccuracy = acc
-		} else if metrics.TrainAccuracy == 0 {
-			// If TestAccuracy is already set, use TrainAccuracy as fallback
-			metrics.TrainAccuracy = acc
-		} else {
-			// If both are set, prefer TestAccuracy for generic accuracy (overwrite)
-			metrics.TestAccuracy = acc
-		}
-	}
-
-	// Extract generic "loss" field if specific loss fields are not present
-	if metrics.TrainLoss == 0 {
-		if loss, ok := data["loss"].(float64); ok {
-			metrics.TrainLoss = loss
-		}
-	}
-
-	// Check for "status" field to identify final/completed metrics
-	// Store it in CustomMetrics for later use
-	if status, ok := data["status"].(string); ok {
-		if metrics.CustomMetrics == nil {
-			metrics.CustomMetrics = make(map[string]interface{})
-		}
-		metrics.CustomMetrics["status"] = status
-	}
-
-	// Only return if we found useful data
-	if metrics.Epoch > 0 || metrics.TrainLoss > 0 || metrics.TrainAccuracy > 0 || metrics.TestAccuracy > 0 || metrics.ValAccuracy > 0 {
-		return metrics
-	}
-
-	return nil
-}
-
-func parseMetricsFromOutput(line string) *aiAgent.TrainingMetrics {
-	metrics := &aiAgent.TrainingMetrics{}
-
-	// Pattern: Epoch 1/10, Train Loss: 0.5432
-	epochPattern := regexp.MustCompile(`Epoch\s+(\d+)[/:](\d+)`)
-	if matches := epochPattern.FindStringSubmatch(line); len(matches) == 3 {
-		epoch, _ := strconv.Atoi(matches[1])
-		total, _ := strconv.Atoi(matches[2])
-		metrics.Epoch = epoch
-		metrics.TotalEpochs = total
-	}
-
-	// Pattern: Train Loss: 0.5432 or loss: 0.5432
-	lossPattern := regexp.MustCompile(`(?i)(train\s*)?loss[:\s]+([0-9.]+)`)
-	if matches := lossPattern.FindStringSubmatch(line); len(matches) == 3 {
-		loss, _ := strconv.ParseFloat(matches[2], 64)
-		metrics.TrainLoss = loss
-	}
-
-	// Pattern: Val Loss: 0.4321 or validation loss: 0.4321
-	valLossPattern := regexp.MustCompile(`(?i)(val|validation)\s*loss[:\s]+([0-9.]+)`)
-	if matches := valLossPattern.FindStringSubmatch(line); len(matches) == 3 {
-		valLoss, _ := strconv.ParseFloat(matches[2], 64)
-		metrics.ValLoss = valLoss
-	}
-
-	// Pattern: Accuracy: 0.95 or Train Accuracy: 95%
-	accPattern := regexp.MustCompile(`(?i)(train\s*)?acc(?:uracy)?[:\s]+([0-9.]+)%?`)
-	if matches := accPattern.FindStringSubmatch(line); len(matches) == 3 {
-		acc, _ := strconv.ParseFloat(matches[2], 64)
-		// Convert to 0-1 range if it's a percentage
-		if acc > 1 {
-			acc = acc / 100
-		}
-		metrics.TrainAccuracy = acc
-	}
-
-	// Pattern: Val Accuracy: 0.93
-	valAccPattern := regexp.MustCompile(`(?i)(val|validation)\s*acc(?:uracy)?[:\s]+([0-9.]+)%?`)
-	if matches := valAccPattern.FindStringSubmatch(line); len(matches) == 3 {
-		valAcc, _ := strconv.ParseFloat(matches[2], 64)
-		if valAcc > 1 {
-			valAcc = valAcc / 100
-		}
-		metrics.ValAccuracy = valAcc
-	}
-
-	// Only return metrics if we found something useful
-	if metrics.Epoch > 0 || metrics.TrainLoss > 0 || metrics.TrainAccuracy > 0 {
-		return metrics
-	}
-
-	return nil
-}
@@ -0,0 +1,679 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"server/aiAgent"
+	"server/internal/middlewares"
+	"server/internal/models"
+	"server/internal/repository"
+	"server/internal/testutil/agenttest"
+	"server/internal/testutil/pgtest"
+	"server/internal/ws"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
+
+// agentServer serves the agent WebSocket endpoint with a fresh trainer for remote progress
+func agentServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	previous := globalTrainer
+	SetGlobalTrainer(aiAgent.NewTrainer(aiAgent.NewDirectoryNavigator(t.TempDir())))
+	server := httptest.NewServer(http.HandlerFunc(AgentWebSocketHandler))
+	t.Cleanup(func() {
+		server.Close()
+		SetGlobalTrainer(previous)
+	})
+	return server
+}
+
+// connectAgent connects a mock agent of user and waits for the handshake to finish
+func connectAgent(t *testing.T, server *httptest.Server, user pgtest.User, frontend *agenttest.Frontend) *agenttest.Agent {
+	t.Helper()
+	agent, resp, err := agenttest.Dial(server.URL, user.APIKey, nil)
+	if err != nil {
+		t.Fatalf("agent failed to connect: %v (response %v)", err, resp)
+	}
+	t.Cleanup(func() { agent.Close() })
+
+	agent.Expect(t, "connected")
+	agent.Expect(t, "system_info_request")
+	// The first status has no system info, the second one carries what the agent reported
+	frontend.ExpectData(t, "agent_status")
+	status := frontend.ExpectData(t, "agent_status")
+	if status["system_info"] == nil {
+		t.Fatalf("agent_status after system_info = %v, want the agent's system info", status)
+	}
+	return agent
+}
+
+// waitFor polls cond until it holds or the agent test timeout passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(agenttest.Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgentRequiresAPIKey(t *testing.T) {
+	server := agentServer(t)
+
+	_, resp, err := agenttest.Dial(server.URL, "", nil)
+	if err == nil {
+		t.Fatal("agent without an API key connected, want it rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("agent without an API key got response %v, want 401", resp)
+	}
+}
+
+func TestAgentRejectsUnknownAPIKey(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+
+	_, resp, err := agenttest.Dial(server.URL, "sk_live_unknown", nil)
+	if err == nil {
+		t.Fatal("agent with an unknown API key connected, want it rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("agent with an unknown API key got response %v, want 401", resp)
+	}
+}
+
+func TestAgentHandshakeReportsStatus(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+
+	agent := connectAgent(t, server, user, frontend)
+	if !IsAgentConnected(user.Email) {
+		t.Fatal("IsAgentConnected = false after the handshake")
+	}
+	waitFor(t, "system info to be stored", func() bool {
+		agentManager.mu.RLock()
+		defer agentManager.mu.RUnlock()
+		ac := agentManager.agents[user.Email][""]
+		ac.mu.Lock()
+		defer ac.mu.Unlock()
+		return ac.SystemInfo["os"] == "linux"
+	})
+
+	agent.Close()
+	if status := frontend.ExpectData(t, "agent_status"); status["connected"] != false || status["status"] != "disconnected" {
+		t.Errorf("agent_status after disconnect = %v, want disconnected", status)
+	}
+	waitFor(t, "agent to be unregistered", func() bool { return !IsAgentConnected(user.Email) })
+}
+
+func TestAgentTrainingRunUpdatesProgressAndModel(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, user.ID)
+	var modelName string
+	if err := models.Pool.QueryRow(context.Background(), `SELECT name FROM models WHERE id = $1`, modelID).Scan(&modelName); err != nil {
+		t.Fatalf("failed to read model name: %v", err)
+	}
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+
+	// Training IDs are "<model name>_<unix time>", the server uses the name to update the model
+	trainingID := modelName + "_1700000000"
+	if err := agent.Start(trainingID); err != nil {
+		t.Fatal(err)
+	}
+	if update := frontend.ExpectData(t, "training_update"); update["status"] != "running" || update["training_id"] != trainingID {
+		t.Errorf("training_update after training_started = %v, want running", update)
+	}
+	progress, err := globalTrainer.GetProgress(trainingID)
+	if err != nil {
+		t.Fatalf("no progress created for %s: %v", trainingID, err)
+	}
+	if snapshot := progress.Snapshot(); progress.UserID != user.ID || snapshot.Status != aiAgent.StatusRunning {
+		t.Errorf("progress = user %d, status %s, want user %d running", progress.UserID, snapshot.Status, user.ID)
+	}
+
+	// Both the PROGRESS protocol and plain log lines are parsed into metrics
+	if err := agent.Output(trainingID, "Epoch 1/2, Train Loss: 0.6931, Accuracy: 71.5%"); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.Progress(trainingID, agenttest.Message{
+		"epoch": 2, "total_epochs": 2, "train_loss": 0.25, "test_accuracy": 0.91,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if output := frontend.ExpectData(t, "training_output"); output["training_id"] != trainingID {
+		t.Errorf("training_output = %v, want it for %s", output, trainingID)
+	}
+	if err := agent.Complete(trainingID, "./uploads/trained/model.pt"); err != nil {
+		t.Fatal(err)
+	}
+	if update := frontend.ExpectData(t, "training_update"); update["status"] != "completed" || update["model_path"] != "./uploads/trained/model.pt" {
+		t.Errorf("training_update after training_completed = %v, want completed with the model path", update)
+	}
+
+	// The agent connection handled every message before broadcasting the completion
+	if progress.Status != aiAgent.StatusCompleted {
+		t.Errorf("progress status = %s, want completed", progress.Status)
+	}
+	if len(progress.Metrics) != 2 {
+		t.Fatalf("parsed %d metrics, want 2: %+v", len(progress.Metrics), progress.Metrics)
+	}
+	if first := progress.Metrics[0]; first.Epoch != 1 || first.TotalEpochs != 2 || first.TrainLoss != 0.6931 || first.TrainAccuracy != 0.715 {
+		t.Errorf("metrics from log line = %+v", first)
+	}
+	if second := progress.Metrics[1]; second.Epoch != 2 || second.TestAccuracy != 0.91 {
+		t.Errorf("metrics from PROGRESS line = %+v", second)
+	}
+
+	var path string
+	var accuracy float64
+	if err := models.Pool.QueryRow(context.Background(), `
+		SELECT trained_model_path, accuracy_score FROM models WHERE id = $1
+	`, modelID).Scan(&path, &accuracy); err != nil {
+		t.Fatalf("failed to read model: %v", err)
+	}
+	if path != "./uploads/trained/model.pt" || accuracy != 91 {
+		t.Errorf("model = path %q, accuracy %v, want the agent's model path with accuracy 91", path, accuracy)
+	}
+}
+
+func TestAgentTrainingFailure(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+
+	trainingID := "broken_1700000000"
+	if err := agent.Start(trainingID); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.Fail(trainingID, "CUDA out of memory"); err != nil {
+		t.Fatal(err)
+	}
+	frontend.ExpectData(t, "training_update")
+	if update := frontend.ExpectData(t, "training_update"); update["status"] != "failed" || update["error_message"] != "CUDA out of memory" {
+		t.Errorf("training_update after training_failed = %v, want failed with the error", update)
+	}
+
+	progress, err := globalTrainer.GetProgress(trainingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Status != aiAgent.StatusFailed || progress.ErrorMessage != "CUDA out of memory" {
+		t.Errorf("progress = %s %q, want failed with the agent's error", progress.Status, progress.ErrorMessage)
+	}
+}
+
+func TestAgentTrainingEarlyStop(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	aiAgent.SetEarlyStopCallback(HandleTrainingEarlyStop)
+	t.Cleanup(func() { aiAgent.SetEarlyStopCallback(nil) })
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+
+	trainingID := "early_1700000000"
+	pendingEarlyStopping.Store(trainingID, aiAgent.EarlyStopping{TargetAccuracy: 90})
+	if err := agent.Start(trainingID); err != nil {
+		t.Fatal(err)
+	}
+	frontend.ExpectData(t, "training_update")
+
+	for epoch, accuracy := range []float64{0.8, 0.93} {
+		if err := agent.Progress(trainingID, agenttest.Message{
+			"epoch": epoch + 1, "total_epochs": 10, "val_loss": 0.5, "val_accuracy": accuracy,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stop := agent.Expect(t, "stop"); stop["reason"] != "early_stop" || stop["training_id"] != trainingID {
+		t.Errorf("stop message = %v, want an early stop of %s", stop, trainingID)
+	}
+
+	// Agents that do not know early stops report the terminated script as failed
+	if err := agent.Fail(trainingID, "Terminated"); err != nil {
+		t.Fatal(err)
+	}
+	if update := frontend.ExpectData(t, "training_update"); update["status"] != "completed" {
+		t.Errorf("training_update after the early stop = %v, want completed", update)
+	}
+	progress, err := globalTrainer.GetProgress(trainingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := progress.EarlyStopped()
+	if progress.Status != aiAgent.StatusCompleted || stop == nil || stop.Reason != aiAgent.EarlyStopTargetReached || stop.Epoch != 2 {
+		t.Errorf("progress = %s with early stop %+v, want completed at the target in epoch 2", progress.Status, stop)
+	}
+}
+
+func TestServerCommandsReachAgent(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+
+	if _, err := StartRemoteTraining(user.Email, "", map[string]interface{}{"model_name": "digits"}); err != nil {
+		t.Fatalf("StartRemoteTraining: %v", err)
+	}
+	train := agent.Expect(t, "train")
+	if data, _ := train["data"].(map[string]interface{}); data["model_name"] != "digits" {
+		t.Errorf("train message = %v, want the training data", train)
+	}
+
+	trainingID := "digits_1700000000"
+	if err := agent.Start(trainingID); err != nil {
+		t.Fatal(err)
+	}
+	frontend.ExpectData(t, "training_update")
+	if _, err := StartRemoteTraining(user.Email, "", map[string]interface{}{}); err == nil {
+		t.Error("StartRemoteTraining sent a second training to a busy agent")
+	}
+	if !StopRemoteTraining(user.ID, trainingID) {
+		t.Fatal("StopRemoteTraining = false for the running training")
+	}
+	agent.Expect(t, "stop")
+	if StopRemoteTraining(user.ID, "other_1700000000") {
+		t.Error("StopRemoteTraining = true for a training the agent is not running")
+	}
+}
+
+func TestAgentBenchmark(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+
+	if err := StartAgentBenchmark(user.Email); err != nil {
+		t.Fatalf("StartAgentBenchmark: %v", err)
+	}
+	benchmark := agent.Expect(t, "benchmark")
+	if data, _ := benchmark["data"].(map[string]interface{}); data["suite"] != aiAgent.BenchmarkSuiteVersion {
+		t.Errorf("benchmark message = %v, want suite %s", benchmark, aiAgent.BenchmarkSuiteVersion)
+	}
+	if _, err := StartRemoteTraining(user.Email, "", map[string]interface{}{}); err == nil {
+		t.Error("StartRemoteTraining sent a training to a benchmarking agent")
+	}
+
+	// Twice the reference throughputs score 200
+	if err := agent.BenchmarkResult(200, 2000); err != nil {
+		t.Fatal(err)
+	}
+	update := frontend.ExpectData(t, "agent_benchmark")
+	if update["status"] != "completed" {
+		t.Fatalf("agent_benchmark = %v, want completed", update)
+	}
+	result := AgentBenchmark(user.Email)
+	if result == nil || result.Score != 200 {
+		t.Fatalf("AgentBenchmark = %+v, want score 200", result)
+	}
+
+	var stored float64
+	if err := models.Pool.QueryRow(context.Background(),
+		`SELECT score FROM agent_benchmarks WHERE user_id = $1 AND agent_name = 'test-agent'`, user.ID).Scan(&stored); err != nil {
+		t.Fatalf("benchmark not stored: %v", err)
+	}
+	if stored != 200 {
+		t.Errorf("stored score = %v, want 200", stored)
+	}
+}
+
+func TestAgentPreview(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+
+	if _, err := PredictWithAgentPreview(context.Background(), user.Email, []float64{1}); err != errNoPreview {
+		t.Fatalf("PredictWithAgentPreview without preview error = %v, want errNoPreview", err)
+	}
+	preview, err := StartAgentPreview(user.Email, "digits_1700000000")
+	if err != nil {
+		t.Fatalf("StartAgentPreview: %v", err)
+	}
+	start := agent.Expect(t, "preview_start")
+	if data, _ := start["data"].(map[string]interface{}); data["preview_id"] != preview.ID || data["training_id"] != "digits_1700000000" {
+		t.Fatalf("preview_start message = %v, want preview %s of the training", start, preview.ID)
+	}
+	if err := agent.PreviewReady(preview.ID, "pytorch"); err != nil {
+		t.Fatal(err)
+	}
+	if update := frontend.ExpectData(t, "agent_preview"); update["status"] != "ready" {
+		t.Fatalf("agent_preview = %v, want ready", update)
+	}
+
+	type result struct {
+		outputs interface{}
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		outputs, err := PredictWithAgentPreview(context.Background(), user.Email, []float64{0.5, 0.25})
+		done <- result{outputs, err}
+	}()
+	predict := agent.Expect(t, "preview_predict")
+	data, _ := predict["data"].(map[string]interface{})
+	requestID, _ := data["request_id"].(string)
+	if err := agent.Prediction(requestID, []interface{}{float64(7)}); err != nil {
+		t.Fatal(err)
+	}
+	got := <-done
+	if outputs, _ := got.outputs.([]interface{}); got.err != nil || len(outputs) != 1 || outputs[0] != float64(7) {
+		t.Fatalf("PredictWithAgentPreview = %v, %v, want [7]", got.outputs, got.err)
+	}
+
+	StopAgentPreview(user.Email)
+	agent.Expect(t, "preview_stop")
+	if _, err := PredictWithAgentPreview(context.Background(), user.Email, []float64{1}); err != errNoPreview {
+		t.Errorf("PredictWithAgentPreview after stop error = %v, want errNoPreview", err)
+	}
+}
+
+func TestAgentInventory(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+	agent.Expect(t, "inventory_request")
+
+	checksum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	err := agent.Inventory(
+		[]agenttest.Message{{"training_id": "digits_1700000000", "folder_path": "/home/me/digits", "status": "completed", "started_at": float64(1700000000)}},
+		[]agenttest.Message{
+			{"path": "/home/me/digits/model.pth", "size_bytes": float64(1024), "sha256": checksum, "training_id": "digits_1700000000"},
+			{"path": "/home/me/digits/broken.pth", "size_bytes": float64(1), "sha256": "not-a-checksum"},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update := frontend.ExpectData(t, "agent_inventory"); update["artifacts_count"] != float64(1) {
+		t.Errorf("agent_inventory = %v, want the one valid artifact", update)
+	}
+
+	var agentID int
+	if err := models.Pool.QueryRow(context.Background(),
+		`SELECT id FROM agents WHERE user_id = $1 AND name = 'test-agent'`, user.ID).Scan(&agentID); err != nil {
+		t.Fatalf("agent not registered: %v", err)
+	}
+	if connectedAgent(user.ID, agentID) == nil {
+		t.Fatal("connectedAgent = nil for the registered agent")
+	}
+
+	artifacts, err := repository.GetAgentArtifacts(context.Background(), agentID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 1 || artifacts[0]["on_server"] != false {
+		t.Fatalf("artifacts = %v, want one artifact missing on the server", artifacts)
+	}
+
+	if err := agent.Send(agenttest.Message{"type": "artifact_uploaded", "path": "/home/me/digits/model.pth", "server_path": "digits/model.pth"}); err != nil {
+		t.Fatal(err)
+	}
+	if update := frontend.ExpectData(t, "agent_artifact_upload"); update["status"] != "completed" {
+		t.Fatalf("agent_artifact_upload = %v, want completed", update)
+	}
+	artifacts, err = repository.GetAgentArtifacts(context.Background(), agentID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 1 || artifacts[0]["on_server"] != true {
+		t.Errorf("artifacts after upload = %v, want the artifact on the server", artifacts)
+	}
+}
+
+func TestAgentSyncServesOnlyGrantedFolder(t *testing.T) {
+	pgtest.Require(t)
+	uploads := t.TempDir()
+	t.Setenv("UPLOADS_PATH", uploads)
+	if err := os.MkdirAll(filepath.Join(uploads, "digits"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(uploads, "digits", "train.py"), []byte("print('training')\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	user := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+
+	spec := grantAgentSync("digits_1700000000", user.ID, "digits")
+	if spec == nil {
+		t.Fatal("grantAgentSync = nil for a folder on the server")
+	}
+	t.Cleanup(func() { agentSyncGrants.Delete("digits_1700000000") })
+
+	router := chi.NewRouter()
+	router.Get("/v1/agent/sync/{trainingId}/manifest", AgentSyncManifestHandler)
+	router.Get("/v1/agent/sync/{trainingId}/files/*", AgentSyncFileHandler)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	get := func(path, apiKey string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get(spec["manifest_url"].(string), user.APIKey)
+	var manifest struct {
+		Files []syncManifestEntry `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Path != "train.py" {
+		t.Fatalf("manifest = %+v, want train.py", manifest.Files)
+	}
+
+	resp = get(spec["files_url"].(string)+"train.py", user.APIKey)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Content-SHA256") != manifest.Files[0].SHA256 {
+		t.Errorf("file response = %d with checksum %q, want the manifest's", resp.StatusCode, resp.Header.Get("X-Content-SHA256"))
+	}
+	if resp := get(spec["manifest_url"].(string), other.APIKey); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("manifest for another user = %d, want 404", resp.StatusCode)
+	}
+	if resp := get(spec["files_url"].(string)+"..%2F..%2Fetc%2Fpasswd", user.APIKey); resp.StatusCode == http.StatusOK {
+		t.Error("file outside the model folder was served")
+	}
+}
+
+func TestStaleAgentsAreHidden(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+	agent.Expect(t, "inventory_request")
+
+	agent.Close()
+	if status := frontend.ExpectData(t, "agent_status"); status["connected"] != false || status["last_seen_at"] == nil {
+		t.Fatalf("agent_status after disconnect = %v, want disconnected with last_seen_at", status)
+	}
+	if _, err := models.Pool.Exec(context.Background(),
+		`UPDATE agents SET last_seen_at = NOW() - INTERVAL '30 days' WHERE user_id = $1`, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/agents"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.UserIDKey, user.ID))
+		rec := httptest.NewRecorder()
+		GetAgentsHandler(rec, req)
+		var body map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("GetAgentsHandler%s: %v", query, err)
+		}
+		return body
+	}
+	if body := list(""); len(body["agents"].([]interface{})) != 0 || body["stale_hidden"] != float64(1) {
+		t.Errorf("GetAgentsHandler = %v, want the stale agent hidden", body)
+	}
+	body := list("?include_stale=true")
+	agents := body["agents"].([]interface{})
+	if len(agents) != 1 || agents[0].(map[string]interface{})["stale"] != true {
+		t.Errorf("GetAgentsHandler?include_stale=true = %v, want the agent marked stale", body)
+	}
+}
+
+func TestMultipleAgentsPerUser(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+
+	dial := func(agentID string, gpus float64) *agenttest.Agent {
+		info := agenttest.Message{"os": "linux", "hostname": agentID, "cuda_available": gpus > 0, "gpu_count": gpus}
+		agent, resp, err := agenttest.DialAs(server.URL, user.APIKey, agentID, info)
+		if err != nil {
+			t.Fatalf("agent %s failed to connect: %v (response %v)", agentID, err, resp)
+		}
+		t.Cleanup(func() { agent.Close() })
+		agent.Expect(t, "system_info_request")
+		agent.Expect(t, "inventory_request")
+		return agent
+	}
+	laptop := dial("laptop", 0)
+	workstation := dial("workstation", 2)
+
+	if _, _, err := agenttest.DialAs(server.URL, user.APIKey, "bad name!", nil); err == nil {
+		t.Error("agent with an invalid agent_id connected, want it rejected")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/agent/status", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middlewares.UserEmailKey, user.Email))
+	rec := httptest.NewRecorder()
+	GetAgentStatusHandler(rec, req)
+	var status map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if agents, _ := status["agents"].([]interface{}); len(agents) != 2 || status["agent_id"] != "workstation" {
+		t.Errorf("GetAgentStatusHandler = %v, want both agents with the workstation as default", status)
+	}
+
+	// Without a target the idle agent with the most GPUs trains, then the other one
+	if name, err := StartRemoteTraining(user.Email, "", map[string]interface{}{"training_id": "a_1700000000"}); err != nil || name != "workstation" {
+		t.Fatalf("StartRemoteTraining = %q, %v, want the workstation", name, err)
+	}
+	workstation.Expect(t, "train")
+	if name, err := StartRemoteTraining(user.Email, "", map[string]interface{}{"training_id": "b_1700000000"}); err != nil || name != "laptop" {
+		t.Fatalf("second StartRemoteTraining = %q, %v, want the idle laptop", name, err)
+	}
+	laptop.Expect(t, "train")
+
+	if _, err := StartRemoteTraining(user.Email, "workstation", map[string]interface{}{}); err == nil {
+		t.Error("StartRemoteTraining sent a training to the busy workstation")
+	}
+	if _, err := StartRemoteTraining(user.Email, "server-room", map[string]interface{}{}); !errors.Is(err, errAgentNotConnected) {
+		t.Errorf("StartRemoteTraining to an unknown agent = %v, want errAgentNotConnected", err)
+	}
+
+	laptop.Close()
+	waitFor(t, "laptop to be unregistered", func() bool {
+		_, err := selectAgent(user.Email, "laptop")
+		return err != nil
+	})
+	if !IsAgentConnected(user.Email) {
+		t.Error("IsAgentConnected = false while the workstation is connected")
+	}
+}
+
+func TestPlacementFollowsHardware(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+
+	laptop, resp, err := agenttest.DialAs(server.URL, user.APIKey, "laptop",
+		agenttest.Message{"hostname": "laptop", "cuda_available": false, "gpu_count": float64(0), "memory_gb": float64(16)})
+	if err != nil {
+		t.Fatalf("agent failed to connect: %v (response %v)", err, resp)
+	}
+	t.Cleanup(func() { laptop.Close() })
+	laptop.Expect(t, "inventory_request")
+
+	uploads := t.TempDir()
+	trainer := aiAgent.NewTrainer(aiAgent.NewDirectoryNavigator(uploads))
+	folder := filepath.Join(uploads, "digits")
+	if err := os.MkdirAll(folder, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(script string) {
+		if err := os.WriteFile(filepath.Join(folder, "train.py"), []byte(script), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	place := func(placement string) (trainingPlacement, *trainingStartError) {
+		r := httptest.NewRequest(http.MethodPost, "/train", nil)
+		r = r.WithContext(context.WithValue(r.Context(), middlewares.UserEmailKey, user.Email))
+		req := aiAgent.TrainingRequest{FolderName: "digits", ScriptName: "train.py", Placement: placement}
+		return choosePlacement(r, user.Email, req, trainer)
+	}
+
+	write("import torch\nmodel = Net().to('cuda' if torch.cuda.is_available() else 'cpu')\n")
+	if placement, err := place(""); err != nil || placement.Target != PlacementAgent || placement.AgentID != "laptop" {
+		t.Fatalf("placement of a script with a CPU fallback = %+v, %+v, want the laptop", placement, err)
+	}
+
+	write("import torch\nmodel = Net().cuda()\n")
+	placement, startErr := place("")
+	if startErr == nil || startErr.Status != http.StatusForbidden {
+		t.Fatalf("placement of a CUDA script for a free user = %+v, %+v, want 403", placement, startErr)
+	}
+	if placement, err := place(PlacementAgent); err != nil || placement.AgentID != "laptop" || placement.Rejected["laptop"] == "" {
+		t.Errorf("forced agent placement = %+v, %+v, want the laptop with its shortfall", placement, err)
+	}
+}
+
+func TestAgentStatusSnapshot(t *testing.T) {
+	pgtest.Require(t)
+	server := agentServer(t)
+	user := pgtest.CreateUser(t)
+	frontend := agenttest.NewFrontend(t, user.ID)
+	agent := connectAgent(t, server, user, frontend)
+
+	snapshot := ws.AgentStatusSnapshot(user.ID)
+	transitions := snapshot["transitions"].([]ws.AgentTransition)
+	if snapshot["connected"] != true || len(transitions) != 1 || transitions[0].To != "connected" {
+		t.Fatalf("snapshot after connecting = %v, want one connected agent and its transition", snapshot)
+	}
+	connectedSeq := snapshot["seq"].(int64)
+
+	agent.Close()
+	status := frontend.ExpectData(t, "agent_status")
+	if seq, _ := status["seq"].(float64); int64(seq) <= connectedSeq {
+		t.Errorf("disconnect status seq = %v, want above the snapshot's %d", status["seq"], connectedSeq)
+	}
+	snapshot = ws.AgentStatusSnapshot(user.ID)
+	transitions = snapshot["transitions"].([]ws.AgentTransition)
+	if snapshot["connected"] != false || len(transitions) != 2 || transitions[1].To != "disconnected" {
+		t.Errorf("snapshot after disconnecting = %v, want no agent and the disconnect transition", snapshot)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"server/aiAgent"
+	"server/internal/apierrors"
 )
 
 // AIAgentHandler handles AI agent requests
@@ -41,18 +42,18 @@ func NewAIAgentHandler() (*AIAgentHandler, error) {
 // AnalyzeDirectory handles directory analysis requests
 func (h *AIAgentHandler) AnalyzeDirectory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req aiAgent.AgentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.FolderName == "" {
-		http.Error(w, "folder_name is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "folder_name is required")
 		return
 	}
 
@@ -63,7 +64,7 @@ func (h *AIAgentHandler) AnalyzeDirectory(w http.ResponseWriter, r *http.Request
 
 	response, err := h.agent.ProcessRequest(req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -74,13 +75,13 @@ func (h *AIAgentHandler) AnalyzeDirectory(w http.ResponseWriter, r *http.Request
 // GetDirectoryInfo handles requests to get directory information
 func (h *AIAgentHandler) GetDirectoryInfo(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	folderName := r.URL.Query().Get("folder")
 	if folderName == "" {
-		http.Error(w, "folder query parameter is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "folder query parameter is required")
 		return
 	}
 
@@ -91,7 +92,7 @@ func (h *AIAgentHandler) GetDirectoryInfo(w http.ResponseWriter, r *http.Request
 
 	response, err := h.agent.ProcessRequest(req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -102,7 +103,7 @@ func (h *AIAgentHandler) GetDirectoryInfo(w http.ResponseWriter, r *http.Request
 // ListDirectories handles requests to list all directories
 func (h *AIAgentHandler) ListDirectories(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -112,7 +113,7 @@ func (h *AIAgentHandler) ListDirectories(w http.ResponseWriter, r *http.Request)
 
 	response, err := h.agent.ProcessRequest(req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -123,7 +124,7 @@ func (h *AIAgentHandler) ListDirectories(w http.ResponseWriter, r *http.Request)
 // CustomPrompt handles custom prompt requests
 func (h *AIAgentHandler) CustomPrompt(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -133,22 +134,18 @@ func (h *AIAgentHandler) CustomPrompt(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if requestBody.FolderName == "" || requestBody.Prompt == "" {
-		http.Error(w, "folder_name and prompt are required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "folder_name and prompt are required")
 		return
 	}
 
 	response, err := h.agent.AnalyzeWithPrompt(requestBody.FolderName, requestBody.Prompt)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		apierrors.Respond(w, http.StatusBadGateway, err.Error())
 		return
 	}
 
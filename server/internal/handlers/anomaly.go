@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"server/aiAgent"
+	"server/internal/repository"
+)
+
+// pendingAnomalyPolicies holds the anomaly policy of agent trainings until the agent reports them started
+var pendingAnomalyPolicies sync.Map // training ID -> aiAgent.AnomalyPolicy
+
+// modelAnomalyPolicy returns the anomaly policy configured for a model, or the defaults
+func modelAnomalyPolicy(ctx context.Context, modelID int) aiAgent.AnomalyPolicy {
+	policy := aiAgent.DefaultAnomalyPolicy()
+	if name, direction, err := repository.GetModelPrimaryMetric(ctx, modelID); err != nil {
+		log.Printf("⚠️  Failed to get primary metric of model %d, using accuracy: %v", modelID, err)
+	} else if metric, err := aiAgent.NewPrimaryMetric(name, direction); err == nil {
+		policy.Metric = metric
+	}
+	settings, err := repository.GetModelTrainingSettings(ctx, modelID)
+	if err != nil {
+		log.Printf("⚠️  Failed to get anomaly policy of model %d, using defaults: %v", modelID, err)
+		return policy
+	}
+	policy.AutoStop, _ = settings["anomaly_auto_stop"].(bool)
+	policy.FrozenEpochs = getIntField(settings, "anomaly_frozen_epochs", policy.FrozenEpochs)
+	if factor, ok := settings["anomaly_exploding_factor"].(float64); ok {
+		policy.ExplodingFactor = factor
+	}
+	if drop, ok := settings["anomaly_accuracy_drop"].(float64); ok {
+		policy.AccuracyDrop = drop
+	}
+	return policy
+}
+
+// HandleTrainingAnomaly notifies the owner of a training about an anomaly. Agent trainings whose
+// policy auto-stops are stopped here; server trainings are stopped by the trainer.
+func HandleTrainingAnomaly(trainingID string, userID int, anomaly aiAgent.TrainingAnomaly) {
+	title := fmt.Sprintf("Anomaly in training %s", trainingID)
+	message := anomaly.Message
+	if anomaly.AutoStopped {
+		message += ". The training was stopped."
+	}
+
+	if anomaly.AutoStopped && StopRemoteTraining(userID, trainingID) {
+		log.Printf("🛑 Stopped agent training %s after anomaly: %s", trainingID, anomaly.Kind)
+	}
+
+	notifyUser(context.Background(), userID, Notification{
+		Type:    NotificationTrainingAnomaly,
+		Title:   title,
+		Message: message,
+		Link:    "/statistics",
+		Data: map[string]interface{}{
+			"training_id":  trainingID,
+			"kind":         anomaly.Kind,
+			"epoch":        anomaly.Epoch,
+			"auto_stopped": anomaly.AutoStopped,
+		},
+	}, "", "")
+}
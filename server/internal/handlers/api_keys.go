@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// namedAPIKeyPrefix tells named API keys apart from account (sk_live_) and read-only (sk_read_) keys
+const namedAPIKeyPrefix = "sk_key_"
+
+// Scopes a named API key can be granted
+const (
+	APIKeyScopeAgentConnect  = "agent-connect"
+	APIKeyScopeReadModels    = "read-models"
+	APIKeyScopeStartTraining = "start-training"
+)
+
+// apiKeyScopes lists every scope, in the order they are documented
+var apiKeyScopes = []string{APIKeyScopeAgentConnect, APIKeyScopeReadModels, APIKeyScopeStartTraining}
+
+const (
+	// maxAPIKeyNameLength matches the api_keys.name column
+	maxAPIKeyNameLength = 100
+	// maxAPIKeyLifetimeDays is the longest expiry a named API key can be created with
+	maxAPIKeyLifetimeDays = 365
+)
+
+// userAPIKeyScopes returns the scopes of the key a user returned by repository.GetUserByApiKey
+// authenticated with. Account keys carry no scopes and are granted all of them.
+func userAPIKeyScopes(user map[string]interface{}) []string {
+	if scopes, ok := user["scopes"].([]string); ok {
+		return scopes
+	}
+	return apiKeyScopes
+}
+
+// apiKeyHasScope reports whether the key a user authenticated with was granted a scope
+func apiKeyHasScope(user map[string]interface{}, scope string) bool {
+	return slices.Contains(userAPIKeyScopes(user), scope)
+}
+
+// CreateAPIKeyHandler creates a named API key limited to scopes, optionally expiring after
+// expires_in_days. The key is only returned by this request; the server keeps its hash.
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxAPIKeyNameLength))
+		return
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPIKeyLifetimeDays {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be 0 (never) to %d", maxAPIKeyLifetimeDays))
+		return
+	}
+
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("scopes must be among %s", strings.Join(apiKeyScopes, ", ")))
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("❌ Failed to generate API key: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	key := namedAPIKeyPrefix + hex.EncodeToString(secret)
+
+	apiKey, err := repository.CreateAPIKey(r.Context(), userID, req.Name,
+		repository.HashAPIKey(key), key[:len(namedAPIKeyPrefix)+8], scopes, expiresAt)
+	if err != nil {
+		log.Printf("❌ Failed to create API key for user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	keyID := getIntField(apiKey, "id", 0)
+	log.Printf("🔑 User %d created API key %q with scopes %v", userID, req.Name, scopes)
+	recordAudit(r, AuditAPIKeyCreated, AuditTargetAPIKey, strconv.Itoa(keyID), map[string]interface{}{
+		"name":   req.Name,
+		"scopes": scopes,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"key":     key,
+		"api_key": apiKey,
+		"message": "Copy the key now, it will not be shown again",
+	})
+}
+
+// GetAPIKeysHandler lists the user's named API keys without their secrets
+func GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	keys, err := repository.GetAPIKeys(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get API keys of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve API keys")
+		return
+	}
+	if keys == nil {
+		keys = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"api_keys": keys,
+		"scopes":   apiKeyScopes,
+	})
+}
+
+// RevokeAPIKeyHandler revokes one of the user's named API keys. Agents already connected with
+// it stay connected until they reconnect.
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	keyID, err := strconv.Atoi(chi.URLParam(r, "keyId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid key ID")
+		return
+	}
+
+	revoked, err := repository.RevokeAPIKey(r.Context(), keyID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to revoke API key %d: %v", keyID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+	if !revoked {
+		apierrors.Respond(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	log.Printf("🔑 User %d revoked API key %d", userID, keyID)
+	recordAudit(r, AuditAPIKeyRevoked, AuditTargetAPIKey, strconv.Itoa(keyID), nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "API key revoked",
+	})
+}
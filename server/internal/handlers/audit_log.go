@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Audit log actions
+const (
+	AuditLogin                   = "login"
+	AuditLoginFailed             = "login_failed"
+	AuditAPIKeyRegenerated       = "api_key_regenerated"
+	AuditAPIKeyCreated           = "api_key_created"
+	AuditAPIKeyRevoked           = "api_key_revoked"
+	AuditModelDeleted            = "model_deleted"
+	AuditModelPublished          = "model_published"
+	AuditModelUnpublished        = "model_unpublished"
+	AuditPurchase                = "purchase"
+	AuditSubscriptionChanged     = "subscription_changed"
+	AuditUploadQuarantined       = "upload_quarantined"
+	AuditCommentHidden           = "comment_hidden"
+	AuditCommentUnhidden         = "comment_unhidden"
+	AuditCommentDeleted          = "comment_deleted"
+	AuditCommentReported         = "comment_reported"
+	AuditCommentReportsDismissed = "comment_reports_dismissed"
+	AuditSessionRevoked          = "session_revoked"
+	AuditSessionsRevoked         = "sessions_revoked"
+)
+
+// Types of the targets of audited actions
+const (
+	AuditTargetUser         = "user"
+	AuditTargetAPIKey       = "api_key"
+	AuditTargetModel        = "model"
+	AuditTargetListing      = "published_model"
+	AuditTargetBundle       = "bundle"
+	AuditTargetSubscription = "subscription"
+	AuditTargetComment      = "model_comment"
+	AuditTargetSession      = "session"
+)
+
+// recordAudit appends an action of the signed-in user to the audit log
+func recordAudit(r *http.Request, action, targetType, targetID string, details map[string]interface{}) {
+	userID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	userEmail, _ := r.Context().Value(middlewares.UserEmailKey).(string)
+	recordAuditAs(r, userID, userEmail, action, targetType, targetID, details)
+}
+
+// recordAuditAs appends an action to the audit log for requests made before the actor signed in or
+// on their behalf, like logins and payment webhooks. Failures are logged and never returned.
+func recordAuditAs(r *http.Request, actorID int, actorEmail, action, targetType, targetID string, details map[string]interface{}) {
+	entry := repository.AuditEntry{
+		ActorID:    actorID,
+		ActorEmail: actorEmail,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		UserAgent:  r.UserAgent(),
+		Details:    details,
+	}
+	if ip := clientIP(r); ip != nil {
+		entry.IPAddress = ip.String()
+	}
+	// Recorded even if the client went away before the response
+	if err := repository.InsertAuditEntry(context.WithoutCancel(r.Context()), entry); err != nil {
+		log.Printf("❌ Failed to record %s in the audit log: %v", action, err)
+	}
+}
+
+// recordSubscriptionAudit records a change of a user's subscription. Stripe webhooks act on behalf of
+// the user, so the user is recorded as the actor.
+func recordSubscriptionAudit(r *http.Request, userEmail string, details map[string]interface{}) {
+	userID := 0
+	if user, err := repository.GetUserByEmail(r.Context(), userEmail); err == nil && user != nil {
+		userID = getIntField(*user, "id", 0)
+	}
+	recordAuditAs(r, userID, userEmail, AuditSubscriptionChanged, AuditTargetSubscription, strconv.Itoa(userID), details)
+}
+
+// GetAuditLogHandler lists the audit log for admins, newest first, filtered by ?actor_id=, ?action=,
+// ?target_type=, ?target_id=, ?ip= and ?since= / ?until= (RFC 3339)
+func GetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := repository.AuditLogFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		IPAddress:  query.Get("ip"),
+	}
+	if raw := query.Get("actor_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid actor_id")
+			return
+		}
+		filter.ActorID = id
+	}
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := query.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("%s must be an RFC 3339 time", name))
+				return
+			}
+			*target = t.UTC()
+		}
+	}
+
+	page, pageSize := parsePagination(r)
+	entries, total, err := repository.GetAuditLog(r.Context(), filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get the audit log: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve the audit log")
+		return
+	}
+	if entries == nil {
+		entries = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"entries":   entries,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"server/helpers"
+	"server/internal/apierrors"
 	"server/internal/email"
 	"server/internal/repository"
 	"golang.org/x/crypto/bcrypt"
@@ -15,57 +17,66 @@ import (
 
 
 
+// RegisterRequest is the body of POST /v1/register
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	var rq struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var rq RegisterRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
-		http.Error(w, "Couldn't decode request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Couldn't decode request")
 		return
 	}
 
 	// Validate required fields
 	if rq.Email == "" || rq.Password == "" || rq.Username == "" {
-		http.Error(w, "Email, password, and username are required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Email, password, and username are required")
+		return
+	}
+
+	// Enforce the password policy
+	if result := evaluatePassword(r.Context(), rq.Password, rq.Username, rq.Email); !result.Valid {
+		writePasswordPolicyError(w, result)
 		return
 	}
 
 	// Check if email already exists
 	existing, err := repository.GetUserByEmail(r.Context(), rq.Email)
 	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 	if existing != nil {
-		http.Error(w, "Email already registered", http.StatusConflict)
+		apierrors.Respond(w, http.StatusConflict, "Email already registered")
 		return
 	}
 
 	// Check if username already exists
 	existingUsername, err := repository.GetUserByUsername(r.Context(), rq.Username)
 	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 	if existingUsername != nil {
-		http.Error(w, "Username already taken", http.StatusConflict)
+		apierrors.Respond(w, http.StatusConflict, "Username already taken")
 		return
 	}
 
 	// Hash password
 	hashed, err := bcrypt.GenerateFromPassword([]byte(rq.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Couldn't hash password", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Couldn't hash password")
 		return
 	}
 
 	// Insert user
 	_, err = repository.InsertUser(r.Context(), rq.Email, string(hashed), rq.Username)
 	if err != nil {
-		http.Error(w, "Couldn't insert user into DB", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Couldn't insert user into DB")
 		return
 	}
 
@@ -73,7 +84,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	token, err := helpers.GenerateRandomString(32)
 	if err != nil {
 		log.Printf("[REGISTER ERROR] Failed to generate verification token: %v", err)
-		http.Error(w, "Failed to generate verification token", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to generate verification token")
 		return
 	}
 
@@ -104,14 +115,17 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 
 
+// LoginRequest is the body of POST /v1/login
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	var rq struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var rq LoginRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
-		http.Error(w, "Couldn't decode request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Couldn't decode request")
 		return
 	}
 
@@ -121,12 +135,13 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := repository.GetUserByEmail(r.Context(), rq.Email)
 	if err != nil {
 		log.Printf("[LOGIN ERROR] DB error fetching user: %v", err)
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 	if user == nil {
 		log.Printf("[LOGIN ERROR] User not found for email: %s", rq.Email)
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		recordAuditAs(r, 0, rq.Email, AuditLoginFailed, "", "", map[string]interface{}{"reason": "unknown_email"})
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
@@ -141,7 +156,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	if !emailVerified {
 		log.Printf("[LOGIN ERROR] Email not verified for: %s", rq.Email)
-		http.Error(w, "Email not verified. Please check your email for verification link.", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Email not verified. Please check your email for verification link.")
 		return
 	}
 
@@ -149,7 +164,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	passwordHash, ok := (*user)["password"].(string)
 	if !ok {
 		log.Printf("[LOGIN ERROR] Password field type assertion failed. User data: %+v", *user)
-		http.Error(w, "Invalid user data", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Invalid user data")
 		return
 	}
 
@@ -158,7 +173,8 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Compare password
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(rq.Password)); err != nil {
 		log.Printf("[LOGIN ERROR] Password comparison failed for email: %s, error: %v", rq.Email, err)
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		recordAuditAs(r, getIntField(*user, "id", 0), rq.Email, AuditLoginFailed, AuditTargetUser, fmt.Sprint(getIntField(*user, "id", 0)), map[string]interface{}{"reason": "wrong_password"})
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
@@ -178,41 +194,27 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[LOGIN] User ID extracted as int64, converted to int: %d", userID)
 	default:
 		log.Printf("[LOGIN ERROR] User ID type assertion failed. Type: %T, Value: %v", (*user)["id"], (*user)["id"])
-		http.Error(w, "Invalid user data", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Invalid user data")
 		return
 	}
 
-	// Generate JWT token with email and userID
-	log.Printf("[LOGIN] Generating JWT for userID: %d, email: %s", userID, rq.Email)
-	token, err := helpers.GenerateJWT(rq.Email, userID)
-	if err != nil {
-		log.Printf("[LOGIN ERROR] JWT generation failed: %v", err)
-		http.Error(w, "Couldn't generate token", http.StatusInternalServerError)
+	if !allowSignIn(w, r, userID) {
 		return
 	}
 
-	log.Printf("[LOGIN] JWT generated successfully")
-
-	// Generate refresh token
-	refreshToken, err := helpers.GenerateRandomString(64)
+	// Generate the JWT and refresh token of a new session
+	log.Printf("[LOGIN] Starting session for userID: %d, email: %s", userID, rq.Email)
+	token, refreshToken, err := startSession(r, userID, rq.Email)
 	if err != nil {
-		log.Printf("[LOGIN ERROR] Refresh token generation failed: %v", err)
-		http.Error(w, "Couldn't generate refresh token", http.StatusInternalServerError)
+		log.Printf("[LOGIN ERROR] Session start failed: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Couldn't save session")
 		return
 	}
 
-	log.Printf("[LOGIN] Refresh token generated")
+	log.Printf("[LOGIN] Session saved")
+	recordAuditAs(r, userID, rq.Email, AuditLogin, AuditTargetUser, fmt.Sprint(userID), map[string]interface{}{"method": "password"})
 
-	// Save session to DB
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
-	sessionID, err := repository.InsertSession(r.Context(), userID, rq.Email, refreshToken, expiresAt)
-	if err != nil {
-		log.Printf("[LOGIN ERROR] Session save failed: %v", err)
-		http.Error(w, "Couldn't save session", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("[LOGIN] Session saved with ID: %d", sessionID)
+	mergeAnonymousViews(w, r, userID)
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "refresh_token",
@@ -225,10 +227,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"token":         token,
-		"refresh_token": refreshToken,
-	})
+	json.NewEncoder(w).Encode(loginResponse(r.Context(), userID, token, refreshToken))
 
 	log.Printf("[LOGIN] Login successful for email: %s, userID: %d", rq.Email, userID)
 }
@@ -238,7 +237,7 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 	// Get token from query parameter
 	token := r.URL.Query().Get("token")
 	if token == "" {
-		http.Error(w, "Verification token is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Verification token is required")
 		return
 	}
 
@@ -248,7 +247,7 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := repository.VerifyEmailByToken(r.Context(), token)
 	if err != nil {
 		log.Printf("[EMAIL VERIFICATION ERROR] %v", err)
-		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid or expired verification token")
 		return
 	}
 
@@ -275,12 +274,12 @@ func ResendVerificationEmailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
-		http.Error(w, "Couldn't decode request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Couldn't decode request")
 		return
 	}
 
 	if rq.Email == "" {
-		http.Error(w, "Email is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Email is required")
 		return
 	}
 
@@ -289,7 +288,7 @@ func ResendVerificationEmailHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if user exists
 	user, err := repository.GetUserByEmail(r.Context(), rq.Email)
 	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 	if user == nil {
@@ -302,7 +301,7 @@ func ResendVerificationEmailHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if already verified
 	emailVerified, ok := (*user)["email_verified"].(bool)
 	if ok && emailVerified {
-		http.Error(w, "Email is already verified", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Email is already verified")
 		return
 	}
 
@@ -310,7 +309,7 @@ func ResendVerificationEmailHandler(w http.ResponseWriter, r *http.Request) {
 	token, err := helpers.GenerateRandomString(32)
 	if err != nil {
 		log.Printf("[RESEND VERIFICATION ERROR] Failed to generate token: %v", err)
-		http.Error(w, "Failed to generate verification token", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to generate verification token")
 		return
 	}
 
@@ -321,7 +320,7 @@ func ResendVerificationEmailHandler(w http.ResponseWriter, r *http.Request) {
 	err = repository.SetVerificationToken(r.Context(), rq.Email, token, expiresAt)
 	if err != nil {
 		log.Printf("[RESEND VERIFICATION ERROR] Failed to save token: %v", err)
-		http.Error(w, "Failed to save verification token", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save verification token")
 		return
 	}
 
@@ -335,7 +334,7 @@ func ResendVerificationEmailHandler(w http.ResponseWriter, r *http.Request) {
 	err = emailService.SendVerificationEmail(rq.Email, username, token)
 	if err != nil {
 		log.Printf("[RESEND VERIFICATION ERROR] Failed to send email: %v", err)
-		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to send verification email")
 		return
 	}
 
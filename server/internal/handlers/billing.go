@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	portalsession "github.com/stripe/stripe-go/v81/billingportal/session"
+	"github.com/stripe/stripe-go/v81/invoice"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// InvoiceCacheEnv is how long, in minutes, cached invoices are served before they are fetched
+// from Stripe again (default 60)
+const InvoiceCacheEnv = "INVOICE_CACHE_MINUTES"
+
+// maxSyncedInvoices is how many of a customer's most recent invoices are fetched from Stripe
+const maxSyncedInvoices = 100
+
+// toStripeInvoice converts a Stripe invoice to its cached copy
+func toStripeInvoice(inv *stripe.Invoice) repository.StripeInvoice {
+	cached := repository.StripeInvoice{
+		ID:               inv.ID,
+		Number:           inv.Number,
+		Status:           string(inv.Status),
+		Currency:         string(inv.Currency),
+		AmountDue:        inv.AmountDue,
+		AmountPaid:       inv.AmountPaid,
+		Total:            inv.Total,
+		HostedInvoiceURL: inv.HostedInvoiceURL,
+		InvoicePDF:       inv.InvoicePDF,
+		CreatedAt:        time.Unix(inv.Created, 0),
+	}
+	if inv.PeriodStart > 0 {
+		cached.PeriodStart = time.Unix(inv.PeriodStart, 0)
+	}
+	if inv.PeriodEnd > 0 {
+		cached.PeriodEnd = time.Unix(inv.PeriodEnd, 0)
+	}
+	return cached
+}
+
+// syncInvoices fetches a customer's most recent invoices from Stripe into the cache
+func syncInvoices(r *http.Request, userID int, customerID string) error {
+	params := &stripe.InvoiceListParams{Customer: stripe.String(customerID)}
+	params.Context = r.Context()
+	params.Limit = stripe.Int64(maxSyncedInvoices)
+
+	var invoices []repository.StripeInvoice
+	iter := invoice.List(params)
+	for iter.Next() && len(invoices) < maxSyncedInvoices {
+		invoices = append(invoices, toStripeInvoice(iter.Invoice()))
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if err := repository.UpsertStripeInvoices(r.Context(), userID, invoices); err != nil {
+		return err
+	}
+	return repository.MarkInvoicesSynced(r.Context(), userID)
+}
+
+// cacheWebhookInvoice updates the cached copy of an invoice from a webhook event, so the invoice
+// history shows a payment without waiting for the cache to expire
+func cacheWebhookInvoice(r *http.Request, userEmail string, inv *stripe.Invoice) {
+	user, err := repository.GetUserByEmail(r.Context(), userEmail)
+	if err != nil || user == nil {
+		return
+	}
+	if err := repository.UpsertStripeInvoices(r.Context(), getIntField(*user, "id", 0), []repository.StripeInvoice{toStripeInvoice(inv)}); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+}
+
+// CreateBillingPortalSessionHandler creates a Stripe Billing Portal session where the user manages
+// their payment methods, subscription and billing details, and returns its URL
+func CreateBillingPortalSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := repository.GetUserByEmail(r.Context(), userEmail)
+	if err != nil || user == nil {
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:5173"
+	}
+	returnURL := frontendURL + "/settings"
+
+	stripeKey := os.Getenv("STRIPE_SECRET_KEY")
+	if stripeKey == "" {
+		log.Println("⚠️  STRIPE_SECRET_KEY not set, using mock mode")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"portal_url": returnURL + "?mock_billing_portal=true",
+			"message":    "Mock mode - STRIPE_SECRET_KEY not configured",
+		})
+		return
+	}
+	stripe.Key = stripeKey
+
+	customerID := getStringField(*user, "stripe_customer_id", "")
+	if customerID == "" {
+		apierrors.Respond(w, http.StatusConflict, "You have no billing account yet. Subscribe to a plan first.")
+		return
+	}
+
+	params := &stripe.BillingPortalSessionParams{
+		Customer:  stripe.String(customerID),
+		ReturnURL: stripe.String(returnURL),
+	}
+	params.Context = r.Context()
+	sess, err := portalsession.New(params)
+	if err != nil {
+		log.Printf("❌ Failed to create billing portal session for %s: %v", userEmail, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create billing portal session")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"portal_url": sess.URL,
+	})
+}
+
+// GetInvoicesHandler returns a page of the user's past invoices with their amount, status and PDF
+// link, newest first. Invoices are cached locally and fetched from Stripe again once the cache is
+// older than INVOICE_CACHE_MINUTES, or with ?refresh=true. When Stripe cannot be reached the
+// cached invoices are returned with "stale": true.
+func GetInvoicesHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := repository.GetUserByEmail(r.Context(), userEmail)
+	if err != nil || user == nil {
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+	userID := getIntField(*user, "id", 0)
+
+	stale := false
+	customerID := getStringField(*user, "stripe_customer_id", "")
+	if stripeKey := os.Getenv("STRIPE_SECRET_KEY"); stripeKey != "" && customerID != "" {
+		maxAge := time.Duration(envInt(InvoiceCacheEnv, 60)) * time.Minute
+		fresh, err := repository.InvoicesSyncedSince(r.Context(), userID, time.Now().Add(-maxAge))
+		if err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+		if !fresh || r.URL.Query().Get("refresh") == "true" {
+			stripe.Key = stripeKey
+			if err := syncInvoices(r, userID, customerID); err != nil {
+				log.Printf("⚠️  Failed to fetch invoices of %s from Stripe: %v", userEmail, err)
+				stale = true
+			}
+		}
+	}
+
+	page, pageSize := parsePagination(r)
+	invoices, total, err := repository.GetUserInvoices(r.Context(), userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get invoices of %s: %v", userEmail, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve invoices")
+		return
+	}
+	if invoices == nil {
+		invoices = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"invoices":  invoices,
+		"stale":     stale,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
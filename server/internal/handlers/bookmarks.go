@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// BookmarkModelHandler adds a published model to the user's wishlist.
+// Send {"email_alerts": true} to be emailed about price drops and new versions.
+func BookmarkModelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	var req struct {
+		EmailAlerts bool `json:"email_alerts"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+	if isActive, _ := listing["is_active"].(bool); !isActive {
+		apierrors.Respond(w, http.StatusForbidden, "This model is not available")
+		return
+	}
+
+	if err := repository.AddBookmark(r.Context(), userID, listingID, req.EmailAlerts); err != nil {
+		log.Printf("❌ Failed to bookmark model %d for user %d: %v", listingID, userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to bookmark model")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"model_id":     listingID,
+		"email_alerts": req.EmailAlerts,
+	})
+}
+
+// RemoveBookmarkHandler removes a published model from the user's wishlist
+func RemoveBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	removed, err := repository.RemoveBookmark(r.Context(), userID, listingID)
+	if err != nil {
+		log.Printf("❌ Failed to remove bookmark of model %d for user %d: %v", listingID, userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove bookmark")
+		return
+	}
+	if !removed {
+		apierrors.Respond(w, http.StatusNotFound, "Model is not bookmarked")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"model_id": listingID,
+	})
+}
+
+// GetBookmarksHandler returns a page of the user's bookmarked models
+func GetBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	bookmarks, total, err := repository.GetBookmarks(r.Context(), userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get bookmarks for user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve bookmarks")
+		return
+	}
+	if bookmarks == nil {
+		bookmarks = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"bookmarks": bookmarks,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// notifyBookmarkers tells everyone who bookmarked a listing about a price drop or new version.
+// Users with email alerts also get an email.
+func notifyBookmarkers(listingID int, n Notification) {
+	ctx := context.Background()
+	bookmarkers, err := repository.GetBookmarkers(ctx, listingID)
+	if err != nil {
+		log.Printf("⚠️  Failed to get bookmarkers of model %d: %v", listingID, err)
+		return
+	}
+
+	for _, bookmarker := range bookmarkers {
+		userID := getIntField(bookmarker, "id", 0)
+		username := getStringField(bookmarker, "username", "")
+		emailTo := ""
+		if alerts, _ := bookmarker["email_alerts"].(bool); alerts {
+			emailTo = getStringField(bookmarker, "email", "")
+		}
+		notifyUser(ctx, userID, n, emailTo, username)
+	}
+	if len(bookmarkers) > 0 {
+		log.Printf("🔔 Notified %d bookmarkers of model %d (%s)", len(bookmarkers), listingID, n.Type)
+	}
+}
+
+// UpdatePublishedModelHandler lets the publisher change a listing's price, descriptions, category,
+// tags and visibility, or ship a new version from the model's latest training. Omitted fields are left
+// unchanged. Only admins can feature a listing. Bookmarkers are notified of price drops and new versions.
+func UpdatePublishedModelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	var req struct {
+		Price            *int      `json:"price"`
+		Description      *string   `json:"description"`
+		ShortDescription *string   `json:"short_description"`
+		Category         *string   `json:"category"` // An empty category clears it
+		Tags             *[]string `json:"tags"`
+		IsFeatured       *bool     `json:"is_featured"`  // Admins only
+		NewVersion       bool      `json:"new_version"`  // Publish the model's current weights (or scripts) as a new version
+		RentalPrice      *int      `json:"rental_price"` // 0 stops offering rentals; current rentals run until they expire
+		RentalDays       *int      `json:"rental_days"`
+		Visibility       *string   `json:"visibility"` // public, org (with organization_id) or private
+		OrganizationID   *int      `json:"organization_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	update := repository.ListingUpdate{
+		Price:            req.Price,
+		Description:      req.Description,
+		ShortDescription: req.ShortDescription,
+		Category:         req.Category,
+		Tags:             req.Tags,
+		IsFeatured:       req.IsFeatured,
+	}
+	if fields := validateListingUpdate(&update); len(fields) > 0 {
+		writeListingFieldErrors(w, fields)
+		return
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+	isPublisher := false
+	if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) == userID {
+		isPublisher = true
+	}
+	if req.IsFeatured != nil {
+		isAdmin, err := repository.IsAdmin(r.Context(), userID)
+		if err != nil {
+			log.Printf("❌ Failed to check admin role of user %d: %v", userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to check permissions")
+			return
+		}
+		if !isAdmin {
+			apierrors.Respond(w, http.StatusForbidden, "Only admins can feature listings")
+			return
+		}
+	}
+	// Admins who do not own the listing may only feature it
+	featureOnly := req.IsFeatured != nil && update == repository.ListingUpdate{IsFeatured: req.IsFeatured} && !req.NewVersion &&
+		req.RentalPrice == nil && req.RentalDays == nil && req.Visibility == nil && req.OrganizationID == nil
+	if !isPublisher && !featureOnly {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher can update this listing")
+		return
+	}
+
+	oldPrice := getIntField(listing, "price", 0)
+	newPrice := oldPrice
+	if req.Price != nil {
+		newPrice = *req.Price
+	}
+	rentalPrice := req.RentalPrice
+	if rentalPrice == nil && req.Price != nil {
+		// Check the current rental price still makes sense with the new price
+		current := getIntField(listing, "rental_price", 0)
+		rentalPrice = &current
+	}
+	if err := validateRentalTerms(newPrice, rentalPrice, req.RentalDays); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	visibility := getStringField(listing, "visibility", repository.ListingVisibilityPublic)
+	var organizationID *int
+	if id := getIntField(listing, "organization_id", 0); id > 0 {
+		organizationID = &id
+	}
+	if req.Visibility != nil {
+		visibility = *req.Visibility
+	}
+	if req.OrganizationID != nil {
+		organizationID = req.OrganizationID
+	}
+	newRentalPrice := getIntField(listing, "rental_price", 0)
+	if req.RentalPrice != nil {
+		newRentalPrice = *req.RentalPrice
+	}
+	if req.Visibility != nil || req.OrganizationID != nil {
+		if status, err := validateListingVisibility(r, userID, visibility, organizationID, newPrice, newRentalPrice); err != nil {
+			apierrors.Respond(w, status, err.Error())
+			return
+		}
+	} else if visibility != repository.ListingVisibilityPublic && (newPrice > 0 || newRentalPrice > 0) {
+		apierrors.Respond(w, http.StatusBadRequest, "only public listings can be sold or rented")
+		return
+	}
+	name := getStringField(listing, "name", fmt.Sprintf("Model #%d", listingID))
+	link := fmt.Sprintf("/community/models/%d", listingID)
+
+	if update != (repository.ListingUpdate{}) {
+		if err := repository.UpdatePublishedModelListing(r.Context(), listingID, update, userID); err != nil {
+			log.Printf("❌ Failed to update listing %d: %v", listingID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to update listing")
+			return
+		}
+	}
+	if req.RentalPrice != nil || req.RentalDays != nil {
+		if err := repository.UpdatePublishedModelRental(r.Context(), listingID, req.RentalPrice, req.RentalDays); err != nil {
+			log.Printf("❌ Failed to update rental terms of listing %d: %v", listingID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to update listing")
+			return
+		}
+	}
+	if req.Visibility != nil || req.OrganizationID != nil {
+		if err := repository.SetListingVisibility(r.Context(), listingID, visibility, organizationID); err != nil {
+			log.Printf("❌ Failed to update visibility of listing %d: %v", listingID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to update listing")
+			return
+		}
+	}
+	if update.Description != nil || update.ShortDescription != nil {
+		description, shortDescription := getStringField(listing, "description", ""), getStringField(listing, "short_description", "")
+		if update.Description != nil {
+			description = *update.Description
+		}
+		if update.ShortDescription != nil {
+			shortDescription = *update.ShortDescription
+		}
+		go translateListing(listingID, description, shortDescription)
+	}
+
+	version := getIntField(listing, "version", 1)
+	modelPath := getStringField(listing, "trained_model_path", "")
+	if req.NewVersion {
+		trainedModelPath, templatePath, status, err := currentListingArtifact(r.Context(), listing, userID)
+		if err != nil {
+			apierrors.Respond(w, status, err.Error())
+			return
+		}
+		if version, err = repository.UpdatePublishedModelArtifact(r.Context(), listingID, trainedModelPath, templatePath); err != nil {
+			log.Printf("❌ Failed to publish new version of listing %d: %v", listingID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to publish new version")
+			return
+		}
+		if path, ok := trainedModelPath.(string); ok {
+			modelPath = path
+		}
+		go notifyBookmarkers(listingID, Notification{
+			Type:    NotificationBookmarkNewVersion,
+			Title:   fmt.Sprintf("New version of %s", name),
+			Message: fmt.Sprintf("%s was updated to version %d.", name, version),
+			Link:    link,
+			Data:    map[string]interface{}{"model_id": listingID, "version": version},
+		})
+	}
+
+	// A new description or model file may now duplicate another listing
+	duplicates := []duplicateMatch{}
+	if update.Description != nil || req.NewVersion {
+		description := getStringField(listing, "description", "")
+		if update.Description != nil {
+			description = *update.Description
+		}
+		if matches, err := checkListingDuplicates(r.Context(), listingID, getStringField(listing, "listing_type", ""), modelPath, description); err != nil {
+			log.Printf("⚠️  Failed to check listing %d for duplicates: %v", listingID, err)
+		} else if matches != nil {
+			duplicates = matches
+		}
+	}
+
+	if req.Price != nil && newPrice < oldPrice {
+		go notifyBookmarkers(listingID, Notification{
+			Type:    NotificationBookmarkPriceDrop,
+			Title:   fmt.Sprintf("Price drop on %s", name),
+			Message: fmt.Sprintf("%s dropped from $%.2f to $%.2f.", name, float64(oldPrice)/100, float64(newPrice)/100),
+			Link:    link,
+			Data:    map[string]interface{}{"model_id": listingID, "old_price": oldPrice, "price": newPrice},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":            true,
+		"model_id":           listingID,
+		"version":            version,
+		"duplicate_warnings": duplicates,
+	})
+}
+
+// currentListingArtifact returns the model file or freshly packaged template a new listing version ships
+func currentListingArtifact(ctx context.Context, listing map[string]interface{}, userID int) (interface{}, interface{}, int, error) {
+	modelID := getIntField(listing, "model_id", 0)
+	model, err := repository.GetModelByID(ctx, modelID)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, fmt.Errorf("the model behind this listing no longer exists")
+	}
+
+	if listingType, _ := listing["listing_type"].(string); listingType == ListingTypePipelineTemplate {
+		var modelFolder string
+		if folders, ok := (*model)["folder"].([]interface{}); ok && len(folders) > 0 {
+			modelFolder, _ = folders[0].(string)
+		}
+		trainingScript, _ := (*model)["training_script"].(string)
+		path, err := packagePipelineTemplate(modelFolder, trainingScript, userID, modelID)
+		if err != nil {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("could not package pipeline template: %v", err)
+		}
+		return nil, path, http.StatusOK, nil
+	}
+
+	path, _ := (*model)["trained_model_path"].(string)
+	if path == "" {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("the model has no trained weights to publish")
+	}
+	if listingType, _ := listing["listing_type"].(string); listingType == ListingTypeWeightsOnly {
+		if _, err := resolveUploadsPath(path); err != nil {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("the trained model file was not found on the server")
+		}
+	}
+	return path, nil, http.StatusOK, nil
+}
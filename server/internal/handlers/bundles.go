@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// maxBundleItems limits how many listings a bundle can hold
+const maxBundleItems = 20
+
+// CreateBundleHandler creates a bundle from the publisher's own active listings.
+// The combined price may not exceed what the items cost separately.
+func CreateBundleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Price       int    `json:"price"` // Cents
+		ListingIDs  []int  `json:"listing_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if req.Price < 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "price cannot be negative")
+		return
+	}
+	if len(req.ListingIDs) < 2 || len(req.ListingIDs) > maxBundleItems {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("a bundle needs between 2 and %d listings", maxBundleItems))
+		return
+	}
+
+	seen := make(map[int]bool, len(req.ListingIDs))
+	itemsTotal := 0
+	for _, listingID := range req.ListingIDs {
+		if seen[listingID] {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("listing %d is included twice", listingID))
+			return
+		}
+		seen[listingID] = true
+
+		listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("listing %d not found", listingID))
+				return
+			}
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve listings")
+			return
+		}
+		if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) != userID {
+			apierrors.Respond(w, http.StatusForbidden, fmt.Sprintf("listing %d is not yours", listingID))
+			return
+		}
+		if isActive, _ := listing["is_active"].(bool); !isActive {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("listing %d is not published", listingID))
+			return
+		}
+		if getStringField(listing, "visibility", repository.ListingVisibilityPublic) != repository.ListingVisibilityPublic {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("listing %d is not public", listingID))
+			return
+		}
+		price, _ := listing["price"].(int32)
+		itemsTotal += int(price)
+	}
+	if req.Price > itemsTotal {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("bundle price cannot exceed the items' total of %d cents", itemsTotal))
+		return
+	}
+
+	bundleID, err := repository.CreateBundle(r.Context(), userID, req.Name, req.Description, req.Price, req.ListingIDs)
+	if err != nil {
+		log.Printf("❌ Failed to create bundle: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create bundle")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":           true,
+		"bundle_id":         bundleID,
+		"items_total_price": itemsTotal,
+	})
+}
+
+// GetBundlesHandler lists active bundles, or all of the caller's bundles with mine=true
+func GetBundlesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	publisherID := 0
+	if r.URL.Query().Get("mine") == "true" {
+		publisherID = userID
+	}
+	bundles, err := repository.GetBundles(r.Context(), publisherID)
+	if err != nil {
+		log.Printf("❌ Failed to get bundles: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve bundles")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"bundles": bundles,
+	})
+}
+
+// GetBundleByIDHandler returns a bundle page: the bundle, its items and their aggregated stats
+func GetBundleByIDHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	bundleID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid bundle ID")
+		return
+	}
+
+	bundle, err := repository.GetBundleByID(r.Context(), bundleID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Bundle not found")
+			return
+		}
+		log.Printf("❌ Failed to get bundle %d: %v", bundleID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve bundle")
+		return
+	}
+	publisherID, _ := bundle["publisher_id"].(int32)
+	if isActive, _ := bundle["is_active"].(bool); !isActive && int(publisherID) != userID {
+		apierrors.Respond(w, http.StatusNotFound, "Bundle not found")
+		return
+	}
+
+	items, err := repository.GetBundleItems(r.Context(), bundleID)
+	if err != nil {
+		log.Printf("❌ Failed to get items of bundle %d: %v", bundleID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve bundle")
+		return
+	}
+
+	purchased, err := repository.HasPurchasedBundle(r.Context(), bundleID, userID)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"bundle":    bundle,
+		"items":     items,
+		"purchased": purchased,
+	})
+}
+
+// UnpublishBundleHandler takes a bundle off the marketplace. Buyers keep access to its items.
+func UnpublishBundleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	bundleID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid bundle ID")
+		return
+	}
+
+	bundle, err := repository.GetBundleByID(r.Context(), bundleID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Bundle not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve bundle")
+		return
+	}
+	if publisherID, _ := bundle["publisher_id"].(int32); int(publisherID) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher can unpublish this bundle")
+		return
+	}
+
+	if err := repository.SetBundleActive(r.Context(), bundleID, false); err != nil {
+		log.Printf("❌ Failed to unpublish bundle %d: %v", bundleID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to unpublish bundle")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Bundle unpublished",
+	})
+}
+
+// canDownloadPublishedModel reports whether a user may download a listing:
+// free listings are open, paid ones need a purchase of the listing or of a bundle containing it
+func canDownloadPublishedModel(r *http.Request, listing map[string]interface{}, listingID, userID int) (bool, error) {
+	if price, _ := listing["price"].(int32); price <= 0 {
+		return true, nil
+	}
+	if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) == userID {
+		return true, nil
+	}
+	return repository.HasPublishedModelAccess(r.Context(), userID, listingID)
+}
+
+// purchaseItem is what a payment intent is created for: a single listing, a rental of one or a bundle
+type purchaseItem struct {
+	modelID    int
+	bundleID   int
+	name       string
+	price      int
+	rentalDays int // Set for rentals
+}
+
+// resolvePurchaseItem looks up the listing or bundle a user wants to buy or rent and checks it can be.
+// Renting a model the user already rents renews the rental.
+func resolvePurchaseItem(r *http.Request, userID, modelID, bundleID int, rental bool) (*purchaseItem, int, error) {
+	if (modelID > 0) == (bundleID > 0) {
+		return nil, http.StatusBadRequest, fmt.Errorf("either model_id or bundle_id is required")
+	}
+	if rental && bundleID > 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("Bundles cannot be rented")
+	}
+
+	if bundleID > 0 {
+		bundle, err := repository.GetBundleByID(r.Context(), bundleID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, http.StatusNotFound, fmt.Errorf("Bundle not found")
+			}
+			log.Printf("[PAYMENT ERROR] Failed to fetch bundle %d: %v", bundleID, err)
+			return nil, http.StatusInternalServerError, fmt.Errorf("Failed to retrieve bundle")
+		}
+		if isActive, _ := bundle["is_active"].(bool); !isActive {
+			return nil, http.StatusForbidden, fmt.Errorf("This bundle is not available for purchase")
+		}
+		price, _ := bundle["price"].(int32)
+		if price <= 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("This bundle is free and does not require payment")
+		}
+		if purchased, err := repository.HasPurchasedBundle(r.Context(), bundleID, userID); err == nil && purchased {
+			return nil, http.StatusConflict, fmt.Errorf("You already own this bundle")
+		}
+		name, _ := bundle["name"].(string)
+		return &purchaseItem{bundleID: bundleID, name: "Bundle: " + name, price: int(price)}, http.StatusOK, nil
+	}
+
+	model, err := repository.GetPublishedModelByID(r.Context(), modelID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, http.StatusNotFound, fmt.Errorf("Model not found")
+		}
+		log.Printf("[PAYMENT ERROR] Failed to fetch model %d: %v", modelID, err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to retrieve model")
+	}
+	if isActive, _ := model["is_active"].(bool); !isActive {
+		return nil, http.StatusForbidden, fmt.Errorf("This model is not available for purchase")
+	}
+	if getStringField(model, "visibility", repository.ListingVisibilityPublic) != repository.ListingVisibilityPublic {
+		return nil, http.StatusForbidden, fmt.Errorf("This model is not available for purchase")
+	}
+	price, _ := model["price"].(int32)
+	if price <= 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("This model is free and does not require payment")
+	}
+	if owned, err := repository.HasPublishedModelAccess(r.Context(), userID, modelID); err == nil && owned {
+		// Renters can renew or buy the model outright
+		if _, err := repository.GetModelRental(r.Context(), userID, modelID); err != nil {
+			return nil, http.StatusConflict, fmt.Errorf("You already own this model")
+		}
+	}
+	name, _ := model["name"].(string)
+	if name == "" {
+		name = fmt.Sprintf("Model #%d", modelID)
+	}
+	if rental {
+		rentalPrice := getIntField(model, "rental_price", 0)
+		if rentalPrice <= 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("This model is not available for rent")
+		}
+		days := getIntField(model, "rental_days", 30)
+		return &purchaseItem{modelID: modelID, name: name, price: rentalPrice, rentalDays: days}, http.StatusOK, nil
+	}
+	return &purchaseItem{modelID: modelID, name: name, price: int(price)}, http.StatusOK, nil
+}
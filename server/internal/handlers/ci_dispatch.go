@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	// ciSignatureHeader carries the HMAC-SHA256 of a CI dispatch, and of the callbacks sent back
+	ciSignatureHeader = "X-AIManage-Signature"
+	// ciDispatchMaxAge rejects replayed dispatches
+	ciDispatchMaxAge = 5 * time.Minute
+	// ciSyncTimeout bounds fetching the dispatched commit into the model folder
+	ciSyncTimeout = 10 * time.Minute
+	// ciStaleRunAge is when a run whose training the server lost track of is reported as an error
+	ciStaleRunAge = time.Hour
+	// ciStatusContext names the commit status on GitHub
+	ciStatusContext = "aimanage/training"
+	// maxCIDispatchSize bounds the dispatch payload
+	maxCIDispatchSize = 64 << 10
+	// githubAPIURL is where commit statuses are reported
+	githubAPIURL = "https://api.github.com"
+)
+
+var (
+	commitSHAPattern        = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	githubRepositoryPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+	ciStatusClient          = &http.Client{Timeout: 10 * time.Second}
+)
+
+// signCIPayload returns the signature header value of a payload signed with an integration secret
+func signCIPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validCIURL checks that a repository or callback URL is an http(s) URL
+func validCIURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// optionalString turns an empty string into NULL
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// ciIntegrationResponse is an integration as shown to its owner, without the GitHub token
+func ciIntegrationResponse(integration map[string]interface{}) map[string]interface{} {
+	response := map[string]interface{}{}
+	for _, key := range []string{"id", "model_id", "secret", "repository_url", "github_repository", "has_github_token", "callback_url", "created_at", "updated_at"} {
+		response[key] = integration[key]
+	}
+	return response
+}
+
+// GetCIIntegrationHandler returns the CI integration of one of the user's models with its latest runs
+func GetCIIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	integration, err := repository.GetCIIntegration(r.Context(), getIntField(model, "id", 0))
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "This model has no CI integration")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get CI integration: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve CI integration")
+		return
+	}
+
+	runs, err := repository.GetCIRuns(r.Context(), getIntField(integration, "id", 0), 20)
+	if err != nil {
+		log.Printf("❌ Failed to get CI runs: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve CI integration")
+		return
+	}
+	if runs == nil {
+		runs = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"integration": ciIntegrationResponse(integration),
+		"runs":        runs,
+	})
+}
+
+// PutCIIntegrationHandler creates or updates the CI integration of one of the user's models. The
+// signing secret is generated with the integration and replaced when rotate_secret is set. An
+// omitted github_token keeps the current one; an empty one removes it.
+func PutCIIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	model, userID, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	var req struct {
+		RepositoryURL    string  `json:"repository_url"`
+		GithubRepository string  `json:"github_repository"`
+		GithubToken      *string `json:"github_token"`
+		CallbackURL      string  `json:"callback_url"`
+		RotateSecret     bool    `json:"rotate_secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.RepositoryURL != "" && !validCIURL(req.RepositoryURL) {
+		apierrors.Respond(w, http.StatusBadRequest, "repository_url must be an http(s) URL")
+		return
+	}
+	if req.CallbackURL != "" && !validCIURL(req.CallbackURL) {
+		apierrors.Respond(w, http.StatusBadRequest, "callback_url must be an http(s) URL")
+		return
+	}
+	if req.GithubRepository != "" && !githubRepositoryPattern.MatchString(req.GithubRepository) {
+		apierrors.Respond(w, http.StatusBadRequest, "github_repository must look like owner/repo")
+		return
+	}
+
+	githubToken := req.GithubToken
+	if githubToken == nil {
+		existing, err := repository.GetCIIntegration(r.Context(), modelID)
+		if err != nil && err != pgx.ErrNoRows {
+			log.Printf("❌ Failed to get CI integration: %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to save CI integration")
+			return
+		}
+		if token, ok := existing["github_token"].(string); ok {
+			githubToken = &token
+		}
+	} else {
+		githubToken = optionalString(*githubToken)
+	}
+	if githubToken != nil && req.GithubRepository == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "github_repository is required with a github_token")
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("❌ Failed to generate CI secret: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save CI integration")
+		return
+	}
+
+	integration, err := repository.UpsertCIIntegration(r.Context(), modelID, userID, hex.EncodeToString(secret), req.RotateSecret,
+		optionalString(req.RepositoryURL), optionalString(req.GithubRepository), githubToken, optionalString(req.CallbackURL))
+	if err != nil {
+		log.Printf("❌ Failed to save CI integration of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save CI integration")
+		return
+	}
+	log.Printf("🔗 User %d configured the CI integration of model %d", userID, modelID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"integration": ciIntegrationResponse(integration),
+	})
+}
+
+// DeleteCIIntegrationHandler removes the CI integration of one of the user's models
+func DeleteCIIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := repository.DeleteCIIntegration(r.Context(), getIntField(model, "id", 0))
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to delete CI integration")
+		return
+	}
+	if !deleted {
+		apierrors.Respond(w, http.StatusNotFound, "This model has no CI integration")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "CI integration removed",
+	})
+}
+
+// ciDispatch is the payload CI sends to retrain a model on a commit
+type ciDispatch struct {
+	ModelID   int               `json:"model_id"`
+	CommitSHA string            `json:"commit_sha"`
+	Timestamp int64             `json:"timestamp"`
+	Profile   ciTrainingProfile `json:"profile"`
+}
+
+// CIDispatchHandler accepts a dispatch signed with a model's CI integration secret. It responds
+// once the dispatch is verified; fetching the commit and starting the training happen in the
+// background and their outcome is reported back like the training's result.
+func (h *TrainingHandler) CIDispatchHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxCIDispatchSize))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	var dispatch ciDispatch
+	if err := json.Unmarshal(payload, &dispatch); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	integration, err := repository.GetCIIntegration(r.Context(), dispatch.ModelID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "This model has no CI integration")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get CI integration: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to check dispatch")
+		return
+	}
+
+	expected := signCIPayload(getStringField(integration, "secret", ""), payload)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(ciSignatureHeader))) {
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid signature")
+		return
+	}
+	if age := time.Since(time.Unix(dispatch.Timestamp, 0)); age > ciDispatchMaxAge || age < -ciDispatchMaxAge {
+		apierrors.Respond(w, http.StatusUnauthorized, "Dispatch timestamp is too old or in the future")
+		return
+	}
+	if !commitSHAPattern.MatchString(dispatch.CommitSHA) {
+		apierrors.Respond(w, http.StatusBadRequest, "commit_sha must be a full lowercase commit SHA")
+		return
+	}
+	if err := dispatch.Profile.validate(getStringField(integration, "training_script", "")); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	runID, err := repository.CreateCIRun(r.Context(), getIntField(integration, "id", 0), dispatch.CommitSHA)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to start CI run")
+		return
+	}
+	if runID == 0 {
+		apierrors.Respond(w, http.StatusConflict, "This commit is already being trained")
+		return
+	}
+	log.Printf("🔗 CI dispatch of model %d at %s (run %d)", dispatch.ModelID, dispatch.CommitSHA[:7], runID)
+
+	go h.runCIDispatch(runID, integration, dispatch)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"run_id":  runID,
+		"message": "Dispatch accepted, the training status will be reported back",
+	})
+}
+
+// runCIDispatch fetches the dispatched commit into the model folder and starts its training
+func (h *TrainingHandler) runCIDispatch(runID int, integration map[string]interface{}, dispatch ciDispatch) {
+	ctx := context.Background()
+	report := ciReportTarget(integration, dispatch.CommitSHA)
+	report.send(ctx, repository.CIRunPending, "", "Preparing training")
+
+	fail := func(message string) {
+		log.Printf("❌ CI run %d failed to start: %s", runID, message)
+		if err := repository.UpdateCIRun(ctx, runID, repository.CIRunError, "", message); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+		report.send(ctx, repository.CIRunError, "", message)
+	}
+
+	if repositoryURL := getStringField(integration, "repository_url", ""); repositoryURL != "" {
+		folder := ""
+		if folders, ok := integration["folder"].([]interface{}); ok && len(folders) > 0 {
+			folder, _ = folders[0].(string)
+		}
+		if folder == "" {
+			fail("The model has no folder to sync the repository into")
+			return
+		}
+		if err := syncCIRepository(ctx, folder, repositoryURL, dispatch.CommitSHA); err != nil {
+			log.Printf("⚠️  CI run %d: %v", runID, err)
+			fail("Failed to fetch the commit into the model folder")
+			return
+		}
+	}
+
+	// startTraining reads the user's email from the request context, as for requests from the frontend
+	email := getStringField(integration, "email", "")
+	req, _ := http.NewRequestWithContext(context.WithValue(ctx, middlewares.UserEmailKey, email), http.MethodPost, "/v1/ci/dispatch", nil)
+	result, startErr := h.startTraining(req, email, aiAgent.TrainingRequest{
+		ModelID:       dispatch.ModelID,
+		ScriptName:    dispatch.Profile.ScriptName,
+		PythonCommand: dispatch.Profile.PythonCommand,
+		Args:          dispatch.Profile.Args,
+		Env:           dispatch.Profile.Env,
+		ExecutionMode: dispatch.Profile.ExecutionMode,
+	})
+	if startErr != nil {
+		fail(startErr.Message)
+		return
+	}
+
+	trainingID := getStringField(result, "training_id", "")
+	if err := repository.UpdateCIRun(ctx, runID, repository.CIRunRunning, trainingID, ""); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	report.send(ctx, repository.CIRunPending, trainingID, "Training "+trainingID+" is running")
+}
+
+// syncCIRepository checks a commit of the repository out into a model folder. Files the commit
+// tracks are overwritten; datasets and trained models that are not in the repository are kept.
+func syncCIRepository(ctx context.Context, folder, repositoryURL, commitSHA string) error {
+	ctx, cancel := context.WithTimeout(ctx, ciSyncTimeout)
+	defer cancel()
+
+	dir := filepath.Join(uploadsBaseDir(), strings.TrimPrefix(strings.TrimPrefix(folder, "./uploads/"), "uploads/"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create model folder: %w", err)
+	}
+
+	git := func(args ...string) error {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			// The URL may hold credentials, so only the subcommand is logged
+			return fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := git("init", "--quiet"); err != nil {
+			return err
+		}
+	}
+	if err := git("fetch", "--quiet", "--depth", "1", repositoryURL, commitSHA); err != nil {
+		return err
+	}
+	return git("checkout", "--quiet", "--force", "FETCH_HEAD")
+}
+
+// ciReport is where the status of a CI run is reported
+type ciReport struct {
+	modelID          int
+	commitSHA        string
+	secret           string
+	githubRepository string
+	githubToken      string
+	callbackURL      string
+}
+
+func ciReportTarget(row map[string]interface{}, commitSHA string) ciReport {
+	return ciReport{
+		modelID:          getIntField(row, "model_id", 0),
+		commitSHA:        commitSHA,
+		secret:           getStringField(row, "secret", ""),
+		githubRepository: getStringField(row, "github_repository", ""),
+		githubToken:      getStringField(row, "github_token", ""),
+		callbackURL:      getStringField(row, "callback_url", ""),
+	}
+}
+
+// send reports a run status as a GitHub commit status and to the callback URL, when configured
+func (c ciReport) send(ctx context.Context, status, trainingID, description string) {
+	if c.githubRepository != "" && c.githubToken != "" {
+		// GitHub descriptions are limited to 140 characters
+		if len(description) > 140 {
+			description = description[:137] + "..."
+		}
+		body, _ := json.Marshal(map[string]string{
+			"state":       status,
+			"description": description,
+			"context":     ciStatusContext,
+		})
+		statusURL := fmt.Sprintf("%s/repos/%s/statuses/%s", githubAPIURL, c.githubRepository, c.commitSHA)
+		c.post(ctx, statusURL, body, map[string]string{
+			"Authorization": "Bearer " + c.githubToken,
+			"Accept":        "application/vnd.github+json",
+		})
+	}
+
+	if c.callbackURL != "" {
+		body, _ := json.Marshal(map[string]interface{}{
+			"model_id":    c.modelID,
+			"commit_sha":  c.commitSHA,
+			"training_id": trainingID,
+			"status":      status,
+			"message":     description,
+		})
+		c.post(ctx, c.callbackURL, body, map[string]string{ciSignatureHeader: signCIPayload(c.secret, body)})
+	}
+}
+
+func (c ciReport) post(ctx context.Context, target string, body []byte, headers map[string]string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("⚠️  Failed to report CI status of model %d: %v", c.modelID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := ciStatusClient.Do(req)
+	if err != nil {
+		log.Printf("⚠️  Failed to report CI status of model %d: %v", c.modelID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("⚠️  Reporting CI status of model %d returned %d", c.modelID, resp.StatusCode)
+	}
+}
+
+// StartCIStatusReporter reports, every 30 seconds, the result of CI runs whose training ended
+func StartCIStatusReporter() {
+	go func() {
+		for {
+			if err := reportCIRuns(context.Background()); err != nil {
+				log.Printf("⚠️  CI status reporting failed: %v", err)
+			}
+			time.Sleep(30 * time.Second)
+		}
+	}()
+}
+
+// reportCIRuns reports completed and failed trainings of CI runs, and gives up on runs the server
+// lost track of, e.g. across a restart
+func reportCIRuns(ctx context.Context) error {
+	runs, err := repository.GetActiveCIRuns(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		runID := getIntField(run, "id", 0)
+		trainingID := getStringField(run, "training_id", "")
+		createdAt, _ := run["created_at"].(time.Time)
+
+		status, message := "", ""
+		var progress *aiAgent.TrainingProgress
+		if trainer := GetGlobalTrainer(); trainer != nil && trainingID != "" {
+			progress, _ = trainer.GetProgress(trainingID)
+		}
+		switch {
+		case progress != nil:
+			snapshot := progress.Snapshot()
+			switch snapshot.Status {
+			case aiAgent.StatusCompleted:
+				status, message = repository.CIRunSuccess, "Training "+trainingID+" completed"
+			case aiAgent.StatusFailed:
+				status, message = repository.CIRunFailure, "Training "+trainingID+" failed"
+			}
+		case time.Since(createdAt) > ciStaleRunAge:
+			// Agents only report a training once it started, so a missing one is given time
+			status, message = repository.CIRunError, "The server lost track of the training"
+		}
+		if status == "" {
+			continue
+		}
+
+		if err := repository.UpdateCIRun(ctx, runID, status, "", message); err != nil {
+			log.Printf("⚠️  %v", err)
+			continue
+		}
+		ciReportTarget(run, getStringField(run, "commit_sha", "")).send(ctx, status, trainingID, message)
+		log.Printf("🏁 CI run %d finished: %s", runID, status)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TrustedProxiesEnv lists the reverse proxies, as IPs or CIDRs separated by commas, whose
+// X-Forwarded-For and X-Real-IP headers are believed. It defaults to loopback addresses, for a
+// proxy on the same host; set it to "none" when clients connect directly.
+const TrustedProxiesEnv = "TRUSTED_PROXIES"
+
+const defaultTrustedProxies = "127.0.0.0/8,::1/128"
+
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []*net.IPNet
+)
+
+// parseTrustedProxies parses a TRUSTED_PROXIES value, skipping invalid entries
+func parseTrustedProxies(value string) []*net.IPNet {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.EqualFold(entry, "none") {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("⚠️  Invalid %s entry %q, ignoring it", TrustedProxiesEnv, entry)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies
+}
+
+// trustedProxyNetworks returns the configured trusted proxies
+func trustedProxyNetworks() []*net.IPNet {
+	trustedProxiesOnce.Do(func() {
+		value, ok := os.LookupEnv(TrustedProxiesEnv)
+		if !ok {
+			value = defaultTrustedProxies
+		}
+		trustedProxies = parseTrustedProxies(value)
+	})
+	return trustedProxies
+}
+
+// isTrustedProxy reports whether ip belongs to one of the proxies
+func isTrustedProxy(ip net.IP, proxies []*net.IPNet) bool {
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client, or nil when the peer address does not parse
+func clientIP(r *http.Request) net.IP {
+	return clientIPBehind(r, trustedProxyNetworks())
+}
+
+// clientIPBehind returns the address of the client when the proxies are trusted. Forwarding
+// headers are only read from a trusted peer, and the client is the rightmost X-Forwarded-For hop
+// that is not a trusted proxy: the hops left of it were written by the client and can be made up.
+func clientIPBehind(r *http.Request, proxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !isTrustedProxy(peer, proxies) {
+		return peer
+	}
+
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				// Nothing left of a malformed hop can be told apart from what the client wrote
+				return client
+			}
+			client = ip
+			if !isTrustedProxy(ip, proxies) {
+				break
+			}
+		}
+		return client
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip
+	}
+	return peer
+}
+
+// clientAddress returns the client IP as a string, or the raw peer address when it does not
+// parse, so such clients do not share one key
+func clientAddress(r *http.Request) string {
+	if ip := clientIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"server/internal/repository"
+	"server/internal/testutil/pgtest"
+)
+
+func TestClientIPBehind(t *testing.T) {
+	proxies := parseTrustedProxies("127.0.0.0/8, 10.0.0.5")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:4000", want: "203.0.113.7"},
+		{name: "spoofed X-Forwarded-For from an untrusted peer", remoteAddr: "203.0.113.7:4000", forwarded: "198.51.100.1", want: "203.0.113.7"},
+		{name: "spoofed X-Real-IP from an untrusted peer", remoteAddr: "203.0.113.7:4000", realIP: "198.51.100.1", want: "203.0.113.7"},
+		{name: "client through a trusted proxy", remoteAddr: "127.0.0.1:4000", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "made-up hops left of the client", remoteAddr: "127.0.0.1:4000", forwarded: "192.0.2.99, 198.51.100.1", want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "127.0.0.1:4000", forwarded: "192.0.2.99, 198.51.100.1, 10.0.0.5", want: "198.51.100.1"},
+		{name: "X-Real-IP through a trusted proxy", remoteAddr: "127.0.0.1:4000", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "malformed X-Forwarded-For", remoteAddr: "127.0.0.1:4000", forwarded: "not-an-ip", want: "127.0.0.1"},
+		{name: "malformed hop left of the client", remoteAddr: "127.0.0.1:4000", forwarded: "garbage, 198.51.100.1", want: "198.51.100.1"},
+		{name: "malformed hop behind a trusted proxy", remoteAddr: "127.0.0.1:4000", forwarded: "198.51.100.1, garbage, 10.0.0.5", want: "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := clientIPBehind(r, proxies); got.String() != tt.want {
+				t.Errorf("clientIPBehind = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitKeysUsePeerAddress(t *testing.T) {
+	// httptest requests come from 192.0.2.1, which is not a trusted proxy by default
+	first := httptest.NewRequest("POST", "/v1/login", nil)
+	first.Header.Set("X-Forwarded-For", "198.51.100.1")
+	second := httptest.NewRequest("POST", "/v1/login", nil)
+	second.Header.Set("X-Forwarded-For", "198.51.100.2")
+
+	if got, want := rateLimitKeys(first)[0], "ip:192.0.2.1"; got != want {
+		t.Errorf("key of a spoofed X-Forwarded-For = %q, want %q", got, want)
+	}
+	if rateLimitKeys(first)[0] != rateLimitKeys(second)[0] {
+		t.Error("rotating X-Forwarded-For changed the rate limit key")
+	}
+
+	malformed := httptest.NewRequest("POST", "/v1/login", nil)
+	malformed.RemoteAddr = "unix-socket"
+	if got, want := rateLimitKeys(malformed)[0], "ip:unix-socket"; got != want {
+		t.Errorf("key of an unparsable peer = %q, want %q", got, want)
+	}
+}
+
+func TestStartSessionRecordsPeerIP(t *testing.T) {
+	pgtest.Require(t)
+	user := pgtest.CreateUser(t)
+
+	r := httptest.NewRequest("POST", "/v1/login", nil)
+	r.RemoteAddr = "203.0.113.7:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if _, _, err := startSession(r, user.ID, user.Email); err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+
+	sessions, err := repository.GetUserSessions(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetUserSessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(sessions))
+	}
+	if got := sessions[0]["ip_address"]; got != "203.0.113.7" {
+		t.Errorf("session IP = %v, want the peer address 203.0.113.7", got)
+	}
+}
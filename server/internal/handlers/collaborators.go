@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/apierrors"
+	"server/internal/email"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Roles of a user on a model. Read collaborators can view and download the model, train
+// collaborators can also train it, subject to the owner's training settings.
+const (
+	ModelRoleOwner        = "owner"
+	CollaboratorRoleRead  = "read"
+	CollaboratorRoleTrain = "train"
+)
+
+// collaboratorInvitationTTL is how long an invitation to collaborate can be accepted
+const collaboratorInvitationTTL = 14 * 24 * time.Hour
+
+// validCollaboratorRole reports whether role can be given to a collaborator
+func validCollaboratorRole(role string) bool {
+	return role == CollaboratorRoleRead || role == CollaboratorRoleTrain
+}
+
+// modelRole returns the role of a user on a model: owner, train, read, or "" without access
+func modelRole(ctx context.Context, model map[string]interface{}, userID int) (string, error) {
+	if getIntField(model, "user_id", 0) == userID {
+		return ModelRoleOwner, nil
+	}
+	return repository.GetModelCollaboratorRole(ctx, getIntField(model, "id", 0), userID)
+}
+
+// getModelForCollaborator loads the model from the URL and verifies the current user owns it or
+// collaborates on it. It returns the model, the user ID and their role.
+func getModelForCollaborator(w http.ResponseWriter, r *http.Request) (map[string]interface{}, int, string, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, 0, "", false
+	}
+
+	modelID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return nil, 0, "", false
+	}
+
+	model, err := repository.GetModelByID(r.Context(), modelID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return nil, 0, "", false
+		}
+		log.Printf("❌ Failed to get model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get model")
+		return nil, 0, "", false
+	}
+
+	role, err := modelRole(r.Context(), *model, userID)
+	if err != nil {
+		log.Printf("❌ Failed to check access of user %d to model %d: %v", userID, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to check permissions")
+		return nil, 0, "", false
+	}
+	if role == "" {
+		apierrors.Respond(w, http.StatusNotFound, "Model not found")
+		return nil, 0, "", false
+	}
+	return *model, userID, role, true
+}
+
+// GetModelCollaboratorsHandler lists the collaborators of one of the user's models and the
+// invitations that were not answered yet
+func GetModelCollaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	collaborators, err := repository.GetModelCollaborators(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to get collaborators of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get collaborators")
+		return
+	}
+	invitations, err := repository.GetPendingModelCollaboratorInvitations(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to get invitations of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get collaborators")
+		return
+	}
+	if collaborators == nil {
+		collaborators = []map[string]interface{}{}
+	}
+	if invitations == nil {
+		invitations = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"collaborators": collaborators,
+		"invitations":   invitations,
+	})
+}
+
+// InviteModelCollaboratorHandler invites an email address to collaborate on one of the user's
+// models with the read or train role. Registered users are notified, others get an email.
+func InviteModelCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	model, ownerID, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	address, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "A valid email is required")
+		return
+	}
+	inviteEmail := strings.ToLower(address.Address)
+	if req.Role == "" {
+		req.Role = CollaboratorRoleRead
+	}
+	if !validCollaboratorRole(req.Role) {
+		apierrors.Respond(w, http.StatusBadRequest, "role must be 'read' or 'train'")
+		return
+	}
+
+	ownerEmail, _ := r.Context().Value(middlewares.UserEmailKey).(string)
+	if strings.EqualFold(ownerEmail, inviteEmail) {
+		apierrors.Respond(w, http.StatusBadRequest, "You already own this model")
+		return
+	}
+	invitee, _ := repository.GetUserByEmail(r.Context(), inviteEmail)
+	if invitee != nil {
+		role, err := repository.GetModelCollaboratorRole(r.Context(), modelID, getIntField(*invitee, "id", 0))
+		if err != nil {
+			log.Printf("❌ Failed to check collaborators of model %d: %v", modelID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to invite collaborator")
+			return
+		}
+		if role != "" {
+			apierrors.Respond(w, http.StatusConflict, "This user already collaborates on the model, change their role instead")
+			return
+		}
+	}
+
+	invitation, err := repository.CreateModelCollaboratorInvitation(r.Context(), modelID, inviteEmail, req.Role, ownerID, time.Now().Add(collaboratorInvitationTTL))
+	if err != nil {
+		log.Printf("❌ Failed to invite %s to model %d: %v", inviteEmail, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to invite collaborator")
+		return
+	}
+	log.Printf("🤝 User %d invited %s to model %d as %s", ownerID, inviteEmail, modelID, req.Role)
+
+	name := getStringField(model, "name", fmt.Sprintf("Model #%d", modelID))
+	n := Notification{
+		Type:    NotificationCollaboratorInvite,
+		Title:   fmt.Sprintf("Invitation to collaborate on %s", name),
+		Message: fmt.Sprintf("You were invited to %s %s. The invitation expires in %d days.", collaboratorRoleAction(req.Role), name, int(collaboratorInvitationTTL.Hours()/24)),
+		Link:    "/collaborations",
+		Data:    map[string]interface{}{"model_id": modelID, "invitation_id": getIntField(invitation, "id", 0), "role": req.Role},
+	}
+	go func() {
+		if invitee != nil {
+			notifyUser(context.Background(), getIntField(*invitee, "id", 0), n, inviteEmail, getStringField(*invitee, "username", ""))
+			return
+		}
+		if err := email.NewEmailService().SendNotificationEmail(inviteEmail, "", n.Title, n.Message+" Sign up with this email to accept it.", "/register"); err != nil {
+			log.Printf("⚠️  Failed to email the invitation to model %d: %v", modelID, err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"invitation": invitation,
+	})
+}
+
+// collaboratorRoleAction describes what a role allows, for invitation messages
+func collaboratorRoleAction(role string) string {
+	if role == CollaboratorRoleTrain {
+		return "view and train"
+	}
+	return "view"
+}
+
+// UpdateModelCollaboratorHandler changes the role of a collaborator on one of the user's models
+func UpdateModelCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	collaboratorID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validCollaboratorRole(req.Role) {
+		apierrors.Respond(w, http.StatusBadRequest, "role must be 'read' or 'train'")
+		return
+	}
+
+	updated, err := repository.UpdateModelCollaboratorRole(r.Context(), modelID, collaboratorID, req.Role)
+	if err != nil {
+		log.Printf("❌ Failed to update collaborator %d of model %d: %v", collaboratorID, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update collaborator")
+		return
+	}
+	if !updated {
+		apierrors.Respond(w, http.StatusNotFound, "Collaborator not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"user_id": collaboratorID,
+		"role":    req.Role,
+	})
+}
+
+// RemoveModelCollaboratorHandler revokes a collaborator's access to a model. Collaborators can
+// also remove themselves.
+func RemoveModelCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	model, userID, role, ok := getModelForCollaborator(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	collaboratorID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if role != ModelRoleOwner && collaboratorID != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the model owner can remove other collaborators")
+		return
+	}
+
+	removed, err := repository.RemoveModelCollaborator(r.Context(), modelID, collaboratorID)
+	if err != nil {
+		log.Printf("❌ Failed to remove collaborator %d of model %d: %v", collaboratorID, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove collaborator")
+		return
+	}
+	if !removed {
+		apierrors.Respond(w, http.StatusNotFound, "Collaborator not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Collaborator removed",
+	})
+}
+
+// RevokeModelCollaboratorInvitationHandler withdraws a pending invitation to one of the user's models
+func RevokeModelCollaboratorInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	invitationID, err := strconv.Atoi(chi.URLParam(r, "invitationId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+	revoked, err := repository.RevokeModelCollaboratorInvitation(r.Context(), modelID, invitationID)
+	if err != nil {
+		log.Printf("❌ Failed to revoke invitation %d of model %d: %v", invitationID, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to revoke invitation")
+		return
+	}
+	if !revoked {
+		apierrors.Respond(w, http.StatusNotFound, "Invitation not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Invitation revoked",
+	})
+}
+
+// GetMyCollaboratorInvitationsHandler lists the pending invitations sent to the user's email
+func GetMyCollaboratorInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok || userEmail == "" {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	invitations, err := repository.GetUserCollaboratorInvitations(r.Context(), userEmail)
+	if err != nil {
+		log.Printf("❌ Failed to get invitations of %s: %v", userEmail, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get invitations")
+		return
+	}
+	if invitations == nil {
+		invitations = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"invitations": invitations,
+	})
+}
+
+// RespondCollaboratorInvitationHandler accepts (POST .../accept) or declines (POST .../decline) an
+// invitation sent to the user's email
+func RespondCollaboratorInvitationHandler(accept bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+		userEmail, hasEmail := r.Context().Value(middlewares.UserEmailKey).(string)
+		if !ok || !hasEmail || userEmail == "" {
+			apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		invitationID, err := strconv.Atoi(chi.URLParam(r, "invitationId"))
+		if err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid invitation ID")
+			return
+		}
+
+		if !accept {
+			declined, err := repository.DeclineModelCollaboratorInvitation(r.Context(), invitationID, userEmail)
+			if err != nil {
+				log.Printf("❌ Failed to decline invitation %d: %v", invitationID, err)
+				apierrors.Respond(w, http.StatusInternalServerError, "Failed to decline invitation")
+				return
+			}
+			if !declined {
+				apierrors.Respond(w, http.StatusNotFound, "Invitation not found")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"message": "Invitation declined",
+			})
+			return
+		}
+
+		modelID, role, err := repository.AcceptModelCollaboratorInvitation(r.Context(), invitationID, userID, userEmail)
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Invitation not found or expired")
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Failed to accept invitation %d: %v", invitationID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to accept invitation")
+			return
+		}
+		log.Printf("🤝 User %d now collaborates on model %d as %s", userID, modelID, role)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"model_id": modelID,
+			"role":     role,
+		})
+	}
+}
+
+// GetSharedModelsHandler lists the models other users shared with the current user and their role on each
+func GetSharedModelsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sharedModels, err := repository.GetCollaboratorModels(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get models shared with user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get shared models")
+		return
+	}
+	if sharedModels == nil {
+		sharedModels = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"models":  sharedModels,
+	})
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Collection limits
+const (
+	maxCollections              = 50
+	maxCollectionNameLength     = 100
+	maxCollectionDescriptionLen = 1000
+	maxCollectionSlugBase       = 60
+)
+
+// collectionSlug derives the share slug of a collection from its name, with a random suffix so
+// slugs cannot be guessed from names: "Vision models" -> "vision-models-3f9a1c2b"
+func collectionSlug(name string) (string, error) {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= maxCollectionSlugBase {
+			break
+		}
+	}
+	base := strings.Trim(b.String(), "-")
+	if base == "" {
+		base = "collection"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
+
+// validateCollectionFields trims and checks the name and description of a collection
+func validateCollectionFields(name, description *string) error {
+	if name != nil {
+		*name = strings.TrimSpace(*name)
+		if *name == "" || utf8.RuneCountInString(*name) > maxCollectionNameLength {
+			return fmt.Errorf("name must be between 1 and %d characters", maxCollectionNameLength)
+		}
+	}
+	if description != nil {
+		*description = strings.TrimSpace(*description)
+		if utf8.RuneCountInString(*description) > maxCollectionDescriptionLen {
+			return fmt.Errorf("description cannot be longer than %d characters", maxCollectionDescriptionLen)
+		}
+	}
+	return nil
+}
+
+// getOwnCollection loads the caller's collection of the URL, writing the error response otherwise
+func getOwnCollection(w http.ResponseWriter, r *http.Request) (int, map[string]interface{}, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return 0, nil, false
+	}
+	collectionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid collection ID")
+		return 0, nil, false
+	}
+
+	collection, err := repository.GetCollection(r.Context(), userID, collectionID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Collection not found")
+		return 0, nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get collection %d: %v", collectionID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve collection")
+		return 0, nil, false
+	}
+	return userID, collection, true
+}
+
+// writeCollection responds with a collection and the listings in it the viewer can see
+func writeCollection(w http.ResponseWriter, r *http.Request, collection map[string]interface{}, viewerID int) {
+	collectionID := getIntField(collection, "id", 0)
+	items, err := repository.GetCollectionItems(r.Context(), collectionID, viewerID)
+	if err != nil {
+		log.Printf("❌ Failed to get items of collection %d: %v", collectionID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve collection")
+		return
+	}
+	if items == nil {
+		items = []map[string]interface{}{}
+	}
+	localizeListings(w, r, items)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"collection": collection,
+		"models":     items,
+	})
+}
+
+// GetCollectionsHandler lists the caller's collections with the number of listings in each
+func GetCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	collections, err := repository.GetCollections(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get collections of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve collections")
+		return
+	}
+	if collections == nil {
+		collections = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"collections": collections,
+	})
+}
+
+// CreateCollectionHandler creates a collection: {"name": "...", "description": "...", "public": false}.
+// Public collections can be viewed by anyone at /shared/collections/{slug}.
+func CreateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validateCollectionFields(&req.Name, &req.Description); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	count, err := repository.CountCollections(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to count collections of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create collection")
+		return
+	}
+	if count >= maxCollections {
+		apierrors.Respond(w, http.StatusConflict, fmt.Sprintf("You can have at most %d collections", maxCollections))
+		return
+	}
+
+	slug, err := collectionSlug(req.Name)
+	if err != nil {
+		log.Printf("❌ Failed to generate collection slug: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create collection")
+		return
+	}
+	collectionID, err := repository.CreateCollection(r.Context(), userID, req.Name, req.Description, req.Public, slug)
+	if err == repository.ErrCollectionExists {
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to create collection for user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create collection")
+		return
+	}
+
+	collection, err := repository.GetCollection(r.Context(), userID, collectionID)
+	if err != nil {
+		log.Printf("⚠️  Failed to reload collection %d: %v", collectionID, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"collection": collection,
+	})
+}
+
+// GetCollectionHandler returns one of the caller's collections with its listings
+func GetCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collection, ok := getOwnCollection(w, r)
+	if !ok {
+		return
+	}
+	writeCollection(w, r, collection, userID)
+}
+
+// UpdateCollectionHandler renames, describes or shares one of the caller's collections.
+// Omitted fields are left unchanged; the share slug stays the same.
+func UpdateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collection, ok := getOwnCollection(w, r)
+	if !ok {
+		return
+	}
+	collectionID := getIntField(collection, "id", 0)
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Public      *bool   `json:"public"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validateCollectionFields(req.Name, req.Description); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := repository.UpdateCollection(r.Context(), userID, collectionID, req.Name, req.Description, req.Public)
+	if err == repository.ErrCollectionExists {
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to update collection %d: %v", collectionID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update collection")
+		return
+	}
+	if !updated {
+		apierrors.Respond(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+
+	if collection, err = repository.GetCollection(r.Context(), userID, collectionID); err != nil {
+		log.Printf("⚠️  Failed to reload collection %d: %v", collectionID, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"collection": collection,
+	})
+}
+
+// DeleteCollectionHandler deletes one of the caller's collections. The listings stay published.
+func DeleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collection, ok := getOwnCollection(w, r)
+	if !ok {
+		return
+	}
+	collectionID := getIntField(collection, "id", 0)
+
+	if _, err := repository.DeleteCollection(r.Context(), userID, collectionID); err != nil {
+		log.Printf("❌ Failed to delete collection %d: %v", collectionID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to delete collection")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"collection_id": collectionID,
+	})
+}
+
+// AddCollectionItemHandler saves a listing the caller can see into one of their collections:
+// {"model_id": 42}
+func AddCollectionItemHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collection, ok := getOwnCollection(w, r)
+	if !ok {
+		return
+	}
+	collectionID := getIntField(collection, "id", 0)
+
+	var req struct {
+		ModelID int `json:"model_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ModelID <= 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "model_id is required")
+		return
+	}
+
+	visible, err := repository.CanViewListing(r.Context(), req.ModelID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to check access to listing %d: %v", req.ModelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to add model")
+		return
+	}
+	if !visible {
+		apierrors.Respond(w, http.StatusNotFound, "Model not found")
+		return
+	}
+
+	if err := repository.AddCollectionItem(r.Context(), collectionID, req.ModelID); err != nil {
+		log.Printf("❌ Failed to add listing %d to collection %d: %v", req.ModelID, collectionID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to add model")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"collection_id": collectionID,
+		"model_id":      req.ModelID,
+	})
+}
+
+// RemoveCollectionItemHandler removes a listing from one of the caller's collections
+func RemoveCollectionItemHandler(w http.ResponseWriter, r *http.Request) {
+	_, collection, ok := getOwnCollection(w, r)
+	if !ok {
+		return
+	}
+	collectionID := getIntField(collection, "id", 0)
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "modelId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	removed, err := repository.RemoveCollectionItem(r.Context(), collectionID, listingID)
+	if err != nil {
+		log.Printf("❌ Failed to remove listing %d from collection %d: %v", listingID, collectionID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove model")
+		return
+	}
+	if !removed {
+		apierrors.Respond(w, http.StatusNotFound, "Model is not in this collection")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"collection_id": collectionID,
+		"model_id":      listingID,
+	})
+}
+
+// GetSharedCollectionHandler returns a public collection by its slug with the listings in it the
+// visitor can see. No authentication is required.
+func GetSharedCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	collection, err := repository.GetPublicCollection(r.Context(), slug)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get shared collection %s: %v", slug, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve collection")
+		return
+	}
+
+	viewerID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	writeCollection(w, r, collection, viewerID)
+}
+
+// markSavedListings sets "saved" on listings the viewer put in one of their collections
+func markSavedListings(r *http.Request, listings []map[string]interface{}, viewerID int) {
+	saved := map[int]bool{}
+	if viewerID != 0 {
+		var err error
+		if saved, err = repository.GetSavedListingIDs(r.Context(), viewerID); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+	for _, listing := range listings {
+		listing["saved"] = saved[getIntField(listing, "id", 0)]
+	}
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	maxCommentLength       = 2000
+	maxCommentReportLength = 1000
+)
+
+// Roles of the users who moderate the comments on a listing
+const (
+	commentModeratorPublisher = "publisher"
+	commentModeratorAdmin     = "admin"
+)
+
+// commentModeratorRole returns how a user may moderate the comments on a listing: as its publisher,
+// as an admin, or not at all (""). Returns pgx.ErrNoRows when there is no such listing.
+func commentModeratorRole(ctx context.Context, listingID, userID int) (string, error) {
+	listing, err := repository.GetListingModeration(ctx, listingID)
+	if err != nil {
+		return "", err
+	}
+	if getIntField(listing, "publisher_id", 0) == userID {
+		return commentModeratorPublisher, nil
+	}
+	isAdmin, err := repository.IsAdmin(ctx, userID)
+	if err != nil || !isAdmin {
+		return "", err
+	}
+	return commentModeratorAdmin, nil
+}
+
+// commentViewer returns the signed-in user, 0 for guests, and whether they moderate the comments
+// of a listing, for showing them hidden comments
+func commentViewer(r *http.Request, listingID int) (int, bool) {
+	viewerID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	if viewerID == 0 {
+		return 0, false
+	}
+	role, err := commentModeratorRole(r.Context(), listingID, viewerID)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Printf("⚠️  Failed to check comment moderation of model %d by user %d: %v", listingID, viewerID, err)
+	}
+	return viewerID, role != ""
+}
+
+// getListingComment loads the comment of the URL on the listing of the URL, writing the error
+// response otherwise
+func getListingComment(w http.ResponseWriter, r *http.Request) (int, map[string]interface{}, bool) {
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return 0, nil, false
+	}
+	commentID, err := strconv.Atoi(chi.URLParam(r, "commentId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid comment ID")
+		return 0, nil, false
+	}
+
+	comment, err := repository.GetListingComment(r.Context(), listingID, commentID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Comment not found")
+		return 0, nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get comment %d of model %d: %v", commentID, listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve comment")
+		return 0, nil, false
+	}
+	return listingID, comment, true
+}
+
+// getModeratedComment loads the comment of the URL for the publisher of its listing or an admin,
+// writing the error response otherwise. It also returns the moderator's ID and role.
+func getModeratedComment(w http.ResponseWriter, r *http.Request) (int, string, map[string]interface{}, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return 0, "", nil, false
+	}
+	listingID, comment, ok := getListingComment(w, r)
+	if !ok {
+		return 0, "", nil, false
+	}
+
+	role, err := commentModeratorRole(r.Context(), listingID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to check comment moderation of model %d by user %d: %v", listingID, userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to check permissions")
+		return 0, "", nil, false
+	}
+	if role == "" {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher of this model or an admin can moderate its comments")
+		return 0, "", nil, false
+	}
+	return userID, role, comment, true
+}
+
+// commentAuditDetails describes a moderated comment for the audit log
+func commentAuditDetails(comment map[string]interface{}, role string) map[string]interface{} {
+	return map[string]interface{}{
+		"published_model_id": getIntField(comment, "published_model_id", 0),
+		"author_id":          getIntField(comment, "user_id", 0),
+		"moderator_role":     role,
+	}
+}
+
+// UpdateModelCommentHandler lets the author of a comment change its text: {"comment_text": "..."}.
+// The comment is marked edited.
+func UpdateModelCommentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	_, comment, ok := getListingComment(w, r)
+	if !ok {
+		return
+	}
+	if getIntField(comment, "user_id", 0) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the author can edit a comment")
+		return
+	}
+
+	var req struct {
+		CommentText string `json:"comment_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.CommentText = strings.TrimSpace(req.CommentText)
+	if req.CommentText == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "comment_text is required")
+		return
+	}
+	if len(req.CommentText) > maxCommentLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("comment_text cannot be longer than %d characters", maxCommentLength))
+		return
+	}
+
+	updated, err := repository.UpdateCommentText(r.Context(), getIntField(comment, "id", 0), userID, req.CommentText)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to update comment %d: %v", getIntField(comment, "id", 0), err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update comment")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"comment": updated,
+	})
+}
+
+// ReportModelCommentHandler reports a comment to the publisher of the model and admins:
+// {"reason": "..."}. Each user can report a comment once.
+func ReportModelCommentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	listingID, comment, ok := getListingComment(w, r)
+	if !ok {
+		return
+	}
+	commentID := getIntField(comment, "id", 0)
+	if getIntField(comment, "user_id", 0) == userID {
+		apierrors.Respond(w, http.StatusBadRequest, "You cannot report your own comment")
+		return
+	}
+	if hidden, _ := comment["hidden"].(bool); hidden {
+		apierrors.Respond(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+	if len(req.Reason) > maxCommentReportLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("reason cannot be longer than %d characters", maxCommentReportLength))
+		return
+	}
+
+	reportID, err := repository.ReportComment(r.Context(), commentID, userID, req.Reason)
+	if err == repository.ErrCommentAlreadyReported {
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to report comment %d: %v", commentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to report comment")
+		return
+	}
+	log.Printf("🚩 User %d reported comment %d on model %d", userID, commentID, listingID)
+	recordAudit(r, AuditCommentReported, AuditTargetComment, strconv.Itoa(commentID), map[string]interface{}{
+		"published_model_id": listingID,
+		"report_id":          reportID,
+		"reason":             req.Reason,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"report_id": reportID,
+	})
+}
+
+// HideModelCommentHandler hides a comment on the publisher's listing, or any listing for admins.
+// Hidden comments are only shown to their author and moderators; open reports are resolved.
+func HideModelCommentHandler(w http.ResponseWriter, r *http.Request) {
+	setModelCommentHidden(w, r, true)
+}
+
+// UnhideModelCommentHandler shows a hidden comment again
+func UnhideModelCommentHandler(w http.ResponseWriter, r *http.Request) {
+	setModelCommentHidden(w, r, false)
+}
+
+func setModelCommentHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	moderatorID, role, comment, ok := getModeratedComment(w, r)
+	if !ok {
+		return
+	}
+	commentID := getIntField(comment, "id", 0)
+
+	if err := repository.SetCommentHidden(r.Context(), commentID, moderatorID, hidden); err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Comment not found")
+		return
+	} else if err != nil {
+		log.Printf("❌ Failed to hide comment %d: %v", commentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to moderate comment")
+		return
+	}
+
+	action := AuditCommentHidden
+	if !hidden {
+		action = AuditCommentUnhidden
+	}
+	log.Printf("🛡️  User %d (%s) set comment %d hidden=%t", moderatorID, role, commentID, hidden)
+	recordAudit(r, action, AuditTargetComment, strconv.Itoa(commentID), commentAuditDetails(comment, role))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"comment_id": commentID,
+		"hidden":     hidden,
+	})
+}
+
+// DeleteListingCommentHandler deletes a comment and its replies. Authors can delete their own
+// comments; the publisher of the model and admins can delete any comment on it.
+func DeleteListingCommentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	listingID, comment, ok := getListingComment(w, r)
+	if !ok {
+		return
+	}
+	commentID := getIntField(comment, "id", 0)
+
+	role := ""
+	if getIntField(comment, "user_id", 0) != userID {
+		_, role, comment, ok = getModeratedComment(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	if err := repository.DeleteListingComment(r.Context(), listingID, commentID); err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Comment not found")
+		return
+	} else if err != nil {
+		log.Printf("❌ Failed to delete comment %d: %v", commentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to delete comment")
+		return
+	}
+
+	if role != "" {
+		log.Printf("🛡️  User %d (%s) deleted comment %d on model %d", userID, role, commentID, listingID)
+		details := commentAuditDetails(comment, role)
+		// The comment is gone; the log keeps what it said
+		details["comment_text"] = getStringField(comment, "comment_text", "")
+		recordAudit(r, AuditCommentDeleted, AuditTargetComment, strconv.Itoa(commentID), details)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"comment_id": commentID,
+	})
+}
+
+// DismissCommentReportsHandler closes the open reports of a comment without hiding or deleting it
+func DismissCommentReportsHandler(w http.ResponseWriter, r *http.Request) {
+	moderatorID, role, comment, ok := getModeratedComment(w, r)
+	if !ok {
+		return
+	}
+	commentID := getIntField(comment, "id", 0)
+
+	dismissed, err := repository.DismissCommentReports(r.Context(), commentID, moderatorID)
+	if err != nil {
+		log.Printf("❌ Failed to dismiss reports of comment %d: %v", commentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to dismiss reports")
+		return
+	}
+	if dismissed > 0 {
+		details := commentAuditDetails(comment, role)
+		details["dismissed"] = dismissed
+		recordAudit(r, AuditCommentReportsDismissed, AuditTargetComment, strconv.Itoa(commentID), details)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"dismissed": dismissed,
+	})
+}
+
+// GetCommentReportsHandler lists the reports of the comments on a listing for its publisher and
+// admins, oldest first. ?status= filters them (open, resolved or dismissed); all by default.
+func GetCommentReportsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", repository.CommentReportOpen, repository.CommentReportResolved, repository.CommentReportDismissed:
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, "status must be open, resolved or dismissed")
+		return
+	}
+
+	role, err := commentModeratorRole(r.Context(), listingID, userID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Model not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to check comment moderation of model %d by user %d: %v", listingID, userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to check permissions")
+		return
+	}
+	if role == "" {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher of this model or an admin can see its comment reports")
+		return
+	}
+
+	reports, err := repository.GetListingCommentReports(r.Context(), listingID, status)
+	if err != nil {
+		log.Printf("❌ Failed to get comment reports of model %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve reports")
+		return
+	}
+	if reports == nil {
+		reports = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":            true,
+		"published_model_id": listingID,
+		"reports":            reports,
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+const (
+	defaultThreadReplies = 3
+	maxThreadReplies     = 20
+)
+
+// GetCommentThreadsHandler returns a page of the discussion of a listing: its top-level comments,
+// oldest first, each with its reply_count and first replies (?replies=, 3 by default). Deeper
+// replies are loaded per comment from GetCommentRepliesHandler.
+func GetCommentThreadsHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+	replyLimit := defaultThreadReplies
+	if raw := r.URL.Query().Get("replies"); raw != "" {
+		replyLimit, err = strconv.Atoi(raw)
+		if err != nil || replyLimit < 0 {
+			apierrors.Respond(w, http.StatusBadRequest, "replies must be a non-negative number")
+			return
+		}
+		if replyLimit > maxThreadReplies {
+			replyLimit = maxThreadReplies
+		}
+	}
+	viewerID, moderator := commentViewer(r, listingID)
+
+	page, pageSize := parsePagination(r)
+	threads, total, err := repository.GetCommentThreads(r.Context(), listingID, viewerID, moderator, pageSize, (page-1)*pageSize, replyLimit)
+	if err != nil {
+		log.Printf("❌ Failed to get comment threads of model %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve comments")
+		return
+	}
+	if threads == nil {
+		threads = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"threads":   threads,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// GetCommentRepliesHandler returns a page of the direct replies to a comment, oldest first
+func GetCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, comment, ok := getListingComment(w, r)
+	if !ok {
+		return
+	}
+	commentID := getIntField(comment, "id", 0)
+	viewerID, moderator := commentViewer(r, listingID)
+	if hidden, _ := comment["hidden"].(bool); hidden && !moderator && getIntField(comment, "user_id", 0) != viewerID {
+		apierrors.Respond(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	replies, total, err := repository.GetCommentReplies(r.Context(), listingID, commentID, viewerID, moderator, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get replies to comment %d: %v", commentID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve replies")
+		return
+	}
+	if replies == nil {
+		replies = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"comment_id": commentID,
+		"replies":    replies,
+		"page":       page,
+		"page_size":  pageSize,
+		"total":      total,
+	})
+}
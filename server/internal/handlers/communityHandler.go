@@ -8,12 +8,15 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/paymentintent"
 	"github.com/stripe/stripe-go/v81/customer"
+	"server/internal/apierrors"
 	"server/internal/middlewares"
 	"server/internal/repository"
 )
@@ -24,13 +27,13 @@ func GetPublishedModelByIDHandler(w http.ResponseWriter, r *http.Request) {
 	// Get model ID from URL parameter
 	modelIDStr := chi.URLParam(r, "id")
 	if modelIDStr == "" {
-		http.Error(w, "model ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model ID is required")
 		return
 	}
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
 		return
 	}
 
@@ -41,11 +44,11 @@ func GetPublishedModelByIDHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			log.Printf("[COMMUNITY] Published model %d not found", modelID)
-			http.Error(w, "Model not found", http.StatusNotFound)
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
 			return
 		}
 		log.Printf("[COMMUNITY ERROR] Failed to fetch model %d: %v", modelID, err)
-		http.Error(w, "Failed to retrieve model", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
 		return
 	}
 
@@ -56,22 +59,44 @@ func GetPublishedModelByIDHandler(w http.ResponseWriter, r *http.Request) {
 		userID = &uid
 	}
 
-	// Get IP address from request
-	ipAddress := r.RemoteAddr
-	// Check for forwarded IP (if behind proxy)
-	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
-		ipAddress = forwardedFor
-	} else if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		ipAddress = realIP
+	// Listings removed by an admin are only visible to their publisher, and are not counted as views
+	if listingIsRemoved(model) {
+		publisherID, _ := model["publisher_id"].(int32)
+		if userID == nil || int(publisherID) != *userID {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model)
+		return
 	}
 
-	if err := repository.IncrementModelViews(r.Context(), modelID, userID, ipAddress); err != nil {
+	// Forwarding headers are only trusted from TRUSTED_PROXIES, so viewers cannot make up IPs to count views again
+	ipAddress := ""
+	if ip := clientIP(r); ip != nil {
+		ipAddress = ip.String()
+	}
+
+	// Anonymous viewers get a cookie so their views can be linked to their account after login
+	anonymousID := anonymousViewerID(w, r, userID == nil)
+
+	if err := repository.IncrementModelViews(r.Context(), modelID, userID, anonymousID, ipAddress, requestCountry(r)); err != nil {
 		// Log error but don't fail the request
 		log.Printf("[COMMUNITY WARNING] Failed to increment views for model %d: %v", modelID, err)
 	}
 
 	log.Printf("[COMMUNITY] Successfully fetched model: %s (ID: %d)", model["name"], modelID)
 
+	// Deprecated listings carry a warning pointing to their successor
+	if deprecation := listingDeprecation(model); deprecation != nil {
+		model["deprecation"] = deprecation
+	}
+
+	// Trained models exported to ONNX can be downloaded in either format
+	model["download_formats"] = listingDownloadFormats(model)
+
+	localizeListing(w, r, model)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(model)
 }
@@ -83,20 +108,20 @@ func DownloadPublishedModelHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
 		log.Println("[COMMUNITY ERROR] User ID not found in context")
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
 	// Get model ID from URL parameter
 	modelIDStr := chi.URLParam(r, "id")
 	if modelIDStr == "" {
-		http.Error(w, "model ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model ID is required")
 		return
 	}
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
 		return
 	}
 
@@ -107,27 +132,59 @@ func DownloadPublishedModelHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			log.Printf("[COMMUNITY] Published model %d not found", modelID)
-			http.Error(w, "Model not found", http.StatusNotFound)
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
 			return
 		}
 		log.Printf("[COMMUNITY ERROR] Failed to fetch model %d: %v", modelID, err)
-		http.Error(w, "Failed to retrieve model", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
 		return
 	}
 
-	// Check if model is active
+	// Check if model is active. Listings past their end of life stay downloadable by their buyers.
 	isActive, ok := model["is_active"].(bool)
 	if !ok || !isActive {
-		log.Printf("[COMMUNITY] Attempted to download inactive model %d", modelID)
-		http.Error(w, "This model is not available for download", http.StatusForbidden)
-		return
+		if !listingEndedLife(model) || listingIsRemoved(model) {
+			log.Printf("[COMMUNITY] Attempted to download inactive model %d", modelID)
+			apierrors.Respond(w, http.StatusForbidden, "This model is not available for download")
+			return
+		}
+		allowed, err := canDownloadAfterEndOfLife(r, model, modelID, userID)
+		if err != nil {
+			log.Printf("[COMMUNITY ERROR] Failed to check access of user %d to end of life model %d: %v", userID, modelID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to verify purchase")
+			return
+		}
+		if !allowed {
+			log.Printf("[COMMUNITY] User %d attempted to download end of life model %d", userID, modelID)
+			apierrors.Respond(w, http.StatusGone, "This model has reached its end of life and is no longer available")
+			return
+		}
 	}
 
-	// Get trained model path
+	// Get trained model path (pipeline templates are downloaded as their script archive)
 	trainedModelPath, ok := model["trained_model_path"].(string)
+	if listingType, _ := model["listing_type"].(string); listingType == ListingTypePipelineTemplate {
+		trainedModelPath, ok = model["template_path"].(string)
+	}
 	if !ok || trainedModelPath == "" {
 		log.Printf("[COMMUNITY] Model %d has no trained model path", modelID)
-		http.Error(w, "No trained model file available", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "No trained model file available")
+		return
+	}
+
+	// ?format=onnx downloads the ONNX export of the trained model instead
+	switch r.URL.Query().Get("format") {
+	case "", DownloadFormatOriginal:
+	case DownloadFormatONNX:
+		onnxPath, found := listingONNXExport(model)
+		if !found {
+			log.Printf("[COMMUNITY] Model %d has no ONNX export", modelID)
+			apierrors.Respond(w, http.StatusNotFound, "No ONNX export is available for this model")
+			return
+		}
+		trainedModelPath = onnxPath
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, "format must be original or onnx")
 		return
 	}
 
@@ -138,9 +195,18 @@ func DownloadPublishedModelHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if price > 0 {
-		// TODO: In the future, check if user has purchased this model
-		// For now, we'll allow downloads (you can add payment logic later)
-		log.Printf("[COMMUNITY] Model %d is a paid model ($%.2f), but purchase check not implemented yet", modelID, float64(price)/100.0)
+		// Paid models need a purchase of the model or of a bundle that contains it
+		allowed, err := canDownloadPublishedModel(r, model, modelID, userID)
+		if err != nil {
+			log.Printf("[COMMUNITY ERROR] Failed to check purchase of model %d by user %d: %v", modelID, userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to verify purchase")
+			return
+		}
+		if !allowed {
+			log.Printf("[COMMUNITY] User %d has not purchased paid model %d ($%.2f)", userID, modelID, float64(price)/100.0)
+			apierrors.Respond(w, http.StatusPaymentRequired, "Purchase this model (or a bundle containing it) to download it")
+			return
+		}
 	}
 
 	// Construct full file path
@@ -154,21 +220,21 @@ func DownloadPublishedModelHandler(w http.ResponseWriter, r *http.Request) {
 	absUploadsDir, err := filepath.Abs(uploadsDir)
 	if err != nil {
 		log.Printf("[COMMUNITY ERROR] Error resolving uploads directory: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	absFullPath, err := filepath.Abs(fullPath)
 	if err != nil {
 		log.Printf("[COMMUNITY ERROR] Error resolving file path: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	// Ensure the path is within uploads directory (prevent directory traversal)
 	if !filepath.HasPrefix(absFullPath, absUploadsDir) {
 		log.Printf("[COMMUNITY SECURITY] Attempted path traversal: %s", trainedModelPath)
-		http.Error(w, "Invalid file path", http.StatusForbidden)
+		apierrors.Respond(w, http.StatusForbidden, "Invalid file path")
 		return
 	}
 
@@ -177,11 +243,11 @@ func DownloadPublishedModelHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Printf("[COMMUNITY] Model file not found: %s", absFullPath)
-			http.Error(w, "Model file not found on server", http.StatusNotFound)
+			apierrors.Respond(w, http.StatusNotFound, "Model file not found on server")
 			return
 		}
 		log.Printf("[COMMUNITY ERROR] Error accessing file: %v", err)
-		http.Error(w, "Error accessing file", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Error accessing file")
 		return
 	}
 
@@ -197,6 +263,9 @@ func DownloadPublishedModelHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[COMMUNITY WARNING] Failed to record download for user %d, model %d: %v", userID, modelID, err)
 	}
 
+	// Add the download to the publisher's ledger
+	recordDownloadLedger(r, model, modelID, userID, fileInfo)
+
 	// Set headers for download
 	filename := filepath.Base(trainedModelPath)
 	modelName, _ := model["name"].(string)
@@ -206,13 +275,22 @@ func DownloadPublishedModelHandler(w http.ResponseWriter, r *http.Request) {
 		filename = fmt.Sprintf("%s%s", modelName, ext)
 	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+	// The file is bundled in a zip with a signed license manifest
+	bundleName := strings.TrimSuffix(filename, filepath.Ext(filename)) + "-licensed.zip"
+	if listingType, _ := model["listing_type"].(string); listingType == ListingTypeWeightsOnly {
+		bundleName = strings.TrimSuffix(filename, filepath.Ext(filename)) + "-weights-only.zip"
+	}
+	setDeprecationHeaders(w, listingDeprecation(model))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", bundleName))
+	w.Header().Set("Content-Type", "application/zip")
 
-	// Serve the file
+	// Serve the bundle
 	log.Printf("[COMMUNITY] Serving published model %s (ID: %d) to user %d", filename, modelID, userID)
-	http.ServeFile(w, r, absFullPath)
+	manifest := newLicenseManifest(r.Context(), model, modelID, userID)
+	if err := writeLicensedBundle(w, absFullPath, filename, manifest); err != nil {
+		// Headers are already sent, the client gets a truncated archive
+		log.Printf("[COMMUNITY ERROR] Failed to stream model %d: %v", modelID, err)
+	}
 }
 
 // ===== LIKES =====
@@ -221,19 +299,19 @@ func DownloadPublishedModelHandler(w http.ResponseWriter, r *http.Request) {
 func LikeModelHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
 	modelIDStr := chi.URLParam(r, "id")
 	if modelIDStr == "" {
-		http.Error(w, "model ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model ID is required")
 		return
 	}
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
 		return
 	}
 
@@ -241,7 +319,7 @@ func LikeModelHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := repository.LikeModel(r.Context(), userID, modelID); err != nil {
 		log.Printf("[COMMUNITY ERROR] Failed to like model: %v", err)
-		http.Error(w, "Failed to like model", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to like model")
 		return
 	}
 
@@ -263,19 +341,19 @@ func LikeModelHandler(w http.ResponseWriter, r *http.Request) {
 func UnlikeModelHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
 	modelIDStr := chi.URLParam(r, "id")
 	if modelIDStr == "" {
-		http.Error(w, "model ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model ID is required")
 		return
 	}
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
 		return
 	}
 
@@ -283,7 +361,7 @@ func UnlikeModelHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := repository.UnlikeModel(r.Context(), userID, modelID); err != nil {
 		log.Printf("[COMMUNITY ERROR] Failed to unlike model: %v", err)
-		http.Error(w, "Failed to unlike model", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to unlike model")
 		return
 	}
 
@@ -305,20 +383,20 @@ func UnlikeModelHandler(w http.ResponseWriter, r *http.Request) {
 func GetModelLikesHandler(w http.ResponseWriter, r *http.Request) {
 	modelIDStr := chi.URLParam(r, "id")
 	if modelIDStr == "" {
-		http.Error(w, "model ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model ID is required")
 		return
 	}
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
 		return
 	}
 
 	likesCount, err := repository.GetModelLikesCount(r.Context(), modelID)
 	if err != nil {
 		log.Printf("[COMMUNITY ERROR] Failed to get likes count: %v", err)
-		http.Error(w, "Failed to get likes", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get likes")
 		return
 	}
 
@@ -341,22 +419,23 @@ func GetModelLikesHandler(w http.ResponseWriter, r *http.Request) {
 func GetModelCommentsHandler(w http.ResponseWriter, r *http.Request) {
 	modelIDStr := chi.URLParam(r, "id")
 	if modelIDStr == "" {
-		http.Error(w, "model ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model ID is required")
 		return
 	}
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
 		return
 	}
 
 	log.Printf("[COMMUNITY] Fetching comments for model %d", modelID)
 
-	comments, err := repository.GetModelComments(r.Context(), modelID)
+	viewerID, moderator := commentViewer(r, modelID)
+	comments, err := repository.GetModelComments(r.Context(), modelID, viewerID, moderator)
 	if err != nil {
 		log.Printf("[COMMUNITY ERROR] Failed to get comments: %v", err)
-		http.Error(w, "Failed to retrieve comments", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve comments")
 		return
 	}
 
@@ -368,19 +447,19 @@ func GetModelCommentsHandler(w http.ResponseWriter, r *http.Request) {
 func AddModelCommentHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
 	modelIDStr := chi.URLParam(r, "id")
 	if modelIDStr == "" {
-		http.Error(w, "model ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model ID is required")
 		return
 	}
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
 		return
 	}
 
@@ -390,21 +469,35 @@ func AddModelCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.CommentText == "" {
-		http.Error(w, "comment_text is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "comment_text is required")
 		return
 	}
 
+	// Replies must stay in the thread of their listing
+	if req.ParentCommentID != nil {
+		parent, err := repository.GetListingComment(r.Context(), modelID, *req.ParentCommentID)
+		if err != nil && err != pgx.ErrNoRows {
+			log.Printf("[COMMUNITY ERROR] Failed to get parent comment: %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to add comment")
+			return
+		}
+		if hidden, _ := parent["hidden"].(bool); err == pgx.ErrNoRows || hidden {
+			apierrors.Respond(w, http.StatusBadRequest, "Parent comment not found")
+			return
+		}
+	}
+
 	log.Printf("[COMMUNITY] User %d adding comment to model %d", userID, modelID)
 
 	commentID, err := repository.AddComment(r.Context(), userID, modelID, req.CommentText, req.ParentCommentID)
 	if err != nil {
 		log.Printf("[COMMUNITY ERROR] Failed to add comment: %v", err)
-		http.Error(w, "Failed to add comment", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to add comment")
 		return
 	}
 
@@ -420,19 +513,19 @@ func AddModelCommentHandler(w http.ResponseWriter, r *http.Request) {
 func DeleteModelCommentHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
 	commentIDStr := chi.URLParam(r, "commentId")
 	if commentIDStr == "" {
-		http.Error(w, "comment ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "comment ID is required")
 		return
 	}
 
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
-		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid comment ID")
 		return
 	}
 
@@ -440,7 +533,7 @@ func DeleteModelCommentHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := repository.DeleteComment(r.Context(), commentID, userID); err != nil {
 		log.Printf("[COMMUNITY ERROR] Failed to delete comment: %v", err)
-		http.Error(w, err.Error(), http.StatusForbidden)
+		apierrors.Respond(w, http.StatusForbidden, err.Error())
 		return
 	}
 
@@ -450,73 +543,68 @@ func DeleteModelCommentHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ModelPaymentRequest is the body of POST /v1/published-models/payment-intent, for a model or a
+// bundle
+type ModelPaymentRequest struct {
+	ModelID    int    `json:"model_id"`
+	BundleID   int    `json:"bundle_id"`
+	Rental     bool   `json:"rental"` // Rent the model for its rental period, or renew a rental
+	CouponCode string `json:"coupon_code"`
+}
+
 // CreateModelPaymentIntentHandler creates a Stripe Payment Intent for purchasing a model
 func CreateModelPaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
-		http.Error(w, "User email not found", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "User email not found")
 		return
 	}
 
-	var req struct {
-		ModelID int `json:"model_id"`
-	}
+	var req ModelPaymentRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	// Get model from database
-	model, err := repository.GetPublishedModelByID(r.Context(), req.ModelID)
+	purchase, status, err := resolvePurchaseItem(r, userID, req.ModelID, req.BundleID, req.Rental)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			http.Error(w, "Model not found", http.StatusNotFound)
-			return
-		}
-		log.Printf("[PAYMENT ERROR] Failed to fetch model %d: %v", req.ModelID, err)
-		http.Error(w, "Failed to retrieve model", http.StatusInternalServerError)
+		apierrors.Respond(w, status, err.Error())
 		return
 	}
+	price := int32(purchase.price)
 
-	// Check if model is active
-	isActive, ok := model["is_active"].(bool)
-	if !ok || !isActive {
-		http.Error(w, "This model is not available for purchase", http.StatusForbidden)
-		return
-	}
-
-	// Get price
-	price, ok := model["price"].(int32)
-	if !ok {
-		price = 0
-	}
-
-	if price <= 0 {
-		http.Error(w, "This model is free and does not require payment", http.StatusBadRequest)
-		return
+	// Discount codes lower the price, or make the purchase free without a payment
+	var applied *appliedCoupon
+	if req.CouponCode != "" {
+		applied, status, err = applyCoupon(r, userID, req.CouponCode, repository.CouponAppliesPurchase, purchase.price)
+		if err != nil {
+			apierrors.Respond(w, status, err.Error())
+			return
+		}
+		if applied.price == 0 {
+			completeCouponPurchase(w, r, userID, purchase, applied)
+			return
+		}
+		price = int32(applied.price)
 	}
 
-	// Check if user already purchased this model
-	// TODO: Implement purchase check in repository
-	// For now, we'll allow multiple purchases (you can add this check later)
-
 	// Initialize Stripe
 	stripeKey := os.Getenv("STRIPE_SECRET_KEY")
 	if stripeKey == "" {
 		log.Println("⚠️  STRIPE_SECRET_KEY not set")
-		http.Error(w, "Payment processing not configured", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Payment processing not configured")
 		return
 	}
 
@@ -525,7 +613,7 @@ func CreateModelPaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
 	// Get or create Stripe customer
 	user, err := repository.GetUserByEmail(r.Context(), userEmail)
 	if err != nil || user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
@@ -541,7 +629,7 @@ func CreateModelPaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
 		cust, err := customer.New(customerParams)
 		if err != nil {
 			log.Printf("❌ Failed to create Stripe customer: %v", err)
-			http.Error(w, "Failed to create customer", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to create customer")
 			return
 		}
 		stripeCustomerID = cust.ID
@@ -552,52 +640,61 @@ func CreateModelPaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Get model name for description
-	modelName, _ := model["name"].(string)
-	if modelName == "" {
-		modelName = fmt.Sprintf("Model #%d", req.ModelID)
-	}
-
 	// Create Payment Intent
+	metadata := map[string]string{
+		"user_id":    fmt.Sprintf("%d", userID),
+		"user_email": userEmail,
+		"model_name": purchase.name,
+	}
+	if purchase.bundleID > 0 {
+		metadata["bundle_id"] = fmt.Sprintf("%d", purchase.bundleID)
+	} else {
+		metadata["model_id"] = fmt.Sprintf("%d", purchase.modelID)
+	}
+	description := fmt.Sprintf("Purchase: %s", purchase.name)
+	if purchase.rentalDays > 0 {
+		// The rental period is fixed when paying, later changes to the listing don't affect it
+		metadata["rental_days"] = fmt.Sprintf("%d", purchase.rentalDays)
+		description = fmt.Sprintf("%d-day rental: %s", purchase.rentalDays, purchase.name)
+	}
+	if applied != nil {
+		applied.metadata(metadata)
+	}
 	params := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(int64(price)),
-		Currency: stripe.String(string(stripe.CurrencyUSD)),
-		Customer: stripe.String(stripeCustomerID),
-		Metadata: map[string]string{
-			"user_id":    fmt.Sprintf("%d", userID),
-			"user_email": userEmail,
-			"model_id":   fmt.Sprintf("%d", req.ModelID),
-			"model_name": modelName,
-		},
-		Description: stripe.String(fmt.Sprintf("Purchase: %s", modelName)),
+		Amount:      stripe.Int64(int64(price)),
+		Currency:    stripe.String(string(stripe.CurrencyUSD)),
+		Customer:    stripe.String(stripeCustomerID),
+		Metadata:    metadata,
+		Description: stripe.String(description),
 	}
 
 	pi, err := paymentintent.New(params)
 	if err != nil {
 		log.Printf("❌ Failed to create payment intent: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to create payment intent: %v", err), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create payment intent: %v", err))
 		return
 	}
 
-	log.Printf("✅ Created payment intent %s for user %d, model %d", pi.ID, userID, req.ModelID)
+	log.Printf("✅ Created payment intent %s for user %d, %s", pi.ID, userID, purchase.name)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"client_secret": pi.ClientSecret,
 		"payment_intent_id": pi.ID,
+		"amount": price,
 	})
 }
 
 // ConfirmModelPurchaseHandler confirms a completed payment and records the purchase
 func ConfirmModelPurchaseHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
@@ -607,14 +704,14 @@ func ConfirmModelPurchaseHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	// Initialize Stripe
 	stripeKey := os.Getenv("STRIPE_SECRET_KEY")
 	if stripeKey == "" {
-		http.Error(w, "Payment processing not configured", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Payment processing not configured")
 		return
 	}
 
@@ -624,19 +721,47 @@ func ConfirmModelPurchaseHandler(w http.ResponseWriter, r *http.Request) {
 	pi, err := paymentintent.Get(req.PaymentIntentID, nil)
 	if err != nil {
 		log.Printf("❌ Failed to retrieve payment intent: %v", err)
-		http.Error(w, "Invalid payment intent", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid payment intent")
 		return
 	}
 
 	// Verify payment intent belongs to this user
 	if pi.Metadata["user_id"] != fmt.Sprintf("%d", userID) {
-		http.Error(w, "Payment intent does not belong to this user", http.StatusForbidden)
+		apierrors.Respond(w, http.StatusForbidden, "Payment intent does not belong to this user")
 		return
 	}
 
 	// Verify payment was successful
 	if pi.Status != stripe.PaymentIntentStatusSucceeded {
-		http.Error(w, fmt.Sprintf("Payment not completed. Status: %s", pi.Status), http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("Payment not completed. Status: %s", pi.Status))
+		return
+	}
+	redeemPaymentCoupon(r, userID, pi.Metadata, repository.CouponAppliesPurchase, pi.ID)
+
+	// Bundle purchases grant access to every item in the bundle
+	if bundleIDStr := pi.Metadata["bundle_id"]; bundleIDStr != "" {
+		bundleID, err := strconv.Atoi(bundleIDStr)
+		if err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid bundle ID")
+			return
+		}
+		if err := repository.RecordBundlePurchase(r.Context(), bundleID, userID, int(pi.Amount), "stripe", pi.ID); err != nil {
+			log.Printf("❌ Failed to record bundle purchase: %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to record purchase")
+			return
+		}
+		log.Printf("✅ Payment confirmed for user %d, bundle %d, payment intent %s", userID, bundleID, req.PaymentIntentID)
+		recordAudit(r, AuditPurchase, AuditTargetBundle, fmt.Sprint(bundleID), map[string]interface{}{
+			"amount":            pi.Amount,
+			"payment_intent_id": pi.ID,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"message":   "Purchase confirmed successfully",
+			"bundle_id": bundleID,
+		})
 		return
 	}
 
@@ -648,22 +773,65 @@ func ConfirmModelPurchaseHandler(w http.ResponseWriter, r *http.Request) {
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	model, err := repository.GetPublishedModelByID(r.Context(), modelID)
+	if err != nil {
+		apierrors.Respond(w, http.StatusNotFound, "Model not found")
+		return
+	}
+	publisherID, _ := model["publisher_id"].(int32)
+
+	// Rentals grant access until their expiry, renewals extend it
+	if daysStr := pi.Metadata["rental_days"]; daysStr != "" {
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days < 1 {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid rental period")
+			return
+		}
+		expiresAt, err := repository.RecordModelRental(r.Context(), userID, modelID, int(publisherID), int(pi.Amount), days, "stripe", pi.ID)
+		if err == pgx.ErrNoRows {
+			// Already confirmed, or the user bought the model in the meantime
+			rental, rentalErr := repository.GetModelRental(r.Context(), userID, modelID)
+			if rentalErr != nil {
+				apierrors.Respond(w, http.StatusConflict, "You already own this model")
+				return
+			}
+			expiresAt, _ = rental["expires_at"].(time.Time)
+		} else if err != nil {
+			log.Printf("❌ Failed to record rental: %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to record rental")
+			return
+		}
+		log.Printf("✅ Rental confirmed for user %d, model %d until %s, payment intent %s", userID, modelID, expiresAt.Format(time.RFC3339), req.PaymentIntentID)
+		recordAudit(r, AuditPurchase, AuditTargetListing, fmt.Sprint(modelID), map[string]interface{}{
+			"amount":            pi.Amount,
+			"payment_intent_id": pi.ID,
+			"rental_days":       days,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"message":    "Rental confirmed successfully",
+			"expires_at": expiresAt,
+		})
 		return
 	}
 
-	// TODO: Implement RecordModelPurchase in repository
-	// Get model to get price and publisher ID for purchase recording:
-	// model, err := repository.GetPublishedModelByID(r.Context(), modelID)
-	// if err != nil {
-	//     http.Error(w, "Model not found", http.StatusNotFound)
-	//     return
-	// }
-	// price, _ := model["price"].(int32)
-	// publisherID, _ := model["user_id"].(int)
-	// err = repository.RecordModelPurchase(r.Context(), userID, modelID, publisherID, int(price), req.PaymentIntentID)
+	if err := repository.RecordModelPurchase(r.Context(), userID, modelID, int(publisherID), int(pi.Amount), "stripe", pi.ID); err != nil {
+		log.Printf("❌ Failed to record purchase: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to record purchase")
+		return
+	}
 
 	log.Printf("✅ Payment confirmed for user %d, model %d, payment intent %s", userID, modelID, req.PaymentIntentID)
+	recordAudit(r, AuditPurchase, AuditTargetListing, fmt.Sprint(modelID), map[string]interface{}{
+		"amount":            pi.Amount,
+		"payment_intent_id": pi.ID,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -0,0 +1,502 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/stripe/stripe-go/v81"
+	stripecoupon "github.com/stripe/stripe-go/v81/coupon"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// minStripeCharge is the smallest amount, in cents, Stripe charges in USD. Coupons that leave less
+// than this on a purchase make it free.
+const minStripeCharge = 50
+
+// couponCodePattern is what a coupon code may contain; codes are matched ignoring case
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,50}$`)
+
+// appliedCoupon is a coupon checked against a price: the discount it gives and the price left
+type appliedCoupon struct {
+	coupon   map[string]interface{}
+	id       int
+	code     string
+	discount int // Cents
+	price    int // Cents, after the discount
+}
+
+// metadata adds the coupon to the metadata of a Stripe payment, so it is redeemed once paid
+func (c *appliedCoupon) metadata(metadata map[string]string) {
+	metadata["coupon_id"] = strconv.Itoa(c.id)
+	metadata["coupon_code"] = c.code
+	metadata["coupon_discount"] = strconv.Itoa(c.discount)
+}
+
+// applyCoupon checks that a user can use a coupon code for a subscription or purchase (kind) of a
+// price in cents and computes its discount. The error is meant for the user, with its HTTP status.
+func applyCoupon(r *http.Request, userID int, code, kind string, price int) (*appliedCoupon, int, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	coupon, err := repository.GetCouponByCode(r.Context(), code)
+	if err == pgx.ErrNoRows {
+		return nil, http.StatusNotFound, fmt.Errorf("Coupon not found")
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get coupon %s: %v", code, err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to check coupon")
+	}
+
+	if active, _ := coupon["is_active"].(bool); !active {
+		return nil, http.StatusBadRequest, fmt.Errorf("This coupon is no longer valid")
+	}
+	if expiresAt, ok := coupon["expires_at"].(time.Time); ok && time.Now().After(expiresAt) {
+		return nil, http.StatusBadRequest, fmt.Errorf("This coupon has expired")
+	}
+	if appliesTo := getStringField(coupon, "applies_to", repository.CouponAppliesAll); appliesTo != repository.CouponAppliesAll && appliesTo != kind {
+		return nil, http.StatusBadRequest, fmt.Errorf("This coupon cannot be used for a %s", kind)
+	}
+	if limit := getIntField(coupon, "max_redemptions", 0); limit > 0 && getIntField(coupon, "redemptions_count", 0) >= limit {
+		return nil, http.StatusBadRequest, fmt.Errorf("This coupon has been fully redeemed")
+	}
+	couponID := getIntField(coupon, "id", 0)
+	used, err := repository.CountUserRedemptions(r.Context(), couponID, userID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to check coupon")
+	}
+	if used >= getIntField(coupon, "max_per_user", 1) {
+		return nil, http.StatusBadRequest, fmt.Errorf("You have already used this coupon")
+	}
+
+	value := getIntField(coupon, "discount_value", 0)
+	discount := value
+	if getStringField(coupon, "discount_type", "") == repository.CouponPercent {
+		discount = price * value / 100
+	}
+	if discount > price {
+		discount = price
+	}
+	if kind == repository.CouponAppliesPurchase && price-discount < minStripeCharge {
+		discount = price
+	}
+	return &appliedCoupon{coupon: coupon, id: couponID, code: code, discount: discount, price: price - discount}, http.StatusOK, nil
+}
+
+// stripeCouponID returns the Stripe coupon of a coupon, creating it on first use. Subscription
+// discounts apply to the first month.
+func stripeCouponID(r *http.Request, applied *appliedCoupon) (string, error) {
+	if id := getStringField(applied.coupon, "stripe_coupon_id", ""); id != "" {
+		return id, nil
+	}
+	params := &stripe.CouponParams{
+		Duration: stripe.String(string(stripe.CouponDurationOnce)),
+		Name:     stripe.String(applied.code),
+	}
+	params.Context = r.Context()
+	value := getIntField(applied.coupon, "discount_value", 0)
+	if getStringField(applied.coupon, "discount_type", "") == repository.CouponPercent {
+		params.PercentOff = stripe.Float64(float64(value))
+	} else {
+		params.AmountOff = stripe.Int64(int64(value))
+		params.Currency = stripe.String(string(stripe.CurrencyUSD))
+	}
+	created, err := stripecoupon.New(params)
+	if err != nil {
+		return "", err
+	}
+	if err := repository.SetStripeCoupon(r.Context(), applied.id, created.ID); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	return created.ID, nil
+}
+
+// redeemPaymentCoupon records the coupon in the metadata of a completed Stripe payment, if any
+func redeemPaymentCoupon(r *http.Request, userID int, metadata map[string]string, kind, reference string) {
+	couponID, err := strconv.Atoi(metadata["coupon_id"])
+	if err != nil {
+		return
+	}
+	discount, _ := strconv.Atoi(metadata["coupon_discount"])
+	if err := repository.RedeemCoupon(r.Context(), couponID, userID, kind, reference, discount); err != nil {
+		log.Printf("⚠️  Failed to redeem coupon %d for %s: %v", couponID, reference, err)
+	}
+}
+
+// completeCouponPurchase grants a purchase that a coupon made free, without a Stripe payment. The
+// coupon is redeemed with the purchase, which is refused once the coupon's limits are reached.
+func completeCouponPurchase(w http.ResponseWriter, r *http.Request, userID int, purchase *purchaseItem, applied *appliedCoupon) {
+	reference := fmt.Sprintf("coupon-%d-%d-%d", applied.id, userID, time.Now().UnixNano())
+	record := repository.CouponPurchase{
+		CouponID:   applied.id,
+		Discount:   applied.discount,
+		BuyerID:    userID,
+		BundleID:   purchase.bundleID,
+		RentalDays: purchase.rentalDays,
+		Reference:  reference,
+	}
+	if purchase.bundleID == 0 {
+		model, err := repository.GetPublishedModelByID(r.Context(), purchase.modelID)
+		if err != nil {
+			log.Printf("❌ Failed to get published model %d: %v", purchase.modelID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to record purchase")
+			return
+		}
+		record.PublishedModelID = purchase.modelID
+		record.PublisherID = getIntField(model, "publisher_id", 0)
+	}
+
+	granted, err := repository.RecordCouponPurchase(r.Context(), record)
+	if errors.Is(err, repository.ErrCouponFullyRedeemed) {
+		apierrors.Respond(w, http.StatusBadRequest, "This coupon has been fully redeemed")
+		return
+	}
+	if errors.Is(err, repository.ErrCouponUsedByUser) {
+		apierrors.Respond(w, http.StatusBadRequest, "You have already used this coupon")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to record coupon purchase of %s for user %d: %v", purchase.name, userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to record purchase")
+		return
+	}
+	if !granted {
+		apierrors.Respond(w, http.StatusConflict, "You already own "+purchase.name)
+		return
+	}
+
+	log.Printf("🎟️  Coupon %s made %s free for user %d", applied.code, purchase.name, userID)
+	target, targetID := AuditTargetListing, purchase.modelID
+	if purchase.bundleID > 0 {
+		target, targetID = AuditTargetBundle, purchase.bundleID
+	}
+	recordAudit(r, AuditPurchase, target, fmt.Sprint(targetID), map[string]interface{}{
+		"amount":      0,
+		"coupon_code": applied.code,
+		"discount":    applied.discount,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"free":     true,
+		"message":  "Purchase completed with your coupon",
+		"discount": applied.discount,
+	})
+}
+
+// ValidateCouponHandler checks a coupon code for a subscription ({"code", "tier"}) or a marketplace
+// purchase ({"code", "model_id" or "bundle_id", "rental"}) and returns the discount and final price
+func ValidateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Code     string `json:"code"`
+		Tier     string `json:"tier"`
+		ModelID  int    `json:"model_id"`
+		BundleID int    `json:"bundle_id"`
+		Rental   bool   `json:"rental"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	kind, price := repository.CouponAppliesPurchase, 0
+	if req.Tier != "" {
+		tierPrice, ok := subscriptionPrices[req.Tier]
+		if !ok {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid subscription tier")
+			return
+		}
+		kind, price = repository.CouponAppliesSubscription, int(tierPrice)
+	} else {
+		purchase, status, err := resolvePurchaseItem(r, userID, req.ModelID, req.BundleID, req.Rental)
+		if err != nil {
+			apierrors.Respond(w, status, err.Error())
+			return
+		}
+		price = purchase.price
+	}
+
+	applied, status, err := applyCoupon(r, userID, req.Code, kind, price)
+	if err != nil {
+		apierrors.Respond(w, status, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"code":           applied.code,
+		"description":    getStringField(applied.coupon, "description", ""),
+		"discount_type":  applied.coupon["discount_type"],
+		"discount_value": applied.coupon["discount_value"],
+		"price":          price,
+		"discount":       applied.discount,
+		"final_price":    applied.price,
+	})
+}
+
+// couponRequest is the body of the admin coupon endpoints. Omitted fields keep their value on
+// update and take their default on create.
+type couponRequest struct {
+	Code           *string    `json:"code"`
+	Description    *string    `json:"description"`
+	DiscountType   *string    `json:"discount_type"`
+	DiscountValue  *int       `json:"discount_value"`
+	AppliesTo      *string    `json:"applies_to"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	MaxRedemptions *int       `json:"max_redemptions"`
+	MaxPerUser     *int       `json:"max_per_user"`
+	IsActive       *bool      `json:"is_active"`
+	// ClearExpiry and ClearMaxRedemptions remove the expiry and redemption limit on update
+	ClearExpiry         bool `json:"clear_expiry"`
+	ClearMaxRedemptions bool `json:"clear_max_redemptions"`
+}
+
+// apply sets the fields given in the request
+func (req couponRequest) apply(fields *repository.CouponFields) {
+	if req.Code != nil {
+		fields.Code = strings.ToUpper(strings.TrimSpace(*req.Code))
+	}
+	if req.Description != nil {
+		fields.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.DiscountType != nil {
+		fields.DiscountType = *req.DiscountType
+	}
+	if req.DiscountValue != nil {
+		fields.DiscountValue = *req.DiscountValue
+	}
+	if req.AppliesTo != nil {
+		fields.AppliesTo = *req.AppliesTo
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		fields.ExpiresAt = &expiresAt
+	} else if req.ClearExpiry {
+		fields.ExpiresAt = nil
+	}
+	if req.MaxRedemptions != nil {
+		fields.MaxRedemptions = req.MaxRedemptions
+	} else if req.ClearMaxRedemptions {
+		fields.MaxRedemptions = nil
+	}
+	if req.MaxPerUser != nil {
+		fields.MaxPerUser = *req.MaxPerUser
+	}
+	if req.IsActive != nil {
+		fields.IsActive = *req.IsActive
+	}
+}
+
+// validateCoupon checks the settings of a coupon
+func validateCoupon(fields repository.CouponFields) error {
+	switch {
+	case !couponCodePattern.MatchString(fields.Code):
+		return fmt.Errorf("code must be 3 to 50 letters, digits, dashes or underscores")
+	case fields.DiscountType != repository.CouponPercent && fields.DiscountType != repository.CouponFixed:
+		return fmt.Errorf("discount_type must be percent or fixed")
+	case fields.DiscountValue <= 0:
+		return fmt.Errorf("discount_value must be positive")
+	case fields.DiscountType == repository.CouponPercent && fields.DiscountValue > 100:
+		return fmt.Errorf("a percent discount_value cannot be more than 100")
+	case fields.AppliesTo != repository.CouponAppliesAll && fields.AppliesTo != repository.CouponAppliesSubscription &&
+		fields.AppliesTo != repository.CouponAppliesPurchase:
+		return fmt.Errorf("applies_to must be all, subscription or purchase")
+	case fields.MaxRedemptions != nil && *fields.MaxRedemptions <= 0:
+		return fmt.Errorf("max_redemptions must be positive")
+	case fields.MaxPerUser <= 0:
+		return fmt.Errorf("max_per_user must be positive")
+	}
+	return nil
+}
+
+// adminCouponID reads the {couponId} of an admin route, writing the error response when invalid
+func adminCouponID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	couponID, err := strconv.Atoi(chi.URLParam(r, "couponId"))
+	if err != nil || couponID <= 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid coupon ID")
+		return 0, false
+	}
+	return couponID, true
+}
+
+// GetCouponsHandler lists coupons for admins, newest first, with page and page_size
+func GetCouponsHandler(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := parsePagination(r)
+	coupons, total, err := repository.GetCoupons(r.Context(), pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get coupons: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve coupons")
+		return
+	}
+	if coupons == nil {
+		coupons = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"coupons":   coupons,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// CreateCouponHandler creates a coupon. code, discount_type and discount_value are required; it
+// applies to everything, once per user, without expiry or redemption limit by default.
+func CreateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+
+	var req couponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	fields := repository.CouponFields{AppliesTo: repository.CouponAppliesAll, MaxPerUser: 1, IsActive: true}
+	req.apply(&fields)
+	if err := validateCoupon(fields); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	couponID, err := repository.CreateCoupon(r.Context(), fields, adminID)
+	if errors.Is(err, repository.ErrCouponExists) {
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to create coupon %s: %v", fields.Code, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create coupon")
+		return
+	}
+	log.Printf("🎟️  Admin %d created coupon %s", adminID, fields.Code)
+
+	writeCoupon(w, r, couponID, http.StatusCreated)
+}
+
+// UpdateCouponHandler changes the fields given of a coupon. Set is_active to false to stop it
+// being used.
+func UpdateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	couponID, ok := adminCouponID(w, r)
+	if !ok {
+		return
+	}
+
+	coupon, err := repository.GetCoupon(r.Context(), couponID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Coupon not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get coupon %d: %v", couponID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update coupon")
+		return
+	}
+	var req couponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	isActive, _ := coupon["is_active"].(bool)
+	fields := repository.CouponFields{
+		Code:          getStringField(coupon, "code", ""),
+		Description:   getStringField(coupon, "description", ""),
+		DiscountType:  getStringField(coupon, "discount_type", ""),
+		DiscountValue: getIntField(coupon, "discount_value", 0),
+		AppliesTo:     getStringField(coupon, "applies_to", repository.CouponAppliesAll),
+		MaxPerUser:    getIntField(coupon, "max_per_user", 1),
+		IsActive:      isActive,
+	}
+	if expiresAt, ok := coupon["expires_at"].(time.Time); ok {
+		fields.ExpiresAt = &expiresAt
+	}
+	if limit := getIntField(coupon, "max_redemptions", 0); limit > 0 {
+		fields.MaxRedemptions = &limit
+	}
+	req.apply(&fields)
+	if err := validateCoupon(fields); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := repository.UpdateCoupon(r.Context(), couponID, fields); err != nil {
+		if errors.Is(err, repository.ErrCouponExists) {
+			apierrors.Respond(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Printf("❌ Failed to update coupon %d: %v", couponID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update coupon")
+		return
+	}
+	log.Printf("🎟️  Admin %d updated coupon %s", adminID, fields.Code)
+
+	writeCoupon(w, r, couponID, http.StatusOK)
+}
+
+// DeleteCouponHandler deletes a coupon that was never redeemed
+func DeleteCouponHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	couponID, ok := adminCouponID(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := repository.DeleteCoupon(r.Context(), couponID)
+	if errors.Is(err, repository.ErrCouponRedeemed) {
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to delete coupon %d: %v", couponID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to delete coupon")
+		return
+	}
+	if !deleted {
+		apierrors.Respond(w, http.StatusNotFound, "Coupon not found")
+		return
+	}
+	log.Printf("🎟️  Admin %d deleted coupon %d", adminID, couponID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// writeCoupon responds with a coupon after it was saved
+func writeCoupon(w http.ResponseWriter, r *http.Request, couponID, status int) {
+	coupon, err := repository.GetCoupon(r.Context(), couponID)
+	if err != nil {
+		log.Printf("❌ Failed to get coupon %d: %v", couponID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve coupon")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"coupon":  coupon,
+	})
+}
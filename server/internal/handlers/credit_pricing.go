@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// defaultEstimatedTrainingTime is assumed for models without a finished server training
+const defaultEstimatedTrainingTime = time.Hour
+
+// Finalizing waits for the training run to be recorded when a training ends right after it started
+const (
+	finalizeAttempts = 5
+	finalizeRetryGap = 2 * time.Second
+)
+
+// earlyFailureWindow is how long a server training can run before failing and still cost nothing
+// (CREDIT_REFUND_FAILURE_MINUTES)
+var earlyFailureWindow = time.Duration(envInt("CREDIT_REFUND_FAILURE_MINUTES", 5)) * time.Minute
+
+// creditPrice is the credit cost of server trainings on a hardware tier
+type creditPrice struct {
+	HardwareTier          string  `json:"hardware_tier"`
+	CreditsPerHour        float64 `json:"credits_per_hour"`
+	MinimumCredits        float64 `json:"minimum_credits"`
+	PreemptibleMultiplier float64 `json:"preemptible_multiplier"`
+}
+
+// creditPriceFromRow converts a training_credit_pricing row into its price
+func creditPriceFromRow(row map[string]interface{}) creditPrice {
+	return creditPrice{
+		HardwareTier:          getStringField(row, "hardware_tier", ""),
+		CreditsPerHour:        getFloatField(row, "credits_per_hour", 0),
+		MinimumCredits:        getFloatField(row, "minimum_credits", 0),
+		PreemptibleMultiplier: getFloatField(row, "preemptible_multiplier", 1),
+	}
+}
+
+// credits returns the cost of running for d in an execution mode, rounded to hundredths of a credit
+func (p creditPrice) credits(executionMode string, d time.Duration) float64 {
+	credits := math.Max(p.CreditsPerHour*d.Hours(), p.MinimumCredits)
+	if executionMode == aiAgent.ExecutionModePreemptible {
+		credits *= p.PreemptibleMultiplier
+	}
+	return math.Round(credits*100) / 100
+}
+
+// creditEstimate is the expected cost of a server training, shown before it starts
+type creditEstimate struct {
+	HardwareTier     string      `json:"hardware_tier"`
+	ExecutionMode    string      `json:"execution_mode"`
+	EstimatedSeconds int         `json:"estimated_seconds"`
+	Credits          float64     `json:"credits"`
+	Price            creditPrice `json:"price"`
+	// Basis is "history" when the duration is the average of the model's last server trainings, "default" otherwise
+	Basis string `json:"basis"`
+}
+
+// estimateTrainingCredits estimates the cost of training a model on the server now
+func estimateTrainingCredits(ctx context.Context, trainer *aiAgent.Trainer, modelID int, executionMode string) (creditEstimate, error) {
+	if executionMode == "" {
+		executionMode = aiAgent.ExecutionModeOnDemand
+	}
+	tier := trainer.ExpectedHardwareTier()
+	row, err := repository.GetCreditPrice(ctx, tier)
+	if err != nil {
+		return creditEstimate{}, fmt.Errorf("no credit price for hardware tier %s: %w", tier, err)
+	}
+
+	duration, basis := defaultEstimatedTrainingTime, "default"
+	if seconds, ok, err := repository.GetAverageTrainingRunSeconds(ctx, modelID); err != nil {
+		return creditEstimate{}, err
+	} else if ok {
+		duration, basis = time.Duration(seconds*float64(time.Second)), "history"
+	}
+
+	price := creditPriceFromRow(row)
+	return creditEstimate{
+		HardwareTier:     tier,
+		ExecutionMode:    executionMode,
+		EstimatedSeconds: int(duration.Seconds()),
+		Credits:          price.credits(executionMode, duration),
+		Price:            price,
+		Basis:            basis,
+	}, nil
+}
+
+// reserveTrainingCredits holds the whole credits of an estimate from a user's balance and returns
+// the reservation, 0 when the estimate is free, or repository.ErrInsufficientCredits. With an orgID,
+// the organization's pool pays while it covers the estimate.
+func reserveTrainingCredits(ctx context.Context, userID, orgID int, estimate creditEstimate) (int, error) {
+	credits := int(math.Ceil(estimate.Credits))
+	if credits <= 0 {
+		return 0, nil
+	}
+	description := fmt.Sprintf("Reserved for a training estimated at %.2f credits on %s", estimate.Credits, estimate.HardwareTier)
+	if orgID != 0 {
+		id, err := repository.ReserveOrganizationTrainingCredits(ctx, orgID, userID, credits, description)
+		if !errors.Is(err, repository.ErrInsufficientCredits) {
+			return id, err
+		}
+	}
+	return repository.ReserveTrainingCredits(ctx, userID, credits, description)
+}
+
+// trainingCreditOrganization returns the organization whose pool pays for a user's trainings of a
+// model: the one the model is shared with, if the user belongs to it. It returns 0 otherwise.
+func trainingCreditOrganization(ctx context.Context, modelID, userID int) (int, error) {
+	orgID, err := repository.GetModelOrganizationID(ctx, modelID)
+	if err != nil || orgID == 0 {
+		return 0, err
+	}
+	role, err := repository.GetOrganizationRole(ctx, orgID, userID)
+	if err != nil || role == "" {
+		return 0, err
+	}
+	return orgID, nil
+}
+
+// refundTrainingCredits gives back a reservation made for a training that did not start
+func refundTrainingCredits(reservationID int, description string) {
+	if reservationID == 0 {
+		return
+	}
+	if err := repository.RefundCreditReservation(context.Background(), reservationID, description); err != nil {
+		log.Printf("❌ Failed to refund credit reservation %d: %v", reservationID, err)
+	}
+}
+
+// FinalizeTrainingCharge meters the credits of a finished server training and charges them to its
+// user. Enterprise users are metered but not charged. Trainings that never got a slot or failed
+// within earlyFailureWindow cost nothing, and their reserved credits are refunded in full.
+func FinalizeTrainingCharge(usage aiAgent.TrainingUsage) {
+	ctx := context.Background()
+
+	credits := 0.0
+	free := usage.HardwareTier == "" || (usage.Status == aiAgent.StatusFailed && usage.RunTime < earlyFailureWindow)
+	if !free {
+		row, err := repository.GetCreditPrice(ctx, usage.HardwareTier)
+		if err != nil {
+			log.Printf("❌ No credit price for hardware tier %s, training %s is not charged: %v", usage.HardwareTier, usage.TrainingID, err)
+			return
+		}
+		credits = creditPriceFromRow(row).credits(usage.ExecutionMode, usage.RunTime)
+	}
+
+	user, err := repository.GetUserByID(ctx, usage.UserID)
+	if err == nil && user != nil {
+		user, err = repository.GetUserByEmail(ctx, getStringField(*user, "email", ""))
+	}
+	if err != nil || user == nil {
+		log.Printf("❌ Failed to get user %d to charge training %s: %v", usage.UserID, usage.TrainingID, err)
+		return
+	}
+	email := getStringField(*user, "email", "")
+	charge := getStringField(*user, "subscription_tier", TierFree) != TierEnterprise && !free
+
+	for attempt := 1; ; attempt++ {
+		charged, err := repository.FinalizeTrainingRunCredits(ctx, usage.TrainingID, usage.HardwareTier, usage.RunTime, credits, charge)
+		if errors.Is(err, pgx.ErrNoRows) && attempt < finalizeAttempts {
+			time.Sleep(finalizeRetryGap)
+			continue
+		}
+		if err != nil {
+			log.Printf("❌ Failed to finalize the credits of training %s: %v", usage.TrainingID, err)
+			return
+		}
+		log.Printf("💳 Training %s ran %s on %s: %.2f credits metered, %d charged to %s",
+			usage.TrainingID, usage.RunTime.Round(time.Second), usage.HardwareTier, credits, charged, email)
+		break
+	}
+
+	if charge && email != "" {
+		CheckQuotaWarnings(ctx, email)
+	}
+}
+
+// GetTrainingEstimate returns the expected credit cost of training a model on the server.
+// ?execution_mode=preemptible estimates a preemptible training.
+func (h *TrainingHandler) GetTrainingEstimate(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForTrainer(w, r)
+	if !ok {
+		return
+	}
+
+	executionMode := r.URL.Query().Get("execution_mode")
+	if executionMode != "" && executionMode != aiAgent.ExecutionModeOnDemand && executionMode != aiAgent.ExecutionModePreemptible {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("execution_mode must be '%s' or '%s'", aiAgent.ExecutionModeOnDemand, aiAgent.ExecutionModePreemptible))
+		return
+	}
+
+	estimate, err := estimateTrainingCredits(r.Context(), h.agent.GetTrainer(), getIntField(model, "id", 0), executionMode)
+	if err != nil {
+		log.Printf("❌ Failed to estimate training credits: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to estimate training cost")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":  true,
+		"estimate": estimate,
+	}
+	userEmail, _ := r.Context().Value(middlewares.UserEmailKey).(string)
+	if user, err := repository.GetUserByEmail(r.Context(), userEmail); err == nil && user != nil {
+		response["remaining_credits"] = getIntField(*user, "training_credits", 0)
+		response["unlimited"] = getStringField(*user, "subscription_tier", TierFree) == TierEnterprise
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetCreditPricingHandler returns the credit price of every hardware tier
+func GetCreditPricingHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := repository.GetCreditPricing(r.Context())
+	if err != nil {
+		log.Printf("❌ Failed to get credit pricing: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve pricing")
+		return
+	}
+
+	pricing := make([]creditPrice, 0, len(rows))
+	for _, row := range rows {
+		pricing = append(pricing, creditPriceFromRow(row))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"pricing": pricing,
+	})
+}
+
+// UpdateCreditPriceHandler lets an admin set the credit price of a hardware tier.
+// {"credits_per_hour": 4, "minimum_credits": 1, "preemptible_multiplier": 0.5}; the minimum
+// defaults to 0 and the multiplier to 0.5. New prices apply to trainings that end afterwards.
+func UpdateCreditPriceHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	tier := chi.URLParam(r, "tier")
+	if !aiAgent.ValidHardwareTier(tier) {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("Unknown hardware tier, expected one of %v", aiAgent.HardwareTiers))
+		return
+	}
+
+	var req struct {
+		CreditsPerHour        *float64 `json:"credits_per_hour"`
+		MinimumCredits        float64  `json:"minimum_credits"`
+		PreemptibleMultiplier *float64 `json:"preemptible_multiplier"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.CreditsPerHour == nil || *req.CreditsPerHour < 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "credits_per_hour must be 0 or more")
+		return
+	}
+	if req.MinimumCredits < 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "minimum_credits must be 0 or more")
+		return
+	}
+	multiplier := 0.5
+	if req.PreemptibleMultiplier != nil {
+		multiplier = *req.PreemptibleMultiplier
+	}
+	if multiplier <= 0 || multiplier > 1 {
+		apierrors.Respond(w, http.StatusBadRequest, "preemptible_multiplier must be above 0 and at most 1")
+		return
+	}
+
+	if err := repository.SetCreditPrice(r.Context(), tier, *req.CreditsPerHour, req.MinimumCredits, multiplier, adminID); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update price")
+		return
+	}
+	log.Printf("💳 Admin %d set the %s price to %.2f credits/hour (minimum %.2f, preemptible x%.3f)",
+		adminID, tier, *req.CreditsPerHour, req.MinimumCredits, multiplier)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"price": creditPrice{
+			HardwareTier:          tier,
+			CreditsPerHour:        *req.CreditsPerHour,
+			MinimumCredits:        req.MinimumCredits,
+			PreemptibleMultiplier: multiplier,
+		},
+	})
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"server/internal/repository"
+)
+
+// addMonths adds n months to t, clamping the day to the end of shorter months so that a
+// subscription started on the 31st renews on the last day of February
+func addMonths(t time.Time, n int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// creditCycle returns the bounds of the monthly credit period of a subscription started at anchor
+// which contains now: the last anniversary at or before now and the next one after it
+func creditCycle(anchor, now time.Time) (time.Time, time.Time) {
+	if now.Before(anchor) {
+		return anchor, addMonths(anchor, 1)
+	}
+	months := (now.Year()-anchor.Year())*12 + int(now.Month()-anchor.Month())
+	start := addMonths(anchor, months)
+	if start.After(now) {
+		months--
+		start = addMonths(anchor, months)
+	}
+	return start, addMonths(anchor, months+1)
+}
+
+// proratedCredits returns the balance of a subscriber switching from oldTier to newTier during
+// the credit period [start, next): the difference between the tiers' monthly credits is added or
+// taken back in proportion to the time left in the period
+func proratedCredits(balance int, oldTier, newTier string, start, next, now time.Time) int {
+	fraction := 0.0
+	if period := next.Sub(start); period > 0 && now.Before(next) {
+		fraction = math.Min(1, float64(next.Sub(now))/float64(period))
+	}
+	credits := balance + int(math.Round(float64(trainingCredits[newTier]-trainingCredits[oldTier])*fraction))
+	if credits < 0 {
+		return 0
+	}
+	return credits
+}
+
+// changeSubscriptionTier moves a user to tier, with fields as the other subscription columns to
+// update. A first subscription starts a new credit period with the tier's full monthly credits, a
+// change between paid tiers keeps the period and prorates the credits, and the free tier drops them.
+func changeSubscriptionTier(ctx context.Context, email, tier string, fields map[string]interface{}) (*repository.CreditResetPlan, error) {
+	now := time.Now().UTC()
+	return repository.ResetSubscriptionCredits(ctx, email, func(current repository.SubscriptionCredits) *repository.CreditResetPlan {
+		plan := &repository.CreditResetPlan{Tier: tier, Fields: fields}
+		if plan.Fields == nil {
+			plan.Fields = map[string]interface{}{}
+		}
+
+		switch {
+		case tier == TierFree:
+			plan.Reason = repository.CreditResetCanceled
+		case current.Tier != TierFree && current.Status == "active" && current.NextResetAt != nil:
+			next := *current.NextResetAt
+			start := addMonths(next, -1)
+			if current.StartDate != nil {
+				start, _ = creditCycle(*current.StartDate, next.Add(-time.Nanosecond))
+			}
+			plan.Reason = repository.CreditResetTierChange
+			plan.Credits = proratedCredits(current.Credits, current.Tier, tier, start, next, now)
+			plan.NextResetAt = &next
+		default:
+			next := addMonths(now, 1)
+			plan.Reason = repository.CreditResetSubscribed
+			plan.Credits = trainingCredits[tier]
+			plan.NextResetAt = &next
+			plan.Fields["subscription_start_date"] = now
+			plan.Fields["subscription_end_date"] = next
+		}
+		return plan
+	})
+}
+
+// StartCreditResets resets, once an hour, the training credits of subscribers whose subscription
+// anniversary has passed
+func StartCreditResets() {
+	go func() {
+		for {
+			if _, err := resetDueCredits(context.Background()); err != nil {
+				log.Printf("⚠️  Credit resets failed: %v", err)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// resetDueCredits gives each subscriber due for a reset their tier's monthly credits and schedules
+// the next reset on the following anniversary. It returns how many users were reset.
+func resetDueCredits(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	emails, err := repository.GetDueCreditResets(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	reset := 0
+	for _, email := range emails {
+		plan, err := repository.ResetSubscriptionCredits(ctx, email, func(current repository.SubscriptionCredits) *repository.CreditResetPlan {
+			// The subscription may have changed since it was listed
+			if current.Tier == TierFree || current.Status != "active" ||
+				current.NextResetAt == nil || current.NextResetAt.After(now) {
+				return nil
+			}
+			anchor := *current.NextResetAt
+			if current.StartDate != nil {
+				anchor = *current.StartDate
+			}
+			_, next := creditCycle(anchor, now)
+			return &repository.CreditResetPlan{
+				Reason:      repository.CreditResetAnniversary,
+				Tier:        current.Tier,
+				Credits:     trainingCredits[current.Tier],
+				NextResetAt: &next,
+				Fields:      map[string]interface{}{"subscription_end_date": next},
+			}
+		})
+		if err != nil {
+			log.Printf("⚠️  Failed to reset credits of %s: %v", email, err)
+			continue
+		}
+		if plan != nil {
+			reset++
+		}
+	}
+	if reset > 0 {
+		log.Printf("💳 Reset the training credits of %d subscribers", reset)
+	}
+	return reset, nil
+}
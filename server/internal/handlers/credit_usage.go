@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	defaultUsageMonths = 6
+	maxUsageMonths     = 24
+	recentCreditResets = 12
+)
+
+// GetCreditUsageHandler returns the user's remaining training credits, the credits consumed in each
+// of the last ?months= months (default 6, max 24), their next and recent credit resets and a page of
+// their credit transactions
+func GetCreditUsageHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	months := defaultUsageMonths
+	if raw := r.URL.Query().Get("months"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxUsageMonths {
+			apierrors.Respond(w, http.StatusBadRequest, "months must be between 1 and 24")
+			return
+		}
+		months = n
+	}
+
+	user, err := repository.GetUserByEmail(r.Context(), userEmail)
+	if err != nil || user == nil {
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+	userID := getIntField(*user, "id", 0)
+	tier := getStringField(*user, "subscription_tier", TierFree)
+
+	monthly, err := repository.GetMonthlyCreditUsage(r.Context(), userID, months)
+	if err != nil {
+		log.Printf("❌ Failed to get credit usage of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve credit usage")
+		return
+	}
+	if monthly == nil {
+		monthly = []map[string]interface{}{}
+	}
+
+	page, pageSize := parsePagination(r)
+	transactions, total, err := repository.GetCreditTransactions(r.Context(), userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get credit transactions of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve credit usage")
+		return
+	}
+	if transactions == nil {
+		transactions = []map[string]interface{}{}
+	}
+
+	resets, err := repository.GetCreditResets(r.Context(), userID, recentCreditResets)
+	if err != nil {
+		log.Printf("❌ Failed to get credit resets of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve credit usage")
+		return
+	}
+	if resets == nil {
+		resets = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":           true,
+		"tier":              tier,
+		"remaining_credits": getIntField(*user, "training_credits", 0),
+		"monthly_credits":   trainingCredits[tier],
+		"unlimited":         tier == TierEnterprise,
+		"next_reset_at":     (*user)["next_credit_reset_at"],
+		"monthly_usage":     monthly,
+		"resets":            resets,
+		"transactions":      transactions,
+		"page":              page,
+		"page_size":         pageSize,
+		"total":             total,
+	})
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Formats of data exports
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+)
+
+// dataExport describes an exportable dataset: its columns in export order and how to load its rows
+type dataExport struct {
+	filename string
+	columns  []string
+	load     func(ctx context.Context, userID int, from, to time.Time) ([]map[string]interface{}, error)
+}
+
+var dataExports = map[string]dataExport{
+	repository.DataExportTrainingRuns: {
+		filename: "training-runs",
+		columns: []string{"training_id", "model_id", "model_name", "training_type", "execution_mode", "training_script",
+			"primary_metric", "primary_metric_direction", "started_at", "ended_at", "duration_seconds", "epochs",
+			"total_epochs", "train_loss", "val_loss", "train_accuracy", "val_accuracy", "test_accuracy",
+			"custom_metrics", "credits", "hardware_tier", "network_mode"},
+		load: repository.GetTrainingRunsForExport,
+	},
+	repository.DataExportPublisherAnalytics: {
+		filename: "publisher-analytics",
+		columns:  []string{"day", "listing_id", "listing_name", "views", "downloads", "revenue_cents"},
+		load:     repository.GetPublisherDailyStatsForExport,
+	},
+}
+
+// exportsDir is where background exports are written. It is outside the uploads directory, which
+// is served publicly.
+func exportsDir() string {
+	if dir := os.Getenv("EXPORTS_PATH"); dir != "" {
+		return dir
+	}
+	return "./exports"
+}
+
+// exportSyncMaxDays is the longest range exported in the request; longer ranges are generated in
+// the background and delivered by notification
+func exportSyncMaxDays() int {
+	return envInt("EXPORT_SYNC_MAX_DAYS", 31)
+}
+
+// exportRetention is how long background exports can be downloaded
+func exportRetention() time.Duration {
+	return time.Duration(envInt("EXPORT_RETENTION_DAYS", 7)) * 24 * time.Hour
+}
+
+// formatExportValue formats a database value as a CSV cell
+func formatExportValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case time.Time:
+		return val.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(val)
+		return string(encoded)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// writeExport writes rows as CSV with a header row, or as a JSON array of objects, keeping only
+// the export's columns
+func writeExport(w io.Writer, export dataExport, format string, rows []map[string]interface{}) error {
+	if format == exportFormatJSON {
+		records := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			record := make(map[string]interface{}, len(export.columns))
+			for _, column := range export.columns {
+				record[column] = row[column]
+			}
+			records[i] = record
+		}
+		return json.NewEncoder(w).Encode(records)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(export.columns)
+	for _, row := range rows {
+		record := make([]string, len(export.columns))
+		for i, column := range export.columns {
+			record[i] = formatExportValue(row[column])
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportTrainingRunsHandler exports the user's training runs: configuration, duration, final
+// metrics and credits. See exportData for the parameters.
+func ExportTrainingRunsHandler(w http.ResponseWriter, r *http.Request) {
+	exportData(w, r, repository.DataExportTrainingRuns)
+}
+
+// ExportPublisherAnalyticsHandler exports the daily views, downloads and revenue of the user's
+// listings. See exportData for the parameters.
+func ExportPublisherAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	exportData(w, r, repository.DataExportPublisherAnalytics)
+}
+
+// exportData exports a dataset over from/to (YYYY-MM-DD, last 30 days by default) as format=csv
+// (default) or json. Ranges up to EXPORT_SYNC_MAX_DAYS are returned directly; longer ranges, or
+// async=true, are generated in the background and answered with 202 and the export to poll. The
+// user is notified with a download link once it is ready.
+func exportData(w http.ResponseWriter, r *http.Request, kind string) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	export := dataExports[kind]
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatJSON {
+		apierrors.Respond(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+	from, to, err := parseLedgerRange(r)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	async := r.URL.Query().Get("async") == "true" || to.Sub(from) > time.Duration(exportSyncMaxDays())*24*time.Hour
+	if async {
+		exportID, err := repository.CreateDataExport(r.Context(), userID, kind, format, from, to, time.Now().Add(exportRetention()))
+		if err != nil {
+			log.Printf("❌ Failed to queue %s export for user %d: %v", kind, userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to start export")
+			return
+		}
+		go generateDataExport(exportID, userID, kind, format, from, to)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"export_id": exportID,
+			"status":    repository.DataExportPending,
+			"message":   "The export is being generated; you will be notified when it is ready",
+		})
+		return
+	}
+
+	rows, err := export.load(r.Context(), userID, from, to)
+	if err != nil {
+		log.Printf("❌ Failed to load %s export for user %d: %v", kind, userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to export data")
+		return
+	}
+	w.Header().Set("Content-Type", exportContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-%s.%s"`,
+		export.filename, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"), format))
+	if err := writeExport(w, export, format, rows); err != nil {
+		log.Printf("⚠️  Failed to write %s export for user %d: %v", kind, userID, err)
+	}
+}
+
+func exportContentType(format string) string {
+	if format == exportFormatJSON {
+		return "application/json"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// generateDataExport writes a background export to the exports directory and notifies the user
+func generateDataExport(exportID, userID int, kind, format string, from, to time.Time) {
+	ctx := context.Background()
+	export := dataExports[kind]
+
+	fail := func(err error) {
+		log.Printf("❌ Export %d (%s) of user %d failed: %v", exportID, kind, userID, err)
+		if err := repository.FailDataExport(ctx, exportID, err.Error()); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+		notifyUser(ctx, userID, Notification{
+			Type:    NotificationDataExportFailed,
+			Title:   "Export failed",
+			Message: "Your export could not be generated. Please try again.",
+			Link:    "/exports",
+			Data:    map[string]interface{}{"export_id": exportID, "kind": kind},
+		}, "", "")
+	}
+
+	rows, err := export.load(ctx, userID, from, to)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	relPath := filepath.Join(strconv.Itoa(userID), fmt.Sprintf("%d.%s", exportID, format))
+	path := filepath.Join(exportsDir(), relPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fail(err)
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fail(err)
+		return
+	}
+	err = writeExport(file, export, format, rows)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		fail(err)
+		return
+	}
+
+	if err := repository.CompleteDataExport(ctx, exportID, relPath, len(rows)); err != nil {
+		os.Remove(path)
+		fail(err)
+		return
+	}
+	log.Printf("✅ Export %d (%s) of user %d ready with %d rows", exportID, kind, userID, len(rows))
+
+	downloadURL := fmt.Sprintf("/v1/exports/%d/download", exportID)
+	notifyUser(ctx, userID, Notification{
+		Type:    NotificationDataExportReady,
+		Title:   "Your export is ready",
+		Message: fmt.Sprintf("Your %s export (%d rows) can be downloaded for %d days.", export.filename, len(rows), int(exportRetention().Hours()/24)),
+		Link:    "/exports",
+		Data: map[string]interface{}{
+			"export_id":    exportID,
+			"kind":         kind,
+			"download_url": downloadURL,
+		},
+	}, "", "")
+}
+
+// GetDataExportsHandler lists the user's background exports that can still be downloaded
+func GetDataExportsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	exports, err := repository.GetDataExports(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get exports of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve exports")
+		return
+	}
+	if exports == nil {
+		exports = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"exports": exports,
+	})
+}
+
+// DownloadDataExportHandler serves a ready background export to its owner
+func DownloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	exportID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	record, err := repository.GetDataExport(r.Context(), exportID, userID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get export %d: %v", exportID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve export")
+		return
+	}
+	if status := getStringField(record, "status", ""); status != repository.DataExportReady {
+		apierrors.Respond(w, http.StatusConflict, "Export is "+status)
+		return
+	}
+
+	kind := getStringField(record, "kind", "")
+	format := getStringField(record, "format", exportFormatCSV)
+	from, _ := record["range_from"].(time.Time)
+	to, _ := record["range_to"].(time.Time)
+	w.Header().Set("Content-Type", exportContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-%s.%s"`,
+		dataExports[kind].filename, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"), format))
+	http.ServeFile(w, r, filepath.Join(exportsDir(), getStringField(record, "file_path", "")))
+}
+
+// StartDataExportCleanup deletes expired exports and their files now and once an hour
+func StartDataExportCleanup() {
+	go func() {
+		for {
+			paths, err := repository.DeleteExpiredDataExports(context.Background())
+			if err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+			for _, path := range paths {
+				if err := os.Remove(filepath.Join(exportsDir(), path)); err != nil && !os.IsNotExist(err) {
+					log.Printf("⚠️  Failed to remove expired export %s: %v", path, err)
+				}
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
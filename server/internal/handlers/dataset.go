@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// errDatasetNotOnServer is returned for models whose folder lives on the user's machine
+var errDatasetNotOnServer = errors.New("the model's files are not stored on the server")
+
+// serverModelFolder returns the folder of a model in the uploads directory
+func serverModelFolder(model map[string]interface{}) (string, bool) {
+	folders, ok := model["folder"].([]interface{})
+	if !ok || len(folders) == 0 {
+		return "", false
+	}
+	folder, ok := folders[0].(string)
+	if !ok || !strings.HasPrefix(filepath.Clean(folder), "uploads") {
+		// Local-mode models live on the user's machine
+		return "", false
+	}
+	return filepath.Clean(folder), true
+}
+
+// folderModifiedAt returns when a file or folder inside path last changed
+func folderModifiedAt(path string) (time.Time, error) {
+	var latest time.Time
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	// Stored timestamps keep microseconds
+	return latest.UTC().Truncate(time.Microsecond), err
+}
+
+// modelDatasetSummary returns the dataset summary of a model, inspecting its folder again when it
+// changed since the stored summary, or when refresh is set
+func modelDatasetSummary(ctx context.Context, model map[string]interface{}, refresh bool) (*aiAgent.DatasetSummary, error) {
+	folder, ok := serverModelFolder(model)
+	if !ok {
+		return nil, errDatasetNotOnServer
+	}
+	modelID := getIntField(model, "id", 0)
+	modifiedAt, err := folderModifiedAt(folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the model folder: %w", err)
+	}
+
+	if !refresh {
+		if stored, err := repository.GetDatasetSummary(ctx, modelID); err == nil {
+			storedAt, _ := stored["folder_modified_at"].(time.Time)
+			var summary aiAgent.DatasetSummary
+			text, _ := stored["summary"].(string)
+			if !modifiedAt.After(storedAt) && json.Unmarshal([]byte(text), &summary) == nil {
+				return &summary, nil
+			}
+		}
+	}
+
+	summary, err := aiAgent.NewDirectoryNavigator(filepath.Dir(folder)).InspectDataset(filepath.Base(folder))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect the dataset: %w", err)
+	}
+	if err := repository.SaveDatasetSummary(ctx, modelID, modifiedAt, summary); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	return summary, nil
+}
+
+// inspectUploadedDataset summarizes the dataset of a model once its files are uploaded, so the
+// summary is ready when the user opens it
+func inspectUploadedDataset(modelID int, folder string) {
+	model := map[string]interface{}{"id": modelID, "folder": []interface{}{folder}}
+	summary, err := modelDatasetSummary(context.Background(), model, true)
+	if err != nil {
+		if !errors.Is(err, errDatasetNotOnServer) {
+			log.Printf("⚠️  Failed to summarize the dataset of model %d: %v", modelID, err)
+		}
+		return
+	}
+	log.Printf("🗂️  Model %d has a %s dataset of %d samples (%d warnings)", modelID, summary.Type, summary.Samples, len(summary.Warnings))
+}
+
+// checkTrainingDataset refuses to train a model whose dataset looks broken, unless the user asked
+// to ignore the dataset warnings. It returns the warnings of datasets that can be trained on.
+func checkTrainingDataset(ctx context.Context, model map[string]interface{}, ignoreWarnings bool) ([]string, *trainingStartError) {
+	summary, err := modelDatasetSummary(ctx, model, false)
+	if err != nil {
+		if !errors.Is(err, errDatasetNotOnServer) {
+			log.Printf("⚠️  Failed to check the dataset of model %d: %v", getIntField(model, "id", 0), err)
+		}
+		return []string{}, nil
+	}
+	if summary.Broken && !ignoreWarnings {
+		return nil, &trainingStartError{Status: http.StatusUnprocessableEntity, Code: apierrors.CodeDatasetBroken,
+			Message: "The dataset looks broken: " + strings.Join(summary.Warnings, "; "),
+			Details: map[string]interface{}{
+				"dataset_warnings": summary.Warnings,
+				"dataset_summary":  summary,
+				"hint":             "Fix the dataset, or start the training again with \"ignore_dataset_warnings\": true",
+			}}
+	}
+	return summary.Warnings, nil
+}
+
+// GetDatasetSummaryHandler returns what the dataset of a model folder contains: its type (COCO,
+// image folders or CSV), samples per class and split, corrupt files and warnings. ?refresh=true
+// inspects the folder again even if it did not change.
+func GetDatasetSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForTrainer(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	summary, err := modelDatasetSummary(r.Context(), model, r.URL.Query().Get("refresh") == "true")
+	if errors.Is(err, errDatasetNotOnServer) {
+		apierrors.Respond(w, http.StatusNotFound, "The model's files are not stored on the server")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to summarize the dataset of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to summarize the dataset")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"model_id": modelID,
+		"summary":  summary,
+	})
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 
 	"server/aiAgent"
+	"server/internal/apierrors"
 	"server/internal/middlewares"
 	"server/internal/repository"
 )
@@ -30,7 +32,7 @@ func (h *DeleteModelHandler) DeleteModel(w http.ResponseWriter, r *http.Request)
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
 		log.Println("❌ User ID not found in context")
-		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "User ID not found")
 		return
 	}
 
@@ -44,12 +46,24 @@ func (h *DeleteModelHandler) DeleteModel(w http.ResponseWriter, r *http.Request)
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Println("❌ Failed to decode request:", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.ModelID == 0 {
-		http.Error(w, "model_id is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model_id is required")
+		return
+	}
+
+	// Collaborators can view or train a shared model but never delete it
+	role, err := repository.GetModelCollaboratorRole(r.Context(), req.ModelID, userID)
+	if err != nil {
+		log.Println("❌ Failed to check collaborator role:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to check permissions")
+		return
+	}
+	if role != "" {
+		apierrors.Respond(w, http.StatusForbidden, "Only the model owner can delete it")
 		return
 	}
 
@@ -60,14 +74,14 @@ func (h *DeleteModelHandler) DeleteModel(w http.ResponseWriter, r *http.Request)
 	deletedID, err := repository.DeleteModel(r.Context(), req.ModelID, userID)
 	if err != nil {
 		log.Println("❌ Delete failed:", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	
 	modelDir := "./uploads/" + req.Name
 	if err := os.RemoveAll(modelDir); err != nil {
 		log.Println("❌ Failed to delete model directory:", err)
-		http.Error(w, "Could not delete model directory: "+err.Error(), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not delete model directory: "+err.Error())
 		return
 	}
 
@@ -83,6 +97,7 @@ func (h *DeleteModelHandler) DeleteModel(w http.ResponseWriter, r *http.Request)
 	}
 
 	log.Printf("✅ Deleted model ID: %d", deletedID)
+	recordAudit(r, AuditModelDeleted, AuditTargetModel, fmt.Sprint(deletedID), map[string]interface{}{"name": req.Name})
 
 	// 4. Send success response
 	w.Header().Set("Content-Type", "application/json")
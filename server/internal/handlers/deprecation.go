@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// minDeprecationNotice is how far in the future a listing's sunset must be, so buyers have time to migrate
+const minDeprecationNotice = 24 * time.Hour
+
+// maxDeprecationMessageLength bounds the publisher's note shown with deprecation warnings
+const maxDeprecationMessageLength = 1000
+
+// listingDeprecation describes a listing's deprecation for detail and download responses, or returns
+// nil when the listing is not deprecated
+func listingDeprecation(listing map[string]interface{}) map[string]interface{} {
+	deprecatedAt, ok := listing["deprecated_at"].(time.Time)
+	if !ok {
+		return nil
+	}
+	sunsetAt, _ := listing["sunset_at"].(time.Time)
+	name := getStringField(listing, "name", "This model")
+
+	warning := fmt.Sprintf("%s is deprecated and will be unlisted on %s.", name, sunsetAt.Format("January 2, 2006"))
+	endOfLife := false
+	if _, ok := listing["end_of_life_at"].(time.Time); ok {
+		endOfLife = true
+		warning = fmt.Sprintf("%s has reached its end of life and is no longer listed.", name)
+	}
+	successorID := getIntField(listing, "successor_id", 0)
+	if successorID > 0 {
+		warning += fmt.Sprintf(" Its successor is model #%d.", successorID)
+	}
+
+	deprecation := map[string]interface{}{
+		"deprecated_at": deprecatedAt,
+		"sunset_at":     sunsetAt,
+		"end_of_life":   endOfLife,
+		"message":       listing["deprecation_message"],
+		"warning":       warning,
+		"successor_id":  nil,
+	}
+	if successorID > 0 {
+		deprecation["successor_id"] = successorID
+	}
+	return deprecation
+}
+
+// setDeprecationHeaders adds the deprecation of a listing to a download's headers: Deprecation and
+// Sunset (RFC 9745 and RFC 8594), a successor-version link and a human readable Warning
+func setDeprecationHeaders(w http.ResponseWriter, deprecation map[string]interface{}) {
+	if deprecation == nil {
+		return
+	}
+	if deprecatedAt, ok := deprecation["deprecated_at"].(time.Time); ok {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", deprecatedAt.Unix()))
+	}
+	if sunsetAt, ok := deprecation["sunset_at"].(time.Time); ok && !sunsetAt.IsZero() {
+		w.Header().Set("Sunset", sunsetAt.UTC().Format(http.TimeFormat))
+	}
+	if successorID, ok := deprecation["successor_id"].(int); ok {
+		w.Header().Set("Link", fmt.Sprintf("</published-models/%d>; rel=\"successor-version\"", successorID))
+	}
+	warning, _ := deprecation["warning"].(string)
+	w.Header().Set("Warning", fmt.Sprintf("299 - %q", warning))
+}
+
+// listingEndedLife reports whether a listing was unlisted at the end of its deprecation
+func listingEndedLife(listing map[string]interface{}) bool {
+	_, ok := listing["end_of_life_at"].(time.Time)
+	return ok
+}
+
+// canDownloadAfterEndOfLife reports whether the user keeps access to a listing past its end of life:
+// its publisher, and the users who bought it or downloaded it before
+func canDownloadAfterEndOfLife(r *http.Request, listing map[string]interface{}, listingID, userID int) (bool, error) {
+	if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) == userID {
+		return true, nil
+	}
+	if purchased, err := repository.HasPublishedModelAccess(r.Context(), userID, listingID); err != nil || purchased {
+		return purchased, err
+	}
+	return repository.HasDownloadedListing(r.Context(), userID, listingID)
+}
+
+// DeprecateListingHandler lets a publisher deprecate a listing with an optional successor and a
+// sunset date, after which the listing is unlisted. Calling it again updates the successor, sunset
+// and message. Past purchasers are notified the first time.
+func DeprecateListingHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	var req struct {
+		SuccessorID *int      `json:"successor_id"`
+		SunsetAt    time.Time `json:"sunset_at"` // RFC 3339
+		Message     string    `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if len(req.Message) > maxDeprecationMessageLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("message must be at most %d characters", maxDeprecationMessageLength))
+		return
+	}
+	if req.SunsetAt.Before(time.Now().Add(minDeprecationNotice)) {
+		apierrors.Respond(w, http.StatusBadRequest, "sunset_at must be at least 24 hours from now")
+		return
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+	if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher can deprecate this listing")
+		return
+	}
+	if listingEndedLife(listing) {
+		apierrors.Respond(w, http.StatusConflict, "This listing has already reached its end of life")
+		return
+	}
+	if isActive, _ := listing["is_active"].(bool); !isActive {
+		apierrors.Respond(w, http.StatusConflict, "Only listed models can be deprecated")
+		return
+	}
+
+	if req.SuccessorID != nil {
+		if *req.SuccessorID == listingID {
+			apierrors.Respond(w, http.StatusBadRequest, "A listing cannot be its own successor")
+			return
+		}
+		successor, err := repository.GetPublishedModelByID(r.Context(), *req.SuccessorID)
+		if err != nil || listingEndedLife(successor) {
+			apierrors.Respond(w, http.StatusBadRequest, "successor_id must be a listed model")
+			return
+		}
+		if isActive, _ := successor["is_active"].(bool); !isActive ||
+			getStringField(successor, "visibility", repository.ListingVisibilityPublic) != getStringField(listing, "visibility", repository.ListingVisibilityPublic) {
+			apierrors.Respond(w, http.StatusBadRequest, "successor_id must be a listed model with the same visibility")
+			return
+		}
+	}
+
+	if err := repository.DeprecateListing(r.Context(), listingID, req.SuccessorID, req.SunsetAt, req.Message); err != nil {
+		log.Printf("❌ Failed to deprecate listing %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to deprecate listing")
+		return
+	}
+	log.Printf("🚩 User %d deprecated listing %d until %s", userID, listingID, req.SunsetAt.Format(time.RFC3339))
+
+	updated, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		log.Printf("❌ Failed to reload listing %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+	deprecation := listingDeprecation(updated)
+	if _, wasDeprecated := listing["deprecated_at"].(time.Time); !wasDeprecated {
+		go notifyPurchasers(listingID, Notification{
+			Type:    NotificationListingDeprecated,
+			Title:   fmt.Sprintf("%s is deprecated", getStringField(listing, "name", "A model you bought")),
+			Message: deprecation["warning"].(string),
+			Link:    fmt.Sprintf("/community/models/%d", listingID),
+			Data:    map[string]interface{}{"model_id": listingID, "deprecation": deprecation},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"deprecation": deprecation,
+	})
+}
+
+// CancelListingDeprecationHandler lets a publisher undo a deprecation before the listing's end of life
+func CancelListingDeprecationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+	if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher can update this listing")
+		return
+	}
+	if listingEndedLife(listing) {
+		apierrors.Respond(w, http.StatusConflict, "This listing has already reached its end of life")
+		return
+	}
+
+	cancelled, err := repository.CancelListingDeprecation(r.Context(), listingID)
+	if err != nil {
+		log.Printf("❌ Failed to cancel deprecation of listing %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update listing")
+		return
+	}
+	if !cancelled {
+		apierrors.Respond(w, http.StatusConflict, "This listing is not deprecated")
+		return
+	}
+	log.Printf("✅ User %d cancelled the deprecation of listing %d", userID, listingID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Deprecation cancelled",
+	})
+}
+
+// notifyPurchasers notifies and emails everyone who bought or rented a listing, directly or in a bundle
+func notifyPurchasers(listingID int, n Notification) {
+	ctx := context.Background()
+	purchasers, err := repository.GetListingPurchasers(ctx, listingID)
+	if err != nil {
+		log.Printf("⚠️  Failed to get purchasers of listing %d: %v", listingID, err)
+		return
+	}
+	for _, purchaser := range purchasers {
+		notifyUser(ctx, getIntField(purchaser, "id", 0), n,
+			getStringField(purchaser, "email", ""), getStringField(purchaser, "username", ""))
+	}
+	if len(purchasers) > 0 {
+		log.Printf("🔔 Notified %d purchasers of listing %d", len(purchasers), listingID)
+	}
+}
+
+// StartListingSunset unlists deprecated listings once their sunset has passed, every hour
+func StartListingSunset() {
+	go func() {
+		for {
+			if err := endSunsetListings(context.Background()); err != nil {
+				log.Printf("⚠️  Listing sunset failed: %v", err)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// endSunsetListings unlists the listings past their sunset and tells their publisher and purchasers
+func endSunsetListings(ctx context.Context) error {
+	listings, err := repository.GetListingsPastSunset(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, listing := range listings {
+		listingID := getIntField(listing, "id", 0)
+		ended, err := repository.EndListingLife(ctx, listingID)
+		if err != nil {
+			log.Printf("⚠️  %v", err)
+			continue
+		}
+		if !ended {
+			continue
+		}
+
+		name := getStringField(listing, "name", fmt.Sprintf("Model #%d", listingID))
+		data := map[string]interface{}{"model_id": listingID}
+		successor := ""
+		if successorID := getIntField(listing, "successor_id", 0); successorID > 0 {
+			data["successor_id"] = successorID
+			successor = fmt.Sprintf(" Its successor is model #%d.", successorID)
+		}
+		notifyUser(ctx, getIntField(listing, "publisher_id", 0), Notification{
+			Type:    NotificationListingEndOfLife,
+			Title:   fmt.Sprintf("%s reached its end of life", name),
+			Message: fmt.Sprintf("%s was unlisted from the marketplace. Buyers can still download it.", name),
+			Link:    fmt.Sprintf("/community/models/%d", listingID),
+			Data:    data,
+		}, getStringField(listing, "email", ""), getStringField(listing, "username", ""))
+		notifyPurchasers(listingID, Notification{
+			Type:    NotificationListingEndOfLife,
+			Title:   fmt.Sprintf("%s reached its end of life", name),
+			Message: fmt.Sprintf("%s is no longer listed. You can still download the version you bought.%s", name, successor),
+			Link:    fmt.Sprintf("/community/models/%d", listingID),
+			Data:    data,
+		})
+	}
+	return nil
+}
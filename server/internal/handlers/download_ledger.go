@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Download ledger environment variables.
+// DOWNLOAD_LEDGER_RETENTION_DAYS is how long ledger entries are kept (0 keeps them forever).
+// DOWNLOAD_COUNTRY_HEADER is the header the reverse proxy puts the client's country code in.
+// DOWNLOAD_LEDGER_SALT keys the anonymized buyer IDs (falls back to JWT_SECRET).
+const (
+	DownloadLedgerRetentionEnv = "DOWNLOAD_LEDGER_RETENTION_DAYS"
+	DownloadCountryHeaderEnv   = "DOWNLOAD_COUNTRY_HEADER"
+	DownloadLedgerSaltEnv      = "DOWNLOAD_LEDGER_SALT"
+)
+
+const (
+	defaultDownloadLedgerRetentionDays = 365
+	defaultDownloadCountryHeader       = "CF-IPCountry"
+)
+
+// downloadLedgerRetention returns how long ledger entries are kept, 0 for forever
+func downloadLedgerRetention() time.Duration {
+	days := defaultDownloadLedgerRetentionDays
+	if raw := os.Getenv(DownloadLedgerRetentionEnv); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n >= 0 {
+			days = n
+		} else {
+			log.Printf("⚠️  Invalid %s %q, using default %d", DownloadLedgerRetentionEnv, raw, defaultDownloadLedgerRetentionDays)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// StartDownloadLedgerRetention prunes expired ledger entries now and once a day
+func StartDownloadLedgerRetention() {
+	go func() {
+		for {
+			if retention := downloadLedgerRetention(); retention > 0 {
+				if _, err := repository.PruneDownloadLedger(context.Background(), retention); err != nil {
+					log.Printf("⚠️  %v", err)
+				}
+			}
+			time.Sleep(24 * time.Hour)
+		}
+	}()
+}
+
+// anonymizedBuyerRef identifies a buyer within one listing without revealing who they are.
+// The same buyer gets a different reference on every listing, so publishers cannot link them.
+func anonymizedBuyerRef(listingID, userID int) string {
+	salt := os.Getenv(DownloadLedgerSaltEnv)
+	if salt == "" {
+		salt = os.Getenv("JWT_SECRET")
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	fmt.Fprintf(mac, "%d:%d", listingID, userID)
+	return "buyer-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// downloadCountry returns the ISO country code set by the reverse proxy, or "" when unknown.
+// The IP address itself is never stored.
+func downloadCountry(r *http.Request) string {
+	header := os.Getenv(DownloadCountryHeaderEnv)
+	if header == "" {
+		header = defaultDownloadCountryHeader
+	}
+	country := strings.ToUpper(strings.TrimSpace(r.Header.Get(header)))
+	if len(country) != 2 || country == "XX" || country == "T1" {
+		return ""
+	}
+	for _, c := range country {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+	}
+	return country
+}
+
+// artifactVersion labels the revision of a downloaded file by its modification time
+func artifactVersion(info os.FileInfo) string {
+	return info.ModTime().UTC().Format("20060102T150405Z")
+}
+
+// recordDownloadLedger adds a download of a listing to its publisher's ledger
+func recordDownloadLedger(r *http.Request, listing map[string]interface{}, listingID, userID int, info os.FileInfo) {
+	publisherID, _ := listing["publisher_id"].(int32)
+	price, _ := listing["price"].(int32)
+
+	err := repository.RecordDownloadLedgerEntry(r.Context(), listingID, int(publisherID), userID,
+		anonymizedBuyerRef(listingID, userID), artifactVersion(info), requestCountry(r), int(price))
+	if err != nil {
+		log.Printf("[COMMUNITY WARNING] Failed to add download of model %d to the ledger: %v", listingID, err)
+	}
+}
+
+// parseLedgerRange reads the from/to query parameters (YYYY-MM-DD, to is inclusive), defaulting to the last 30 days
+func parseLedgerRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().Add(time.Second)
+	from := to.AddDate(0, 0, -30)
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return from, to, fmt.Errorf("from must be a YYYY-MM-DD date")
+		}
+		from = parsed
+	}
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return from, to, fmt.Errorf("to must be a YYYY-MM-DD date")
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// GetDownloadLedgerHandler returns who downloaded a listing, for its publisher only.
+// Pass format=csv to export the ledger as a CSV file.
+func GetDownloadLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+	if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher can see the download ledger")
+		return
+	}
+
+	from, to, err := parseLedgerRange(r)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := repository.GetDownloadLedger(r.Context(), listingID, from, to)
+	if err != nil {
+		log.Printf("❌ Failed to get download ledger for model %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve downloads")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeDownloadLedgerCSV(w, listingID, entries)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"downloads":      entries,
+		"from":           from,
+		"to":             to,
+		"retention_days": int(downloadLedgerRetention().Hours() / 24),
+	})
+}
+
+func writeDownloadLedgerCSV(w http.ResponseWriter, listingID int, entries []map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="downloads-%d.csv"`, listingID))
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"downloaded_at", "buyer", "buyer_username", "version", "country", "price_paid_cents"})
+	for _, entry := range entries {
+		downloadedAt, _ := entry["downloaded_at"].(time.Time)
+		username, _ := entry["buyer_username"].(string)
+		buyerRef, _ := entry["buyer_ref"].(string)
+		version, _ := entry["version"].(string)
+		country, _ := entry["country"].(string)
+		price, _ := entry["price_paid"].(int32)
+		writer.Write([]string{
+			downloadedAt.UTC().Format(time.RFC3339),
+			buyerRef,
+			username,
+			version,
+			country,
+			strconv.Itoa(int(price)),
+		})
+	}
+	writer.Flush()
+}
+
+// GetDownloadPrivacyHandler returns whether the user shares their username with publishers
+func GetDownloadPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	share, err := repository.GetShareDownloadIdentity(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get privacy settings for user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve privacy settings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":                 true,
+		"share_download_identity": share,
+	})
+}
+
+// UpdateDownloadPrivacyHandler lets a user show their username in publishers' download ledgers.
+// Only downloads made after the change are affected.
+func UpdateDownloadPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		ShareDownloadIdentity *bool `json:"share_download_identity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ShareDownloadIdentity == nil {
+		apierrors.Respond(w, http.StatusBadRequest, "share_download_identity is required")
+		return
+	}
+
+	if err := repository.SetShareDownloadIdentity(r.Context(), userID, *req.ShareDownloadIdentity); err != nil {
+		log.Printf("❌ Failed to update privacy settings for user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update privacy settings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":                 true,
+		"share_download_identity": *req.ShareDownloadIdentity,
+	})
+}
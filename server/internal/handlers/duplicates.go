@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+const (
+	// minhashSize is the number of hash functions in a description's MinHash signature
+	minhashSize = 64
+	// shingleWords is the number of consecutive words in a description shingle
+	shingleWords = 3
+	// minShingledWords is the shortest description compared; shorter ones match too easily
+	minShingledWords = 12
+	// duplicateDescriptionThreshold is the estimated Jaccard similarity from which descriptions are near-duplicates
+	duplicateDescriptionThreshold = 0.8
+)
+
+// duplicateMatch is an existing listing a listing looks like a duplicate of
+type duplicateMatch struct {
+	ListingID  int     `json:"model_id"`
+	Name       string  `json:"name"`
+	Reason     string  `json:"reason"`
+	Similarity float64 `json:"similarity"`
+}
+
+// splitmix64 scrambles a 64-bit value; it turns one shingle hash into minhashSize independent ones
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// descriptionMinHash returns the MinHash signature of the word shingles of a description. It is
+// empty for descriptions too short to compare.
+func descriptionMinHash(description string) []int64 {
+	words := strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) < minShingledWords {
+		return []int64{}
+	}
+
+	mins := make([]uint64, minhashSize)
+	for i := range mins {
+		mins[i] = ^uint64(0)
+	}
+	for i := 0; i+shingleWords <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleWords], " ")))
+		shingle := h.Sum64()
+		for j := range mins {
+			if v := splitmix64(shingle ^ uint64(j)*0x9e3779b97f4a7c15); v < mins[j] {
+				mins[j] = v
+			}
+		}
+	}
+
+	signature := make([]int64, minhashSize)
+	for i, v := range mins {
+		signature[i] = int64(v)
+	}
+	return signature
+}
+
+// minhashSimilarity estimates the Jaccard similarity of two descriptions from their signatures
+func minhashSimilarity(a, b []int64) float64 {
+	if len(a) != minhashSize || len(b) != minhashSize {
+		return 0
+	}
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / minhashSize
+}
+
+// signatureField reads a BIGINT[] signature column
+func signatureField(row map[string]interface{}, key string) []int64 {
+	switch v := row[key].(type) {
+	case []int64:
+		return v
+	case []interface{}:
+		signature := make([]int64, 0, len(v))
+		for _, item := range v {
+			if n, ok := item.(int64); ok {
+				signature = append(signature, n)
+			}
+		}
+		return signature
+	}
+	return nil
+}
+
+// artifactChecksum returns the SHA-256 of a model file stored under the uploads directory
+func artifactChecksum(path string) (string, error) {
+	file, err := os.Open(filepath.Join(uploadsBaseDir(), path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkListingDuplicates fingerprints a listing's model file and description, then flags it for
+// admin review against the listings it likely duplicates. Of two duplicates, the older listing is
+// the original. The matches are returned so the publisher can be warned.
+func checkListingDuplicates(ctx context.Context, listingID int, listingType, trainedModelPath, description string) ([]duplicateMatch, error) {
+	// Template archives are packaged anew on every publish, so only model files are compared
+	checksum := ""
+	if listingType != ListingTypePipelineTemplate && trainedModelPath != "" {
+		var err error
+		if checksum, err = artifactChecksum(trainedModelPath); err != nil {
+			log.Printf("⚠️  Failed to checksum model file of listing %d: %v", listingID, err)
+		}
+	}
+	signature := descriptionMinHash(description)
+	if err := repository.SetListingFingerprints(ctx, listingID, checksum, signature); err != nil {
+		return nil, err
+	}
+
+	var matches []duplicateMatch
+	matched := map[int]bool{}
+	if checksum != "" {
+		listings, err := repository.GetListingsByArtifactChecksum(ctx, listingID, checksum)
+		if err != nil {
+			return nil, err
+		}
+		for _, listing := range listings {
+			id := getIntField(listing, "id", 0)
+			matched[id] = true
+			matches = append(matches, duplicateMatch{id, getStringField(listing, "name", ""), repository.DuplicateReasonChecksum, 1})
+		}
+	}
+	if len(signature) > 0 {
+		listings, err := repository.GetDescriptionSignatures(ctx, listingID)
+		if err != nil {
+			return nil, err
+		}
+		for _, listing := range listings {
+			id := getIntField(listing, "id", 0)
+			if matched[id] {
+				continue
+			}
+			if similarity := minhashSimilarity(signature, signatureField(listing, "description_minhash")); similarity >= duplicateDescriptionThreshold {
+				matches = append(matches, duplicateMatch{id, getStringField(listing, "name", ""), repository.DuplicateReasonDescription, similarity})
+			}
+		}
+	}
+
+	for _, match := range matches {
+		duplicate, original := listingID, match.ListingID
+		if original > duplicate {
+			duplicate, original = original, duplicate
+		}
+		created, err := repository.FlagDuplicateListing(ctx, duplicate, original, match.Reason, match.Similarity)
+		if err != nil {
+			return matches, err
+		}
+		if created {
+			log.Printf("🚩 Flagged listing %d as a possible duplicate of %d (%s, %.2f)", duplicate, original, match.Reason, match.Similarity)
+		}
+	}
+	return matches, nil
+}
+
+// StartDuplicateFingerprintBackfill fingerprints, in the background, the listings published
+// before duplicate detection existed, flagging the duplicates among them
+func StartDuplicateFingerprintBackfill() {
+	go func() {
+		ctx := context.Background()
+		listings, err := repository.GetListingsWithoutFingerprints(ctx)
+		if err != nil {
+			log.Printf("⚠️  Failed to get listings to fingerprint: %v", err)
+			return
+		}
+		for _, listing := range listings {
+			if _, err := checkListingDuplicates(ctx, getIntField(listing, "id", 0), getStringField(listing, "listing_type", ""),
+				getStringField(listing, "trained_model_path", ""), getStringField(listing, "description", "")); err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+		}
+		if len(listings) > 0 {
+			log.Printf("✅ Fingerprinted %d listings for duplicate detection", len(listings))
+		}
+	}()
+}
+
+// GetDuplicateFlagsHandler lists listings flagged as likely duplicates (status=pending by default,
+// or confirmed, dismissed or all)
+func GetDuplicateFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = repository.DuplicatePending
+	case "all":
+		status = ""
+	case repository.DuplicatePending, repository.DuplicateConfirmed, repository.DuplicateDismissed:
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, "status must be pending, confirmed, dismissed or all")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	flags, total, err := repository.GetDuplicateFlags(r.Context(), status, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get duplicate flags: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve duplicate flags")
+		return
+	}
+	if flags == nil {
+		flags = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"flags":     flags,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// ResolveDuplicateFlagHandler lets an admin confirm or dismiss a duplicate flag. Confirmed
+// duplicates are linked to the original listing and their publisher is notified.
+func ResolveDuplicateFlagHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	flagID, err := strconv.Atoi(chi.URLParam(r, "flagId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid flag ID")
+		return
+	}
+
+	var req struct {
+		Decision string `json:"decision"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Decision != repository.DuplicateConfirmed && req.Decision != repository.DuplicateDismissed {
+		apierrors.Respond(w, http.StatusBadRequest, "decision must be confirmed or dismissed")
+		return
+	}
+
+	flag, err := repository.ResolveDuplicateFlag(r.Context(), flagID, adminID, req.Decision)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "No pending duplicate flag with this ID")
+			return
+		}
+		log.Printf("❌ Failed to resolve duplicate flag %d: %v", flagID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to resolve duplicate flag")
+		return
+	}
+	log.Printf("🚩 Admin %d resolved duplicate flag %d: %s", adminID, flagID, req.Decision)
+
+	if req.Decision == repository.DuplicateConfirmed {
+		listingID := getIntField(flag, "published_model_id", 0)
+		originalID := getIntField(flag, "original_id", 0)
+		name := getStringField(flag, "listing_name", "")
+		notifyUser(context.Background(), getIntField(flag, "publisher_id", 0), Notification{
+			Type:    NotificationListingDuplicate,
+			Title:   fmt.Sprintf("%s was marked as a duplicate", name),
+			Message: fmt.Sprintf("An administrator found that %s duplicates %s. The listing now links to the original.", name, getStringField(flag, "original_name", "")),
+			Link:    fmt.Sprintf("/community/%d", listingID),
+			Data: map[string]interface{}{
+				"published_model_id": listingID,
+				"original_id":        originalID,
+			},
+		}, getStringField(flag, "publisher_email", ""), getStringField(flag, "publisher_username", ""))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"flag":    flag,
+	})
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+
+	"server/aiAgent"
+)
+
+// pendingEarlyStopping holds the early stopping options of agent trainings until the agent reports them started
+var pendingEarlyStopping sync.Map // training ID -> aiAgent.EarlyStopping
+
+// remoteEarlyStop returns why an agent training was stopped early, or nil
+func remoteEarlyStop(trainingID string) *aiAgent.EarlyStop {
+	progress, err := globalTrainer.GetProgress(trainingID)
+	if err != nil {
+		return nil
+	}
+	return progress.EarlyStopped()
+}
+
+// HandleTrainingEarlyStop tells the agent running a training stopped early to end its script.
+// The agent reports the training completed once the script exited. Server trainings are stopped
+// by the trainer.
+func HandleTrainingEarlyStop(trainingID string, userID int, stop aiAgent.EarlyStop) {
+	if sendRemoteStop(userID, trainingID, map[string]interface{}{
+		"type":        "stop",
+		"training_id": trainingID,
+		"reason":      "early_stop",
+	}) {
+		log.Printf("🏁 Stopped agent training %s early: %s", trainingID, stop.Reason)
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// environmentFromRow converts a training_environments row into a snapshot
+func environmentFromRow(row map[string]interface{}) *aiAgent.EnvironmentSnapshot {
+	snapshot := &aiAgent.EnvironmentSnapshot{Packages: []string{}}
+	snapshot.Source, _ = row["source"].(string)
+	snapshot.PythonVersion, _ = row["python_version"].(string)
+	snapshot.CUDAVersion, _ = row["cuda_version"].(string)
+	snapshot.Platform, _ = row["platform"].(string)
+	snapshot.CapturedAt, _ = row["captured_at"].(time.Time)
+	if packages, ok := row["packages"].([]interface{}); ok {
+		for _, pkg := range packages {
+			if s, ok := pkg.(string); ok {
+				snapshot.Packages = append(snapshot.Packages, s)
+			}
+		}
+	}
+	return snapshot
+}
+
+// saveRemoteEnvironment stores the environment an agent reported with training_completed
+func saveRemoteEnvironment(trainingID string, environment interface{}) {
+	data, err := json.Marshal(environment)
+	if err != nil {
+		log.Printf("⚠️  Invalid environment for training %s: %v", trainingID, err)
+		return
+	}
+	snapshot, err := aiAgent.ParseEnvironmentSnapshot(data, aiAgent.EnvironmentSourceAgent)
+	if err != nil {
+		log.Printf("⚠️  Invalid environment for training %s: %v", trainingID, err)
+		return
+	}
+
+	if globalTrainer != nil {
+		if progress, err := globalTrainer.GetProgress(trainingID); err == nil {
+			progress.SetEnvironment(snapshot)
+		}
+	}
+	if err := aiAgent.SaveEnvironment(context.Background(), trainingID, snapshot); err != nil {
+		log.Printf("⚠️  Failed to save environment for training %s: %v", trainingID, err)
+	}
+}
+
+// loadTrainingEnvironment returns the environment of a run the user may see
+func loadTrainingEnvironment(ctx context.Context, trainingID string, userID int) (*aiAgent.EnvironmentSnapshot, int, error) {
+	row, err := repository.GetTrainingEnvironment(ctx, trainingID)
+	if err == pgx.ErrNoRows {
+		// Not saved (yet), fall back to the in-memory run
+		if globalTrainer != nil {
+			if progress, err := globalTrainer.GetProgress(trainingID); err == nil && progress.UserID == userID {
+				if snapshot := progress.GetEnvironment(); snapshot != nil {
+					return snapshot, http.StatusOK, nil
+				}
+			}
+		}
+		return nil, http.StatusNotFound, fmt.Errorf("no environment captured for this training")
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to retrieve environment")
+	}
+
+	allowed := false
+	if owner, ok := row["user_id"].(int32); ok && int(owner) == userID {
+		allowed = true
+	} else if modelID, ok := row["model_id"].(int32); ok {
+		if model, err := repository.GetModelByID(ctx, int(modelID)); err == nil {
+			if modelOwner, ok := (*model)["user_id"].(int32); ok && int(modelOwner) == userID {
+				allowed = true
+			}
+		}
+	}
+	if !allowed {
+		return nil, http.StatusForbidden, fmt.Errorf("you don't have access to this training")
+	}
+	return environmentFromRow(row), http.StatusOK, nil
+}
+
+func writeRequirementsLock(w http.ResponseWriter, trainingID string, snapshot *aiAgent.EnvironmentSnapshot) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="requirements.lock"`)
+	w.Write([]byte(aiAgent.RequirementsLock(trainingID, snapshot)))
+}
+
+// GetTrainingEnvironmentHandler returns the environment captured for a training run
+func GetTrainingEnvironmentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	trainingID := r.URL.Query().Get("id")
+	if trainingID == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	snapshot, status, err := loadTrainingEnvironment(r.Context(), trainingID, userID)
+	if err != nil {
+		apierrors.Respond(w, status, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"training_id": trainingID,
+		"environment": snapshot,
+	})
+}
+
+// GetTrainingRequirementsLockHandler generates a requirements.lock reproducing a training's environment
+func GetTrainingRequirementsLockHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	trainingID := r.URL.Query().Get("id")
+	if trainingID == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	snapshot, status, err := loadTrainingEnvironment(r.Context(), trainingID, userID)
+	if err != nil {
+		apierrors.Respond(w, status, err.Error())
+		return
+	}
+	writeRequirementsLock(w, trainingID, snapshot)
+}
+
+// GetPublishedModelRequirementsLockHandler generates a requirements.lock for the training
+// that produced a published model, so buyers can reproduce its environment
+func GetPublishedModelRequirementsLockHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+	if isActive, _ := listing["is_active"].(bool); !isActive {
+		apierrors.Respond(w, http.StatusForbidden, "This model is not available")
+		return
+	}
+	modelID, ok := listing["model_id"].(int32)
+	if !ok {
+		apierrors.Respond(w, http.StatusNotFound, "No environment captured for this model")
+		return
+	}
+
+	row, err := repository.GetLatestModelEnvironment(r.Context(), int(modelID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "No environment captured for this model")
+			return
+		}
+		log.Printf("❌ Failed to get environment for model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve environment")
+		return
+	}
+
+	trainingID, _ := row["training_id"].(string)
+	writeRequirementsLock(w, trainingID, environmentFromRow(row))
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// getFollowTarget looks up the publisher of the URL for a follow request, writing the error
+// response otherwise. Users cannot follow themselves.
+func getFollowTarget(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return 0, 0, false
+	}
+
+	username := chi.URLParam(r, "username")
+	profile, err := repository.GetPublicProfile(r.Context(), username)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return 0, 0, false
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get user %s: %v", username, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return 0, 0, false
+	}
+	publisherID := getIntField(profile, "id", 0)
+	if publisherID == userID {
+		apierrors.Respond(w, http.StatusBadRequest, "You cannot follow yourself")
+		return 0, 0, false
+	}
+	return userID, publisherID, true
+}
+
+// FollowPublisherHandler makes the caller follow a publisher
+func FollowPublisherHandler(w http.ResponseWriter, r *http.Request) {
+	userID, publisherID, ok := getFollowTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := repository.FollowPublisher(r.Context(), userID, publisherID); err != nil {
+		log.Printf("❌ Failed to follow publisher %d for user %d: %v", publisherID, userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to follow publisher")
+		return
+	}
+	followers, err := repository.CountFollowers(r.Context(), publisherID)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"following":       true,
+		"followers_count": followers,
+	})
+}
+
+// UnfollowPublisherHandler makes the caller stop following a publisher
+func UnfollowPublisherHandler(w http.ResponseWriter, r *http.Request) {
+	userID, publisherID, ok := getFollowTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := repository.UnfollowPublisher(r.Context(), userID, publisherID); err != nil {
+		log.Printf("❌ Failed to unfollow publisher %d for user %d: %v", publisherID, userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to unfollow publisher")
+		return
+	}
+	followers, err := repository.CountFollowers(r.Context(), publisherID)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"following":       false,
+		"followers_count": followers,
+	})
+}
+
+// GetFollowingHandler returns a page of the publishers the caller follows
+func GetFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	publishers, total, err := repository.GetFollowedPublishers(r.Context(), userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get followed publishers of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve followed publishers")
+		return
+	}
+	if publishers == nil {
+		publishers = []map[string]interface{}{}
+	}
+	for _, publisher := range publishers {
+		if avatar := getStringField(publisher, "avatar_path", ""); avatar != "" {
+			publisher["avatar_url"] = "/uploads/" + avatar
+		}
+		delete(publisher, "avatar_path")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"publishers": publishers,
+		"page":       page,
+		"page_size":  pageSize,
+		"total":      total,
+	})
+}
+
+// GetFeedHandler returns a page of the caller's feed: listings published or updated to a new
+// version by the publishers they follow, newest first
+func GetFeedHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	feed, total, err := repository.GetFollowFeed(r.Context(), userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get feed of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve feed")
+		return
+	}
+	if feed == nil {
+		feed = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"feed":      feed,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// notifyFollowers tells the followers of a publisher who can see a new listing about it, in-app
+// and over their WebSockets
+func notifyFollowers(publisherID, listingID int, publisherName, listingName string) {
+	ctx := context.Background()
+	followers, err := repository.GetFollowers(ctx, publisherID, listingID)
+	if err != nil {
+		log.Printf("⚠️  Failed to get followers of publisher %d: %v", publisherID, err)
+		return
+	}
+
+	n := Notification{
+		Type:    NotificationFollowedPublisherRelease,
+		Title:   fmt.Sprintf("New model from %s", publisherName),
+		Message: fmt.Sprintf("%s published %s.", publisherName, listingName),
+		Link:    fmt.Sprintf("/community/models/%d", listingID),
+		Data:    map[string]interface{}{"model_id": listingID, "publisher_id": publisherID},
+	}
+	for _, follower := range followers {
+		notifyUser(ctx, getIntField(follower, "id", 0), n, "", getStringField(follower, "username", ""))
+	}
+	if len(followers) > 0 {
+		log.Printf("🔔 Notified %d followers of publisher %d of model %d", len(followers), publisherID, listingID)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// GeoIP environment variables. Only the country is ever derived from an IP address.
+// GEOIP_ENABLED=false records no country for views and downloads at all.
+// GEOIP_DB_PATH is a local country MMDB (e.g. GeoLite2-Country.mmdb) used when the reverse
+// proxy does not send a country; lookups are skipped when it is unset.
+// GEOIP_RESPECT_DNT skips the lookup for browsers sending DNT or Sec-GPC (default true).
+// GEOIP_MIN_COUNTRY_COUNT hides countries with fewer events in publisher analytics (default 5).
+const (
+	GeoIPEnabledEnv         = "GEOIP_ENABLED"
+	GeoIPDBPathEnv          = "GEOIP_DB_PATH"
+	GeoIPRespectDNTEnv      = "GEOIP_RESPECT_DNT"
+	GeoIPMinCountryCountEnv = "GEOIP_MIN_COUNTRY_COUNT"
+)
+
+const defaultGeoIPMinCountryCount = 5
+
+var (
+	geoIPOnce   sync.Once
+	geoIPReader *geoip2.Reader
+)
+
+// envBool reads a boolean environment variable, falling back to def when unset or invalid
+func envBool(name string, def bool) bool {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s %q, using default %t", name, raw, def)
+		return def
+	}
+	return value
+}
+
+// geoIPEnabled reports whether countries are recorded for marketplace events
+func geoIPEnabled() bool {
+	return envBool(GeoIPEnabledEnv, true)
+}
+
+// geoIPMinCountryCount is the number of events a country needs before analytics name it
+func geoIPMinCountryCount() int {
+	return envInt(GeoIPMinCountryCountEnv, defaultGeoIPMinCountryCount)
+}
+
+// geoIPDatabase opens the local MMDB on first use, or returns nil when none is configured
+func geoIPDatabase() *geoip2.Reader {
+	geoIPOnce.Do(func() {
+		path := os.Getenv(GeoIPDBPathEnv)
+		if path == "" {
+			return
+		}
+		reader, err := geoip2.Open(path)
+		if err != nil {
+			log.Printf("⚠️  Failed to open GeoIP database %s, country lookups disabled: %v", path, err)
+			return
+		}
+		geoIPReader = reader
+		log.Printf("✅ Loaded GeoIP database %s", path)
+	})
+	return geoIPReader
+}
+
+// requestCountry returns the ISO country code of a marketplace view or download, or "" when
+// it is unknown or must not be recorded. The proxy's country header wins over a local lookup.
+func requestCountry(r *http.Request) string {
+	if !geoIPEnabled() {
+		return ""
+	}
+	if country := downloadCountry(r); country != "" {
+		return country
+	}
+	if envBool(GeoIPRespectDNTEnv, true) && (r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1") {
+		return ""
+	}
+
+	db := geoIPDatabase()
+	if db == nil {
+		return ""
+	}
+	ip := clientIP(r)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() {
+		return ""
+	}
+	record, err := db.Country(ip)
+	if err != nil {
+		return ""
+	}
+	return record.Country.IsoCode
+}
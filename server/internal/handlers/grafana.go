@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// Annotation queries of the Grafana datasource
+const (
+	GrafanaAnnotationTrainings   = "trainings"
+	GrafanaAnnotationDeployments = "deployments"
+)
+
+// grafanaCustomPrefix marks a custom metric in a target, e.g. "resnet/custom:f1_score"
+const grafanaCustomPrefix = "custom:"
+
+// grafanaMetrics are the built-in metrics a target can chart
+var grafanaMetrics = []string{"epoch", "train_loss", "val_loss", "train_accuracy", "val_accuracy", "test_accuracy"}
+
+// grafanaRange is the time range Grafana sends with queries and annotations
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// parseGrafanaTarget splits a "<model>/<metric>" target
+func parseGrafanaTarget(target string) (string, string, error) {
+	i := strings.LastIndex(target, "/")
+	if i <= 0 || i == len(target)-1 {
+		return "", "", fmt.Errorf("target %q must look like <model>/<metric>", target)
+	}
+	model, metric := target[:i], target[i+1:]
+	if strings.HasPrefix(metric, grafanaCustomPrefix) {
+		return model, metric, nil
+	}
+	for _, known := range grafanaMetrics {
+		if metric == known {
+			return model, metric, nil
+		}
+	}
+	return "", "", fmt.Errorf("unknown metric %q", metric)
+}
+
+// grafanaMetricValue reads a metric from a training_metric_history row
+func grafanaMetricValue(row map[string]interface{}, metric string) (float64, bool) {
+	if name, ok := strings.CutPrefix(metric, grafanaCustomPrefix); ok {
+		custom, _ := row["custom_metrics"].(map[string]interface{})
+		value, ok := custom[name].(float64)
+		return value, ok
+	}
+	switch value := row[metric].(type) {
+	case float64:
+		return value, true
+	case int32:
+		return float64(value), true
+	}
+	return 0, false
+}
+
+// GrafanaTestHandler answers Grafana's "Save & test" of the datasource
+func GrafanaTestHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := readAPIKeyUser(w, r); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "AiManage training history datasource",
+	})
+}
+
+// GrafanaSearchHandler lists the "<model>/<metric>" targets of the caller's training history,
+// filtered by the substring Grafana sends as target
+func GrafanaSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := readAPIKeyUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Target string `json:"target"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	modelNames, err := repository.GetTrainingMetricModels(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get metric models of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to search metrics")
+		return
+	}
+	customNames, err := repository.GetCustomMetricNames(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get custom metrics of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to search metrics")
+		return
+	}
+
+	metrics := append([]string{}, grafanaMetrics...)
+	for _, name := range customNames {
+		metrics = append(metrics, grafanaCustomPrefix+name)
+	}
+
+	targets := []string{}
+	for _, model := range modelNames {
+		for _, metric := range metrics {
+			target := model + "/" + metric
+			if strings.Contains(target, req.Target) {
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(targets)
+}
+
+// GrafanaQueryHandler returns one time series per training for every "<model>/<metric>" target.
+// Series are thinned to maxDataPoints.
+func GrafanaQueryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := readAPIKeyUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Range   grafanaRange `json:"range"`
+		Targets []struct {
+			Target string `json:"target"`
+		} `json:"targets"`
+		MaxDataPoints int `json:"maxDataPoints"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	type series struct {
+		Target     string      `json:"target"`
+		Datapoints [][]float64 `json:"datapoints"` // [value, unix ms]
+	}
+	response := []series{}
+	history := make(map[string][]map[string]interface{})
+
+	for _, t := range req.Targets {
+		if t.Target == "" {
+			continue
+		}
+		model, metric, err := parseGrafanaTarget(t.Target)
+		if err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		rows, fetched := history[model]
+		if !fetched {
+			rows, err = repository.GetTrainingMetricHistory(r.Context(), userID, model, req.Range.From, req.Range.To)
+			if err != nil {
+				log.Printf("❌ Failed to get metric history of %s for user %d: %v", model, userID, err)
+				apierrors.Respond(w, http.StatusInternalServerError, "Failed to query metrics")
+				return
+			}
+			history[model] = rows
+		}
+
+		// Rows are ordered by training, so each training's points are contiguous
+		current := -1
+		for _, row := range rows {
+			value, ok := grafanaMetricValue(row, metric)
+			if !ok {
+				continue
+			}
+			name := getStringField(row, "training_id", "") + " " + metric
+			if current < 0 || response[current].Target != name {
+				response = append(response, series{Target: name})
+				current = len(response) - 1
+			}
+			recordedAt, _ := row["recorded_at"].(time.Time)
+			response[current].Datapoints = append(response[current].Datapoints, []float64{value, float64(recordedAt.UnixMilli())})
+		}
+	}
+
+	if req.MaxDataPoints > 0 {
+		for i := range response {
+			points := response[i].Datapoints
+			if len(points) <= req.MaxDataPoints {
+				continue
+			}
+			step := (len(points) + req.MaxDataPoints - 1) / req.MaxDataPoints
+			thinned := make([][]float64, 0, req.MaxDataPoints+1)
+			for j := 0; j < len(points); j += step {
+				thinned = append(thinned, points[j])
+			}
+			// Keep the last point so the chart ends at the latest value
+			if last := points[len(points)-1]; thinned[len(thinned)-1][1] != last[1] {
+				thinned = append(thinned, last)
+			}
+			response[i].Datapoints = thinned
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GrafanaAnnotationsHandler annotates charts with training runs (as regions) and marketplace
+// deployments: a listing being published or shipping a new version. The annotation query picks
+// "trainings" or "deployments"; an empty query returns both.
+func GrafanaAnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := readAPIKeyUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Range      grafanaRange           `json:"range"`
+		Annotation map[string]interface{} `json:"annotation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	query := strings.TrimSpace(getStringField(req.Annotation, "query", ""))
+	if query != "" && query != GrafanaAnnotationTrainings && query != GrafanaAnnotationDeployments {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("annotation query must be '%s' or '%s'", GrafanaAnnotationTrainings, GrafanaAnnotationDeployments))
+		return
+	}
+
+	annotations := []map[string]interface{}{}
+
+	if query == "" || query == GrafanaAnnotationTrainings {
+		runs, err := repository.GetTrainingRunSpans(r.Context(), userID, req.Range.From, req.Range.To)
+		if err != nil {
+			log.Printf("❌ Failed to get training runs of user %d: %v", userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to get annotations")
+			return
+		}
+		for _, run := range runs {
+			startedAt, _ := run["started_at"].(time.Time)
+			endedAt, _ := run["ended_at"].(time.Time)
+			trainingID := getStringField(run, "training_id", "")
+			annotations = append(annotations, map[string]interface{}{
+				"annotation": req.Annotation,
+				"time":       startedAt.UnixMilli(),
+				"timeEnd":    endedAt.UnixMilli(),
+				"isRegion":   true,
+				"title":      "Training " + trainingID,
+				"text":       fmt.Sprintf("%s ran %d epochs", trainingID, getIntField(run, "epochs", 0)),
+				"tags":       []string{GrafanaAnnotationTrainings, getStringField(run, "model", "")},
+			})
+		}
+	}
+
+	if query == "" || query == GrafanaAnnotationDeployments {
+		deployments, err := repository.GetListingDeployments(r.Context(), userID, req.Range.From, req.Range.To)
+		if err != nil {
+			log.Printf("❌ Failed to get deployments of user %d: %v", userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to get annotations")
+			return
+		}
+		for _, deployment := range deployments {
+			name := getStringField(deployment, "name", "")
+			version := getIntField(deployment, "version", 1)
+			publishedAt, _ := deployment["published_at"].(time.Time)
+			versionAt, _ := deployment["version_published_at"].(time.Time)
+
+			if !publishedAt.Before(req.Range.From) && !publishedAt.After(req.Range.To) {
+				annotations = append(annotations, map[string]interface{}{
+					"annotation": req.Annotation,
+					"time":       publishedAt.UnixMilli(),
+					"title":      "Published " + name,
+					"text":       fmt.Sprintf("%s was published on the marketplace", name),
+					"tags":       []string{GrafanaAnnotationDeployments, name},
+				})
+			}
+			if version > 1 && !versionAt.Before(req.Range.From) && !versionAt.After(req.Range.To) {
+				annotations = append(annotations, map[string]interface{}{
+					"annotation": req.Annotation,
+					"time":       versionAt.UnixMilli(),
+					"title":      fmt.Sprintf("%s v%d", name, version),
+					"text":       fmt.Sprintf("%s shipped version %d", name, version),
+					"tags":       []string{GrafanaAnnotationDeployments, name},
+				})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(annotations)
+}
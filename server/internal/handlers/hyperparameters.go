@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"server/aiAgent"
+)
+
+// pendingHyperparameters holds the hyperparameters of agent trainings until the agent reports them started
+var pendingHyperparameters sync.Map // training ID -> map[string]interface{}
+
+// agentHyperparameters passes the validated hyperparameters of an agent training to its script:
+// as JSON in req.Env, which the agent also writes to a file, and as flags after req.Args with the
+// "args" format. It returns the arguments to start the script with.
+func agentHyperparameters(req *aiAgent.TrainingRequest) ([]string, *trainingStartError) {
+	if len(req.Hyperparameters) == 0 {
+		return req.Args, nil
+	}
+	params, err := json.Marshal(req.Hyperparameters)
+	if err != nil {
+		return nil, &trainingStartError{Status: http.StatusBadRequest, Message: "Invalid hyperparameters"}
+	}
+	if req.Env == nil {
+		req.Env = map[string]string{}
+	}
+	req.Env[aiAgent.HyperparametersEnv] = string(params)
+
+	if req.HyperparameterFormat != aiAgent.HyperparameterFormatArgs {
+		return req.Args, nil
+	}
+	return append(append([]string{}, req.Args...), aiAgent.HyperparameterArgs(req.Hyperparameters)...), nil
+}
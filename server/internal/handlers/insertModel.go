@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"server/helpers"
+	"server/internal/apierrors"
 	"server/internal/middlewares"
 	"server/internal/repository"
 )
@@ -28,7 +32,7 @@ func InsertHandler(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseMultipartForm(500 << 20) // 500 MB for bigger zips
 	if err != nil {
 		log.Println("❌ ParseMultipartForm error:", err)
-		http.Error(w, "Could not parse multipart form: "+err.Error(), http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Could not parse multipart form: "+err.Error())
 		return
 	}
 
@@ -53,31 +57,84 @@ func InsertHandler(w http.ResponseWriter, r *http.Request) {
 
 	name := r.FormValue("name")
 	if name == "" {
-		http.Error(w, "Model name is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Model name is required")
+		return
+	}
+	if err := validModelName(name); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
 		return
 	}
 	log.Println("📄 Received model name:", name)
 
+	// Get user email from context
+	email, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok || email == "" {
+		log.Println("❌ User email not found in context")
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get user from database
+	user, err := repository.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		log.Println("❌ Failed to get user:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+	if user == nil {
+		log.Println("❌ User not found")
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	userID, ok := (*user)["id"].(int32)
+	if !ok {
+		log.Println("❌ Failed to get user ID")
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user ID")
+		return
+	}
+
 	// Check if this is local mode or server mode
 	folderPath := r.FormValue("folder_path")
 	isLocalMode := folderPath != ""
 
 	log.Printf("📍 Mode: %s", map[bool]string{true: "Local", false: "Server"}[isLocalMode])
 
+	// Uploads are staged and only moved into the server directory together with the database
+	// insert, so a failed request or a crash never leaves a partial model folder behind
+	serverModelDir := "./uploads/" + name
+	if err := releaseModelDir(r.Context(), serverModelDir); err != nil {
+		if err == errModelDirInUse {
+			apierrors.Respond(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Println("❌ Failed to prepare model directory:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not create model directory")
+		return
+	}
+	stagingDir, err := newModelStaging()
+	if err != nil {
+		log.Println("❌ Failed to create staging directory:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not create model directory")
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			os.RemoveAll(stagingDir)
+		}
+		endModelStaging(stagingDir)
+	}()
+
 	var modelDir string
 	if isLocalMode {
 		// Local mode: use the provided path
 		modelDir = folderPath
 		log.Printf("📂 Using local folder path: %s", modelDir)
 	} else {
-		// Server mode: create uploads directory
-		modelDir = "./uploads/" + name
-		if err := os.MkdirAll(modelDir, os.ModePerm); err != nil {
-			log.Println("❌ Failed to create model directory:", err)
-			http.Error(w, "Could not create model directory: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		log.Printf("📁 Created server directory: %s", modelDir)
+		// Server mode: files go to the uploads directory once committed
+		modelDir = serverModelDir
+		log.Printf("📁 Staging server directory %s in %s", modelDir, stagingDir)
 	}
 
 	// Handle picture upload (optional)
@@ -87,26 +144,19 @@ func InsertHandler(w http.ResponseWriter, r *http.Request) {
 	if err == nil {
 		defer pictureFile.Close()
 
-		// Always use server uploads directory for pictures
-		serverModelDir := "./uploads/" + name
-		if err := os.MkdirAll(serverModelDir, os.ModePerm); err != nil {
-			log.Println("❌ Failed to create picture directory:", err)
-			http.Error(w, "Could not create picture directory: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		picturePath = serverModelDir + "/" + pictureHeader.Filename
-		pictureOut, err := os.Create(picturePath)
+		pictureOut, err := os.Create(filepath.Join(stagingDir, pictureHeader.Filename))
 		if err != nil {
 			log.Println("❌ Could not create picture file:", err)
-			http.Error(w, "Could not save picture: "+err.Error(), http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Could not save picture")
 			return
 		}
-		defer pictureOut.Close()
-
-		if _, err := io.Copy(pictureOut, pictureFile); err != nil {
+		_, err = io.Copy(pictureOut, pictureFile)
+		if closeErr := pictureOut.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
 			log.Println("❌ Could not write picture file:", err)
-			http.Error(w, "Could not save picture: "+err.Error(), http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Could not save picture")
 			return
 		}
 		// Convert to relative path for database (remove ./ prefix)
@@ -117,6 +167,7 @@ func InsertHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle folder/model zip upload (only for server mode)
+	var scan uploadScan
 	if !isLocalMode {
 		zipFile, zipHeader, err := r.FormFile("folder")
 		if err != nil {
@@ -131,34 +182,45 @@ func InsertHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
-			http.Error(w, "You must provide a model zip file with field name 'folder' for server mode", http.StatusBadRequest)
+			apierrors.Respond(w, http.StatusBadRequest, "You must provide a model zip file with field name 'folder' for server mode")
 			return
 		}
 		defer zipFile.Close()
 
-		zipPath := modelDir + "/" + zipHeader.Filename
+		zipPath := filepath.Join(stagingDir, zipHeader.Filename)
 		out, err := os.Create(zipPath)
 		if err != nil {
 			log.Println("❌ Could not create zip file:", err)
-			http.Error(w, "Could not save zip: "+err.Error(), http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Could not save zip")
 			return
 		}
-		defer out.Close()
-
-		if _, err := io.Copy(out, zipFile); err != nil {
+		_, err = io.Copy(out, zipFile)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
 			log.Println("❌ Could not write zip file:", err)
-			http.Error(w, "Could not save zip: "+err.Error(), http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Could not save zip")
 			return
 		}
 		log.Println("✅ Model zip saved:", zipPath)
 
+		if !screenUploadedArchive(w, r, zipPath, int(userID), name) {
+			return
+		}
+
 		// Extract zip
-		if err := helpers.Unzip(zipPath, modelDir); err != nil {
+		if err := helpers.UnzipWithLimits(zipPath, stagingDir, uploadUnzipLimits()); err != nil {
 			log.Println("❌ Could not unzip file:", err)
-			http.Error(w, "Could not unzip model: "+err.Error(), http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Could not unzip model: "+err.Error())
+			return
+		}
+		log.Println("✅ Model unzipped to:", stagingDir)
+
+		var ok bool
+		if scan, ok = scanUploadedFiles(w, r, zipPath, stagingDir, int(userID), name); !ok {
 			return
 		}
-		log.Println("✅ Model unzipped to:", modelDir)
 
 		// Optional: remove the zip after extraction
 		os.Remove(zipPath)
@@ -166,34 +228,6 @@ func InsertHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("ℹ️ Local mode: Skipping file upload, using local path")
 	}
 
-	// Get user email from context
-	email, ok := r.Context().Value(middlewares.UserEmailKey).(string)
-	if !ok || email == "" {
-		log.Println("❌ User email not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Get user from database
-	user, err := repository.GetUserByEmail(r.Context(), email)
-	if err != nil {
-		log.Println("❌ Failed to get user:", err)
-		http.Error(w, "Failed to get user", http.StatusInternalServerError)
-		return
-	}
-	if user == nil {
-		log.Println("❌ User not found")
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
-
-	userID, ok := (*user)["id"].(int32)
-	if !ok {
-		log.Println("❌ Failed to get user ID")
-		http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
-		return
-	}
-
 	// Get training script path (optional, defaults to "train.py")
 	trainingScript := r.FormValue("training_script")
 	if trainingScript == "" {
@@ -203,16 +237,35 @@ func InsertHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("📜 Training script: %s", trainingScript)
 	}
 
-	// Insert model into database
+	// Insert model into database and move the staged files into place in the same transaction
 	log.Printf("📦 Inserting into PostgreSQL for user %d: name=%s, picture=%s, training_script=%s\n", userID, name, picturePath, trainingScript)
-	modelID, err := repository.InsertModel(r.Context(), int(userID), name, picturePath, []string{modelDir}, trainingScript)
+	hasFiles := !isLocalMode || picturePath != ""
+	renamed := false
+	modelID, err := repository.InsertModelWithFiles(r.Context(), int(userID), name, picturePath, []string{modelDir}, trainingScript, func() error {
+		if !hasFiles {
+			return nil
+		}
+		if err := os.Rename(stagingDir, serverModelDir); err != nil {
+			return fmt.Errorf("could not move model files into place: %w", err)
+		}
+		renamed = true
+		return nil
+	})
 	if err != nil {
+		// Put the files back in staging so the deferred cleanup removes them
+		if renamed {
+			os.Rename(serverModelDir, stagingDir)
+		}
 		log.Println("❌ PostgreSQL insert failed:", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create model")
 		return
 	}
+	committed = hasFiles
 
 	log.Printf("✅ Insert successful! Model ID: %d", modelID)
+	recordUploadScan(modelID, scan)
+	go CheckQuotaWarnings(context.Background(), email)
+	go inspectUploadedDataset(modelID, modelDir)
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("Model added successfully!"))
 }
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// GetInterruptedTrainingsHandler lists the user's server trainings a shutdown interrupted that can
+// still be resumed
+func GetInterruptedTrainingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	trainings, err := repository.GetInterruptedTrainings(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get interrupted trainings of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve interrupted trainings")
+		return
+	}
+	if trainings == nil {
+		trainings = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"trainings": trainings,
+	})
+}
+
+// ResumeInterruptedTrainingHandler starts an interrupted training again with its original request.
+// Trainings that saved a checkpoint resume from it on the server, with the checkpoint in
+// AIMANAGE_RESUME_CHECKPOINT like preempted trainings. The resumed training is a new training that
+// is authorized and charged like any other.
+func (h *TrainingHandler) ResumeInterruptedTrainingHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	userEmail, _ := r.Context().Value(middlewares.UserEmailKey).(string)
+	trainingID := chi.URLParam(r, "trainingId")
+
+	interrupted, err := repository.ClaimInterruptedTraining(r.Context(), trainingID, userID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Interrupted training not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to claim interrupted training %s: %v", trainingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to resume training")
+		return
+	}
+	release := func() {
+		if err := repository.ReleaseInterruptedTraining(r.Context(), trainingID); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+
+	var req aiAgent.TrainingRequest
+	raw, err := json.Marshal(interrupted["request"])
+	if err == nil {
+		err = json.Unmarshal(raw, &req)
+	}
+	modelID := getIntField(interrupted, "model_id", 0)
+	if err != nil || modelID == 0 {
+		release()
+		apierrors.Respond(w, http.StatusConflict, "This training cannot be resumed, start a new one")
+		return
+	}
+	req.ModelID = modelID
+	req.FolderName = ""
+
+	if checkpoint := getStringField(interrupted, "checkpoint_path", ""); checkpoint != "" {
+		env := make(map[string]string, len(req.Env)+2)
+		for key, val := range req.Env {
+			env[key] = val
+		}
+		resumes, _ := strconv.Atoi(env[aiAgent.ResumeCountEnv])
+		env[aiAgent.ResumeCheckpointEnv] = checkpoint
+		env[aiAgent.ResumeCountEnv] = strconv.Itoa(resumes + 1)
+		req.Env = env
+		// The checkpoint is a file on the server
+		req.Placement = PlacementServer
+	}
+
+	result, startErr := h.startTraining(r, userEmail, req)
+	if startErr != nil {
+		release()
+		startErr.write(w)
+		return
+	}
+	resumedID := getStringField(result, "training_id", "")
+	if err := repository.SetInterruptedTrainingResumedAs(r.Context(), trainingID, resumedID); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	log.Printf("▶️  User %d resumed interrupted training %s as %s", userID, trainingID, resumedID)
+
+	result["resumed_from"] = trainingID
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// legalCacheTTL is how long the current document versions are cached between database reads
+const legalCacheTTL = time.Minute
+
+const (
+	maxLegalVersionLength = 32
+	maxLegalContentLength = 200000
+)
+
+var (
+	legalCacheMu      sync.Mutex
+	legalCurrent      []map[string]interface{}
+	legalCurrentSince time.Time
+	// legalAccepted maps user IDs to the documentSignature of the versions they accepted
+	legalAccepted sync.Map
+)
+
+// isLegalKind reports whether kind names a legal document
+func isLegalKind(kind string) bool {
+	return kind == repository.LegalTerms || kind == repository.LegalPrivacy
+}
+
+// currentLegalDocuments returns the current version of each document, cached for legalCacheTTL
+func currentLegalDocuments(ctx context.Context) ([]map[string]interface{}, error) {
+	legalCacheMu.Lock()
+	defer legalCacheMu.Unlock()
+	if legalCurrent != nil && time.Since(legalCurrentSince) < legalCacheTTL {
+		return legalCurrent, nil
+	}
+	documents, err := repository.GetCurrentLegalDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if documents == nil {
+		documents = []map[string]interface{}{}
+	}
+	legalCurrent, legalCurrentSince = documents, time.Now()
+	return documents, nil
+}
+
+// invalidateLegalCache makes the next check read the current versions from the database
+func invalidateLegalCache() {
+	legalCacheMu.Lock()
+	defer legalCacheMu.Unlock()
+	legalCurrent = nil
+}
+
+// documentSignature identifies a set of document versions
+func documentSignature(documents []map[string]interface{}) string {
+	ids := make([]string, 0, len(documents))
+	for _, document := range documents {
+		ids = append(ids, fmt.Sprint(getIntField(document, "id", 0)))
+	}
+	return strings.Join(ids, ",")
+}
+
+// PendingLegalDocuments returns the current documents a user has not accepted yet.
+// Users who accepted every current version are remembered until a new version is published.
+func PendingLegalDocuments(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	current, err := currentLegalDocuments(ctx)
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+	signature := documentSignature(current)
+	if accepted, ok := legalAccepted.Load(userID); ok && accepted.(string) == signature {
+		return nil, nil
+	}
+
+	ids := make([]int, 0, len(current))
+	for _, document := range current {
+		ids = append(ids, getIntField(document, "id", 0))
+	}
+	accepted, err := repository.GetAcceptedLegalDocumentIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []map[string]interface{}
+	for _, document := range current {
+		if !accepted[getIntField(document, "id", 0)] {
+			pending = append(pending, document)
+		}
+	}
+	if len(pending) == 0 {
+		legalAccepted.Store(userID, signature)
+	}
+	return pending, nil
+}
+
+// loginResponse is the body returned by the login endpoints. It lists the documents the user
+// has to accept before the API can be used.
+func loginResponse(ctx context.Context, userID int, token, refreshToken string) map[string]interface{} {
+	pending, err := PendingLegalDocuments(ctx, userID)
+	if err != nil {
+		log.Printf("⚠️  Failed to check terms acceptance of user %d: %v", userID, err)
+	}
+	if pending == nil {
+		pending = []map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"token":                     token,
+		"refresh_token":             refreshToken,
+		"terms_acceptance_required": len(pending) > 0,
+		"pending_legal_documents":   pending,
+	}
+}
+
+// GetLegalDocumentHandler returns the current terms or privacy policy, or the version given as ?version=
+func GetLegalDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	if !isLegalKind(kind) {
+		apierrors.Respond(w, http.StatusNotFound, "Unknown document, use terms or privacy")
+		return
+	}
+
+	document, err := repository.GetLegalDocument(r.Context(), kind, r.URL.Query().Get("version"))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Document not found")
+			return
+		}
+		log.Printf("❌ Failed to get %s document: %v", kind, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve document")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"document": document,
+	})
+}
+
+// GetLegalStatusHandler returns the documents the user still has to accept and their acceptance history
+func GetLegalStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	pending, err := PendingLegalDocuments(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get pending documents of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve documents")
+		return
+	}
+	acceptances, err := repository.GetLegalAcceptances(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get acceptances of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve documents")
+		return
+	}
+	if pending == nil {
+		pending = []map[string]interface{}{}
+	}
+	if acceptances == nil {
+		acceptances = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":                   true,
+		"terms_acceptance_required": len(pending) > 0,
+		"pending_documents":         pending,
+		"acceptances":               acceptances,
+	})
+}
+
+// AcceptLegalDocumentsHandler records that the user accepted document versions, sent as
+// {"versions": {"terms": "...", "privacy": "..."}}. Only current versions can be accepted.
+func AcceptLegalDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Versions map[string]string `json:"versions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Versions) == 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "versions is required")
+		return
+	}
+
+	current, err := currentLegalDocuments(r.Context())
+	if err != nil {
+		log.Printf("❌ Failed to get current documents: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to record acceptance")
+		return
+	}
+	currentByKind := make(map[string]map[string]interface{}, len(current))
+	for _, document := range current {
+		currentByKind[getStringField(document, "kind", "")] = document
+	}
+
+	var ids []int
+	for kind, version := range req.Versions {
+		document, ok := currentByKind[kind]
+		if !ok {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("There is no %s document to accept", kind))
+			return
+		}
+		if getStringField(document, "version", "") != version {
+			apierrors.Respond(w, http.StatusConflict, fmt.Sprintf("Version %s of %s is not current, please review the latest version", version, kind))
+			return
+		}
+		ids = append(ids, getIntField(document, "id", 0))
+	}
+
+	if err := repository.AcceptLegalDocuments(r.Context(), userID, ids); err != nil {
+		log.Printf("❌ Failed to record acceptance of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to record acceptance")
+		return
+	}
+	log.Printf("✅ User %d accepted %v", userID, req.Versions)
+
+	pending, err := PendingLegalDocuments(r.Context(), userID)
+	if err != nil {
+		log.Printf("⚠️  Failed to get pending documents of user %d: %v", userID, err)
+	}
+	if pending == nil {
+		pending = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":                   true,
+		"terms_acceptance_required": len(pending) > 0,
+		"pending_documents":         pending,
+	})
+}
+
+// PublishLegalDocumentHandler lets an admin publish a new version of the terms or privacy policy.
+// Every user has to accept it on their next login or request.
+func PublishLegalDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	kind := chi.URLParam(r, "kind")
+	if !isLegalKind(kind) {
+		apierrors.Respond(w, http.StatusNotFound, "Unknown document, use terms or privacy")
+		return
+	}
+
+	var req struct {
+		Version string `json:"version"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Version = strings.TrimSpace(req.Version)
+	if req.Version == "" || len(req.Version) > maxLegalVersionLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("version is required and cannot be longer than %d characters", maxLegalVersionLength))
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" || len(req.Content) > maxLegalContentLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("content is required and cannot be longer than %d characters", maxLegalContentLength))
+		return
+	}
+
+	document, err := repository.PublishLegalDocument(r.Context(), kind, req.Version, req.Content, adminID)
+	if err != nil {
+		if err == repository.ErrLegalVersionExists {
+			apierrors.Respond(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Printf("❌ Failed to publish %s %s: %v", kind, req.Version, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to publish document")
+		return
+	}
+	invalidateLegalCache()
+	log.Printf("📜 Admin %d published %s version %s", adminID, kind, req.Version)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"document": document,
+	})
+}
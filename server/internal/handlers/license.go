@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// LicenseSigningKeyEnv holds the base64 Ed25519 seed (32 bytes) used to sign license manifests.
+// Without it a key is derived from JWT_SECRET, so manifests stay valid across restarts.
+const LicenseSigningKeyEnv = "LICENSE_SIGNING_KEY"
+
+// LicenseManifestName is the sidecar file added to every marketplace download
+const LicenseManifestName = "aimanage-license.json"
+
+const licenseManifestVersion = 1
+
+// LicenseManifest describes who a marketplace artifact was licensed to.
+// The signature covers the JSON encoding of every other field, in this order.
+type LicenseManifest struct {
+	ManifestVersion  int       `json:"manifest_version"`
+	PublishedModelID int       `json:"published_model_id"`
+	ModelName        string    `json:"model_name"`
+	LicenseType      string    `json:"license_type"`
+	BuyerIDHash      string    `json:"buyer_id_hash"`
+	PurchasedAt      time.Time `json:"purchased_at"`
+	IssuedAt         time.Time `json:"issued_at"`
+	ArtifactName     string    `json:"artifact_name"`
+	ArtifactSHA256   string    `json:"artifact_sha256"`
+	// ListingType tells buyers of weights-only listings that no training code comes with the weights
+	ListingType string `json:"listing_type,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+}
+
+var (
+	licenseKeyOnce sync.Once
+	licenseKey     ed25519.PrivateKey
+)
+
+// licenseSigningKey returns the manifest signing key
+func licenseSigningKey() ed25519.PrivateKey {
+	licenseKeyOnce.Do(func() {
+		if raw := os.Getenv(LicenseSigningKeyEnv); raw != "" {
+			seed, err := base64.StdEncoding.DecodeString(raw)
+			if err == nil && len(seed) == ed25519.SeedSize {
+				licenseKey = ed25519.NewKeyFromSeed(seed)
+				return
+			}
+			log.Printf("⚠️  Invalid %s, it must be a base64 %d-byte seed", LicenseSigningKeyEnv, ed25519.SeedSize)
+		}
+		seed := sha256.Sum256([]byte("aimanage-license:" + os.Getenv("JWT_SECRET")))
+		licenseKey = ed25519.NewKeyFromSeed(seed[:])
+	})
+	return licenseKey
+}
+
+// LicensePublicKey returns the base64 public key third parties verify manifests with
+func LicensePublicKey() string {
+	return base64.StdEncoding.EncodeToString(licenseSigningKey().Public().(ed25519.PublicKey))
+}
+
+// signedPayload is the manifest encoding covered by the signature
+func (m LicenseManifest) signedPayload() ([]byte, error) {
+	m.Signature = ""
+	return json.Marshal(m)
+}
+
+// Sign sets the manifest's signature
+func (m *LicenseManifest) Sign() error {
+	payload, err := m.signedPayload()
+	if err != nil {
+		return err
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(licenseSigningKey(), payload))
+	return nil
+}
+
+// Verify reports whether the manifest was signed by this server and has not been altered
+func (m LicenseManifest) Verify() bool {
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	payload, err := m.signedPayload()
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(licenseSigningKey().Public().(ed25519.PublicKey), payload, signature)
+}
+
+// writeLicensedBundle streams a zip holding the artifact and its signed license manifest.
+// The artifact is written first so its hash is known when the manifest is signed.
+func writeLicensedBundle(w io.Writer, artifactPath, artifactName string, manifest LicenseManifest) error {
+	file, err := os.Open(artifactPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(w)
+	entry, err := archive.Create(artifactName)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(entry, hash), file); err != nil {
+		return err
+	}
+
+	manifest.ArtifactName = artifactName
+	manifest.ArtifactSHA256 = hex.EncodeToString(hash.Sum(nil))
+	if err := manifest.Sign(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	entry, err = archive.Create(LicenseManifestName)
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(data); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// newLicenseManifest builds the unsigned manifest for a buyer's download of a listing
+func newLicenseManifest(ctx context.Context, listing map[string]interface{}, listingID, userID int) LicenseManifest {
+	now := time.Now().UTC()
+	manifest := LicenseManifest{
+		ManifestVersion:  licenseManifestVersion,
+		PublishedModelID: listingID,
+		BuyerIDHash:      anonymizedBuyerRef(listingID, userID),
+		PurchasedAt:      now,
+		IssuedAt:         now,
+	}
+	manifest.ModelName, _ = listing["name"].(string)
+	manifest.LicenseType, _ = listing["license_type"].(string)
+	manifest.ListingType, _ = listing["listing_type"].(string)
+	if manifest.LicenseType == "" {
+		manifest.LicenseType = "personal_use"
+	}
+	if purchasedAt, err := repository.GetModelPurchaseTime(ctx, userID, listingID); err == nil {
+		manifest.PurchasedAt = purchasedAt.UTC()
+	}
+	return manifest
+}
+
+// VerifyLicenseHandler checks the signature of a license manifest found in a marketplace download.
+// It is public so anyone a model is passed to can check where it came from.
+func VerifyLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	var manifest LicenseManifest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&manifest); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid license manifest")
+		return
+	}
+	if manifest.Signature == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "signature is required")
+		return
+	}
+
+	valid := manifest.Verify()
+	response := map[string]interface{}{
+		"success":    true,
+		"valid":      valid,
+		"public_key": LicensePublicKey(),
+	}
+	if valid {
+		response["published_model_id"] = manifest.PublishedModelID
+		response["license_type"] = manifest.LicenseType
+		response["buyer_id_hash"] = manifest.BuyerIDHash
+		response["purchased_at"] = manifest.PurchasedAt
+		if listing, err := repository.GetPublishedModelByID(r.Context(), manifest.PublishedModelID); err == nil {
+			isActive, _ := listing["is_active"].(bool)
+			response["listing_active"] = isActive
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetLicensePublicKeyHandler returns the key license manifests are signed with, for offline verification
+func GetLicensePublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"algorithm":  "ed25519",
+		"public_key": LicensePublicKey(),
+	})
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+	"server/internal/ws"
+)
+
+// Quota names reported by the limits endpoint and quota warnings
+const (
+	QuotaTrainingCredits = "training_credits"
+	QuotaStorage         = "storage"
+	QuotaAPIRate         = "api_rate"
+)
+
+// Quota levels
+const (
+	QuotaLevelOK        = "ok"
+	QuotaLevelWarning   = "warning"
+	QuotaLevelExceeded  = "exceeded"
+	QuotaLevelUnlimited = "unlimited"
+)
+
+// quotaWarningThreshold is the fraction of a quota at which users get a warning
+const quotaWarningThreshold = 0.8
+
+// quotaWarningCooldown prevents the same warning from being sent repeatedly
+const quotaWarningCooldown = time.Hour
+
+// quotaWarningsSweepSize is the number of remembered warnings above which expired cooldowns are dropped
+const quotaWarningsSweepSize = 10000
+
+// Storage limits per tier (in bytes)
+var storageLimits = map[string]int64{
+	TierFree:       1 << 30,   // 1 GB
+	TierBasic:      10 << 30,  // 10 GB
+	TierPro:        50 << 30,  // 50 GB
+	TierEnterprise: 500 << 30, // 500 GB
+}
+
+// QuotaState describes how much of a single quota a user has consumed
+type QuotaState struct {
+	Quota     string     `json:"quota"`
+	Used      int64      `json:"used"`
+	Limit     int64      `json:"limit"`
+	Remaining int64      `json:"remaining"`
+	Percent   float64    `json:"percent"`
+	Level     string     `json:"level"`
+	Unit      string     `json:"unit"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"`
+}
+
+var (
+	quotaWarningsMutex sync.Mutex
+	quotaWarningsSent  = make(map[string]time.Time)
+)
+
+func newQuotaState(quota, unit string, used, limit int64) QuotaState {
+	state := QuotaState{
+		Quota: quota,
+		Used:  used,
+		Limit: limit,
+		Unit:  unit,
+	}
+
+	if limit <= 0 {
+		state.Level = QuotaLevelExceeded
+		state.Percent = 100
+		return state
+	}
+
+	state.Remaining = limit - used
+	if state.Remaining < 0 {
+		state.Remaining = 0
+	}
+	state.Percent = float64(used) / float64(limit) * 100
+
+	switch {
+	case used >= limit:
+		state.Level = QuotaLevelExceeded
+	case float64(used) >= float64(limit)*quotaWarningThreshold:
+		state.Level = QuotaLevelWarning
+	default:
+		state.Level = QuotaLevelOK
+	}
+	return state
+}
+
+// getUserQuotaStates collects the current state of every quota for a user
+func getUserQuotaStates(ctx context.Context, userID int, user map[string]interface{}) []QuotaState {
+	tier := getStringField(user, "subscription_tier", TierFree)
+
+	// Training credits
+	var credits QuotaState
+	if tier == TierEnterprise {
+		credits = QuotaState{Quota: QuotaTrainingCredits, Unit: "credits", Level: QuotaLevelUnlimited}
+	} else {
+		limit := int64(trainingCredits[tier])
+		remaining := int64(getIntField(user, "training_credits", 0))
+		used := limit - remaining
+		if used < 0 {
+			used = 0
+		}
+		credits = newQuotaState(QuotaTrainingCredits, "credits", used, limit)
+		if tier == TierFree {
+			// Free users train locally only, so there is nothing to warn about
+			credits.Level = QuotaLevelOK
+		}
+	}
+	if endDate, ok := user["subscription_end_date"].(time.Time); ok {
+		credits.ResetsAt = &endDate
+	}
+
+	// Storage
+	storageUsed, err := getUserStorageUsage(ctx, userID)
+	if err != nil {
+		log.Printf("⚠️  Failed to calculate storage usage for user %d: %v", userID, err)
+	}
+	storage := newQuotaState(QuotaStorage, "bytes", storageUsed, storageLimits[tier])
+
+	// API rate
+	count, resetAt := middlewares.GetAPIUsage(userID)
+	apiRate := newQuotaState(QuotaAPIRate, "requests", int64(count), int64(middlewares.SoftAPIRateLimit()))
+	apiRate.ResetsAt = &resetAt
+
+	return []QuotaState{credits, storage, apiRate}
+}
+
+// getUserStorageUsage sums the size of all server-side model folders owned by the user
+func getUserStorageUsage(ctx context.Context, userID int) (int64, error) {
+	userModels, err := repository.GetModelsByUserID(ctx, userID, "")
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, model := range userModels {
+		folders, ok := model["folder"].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, f := range folders {
+			folder, ok := f.(string)
+			if !ok || !strings.HasPrefix(filepath.Clean(folder), "uploads") {
+				// Local-mode models live on the user's machine
+				continue
+			}
+			filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return nil
+				}
+				if info, err := d.Info(); err == nil {
+					total += info.Size()
+				}
+				return nil
+			})
+		}
+	}
+	return total, nil
+}
+
+// GetAccountLimitsHandler returns the state of all quotas for the current user
+func GetAccountLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := repository.GetUserByEmail(r.Context(), userEmail)
+	if err != nil || user == nil {
+		log.Printf("❌ User not found: %s", userEmail)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	userID, ok := (*user)["id"].(int32)
+	if !ok {
+		apierrors.Respond(w, http.StatusInternalServerError, "Invalid user ID")
+		return
+	}
+
+	quotas := getUserQuotaStates(r.Context(), int(userID), *user)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"tier":    getStringField(*user, "subscription_tier", TierFree),
+		"limits":  quotas,
+	})
+}
+
+// CheckQuotaWarnings pushes a quota_warning message over WebSocket for every quota
+// that is at or above the warning threshold
+func CheckQuotaWarnings(ctx context.Context, userEmail string) {
+	user, err := repository.GetUserByEmail(ctx, userEmail)
+	if err != nil || user == nil {
+		log.Printf("⚠️  Skipping quota check, user not found: %s", userEmail)
+		return
+	}
+
+	userID, ok := (*user)["id"].(int32)
+	if !ok {
+		return
+	}
+
+	for _, state := range getUserQuotaStates(ctx, int(userID), *user) {
+		if state.Quota == QuotaAPIRate {
+			// API rate warnings are raised by the usage middleware
+			continue
+		}
+		sendQuotaWarning(int(userID), state)
+	}
+}
+
+// WarnAPIRateUsage is called by the API usage middleware when a user approaches the soft rate limit
+func WarnAPIRateUsage(userID, count, limit int) {
+	state := newQuotaState(QuotaAPIRate, "requests", int64(count), int64(limit))
+	_, resetAt := middlewares.GetAPIUsage(userID)
+	state.ResetsAt = &resetAt
+	sendQuotaWarning(userID, state)
+}
+
+func sendQuotaWarning(userID int, state QuotaState) {
+	if state.Level != QuotaLevelWarning && state.Level != QuotaLevelExceeded {
+		return
+	}
+
+	key := fmt.Sprintf("%d:%s:%s", userID, state.Quota, state.Level)
+	quotaWarningsMutex.Lock()
+	if len(quotaWarningsSent) > quotaWarningsSweepSize {
+		for k, last := range quotaWarningsSent {
+			if time.Since(last) >= quotaWarningCooldown {
+				delete(quotaWarningsSent, k)
+			}
+		}
+	}
+	if last, ok := quotaWarningsSent[key]; ok && time.Since(last) < quotaWarningCooldown && state.Quota != QuotaAPIRate {
+		quotaWarningsMutex.Unlock()
+		return
+	}
+	quotaWarningsSent[key] = time.Now()
+	quotaWarningsMutex.Unlock()
+
+	log.Printf("⚠️  Quota %s for user %d is at %.0f%% (%s)", state.Quota, userID, state.Percent, state.Level)
+	ws.BroadcastToUser(userID, map[string]interface{}{
+		"type": "quota_warning",
+		"data": state,
+	})
+}
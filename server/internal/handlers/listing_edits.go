@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// Limits of the editable fields of a listing
+const (
+	maxListingDescriptionLength      = 20000
+	maxListingShortDescriptionLength = 500
+	maxListingCategoryLength         = 100
+)
+
+// validateListingUpdate trims the edited fields of a listing and normalizes its tags. It returns
+// the problem of each invalid field by name.
+func validateListingUpdate(update *repository.ListingUpdate) map[string]string {
+	fields := map[string]string{}
+	if update.Price != nil && *update.Price < 0 {
+		fields["price"] = "price must be non-negative"
+	}
+	if update.Description != nil {
+		description := strings.TrimSpace(*update.Description)
+		if description == "" {
+			fields["description"] = "description cannot be empty"
+		} else if len(description) > maxListingDescriptionLength {
+			fields["description"] = fmt.Sprintf("description must be at most %d characters", maxListingDescriptionLength)
+		}
+		update.Description = &description
+	}
+	if update.ShortDescription != nil {
+		shortDescription := strings.TrimSpace(*update.ShortDescription)
+		if len(shortDescription) > maxListingShortDescriptionLength {
+			fields["short_description"] = fmt.Sprintf("short_description must be at most %d characters", maxListingShortDescriptionLength)
+		}
+		update.ShortDescription = &shortDescription
+	}
+	if update.Category != nil {
+		category := strings.TrimSpace(*update.Category)
+		if len(category) > maxListingCategoryLength {
+			fields["category"] = fmt.Sprintf("category must be at most %d characters", maxListingCategoryLength)
+		}
+		update.Category = &category
+	}
+	if update.Tags != nil {
+		tags, err := normalizeModelTags(*update.Tags)
+		if err != nil {
+			fields["tags"] = err.Error()
+		} else {
+			update.Tags = &tags
+		}
+	}
+	return fields
+}
+
+// writeListingFieldErrors rejects a listing edit with the problem of each invalid field
+func writeListingFieldErrors(w http.ResponseWriter, fields map[string]string) {
+	apierrors.Write(w, apierrors.New(http.StatusBadRequest, apierrors.CodeValidationFailed, "Some fields of the listing are invalid").
+		WithDetails(map[string]interface{}{"fields": fields}))
+}
+
+// GetListingPriceHistoryHandler returns the price changes of a listing, newest first
+func GetListingPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	history, err := repository.GetListingPriceHistory(r.Context(), listingID)
+	if err != nil {
+		log.Printf("❌ Failed to get price history of listing %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get price history")
+		return
+	}
+	if history == nil {
+		history = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"model_id":      listingID,
+		"price_history": history,
+	})
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Marketplace analytics settings
+const (
+	// AnalyticsIntervalEnv is how often, in minutes, yesterday's and today's listing stats are
+	// aggregated again (default 60)
+	AnalyticsIntervalEnv = "ANALYTICS_AGGREGATION_INTERVAL_MINUTES"
+	// AnalyticsBackfillEnv is how many days of listing stats are aggregated at startup (default 365)
+	AnalyticsBackfillEnv = "ANALYTICS_BACKFILL_DAYS"
+)
+
+// maxAnalyticsDays is the longest period of a marketplace analytics time series
+const maxAnalyticsDays = 366
+
+// analyticsDay truncates t to its day
+func analyticsDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StartListingStatsAggregation aggregates the daily stats of marketplace listings over the last
+// ANALYTICS_BACKFILL_DAYS at startup, and then yesterday's and today's every
+// ANALYTICS_AGGREGATION_INTERVAL_MINUTES
+func StartListingStatsAggregation() {
+	interval := time.Duration(envInt(AnalyticsIntervalEnv, 60)) * time.Minute
+	backfill := envInt(AnalyticsBackfillEnv, 365)
+	go func() {
+		tomorrow := analyticsDay(time.Now()).AddDate(0, 0, 1)
+		from := tomorrow.AddDate(0, 0, -backfill)
+		for {
+			written, err := repository.AggregateListingDailyStats(context.Background(), 0, from, tomorrow)
+			if err != nil {
+				log.Printf("⚠️  Listing stats aggregation failed: %v", err)
+			} else {
+				log.Printf("📊 Aggregated %d daily listing stats since %s", written, from.Format("2006-01-02"))
+			}
+			time.Sleep(interval)
+			tomorrow = analyticsDay(time.Now()).AddDate(0, 0, 1)
+			from = tomorrow.AddDate(0, 0, -2)
+		}
+	}()
+}
+
+// dailyStats are a listing's marketplace activity on one day, or over a period. Revenue is in cents.
+type dailyStats struct {
+	Date      string `json:"date,omitempty"`
+	Views     int    `json:"views"`
+	Downloads int    `json:"downloads"`
+	Likes     int    `json:"likes"`
+	Purchases int    `json:"purchases"`
+	Revenue   int    `json:"revenue"`
+}
+
+func (s *dailyStats) add(other dailyStats) {
+	s.Views += other.Views
+	s.Downloads += other.Downloads
+	s.Likes += other.Likes
+	s.Purchases += other.Purchases
+	s.Revenue += other.Revenue
+}
+
+// listingSeries is the time series of one of a publisher's listings
+type listingSeries struct {
+	ModelID  int          `json:"model_id"`
+	Name     string       `json:"name"`
+	IsActive bool         `json:"is_active"`
+	Totals   dailyStats   `json:"totals"`
+	Series   []dailyStats `json:"series"`
+}
+
+// GetMyMarketplaceAnalyticsHandler returns the daily views, downloads, likes, purchases and revenue
+// of each of the caller's listings over a period (from/to as YYYY-MM-DD, last 30 days by default,
+// at most a year), with every day of the period in each series. Pass model_id for one listing.
+func GetMyMarketplaceAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	from, to, err := parseLedgerRange(r)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Whole days: to is exclusive, so a period ending mid-day includes that day
+	from = analyticsDay(from)
+	to = analyticsDay(to.Add(-time.Nanosecond)).AddDate(0, 0, 1)
+	days := int(to.Sub(from).Hours() / 24)
+	if days > maxAnalyticsDays {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("the period cannot be longer than %d days", maxAnalyticsDays))
+		return
+	}
+
+	listingID := 0
+	if raw := r.URL.Query().Get("model_id"); raw != "" {
+		if listingID, err = strconv.Atoi(raw); err != nil || listingID <= 0 {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+			return
+		}
+	}
+
+	listings, err := repository.GetPublishedModelsByPublisher(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get listings of publisher %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve analytics")
+		return
+	}
+
+	// Today's stats are aggregated on request so the last day of the series is current
+	today := analyticsDay(time.Now())
+	if to.After(today) {
+		if _, err := repository.AggregateListingDailyStats(r.Context(), userID, today, today.AddDate(0, 0, 1)); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+	rows, err := repository.GetPublisherDailyStats(r.Context(), userID, listingID, from, to)
+	if err != nil {
+		log.Printf("❌ Failed to get daily stats for publisher %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve analytics")
+		return
+	}
+	byListing := map[int]map[string]dailyStats{}
+	for _, row := range rows {
+		id := getIntField(row, "published_model_id", 0)
+		day, _ := row["day"].(time.Time)
+		if byListing[id] == nil {
+			byListing[id] = map[string]dailyStats{}
+		}
+		byListing[id][day.Format("2006-01-02")] = dailyStats{
+			Views:     getIntField(row, "views", 0),
+			Downloads: getIntField(row, "downloads", 0),
+			Likes:     getIntField(row, "likes", 0),
+			Purchases: getIntField(row, "purchases", 0),
+			Revenue:   getIntField(row, "revenue", 0),
+		}
+	}
+
+	var totals dailyStats
+	series := []listingSeries{}
+	for _, listing := range listings {
+		id := getIntField(listing, "id", 0)
+		if listingID != 0 && id != listingID {
+			continue
+		}
+		isActive, _ := listing["is_active"].(bool)
+		entry := listingSeries{
+			ModelID:  id,
+			Name:     getStringField(listing, "name", ""),
+			IsActive: isActive,
+			Series:   make([]dailyStats, 0, days),
+		}
+		for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+			date := day.Format("2006-01-02")
+			stats := byListing[id][date]
+			stats.Date = date
+			entry.Totals.add(stats)
+			entry.Series = append(entry.Series, stats)
+		}
+		totals.add(entry.Totals)
+		series = append(series, entry)
+	}
+	if listingID != 0 && len(series) == 0 {
+		apierrors.Respond(w, http.StatusNotFound, "Model not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"from":    from.Format("2006-01-02"),
+		"to":      to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"totals":  totals,
+		"models":  series,
+	})
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+)
+
+// LoadTestEnabledEnv turns on the synthetic load generator. Leave it off in production: the
+// synthetic trainings are broadcast to every training WebSocket like real ones.
+const LoadTestEnabledEnv = "LOAD_TEST_ENABLED"
+
+const (
+	maxLoadTestTrainings  = 1000
+	maxLoadTestEpochs     = 1000
+	maxLoadTestBatchLines = 100
+	// maxLoadTestSamples bounds the latency samples kept per run
+	maxLoadTestSamples = 100000
+)
+
+// loadTestRun is a synthetic load run and its measurements
+type loadTestRun struct {
+	ID            string
+	Trainings     int
+	Epochs        int
+	BatchLines    int
+	Interval      time.Duration
+	RecordMetrics bool
+	StartedAt     time.Time
+
+	cancel    context.CancelFunc
+	lines     atomic.Int64
+	completed atomic.Int64
+
+	mu         sync.Mutex
+	finishedAt *time.Time
+	stopped    bool
+	latencies  []time.Duration
+}
+
+var (
+	loadTestMu      sync.Mutex
+	currentLoadTest *loadTestRun
+)
+
+// loadTestEnabled reports whether LOAD_TEST_ENABLED is set
+func loadTestEnabled() bool {
+	return envBool(LoadTestEnabledEnv, false)
+}
+
+// observe records how long the server took to handle one line
+func (run *loadTestRun) observe(latency time.Duration) {
+	run.lines.Add(1)
+	run.mu.Lock()
+	if len(run.latencies) < maxLoadTestSamples {
+		run.latencies = append(run.latencies, latency)
+	}
+	run.mu.Unlock()
+}
+
+// running reports whether the run has not finished yet
+func (run *loadTestRun) running() bool {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.finishedAt == nil
+}
+
+// simulate plays one synthetic training through the same path as trainings on local agents:
+// progress creation, output parsing, metric broadcasts and, optionally, metric history writes
+func (run *loadTestRun) simulate(ctx context.Context, index, userID int) {
+	trainingID := fmt.Sprintf("loadtest-%s-%d_%d", run.ID, index, run.StartedAt.Unix())
+	createRemoteTrainingProgress(trainingID, userID)
+	defer globalTrainer.ClearModelTrainings(aiAgent.ModelNameFromTrainingID(trainingID))
+
+	generator := aiAgent.NewSyntheticTraining(run.StartedAt.UnixNano()+int64(index), run.Epochs, run.BatchLines)
+	// Spread the trainings over the first interval so they don't emit in lockstep
+	delay := time.Duration(rand.Int63n(int64(run.Interval)))
+	for !generator.Done() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = run.Interval
+
+		for _, line := range generator.NextEpoch() {
+			start := time.Now()
+			updateRemoteTrainingProgress(trainingID, line)
+			run.observe(time.Since(start))
+		}
+	}
+
+	if progress, err := globalTrainer.GetProgress(trainingID); err == nil {
+		progress.MarkCompleted()
+	}
+	run.completed.Add(1)
+}
+
+// start runs every synthetic training and marks the run finished when they are done
+func (run *loadTestRun) start(userID int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run.cancel = cancel
+
+	var wg sync.WaitGroup
+	for i := 0; i < run.Trainings; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			run.simulate(ctx, index, userID)
+		}(i)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		now := time.Now()
+		run.mu.Lock()
+		run.finishedAt = &now
+		run.mu.Unlock()
+		log.Printf("🏁 Load test %s finished: %d lines from %d/%d trainings in %v",
+			run.ID, run.lines.Load(), run.completed.Load(), run.Trainings, now.Sub(run.StartedAt).Round(time.Millisecond))
+	}()
+}
+
+// report summarizes the run's throughput and per-line handling latency
+func (run *loadTestRun) report() map[string]interface{} {
+	run.mu.Lock()
+	finishedAt, stopped := run.finishedAt, run.stopped
+	latencies := append([]time.Duration(nil), run.latencies...)
+	run.mu.Unlock()
+
+	end := time.Now()
+	if finishedAt != nil {
+		end = *finishedAt
+	}
+	elapsed := end.Sub(run.StartedAt)
+	lines := run.lines.Load()
+
+	linesPerSecond := 0.0
+	if elapsed > 0 {
+		linesPerSecond = float64(lines) / elapsed.Seconds()
+	}
+	// Rate the generator aims for: every training emits one epoch per interval
+	targetLinesPerSecond := float64(run.Trainings*(run.BatchLines+1)) / run.Interval.Seconds()
+
+	latency := map[string]interface{}{}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var total time.Duration
+		for _, l := range latencies {
+			total += l
+		}
+		percentile := func(p float64) float64 {
+			return float64(latencies[int(p*float64(len(latencies)-1))].Microseconds()) / 1000
+		}
+		latency = map[string]interface{}{
+			"avg_ms": float64((total / time.Duration(len(latencies))).Microseconds()) / 1000,
+			"p50_ms": percentile(0.50),
+			"p95_ms": percentile(0.95),
+			"p99_ms": percentile(0.99),
+			"max_ms": float64(latencies[len(latencies)-1].Microseconds()) / 1000,
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return map[string]interface{}{
+		"id":                      run.ID,
+		"running":                 finishedAt == nil,
+		"stopped":                 stopped,
+		"trainings":               run.Trainings,
+		"epochs":                  run.Epochs,
+		"batch_lines":             run.BatchLines,
+		"interval_ms":             run.Interval.Milliseconds(),
+		"record_metrics":          run.RecordMetrics,
+		"started_at":              run.StartedAt,
+		"finished_at":             finishedAt,
+		"elapsed_seconds":         elapsed.Seconds(),
+		"completed_trainings":     run.completed.Load(),
+		"lines":                   lines,
+		"lines_per_second":        linesPerSecond,
+		"target_lines_per_second": targetLinesPerSecond,
+		"line_latency":            latency,
+		"goroutines":              runtime.NumGoroutine(),
+		"heap_alloc_mb":           float64(mem.HeapAlloc) / (1024 * 1024),
+	}
+}
+
+// requireLoadTest answers 404 unless the load generator is enabled, then checks for an admin
+func requireLoadTest(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if !loadTestEnabled() {
+		http.NotFound(w, r)
+		return 0, false
+	}
+	if globalTrainer == nil {
+		apierrors.Respond(w, http.StatusServiceUnavailable, "Trainer not initialized")
+		return 0, false
+	}
+	return requireAdmin(w, r)
+}
+
+// StartLoadTestHandler starts a synthetic load run. Only one run can be active at a time.
+// Body: {"trainings": 50, "epochs": 20, "batch_lines": 5, "interval_ms": 1000, "record_metrics": false}
+func StartLoadTestHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireLoadTest(w, r)
+	if !ok {
+		return
+	}
+
+	req := struct {
+		Trainings     int  `json:"trainings"`
+		Epochs        int  `json:"epochs"`
+		BatchLines    int  `json:"batch_lines"`
+		IntervalMS    int  `json:"interval_ms"`
+		RecordMetrics bool `json:"record_metrics"`
+	}{Trainings: 10, Epochs: 20, BatchLines: 5, IntervalMS: 1000}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Trainings < 1 || req.Trainings > maxLoadTestTrainings {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("trainings must be between 1 and %d", maxLoadTestTrainings))
+		return
+	}
+	if req.Epochs < 1 || req.Epochs > maxLoadTestEpochs {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("epochs must be between 1 and %d", maxLoadTestEpochs))
+		return
+	}
+	if req.BatchLines < 0 || req.BatchLines > maxLoadTestBatchLines {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("batch_lines must be between 0 and %d", maxLoadTestBatchLines))
+		return
+	}
+	if req.IntervalMS < 10 {
+		apierrors.Respond(w, http.StatusBadRequest, "interval_ms must be at least 10")
+		return
+	}
+
+	loadTestMu.Lock()
+	if currentLoadTest != nil && currentLoadTest.running() {
+		loadTestMu.Unlock()
+		apierrors.Respond(w, http.StatusConflict, "A load test is already running")
+		return
+	}
+	run := &loadTestRun{
+		ID:            fmt.Sprintf("%x", time.Now().UnixNano()),
+		Trainings:     req.Trainings,
+		Epochs:        req.Epochs,
+		BatchLines:    req.BatchLines,
+		Interval:      time.Duration(req.IntervalMS) * time.Millisecond,
+		RecordMetrics: req.RecordMetrics,
+		StartedAt:     time.Now(),
+	}
+	currentLoadTest = run
+	loadTestMu.Unlock()
+
+	// Metric history is only written for trainings that belong to a user
+	userID := 0
+	if req.RecordMetrics {
+		userID = adminID
+	}
+	run.start(userID)
+	log.Printf("🧪 Admin %d started load test %s: %d trainings x %d epochs", adminID, run.ID, run.Trainings, run.Epochs)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"load_test": run.report(),
+	})
+}
+
+// GetLoadTestHandler returns the measurements of the current or last load run
+func GetLoadTestHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireLoadTest(w, r); !ok {
+		return
+	}
+
+	loadTestMu.Lock()
+	run := currentLoadTest
+	loadTestMu.Unlock()
+
+	var report map[string]interface{}
+	if run != nil {
+		report = run.report()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"load_test": report,
+	})
+}
+
+// StopLoadTestHandler stops the running load test
+func StopLoadTestHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireLoadTest(w, r)
+	if !ok {
+		return
+	}
+
+	loadTestMu.Lock()
+	run := currentLoadTest
+	loadTestMu.Unlock()
+	if run == nil || !run.running() {
+		apierrors.Respond(w, http.StatusNotFound, "No load test is running")
+		return
+	}
+
+	run.mu.Lock()
+	run.stopped = true
+	run.mu.Unlock()
+	run.cancel()
+	log.Printf("🛑 Admin %d stopped load test %s", adminID, run.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"load_test": run.report(),
+	})
+}
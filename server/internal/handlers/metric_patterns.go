@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"server/internal/apierrors"
+	"server/internal/metricparse"
+	"server/internal/repository"
+)
+
+// pendingMetricPatterns holds the custom metric patterns of agent trainings until the agent
+// reports them started
+var pendingMetricPatterns sync.Map // training ID -> []metricparse.Pattern
+
+// modelMetricPatterns returns the custom metric patterns of a model, none if they cannot be read
+func modelMetricPatterns(ctx context.Context, modelID int) []metricparse.Pattern {
+	patterns, err := repository.GetModelMetricPatterns(ctx, modelID)
+	if err != nil {
+		log.Printf("⚠️  Failed to get metric patterns of model %d, using the built-in parsers: %v", modelID, err)
+		return nil
+	}
+	return patterns
+}
+
+// GetModelMetricPatternsHandler returns the custom metric patterns of a model the user may train,
+// and the built-in parsers tried after them
+func GetModelMetricPatternsHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForTrainer(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	patterns, err := repository.GetModelMetricPatterns(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to get metric patterns of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get metric patterns")
+		return
+	}
+	if patterns == nil {
+		patterns = []metricparse.Pattern{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"patterns":        patterns,
+		"builtin_parsers": metricparse.Builtin,
+	})
+}
+
+// UpdateModelMetricPatternsHandler replaces the custom metric patterns of one of the user's models,
+// e.g. {"patterns": [{"name": "detection", "pattern": "step (?P<epoch>\\d+) mAP (?P<map50>[0-9.]+)"}]}.
+// Named groups are the metrics a pattern reads. They apply to trainings started afterwards.
+func UpdateModelMetricPatternsHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	var req struct {
+		Patterns []metricparse.Pattern `json:"patterns"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := metricparse.ValidatePatterns(req.Patterns); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := repository.SetModelMetricPatterns(r.Context(), modelID, req.Patterns); err != nil {
+		log.Printf("❌ Failed to set metric patterns of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update metric patterns")
+		return
+	}
+	log.Printf("✅ Model %d now has %d metric patterns", modelID, len(req.Patterns))
+
+	if req.Patterns == nil {
+		req.Patterns = []metricparse.Pattern{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"patterns": req.Patterns,
+	})
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/repository"
+)
+
+// modelStagingDir holds model uploads until they are committed. It is inside the uploads
+// directory so committing is a rename on the same filesystem.
+var modelStagingDir = filepath.Join("./uploads", ".staging")
+
+// staleStagingAge is the age from which a staged upload is considered abandoned
+const staleStagingAge = time.Hour
+
+// validModelName rejects model names that are not a single folder name under uploads
+func validModelName(name string) error {
+	if strings.TrimSpace(name) != name || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) || len(name) > 255 {
+		return fmt.Errorf("model name must not start with a dot, contain slashes or surrounding spaces")
+	}
+	return nil
+}
+
+// errModelDirInUse is returned when another model already stores its files under the name
+var errModelDirInUse = fmt.Errorf("a model with this name already exists")
+
+// activeStaging holds the names of the staging folders requests are still writing, which the
+// cleanup must not remove however long the upload takes
+var (
+	activeStagingMutex sync.Mutex
+	activeStaging      = map[string]bool{}
+)
+
+// newModelStaging creates an empty staging folder for a model upload. The folder is kept from the
+// cleanup until endModelStaging is called.
+func newModelStaging() (string, error) {
+	if err := os.MkdirAll(modelStagingDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(modelStagingDir, "model-")
+	if err != nil {
+		return "", err
+	}
+	activeStagingMutex.Lock()
+	activeStaging[filepath.Base(dir)] = true
+	activeStagingMutex.Unlock()
+	// MkdirTemp creates private folders; committed model folders are readable like any upload
+	return dir, os.Chmod(dir, 0o755)
+}
+
+// endModelStaging lets the cleanup remove a staging folder once its request is done with it
+func endModelStaging(dir string) {
+	activeStagingMutex.Lock()
+	delete(activeStaging, filepath.Base(dir))
+	activeStagingMutex.Unlock()
+}
+
+// stagingActive reports whether a request is still writing the staging folder of that name
+func stagingActive(name string) bool {
+	activeStagingMutex.Lock()
+	defer activeStagingMutex.Unlock()
+	return activeStaging[name]
+}
+
+// releaseModelDir makes dir available for a new model. A folder left by an upload that failed
+// before this was transactional is discarded; one that belongs to a model is a conflict.
+func releaseModelDir(ctx context.Context, dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	inUse, err := repository.ModelFilesInUse(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return errModelDirInUse
+	}
+
+	orphan, err := newModelStaging()
+	if err != nil {
+		return err
+	}
+	defer endModelStaging(orphan)
+	// Moved into staging first so the folder disappears atomically; the cleanup removes it if this fails
+	if err := os.Rename(dir, filepath.Join(orphan, "orphan")); err != nil {
+		return err
+	}
+	log.Printf("🧹 Discarded orphaned model folder %s", dir)
+	return os.RemoveAll(orphan)
+}
+
+// StartStagingCleanup removes, in the background, staged model uploads abandoned by a failed
+// request or a crash
+func StartStagingCleanup() {
+	go removeAbandonedStaging()
+}
+
+// removeAbandonedStaging deletes staged uploads older than staleStagingAge that no request is
+// still writing, and returns how many it removed. It runs while uploads are served, so a slow
+// upload's folder is skipped however old it is.
+func removeAbandonedStaging() int {
+	entries, err := os.ReadDir(modelStagingDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️  Failed to read model staging folder: %v", err)
+		}
+		return 0
+	}
+	removed := 0
+	for _, entry := range entries {
+		if stagingActive(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleStagingAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(modelStagingDir, entry.Name())); err != nil {
+			log.Printf("⚠️  Failed to remove staged upload %s: %v", entry.Name(), err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("🧹 Removed %d abandoned model uploads", removed)
+	}
+	return removed
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveAbandonedStagingSkipsActiveUploads(t *testing.T) {
+	previous := modelStagingDir
+	modelStagingDir = t.TempDir()
+	t.Cleanup(func() { modelStagingDir = previous })
+
+	old := time.Now().Add(-2 * staleStagingAge)
+	active, err := newModelStaging()
+	if err != nil {
+		t.Fatalf("newModelStaging: %v", err)
+	}
+	defer endModelStaging(active)
+	abandoned, err := newModelStaging()
+	if err != nil {
+		t.Fatalf("newModelStaging: %v", err)
+	}
+	endModelStaging(abandoned)
+	recent, err := newModelStaging()
+	if err != nil {
+		t.Fatalf("newModelStaging: %v", err)
+	}
+	endModelStaging(recent)
+	for _, dir := range []string{active, abandoned} {
+		if err := os.Chtimes(dir, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if removed := removeAbandonedStaging(); removed != 1 {
+		t.Errorf("removed %d staged uploads, want 1", removed)
+	}
+	if _, err := os.Stat(abandoned); !os.IsNotExist(err) {
+		t.Errorf("abandoned staging %s was kept", filepath.Base(abandoned))
+	}
+	for _, dir := range []string{active, recent} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("staging %s was removed: %v", filepath.Base(dir), err)
+		}
+	}
+}
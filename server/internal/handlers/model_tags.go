@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	maxModelTags        = 20
+	maxModelTagLength   = 50
+	maxModelNotesLength = 10000
+)
+
+// normalizeModelTags trims and lowercases tags and removes blanks and duplicates
+func normalizeModelTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxModelTagLength {
+			return nil, fmt.Errorf("tags must be at most %d characters", maxModelTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxModelTags {
+		return nil, fmt.Errorf("a model can have at most %d tags", maxModelTags)
+	}
+	return normalized, nil
+}
+
+// UpdateModelTagsHandler sets the tags and notes of one of the user's models. Omitted fields are
+// left unchanged; an empty list or string clears them.
+func UpdateModelTagsHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	var req struct {
+		Tags  *[]string `json:"tags"`
+		Notes *string   `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Tags == nil && req.Notes == nil {
+		apierrors.Respond(w, http.StatusBadRequest, "tags or notes is required")
+		return
+	}
+
+	var tags []string
+	if req.Tags != nil {
+		var err error
+		if tags, err = normalizeModelTags(*req.Tags); err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Notes != nil && len(*req.Notes) > maxModelNotesLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("notes must be at most %d characters", maxModelNotesLength))
+		return
+	}
+
+	if err := repository.UpdateModelTagsAndNotes(r.Context(), modelID, tags, req.Notes); err != nil {
+		log.Printf("❌ Failed to update tags of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update model")
+		return
+	}
+
+	updated, err := repository.GetModelByID(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to reload model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"tags":    (*updated)["tags"],
+		"notes":   (*updated)["notes"],
+	})
+}
+
+// GetModelTagsHandler lists the tags of the user's models with how many models have each, to filter
+// the models list by (GET /getModels?tag=...)
+func GetModelTagsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	tags, err := repository.GetUserModelTags(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get model tags of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve tags")
+		return
+	}
+	if tags == nil {
+		tags = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"tags":    tags,
+	})
+}
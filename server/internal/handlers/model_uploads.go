@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"server/helpers"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Chunk sizes clients may choose for a chunked upload
+const (
+	defaultUploadChunkSize = 8 << 20
+	minUploadChunkSize     = 1 << 20
+	maxUploadChunkSize     = 64 << 20
+)
+
+// uploadChunksDir is where chunks of uploads in progress are kept. It is outside the uploads
+// directory, which is served publicly.
+func uploadChunksDir() string {
+	if dir := os.Getenv("UPLOAD_CHUNKS_PATH"); dir != "" {
+		return dir
+	}
+	return "./upload-chunks"
+}
+
+// maxModelUploadSize is the largest model zip a chunked upload accepts
+func maxModelUploadSize() int64 {
+	return int64(envInt("MODEL_UPLOAD_MAX_MB", 5120)) << 20
+}
+
+// modelUploadExpiry is how long an upload is kept after its last chunk arrived
+func modelUploadExpiry() time.Duration {
+	return time.Duration(envInt("MODEL_UPLOAD_EXPIRY_HOURS", 24)) * time.Hour
+}
+
+// uploadChunkSize is the size of chunk index of an upload: chunk_size, or the rest for the last chunk
+func uploadChunkSize(upload map[string]interface{}, index int) int64 {
+	size := upload["size_bytes"].(int64)
+	chunkSize := int64(getIntField(upload, "chunk_size", defaultUploadChunkSize))
+	return min(chunkSize, size-int64(index)*chunkSize)
+}
+
+// getOwnModelUpload loads the upload named in the URL, writing the error response if it cannot
+func getOwnModelUpload(w http.ResponseWriter, r *http.Request) (map[string]interface{}, int, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return nil, 0, false
+	}
+	uploadID := chi.URLParam(r, "uploadId")
+	upload, err := repository.GetModelUpload(r.Context(), uploadID, userID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Upload not found or expired")
+		return nil, 0, false
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get upload %s: %v", uploadID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve upload")
+		return nil, 0, false
+	}
+	return upload, userID, true
+}
+
+// CreateModelUploadHandler starts a chunked upload of a model zip. The client sends the zip's
+// size and SHA-256, then its chunks, and completes the upload to create the model.
+func CreateModelUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Filename  string `json:"filename"`
+		Size      int64  `json:"size"`
+		SHA256    string `json:"sha256"`
+		ChunkSize int64  `json:"chunk_size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Filename = filepath.Base(strings.TrimSpace(req.Filename))
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if req.Filename == "." || req.Filename == string(filepath.Separator) || !strings.HasSuffix(strings.ToLower(req.Filename), ".zip") {
+		apierrors.Respond(w, http.StatusBadRequest, "filename must name a .zip file")
+		return
+	}
+	if req.Size <= 0 || req.Size > maxModelUploadSize() {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("size must be between 1 byte and %d MB", maxModelUploadSize()>>20))
+		return
+	}
+	if !sha256Pattern.MatchString(req.SHA256) {
+		apierrors.Respond(w, http.StatusBadRequest, "sha256 must be the hex SHA-256 of the zip")
+		return
+	}
+	if req.ChunkSize == 0 {
+		req.ChunkSize = defaultUploadChunkSize
+	}
+	if req.ChunkSize < minUploadChunkSize || req.ChunkSize > maxUploadChunkSize {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("chunk_size must be between %d and %d bytes", minUploadChunkSize, maxUploadChunkSize))
+		return
+	}
+	totalChunks := int((req.Size + req.ChunkSize - 1) / req.ChunkSize)
+
+	uploadID, err := helpers.GenerateRandomString(24)
+	if err != nil {
+		log.Printf("❌ Failed to generate upload ID: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+	expiresAt := time.Now().Add(modelUploadExpiry())
+	if err := repository.CreateModelUpload(r.Context(), uploadID, userID, req.Filename, req.Size, int(req.ChunkSize), totalChunks, req.SHA256, expiresAt); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+	log.Printf("📦 User %d started upload %s of %s (%d bytes in %d chunks)", userID, uploadID, req.Filename, req.Size, totalChunks)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"upload_id":    uploadID,
+		"chunk_size":   req.ChunkSize,
+		"total_chunks": totalChunks,
+		"expires_at":   expiresAt,
+	})
+}
+
+// UploadModelChunkHandler stores one chunk of an upload from the raw request body. Sending a
+// chunk again replaces it, so a client resumes after a failure by resending the missing chunks.
+// An X-Chunk-SHA256 header, when set, is checked against the chunk.
+func UploadModelChunkHandler(w http.ResponseWriter, r *http.Request) {
+	upload, _, ok := getOwnModelUpload(w, r)
+	if !ok {
+		return
+	}
+	uploadID := getStringField(upload, "id", "")
+	if status := getStringField(upload, "status", ""); status != repository.ModelUploadUploading {
+		apierrors.Respond(w, http.StatusConflict, "Upload is "+status)
+		return
+	}
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if err != nil || index < 0 || index >= getIntField(upload, "total_chunks", 0) {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid chunk index")
+		return
+	}
+	expected := uploadChunkSize(upload, index)
+
+	dir := filepath.Join(uploadChunksDir(), uploadID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Printf("❌ Failed to create chunk folder of upload %s: %v", uploadID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to store chunk")
+		return
+	}
+	tmp, err := os.CreateTemp(dir, "chunk-*")
+	if err != nil {
+		log.Printf("❌ Failed to create chunk of upload %s: %v", uploadID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to store chunk")
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), http.MaxBytesReader(w, r.Body, expected+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && written != expected) {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("Chunk %d must be %d bytes", index, expected))
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to receive chunk %d of upload %s: %v", index, uploadID, err)
+		apierrors.Respond(w, http.StatusBadRequest, "Failed to receive chunk")
+		return
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if want := strings.ToLower(r.Header.Get("X-Chunk-SHA256")); want != "" && want != sum {
+		apierrors.Respond(w, http.StatusUnprocessableEntity, fmt.Sprintf("Chunk %d does not match its X-Chunk-SHA256", index))
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(index))); err != nil {
+		log.Printf("❌ Failed to store chunk %d of upload %s: %v", index, uploadID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to store chunk")
+		return
+	}
+	if err := repository.RecordModelUploadChunk(r.Context(), uploadID, index, int(written), sum, time.Now().Add(modelUploadExpiry())); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to store chunk")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"index":   index,
+		"size":    written,
+		"sha256":  sum,
+	})
+}
+
+// uploadProgress returns the indexes of the chunks received and still missing
+func uploadProgress(ctx context.Context, upload map[string]interface{}) (received, missing []int, err error) {
+	chunks, err := repository.GetModelUploadChunks(ctx, getStringField(upload, "id", ""))
+	if err != nil {
+		return nil, nil, err
+	}
+	have := make(map[int]bool, len(chunks))
+	for _, chunk := range chunks {
+		have[getIntField(chunk, "chunk_index", -1)] = true
+	}
+	received, missing = []int{}, []int{}
+	for i := 0; i < getIntField(upload, "total_chunks", 0); i++ {
+		if have[i] {
+			received = append(received, i)
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	return received, missing, nil
+}
+
+// GetModelUploadHandler returns the state of an upload and the chunks it still needs, so a
+// client can resume it
+func GetModelUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, _, ok := getOwnModelUpload(w, r)
+	if !ok {
+		return
+	}
+	received, missing, err := uploadProgress(r.Context(), upload)
+	if err != nil {
+		log.Printf("❌ Failed to get chunks of upload %s: %v", getStringField(upload, "id", ""), err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve upload")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"upload":          upload,
+		"received_chunks": received,
+		"missing_chunks":  missing,
+	})
+}
+
+// assembleModelUpload writes the chunks of an upload in order to path and returns the SHA-256
+// of the result
+func assembleModelUpload(uploadID string, totalChunks int, path string) (string, error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	writer := io.MultiWriter(out, hash)
+	for i := 0; i < totalChunks; i++ {
+		chunk, err := os.Open(filepath.Join(uploadChunksDir(), uploadID, strconv.Itoa(i)))
+		if err != nil {
+			return "", fmt.Errorf("chunk %d is missing: %w", i, err)
+		}
+		_, err = io.Copy(writer, chunk)
+		chunk.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to assemble chunk %d: %w", i, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CompleteModelUploadHandler assembles a fully received upload, checks it against the SHA-256
+// given when it started and creates the model from it like InsertHandler does. The form carries
+// the model's name, training_script and optional picture.
+func CompleteModelUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, userID, ok := getOwnModelUpload(w, r)
+	if !ok {
+		return
+	}
+	uploadID := getStringField(upload, "id", "")
+	email, _ := r.Context().Value(middlewares.UserEmailKey).(string)
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		apierrors.Respond(w, http.StatusBadRequest, "Could not parse form: "+err.Error())
+		return
+	}
+	name := r.FormValue("name")
+	if name == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "Model name is required")
+		return
+	}
+	if err := validModelName(name); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	trainingScript := r.FormValue("training_script")
+	if trainingScript == "" {
+		trainingScript = "train.py"
+	}
+
+	// Only one request completes an upload; any failure below makes it completable again
+	claimed, err := repository.ClaimModelUpload(r.Context(), uploadID, repository.ModelUploadUploading, repository.ModelUploadCompleting)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to complete upload")
+		return
+	}
+	if !claimed {
+		apierrors.Respond(w, http.StatusConflict, "Upload is already being completed or was completed")
+		return
+	}
+	completed := false
+	defer func() {
+		if !completed {
+			if _, err := repository.ClaimModelUpload(context.Background(), uploadID, repository.ModelUploadCompleting, repository.ModelUploadUploading); err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+		}
+	}()
+
+	_, missing, err := uploadProgress(r.Context(), upload)
+	if err != nil {
+		log.Printf("❌ Failed to get chunks of upload %s: %v", uploadID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to complete upload")
+		return
+	}
+	if len(missing) > 0 {
+		apierrors.Write(w, apierrors.New(http.StatusConflict, apierrors.CodeUploadIncomplete, fmt.Sprintf("%d chunks are missing", len(missing))).
+			WithDetails(map[string]interface{}{"missing_chunks": missing}))
+		return
+	}
+
+	serverModelDir := "./uploads/" + name
+	if err := releaseModelDir(r.Context(), serverModelDir); err != nil {
+		if err == errModelDirInUse {
+			apierrors.Respond(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Println("❌ Failed to prepare model directory:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not create model directory")
+		return
+	}
+	stagingDir, err := newModelStaging()
+	if err != nil {
+		log.Println("❌ Failed to create staging directory:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not create model directory")
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			os.RemoveAll(stagingDir)
+		}
+		endModelStaging(stagingDir)
+	}()
+
+	var picturePath string
+	if pictureFile, pictureHeader, err := r.FormFile("picture"); err == nil {
+		defer pictureFile.Close()
+		pictureName := filepath.Base(pictureHeader.Filename)
+		pictureOut, err := os.Create(filepath.Join(stagingDir, pictureName))
+		if err == nil {
+			_, err = io.Copy(pictureOut, pictureFile)
+			if closeErr := pictureOut.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			log.Println("❌ Could not write picture file:", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Could not save picture")
+			return
+		}
+		picturePath = "/uploads/" + name + "/" + pictureName
+	}
+
+	zipPath := filepath.Join(stagingDir, getStringField(upload, "filename", "model.zip"))
+	sum, err := assembleModelUpload(uploadID, getIntField(upload, "total_chunks", 0), zipPath)
+	if err != nil {
+		log.Printf("❌ Failed to assemble upload %s: %v", uploadID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not assemble zip")
+		return
+	}
+	if want := getStringField(upload, "sha256", ""); sum != want {
+		log.Printf("⚠️  Upload %s assembled to SHA-256 %s, expected %s", uploadID, sum, want)
+		apierrors.Write(w, apierrors.New(http.StatusUnprocessableEntity, apierrors.CodeChecksumMismatch, "The assembled zip does not match the upload's sha256; check and resend its chunks").
+			WithDetails(map[string]interface{}{"sha256": sum}))
+		return
+	}
+	if !screenUploadedArchive(w, r, zipPath, userID, name) {
+		return
+	}
+	if err := helpers.UnzipWithLimits(zipPath, stagingDir, uploadUnzipLimits()); err != nil {
+		log.Println("❌ Could not unzip file:", err)
+		apierrors.Respond(w, http.StatusBadRequest, "Could not unzip model: "+err.Error())
+		return
+	}
+	scan, ok := scanUploadedFiles(w, r, zipPath, stagingDir, userID, name)
+	if !ok {
+		return
+	}
+	os.Remove(zipPath)
+
+	renamed := false
+	modelID, err := repository.InsertModelWithFiles(r.Context(), userID, name, picturePath, []string{serverModelDir}, trainingScript, func() error {
+		if err := os.Rename(stagingDir, serverModelDir); err != nil {
+			return fmt.Errorf("could not move model files into place: %w", err)
+		}
+		renamed = true
+		return nil
+	})
+	if err != nil {
+		if renamed {
+			os.Rename(serverModelDir, stagingDir)
+		}
+		log.Println("❌ PostgreSQL insert failed:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create model")
+		return
+	}
+	committed = true
+	recordUploadScan(modelID, scan)
+
+	if err := repository.CompleteModelUpload(r.Context(), uploadID, modelID); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	completed = true
+	if err := os.RemoveAll(filepath.Join(uploadChunksDir(), uploadID)); err != nil {
+		log.Printf("⚠️  Failed to remove chunks of upload %s: %v", uploadID, err)
+	}
+	log.Printf("✅ Upload %s completed into model %d (%s)", uploadID, modelID, name)
+	if email != "" {
+		go CheckQuotaWarnings(context.Background(), email)
+	}
+	go inspectUploadedDataset(modelID, serverModelDir)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"model_id": modelID,
+		"sha256":   sum,
+	})
+}
+
+// DeleteModelUploadHandler aborts an upload and discards its chunks
+func DeleteModelUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, userID, ok := getOwnModelUpload(w, r)
+	if !ok {
+		return
+	}
+	uploadID := getStringField(upload, "id", "")
+	if getStringField(upload, "status", "") == repository.ModelUploadCompleting {
+		apierrors.Respond(w, http.StatusConflict, "Upload is being completed")
+		return
+	}
+	if _, err := repository.DeleteModelUpload(r.Context(), uploadID, userID); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to delete upload")
+		return
+	}
+	if err := os.RemoveAll(filepath.Join(uploadChunksDir(), uploadID)); err != nil {
+		log.Printf("⚠️  Failed to remove chunks of upload %s: %v", uploadID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// StartModelUploadCleanup deletes expired uploads and their chunks now and once an hour
+func StartModelUploadCleanup() {
+	go func() {
+		for {
+			ids, err := repository.DeleteExpiredModelUploads(context.Background())
+			if err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+			for _, id := range ids {
+				if err := os.RemoveAll(filepath.Join(uploadChunksDir(), id)); err != nil {
+					log.Printf("⚠️  Failed to remove chunks of expired upload %s: %v", id, err)
+				}
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
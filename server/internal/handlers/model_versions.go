@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// GetModelVersionsHandler lists the versions of a model the user owns or collaborates on, newest
+// first. Every completed training adds a version; the active one is the model's trained model.
+func GetModelVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, _, ok := getModelForCollaborator(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	versions, err := repository.GetModelVersions(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to get versions of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve versions")
+		return
+	}
+	if versions == nil {
+		versions = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"versions": versions,
+	})
+}
+
+// getModelVersionForOwner loads the version in the URL of one of the user's models
+func getModelVersionForOwner(w http.ResponseWriter, r *http.Request) (map[string]interface{}, int, bool) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+	return getModelVersion(w, r, getIntField(model, "id", 0))
+}
+
+// getModelVersionForCollaborator loads the version in the URL of a model the user owns or collaborates on
+func getModelVersionForCollaborator(w http.ResponseWriter, r *http.Request) (map[string]interface{}, int, bool) {
+	model, _, _, ok := getModelForCollaborator(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+	return getModelVersion(w, r, getIntField(model, "id", 0))
+}
+
+// getModelVersion loads the version in the URL of a model the user was checked to have access to
+func getModelVersion(w http.ResponseWriter, r *http.Request, modelID int) (map[string]interface{}, int, bool) {
+
+	number, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || number < 1 {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid version")
+		return nil, 0, false
+	}
+	version, err := repository.GetModelVersion(r.Context(), modelID, number)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Version not found")
+		return nil, 0, false
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get version %d of model %d: %v", number, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve version")
+		return nil, 0, false
+	}
+	return version, modelID, true
+}
+
+// DownloadModelVersionHandler downloads the trained model of a version of a model the user owns or
+// collaborates on
+func DownloadModelVersionHandler(w http.ResponseWriter, r *http.Request) {
+	version, modelID, ok := getModelVersionForCollaborator(w, r)
+	if !ok {
+		return
+	}
+	artifactPath := getStringField(version, "artifact_path", "")
+	if artifactPath == "" {
+		apierrors.Respond(w, http.StatusNotFound, "This version's trained model is not on the server")
+		return
+	}
+
+	number := getIntField(version, "version", 0)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="v%d-%s"`, number, filepath.Base(artifactPath)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	log.Printf("📥 Downloading version %d of model %d", number, modelID)
+	http.ServeFile(w, r, filepath.Join(uploadsBaseDir(), artifactPath))
+}
+
+// ActivateModelVersionHandler makes a version the active trained model of one of the user's models
+func ActivateModelVersionHandler(w http.ResponseWriter, r *http.Request) {
+	version, modelID, ok := getModelVersionForOwner(w, r)
+	if !ok {
+		return
+	}
+	activateModelVersion(w, r, modelID, getIntField(version, "version", 0))
+}
+
+// RollbackModelVersionHandler activates the newest version older than the active one
+func RollbackModelVersionHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	previous, err := repository.GetRollbackModelVersion(r.Context(), modelID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusConflict, "There is no earlier version to roll back to")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to find the version to roll model %d back to: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to roll back")
+		return
+	}
+	activateModelVersion(w, r, modelID, getIntField(previous, "version", 0))
+}
+
+func activateModelVersion(w http.ResponseWriter, r *http.Request, modelID, number int) {
+	err := repository.ActivateModelVersion(r.Context(), modelID, number)
+	if errors.Is(err, repository.ErrModelVersionNoArtifact) {
+		apierrors.Respond(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Version not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to activate version %d of model %d: %v", number, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to activate version")
+		return
+	}
+	log.Printf("✅ Activated version %d of model %d", number, modelID)
+
+	version, err := repository.GetModelVersion(r.Context(), modelID, number)
+	if err != nil {
+		log.Printf("❌ Failed to reload version %d of model %d: %v", number, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve version")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"version": version,
+	})
+}
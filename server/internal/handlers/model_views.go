@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"server/helpers"
+	"server/internal/repository"
+)
+
+// anonymousViewerCookie identifies a browser that views marketplace listings without logging in
+const anonymousViewerCookie = "anonymous_viewer_id"
+
+// anonymousViewerMaxAge keeps the cookie for a year
+const anonymousViewerMaxAge = 365 * 24 * 60 * 60
+
+// anonymousViewerID returns the anonymous viewer cookie of the request. When create is set and
+// the browser has none, a new ID is issued.
+func anonymousViewerID(w http.ResponseWriter, r *http.Request, create bool) string {
+	if cookie, err := r.Cookie(anonymousViewerCookie); err == nil && cookie.Value != "" && len(cookie.Value) <= 64 {
+		return cookie.Value
+	}
+	if !create {
+		return ""
+	}
+
+	id, err := helpers.GenerateRandomString(24)
+	if err != nil {
+		log.Printf("⚠️  Failed to generate anonymous viewer ID: %v", err)
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     anonymousViewerCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   anonymousViewerMaxAge,
+	})
+	return id
+}
+
+// mergeAnonymousViews links the marketplace views made before logging in to the user.
+// Failures are logged because they must not block the login.
+func mergeAnonymousViews(w http.ResponseWriter, r *http.Request, userID int) {
+	anonymousID := anonymousViewerID(w, r, false)
+	if anonymousID == "" {
+		return
+	}
+	if _, err := repository.MergeAnonymousViews(r.Context(), anonymousID, userID); err != nil {
+		log.Printf("⚠️  Failed to merge anonymous views into user %d: %v", userID, err)
+	}
+}
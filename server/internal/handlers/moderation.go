@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	maxRemovalReasonLength   = 2000
+	maxAppealStatementLength = 5000
+)
+
+// requireAdmin returns the ID of the authenticated user if they are a platform administrator,
+// writing the error response otherwise
+func requireAdmin(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return 0, false
+	}
+
+	isAdmin, err := repository.IsAdmin(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to check admin role of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to check permissions")
+		return 0, false
+	}
+	if !isAdmin {
+		apierrors.Respond(w, http.StatusForbidden, "Admin access required")
+		return 0, false
+	}
+	return userID, true
+}
+
+// listingIsRemoved reports whether an admin removed a listing
+func listingIsRemoved(listing map[string]interface{}) bool {
+	return getStringField(listing, "moderation_status", repository.ModerationActive) == repository.ModerationRemoved
+}
+
+// RemoveListingHandler lets an admin unlist a published model for a policy reason.
+// The publisher is notified with the reason and can appeal.
+func RemoveListingHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+	if len(req.Reason) > maxRemovalReasonLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("reason cannot be longer than %d characters", maxRemovalReasonLength))
+		return
+	}
+
+	listing, err := repository.RemoveListing(r.Context(), listingID, adminID, req.Reason)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		log.Printf("❌ Failed to remove model %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove listing")
+		return
+	}
+	log.Printf("🚫 Admin %d removed model %d: %s", adminID, listingID, req.Reason)
+
+	name := getStringField(listing, "name", "")
+	notifyUser(context.Background(), getIntField(listing, "publisher_id", 0), Notification{
+		Type:    NotificationListingRemoved,
+		Title:   fmt.Sprintf("%s was removed from the marketplace", name),
+		Message: fmt.Sprintf("Reason: %s. You can appeal this decision from the listing page.", req.Reason),
+		Link:    fmt.Sprintf("/community/%d", listingID),
+		Data: map[string]interface{}{
+			"published_model_id": listingID,
+			"reason":             req.Reason,
+		},
+	}, getStringField(listing, "publisher_email", ""), getStringField(listing, "publisher_username", ""))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":            true,
+		"published_model_id": listingID,
+		"moderation_status":  repository.ModerationRemoved,
+	})
+}
+
+// getModerationListing loads a listing for its publisher or an admin, writing the error response otherwise
+func getModerationListing(w http.ResponseWriter, r *http.Request, userID int) (map[string]interface{}, bool) {
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return nil, false
+	}
+
+	listing, err := repository.GetListingModeration(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return nil, false
+		}
+		log.Printf("❌ Failed to get moderation of model %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve listing")
+		return nil, false
+	}
+	if getIntField(listing, "publisher_id", 0) != userID {
+		if isAdmin, _ := repository.IsAdmin(r.Context(), userID); !isAdmin {
+			apierrors.Respond(w, http.StatusForbidden, "Only the publisher can see the moderation of this listing")
+			return nil, false
+		}
+	}
+	return listing, true
+}
+
+// GetListingModerationHandler returns whether a listing was removed, why, and its appeals
+func GetListingModerationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listing, ok := getModerationListing(w, r, userID)
+	if !ok {
+		return
+	}
+	listingID := getIntField(listing, "id", 0)
+
+	appeals, err := repository.GetListingAppeals(r.Context(), listingID)
+	if err != nil {
+		log.Printf("❌ Failed to get appeals of model %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve appeals")
+		return
+	}
+	if appeals == nil {
+		appeals = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":            true,
+		"published_model_id": listingID,
+		"moderation_status":  listing["moderation_status"],
+		"removal_reason":     listing["removal_reason"],
+		"removed_at":         listing["removed_at"],
+		"appeals":            appeals,
+	})
+}
+
+// CreateListingAppealHandler lets a publisher appeal the removal of their listing with a statement.
+// Only one appeal can be pending at a time.
+func CreateListingAppealHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listing, ok := getModerationListing(w, r, userID)
+	if !ok {
+		return
+	}
+	listingID := getIntField(listing, "id", 0)
+	if getIntField(listing, "publisher_id", 0) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher can appeal a removal")
+		return
+	}
+	if !listingIsRemoved(listing) {
+		apierrors.Respond(w, http.StatusConflict, "This listing was not removed")
+		return
+	}
+
+	var req struct {
+		Statement string `json:"statement"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Statement = strings.TrimSpace(req.Statement)
+	if req.Statement == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "statement is required")
+		return
+	}
+	if len(req.Statement) > maxAppealStatementLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("statement cannot be longer than %d characters", maxAppealStatementLength))
+		return
+	}
+
+	appealID, err := repository.CreateListingAppeal(r.Context(), listingID, userID, getStringField(listing, "removal_reason", ""), req.Statement)
+	if err != nil {
+		if err == repository.ErrAppealPending {
+			apierrors.Respond(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Printf("❌ Failed to create appeal of model %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create appeal")
+		return
+	}
+	log.Printf("📨 Publisher %d appealed the removal of model %d (appeal %d)", userID, listingID, appealID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"appeal_id": appealID,
+		"status":    repository.AppealPending,
+	})
+}
+
+// GetAppealsHandler lists listing appeals for admins, oldest first. Filter with status
+// (pending by default, "all" for every appeal).
+func GetAppealsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = repository.AppealPending
+	case "all":
+		status = ""
+	case repository.AppealPending, repository.AppealUpheld, repository.AppealReinstated:
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, "status must be pending, upheld, reinstated or all")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	appeals, total, err := repository.GetAppealsByStatus(r.Context(), status, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get appeals: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve appeals")
+		return
+	}
+	if appeals == nil {
+		appeals = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"appeals":   appeals,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// ResolveAppealHandler lets an admin uphold a removal or reinstate the listing.
+// The publisher is notified of the decision.
+func ResolveAppealHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	appealID, err := strconv.Atoi(chi.URLParam(r, "appealId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid appeal ID")
+		return
+	}
+
+	var req struct {
+		Decision string `json:"decision"`
+		Response string `json:"response"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Decision != repository.AppealUpheld && req.Decision != repository.AppealReinstated {
+		apierrors.Respond(w, http.StatusBadRequest, "decision must be upheld or reinstated")
+		return
+	}
+	req.Response = strings.TrimSpace(req.Response)
+	if len(req.Response) > maxAppealStatementLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("response cannot be longer than %d characters", maxAppealStatementLength))
+		return
+	}
+
+	appeal, err := repository.ResolveListingAppeal(r.Context(), appealID, adminID, req.Decision, req.Response)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "No pending appeal with this ID")
+			return
+		}
+		log.Printf("❌ Failed to resolve appeal %d: %v", appealID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to resolve appeal")
+		return
+	}
+	log.Printf("⚖️  Admin %d resolved appeal %d: %s", adminID, appealID, req.Decision)
+
+	listingID := getIntField(appeal, "published_model_id", 0)
+	name := getStringField(appeal, "listing_name", "")
+	title := fmt.Sprintf("Your appeal for %s was rejected", name)
+	message := "The listing stays removed."
+	if req.Decision == repository.AppealReinstated {
+		title = fmt.Sprintf("%s was reinstated", name)
+		message = "Your appeal was accepted and the listing is back on the marketplace."
+	}
+	if req.Response != "" {
+		message += " " + req.Response
+	}
+	notifyUser(context.Background(), getIntField(appeal, "publisher_id", 0), Notification{
+		Type:    NotificationAppealResolved,
+		Title:   title,
+		Message: message,
+		Link:    fmt.Sprintf("/community/%d", listingID),
+		Data: map[string]interface{}{
+			"published_model_id": listingID,
+			"appeal_id":          appealID,
+			"decision":           req.Decision,
+		},
+	}, getStringField(appeal, "publisher_email", ""), getStringField(appeal, "publisher_username", ""))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"appeal_id": appealID,
+		"status":    req.Decision,
+	})
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// networkPolicyFromRow converts the training network columns of an organization into its policy
+func networkPolicyFromRow(row map[string]interface{}) aiAgent.NetworkPolicy {
+	policy := aiAgent.NetworkPolicy{
+		Mode:   getStringField(row, "training_network_mode", ""),
+		Source: fmt.Sprintf("organization:%d", getIntField(row, "id", 0)),
+	}
+	if hosts, ok := row["training_allowed_hosts"].([]interface{}); ok {
+		for _, host := range hosts {
+			if h, ok := host.(string); ok {
+				policy.AllowedHosts = append(policy.AllowedHosts, h)
+			}
+		}
+	}
+	return policy
+}
+
+// trainingNetworkPolicy returns the network policy of the user's server trainings: the deployment's
+// policy, made stricter by the policies of the user's organizations
+func trainingNetworkPolicy(ctx context.Context, userID int) (aiAgent.NetworkPolicy, error) {
+	policy := aiAgent.DeploymentNetworkPolicy()
+	rows, err := repository.GetUserNetworkPolicies(ctx, userID)
+	if err != nil {
+		return policy, err
+	}
+	for _, row := range rows {
+		policy = policy.Stricter(networkPolicyFromRow(row))
+	}
+	return policy, nil
+}
+
+// GetOrganizationNetworkPolicyHandler returns the training network policy of an organization and
+// the deployment's policy it tightens
+func GetOrganizationNetworkPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, _, _, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	row, err := repository.GetOrganizationNetworkPolicy(r.Context(), orgID)
+	if err != nil {
+		log.Printf("❌ Failed to get the network policy of organization %d: %v", orgID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve network policy")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":           true,
+		"network_policy":    networkPolicyFromRow(row),
+		"deployment_policy": aiAgent.DeploymentNetworkPolicy(),
+	})
+}
+
+// UpdateOrganizationNetworkPolicyHandler sets the network policy of the members' server trainings.
+// {"mode": "none" | "allowlist" | "open" | "", "allowed_hosts": [...]}; the stricter of it and the
+// deployment's policy applies, and an empty mode restores the deployment's.
+func UpdateOrganizationNetworkPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, role, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if role != repository.OrgRoleOwner && role != repository.OrgRoleAdmin {
+		apierrors.Respond(w, http.StatusForbidden, "Only organization owners and admins can change the network policy")
+		return
+	}
+
+	var req struct {
+		Mode         string   `json:"mode"`
+		AllowedHosts []string `json:"allowed_hosts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Mode != "" && !aiAgent.ValidNetworkMode(req.Mode) {
+		apierrors.Respond(w, http.StatusBadRequest, "mode must be 'open', 'none' or 'allowlist'")
+		return
+	}
+	hosts, err := aiAgent.NormalizeAllowedHosts(req.AllowedHosts)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Mode == aiAgent.NetworkModeAllowlist && len(hosts) == 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "allowed_hosts is required in allowlist mode")
+		return
+	}
+
+	if err := repository.SetOrganizationNetworkPolicy(r.Context(), orgID, req.Mode, hosts); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update network policy")
+		return
+	}
+	log.Printf("🔒 User %d set the training network policy of organization %d to %q %v", userID, orgID, req.Mode, hosts)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"network_policy": aiAgent.NetworkPolicy{
+			Mode:         req.Mode,
+			AllowedHosts: hosts,
+			Source:       fmt.Sprintf("organization:%d", orgID),
+		},
+	})
+}
+
+// GetTrainingNetworkHandler returns the network policy a training ran with and its egress attempts.
+// Running trainings report the attempts seen so far.
+func GetTrainingNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	trainingID := r.URL.Query().Get("id")
+	if trainingID == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	run, err := repository.GetTrainingRunNetwork(r.Context(), trainingID, userID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Training not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get the network of training %s: %v", trainingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve training")
+		return
+	}
+
+	if globalTrainer != nil {
+		if progress, err := globalTrainer.GetProgress(trainingID); err == nil && run["egress_attempts"] == nil {
+			if attempts := progress.EgressLog(); attempts != nil {
+				run["egress_attempts"] = attempts
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"network": run,
+	})
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"server/internal/apierrors"
+	"server/internal/email"
+	"server/internal/middlewares"
+	"server/internal/repository"
+	"server/internal/ws"
+)
+
+// Notification types
+const (
+	NotificationBookmarkPriceDrop        = "bookmark_price_drop"
+	NotificationBookmarkNewVersion       = "bookmark_new_version"
+	NotificationTrainingAnomaly          = "training_anomaly"
+	NotificationListingRemoved           = "listing_removed"
+	NotificationAppealResolved           = "listing_appeal_resolved"
+	NotificationSavedSearchMatch         = "saved_search_match"
+	NotificationListingDuplicate         = "listing_duplicate_confirmed"
+	NotificationRentalExpiring           = "rental_expiring"
+	NotificationListingDeprecated        = "listing_deprecated"
+	NotificationListingEndOfLife         = "listing_end_of_life"
+	NotificationDataExportReady          = "data_export_ready"
+	NotificationDataExportFailed         = "data_export_failed"
+	NotificationAgentOffline             = "agent_offline"
+	NotificationCollaboratorInvite       = "model_collaborator_invitation"
+	NotificationFollowedPublisherRelease = "followed_publisher_release"
+)
+
+// Notification is an event shown to a user in-app, pushed over their WebSocket and optionally emailed
+type Notification struct {
+	Type    string
+	Title   string
+	Message string
+	Link    string // Frontend path the notification points to
+	Data    map[string]interface{}
+}
+
+// notifyUser stores a notification, pushes it to the user's open WebSockets and,
+// when emailTo is set, emails it too. Failures are logged and never returned.
+func notifyUser(ctx context.Context, userID int, n Notification, emailTo, username string) {
+	emailed := false
+	if emailTo != "" {
+		if err := email.NewEmailService().SendNotificationEmail(emailTo, username, n.Title, n.Message, n.Link); err == nil {
+			emailed = true
+		}
+	}
+
+	data := n.Data
+	if n.Link != "" {
+		data = make(map[string]interface{}, len(n.Data)+1)
+		for key, val := range n.Data {
+			data[key] = val
+		}
+		data["link"] = n.Link
+	}
+
+	id, err := repository.CreateNotification(ctx, userID, n.Type, n.Title, n.Message, data, emailed)
+	if err != nil {
+		log.Printf("⚠️  Failed to store notification for user %d: %v", userID, err)
+	}
+
+	ws.BroadcastToUser(userID, map[string]interface{}{
+		"type": "notification",
+		"data": map[string]interface{}{
+			"id":      id,
+			"type":    n.Type,
+			"title":   n.Title,
+			"message": n.Message,
+			"data":    data,
+		},
+	})
+}
+
+// GetNotificationsHandler lists the user's notifications, newest first (unread=true for unread only)
+func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	notifications, err := repository.GetNotifications(r.Context(), userID, unreadOnly, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get notifications for user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve notifications")
+		return
+	}
+	if notifications == nil {
+		notifications = []map[string]interface{}{}
+	}
+	unread, err := repository.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"notifications": notifications,
+		"unread_count":  unread,
+		"page":          page,
+		"page_size":     pageSize,
+	})
+}
+
+// MarkNotificationsReadHandler marks notifications as read; without ids every notification is marked
+func MarkNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	updated, err := repository.MarkNotificationsRead(r.Context(), userID, req.IDs)
+	if err != nil {
+		log.Printf("❌ Failed to mark notifications read for user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update notifications")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"updated": updated,
+	})
+}
+
+// Pagination defaults for list endpoints
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination reads the 1-based page and page_size query parameters
+func parsePagination(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return page, pageSize
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,8 +13,10 @@ import (
 	"time"
 
 	"server/helpers"
+	"server/internal/apierrors"
 	"server/internal/repository"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/joho/godotenv"
 )
 
@@ -48,19 +51,26 @@ func init() {
 	AppleRedirectURI = os.Getenv("APPLE_REDIRECT_URI")
 
 	log.Printf("🔧 OAuth Config Loaded - GitHub Client ID: %s (length: %d)", GithubClientID, len(GithubClientID))
-	log.Printf("🔧 OAuth Config Loaded - Google Client ID: %s (length: %d)", GoogleClientID[:10]+"...", len(GoogleClientID))
+	googleClientIDPrefix := GoogleClientID
+	if len(googleClientIDPrefix) > 10 {
+		googleClientIDPrefix = googleClientIDPrefix[:10] + "..."
+	}
+	log.Printf("🔧 OAuth Config Loaded - Google Client ID: %s (length: %d)", googleClientIDPrefix, len(GoogleClientID))
+}
+
+// OAuthCodeRequest is the body of the Google and GitHub OAuth callbacks
+type OAuthCodeRequest struct {
+	Code        string `json:"code"`
+	RedirectURI string `json:"redirect_uri,omitempty"` // Optional, falls back to env var; GitHub requires it to match
 }
 
 // GoogleOAuthHandler handles Google OAuth callback
 func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the authorization code from request (Auth.js style)
-	var req struct {
-		Code        string `json:"code"`
-		RedirectURI string `json:"redirect_uri,omitempty"` // Optional, falls back to env var
-	}
+	var req OAuthCodeRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
@@ -85,7 +95,7 @@ func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("❌ Error exchanging code for token: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to exchange code: %v", err), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to exchange code: %v", err))
 		return
 	}
 	defer tokenResp.Body.Close()
@@ -94,7 +104,7 @@ func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
 	if tokenResp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(tokenResp.Body)
 		log.Printf("❌ Google token exchange failed with status %d: %s", tokenResp.StatusCode, string(bodyBytes))
-		http.Error(w, fmt.Sprintf("Token exchange failed: %s", string(bodyBytes)), http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("Token exchange failed: %s", string(bodyBytes)))
 		return
 	}
 
@@ -107,20 +117,20 @@ func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenData); err != nil {
 		log.Printf("❌ Error decoding token response: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to decode token: %v", err), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to decode token: %v", err))
 		return
 	}
 
 	// Check for OAuth errors in response
 	if tokenData.Error != "" {
 		log.Printf("❌ Google OAuth error: %s - %s", tokenData.Error, tokenData.ErrorDesc)
-		http.Error(w, fmt.Sprintf("OAuth error: %s", tokenData.ErrorDesc), http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("OAuth error: %s", tokenData.ErrorDesc))
 		return
 	}
 
 	if tokenData.AccessToken == "" {
 		log.Printf("❌ No access token received from Google")
-		http.Error(w, "No access token received", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "No access token received")
 		return
 	}
 
@@ -128,7 +138,7 @@ func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
 	userResp, err := http.Get(fmt.Sprintf("https://www.googleapis.com/oauth2/v2/userinfo?access_token=%s", tokenData.AccessToken))
 	if err != nil {
 		log.Printf("Error getting user info: %v", err)
-		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user info")
 		return
 	}
 	defer userResp.Body.Close()
@@ -142,14 +152,14 @@ func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewDecoder(userResp.Body).Decode(&userInfo); err != nil {
 		log.Printf("Error decoding user info: %v", err)
-		http.Error(w, "Failed to decode user info", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to decode user info")
 		return
 	}
 
 	// Check if user exists
 	user, err := repository.GetUserByEmail(r.Context(), userInfo.Email)
 	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 
@@ -164,13 +174,13 @@ func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
 		// Generate a random password (user won't use it for OAuth login)
 		randomPassword, err := helpers.GenerateRandomString(32)
 		if err != nil {
-			http.Error(w, "Failed to generate password", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to generate password")
 			return
 		}
 
 		userID, err = repository.InsertUser(r.Context(), userInfo.Email, randomPassword, username)
 		if err != nil {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to create user")
 			return
 		}
 	} else {
@@ -183,50 +193,37 @@ func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
 		case int64:
 			userID = int(v)
 		default:
-			http.Error(w, "Invalid user data", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Invalid user data")
 			return
 		}
 	}
 
-	// Generate JWT token
-	token, err := helpers.GenerateJWT(userInfo.Email, userID)
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+	if !allowSignIn(w, r, userID) {
 		return
 	}
 
-	// Generate refresh token
-	refreshToken, err := helpers.GenerateRandomString(64)
+	// Start the session
+	token, refreshToken, err := startSession(r, userID, userInfo.Email)
 	if err != nil {
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		log.Printf("❌ Failed to start session of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save session")
 		return
 	}
 
-	// Save session
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
-	_, err = repository.InsertSession(r.Context(), userID, userInfo.Email, refreshToken, expiresAt)
-	if err != nil {
-		http.Error(w, "Failed to save session", http.StatusInternalServerError)
-		return
-	}
+	recordAuditAs(r, userID, userInfo.Email, AuditLogin, AuditTargetUser, fmt.Sprint(userID), map[string]interface{}{"method": "google"})
+	mergeAnonymousViews(w, r, userID)
 
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token":         token,
-		"refresh_token": refreshToken,
-	})
+	json.NewEncoder(w).Encode(loginResponse(r.Context(), userID, token, refreshToken))
 }
 
 // GitHubOAuthHandler handles GitHub OAuth callback
 func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Code        string `json:"code"`
-		RedirectURI string `json:"redirect_uri,omitempty"` // Optional, but GitHub requires it to match
-	}
+	var req OAuthCodeRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
@@ -256,7 +253,7 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	tokenReq, err := http.NewRequest("POST", "https://github.com/login/oauth/access_token", strings.NewReader(formData.Encode()))
 	if err != nil {
-		http.Error(w, "Failed to create request", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create request")
 		return
 	}
 
@@ -267,7 +264,7 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 	tokenResp, err := client.Do(tokenReq)
 	if err != nil {
 		log.Printf("❌ Error exchanging code for token: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to exchange code: %v", err), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to exchange code: %v", err))
 		return
 	}
 	defer tokenResp.Body.Close()
@@ -276,7 +273,7 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 	if tokenResp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(tokenResp.Body)
 		log.Printf("❌ GitHub token exchange failed with status %d: %s", tokenResp.StatusCode, string(bodyBytes))
-		http.Error(w, fmt.Sprintf("Token exchange failed: %s", string(bodyBytes)), http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("Token exchange failed: %s", string(bodyBytes)))
 		return
 	}
 
@@ -290,27 +287,27 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenData); err != nil {
 		log.Printf("❌ Error decoding token response: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to decode token: %v", err), http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, fmt.Sprintf("Failed to decode token: %v", err))
 		return
 	}
 
 	// Check for OAuth errors in response
 	if tokenData.Error != "" {
 		log.Printf("❌ GitHub OAuth error: %s - %s", tokenData.Error, tokenData.ErrorDesc)
-		http.Error(w, fmt.Sprintf("OAuth error: %s", tokenData.ErrorDesc), http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("OAuth error: %s", tokenData.ErrorDesc))
 		return
 	}
 
 	if tokenData.AccessToken == "" {
 		log.Printf("❌ No access token received from GitHub")
-		http.Error(w, "No access token received", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "No access token received")
 		return
 	}
 
 	// Get user info from GitHub
 	userReq, err := http.NewRequest("GET", "https://api.github.com/user", nil)
 	if err != nil {
-		http.Error(w, "Failed to create user request", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create user request")
 		return
 	}
 	userReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tokenData.AccessToken))
@@ -318,7 +315,7 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 	userResp, err := client.Do(userReq)
 	if err != nil {
 		log.Printf("Error getting user info: %v", err)
-		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user info")
 		return
 	}
 	defer userResp.Body.Close()
@@ -331,7 +328,7 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewDecoder(userResp.Body).Decode(&userInfo); err != nil {
 		log.Printf("Error decoding user info: %v", err)
-		http.Error(w, "Failed to decode user info", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to decode user info")
 		return
 	}
 
@@ -361,14 +358,14 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if userInfo.Email == "" {
-		http.Error(w, "Email not available from GitHub", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Email not available from GitHub")
 		return
 	}
 
 	// Check if user exists
 	user, err := repository.GetUserByEmail(r.Context(), userInfo.Email)
 	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 
@@ -382,13 +379,13 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 		randomPassword, err := helpers.GenerateRandomString(32)
 		if err != nil {
-			http.Error(w, "Failed to generate password", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to generate password")
 			return
 		}
 
 		userID, err = repository.InsertUser(r.Context(), userInfo.Email, randomPassword, username)
 		if err != nil {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to create user")
 			return
 		}
 	} else {
@@ -400,95 +397,189 @@ func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
 		case int64:
 			userID = int(v)
 		default:
-			http.Error(w, "Invalid user data", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Invalid user data")
 			return
 		}
 	}
 
-	// Generate tokens
-	token, err := helpers.GenerateJWT(userInfo.Email, userID)
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+	if !allowSignIn(w, r, userID) {
 		return
 	}
 
-	refreshToken, err := helpers.GenerateRandomString(64)
+	// Start the session
+	token, refreshToken, err := startSession(r, userID, userInfo.Email)
 	if err != nil {
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		log.Printf("❌ Failed to start session of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save session")
 		return
 	}
 
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
-	_, err = repository.InsertSession(r.Context(), userID, userInfo.Email, refreshToken, expiresAt)
-	if err != nil {
-		http.Error(w, "Failed to save session", http.StatusInternalServerError)
-		return
-	}
+	recordAuditAs(r, userID, userInfo.Email, AuditLogin, AuditTargetUser, fmt.Sprint(userID), map[string]interface{}{"method": "github"})
+	mergeAnonymousViews(w, r, userID)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token":         token,
-		"refresh_token": refreshToken,
-	})
+	json.NewEncoder(w).Encode(loginResponse(r.Context(), userID, token, refreshToken))
+}
+
+// AppleSignInRequest is the body of the Apple Sign In callback, with the code or the id_token
+type AppleSignInRequest struct {
+	Code        string `json:"code"`
+	IDToken     string `json:"id_token"`
+	User        string `json:"user"`                   // Apple sends user info on first sign-in only
+	Nonce       string `json:"nonce,omitempty"`        // Checked against the token when the client sent one to Apple
+	RedirectURI string `json:"redirect_uri,omitempty"` // Optional, falls back to env var
 }
 
-// AppleOAuthHandler handles Apple Sign In callback
+// AppleOAuthHandler handles Apple Sign In callback. The client sends the authorization code, which
+// is exchanged for an identity token, or the identity token itself. The token is verified against
+// Apple's keys before the user is signed in, linked by Apple ID or by verified email, or created.
 func AppleOAuthHandler(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Code     string `json:"code"`
-		IDToken  string `json:"id_token"`
-		User     string `json:"user"` // Apple sends user info on first sign-in only
-	}
+	var req AppleSignInRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	// For Apple Sign In, we typically decode the ID token
-	// This is a simplified version - in production, you'd want to verify the JWT signature
-	// For now, we'll exchange the code for tokens
+	idToken := req.IDToken
+	if req.Code != "" {
+		redirectURI := req.RedirectURI
+		if redirectURI == "" {
+			redirectURI = AppleRedirectURI
+		}
+
+		formData := url.Values{}
+		formData.Set("client_id", AppleClientID)
+		formData.Set("client_secret", AppleClientSecret)
+		formData.Set("code", req.Code)
+		formData.Set("grant_type", "authorization_code")
+		formData.Set("redirect_uri", redirectURI)
 
-	tokenReq, err := http.NewRequest("POST", "https://appleid.apple.com/auth/token", strings.NewReader(fmt.Sprintf(
-		"client_id=%s&client_secret=%s&code=%s&grant_type=authorization_code&redirect_uri=%s",
-		AppleClientID, AppleClientSecret, req.Code, AppleRedirectURI,
-	)))
-	if err != nil {
-		http.Error(w, "Failed to create request", http.StatusInternalServerError)
+		tokenReq, err := http.NewRequestWithContext(r.Context(), "POST", "https://appleid.apple.com/auth/token", strings.NewReader(formData.Encode()))
+		if err != nil {
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to create request")
+			return
+		}
+		tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		client := &http.Client{Timeout: 15 * time.Second}
+		tokenResp, err := client.Do(tokenReq)
+		if err != nil {
+			log.Printf("❌ Error exchanging Apple code for token: %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to exchange code")
+			return
+		}
+		defer tokenResp.Body.Close()
+
+		var tokenData struct {
+			IDToken   string `json:"id_token"`
+			Error     string `json:"error"`
+			ErrorDesc string `json:"error_description"`
+		}
+		if err := json.NewDecoder(tokenResp.Body).Decode(&tokenData); err != nil {
+			log.Printf("❌ Error decoding Apple token response: %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to decode token")
+			return
+		}
+		if tokenResp.StatusCode != http.StatusOK || tokenData.Error != "" {
+			log.Printf("❌ Apple token exchange failed with status %d: %s %s", tokenResp.StatusCode, tokenData.Error, tokenData.ErrorDesc)
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("Token exchange failed: %s", tokenData.Error))
+			return
+		}
+		if tokenData.IDToken != "" {
+			idToken = tokenData.IDToken
+		}
+	}
+	if idToken == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "code or id_token is required")
 		return
 	}
 
-	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	tokenResp, err := client.Do(tokenReq)
+	claims, err := helpers.VerifyAppleIDToken(r.Context(), idToken, AppleClientID, req.Nonce)
 	if err != nil {
-		log.Printf("Error exchanging code for token: %v", err)
-		http.Error(w, "Failed to exchange code", http.StatusInternalServerError)
+		log.Printf("❌ Apple identity token rejected: %v", err)
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid Apple identity token")
 		return
 	}
-	defer tokenResp.Body.Close()
 
-	bodyBytes, _ := io.ReadAll(tokenResp.Body)
-	log.Printf("Apple token response: %s", string(bodyBytes))
+	// Users who signed in with Apple before are found by their Apple ID, whatever their email now
+	var userID int
+	var email string
+	linked, err := repository.GetUserByAppleSub(r.Context(), claims.Subject)
+	switch {
+	case err == nil:
+		userID = getIntField(linked, "id", 0)
+		email = getStringField(linked, "email", "")
+	case err != pgx.ErrNoRows:
+		log.Printf("❌ Failed to find Apple user: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
+		return
+	default:
+		if !claims.HasVerifiedEmail() {
+			apierrors.Respond(w, http.StatusBadRequest, "Apple did not share a verified email")
+			return
+		}
+		email = claims.Email
+
+		user, err := repository.GetUserByEmail(r.Context(), email)
+		if err != nil {
+			apierrors.Respond(w, http.StatusInternalServerError, "DB error")
+			return
+		}
+		if user != nil {
+			userID = getIntField(*user, "id", 0)
+		} else {
+			// Create new user, named after the name Apple sent on the first sign-in
+			var appleUser struct {
+				Name struct {
+					FirstName string `json:"firstName"`
+				} `json:"name"`
+			}
+			_ = json.Unmarshal([]byte(req.User), &appleUser)
+			username := strings.ToLower(strings.ReplaceAll(email, "@", "_"))
+			if appleUser.Name.FirstName != "" {
+				username = strings.ToLower(appleUser.Name.FirstName)
+			}
+
+			randomPassword, err := helpers.GenerateRandomString(32)
+			if err != nil {
+				apierrors.Respond(w, http.StatusInternalServerError, "Failed to generate password")
+				return
+			}
 
-	// Parse the ID token to get user email
-	// In production, use a JWT library to properly verify and decode
-	// For this example, we'll use the id_token from the request
+			userID, err = repository.InsertUser(r.Context(), email, randomPassword, username)
+			if err != nil {
+				apierrors.Respond(w, http.StatusInternalServerError, "Failed to create user")
+				return
+			}
+		}
 
-	var tokenData struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		IDToken      string `json:"id_token"`
+		if err := repository.LinkAppleAccount(r.Context(), userID, claims.Subject); err != nil {
+			if errors.Is(err, repository.ErrAppleAccountLinked) {
+				apierrors.Respond(w, http.StatusConflict, err.Error())
+				return
+			}
+			log.Printf("❌ Failed to link Apple account of user %d: %v", userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to link Apple account")
+			return
+		}
+	}
+
+	if !allowSignIn(w, r, userID) {
+		return
 	}
 
-	if err := json.Unmarshal(bodyBytes, &tokenData); err != nil {
-		log.Printf("Error decoding token response: %v", err)
-		http.Error(w, "Failed to decode token", http.StatusInternalServerError)
+	// Start the session
+	token, refreshToken, err := startSession(r, userID, email)
+	if err != nil {
+		log.Printf("❌ Failed to start session of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save session")
 		return
 	}
 
-	// Decode ID token (simplified - in production use proper JWT validation)
-	// For now, return an error message that Apple OAuth requires additional setup
-	http.Error(w, "Apple OAuth requires additional JWT validation setup", http.StatusNotImplemented)
+	recordAuditAs(r, userID, email, AuditLogin, AuditTargetUser, fmt.Sprint(userID), map[string]interface{}{"method": "apple"})
+	mergeAnonymousViews(w, r, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loginResponse(r.Context(), userID, token, refreshToken))
 }
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+
+	"server/aiAgent"
+)
+
+// Formats a published model can be downloaded in
+const (
+	DownloadFormatOriginal = "original"
+	DownloadFormatONNX     = "onnx"
+)
+
+// listingONNXExport returns the path of the ONNX export of the trained model of a listing,
+// relative to the uploads directory. Pipeline templates have none.
+func listingONNXExport(model map[string]interface{}) (string, bool) {
+	if listingType, _ := model["listing_type"].(string); listingType == ListingTypePipelineTemplate {
+		return "", false
+	}
+	trainedModelPath, _ := model["trained_model_path"].(string)
+	absPath, err := resolveUploadsPath(trainedModelPath)
+	if err != nil {
+		return "", false
+	}
+	if _, ok := aiAgent.CurrentONNXExport(absPath); !ok {
+		return "", false
+	}
+	return aiAgent.ONNXPath(trainedModelPath), true
+}
+
+// listingDownloadFormats returns the formats a listing can be downloaded in
+func listingDownloadFormats(model map[string]interface{}) []string {
+	formats := []string{DownloadFormatOriginal}
+	if _, ok := listingONNXExport(model); ok {
+		formats = append(formats, DownloadFormatONNX)
+	}
+	return formats
+}
+
+// saveRemoteONNXExport stores the outcome of the ONNX export an agent ran after a training
+func saveRemoteONNXExport(trainingID string, raw interface{}) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		log.Printf("⚠️  Invalid ONNX export for training %s: %v", trainingID, err)
+		return
+	}
+	var export aiAgent.ONNXExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		log.Printf("⚠️  Invalid ONNX export for training %s: %v", trainingID, err)
+		return
+	}
+	switch export.Status {
+	case aiAgent.ONNXExported, aiAgent.ONNXSkipped, aiAgent.ONNXFailed:
+	default:
+		log.Printf("⚠️  Invalid ONNX export status %q for training %s", export.Status, trainingID)
+		return
+	}
+
+	if globalTrainer != nil {
+		if progress, err := globalTrainer.GetProgress(trainingID); err == nil {
+			progress.SetONNXExport(&export)
+		}
+	}
+}
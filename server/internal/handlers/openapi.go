@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/openapi"
+)
+
+// apiOperations documents the routes clients use most. Routes missing here are still listed in
+// the OpenAPI document, with a summary taken from their handler's name.
+var apiOperations = map[string]openapi.Operation{
+	// Authentication
+	"POST /v1/register": {Summary: "Create an account", Request: RegisterRequest{},
+		Description: "Sends a verification email; the account can sign in once the email is verified."},
+	"POST /v1/login": {Summary: "Sign in with email and password", Request: LoginRequest{},
+		Description: "Returns an access token and a refresh token, also set as the refresh_token cookie."},
+	"POST /v1/auth/refresh": {Summary: "Exchange a refresh token for a new access token",
+		Description: "Refresh tokens are single use: the response carries a new one. The token is read from the refresh_token cookie or the refresh_token field of the body."},
+	"POST /v1/auth/logout":                 {Summary: "Sign out of the session of a refresh token"},
+	"POST /v1/auth/google":                 {Summary: "Sign in with Google", Request: OAuthCodeRequest{}},
+	"POST /v1/auth/github":                 {Summary: "Sign in with GitHub", Request: OAuthCodeRequest{}},
+	"POST /v1/auth/apple":                  {Summary: "Sign in with Apple", Request: AppleSignInRequest{}},
+	"GET /v1/auth/sessions":                {Summary: "List the active sessions of the user"},
+	"DELETE /v1/auth/sessions":             {Summary: "Log out everywhere", Description: "Add ?keep_current=true to stay signed in on the current device."},
+	"DELETE /v1/auth/sessions/{sessionId}": {Summary: "Sign out of a session"},
+	"GET /v1/me":                           {Summary: "Get the signed-in user"},
+
+	// Models
+	"POST /v1/insert":         {Summary: "Upload a model folder as a zip", Multipart: true},
+	"GET /v1/getModels":       {Summary: "List the user's models"},
+	"POST /v1/models/uploads": {Summary: "Start a chunked model upload"},
+	"PUT /v1/models/uploads/{uploadId}/chunks/{index}": {Summary: "Upload a chunk of a model upload",
+		Description: "The body is the raw chunk; X-Chunk-SHA256 optionally checks it."},
+	"POST /v1/models/uploads/{uploadId}/complete": {Summary: "Assemble and import a chunked model upload"},
+
+	// Training
+	"POST /v1/train/start": {Summary: "Start a training", Request: aiAgent.TrainingRequest{},
+		Description: "Runs on one of the user's agents or on the server depending on placement."},
+
+	// Community
+	"POST /v1/publish":                         {Summary: "Publish a model to the marketplace", Request: PublishModelRequest{}},
+	"POST /v1/published-models/{id}/unpublish": {Summary: "Unpublish a marketplace listing"},
+	"GET /v1/published-models":                 {Summary: "List marketplace listings"},
+	"POST /v1/published-models/payment-intent": {Summary: "Pay for a model or bundle", Request: ModelPaymentRequest{}},
+
+	// Subscription
+	"GET /v1/subscription":           {Summary: "Get the user's subscription"},
+	"POST /v1/subscription/checkout": {Summary: "Create a Stripe checkout session for a plan", Request: CheckoutRequest{}},
+	"GET /v1/pricing":                {Summary: "List the subscription plans", Tags: []string{"subscription"}},
+	"POST /v1/webhook/stripe":        {Summary: "Receive Stripe events", Description: "Signed by Stripe with STRIPE_WEBHOOK_SECRET.", Tags: []string{"subscription"}},
+
+	// Agents, CI and monitoring, which authenticate with API keys or project tokens
+	"GET /v1/ws":                                   {Summary: "Receive live updates over a WebSocket", Tags: []string{"websocket"}},
+	"GET /v1/ws/training":                          {Summary: "Follow trainings over a WebSocket", Tags: []string{"websocket"}},
+	"GET /v1/ws/agent":                             {Summary: "Connect a training agent over a WebSocket", Tags: []string{"websocket"}, Scheme: openapi.SchemeAPIKey},
+	"POST /v1/agent/upload-model":                  {Summary: "Upload a model trained by an agent", Multipart: true, Scheme: openapi.SchemeAPIKey},
+	"GET /v1/agent/sync/{trainingId}/manifest":     {Summary: "List the files of a training's model folder", Scheme: openapi.SchemeAPIKey},
+	"GET /v1/agent/sync/{trainingId}/files/{path}": {Summary: "Download a file of a training's model folder", Scheme: openapi.SchemeAPIKey},
+	"GET /v1/ci/config":                            {Summary: "Get the CI configuration of a model", Scheme: openapi.SchemeProjectToken},
+	"POST /v1/ci/dispatch":                         {Summary: "Start a retraining from CI", Description: "Signed with the secret of the model's CI integration."},
+	"GET /v1/train/metrics":                        {Summary: "Prometheus metrics of the caller's trainings", Scheme: openapi.SchemeAPIKey},
+	"GET /v1/grafana":                              {Summary: "Test the Grafana datasource", Scheme: openapi.SchemeAPIKey},
+	"POST /v1/grafana/search":                      {Summary: "List the Grafana metrics", Scheme: openapi.SchemeAPIKey},
+	"POST /v1/grafana/query":                       {Summary: "Query training metrics for Grafana", Scheme: openapi.SchemeAPIKey},
+	"POST /v1/grafana/annotations":                 {Summary: "Training events as Grafana annotations", Scheme: openapi.SchemeAPIKey},
+
+	// This description
+	"GET /api/openapi.json": {Summary: "Get the OpenAPI document of the API", Tags: []string{"docs"}},
+	"GET /api/docs":         {Summary: "Browse the API with Swagger UI", Tags: []string{"docs"}},
+}
+
+// apiTags groups routes by path, the first matching prefix wins
+var apiTags = []openapi.TagPrefix{
+	{Prefix: "/v1/admin", Tag: "admin"},
+	{Prefix: "/v1/auth", Tag: "auth"},
+	{Prefix: "/v1/login", Tag: "auth"},
+	{Prefix: "/v1/register", Tag: "auth"},
+	{Prefix: "/v1/verify-email", Tag: "auth"},
+	{Prefix: "/v1/resend-verification", Tag: "auth"},
+	{Prefix: "/v1/password", Tag: "auth"},
+	{Prefix: "/v1/me", Tag: "users"},
+	{Prefix: "/v1/models", Tag: "models"},
+	{Prefix: "/v1/insert", Tag: "models"},
+	{Prefix: "/v1/getModels", Tag: "models"},
+	{Prefix: "/v1/downloadModel", Tag: "models"},
+	{Prefix: "/v1/train", Tag: "training"},
+	{Prefix: "/v1/community", Tag: "community"},
+	{Prefix: "/v1/published-models", Tag: "community"},
+	{Prefix: "/v1/publish", Tag: "community"},
+	{Prefix: "/v1/subscription", Tag: "subscription"},
+	{Prefix: "/v1/coupons", Tag: "subscription"},
+	{Prefix: "/v1/pricing", Tag: "subscription"},
+}
+
+// apiMiddlewares tells which middlewares authenticate requests
+var apiMiddlewares = []openapi.Middleware{
+	{Func: middlewares.JWTGuard, Scheme: openapi.SchemeJWT},
+	{Func: middlewares.OptionalJWT, Scheme: openapi.SchemeJWT, Optional: true},
+	{Func: RequireAdmin, Note: "Admins only."},
+}
+
+// OpenAPISpecHandler serves the OpenAPI document of the routes, built from the router on the first
+// request
+func OpenAPISpecHandler(routes chi.Routes) http.HandlerFunc {
+	var (
+		once sync.Once
+		spec []byte
+		err  error
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			var doc map[string]interface{}
+			var stale []string
+			doc, stale, err = openapi.Build(routes, openapi.Spec{
+				Title:       "AiManage API",
+				Version:     "1.0.0",
+				Description: "Errors are returned as {\"success\": false, \"error\": {\"code\", \"message\", \"details\", \"request_id\"}}.",
+				Operations:  apiOperations,
+				Middlewares: apiMiddlewares,
+				Tags:        apiTags,
+			})
+			if err != nil {
+				return
+			}
+			if len(stale) > 0 {
+				log.Printf("⚠️  OpenAPI docs for routes that do not exist: %v", stale)
+			}
+			spec, err = json.Marshal(doc)
+		})
+		if err != nil {
+			log.Printf("❌ Failed to build the OpenAPI document: %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to build the API description")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}
+}
+
+// swaggerUIPage renders the OpenAPI document with Swagger UI, loaded from a CDN
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>AiManage API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: %q, dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+// SwaggerUIHandler serves Swagger UI for the OpenAPI document at specURL
+func SwaggerUIHandler(specURL string) http.HandlerFunc {
+	page := fmt.Sprintf(swaggerUIPage, specURL)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}
+}
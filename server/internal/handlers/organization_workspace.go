@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// ShareModelWithOrganizationHandler shares one of the user's models with an organization they
+// belong to, or stops sharing it with {"organization_id": null}. Members of the organization can
+// then view, download and train it.
+func ShareModelWithOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	model, userID, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	var req struct {
+		OrganizationID *int `json:"organization_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.OrganizationID != nil {
+		role, err := repository.GetOrganizationRole(r.Context(), *req.OrganizationID, userID)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to check organization membership")
+			return
+		}
+		if role == "" {
+			apierrors.Respond(w, http.StatusForbidden, "You are not a member of this organization")
+			return
+		}
+	}
+
+	if err := repository.SetModelOrganization(r.Context(), modelID, req.OrganizationID); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to share model")
+		return
+	}
+	if req.OrganizationID != nil {
+		log.Printf("✅ User %d shared model %d with organization %d", userID, modelID, *req.OrganizationID)
+	} else {
+		log.Printf("✅ User %d stopped sharing model %d", userID, modelID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"model_id":        modelID,
+		"organization_id": req.OrganizationID,
+	})
+}
+
+// GetOrganizationSharedModelsHandler lists the models members shared with an organization
+func GetOrganizationSharedModelsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, _, _, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	sharedModels, err := repository.GetOrganizationSharedModels(r.Context(), orgID)
+	if err != nil {
+		log.Printf("❌ Failed to get models shared with organization %d: %v", orgID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve models")
+		return
+	}
+	if sharedModels == nil {
+		sharedModels = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"models":  sharedModels,
+	})
+}
+
+// GetOrganizationCreditsHandler returns the credits in an organization's pool and a page of its transactions
+func GetOrganizationCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, _, _, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	credits, err := repository.GetOrganizationCredits(r.Context(), orgID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve credits")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	transactions, total, err := repository.GetOrganizationCreditTransactions(r.Context(), orgID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get credit transactions of organization %d: %v", orgID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve credits")
+		return
+	}
+	if transactions == nil {
+		transactions = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":           true,
+		"remaining_credits": credits,
+		"transactions":      transactions,
+		"page":              page,
+		"page_size":         pageSize,
+		"total":             total,
+	})
+}
+
+// TransferOrganizationCreditsHandler moves credits from the current member's balance to the
+// organization's pool
+func TransferOrganizationCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, _, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Credits int `json:"credits"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Credits <= 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "credits must be positive")
+		return
+	}
+
+	balance, err := repository.TransferCreditsToOrganization(r.Context(), orgID, userID, req.Credits)
+	if errors.Is(err, repository.ErrInsufficientCredits) {
+		apierrors.Respond(w, http.StatusConflict, "You don't have enough credits")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to transfer credits")
+		return
+	}
+	log.Printf("💳 User %d transferred %d credits to organization %d", userID, req.Credits, orgID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":           true,
+		"remaining_credits": balance,
+	})
+}
+
+// GetOrganizationTrainingsHandler returns a page of the trainings of the models shared with an organization
+func GetOrganizationTrainingsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, _, _, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	runs, total, err := repository.GetOrganizationTrainingRuns(r.Context(), orgID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get trainings of organization %d: %v", orgID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve trainings")
+		return
+	}
+	if runs == nil {
+		runs = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"trainings": runs,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
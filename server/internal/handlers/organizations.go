@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// maxOrganizationNameLength matches the organizations.name column
+const maxOrganizationNameLength = 100
+
+// RequireListingAccess hides listings from users who may not see them: organization listings
+// from non-members and private listings from everyone but their publisher. It guards the routes
+// that take a listing ID as {id}, answering 404 so hidden listings cannot be told from missing ones.
+func RequireListingAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+			return
+		}
+		userID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+
+		visible, err := repository.CanViewListing(r.Context(), listingID, userID)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+			return
+		}
+		if !visible {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateListingVisibility checks who a publisher wants a listing to be visible to. Organization
+// listings need an organization the publisher belongs to, and only public listings can be sold or rented.
+func validateListingVisibility(r *http.Request, userID int, visibility string, organizationID *int, price, rentalPrice int) (int, error) {
+	switch visibility {
+	case repository.ListingVisibilityPublic:
+		return http.StatusOK, nil
+	case repository.ListingVisibilityOrg:
+		if organizationID == nil {
+			return http.StatusBadRequest, fmt.Errorf("organization_id is required for organization listings")
+		}
+		role, err := repository.GetOrganizationRole(r.Context(), *organizationID, userID)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			return http.StatusInternalServerError, fmt.Errorf("Failed to check organization membership")
+		}
+		if role == "" {
+			return http.StatusForbidden, fmt.Errorf("You are not a member of this organization")
+		}
+	case repository.ListingVisibilityPrivate:
+	default:
+		return http.StatusBadRequest, fmt.Errorf("visibility must be public, org or private")
+	}
+	if price > 0 || rentalPrice > 0 {
+		return http.StatusBadRequest, fmt.Errorf("only public listings can be sold or rented")
+	}
+	return http.StatusOK, nil
+}
+
+// organizationFromRequest reads the organization in the URL and the current user's role in it. It
+// writes the error response and returns false when the user is not a member.
+func organizationFromRequest(w http.ResponseWriter, r *http.Request) (int, int, string, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return 0, 0, "", false
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "orgId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid organization ID")
+		return 0, 0, "", false
+	}
+
+	role, err := repository.GetOrganizationRole(r.Context(), orgID, userID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve organization")
+		return 0, 0, "", false
+	}
+	if role == "" {
+		apierrors.Respond(w, http.StatusNotFound, "Organization not found")
+		return 0, 0, "", false
+	}
+	return orgID, userID, role, true
+}
+
+// CreateOrganizationHandler creates an organization owned by the current user
+func CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxOrganizationNameLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxOrganizationNameLength))
+		return
+	}
+
+	orgID, err := repository.CreateOrganization(r.Context(), userID, req.Name)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create organization")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"organization_id": orgID,
+	})
+}
+
+// GetOrganizationsHandler lists the organizations the current user belongs to
+func GetOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	organizations, err := repository.GetUserOrganizations(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get organizations of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve organizations")
+		return
+	}
+	if organizations == nil {
+		organizations = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"organizations": organizations,
+	})
+}
+
+// GetOrganizationMembersHandler lists the members of an organization to its members
+func GetOrganizationMembersHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, _, _, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := repository.GetOrganizationMembers(r.Context(), orgID)
+	if err != nil {
+		log.Printf("❌ Failed to get members of organization %d: %v", orgID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve members")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"members": members,
+	})
+}
+
+// AddOrganizationMemberHandler adds a user to an organization by email, or changes their role.
+// Owners and admins manage members; only owners can grant or change the owner role.
+func AddOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, role, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if role != repository.OrgRoleOwner && role != repository.OrgRoleAdmin {
+		apierrors.Respond(w, http.StatusForbidden, "Only organization owners and admins can manage members")
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Role == "" {
+		req.Role = repository.OrgRoleMember
+	}
+	if req.Role != repository.OrgRoleOwner && req.Role != repository.OrgRoleAdmin && req.Role != repository.OrgRoleMember {
+		apierrors.Respond(w, http.StatusBadRequest, "role must be owner, admin or member")
+		return
+	}
+
+	member, err := repository.GetUserByEmail(r.Context(), strings.TrimSpace(req.Email))
+	if err != nil || member == nil {
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+	memberID := getIntField(*member, "id", 0)
+
+	currentRole, err := repository.GetOrganizationRole(r.Context(), orgID, memberID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to add member")
+		return
+	}
+	if (req.Role == repository.OrgRoleOwner || currentRole == repository.OrgRoleOwner) && role != repository.OrgRoleOwner {
+		apierrors.Respond(w, http.StatusForbidden, "Only organization owners can manage owners")
+		return
+	}
+	if currentRole == repository.OrgRoleOwner && req.Role != repository.OrgRoleOwner {
+		owners, err := repository.CountOrganizationOwners(r.Context(), orgID)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to add member")
+			return
+		}
+		if owners <= 1 {
+			apierrors.Respond(w, http.StatusConflict, "An organization needs at least one owner")
+			return
+		}
+	}
+
+	if err := repository.SetOrganizationMember(r.Context(), orgID, memberID, req.Role); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to add member")
+		return
+	}
+	log.Printf("✅ User %d set user %d as %s of organization %d", userID, memberID, req.Role, orgID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"user_id": memberID,
+		"role":    req.Role,
+	})
+}
+
+// RemoveOrganizationMemberHandler removes a user from an organization. Members can leave on
+// their own; owners and admins can remove others, and only owners can remove owners.
+func RemoveOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, role, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if memberID != userID && role != repository.OrgRoleOwner && role != repository.OrgRoleAdmin {
+		apierrors.Respond(w, http.StatusForbidden, "Only organization owners and admins can manage members")
+		return
+	}
+
+	memberRole, err := repository.GetOrganizationRole(r.Context(), orgID, memberID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+	if memberRole == "" {
+		apierrors.Respond(w, http.StatusNotFound, "Member not found")
+		return
+	}
+	if memberRole == repository.OrgRoleOwner {
+		if role != repository.OrgRoleOwner {
+			apierrors.Respond(w, http.StatusForbidden, "Only organization owners can manage owners")
+			return
+		}
+		owners, err := repository.CountOrganizationOwners(r.Context(), orgID)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove member")
+			return
+		}
+		if owners <= 1 {
+			apierrors.Respond(w, http.StatusConflict, "An organization needs at least one owner")
+			return
+		}
+	}
+
+	if _, err := repository.RemoveOrganizationMember(r.Context(), orgID, memberID); err != nil {
+		log.Printf("❌ %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+	log.Printf("✅ User %d removed user %d from organization %d", userID, memberID, orgID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Member removed",
+	})
+}
+
+// GetOrganizationModelsHandler is the organization's internal model registry: the active listings
+// its members published to the organization (listing_type narrows it down)
+func GetOrganizationModelsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, _, _, ok := organizationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	listingType := r.URL.Query().Get("listing_type")
+	if listingType != "" && !listingTypes[listingType] {
+		apierrors.Respond(w, http.StatusBadRequest, invalidListingTypeMessage)
+		return
+	}
+
+	listings, err := repository.GetOrganizationListings(r.Context(), orgID, listingType)
+	if err != nil {
+		log.Printf("❌ Failed to get listings of organization %d: %v", orgID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve models")
+		return
+	}
+	if listings == nil {
+		listings = []map[string]interface{}{}
+	}
+	localizeListings(w, r, listings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"models":  listings,
+	})
+}
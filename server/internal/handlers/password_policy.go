@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"server/internal/apierrors"
+)
+
+// Environment variables configuring the password policy
+const (
+	PasswordMinLengthEnv      = "PASSWORD_MIN_LENGTH"
+	PasswordMinEntropyEnv     = "PASSWORD_MIN_ENTROPY_BITS"
+	PasswordBreachCheckEnv    = "PASSWORD_BREACH_CHECK"
+	PasswordBreachCheckURLEnv = "PASSWORD_BREACH_CHECK_URL"
+)
+
+const (
+	defaultPasswordMinLength  = 8
+	defaultPasswordMinEntropy = 40
+	// bcrypt ignores everything after 72 bytes
+	maxPasswordBytes = 72
+	// defaultBreachCheckURL is the HaveIBeenPwned range API. Only the first 5 characters of the
+	// password's SHA-1 hash are sent to it.
+	defaultBreachCheckURL = "https://api.pwnedpasswords.com/range/"
+	breachCheckTimeout    = 3 * time.Second
+)
+
+var breachCheckClient = &http.Client{Timeout: breachCheckTimeout}
+
+// passwordEvaluation is the result of checking a password against the policy
+type passwordEvaluation struct {
+	Valid       bool     `json:"valid"`
+	Score       int      `json:"score"` // 0 (very weak) to 4 (strong)
+	EntropyBits float64  `json:"entropy_bits"`
+	Problems    []string `json:"problems"`
+	// Breached is nil when the breach check is disabled or the service could not be reached
+	Breached    *bool `json:"breached,omitempty"`
+	BreachCount int   `json:"breach_count,omitempty"`
+}
+
+// envInt reads a positive integer environment variable, falling back to def
+func envInt(name string, def int) int {
+	if raw := os.Getenv(name); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n >= 1 {
+			return n
+		}
+		log.Printf("⚠️  Invalid %s %q, using default %d", name, raw, def)
+	}
+	return def
+}
+
+// passwordEntropy estimates the entropy of a password in bits from its length and the
+// character classes it uses
+func passwordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	length := 0
+	for _, c := range password {
+		length++
+		switch {
+		case c > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return math.Round(float64(length)*math.Log2(float64(pool))*10) / 10
+}
+
+// passwordScore maps entropy to a 0-4 score relative to the required minimum
+func passwordScore(entropy, minEntropy float64) int {
+	switch {
+	case entropy < minEntropy*0.5:
+		return 0
+	case entropy < minEntropy:
+		return 1
+	case entropy < minEntropy+20:
+		return 2
+	case entropy < minEntropy+40:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// passwordBreachCount asks the breach check service how often a password appeared in known
+// breaches. Only a prefix of the SHA-1 hash leaves the server.
+func passwordBreachCount(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	baseURL := os.Getenv(PasswordBreachCheckURLEnv)
+	if baseURL == "" {
+		baseURL = defaultBreachCheckURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Padding hides the number of matching suffixes from observers
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "AIManage-Server")
+
+	resp, err := breachCheckClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("breach check returned status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("invalid breach count %q", count)
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
+
+// evaluatePassword checks a password against the configured policy. The username and email
+// are optional and reject passwords that contain them. If the breach check service cannot be
+// reached the password is evaluated without it.
+func evaluatePassword(ctx context.Context, password, username, email string) passwordEvaluation {
+	minLength := envInt(PasswordMinLengthEnv, defaultPasswordMinLength)
+	minEntropy := float64(envInt(PasswordMinEntropyEnv, defaultPasswordMinEntropy))
+
+	entropy := passwordEntropy(password)
+	result := passwordEvaluation{
+		EntropyBits: entropy,
+		Score:       passwordScore(entropy, minEntropy),
+		Problems:    []string{},
+	}
+
+	if length := len([]rune(password)); length < minLength {
+		result.Problems = append(result.Problems, fmt.Sprintf("Password must be at least %d characters long", minLength))
+	}
+	if len(password) > maxPasswordBytes {
+		result.Problems = append(result.Problems, fmt.Sprintf("Password cannot be longer than %d bytes", maxPasswordBytes))
+	}
+	if entropy < minEntropy {
+		result.Problems = append(result.Problems, "Password is too easy to guess, use a longer password or mix letters, digits and symbols")
+	}
+
+	lowered := strings.ToLower(password)
+	if username = strings.ToLower(strings.TrimSpace(username)); len(username) >= 3 && strings.Contains(lowered, username) {
+		result.Problems = append(result.Problems, "Password cannot contain your username")
+	}
+	if local, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@"); len(local) >= 3 && strings.Contains(lowered, local) {
+		result.Problems = append(result.Problems, "Password cannot contain your email address")
+	}
+
+	if password != "" && envBool(PasswordBreachCheckEnv, false) {
+		count, err := passwordBreachCount(ctx, password)
+		if err != nil {
+			log.Printf("⚠️  Password breach check failed, skipping it: %v", err)
+		} else {
+			breached := count > 0
+			result.Breached = &breached
+			result.BreachCount = count
+			if breached {
+				result.Problems = append(result.Problems, "This password appeared in a data breach, please choose another one")
+				result.Score = 0
+			}
+		}
+	}
+
+	result.Valid = len(result.Problems) == 0
+	return result
+}
+
+// PasswordStrengthHandler evaluates a password against the policy for live feedback while the
+// user types. The password is neither logged nor stored.
+func PasswordStrengthHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result := evaluatePassword(r.Context(), req.Password, req.Username, req.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"password": result,
+	})
+}
+
+// writePasswordPolicyError rejects a password that does not meet the policy
+func writePasswordPolicyError(w http.ResponseWriter, result passwordEvaluation) {
+	apierrors.Write(w, apierrors.New(http.StatusBadRequest, apierrors.CodeWeakPassword, strings.Join(result.Problems, ". ")).
+		WithDetails(map[string]interface{}{"password": result}))
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+	"server/helpers"
+	"server/internal/apierrors"
+	"server/internal/email"
+	"server/internal/repository"
+)
+
+// passwordResetTTL is how long a password reset link can be used
+const passwordResetTTL = time.Hour
+
+// hashResetToken hashes a reset token so a leaked database does not expose usable links
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ForgotPasswordHandler emails a password reset link. It always answers the same way so it
+// cannot be used to find out which emails are registered.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "email is required")
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+
+	respond := func() {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "If an account exists for this email, a password reset link has been sent.",
+		})
+	}
+
+	user, err := repository.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		log.Printf("❌ Failed to look up user for password reset: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to start password reset")
+		return
+	}
+	if user == nil {
+		respond()
+		return
+	}
+
+	token, err := helpers.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("❌ Failed to generate password reset token: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to start password reset")
+		return
+	}
+	if _, err := repository.SetPasswordResetToken(r.Context(), req.Email, hashResetToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		log.Printf("❌ Failed to save password reset token: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to start password reset")
+		return
+	}
+
+	username := getStringField(*user, "username", "")
+	go func() {
+		if err := email.NewEmailService().SendPasswordResetEmail(req.Email, username, token); err != nil {
+			log.Printf("⚠️  Failed to send password reset email: %v", err)
+		}
+	}()
+
+	respond()
+}
+
+// ResetPasswordHandler sets a new password with a token from a reset email. The new password
+// must meet the password policy, and every session of the user is revoked.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "token and password are required")
+		return
+	}
+
+	user, err := repository.GetUserByPasswordResetToken(r.Context(), hashResetToken(req.Token))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid or expired reset link")
+			return
+		}
+		log.Printf("❌ Failed to look up password reset token: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	userID := getIntField(user, "id", 0)
+	result := evaluatePassword(r.Context(), req.Password, getStringField(user, "username", ""), getStringField(user, "email", ""))
+	if !result.Valid {
+		writePasswordPolicyError(w, result)
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		apierrors.Respond(w, http.StatusInternalServerError, "Couldn't hash password")
+		return
+	}
+	if err := repository.ResetPassword(r.Context(), userID, string(hashed)); err != nil {
+		log.Printf("❌ Failed to reset password of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	log.Printf("✅ User %d reset their password", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Password updated. Please log in with your new password.",
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+)
+
+// Placement modes of a training request
+const (
+	PlacementAuto   = "auto"
+	PlacementAgent  = "agent"
+	PlacementServer = "server"
+)
+
+// trainingPlacement is where a training runs and why
+type trainingPlacement struct {
+	// Target is PlacementAgent or PlacementServer
+	Target       string                       `json:"target"`
+	AgentID      string                       `json:"agent_id,omitempty"`
+	Requirements aiAgent.HardwareRequirements `json:"requirements"`
+	Reason       string                       `json:"reason"`
+	// Rejected tells why connected agents were not chosen
+	Rejected map[string]string `json:"rejected,omitempty"`
+}
+
+// choosePlacement decides where a training of req.FolderName runs. Automatic placement prefers
+// the user's agents whose hardware meets the training's requirements, then the server when the
+// user may train there and it meets them. Placement "agent", or an agent_id, trains on an agent
+// even if it falls short, and placement "server" always trains on the server.
+func choosePlacement(r *http.Request, userEmail string, req aiAgent.TrainingRequest, trainer *aiAgent.Trainer) (trainingPlacement, *trainingStartError) {
+	mode := req.Placement
+	if mode == "" {
+		mode = PlacementAuto
+	}
+	if mode != PlacementAuto && mode != PlacementAgent && mode != PlacementServer {
+		return trainingPlacement{}, &trainingStartError{Status: http.StatusBadRequest,
+			Message: fmt.Sprintf("placement must be '%s', '%s' or '%s'", PlacementAuto, PlacementAgent, PlacementServer)}
+	}
+	if mode == PlacementServer && req.AgentID != "" {
+		return trainingPlacement{}, &trainingStartError{Status: http.StatusBadRequest, Message: "agent_id cannot be used with placement 'server'"}
+	}
+
+	needs, err := trainer.TrainingRequirements(req.FolderName, req.ScriptName)
+	if err != nil {
+		return trainingPlacement{}, &trainingStartError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	placement := trainingPlacement{Requirements: needs}
+
+	// Forced onto an agent: the best suitable one, else the best one
+	if mode == PlacementAgent || req.AgentID != "" {
+		agent, rejected, err := rankAgents(userEmail, req.AgentID, &needs)
+		placement.Rejected = rejected
+		placement.Reason = "placed on an agent on request"
+		if errors.Is(err, errNoSuitableAgent) {
+			agent, err = selectAgent(userEmail, req.AgentID)
+			placement.Reason = "placed on an agent on request, although " + describeRejections(rejected)
+		}
+		if err != nil {
+			return trainingPlacement{}, &trainingStartError{Status: http.StatusConflict, Message: err.Error()}
+		}
+		agent.mu.Lock()
+		placement.Target, placement.AgentID = PlacementAgent, agent.displayName()
+		agent.mu.Unlock()
+		return placement, nil
+	}
+
+	if mode == PlacementAuto {
+		agent, rejected, err := rankAgents(userEmail, "", &needs)
+		placement.Rejected = rejected
+		if err == nil {
+			agent.mu.Lock()
+			placement.Target, placement.AgentID = PlacementAgent, agent.displayName()
+			placement.Reason = fmt.Sprintf("%s meets the training's requirements", placement.AgentID)
+			agent.mu.Unlock()
+			return placement, nil
+		}
+	}
+
+	// Server training
+	canTrain, message := CanUserTrainOnServer(r)
+	if !canTrain {
+		details := map[string]interface{}{
+			"hint":      "Connect your training agent or upgrade to a paid subscription",
+			"placement": placement,
+		}
+		if len(placement.Rejected) > 0 {
+			details["hint"] = fmt.Sprintf("Your agents cannot run this training (%s). Connect a suitable agent, upgrade to a paid subscription, or set placement to 'agent' to train anyway.",
+				describeRejections(placement.Rejected))
+		}
+		return trainingPlacement{}, &trainingStartError{Status: http.StatusForbidden, Code: apierrors.CodeTrainingNotAllowed, Message: message, Details: details}
+	}
+	if err := trainer.ServerHardware().Satisfies(needs); err != nil {
+		return trainingPlacement{}, &trainingStartError{Status: http.StatusConflict, Code: apierrors.CodeInsufficientHardware,
+			Message: fmt.Sprintf("The server cannot run this training: it %s", err),
+			Details: map[string]interface{}{"placement": placement}}
+	}
+
+	placement.Target = PlacementServer
+	switch {
+	case mode == PlacementServer:
+		placement.Reason = "placed on the server on request"
+	case len(placement.Rejected) > 0:
+		placement.Reason = "placed on the server because " + describeRejections(placement.Rejected)
+	default:
+		placement.Reason = "no agent connected"
+	}
+	return placement, nil
+}
+
+// describeRejections lists why agents were left out, e.g. "laptop needs a CUDA GPU"
+func describeRejections(rejected map[string]string) string {
+	reasons := make([]string, 0, len(rejected))
+	for name, reason := range rejected {
+		reasons = append(reasons, name+" "+reason)
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, ", ")
+}
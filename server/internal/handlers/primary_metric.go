@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// UpdateModelPrimaryMetricHandler declares the metric of record of one of the user's models, e.g.
+// {"name": "rmse", "direction": "lower"}. Its trainings, detailed metrics, regression alerts and
+// future listings use it instead of accuracy. The direction defaults to lower for well-known error
+// and loss metrics.
+func UpdateModelPrimaryMetricHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	var req struct {
+		Name      string `json:"name"`
+		Direction string `json:"direction"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	metric, err := aiAgent.NewPrimaryMetric(req.Name, req.Direction)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := repository.SetModelPrimaryMetric(r.Context(), modelID, metric.Name, metric.Direction); err != nil {
+		log.Printf("❌ Failed to set primary metric of model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update model")
+		return
+	}
+	log.Printf("✅ Model %d now reports %s", modelID, metric)
+
+	updated, err := repository.GetModelByID(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to reload model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":                  true,
+		"primary_metric":           (*updated)["primary_metric"],
+		"primary_metric_direction": (*updated)["primary_metric_direction"],
+		"primary_metric_value":     (*updated)["primary_metric_value"],
+	})
+}
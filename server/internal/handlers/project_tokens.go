@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// projectTokenPrefix tells project tokens apart from account API keys (sk_live_, sk_read_)
+const projectTokenPrefix = "pt_"
+
+// Scopes a project token can be granted
+const (
+	ProjectScopeConfigRead  = "config:read"
+	ProjectScopeModelUpload = "model:upload"
+)
+
+// maxProjectTokenNameLength matches the project_tokens.name column
+const maxProjectTokenNameLength = 100
+
+// ciTrainingProfile is how a CI job should run the training script of a project token's model
+type ciTrainingProfile struct {
+	ScriptName    string            `json:"script_name"`
+	PythonCommand string            `json:"python_command"`
+	Args          []string          `json:"args"`
+	Env           map[string]string `json:"env"`
+	ExecutionMode string            `json:"execution_mode"`
+}
+
+// validate fills in the defaults of a training profile and checks its execution mode
+func (p *ciTrainingProfile) validate(trainingScript string) error {
+	if p.ScriptName == "" {
+		p.ScriptName = trainingScript
+	}
+	if p.ScriptName == "" {
+		p.ScriptName = "train.py"
+	}
+	if p.PythonCommand == "" {
+		p.PythonCommand = "python3"
+	}
+	if p.Args == nil {
+		p.Args = []string{}
+	}
+	if p.Env == nil {
+		p.Env = map[string]string{}
+	}
+	switch p.ExecutionMode {
+	case "":
+		p.ExecutionMode = aiAgent.ExecutionModeOnDemand
+	case aiAgent.ExecutionModeOnDemand, aiAgent.ExecutionModePreemptible:
+	default:
+		return fmt.Errorf("execution_mode must be %s or %s", aiAgent.ExecutionModeOnDemand, aiAgent.ExecutionModePreemptible)
+	}
+	return nil
+}
+
+// hashProjectToken returns the hash a project token is stored and looked up by
+func hashProjectToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// projectTokenScopes reads the scopes column of a project token row
+func projectTokenScopes(token map[string]interface{}) []string {
+	scopes := []string{}
+	if values, ok := token["scopes"].([]interface{}); ok {
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+// hasProjectScope reports whether a project token was granted a scope
+func hasProjectScope(token map[string]interface{}, scope string) bool {
+	for _, s := range projectTokenScopes(token) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateProjectToken looks up a project token and checks it was granted the scope. It
+// writes the error response and returns false when the token is invalid, revoked or lacks the scope.
+func authenticateProjectToken(ctx context.Context, w http.ResponseWriter, token, scope string) (map[string]interface{}, bool) {
+	if !strings.HasPrefix(token, projectTokenPrefix) {
+		apierrors.Respond(w, http.StatusUnauthorized, "Project token required")
+		return nil, false
+	}
+	projectToken, err := repository.UseProjectToken(ctx, hashProjectToken(token))
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid project token")
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Failed to check project token: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to check project token")
+		return nil, false
+	}
+	if !hasProjectScope(projectToken, scope) {
+		apierrors.Respond(w, http.StatusForbidden, fmt.Sprintf("Project token lacks the %s scope", scope))
+		return nil, false
+	}
+	return projectToken, true
+}
+
+// CreateProjectTokenHandler creates a token scoped to one of the user's models for use in CI
+// pipelines. The token is only returned by this request; the server keeps its hash.
+func CreateProjectTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		ModelID         int               `json:"model_id"`
+		Name            string            `json:"name"`
+		Scopes          []string          `json:"scopes"`
+		TrainingProfile ciTrainingProfile `json:"training_profile"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxProjectTokenNameLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxProjectTokenNameLength))
+		return
+	}
+
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range req.Scopes {
+		if scope != ProjectScopeConfigRead && scope != ProjectScopeModelUpload {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("scopes must be %s or %s", ProjectScopeConfigRead, ProjectScopeModelUpload))
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = []string{ProjectScopeConfigRead, ProjectScopeModelUpload}
+	}
+
+	model, err := repository.GetModelByID(r.Context(), req.ModelID)
+	if err != nil || getIntField(*model, "user_id", 0) != userID {
+		apierrors.Respond(w, http.StatusNotFound, "Model not found")
+		return
+	}
+	if err := req.TrainingProfile.validate(getStringField(*model, "training_script", "")); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	profile, err := json.Marshal(req.TrainingProfile)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid training_profile")
+		return
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("❌ Failed to generate project token: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create project token")
+		return
+	}
+	token := projectTokenPrefix + hex.EncodeToString(secret)
+
+	projectToken, err := repository.CreateProjectToken(r.Context(), userID, req.ModelID, req.Name,
+		hashProjectToken(token), token[:len(projectTokenPrefix)+8], scopes, profile)
+	if err != nil {
+		log.Printf("❌ Failed to create project token for model %d: %v", req.ModelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create project token")
+		return
+	}
+	log.Printf("🔑 User %d created project token %q for model %d", userID, req.Name, req.ModelID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"token":         token,
+		"project_token": projectToken,
+		"message":       "Copy the token now, it will not be shown again",
+	})
+}
+
+// GetProjectTokensHandler lists the user's project tokens without their secrets
+func GetProjectTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	tokens, err := repository.GetProjectTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get project tokens of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve project tokens")
+		return
+	}
+	if tokens == nil {
+		tokens = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"project_tokens": tokens,
+	})
+}
+
+// RevokeProjectTokenHandler revokes one of the user's project tokens
+func RevokeProjectTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	tokenID, err := strconv.Atoi(chi.URLParam(r, "tokenId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	revoked, err := repository.RevokeProjectToken(r.Context(), tokenID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to revoke project token %d: %v", tokenID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to revoke project token")
+		return
+	}
+	if !revoked {
+		apierrors.Respond(w, http.StatusNotFound, "Project token not found")
+		return
+	}
+	log.Printf("🔑 User %d revoked project token %d", userID, tokenID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Project token revoked",
+	})
+}
+
+// GetCIConfigHandler returns what a CI job needs to train and upload the model of the project
+// token sent as a Bearer token: the model, its training profile and, for tokens with the
+// model:upload scope, how to upload the trained model.
+func GetCIConfigHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := authenticateProjectToken(r.Context(), w, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ProjectScopeConfigRead)
+	if !ok {
+		return
+	}
+
+	modelName := getStringField(token, "model_name", "")
+	var profile ciTrainingProfile
+	if raw, err := json.Marshal(token["training_profile"]); err == nil {
+		json.Unmarshal(raw, &profile)
+	}
+	profile.validate(getStringField(token, "training_script", ""))
+
+	var upload map[string]interface{}
+	if hasProjectScope(token, ProjectScopeModelUpload) {
+		upload = map[string]interface{}{
+			"method":     http.MethodPost,
+			"endpoint":   "/v1/agent/upload-model",
+			"file_field": "model_file",
+			"fields":     map[string]string{"model_name": modelName},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"model": map[string]interface{}{
+			"id":   getIntField(token, "model_id", 0),
+			"name": modelName,
+		},
+		"training_profile": profile,
+		"upload":           upload,
+		"scopes":           projectTokenScopes(token),
+	})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	defaultPublicListingsLimit = 20
+	maxPublicListingsLimit     = 100
+
+	// How long shared caches may serve public API responses without revalidating
+	publicListingsMaxAge = 60 * time.Second
+	publicListingMaxAge  = 5 * time.Minute
+)
+
+// publicAPILimiter applies the restrictive per-IP limit of the public API (PUBLIC_API_RATE_LIMIT
+// requests per minute)
+var publicAPILimiter = middlewares.NewRateLimiter(envInt("PUBLIC_API_RATE_LIMIT", 60), time.Minute)
+
+// PublicAPIRateLimit limits the requests of each client IP to the public API
+var PublicAPIRateLimit = publicAPILimiter.Middleware(clientAddress)
+
+// encodePublicCursor encodes the position after a listing as an opaque pagination cursor
+func encodePublicCursor(listing map[string]interface{}) string {
+	publishedAt, _ := listing["published_at"].(time.Time)
+	raw := publishedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(getIntField(listing, "id", 0))
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodePublicCursor parses a pagination cursor returned by encodePublicCursor
+func decodePublicCursor(cursor string) (*repository.PublicListingCursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+	rawTime, rawID, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, false
+	}
+	publishedAt, err := time.Parse(time.RFC3339Nano, rawTime)
+	if err != nil {
+		return nil, false
+	}
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return nil, false
+	}
+	return &repository.PublicListingCursor{PublishedAt: publishedAt, ID: id}, true
+}
+
+// writeCacheableJSON writes a public response with a strong ETag and Cache-Control, and answers
+// 304 Not Modified when the client's If-None-Match already has it
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, maxAge time.Duration, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("❌ Failed to encode public API response: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// PublicListingsHandler lists public marketplace listings for third-party sites, newest first.
+// It needs no authentication and returns no user-specific data. Pages are walked with the
+// next_cursor of the previous page, which stays stable as new listings are published; limit caps
+// the page size and listing_type and category narrow the results.
+func PublicListingsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultPublicListingsLimit
+	}
+	if limit > maxPublicListingsLimit {
+		limit = maxPublicListingsLimit
+	}
+	var after *repository.PublicListingCursor
+	if cursor := query.Get("cursor"); cursor != "" {
+		var ok bool
+		if after, ok = decodePublicCursor(cursor); !ok {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+
+	// Fetch one extra listing to know whether there is a next page
+	listings, err := repository.GetPublicListings(r.Context(), query.Get("listing_type"), query.Get("category"), after, limit+1)
+	if err != nil {
+		log.Printf("❌ Failed to get public listings: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve listings")
+		return
+	}
+	var nextCursor interface{}
+	if len(listings) > limit {
+		listings = listings[:limit]
+		nextCursor = encodePublicCursor(listings[limit-1])
+	}
+	if listings == nil {
+		listings = []map[string]interface{}{}
+	}
+
+	writeCacheableJSON(w, r, publicListingsMaxAge, map[string]interface{}{
+		"listings":    listings,
+		"next_cursor": nextCursor,
+	})
+}
+
+// PublicListingHandler returns the public details of a marketplace listing for third-party sites
+func PublicListingHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid listing ID")
+		return
+	}
+
+	listing, err := repository.GetPublicListing(r.Context(), listingID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Listing not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get public listing %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve listing")
+		return
+	}
+
+	writeCacheableJSON(w, r, publicListingMaxAge, map[string]interface{}{
+		"listing": listing,
+	})
+}
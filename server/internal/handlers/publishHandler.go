@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
 	"server/internal/middlewares"
 	"server/internal/repository"
 )
@@ -27,6 +30,17 @@ type PublishModelRequest struct {
 	Tags      []string `json:"tags,omitempty"`
 	ModelType string   `json:"model_type,omitempty"`
 	Framework string   `json:"framework,omitempty"`
+
+	// ListingType is "model" (default), "pipeline_template" or "weights_only"
+	ListingType string `json:"listing_type,omitempty"`
+
+	// Rental terms: price in cents of renting for RentalDays days (default 30) instead of buying
+	RentalPrice *int `json:"rental_price,omitempty"`
+	RentalDays  *int `json:"rental_days,omitempty"`
+
+	// Visibility is "public" (default), "org" for the members of OrganizationID, or "private"
+	Visibility     string `json:"visibility,omitempty"`
+	OrganizationID *int   `json:"organization_id,omitempty"`
 }
 
 func PubHandler(w http.ResponseWriter, r *http.Request) {
@@ -36,25 +50,50 @@ func PubHandler(w http.ResponseWriter, r *http.Request) {
 	var req PublishModelRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Println("❌ Invalid request body:", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Validate required fields
 	if req.ModelID == 0 {
-		http.Error(w, "model_id is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model_id is required")
 		return
 	}
 	if req.Description == "" {
-		http.Error(w, "description is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "description is required")
 		return
 	}
 	if req.LicenseType == "" {
-		http.Error(w, "license_type is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "license_type is required")
 		return
 	}
 	if req.Price < 0 {
-		http.Error(w, "price must be non-negative", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "price must be non-negative")
+		return
+	}
+	if err := validateRentalTerms(req.Price, req.RentalPrice, req.RentalDays); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var rentalPrice, rentalDays interface{}
+	if req.RentalPrice != nil && *req.RentalPrice > 0 {
+		rentalPrice = *req.RentalPrice
+	}
+	if req.RentalDays != nil {
+		rentalDays = *req.RentalDays
+	}
+	if req.ListingType == "" {
+		req.ListingType = ListingTypeModel
+	}
+	switch req.ListingType {
+	case ListingTypeModel, ListingTypeWeightsOnly:
+	case ListingTypePipelineTemplate:
+		if !templateLicenses[req.LicenseType] {
+			apierrors.Respond(w, http.StatusBadRequest, "license_type is not a supported template license")
+			return
+		}
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, invalidListingTypeMessage)
 		return
 	}
 
@@ -62,7 +101,7 @@ func PubHandler(w http.ResponseWriter, r *http.Request) {
 	email, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok || email == "" {
 		log.Println("❌ User email not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -70,32 +109,48 @@ func PubHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := repository.GetUserByEmail(r.Context(), email)
 	if err != nil {
 		log.Println("❌ Failed to get user:", err)
-		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user")
 		return
 	}
 	if user == nil {
 		log.Println("❌ User not found")
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
 	userID, ok := (*user)["id"].(int32)
 	if !ok {
 		log.Println("❌ Failed to get user ID")
-		http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user ID")
+		return
+	}
+
+	if req.Visibility == "" {
+		req.Visibility = repository.ListingVisibilityPublic
+	}
+	rentalPriceCents := 0
+	if req.RentalPrice != nil {
+		rentalPriceCents = *req.RentalPrice
+	}
+	if status, err := validateListingVisibility(r, int(userID), req.Visibility, req.OrganizationID, req.Price, rentalPriceCents); err != nil {
+		apierrors.Respond(w, status, err.Error())
 		return
 	}
+	var organizationID interface{}
+	if req.Visibility == repository.ListingVisibilityOrg {
+		organizationID = *req.OrganizationID
+	}
 
 	// Get model from database
 	model, err := repository.GetModelByID(r.Context(), req.ModelID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			log.Println("❌ Model not found")
-			http.Error(w, "Model not found", http.StatusNotFound)
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
 			return
 		}
 		log.Println("❌ Failed to get model:", err)
-		http.Error(w, "Failed to get model", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get model")
 		return
 	}
 
@@ -103,16 +158,47 @@ func PubHandler(w http.ResponseWriter, r *http.Request) {
 	modelUserID, ok := (*model)["user_id"].(int32)
 	if !ok || modelUserID != userID {
 		log.Println("❌ User does not own this model")
-		http.Error(w, "You don't have permission to publish this model", http.StatusForbidden)
+		if role, _ := repository.GetModelCollaboratorRole(r.Context(), req.ModelID, int(userID)); role != "" {
+			apierrors.Respond(w, http.StatusForbidden, "Only the model owner can publish it")
+			return
+		}
+		apierrors.Respond(w, http.StatusForbidden, "You don't have permission to publish this model")
 		return
 	}
 
-	// Verify model has been trained
-	trainedModelPath, _ := (*model)["trained_model_path"].(string)
-	if trainedModelPath == "" {
-		log.Println("❌ Model has not been trained yet")
-		http.Error(w, "Model must be trained before publishing", http.StatusBadRequest)
-		return
+	// Models are published with their weights, templates with their scripts only
+	var trainedModelPath, templatePath interface{}
+	trainingScript := (*model)["training_script"]
+	if req.ListingType == ListingTypePipelineTemplate {
+		var modelFolder string
+		if folders, ok := (*model)["folder"].([]interface{}); ok && len(folders) > 0 {
+			modelFolder, _ = folders[0].(string)
+		}
+		trainingScript, _ := (*model)["training_script"].(string)
+		path, err := packagePipelineTemplate(modelFolder, trainingScript, int(userID), req.ModelID)
+		if err != nil {
+			log.Println("❌ Failed to package pipeline template:", err)
+			apierrors.Respond(w, http.StatusBadRequest, "Could not package pipeline template: "+err.Error())
+			return
+		}
+		templatePath = path
+	} else {
+		path, _ := (*model)["trained_model_path"].(string)
+		if path == "" {
+			log.Println("❌ Model has not been trained yet")
+			apierrors.Respond(w, http.StatusBadRequest, "Model must be trained before publishing")
+			return
+		}
+		// Weights-only listings are nothing but the artifact, which must be on the server
+		if req.ListingType == ListingTypeWeightsOnly {
+			if _, err := resolveUploadsPath(path); err != nil {
+				log.Printf("❌ Trained model of model %d is not available: %v", req.ModelID, err)
+				apierrors.Respond(w, http.StatusBadRequest, "The trained model file was not found on the server, upload or retrain it before publishing")
+				return
+			}
+			trainingScript = nil
+		}
+		trainedModelPath = path
 	}
 
 	// Get accuracy score from model if available
@@ -128,7 +214,7 @@ func PubHandler(w http.ResponseWriter, r *http.Request) {
 		"name":               (*model)["name"],
 		"picture":            (*model)["picture"],
 		"trained_model_path": trainedModelPath,
-		"training_script":    (*model)["training_script"],
+		"training_script":    trainingScript,
 		"description":        req.Description,
 		"price":              req.Price,
 		"license_type":       req.LicenseType,
@@ -137,40 +223,97 @@ func PubHandler(w http.ResponseWriter, r *http.Request) {
 		"model_type":         req.ModelType,
 		"framework":          req.Framework,
 		"accuracy_score":     accuracyScore,
+		"listing_type":       req.ListingType,
+		"template_path":      templatePath,
+		"rental_price":       rentalPrice,
+		"rental_days":        rentalDays,
+		"visibility":         req.Visibility,
+		"organization_id":    organizationID,
+
+		// The listing shows the metric of record of the model
+		"primary_metric":           (*model)["primary_metric"],
+		"primary_metric_direction": (*model)["primary_metric_direction"],
+		"primary_metric_value":     (*model)["primary_metric_value"],
 	}
 
 	// Insert published model
 	publishedID, err := repository.InsertPublishedModel(r.Context(), publishData)
 	if err != nil {
 		log.Println("❌ Failed to publish model:", err)
-		http.Error(w, "Failed to publish model: "+err.Error(), http.StatusInternalServerError)
+		if path, ok := templatePath.(string); ok {
+			os.Remove(filepath.Join(uploadsBaseDir(), path))
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to publish model: "+err.Error())
 		return
 	}
 
 	log.Printf("✅ Model published successfully with ID: %d", publishedID)
+	recordAudit(r, AuditModelPublished, AuditTargetListing, fmt.Sprint(publishedID), map[string]interface{}{
+		"model_id":     req.ModelID,
+		"listing_type": req.ListingType,
+		"visibility":   req.Visibility,
+		"price":        req.Price,
+	})
+
+	// Warn the publisher when the listing looks like a re-upload; matches are queued for admin review
+	modelPath, _ := trainedModelPath.(string)
+	duplicates, err := checkListingDuplicates(r.Context(), publishedID, req.ListingType, modelPath, req.Description)
+	if err != nil {
+		log.Printf("⚠️  Failed to check listing %d for duplicates: %v", publishedID, err)
+	}
+	if duplicates == nil {
+		duplicates = []duplicateMatch{}
+	}
+
+	// Machine translate the description into the configured languages
+	go translateListing(publishedID, req.Description, "")
+
+	// Followers who can see the listing hear about it right away
+	publisherName, _ := (*user)["username"].(string)
+	listingName, _ := (*model)["name"].(string)
+	go notifyFollowers(int(userID), publishedID, publisherName, listingName)
 
 	// Send success response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":      "Model published successfully",
-		"published_id": publishedID,
+		"message":            "Model published successfully",
+		"published_id":       publishedID,
+		"listing_type":       req.ListingType,
+		"visibility":         req.Visibility,
+		"duplicate_warnings": duplicates,
 	})
 }
 
-// GetPublishedModelsHandler retrieves all active published models for the community marketplace
+// GetPublishedModelsHandler retrieves all active published models for the community marketplace,
+// narrowed down by the search filters in the query string and ordered by ?sort= (trending by default)
 func GetPublishedModelsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("📋 GetPublishedModelsHandler called")
 
-	publishedModels, err := repository.GetPublishedModels(r.Context())
+	filter, err := parseMarketplaceFilter(r)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewerID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	publishedModels, err := repository.GetPublishedModels(r.Context(), filter.ListingType, viewerID)
 	if err != nil {
 		log.Println("❌ Failed to get published models:", err)
-		http.Error(w, "Failed to retrieve published models", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve published models")
 		return
 	}
+	publishedModels = filter.apply(publishedModels)
+	if err := sortListings(r, publishedModels); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	markSavedListings(r, publishedModels, viewerID)
 
 	log.Printf("✅ Retrieved %d published models", len(publishedModels))
 
+	localizeListings(w, r, publishedModels)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(publishedModels)
 }
@@ -183,7 +326,7 @@ func GetMyPublishedModelsHandler(w http.ResponseWriter, r *http.Request) {
 	email, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok || email == "" {
 		log.Println("❌ User email not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -191,26 +334,26 @@ func GetMyPublishedModelsHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := repository.GetUserByEmail(r.Context(), email)
 	if err != nil {
 		log.Println("❌ Failed to get user:", err)
-		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user")
 		return
 	}
 	if user == nil {
 		log.Println("❌ User not found")
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
 	userID, ok := (*user)["id"].(int32)
 	if !ok {
 		log.Println("❌ Failed to get user ID")
-		http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user ID")
 		return
 	}
 
 	publishedModels, err := repository.GetPublishedModelsByPublisher(r.Context(), int(userID))
 	if err != nil {
 		log.Println("❌ Failed to get published models:", err)
-		http.Error(w, "Failed to retrieve published models", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve published models")
 		return
 	}
 
@@ -228,7 +371,7 @@ func UnPublishModel(w http.ResponseWriter, r *http.Request) {
 	publishedModelID := r.PathValue("id")
 	if publishedModelID == "" {
 		log.Println("❌ Missing published model ID in URL")
-		http.Error(w, "Published model ID is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Published model ID is required")
 		return
 	}
 
@@ -236,7 +379,7 @@ func UnPublishModel(w http.ResponseWriter, r *http.Request) {
 	var modelID int
 	if _, err := fmt.Sscanf(publishedModelID, "%d", &modelID); err != nil {
 		log.Printf("❌ Invalid model ID format: %s", publishedModelID)
-		http.Error(w, "Invalid model ID format", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID format")
 		return
 	}
 
@@ -244,7 +387,7 @@ func UnPublishModel(w http.ResponseWriter, r *http.Request) {
 	email, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok || email == "" {
 		log.Println("❌ User email not found in request context")
-		http.Error(w, "Unauthorized - authentication required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized - authentication required")
 		return
 	}
 
@@ -252,12 +395,12 @@ func UnPublishModel(w http.ResponseWriter, r *http.Request) {
 	user, err := repository.GetUserByEmail(r.Context(), email)
 	if err != nil {
 		log.Printf("❌ Failed to fetch user by email %s: %v", email, err)
-		http.Error(w, "Failed to authenticate user", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to authenticate user")
 		return
 	}
 	if user == nil {
 		log.Printf("❌ No user found with email: %s", email)
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
@@ -265,7 +408,7 @@ func UnPublishModel(w http.ResponseWriter, r *http.Request) {
 	userID, ok := (*user)["id"].(int32)
 	if !ok {
 		log.Println("❌ Failed to extract user ID from database record")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -275,11 +418,12 @@ func UnPublishModel(w http.ResponseWriter, r *http.Request) {
 	err = repository.UnpublishModel(r.Context(), modelID, int(userID))
 	if err != nil {
 		log.Printf("❌ Failed to unpublish model %d: %v", modelID, err)
-		http.Error(w, err.Error(), http.StatusForbidden)
+		apierrors.Respond(w, http.StatusForbidden, err.Error())
 		return
 	}
 
 	log.Printf("✅ Successfully unpublished model %d by user %d", modelID, userID)
+	recordAudit(r, AuditModelUnpublished, AuditTargetListing, fmt.Sprint(modelID), nil)
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Country codes of grouped rows in publisher analytics
+const (
+	analyticsCountryOther   = "other"   // Countries below GEOIP_MIN_COUNTRY_COUNT
+	analyticsCountryUnknown = "unknown" // Events without a country
+)
+
+// countryStats are a country's views and downloads in the selected period and the one before it
+type countryStats struct {
+	Country           string   `json:"country"`
+	Views             int      `json:"views"`
+	Downloads         int      `json:"downloads"`
+	PreviousViews     int      `json:"previous_views"`
+	PreviousDownloads int      `json:"previous_downloads"`
+	Growth            *float64 `json:"growth"` // Relative change of views and downloads, null without a previous period
+}
+
+func (s *countryStats) add(other countryStats) {
+	s.Views += other.Views
+	s.Downloads += other.Downloads
+	s.PreviousViews += other.PreviousViews
+	s.PreviousDownloads += other.PreviousDownloads
+}
+
+func (s *countryStats) computeGrowth() {
+	previous := s.PreviousViews + s.PreviousDownloads
+	if previous == 0 {
+		s.Growth = nil
+		return
+	}
+	growth := float64(s.Views+s.Downloads-previous) / float64(previous)
+	s.Growth = &growth
+}
+
+// GetPublisherAnalyticsHandler returns where a publisher's marketplace views and downloads come from:
+// the top countries of the period (from/to as YYYY-MM-DD, last 30 days by default) and their growth
+// over the period before it. Pass model_id for one listing and limit for the number of countries.
+// Countries with fewer events than GEOIP_MIN_COUNTRY_COUNT are grouped as "other".
+func GetPublisherAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	from, to, err := parseLedgerRange(r)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	listingID := 0
+	if raw := r.URL.Query().Get("model_id"); raw != "" {
+		if listingID, err = strconv.Atoi(raw); err != nil || listingID <= 0 {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+			return
+		}
+	}
+	limit := 10
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > 250 {
+			apierrors.Respond(w, http.StatusBadRequest, "limit must be between 1 and 250")
+			return
+		}
+	}
+
+	rows, err := repository.GetPublisherCountryStats(r.Context(), userID, listingID, from, to)
+	if err != nil {
+		log.Printf("❌ Failed to get analytics for publisher %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve analytics")
+		return
+	}
+
+	minCount := geoIPMinCountryCount()
+	var total countryStats
+	other := countryStats{Country: analyticsCountryOther}
+	countries := []countryStats{}
+	for _, row := range rows {
+		stats := countryStats{
+			Country:           getStringField(row, "country", ""),
+			Views:             getIntField(row, "views", 0),
+			Downloads:         getIntField(row, "downloads", 0),
+			PreviousViews:     getIntField(row, "previous_views", 0),
+			PreviousDownloads: getIntField(row, "previous_downloads", 0),
+		}
+		total.add(stats)
+		switch {
+		case stats.Country == "":
+			stats.Country = analyticsCountryUnknown
+			countries = append(countries, stats)
+		case stats.Views+stats.Downloads < minCount:
+			other.add(stats)
+		default:
+			countries = append(countries, stats)
+		}
+	}
+
+	sort.Slice(countries, func(i, j int) bool {
+		a, b := countries[i].Views+countries[i].Downloads, countries[j].Views+countries[j].Downloads
+		if a != b {
+			return a > b
+		}
+		return countries[i].Country < countries[j].Country
+	})
+	if len(countries) > limit {
+		for _, stats := range countries[limit:] {
+			other.add(stats)
+		}
+		countries = countries[:limit]
+	}
+	if other.Views+other.Downloads+other.PreviousViews+other.PreviousDownloads > 0 {
+		countries = append(countries, other)
+	}
+	for i := range countries {
+		countries[i].computeGrowth()
+	}
+	total.computeGrowth()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":            true,
+		"from":               from,
+		"to":                 to,
+		"views":              total.Views,
+		"downloads":          total.Downloads,
+		"previous_views":     total.PreviousViews,
+		"previous_downloads": total.PreviousDownloads,
+		"growth":             total.Growth,
+		"countries":          countries,
+		"geo_enabled":        geoIPEnabled(),
+		"min_country_count":  minCount,
+	})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/internal/middlewares"
+)
+
+// Token bucket limiters of the abuse-prone endpoints, configured with RATE_LIMIT_<NAME>_PER_MINUTE
+// (the refill rate) and RATE_LIMIT_<NAME>_BURST
+var (
+	authLimiter = middlewares.NewTokenBucketLimiter("auth",
+		envInt("RATE_LIMIT_AUTH_PER_MINUTE", 10), envInt("RATE_LIMIT_AUTH_BURST", 20))
+	trainingLimiter = middlewares.NewTokenBucketLimiter("training",
+		envInt("RATE_LIMIT_TRAINING_PER_MINUTE", 6), envInt("RATE_LIMIT_TRAINING_BURST", 10))
+	communityLimiter = middlewares.NewTokenBucketLimiter("community",
+		envInt("RATE_LIMIT_COMMUNITY_PER_MINUTE", 120), envInt("RATE_LIMIT_COMMUNITY_BURST", 60))
+)
+
+// AuthRateLimit limits login, registration, token and password requests per client IP and API key
+var AuthRateLimit = authLimiter.Middleware(rateLimitKeys)
+
+// TrainingRateLimit limits training starts per client IP and user. It must run after JWTGuard.
+var TrainingRateLimit = trainingLimiter.Middleware(rateLimitKeys)
+
+// CommunityRateLimit limits marketplace requests per client IP and user. It must run after JWTGuard.
+var CommunityRateLimit = communityLimiter.Middleware(rateLimitKeys)
+
+// rateLimitKeys identifies the client IP of a request and, when known, its user or API key.
+// API keys are hashed so they are not kept in memory in clear.
+func rateLimitKeys(r *http.Request) []string {
+	keys := []string{"ip:" + clientAddress(r)}
+	if userID, ok := r.Context().Value(middlewares.UserIDKey).(int); ok {
+		return append(keys, "user:"+strconv.Itoa(userID))
+	}
+	apiKey := r.URL.Query().Get("api_key")
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		apiKey = strings.TrimPrefix(authHeader, "Bearer ")
+	}
+	if apiKey != "" {
+		sum := sha256.Sum256([]byte(apiKey))
+		keys = append(keys, "key:"+hex.EncodeToString(sum[:8]))
+	}
+	return keys
+}
+
+// GetRateLimitStatsHandler returns how many requests each rate limiter allowed and rejected
+// since the server started (admin only)
+func GetRateLimitStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"limiters": middlewares.GetRateLimitStats(),
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strconv"
 
+	"server/internal/apierrors"
 	"server/internal/middlewares"
 	"server/internal/repository"
 )
@@ -17,14 +18,14 @@ func ReadHandler(w http.ResponseWriter, r *http.Request) {
 
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "User ID not found")
 		return
 	}
 
-	modelsData, err := repository.GetModelsByUserID(r.Context(), userID)
+	modelsData, err := repository.GetModelsByUserID(r.Context(), userID, r.URL.Query().Get("tag"))
 	if err != nil {
 		log.Println("problem with getting response from db function", err)
-		http.Error(w, "failed to fetch models", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "failed to fetch models")
 		return
 	}
 
@@ -40,20 +41,20 @@ func DownloadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context for security
 	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "User ID not found")
 		return
 	}
 
 	// Get model ID from query parameter
 	modelIDStr := r.URL.Query().Get("model_id")
 	if modelIDStr == "" {
-		http.Error(w, "model_id parameter is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model_id parameter is required")
 		return
 	}
 
 	modelID, err := strconv.Atoi(modelIDStr)
 	if err != nil {
-		http.Error(w, "Invalid model_id", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model_id")
 		return
 	}
 
@@ -61,22 +62,27 @@ func DownloadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	model, err := repository.QueryRow(r.Context(), "SELECT id, user_id, name, trained_model_path FROM models WHERE id = $1", modelID)
 	if err != nil {
 		log.Printf("Error fetching model %d: %v", modelID, err)
-		http.Error(w, "Model not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "Model not found")
 		return
 	}
 
-	// Security check: ensure the model belongs to this user
-	modelUserID, ok := model["user_id"].(int32)
-	if !ok || int(modelUserID) != userID {
-		log.Printf("Security: User %d attempted to download model %d owned by user %d", userID, modelID, modelUserID)
-		http.Error(w, "You don't have permission to download this model", http.StatusForbidden)
+	// Security check: ensure the model belongs to this user or is shared with them
+	role, err := modelRole(r.Context(), model, userID)
+	if err != nil {
+		log.Printf("Error checking access of user %d to model %d: %v", userID, modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if role == "" {
+		log.Printf("Security: User %d attempted to download model %d owned by user %d", userID, modelID, getIntField(model, "user_id", 0))
+		apierrors.Respond(w, http.StatusForbidden, "You don't have permission to download this model")
 		return
 	}
 
 	// Check if trained model exists
 	trainedModelPath, ok := model["trained_model_path"].(string)
 	if !ok || trainedModelPath == "" {
-		http.Error(w, "This model hasn't been trained yet", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "This model hasn't been trained yet")
 		return
 	}
 
@@ -91,21 +97,21 @@ func DownloadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	absUploadsDir, err := filepath.Abs(uploadsDir)
 	if err != nil {
 		log.Printf("Error resolving uploads directory: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	absFullPath, err := filepath.Abs(fullPath)
 	if err != nil {
 		log.Printf("Error resolving file path: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	// Ensure the path is within uploads directory (prevent directory traversal)
 	if !filepath.HasPrefix(absFullPath, absUploadsDir) {
 		log.Printf("Security: Attempted path traversal: %s", trainedModelPath)
-		http.Error(w, "Invalid file path", http.StatusForbidden)
+		apierrors.Respond(w, http.StatusForbidden, "Invalid file path")
 		return
 	}
 
@@ -114,11 +120,11 @@ func DownloadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Printf("Trained model file not found: %s", absFullPath)
-			http.Error(w, "Trained model file not found", http.StatusNotFound)
+			apierrors.Respond(w, http.StatusNotFound, "Trained model file not found")
 			return
 		}
 		log.Printf("Error accessing file: %v", err)
-		http.Error(w, "Error accessing file", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Error accessing file")
 		return
 	}
 
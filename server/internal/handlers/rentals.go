@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// RentalReminderDaysEnv is how many days before a rental expires the renter is reminded to renew (default 3)
+const RentalReminderDaysEnv = "RENTAL_REMINDER_DAYS"
+
+// maxRentalDays bounds the rental period a publisher can offer
+const maxRentalDays = 365
+
+// validateRentalTerms checks the rental price and period of a listing. A rental price of 0 means the
+// listing is not rentable; rentals are only offered on paid listings and cost less than buying.
+func validateRentalTerms(price int, rentalPrice, rentalDays *int) error {
+	if rentalPrice != nil {
+		if *rentalPrice < 0 {
+			return fmt.Errorf("rental_price must be non-negative")
+		}
+		if *rentalPrice > 0 && price <= 0 {
+			return fmt.Errorf("free models cannot be rented")
+		}
+		if *rentalPrice >= price && *rentalPrice > 0 {
+			return fmt.Errorf("rental_price must be lower than the purchase price")
+		}
+	}
+	if rentalDays != nil && (*rentalDays < 1 || *rentalDays > maxRentalDays) {
+		return fmt.Errorf("rental_days must be between 1 and %d", maxRentalDays)
+	}
+	return nil
+}
+
+// StartRentalReminders reminds renters, once an hour, of rentals that expire within RENTAL_REMINDER_DAYS
+func StartRentalReminders() {
+	go func() {
+		for {
+			if err := sendRentalReminders(context.Background()); err != nil {
+				log.Printf("⚠️  Rental reminders failed: %v", err)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// sendRentalReminders notifies and emails each renter whose rental is about to expire, once per rental period
+func sendRentalReminders(ctx context.Context) error {
+	window := time.Duration(envInt(RentalReminderDaysEnv, 3)) * 24 * time.Hour
+	rentals, err := repository.GetRentalsToRemind(ctx, window)
+	if err != nil {
+		return err
+	}
+
+	for _, rental := range rentals {
+		listingID := getIntField(rental, "published_model_id", 0)
+		name := getStringField(rental, "name", fmt.Sprintf("Model #%d", listingID))
+		expiresAt, _ := rental["expires_at"].(time.Time)
+
+		message := fmt.Sprintf("Your rental of %s expires on %s.", name, expiresAt.Format("January 2, 2006"))
+		renewable := false
+		if active, _ := rental["is_active"].(bool); active && getIntField(rental, "rental_price", 0) > 0 {
+			renewable = true
+			message += fmt.Sprintf(" Renew it for $%.2f to keep access for %d more days.",
+				float64(getIntField(rental, "rental_price", 0))/100, getIntField(rental, "rental_days", 30))
+		}
+		notifyUser(ctx, getIntField(rental, "buyer_id", 0), Notification{
+			Type:    NotificationRentalExpiring,
+			Title:   fmt.Sprintf("Your rental of %s expires soon", name),
+			Message: message,
+			Link:    fmt.Sprintf("/community/models/%d?renew=1", listingID),
+			Data: map[string]interface{}{
+				"model_id":   listingID,
+				"expires_at": expiresAt,
+				"renewable":  renewable,
+			},
+		}, getStringField(rental, "email", ""), getStringField(rental, "username", ""))
+
+		if err := repository.MarkRentalReminded(ctx, getIntField(rental, "id", 0)); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+	if len(rentals) > 0 {
+		log.Printf("🔔 Sent %d rental expiry reminders", len(rentals))
+	}
+	return nil
+}
+
+// GetMyRentalsHandler lists the user's model rentals with their expiry
+func GetMyRentalsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	rentals, err := repository.GetUserRentals(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get rentals of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve rentals")
+		return
+	}
+	if rentals == nil {
+		rentals = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"rentals": rentals,
+	})
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"server/aiAgent"
+	"server/helpers"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	// maxSnapshotSourceSize is the largest script or config file whose content a run snapshot keeps;
+	// larger ones count as data
+	maxSnapshotSourceSize = 256 << 10
+	// maxSnapshotSources bounds the total content of the source files of a run snapshot
+	maxSnapshotSources = 2 << 20
+	// maxSnapshotDatasetFiles is the most data files a run snapshot lists one by one
+	maxSnapshotDatasetFiles = 2000
+)
+
+// snapshotSourceExtensions are the scripts and configs whose content is kept to diff runs
+var snapshotSourceExtensions = map[string]bool{
+	".py": true, ".ipynb": true, ".sh": true, ".r": true, ".jl": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".cfg": true, ".ini": true,
+}
+
+// snapshotOutputExtensions are trained models and logs a training writes, which are neither source nor data
+var snapshotOutputExtensions = map[string]bool{
+	".pt": true, ".pth": true, ".ckpt": true, ".h5": true, ".keras": true, ".onnx": true,
+	".safetensors": true, ".pb": true, ".tflite": true, ".joblib": true, ".log": true,
+}
+
+// snapshotOutputDirs are top-level folders trainings write outputs to
+var snapshotOutputDirs = map[string]bool{
+	"outputs": true, "output": true, "checkpoints": true, "runs": true, "logs": true,
+	"wandb": true, "mlruns": true, "lightning_logs": true,
+}
+
+// trainingHyperparameters flattens what a training is started with: "--lr 0.01" and "--lr=0.01"
+// become lr, flags without a value are "true", other arguments argN and environment variables env.NAME.
+// Hyperparameters given as such take precedence over arguments of the same name.
+func trainingHyperparameters(req aiAgent.TrainingRequest) map[string]string {
+	params := map[string]string{"script": req.ScriptName}
+	if req.ExecutionMode != "" {
+		params["execution_mode"] = req.ExecutionMode
+	}
+
+	isValue := func(arg string) bool {
+		if !strings.HasPrefix(arg, "-") {
+			return true
+		}
+		_, err := strconv.ParseFloat(arg, 64)
+		return err == nil
+	}
+	positional := 0
+	for i := 0; i < len(req.Args); i++ {
+		arg := req.Args[i]
+		name := strings.TrimLeft(arg, "-")
+		if isValue(arg) || name == "" {
+			params[fmt.Sprintf("arg%d", positional)] = arg
+			positional++
+			continue
+		}
+		if key, value, ok := strings.Cut(name, "="); ok {
+			params[key] = value
+			continue
+		}
+		if i+1 < len(req.Args) && isValue(req.Args[i+1]) {
+			params[name] = req.Args[i+1]
+			i++
+			continue
+		}
+		params[name] = "true"
+	}
+
+	for key, value := range req.Env {
+		if key != aiAgent.ProgressProtocolEnv && key != aiAgent.HyperparametersEnv {
+			params["env."+key] = value
+		}
+	}
+	for key, value := range req.Hyperparameters {
+		params[key] = aiAgent.FormatHyperparameter(value)
+	}
+	return params
+}
+
+// isSnapshotSource reports whether a model folder file is a script or config kept in run snapshots
+func isSnapshotSource(rel string, size int64) bool {
+	if size > maxSnapshotSourceSize {
+		return false
+	}
+	base := strings.ToLower(path.Base(rel))
+	if base == "dockerfile" || base == "makefile" || (strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt")) {
+		return true
+	}
+	return snapshotSourceExtensions[path.Ext(base)]
+}
+
+// isSnapshotOutput reports whether a model folder file was written by a training
+func isSnapshotOutput(rel string) bool {
+	top, _, nested := strings.Cut(rel, "/")
+	if nested && snapshotOutputDirs[strings.ToLower(top)] {
+		return true
+	}
+	return snapshotOutputExtensions[strings.ToLower(path.Ext(rel))]
+}
+
+// recordRunSnapshot records, in the background, the hyperparameters a training started with and
+// the source files and dataset of its model folder, if the folder is on the server
+func recordRunSnapshot(trainingID, folderName string, hyperparameters map[string]string) {
+	go func() {
+		sources := map[string]string{}
+		datasetFiles := map[string]string{}
+		datasetHash := ""
+
+		folder := filepath.Join(uploadsBaseDir(), folderName)
+		if info, err := os.Stat(folder); err == nil && info.IsDir() {
+			manifest, err := buildSyncManifest(folder)
+			if err != nil {
+				log.Printf("⚠️  Failed to list the model folder of training %s: %v", trainingID, err)
+			}
+			// The manifest is sorted by path, so the dataset hash only depends on the files
+			hash := sha256.New()
+			sourceBytes := 0
+			for _, entry := range manifest {
+				switch {
+				case isSnapshotSource(entry.Path, entry.Size) && sourceBytes+int(entry.Size) <= maxSnapshotSources:
+					content, err := os.ReadFile(filepath.Join(folder, filepath.FromSlash(entry.Path)))
+					if err != nil {
+						log.Printf("⚠️  Failed to read %s of training %s: %v", entry.Path, trainingID, err)
+						continue
+					}
+					sources[entry.Path] = string(content)
+					sourceBytes += len(content)
+				case isSnapshotSource(entry.Path, entry.Size), isSnapshotOutput(entry.Path):
+					// Sources past the snapshot's budget are left out rather than counted as data
+				default:
+					fmt.Fprintf(hash, "%s  %s\n", entry.SHA256, entry.Path)
+					datasetFiles[entry.Path] = entry.SHA256
+				}
+			}
+			if len(datasetFiles) > 0 {
+				datasetHash = hex.EncodeToString(hash.Sum(nil))
+			}
+		}
+		if len(datasetFiles) > maxSnapshotDatasetFiles {
+			datasetFiles = nil
+		}
+
+		if err := repository.SetTrainingRunSnapshot(context.Background(), trainingID, hyperparameters, sources, datasetFiles, datasetHash); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}()
+}
+
+// valueChange is a value that differs between two runs; nil on the side that lacks it
+type valueChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// mapDiff lists the keys added, removed and changed from one run to the other
+type mapDiff struct {
+	Added   map[string]interface{} `json:"added"`
+	Removed map[string]interface{} `json:"removed"`
+	Changed map[string]valueChange `json:"changed"`
+}
+
+func diffMaps(from, to map[string]interface{}) mapDiff {
+	diff := mapDiff{Added: map[string]interface{}{}, Removed: map[string]interface{}{}, Changed: map[string]valueChange{}}
+	for key, value := range from {
+		other, ok := to[key]
+		switch {
+		case !ok:
+			diff.Removed[key] = value
+		case fmt.Sprint(value) != fmt.Sprint(other):
+			diff.Changed[key] = valueChange{From: value, To: other}
+		}
+	}
+	for key, value := range to {
+		if _, ok := from[key]; !ok {
+			diff.Added[key] = value
+		}
+	}
+	return diff
+}
+
+// sourceFileDiff is a script or config that differs between two runs
+type sourceFileDiff struct {
+	Path string `json:"path"`
+	// Status is added, removed or modified
+	Status string `json:"status"`
+	Diff   string `json:"diff"`
+}
+
+func diffSourceFiles(from, to map[string]interface{}) []sourceFileDiff {
+	paths := map[string]bool{}
+	for p := range from {
+		paths[p] = true
+	}
+	for p := range to {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	diffs := []sourceFileDiff{}
+	for _, p := range sorted {
+		before, inFrom := from[p].(string)
+		after, inTo := to[p].(string)
+		if before == after && inFrom == inTo {
+			continue
+		}
+		status := "modified"
+		fromName, toName := "a/"+p, "b/"+p
+		switch {
+		case !inFrom:
+			status, fromName = "added", "/dev/null"
+		case !inTo:
+			status, toName = "removed", "/dev/null"
+		}
+		diffs = append(diffs, sourceFileDiff{Path: p, Status: status, Diff: helpers.UnifiedDiff(fromName, toName, before, after)})
+	}
+	return diffs
+}
+
+// datasetDiff compares the data files two runs trained on
+type datasetDiff struct {
+	FromHash string `json:"from_hash"`
+	ToHash   string `json:"to_hash"`
+	Changed  bool   `json:"changed"`
+	// FilesCompared is false when a run has too many data files to list which ones changed
+	FilesCompared bool     `json:"files_compared"`
+	Added         []string `json:"added,omitempty"`
+	Removed       []string `json:"removed,omitempty"`
+	Modified      []string `json:"modified,omitempty"`
+}
+
+func diffDatasets(from, to map[string]interface{}) datasetDiff {
+	diff := datasetDiff{
+		FromHash: strings.TrimSpace(getStringField(from, "dataset_hash", "")),
+		ToHash:   strings.TrimSpace(getStringField(to, "dataset_hash", "")),
+	}
+	diff.Changed = diff.FromHash != diff.ToHash
+	fromFiles, fromListed := from["dataset_files"].(map[string]interface{})
+	toFiles, toListed := to["dataset_files"].(map[string]interface{})
+	if !diff.Changed || !fromListed || !toListed {
+		return diff
+	}
+
+	diff.FilesCompared = true
+	files := diffMaps(fromFiles, toFiles)
+	for p := range files.Added {
+		diff.Added = append(diff.Added, p)
+	}
+	for p := range files.Removed {
+		diff.Removed = append(diff.Removed, p)
+	}
+	for p := range files.Changed {
+		diff.Modified = append(diff.Modified, p)
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+	return diff
+}
+
+// environmentDiff compares the environments captured for two runs
+type environmentDiff struct {
+	// Captured tells for each run whether its environment was captured; nothing is compared otherwise
+	Captured map[string]bool        `json:"captured"`
+	Changed  map[string]valueChange `json:"changed"`
+	Packages mapDiff                `json:"packages"`
+}
+
+// environmentPackages maps the pip freeze entries of a run by lowercase package name
+func environmentPackages(run map[string]interface{}) map[string]interface{} {
+	packages := map[string]interface{}{}
+	entries, _ := run["packages"].([]interface{})
+	for _, entry := range entries {
+		requirement, ok := entry.(string)
+		if !ok {
+			continue
+		}
+		name, version, found := strings.Cut(requirement, "==")
+		if !found {
+			name, version, _ = strings.Cut(requirement, " @ ")
+		}
+		packages[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(version)
+	}
+	return packages
+}
+
+func diffEnvironments(from, to map[string]interface{}) environmentDiff {
+	_, fromCaptured := from["environment_captured_at"].(time.Time)
+	_, toCaptured := to["environment_captured_at"].(time.Time)
+	diff := environmentDiff{
+		Captured: map[string]bool{"from": fromCaptured, "to": toCaptured},
+		Changed:  map[string]valueChange{},
+		Packages: mapDiff{Added: map[string]interface{}{}, Removed: map[string]interface{}{}, Changed: map[string]valueChange{}},
+	}
+	if !fromCaptured || !toCaptured {
+		return diff
+	}
+	for _, field := range []string{"python_version", "cuda_version", "platform"} {
+		if before, after := from[field], to[field]; before != after {
+			diff.Changed[field] = valueChange{From: before, To: after}
+		}
+	}
+	diff.Packages = diffMaps(environmentPackages(from), environmentPackages(to))
+	return diff
+}
+
+// metricDelta is a final metric of two runs and how much it moved
+type metricDelta struct {
+	From  *float64 `json:"from"`
+	To    *float64 `json:"to"`
+	Delta *float64 `json:"delta,omitempty"`
+	// Percent is the delta relative to the first run's value
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+// finalMetrics returns the last reported value of each metric of a run
+func finalMetrics(run map[string]interface{}) map[string]float64 {
+	metrics := map[string]float64{}
+	for _, name := range []string{"train_loss", "val_loss", "train_accuracy", "val_accuracy", "test_accuracy"} {
+		if value, ok := run[name].(float64); ok {
+			metrics[name] = value
+		}
+	}
+	custom, _ := run["custom_metrics"].(map[string]interface{})
+	for name, value := range custom {
+		if number, ok := value.(float64); ok {
+			if _, taken := metrics[name]; !taken {
+				metrics[name] = number
+			}
+		}
+	}
+	return metrics
+}
+
+func diffMetrics(from, to map[string]interface{}) map[string]metricDelta {
+	before, after := finalMetrics(from), finalMetrics(to)
+	deltas := map[string]metricDelta{}
+	for name, value := range before {
+		deltas[name] = metricDelta{From: &value}
+	}
+	for name, value := range after {
+		delta := deltas[name]
+		delta.To = &value
+		if delta.From != nil {
+			change := value - *delta.From
+			delta.Delta = &change
+			if *delta.From != 0 {
+				percent := change / *delta.From * 100
+				delta.Percent = &percent
+			}
+		}
+		deltas[name] = delta
+	}
+	return deltas
+}
+
+// runDiffSummary identifies one side of a diff
+func runDiffSummary(run map[string]interface{}) map[string]interface{} {
+	summary := map[string]interface{}{}
+	for _, field := range []string{"training_id", "model_id", "model_name", "training_type", "started_at", "ended_at", "epochs"} {
+		summary[field] = run[field]
+	}
+	summary["snapshot_captured"] = run["source_files"] != nil
+	return summary
+}
+
+// GetTrainingRunDiffHandler compares two trainings the user ran or that ran on their models: the
+// hyperparameters, scripts and data they started with, their environments and final metrics
+func GetTrainingRunDiffHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	fromID, toID := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if fromID == "" || toID == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "from and to are required")
+		return
+	}
+
+	runs := make([]map[string]interface{}, 2)
+	for i, trainingID := range []string{fromID, toID} {
+		run, err := repository.GetTrainingRunForDiff(r.Context(), trainingID, userID)
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, fmt.Sprintf("Training %s not found", trainingID))
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Failed to get training %s: %v", trainingID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve training")
+			return
+		}
+		runs[i] = run
+	}
+	from, to := runs[0], runs[1]
+
+	settings := map[string]valueChange{}
+	for _, field := range []string{"model_name", "training_type", "execution_mode", "hardware_tier", "network_mode"} {
+		if before, after := from[field], to[field]; before != after {
+			settings[field] = valueChange{From: before, To: after}
+		}
+	}
+	fromParams, _ := from["hyperparameters"].(map[string]interface{})
+	toParams, _ := to["hyperparameters"].(map[string]interface{})
+	fromSources, _ := from["source_files"].(map[string]interface{})
+	toSources, _ := to["source_files"].(map[string]interface{})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"from":            runDiffSummary(from),
+		"to":              runDiffSummary(to),
+		"settings":        settings,
+		"hyperparameters": diffMaps(fromParams, toParams),
+		"source_files":    diffSourceFiles(fromSources, toSources),
+		"dataset":         diffDatasets(from, to),
+		"environment":     diffEnvironments(from, to),
+		"metrics":         diffMetrics(from, to),
+	})
+}
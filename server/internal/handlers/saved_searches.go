@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// SavedSearchAlertIntervalEnv is how often, in minutes, saved searches are checked against new listings (default 60)
+const SavedSearchAlertIntervalEnv = "SAVED_SEARCH_ALERT_INTERVAL_MINUTES"
+
+const (
+	maxSavedSearches     = 20
+	maxSearchQueryLength = 200
+	maxSearchTags        = 10
+	// maxAlertListings is how many matching listings an alert names
+	maxAlertListings = 3
+)
+
+// marketplaceFilter is a marketplace search: the listings matching every set criterion
+type marketplaceFilter struct {
+	Query       string   `json:"q,omitempty"` // Every word must appear in the name, descriptions or tags
+	ListingType string   `json:"listing_type,omitempty"`
+	Category    string   `json:"category,omitempty"`
+	ModelType   string   `json:"model_type,omitempty"`
+	Framework   string   `json:"framework,omitempty"`
+	LicenseType string   `json:"license_type,omitempty"`
+	Tags        []string `json:"tags,omitempty"` // The listing must have every tag
+	MaxPrice    *int     `json:"max_price,omitempty"`
+	MinRating   *float64 `json:"min_rating,omitempty"`
+	MinAccuracy *float64 `json:"min_accuracy,omitempty"`
+}
+
+// parseMarketplaceFilter reads a marketplace search from the query parameters
+// q, listing_type, category, model_type, framework, license_type, tags (comma separated),
+// max_price, min_rating and min_accuracy
+func parseMarketplaceFilter(r *http.Request) (marketplaceFilter, error) {
+	query := r.URL.Query()
+	filter := marketplaceFilter{
+		Query:       query.Get("q"),
+		ListingType: query.Get("listing_type"),
+		Category:    query.Get("category"),
+		ModelType:   query.Get("model_type"),
+		Framework:   query.Get("framework"),
+		LicenseType: query.Get("license_type"),
+	}
+	for _, tag := range strings.Split(query.Get("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+	if raw := query.Get("max_price"); raw != "" {
+		price, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, fmt.Errorf("max_price must be an integer number of cents")
+		}
+		filter.MaxPrice = &price
+	}
+	for name, target := range map[string]**float64{"min_rating": &filter.MinRating, "min_accuracy": &filter.MinAccuracy} {
+		if raw := query.Get(name); raw != "" {
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be a number", name)
+			}
+			*target = &v
+		}
+	}
+	return filter, filter.validate()
+}
+
+// validate checks the filter's values are in range
+func (f marketplaceFilter) validate() error {
+	if len(f.Query) > maxSearchQueryLength {
+		return fmt.Errorf("q must be at most %d characters", maxSearchQueryLength)
+	}
+	if f.ListingType != "" && !listingTypes[f.ListingType] {
+		return fmt.Errorf(invalidListingTypeMessage)
+	}
+	if len(f.Tags) > maxSearchTags {
+		return fmt.Errorf("at most %d tags can be searched", maxSearchTags)
+	}
+	if f.MaxPrice != nil && *f.MaxPrice < 0 {
+		return fmt.Errorf("max_price must be non-negative")
+	}
+	if f.MinRating != nil && (*f.MinRating < 0 || *f.MinRating > 5) {
+		return fmt.Errorf("min_rating must be between 0 and 5")
+	}
+	if f.MinAccuracy != nil && (*f.MinAccuracy < 0 || *f.MinAccuracy > 100) {
+		return fmt.Errorf("min_accuracy must be between 0 and 100")
+	}
+	return nil
+}
+
+// empty reports whether the filter matches every listing
+func (f marketplaceFilter) empty() bool {
+	return strings.TrimSpace(f.Query) == "" && f.ListingType == "" && f.Category == "" && f.ModelType == "" &&
+		f.Framework == "" && f.LicenseType == "" && len(f.Tags) == 0 &&
+		f.MaxPrice == nil && f.MinRating == nil && f.MinAccuracy == nil
+}
+
+// listingTags returns a listing's tags lowercased
+func listingTags(listing map[string]interface{}) []string {
+	var tags []string
+	switch v := listing["tags"].(type) {
+	case []string:
+		tags = v
+	case []interface{}:
+		for _, tag := range v {
+			if s, ok := tag.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+	}
+	for i, tag := range tags {
+		tags[i] = strings.ToLower(tag)
+	}
+	return tags
+}
+
+// getFloatField reads a numeric field of a row, including DECIMAL columns
+func getFloatField(m map[string]interface{}, key string, def float64) float64 {
+	switch v := m[key].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case pgtype.Numeric:
+		if f, err := v.Float64Value(); err == nil && f.Valid {
+			return f.Float64
+		}
+	}
+	return def
+}
+
+// matches reports whether a listing matches every criterion of the filter
+func (f marketplaceFilter) matches(listing map[string]interface{}) bool {
+	equal := func(want, field string) bool {
+		return want == "" || strings.EqualFold(want, getStringField(listing, field, ""))
+	}
+	if !equal(f.ListingType, "listing_type") || !equal(f.Category, "category") || !equal(f.ModelType, "model_type") ||
+		!equal(f.Framework, "framework") || !equal(f.LicenseType, "license_type") {
+		return false
+	}
+	if f.MaxPrice != nil && getIntField(listing, "price", 0) > *f.MaxPrice {
+		return false
+	}
+	if f.MinRating != nil && getFloatField(listing, "rating_average", 0) < *f.MinRating {
+		return false
+	}
+	if f.MinAccuracy != nil && getFloatField(listing, "accuracy_score", 0) < *f.MinAccuracy {
+		return false
+	}
+
+	tags := listingTags(listing)
+	for _, want := range f.Tags {
+		found := false
+		for _, tag := range tags {
+			if tag == strings.ToLower(want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if words := strings.Fields(strings.ToLower(f.Query)); len(words) > 0 {
+		text := strings.ToLower(strings.Join(append([]string{
+			getStringField(listing, "name", ""),
+			getStringField(listing, "description", ""),
+			getStringField(listing, "short_description", ""),
+		}, tags...), " "))
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// apply returns the listings matching the filter
+func (f marketplaceFilter) apply(listings []map[string]interface{}) []map[string]interface{} {
+	if f.empty() {
+		return listings
+	}
+	matching := make([]map[string]interface{}, 0, len(listings))
+	for _, listing := range listings {
+		if f.matches(listing) {
+			matching = append(matching, listing)
+		}
+	}
+	return matching
+}
+
+// decodeSavedFilter reads the filters column of a saved search
+func decodeSavedFilter(raw interface{}) (marketplaceFilter, error) {
+	var filter marketplaceFilter
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return filter, err
+	}
+	err = json.Unmarshal(data, &filter)
+	return filter, err
+}
+
+// StartSavedSearchAlerts checks saved searches with alerts against newly published listings
+// every SAVED_SEARCH_ALERT_INTERVAL_MINUTES
+func StartSavedSearchAlerts() {
+	interval := time.Duration(envInt(SavedSearchAlertIntervalEnv, 60)) * time.Minute
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := runSavedSearchAlerts(context.Background()); err != nil {
+				log.Printf("⚠️  Saved search alerts failed: %v", err)
+			}
+		}
+	}()
+}
+
+// runSavedSearchAlerts notifies the owners of saved searches matching listings published since
+// their last check. Users are not alerted about their own listings.
+func runSavedSearchAlerts(ctx context.Context) error {
+	checkpoint, err := repository.SavedSearchCheckpoint(ctx)
+	if err != nil {
+		return err
+	}
+	searches, err := repository.GetAlertingSavedSearches(ctx)
+	if err != nil {
+		return err
+	}
+	if len(searches) == 0 {
+		return nil
+	}
+
+	after := checkpoint
+	searchIDs := make([]int, 0, len(searches))
+	for _, search := range searches {
+		searchIDs = append(searchIDs, getIntField(search, "id", 0))
+		if checked, ok := search["last_checked_at"].(time.Time); ok && checked.Before(after) {
+			after = checked
+		}
+	}
+	listings, err := repository.GetPublishedModelsBetween(ctx, after, checkpoint)
+	if err != nil {
+		return err
+	}
+
+	alerts := 0
+	for _, search := range searches {
+		searchID := getIntField(search, "id", 0)
+		filter, err := decodeSavedFilter(search["filters"])
+		if err != nil {
+			log.Printf("⚠️  Invalid filters in saved search %d: %v", searchID, err)
+			continue
+		}
+		checked, _ := search["last_checked_at"].(time.Time)
+		userID := getIntField(search, "user_id", 0)
+
+		var matches []map[string]interface{}
+		for _, listing := range listings {
+			publishedAt, _ := listing["published_at"].(time.Time)
+			if !publishedAt.After(checked) || getIntField(listing, "publisher_id", 0) == userID {
+				continue
+			}
+			if filter.matches(listing) {
+				matches = append(matches, listing)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		emailTo := ""
+		if wantsEmail, _ := search["email_alerts"].(bool); wantsEmail {
+			emailTo = getStringField(search, "email", "")
+		}
+		notifyUser(ctx, userID, savedSearchNotification(searchID, getStringField(search, "name", ""), matches), emailTo, getStringField(search, "username", ""))
+		if err := repository.MarkSavedSearchAlerted(ctx, searchID); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+		alerts++
+	}
+
+	if err := repository.MarkSavedSearchesChecked(ctx, searchIDs, checkpoint); err != nil {
+		return err
+	}
+	if alerts > 0 {
+		log.Printf("🔔 Sent %d saved search alerts for %d new listings", alerts, len(listings))
+	}
+	return nil
+}
+
+// savedSearchNotification describes the new listings matching a saved search
+func savedSearchNotification(searchID int, name string, matches []map[string]interface{}) Notification {
+	modelIDs := make([]int, len(matches))
+	names := make([]string, 0, maxAlertListings)
+	for i, listing := range matches {
+		modelIDs[i] = getIntField(listing, "id", 0)
+		if i < maxAlertListings {
+			names = append(names, getStringField(listing, "name", fmt.Sprintf("Model #%d", modelIDs[i])))
+		}
+	}
+
+	message := strings.Join(names, ", ")
+	if len(matches) > maxAlertListings {
+		message += fmt.Sprintf(" and %d more", len(matches)-maxAlertListings)
+	}
+	title := fmt.Sprintf("New model matching \"%s\"", name)
+	link := fmt.Sprintf("/community/models/%d", modelIDs[0])
+	if len(matches) > 1 {
+		title = fmt.Sprintf("%d new models matching \"%s\"", len(matches), name)
+		link = fmt.Sprintf("/community?saved_search=%d", searchID)
+	}
+	return Notification{
+		Type:    NotificationSavedSearchMatch,
+		Title:   title,
+		Message: message + ".",
+		Link:    link,
+		Data:    map[string]interface{}{"saved_search_id": searchID, "model_ids": modelIDs},
+	}
+}
+
+// CreateSavedSearchHandler saves a marketplace search.
+// Body: {"name": "...", "filters": {"q": "...", "category": "...", ...}, "alerts_enabled": true, "email_alerts": false}
+func CreateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	req := struct {
+		Name          string            `json:"name"`
+		Filters       marketplaceFilter `json:"filters"`
+		AlertsEnabled *bool             `json:"alerts_enabled"`
+		EmailAlerts   bool              `json:"email_alerts"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		apierrors.Respond(w, http.StatusBadRequest, "name is required and must be at most 100 characters")
+		return
+	}
+	if err := req.Filters.validate(); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Filters.empty() {
+		apierrors.Respond(w, http.StatusBadRequest, "filters must set at least one criterion")
+		return
+	}
+	alertsEnabled := req.AlertsEnabled == nil || *req.AlertsEnabled
+
+	count, err := repository.CountSavedSearches(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to count saved searches of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save search")
+		return
+	}
+	if count >= maxSavedSearches {
+		apierrors.Respond(w, http.StatusConflict, fmt.Sprintf("You can save at most %d searches", maxSavedSearches))
+		return
+	}
+
+	id, err := repository.CreateSavedSearch(r.Context(), userID, req.Name, req.Filters, alertsEnabled, req.EmailAlerts)
+	if err != nil {
+		log.Printf("❌ Failed to save search for user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save search")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      id,
+	})
+}
+
+// GetSavedSearchesHandler lists the user's saved searches
+func GetSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	searches, err := repository.GetSavedSearches(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get saved searches of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve saved searches")
+		return
+	}
+	if searches == nil {
+		searches = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"saved_searches": searches,
+	})
+}
+
+// UpdateSavedSearchHandler changes a saved search's name, filters or alert preferences
+func UpdateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	searchID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid saved search ID")
+		return
+	}
+
+	var req struct {
+		Name          *string            `json:"name"`
+		Filters       *marketplaceFilter `json:"filters"`
+		AlertsEnabled *bool              `json:"alerts_enabled"`
+		EmailAlerts   *bool              `json:"email_alerts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			apierrors.Respond(w, http.StatusBadRequest, "name must be between 1 and 100 characters")
+			return
+		}
+		req.Name = &name
+	}
+	var filters interface{}
+	if req.Filters != nil {
+		if err := req.Filters.validate(); err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Filters.empty() {
+			apierrors.Respond(w, http.StatusBadRequest, "filters must set at least one criterion")
+			return
+		}
+		filters = req.Filters
+	}
+
+	updated, err := repository.UpdateSavedSearch(r.Context(), userID, searchID, req.Name, filters, req.AlertsEnabled, req.EmailAlerts)
+	if err != nil {
+		log.Printf("❌ Failed to update saved search %d: %v", searchID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update saved search")
+		return
+	}
+	if !updated {
+		apierrors.Respond(w, http.StatusNotFound, "Saved search not found")
+		return
+	}
+
+	search, err := repository.GetSavedSearch(r.Context(), userID, searchID)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Printf("⚠️  Failed to reload saved search %d: %v", searchID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"saved_search": search,
+	})
+}
+
+// DeleteSavedSearchHandler deletes a saved search
+func DeleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	searchID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid saved search ID")
+		return
+	}
+
+	deleted, err := repository.DeleteSavedSearch(r.Context(), userID, searchID)
+	if err != nil {
+		log.Printf("❌ Failed to delete saved search %d: %v", searchID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to delete saved search")
+		return
+	}
+	if !deleted {
+		apierrors.Respond(w, http.StatusNotFound, "Saved search not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
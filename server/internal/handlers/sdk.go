@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+)
+
+// PythonSDKPath is the directory holding the Python progress reporting package
+const PythonSDKPath = "./sdk/python"
+
+// pythonSDKArchiveRoot is the top-level directory inside the pip-installable zip
+const pythonSDKArchiveRoot = "aimanage-progress"
+
+// maxValidateOutputSize limits how much script output can be validated at once
+const maxValidateOutputSize = 5 << 20 // 5 MB
+
+// PythonSDKArchiveHandler serves the Python SDK as a zip that pip can install directly
+func PythonSDKArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := os.Stat(filepath.Join(PythonSDKPath, "pyproject.toml")); err != nil {
+		log.Printf("❌ Python SDK not found at %s: %v", PythonSDKPath, err)
+		apierrors.Respond(w, http.StatusNotFound, "Python SDK not available")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="aimanage-progress.zip"`)
+
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(PythonSDKPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "__pycache__" || strings.HasSuffix(d.Name(), ".egg-info") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(PythonSDKPath, path)
+		if err != nil {
+			return err
+		}
+		dst, err := zw.Create(pythonSDKArchiveRoot + "/" + filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		log.Printf("❌ Failed to build Python SDK archive: %v", err)
+	}
+	zw.Close()
+}
+
+// ValidateTrainingOutputHandler validates PROGRESS, CHECKPOINT and ARTIFACT lines
+// from a dry run of a training script against the schema the server parses
+func ValidateTrainingOutputHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Output string   `json:"output"`
+		Lines  []string `json:"lines"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxValidateOutputSize)).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	output := req.Output
+	if len(req.Lines) > 0 {
+		output = strings.Join(req.Lines, "\n")
+	}
+	if strings.TrimSpace(output) == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "output or lines is required")
+		return
+	}
+
+	results, summary := aiAgent.ValidateReportOutput(output)
+	if results == nil {
+		results = []aiAgent.ReportLineResult{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"summary": summary,
+		"lines":   results,
+	})
+}
+
+// GetProgressSchemaHandler returns the JSON schemas of every supported PROGRESS protocol version
+func GetProgressSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"latest_version": aiAgent.LatestProgressProtocol,
+		"env_var":        aiAgent.ProgressProtocolEnv,
+		"schemas":        aiAgent.ProgressSchemas(),
+	})
+}
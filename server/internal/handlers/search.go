@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// SearchPublishedModelsHandler searches the marketplace by keyword with PostgreSQL full-text
+// search, best matches first. q is required and accepts quoted phrases, "or" and -excluded words;
+// the other marketplace filters (see parseMarketplaceFilter) narrow the results down.
+func SearchPublishedModelsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseMarketplaceFilter(r)
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query := strings.TrimSpace(filter.Query)
+	if query == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	viewerID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	page, pageSize := parsePagination(r)
+	results, total, err := repository.SearchPublishedModels(r.Context(), query, repository.ListingSearchFilters{
+		ListingType: filter.ListingType,
+		Category:    filter.Category,
+		ModelType:   filter.ModelType,
+		Framework:   filter.Framework,
+		LicenseType: filter.LicenseType,
+		Tags:        filter.Tags,
+		MaxPrice:    filter.MaxPrice,
+		MinRating:   filter.MinRating,
+		MinAccuracy: filter.MinAccuracy,
+	}, viewerID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to search published models for %q: %v", query, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to search published models")
+		return
+	}
+	if results == nil {
+		results = []map[string]interface{}{}
+	}
+
+	localizeListings(w, r, results)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"query":     query,
+		"results":   results,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+const (
+	defaultDashboardSearchLimit = 20
+	maxDashboardSearchLimit     = 50
+)
+
+// DashboardSearchHandler is the quick switcher of the dashboard: it searches the user's own
+// models, training runs and published listings for q and returns typed results, best first
+func DashboardSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len(query) > maxSearchQueryLength {
+		apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("q must be at most %d characters", maxSearchQueryLength))
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultDashboardSearchLimit
+	}
+	if limit > maxDashboardSearchLimit {
+		limit = maxDashboardSearchLimit
+	}
+
+	results, err := repository.SearchUserWorkspace(r.Context(), userID, query, limit)
+	if err != nil {
+		log.Printf("❌ Failed to search the workspace of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to search")
+		return
+	}
+	if results == nil {
+		results = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"query":   query,
+		"results": results,
+	})
+}
@@ -1,53 +1,257 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"server/helpers"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
 	"server/internal/repository"
 )
 
+// refreshTokenLifetime is how long a refresh token can be exchanged for a new JWT
+const refreshTokenLifetime = 30 * 24 * time.Hour
+
+// maxSessionUserAgent is how many bytes of the User-Agent of a sign-in are kept
+const maxSessionUserAgent = 512
+
+// startSession opens a session for a user signing in, recording the device's user agent and IP,
+// and returns its access and refresh tokens. The access token names the session so that revoking
+// the session rejects it right away.
+func startSession(r *http.Request, userID int, email string) (token, refreshToken string, err error) {
+	refreshToken, err = helpers.GenerateRandomString(64)
+	if err != nil {
+		return "", "", err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxSessionUserAgent {
+		userAgent = userAgent[:maxSessionUserAgent]
+	}
+	ipAddress := ""
+	if ip := clientIP(r); ip != nil {
+		ipAddress = ip.String()
+	}
+
+	sessionID, err := repository.StartSession(r.Context(), userID, email, refreshToken, time.Now().Add(refreshTokenLifetime), userAgent, ipAddress)
+	if err != nil {
+		return "", "", err
+	}
+	token, err = helpers.GenerateSessionJWT(email, userID, sessionID)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// IsSessionActive reports whether a user's sign-in session still exists, for RejectRevokedSessions
+func IsSessionActive(ctx context.Context, userID int, sessionID string) (bool, error) {
+	return repository.IsSessionActive(ctx, userID, sessionID)
+}
+
+// setRefreshTokenCookie stores the refresh token in an HttpOnly cookie; an empty token clears it
+func setRefreshTokenCookie(w http.ResponseWriter, token string) {
+	maxAge := int(refreshTokenLifetime.Seconds())
+	if token == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   maxAge,
+	})
+}
+
+// requestRefreshToken returns the refresh token of the refresh_token cookie, or of the
+// {"refresh_token": ...} body sent by clients that do not keep cookies
+func requestRefreshToken(r *http.Request) string {
+	if cookie, err := r.Cookie("refresh_token"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	return body.RefreshToken
+}
+
+// RefreshHandler exchanges a refresh token for a new JWT. Refresh tokens are single use: the
+// response carries a new refresh token (also set as cookie) and the old one stops working.
+// Presenting a token that was already exchanged revokes every session descending from it.
 func RefreshHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("refresh_token")
+	refreshToken := requestRefreshToken(r)
+	if refreshToken == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	newRefreshToken, err := helpers.GenerateRandomString(64)
 	if err != nil {
-		http.Error(w, "Couldn't get the cookie", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusInternalServerError, "Couldn't generate refresh token")
 		return
 	}
 
-	session, err := repository.GetSessionByRefreshToken(r.Context(), cookie.Value)
+	session, err := repository.RotateSession(r.Context(), refreshToken, newRefreshToken, time.Now().Add(refreshTokenLifetime))
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		log.Printf("🔑 Refresh token reuse detected for user %v, revoked the session", session["user_id"])
+		setRefreshTokenCookie(w, "")
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
 	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		log.Printf("❌ Failed to rotate session: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "DB error")
 		return
 	}
 	if session == nil {
-		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
+
+	email, _ := session["email"].(string)
+	userID, _ := session["user_id"].(int)
+	familyID, _ := session["family_id"].(string)
+	newAccessToken, err := helpers.GenerateSessionJWT(email, userID, familyID)
+	if err != nil {
+		apierrors.Respond(w, http.StatusInternalServerError, "Couldn't generate token")
+		return
+	}
+
+	setRefreshTokenCookie(w, newRefreshToken)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":         newAccessToken,
+		"refresh_token": newRefreshToken,
+	})
+	log.Println("Refresh token sent successfully")
+}
+
+// LogoutHandler deletes the session of the refresh token and clears its cookie. Signing out an
+// unknown or already deleted session succeeds too.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if refreshToken := requestRefreshToken(r); refreshToken != "" {
+		if _, err := repository.DeleteSession(r.Context(), refreshToken); err != nil {
+			log.Printf("❌ Failed to delete session: %v", err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
+	setRefreshTokenCookie(w, "")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// GetSessionsHandler lists the user's active sessions with when they were signed in and last
+// refreshed, when they expire and the user agent and IP they were signed in from. The session of
+// the request's token is marked "current".
+func GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
+	currentID, _ := r.Context().Value(middlewares.SessionIDKey).(string)
+
+	sessions, err := repository.GetUserSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get sessions of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve sessions")
+		return
+	}
+	if sessions == nil {
+		sessions = []map[string]interface{}{}
+	}
+	for _, session := range sessions {
+		session["current"] = currentID != "" && session["id"] == currentID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"sessions": sessions,
+	})
+}
 
-	// Get email and user_id from session
-	email, ok := (*session)["email"].(string)
+// RevokeSessionHandler signs the user out of one of their sessions. Its refresh token stops
+// working and its access tokens are rejected immediately.
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Invalid session data", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	sessionID := chi.URLParam(r, "sessionId")
+
+	revoked, err := repository.RevokeUserSession(r.Context(), userID, sessionID)
+	if err != nil {
+		log.Printf("❌ Failed to revoke session %s: %v", sessionID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to revoke session")
 		return
 	}
+	if !revoked {
+		apierrors.Respond(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	log.Printf("🔑 User %d revoked session %s", userID, sessionID)
+	recordAudit(r, AuditSessionRevoked, AuditTargetSession, sessionID, nil)
 
-	userID, ok := (*session)["user_id"].(int32)
+	if currentID, _ := r.Context().Value(middlewares.SessionIDKey).(string); currentID == sessionID {
+		setRefreshTokenCookie(w, "")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Session revoked",
+	})
+}
+
+// RevokeAllSessionsHandler logs the user out everywhere by revoking all their sessions, or all
+// but the current one with ?keep_current=true
+func RevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Invalid session data", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
+	keepID := ""
+	if r.URL.Query().Get("keep_current") == "true" {
+		keepID, _ = r.Context().Value(middlewares.SessionIDKey).(string)
+	}
 
-	newAccessToken, err := helpers.GenerateJWT(email, int(userID))
+	revoked, err := repository.RevokeUserSessions(r.Context(), userID, keepID)
 	if err != nil {
-		http.Error(w, "Couldn't generate token", http.StatusInternalServerError)
+		log.Printf("❌ Failed to revoke sessions of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to revoke sessions")
 		return
 	}
+	log.Printf("🔑 User %d revoked %d sessions", userID, revoked)
+	recordAudit(r, AuditSessionsRevoked, AuditTargetUser, strconv.Itoa(userID), map[string]interface{}{
+		"revoked":      revoked,
+		"kept_current": keepID != "",
+	})
 
+	if keepID == "" {
+		setRefreshTokenCookie(w, "")
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": newAccessToken,
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"revoked": revoked,
 	})
-	log.Println("Refresh token sent successfully")
 }
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// StorageReconcileIntervalEnv is how often, in hours, storage is checked against the database (default 24)
+const StorageReconcileIntervalEnv = "STORAGE_RECONCILE_INTERVAL_HOURS"
+
+// storefrontsDir holds the storefront banners of each publisher
+const storefrontsDir = "storefronts"
+
+// storageOrphan is a file or folder in the uploads directory no database row references
+type storageOrphan struct {
+	Path      string    `json:"path"`
+	IsDir     bool      `json:"is_dir"`
+	SizeBytes int64     `json:"size_bytes"`
+	Modified  time.Time `json:"modified_at"`
+	Removed   bool      `json:"removed"`
+}
+
+// storageMissing is a database reference to a file that is not on disk
+type storageMissing struct {
+	Source     string `json:"source"`
+	ID         int    `json:"id"`
+	Field      string `json:"field"`
+	Path       string `json:"path"`
+	RelinkedTo string `json:"relinked_to,omitempty"`
+}
+
+// storageReport is the outcome of a reconciliation
+type storageReport struct {
+	ScannedAt   time.Time        `json:"scanned_at"`
+	References  int              `json:"references"`
+	Orphans     []storageOrphan  `json:"orphans"`
+	OrphanBytes int64            `json:"orphan_bytes"`
+	Missing     []storageMissing `json:"missing"`
+}
+
+// storageReference is a file path stored in the database, resolved against the uploads directory
+type storageReference struct {
+	Source      string
+	ID          int
+	Field       string
+	Path        string // As stored
+	Rel         string // Relative to the uploads directory
+	ModelFolder string // Relative folder of the model the row belongs to, if on the server
+	Checksum    string
+}
+
+// uploadsRelPath returns where a stored path points inside the uploads directory. Model folders
+// and pictures are stored as "./uploads/..." and "/uploads/...", the other files relative to it.
+// Local-mode folders, URLs and paths escaping the directory are not on the server.
+func uploadsRelPath(field, path string) (string, bool) {
+	if strings.Contains(path, "://") {
+		return "", false
+	}
+	switch field {
+	case "folder":
+		clean := filepath.ToSlash(filepath.Clean(path))
+		if !strings.HasPrefix(clean, "uploads/") {
+			return "", false
+		}
+		path = strings.TrimPrefix(clean, "uploads/")
+	case "picture":
+		if !strings.HasPrefix(path, "/uploads/") {
+			return "", false
+		}
+		path = strings.TrimPrefix(path, "/uploads/")
+	default:
+		if filepath.IsAbs(path) {
+			return "", false
+		}
+	}
+	rel := filepath.ToSlash(filepath.Clean(path))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+// loadStorageReferences returns the database's references to files in the uploads directory
+func loadStorageReferences(ctx context.Context) ([]storageReference, error) {
+	rows, err := repository.GetStorageReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]storageReference, 0, len(rows))
+	for _, row := range rows {
+		ref := storageReference{
+			Source:   getStringField(row, "source", ""),
+			ID:       getIntField(row, "id", 0),
+			Field:    getStringField(row, "field", ""),
+			Path:     getStringField(row, "path", ""),
+			Checksum: getStringField(row, "checksum", ""),
+		}
+		var ok bool
+		if ref.Rel, ok = uploadsRelPath(ref.Field, ref.Path); !ok {
+			continue
+		}
+		ref.ModelFolder, _ = uploadsRelPath("folder", getStringField(row, "model_folder", ""))
+		// Agents report trained models by their path on the agent's machine unless they uploaded them
+		if ref.Field == "trained_model_path" && (ref.ModelFolder == "" || !strings.HasPrefix(ref.Rel, ref.ModelFolder+"/")) {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// relinkCandidate looks for the file a missing reference most likely moved to: the only file with
+// the same name in the model's folder, with the same checksum when the listing recorded one
+func relinkCandidate(ref storageReference) string {
+	if ref.ModelFolder == "" || ref.Field == "folder" {
+		return ""
+	}
+	base := filepath.Base(ref.Rel)
+	var candidates []string
+	filepath.WalkDir(filepath.Join(uploadsBaseDir(), ref.ModelFolder), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != base {
+			return nil
+		}
+		rel, err := filepath.Rel(uploadsBaseDir(), path)
+		if err == nil {
+			candidates = append(candidates, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if len(candidates) != 1 {
+		return ""
+	}
+	if ref.Checksum != "" {
+		if sum, err := artifactChecksum(candidates[0]); err != nil || sum != ref.Checksum {
+			return ""
+		}
+	}
+	if ref.Field == "picture" {
+		return "/uploads/" + candidates[0]
+	}
+	return candidates[0]
+}
+
+// storageEntrySize returns the total size of a file or folder
+func storageEntrySize(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// reconcileStorage compares the uploads directory with the database. Orphans younger than an hour
+// are ignored, as their rows may not be committed yet. With clean, orphans are deleted; with
+// relink, missing files found elsewhere in their model's folder are linked again.
+func reconcileStorage(ctx context.Context, clean, relink bool) (*storageReport, error) {
+	refs, err := loadStorageReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &storageReport{ScannedAt: time.Now(), References: len(refs), Orphans: []storageOrphan{}, Missing: []storageMissing{}}
+	base := uploadsBaseDir()
+
+	// A path is in use if it, a folder containing it, or a file inside it is referenced
+	referenced := map[string]bool{}
+	for _, ref := range refs {
+		for dir := ref.Rel; dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			referenced[dir] = true
+		}
+		// ONNX exports are stored next to the trained model they were made from
+		if export := aiAgent.ONNXPath(ref.Rel); export != "" {
+			referenced[export] = true
+		}
+
+		if _, err := os.Stat(filepath.Join(base, ref.Rel)); !os.IsNotExist(err) {
+			continue
+		}
+		missing := storageMissing{Source: ref.Source, ID: ref.ID, Field: ref.Field, Path: ref.Path}
+		if relink {
+			if candidate := relinkCandidate(ref); candidate != "" {
+				if err := repository.RelinkStoragePath(ctx, ref.Source, ref.Field, ref.ID, ref.Path, candidate); err != nil {
+					log.Printf("⚠️  %v", err)
+				} else {
+					missing.RelinkedTo = candidate
+					log.Printf("🔗 Relinked %s %d %s from %s to %s", ref.Source, ref.ID, ref.Field, ref.Path, candidate)
+				}
+			}
+		}
+		report.Missing = append(report.Missing, missing)
+	}
+
+	// Model folders are top-level; templates, storefront banners and model versions are files in their own folders
+	var entries []string
+	top, err := os.ReadDir(base)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range top {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue // Staged uploads are cleaned up on their own
+		}
+		if entry.IsDir() && (name == templatesDir || name == storefrontsDir || name == aiAgent.ModelVersionsDir) {
+			filepath.WalkDir(filepath.Join(base, name), func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					if rel, err := filepath.Rel(base, path); err == nil {
+						entries = append(entries, filepath.ToSlash(rel))
+					}
+				}
+				return nil
+			})
+			continue
+		}
+		entries = append(entries, name)
+	}
+
+	for _, rel := range entries {
+		if referenced[rel] {
+			continue
+		}
+		path := filepath.Join(base, rel)
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < staleStagingAge {
+			continue
+		}
+		orphan := storageOrphan{Path: rel, IsDir: info.IsDir(), SizeBytes: storageEntrySize(path), Modified: info.ModTime()}
+		if clean {
+			if err := os.RemoveAll(path); err != nil {
+				log.Printf("⚠️  Failed to remove orphaned %s: %v", rel, err)
+			} else {
+				orphan.Removed = true
+			}
+		}
+		report.OrphanBytes += orphan.SizeBytes
+		report.Orphans = append(report.Orphans, orphan)
+	}
+	sort.Slice(report.Orphans, func(i, j int) bool { return report.Orphans[i].SizeBytes > report.Orphans[j].SizeBytes })
+	return report, nil
+}
+
+// StartStorageReconciliation checks, every STORAGE_RECONCILE_INTERVAL_HOURS, the uploads directory
+// against the database and logs orphaned and missing files. Only abandoned staged uploads are
+// removed, as no row can reference them; admins clean up the rest through the reconcile endpoint.
+func StartStorageReconciliation() {
+	go func() {
+		for {
+			removeAbandonedStaging()
+			report, err := reconcileStorage(context.Background(), false, false)
+			if err != nil {
+				log.Printf("⚠️  Storage reconciliation failed: %v", err)
+			} else if len(report.Orphans) > 0 || len(report.Missing) > 0 {
+				log.Printf("🧹 Storage reconciliation: %d orphans (%.1f MB), %d missing files",
+					len(report.Orphans), float64(report.OrphanBytes)/(1<<20), len(report.Missing))
+			}
+			time.Sleep(time.Duration(envInt(StorageReconcileIntervalEnv, 24)) * time.Hour)
+		}
+	}()
+}
+
+// ReconcileStorageHandler reports orphaned files in the uploads directory and database rows whose
+// files are missing. GET only reports; POST with clean_orphans deletes the orphans and with relink
+// points missing files at the copy found in their model's folder.
+func ReconcileStorageHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		CleanOrphans bool `json:"clean_orphans"`
+		Relink       bool `json:"relink"`
+	}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	report, err := reconcileStorage(r.Context(), req.CleanOrphans, req.Relink)
+	if err != nil {
+		log.Printf("❌ Storage reconciliation failed: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to reconcile storage")
+		return
+	}
+	if req.CleanOrphans || req.Relink {
+		log.Printf("🧹 Admin %d reconciled storage (clean=%v, relink=%v): %d orphans, %d missing",
+			adminID, req.CleanOrphans, req.Relink, len(report.Orphans), len(report.Missing))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
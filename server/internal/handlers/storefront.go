@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Storefront limits
+const (
+	maxStorefrontTagline = 160
+	maxPinnedListings    = 6
+	maxBannerSize        = 5 << 20 // 5 MB
+)
+
+// bannerExtensions are the image types accepted as storefront banners
+var bannerExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// storefrontResponse renders a publisher's storefront settings
+func storefrontResponse(storefront map[string]interface{}) map[string]interface{} {
+	response := map[string]interface{}{"tagline": "", "banner_url": ""}
+	if storefront != nil {
+		response["tagline"] = getStringField(storefront, "tagline", "")
+		if banner := getStringField(storefront, "banner_path", ""); banner != "" {
+			response["banner_url"] = "/uploads/" + banner
+		}
+		response["updated_at"] = storefront["updated_at"]
+	}
+	return response
+}
+
+// GetPublisherProfileHandler returns a publisher's public profile: branding, pinned listings and
+// every active public listing in the publisher's order. No authentication is required.
+func GetPublisherProfileHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	user, err := repository.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		log.Printf("❌ Failed to get publisher %s: %v", username, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve publisher")
+		return
+	}
+	if user == nil {
+		apierrors.Respond(w, http.StatusNotFound, "Publisher not found")
+		return
+	}
+	publisherID := getIntField(*user, "id", 0)
+
+	storefront, err := repository.GetStorefront(r.Context(), publisherID)
+	if err != nil {
+		log.Printf("❌ Failed to get storefront of publisher %d: %v", publisherID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve publisher")
+		return
+	}
+	listings, err := repository.GetStorefrontListings(r.Context(), publisherID)
+	if err != nil {
+		log.Printf("❌ Failed to get listings of publisher %d: %v", publisherID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve publisher")
+		return
+	}
+
+	pinned := []map[string]interface{}{}
+	others := []map[string]interface{}{}
+	downloads := 0
+	for _, listing := range listings {
+		// Organization and private listings are not shown on the public profile
+		if getStringField(listing, "visibility", repository.ListingVisibilityPublic) != repository.ListingVisibilityPublic {
+			continue
+		}
+		downloads += getIntField(listing, "downloads_count", 0)
+		if isPinned, _ := listing["pinned"].(bool); isPinned {
+			pinned = append(pinned, listing)
+		} else {
+			others = append(others, listing)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"publisher": map[string]interface{}{
+			"id":           publisherID,
+			"username":     (*user)["username"],
+			"member_since": (*user)["created_at"],
+		},
+		"storefront": storefrontResponse(storefront),
+		"pinned":     pinned,
+		"listings":   others,
+		"stats": map[string]interface{}{
+			"listings_count":  len(listings),
+			"downloads_count": downloads,
+		},
+	})
+}
+
+// GetMyStorefrontHandler returns the caller's storefront settings and listing order for editing
+func GetMyStorefrontHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	storefront, err := repository.GetStorefront(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get storefront of publisher %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve storefront")
+		return
+	}
+	listings, err := repository.GetStorefrontListings(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get listings of publisher %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve storefront")
+		return
+	}
+
+	order := []int{}
+	pinned := []int{}
+	for _, listing := range listings {
+		id := getIntField(listing, "id", 0)
+		if isPinned, _ := listing["pinned"].(bool); isPinned {
+			pinned = append(pinned, id)
+		} else {
+			order = append(order, id)
+		}
+	}
+
+	response := storefrontResponse(storefront)
+	response["success"] = true
+	response["pinned_model_ids"] = pinned
+	response["model_order"] = order
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateStorefrontHandler sets the caller's tagline, pinned listings and listing order.
+// Omitted fields are left unchanged.
+func UpdateStorefrontHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Tagline        *string `json:"tagline"`
+		PinnedModelIDs *[]int  `json:"pinned_model_ids"`
+		ModelOrder     *[]int  `json:"model_order"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Tagline != nil {
+		tagline := strings.TrimSpace(*req.Tagline)
+		if utf8.RuneCountInString(tagline) > maxStorefrontTagline {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("tagline cannot be longer than %d characters", maxStorefrontTagline))
+			return
+		}
+		req.Tagline = &tagline
+	}
+
+	if req.PinnedModelIDs != nil || req.ModelOrder != nil {
+		listings, err := repository.GetStorefrontListings(r.Context(), userID)
+		if err != nil {
+			log.Printf("❌ Failed to get listings of publisher %d: %v", userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to update storefront")
+			return
+		}
+		owned := make(map[int]bool, len(listings))
+		var currentPinned, currentOrder []int
+		for _, listing := range listings {
+			id := getIntField(listing, "id", 0)
+			owned[id] = true
+			if isPinned, _ := listing["pinned"].(bool); isPinned {
+				currentPinned = append(currentPinned, id)
+			} else {
+				currentOrder = append(currentOrder, id)
+			}
+		}
+
+		pinned, order := currentPinned, currentOrder
+		if req.PinnedModelIDs != nil {
+			pinned = *req.PinnedModelIDs
+		}
+		if req.ModelOrder != nil {
+			order = *req.ModelOrder
+		}
+		if len(pinned) > maxPinnedListings {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("at most %d listings can be pinned", maxPinnedListings))
+			return
+		}
+		for _, id := range append(append([]int{}, pinned...), order...) {
+			if !owned[id] {
+				apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("listing %d is not one of your published listings", id))
+				return
+			}
+		}
+
+		if err := repository.SetStorefrontListings(r.Context(), userID, order, pinned); err != nil {
+			log.Printf("❌ Failed to update storefront order of publisher %d: %v", userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to update storefront")
+			return
+		}
+	}
+
+	if err := repository.UpsertStorefront(r.Context(), userID, req.Tagline); err != nil {
+		log.Printf("❌ Failed to update storefront of publisher %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update storefront")
+		return
+	}
+
+	GetMyStorefrontHandler(w, r)
+}
+
+// UploadStorefrontBannerHandler replaces the caller's storefront banner (multipart field "banner")
+func UploadStorefrontBannerHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBannerSize+1<<20)
+	file, header, err := r.FormFile("banner")
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "A banner image is required in the 'banner' field (max 5 MB)")
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !bannerExtensions[ext] {
+		apierrors.Respond(w, http.StatusBadRequest, "banner must be a JPEG, PNG or WebP image")
+		return
+	}
+	if header.Size > maxBannerSize {
+		apierrors.Respond(w, http.StatusBadRequest, "banner cannot be larger than 5 MB")
+		return
+	}
+
+	relDir := filepath.Join("storefronts", fmt.Sprintf("%d", userID))
+	if err := os.MkdirAll(filepath.Join(uploadsBaseDir(), relDir), os.ModePerm); err != nil {
+		log.Printf("❌ Failed to create banner directory: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not save banner")
+		return
+	}
+	// A new name on every upload so CDNs and browsers do not serve the old banner
+	relPath := filepath.Join(relDir, fmt.Sprintf("banner-%d%s", time.Now().Unix(), ext))
+	out, err := os.Create(filepath.Join(uploadsBaseDir(), relPath))
+	if err != nil {
+		log.Printf("❌ Failed to create banner file: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not save banner")
+		return
+	}
+	if _, err := io.Copy(out, file); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		log.Printf("❌ Failed to write banner file: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not save banner")
+		return
+	}
+	out.Close()
+
+	relPath = filepath.ToSlash(relPath)
+	previous, err := repository.SetStorefrontBanner(r.Context(), userID, relPath)
+	if err != nil {
+		os.Remove(filepath.Join(uploadsBaseDir(), relPath))
+		log.Printf("❌ Failed to save banner of publisher %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not save banner")
+		return
+	}
+	if previous != "" && previous != relPath {
+		os.Remove(filepath.Join(uploadsBaseDir(), previous))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"banner_url": "/uploads/" + relPath,
+	})
+}
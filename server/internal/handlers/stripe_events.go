@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// GetStripeEventsHandler lists received Stripe webhook events for admins, most recent first,
+// filtered by ?status= (processing, processed or failed) and ?type=
+func GetStripeEventsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", repository.StripeEventProcessing, repository.StripeEventProcessed, repository.StripeEventFailed:
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, "status must be processing, processed or failed")
+		return
+	}
+
+	page, pageSize := parsePagination(r)
+	events, total, err := repository.GetStripeEvents(r.Context(), status, r.URL.Query().Get("type"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get Stripe events: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve Stripe events")
+		return
+	}
+	if events == nil {
+		events = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"events":    events,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// GetStripeEventHandler returns a Stripe webhook event with its payload, for admins
+func GetStripeEventHandler(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "eventId")
+	event, err := repository.GetStripeEvent(r.Context(), eventID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Event not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get Stripe event %s: %v", eventID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve Stripe event")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"event":   event,
+	})
+}
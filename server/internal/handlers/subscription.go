@@ -9,6 +9,7 @@ import (
 	"os"
 	"time"
 
+	"server/internal/apierrors"
 	"server/internal/middlewares"
 	"server/internal/repository"
 	"github.com/stripe/stripe-go/v81"
@@ -44,7 +45,7 @@ var trainingCredits = map[string]int{
 func GetSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -53,7 +54,7 @@ func GetSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := repository.GetUserByEmail(r.Context(), userEmail)
 	if err != nil || user == nil {
 		log.Printf("❌ User not found: %s", userEmail)
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
@@ -76,40 +77,57 @@ func GetSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// CheckoutRequest is the body of POST /v1/subscription/checkout
+type CheckoutRequest struct {
+	Tier       string `json:"tier"`
+	CouponCode string `json:"coupon_code"`
+}
+
 // CreateCheckoutSessionHandler creates a Stripe checkout session
 func CreateCheckoutSessionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	var req struct {
-		Tier string `json:"tier"`
-	}
+	var req CheckoutRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	// Validate tier
 	if req.Tier != TierBasic && req.Tier != TierPro && req.Tier != TierEnterprise {
-		http.Error(w, "Invalid subscription tier", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid subscription tier")
 		return
 	}
 
 	user, err := repository.GetUserByEmail(r.Context(), userEmail)
 	if err != nil || user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
+	// Discount codes apply to the first month
+	var applied *appliedCoupon
+	discount := 0
+	if req.CouponCode != "" {
+		var status int
+		applied, status, err = applyCoupon(r, getIntField(*user, "id", 0), req.CouponCode, repository.CouponAppliesSubscription, int(subscriptionPrices[req.Tier]))
+		if err != nil {
+			apierrors.Respond(w, status, err.Error())
+			return
+		}
+		discount = applied.discount
+	}
+
 	// Initialize Stripe
 	stripeKey := os.Getenv("STRIPE_SECRET_KEY")
 	if stripeKey == "" {
@@ -128,6 +146,7 @@ func CreateCheckoutSessionHandler(w http.ResponseWriter, r *http.Request) {
 			"checkout_url": checkoutURL,
 			"tier":         req.Tier,
 			"price":        subscriptionPrices[req.Tier],
+			"discount":     discount,
 			"message":      "Mock mode - STRIPE_SECRET_KEY not configured",
 		})
 		return
@@ -148,7 +167,7 @@ func CreateCheckoutSessionHandler(w http.ResponseWriter, r *http.Request) {
 		cust, err := customer.New(customerParams)
 		if err != nil {
 			log.Printf("❌ Failed to create Stripe customer: %v", err)
-			http.Error(w, "Failed to create customer", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to create customer")
 			return
 		}
 		stripeCustomerID = cust.ID
@@ -202,10 +221,21 @@ func CreateCheckoutSessionHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	if applied != nil {
+		stripeCoupon, err := stripeCouponID(r, applied)
+		if err != nil {
+			log.Printf("❌ Failed to create Stripe coupon for %s: %v", applied.code, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to apply coupon")
+			return
+		}
+		params.Discounts = []*stripe.CheckoutSessionDiscountParams{{Coupon: stripe.String(stripeCoupon)}}
+		applied.metadata(params.Metadata)
+	}
+
 	sess, err := session.New(params)
 	if err != nil {
 		log.Printf("❌ Failed to create checkout session: %v", err)
-		http.Error(w, "Failed to create checkout session", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create checkout session")
 		return
 	}
 
@@ -218,6 +248,7 @@ func CreateCheckoutSessionHandler(w http.ResponseWriter, r *http.Request) {
 		"session_id":   sess.ID,
 		"tier":         req.Tier,
 		"price":        subscriptionPrices[req.Tier],
+		"discount":     discount,
 	})
 }
 
@@ -279,17 +310,16 @@ func getIntField(user map[string]interface{}, field string, defaultValue int) in
 	return defaultValue
 }
 
-// DecrementTrainingCredits decrements the user's training credits
-func DecrementTrainingCredits(userEmail string) error {
-	// TODO: Implement in repository
-	log.Printf("Decrementing training credits for user: %s", userEmail)
-	return nil
-}
+// StripeEventMaxAgeEnv is after how many hours a Stripe event is refused as a replay (default 72,
+// how long Stripe retries a webhook)
+const StripeEventMaxAgeEnv = "STRIPE_EVENT_MAX_AGE_HOURS"
 
-// StripeWebhookHandler handles Stripe webhook events
+// StripeWebhookHandler handles Stripe webhook events. Each event is recorded and applied once:
+// deliveries of an event that was already applied are acknowledged without applying it again, and
+// an event that failed is applied again when Stripe retries it.
 func StripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -298,85 +328,120 @@ func StripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	payload, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("❌ Error reading request body: %v", err)
-		http.Error(w, "Invalid payload", http.StatusServiceUnavailable)
+		apierrors.Respond(w, http.StatusServiceUnavailable, "Invalid payload")
 		return
 	}
 
 	// Verify webhook signature
+	var event stripe.Event
 	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
 	if webhookSecret != "" {
-		event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), webhookSecret)
+		event, err = webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), webhookSecret)
 		if err != nil {
 			log.Printf("❌ Webhook signature verification failed: %v", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
-		handleStripeEvent(event)
 	} else {
 		// For development without webhook secret
 		log.Println("⚠️  STRIPE_WEBHOOK_SECRET not set, skipping signature verification")
-		var event stripe.Event
 		if err := json.Unmarshal(payload, &event); err != nil {
 			log.Printf("❌ Failed to parse webhook JSON: %v", err)
-			http.Error(w, "Invalid payload", http.StatusBadRequest)
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid payload")
 			return
 		}
-		handleStripeEvent(event)
+	}
+
+	if event.ID == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "Event ID is required")
+		return
+	}
+	// Refuse replays of old events; the signature only covers when the request was sent
+	created := time.Unix(event.Created, 0)
+	if maxAge := time.Duration(envInt(StripeEventMaxAgeEnv, 72)) * time.Hour; time.Since(created) > maxAge {
+		log.Printf("⚠️  Refusing Stripe event %s created at %s", event.ID, created.Format(time.RFC3339))
+		apierrors.Respond(w, http.StatusBadRequest, "Event is too old")
+		return
+	}
+
+	claimed, err := repository.ClaimStripeEvent(r.Context(), event.ID, string(event.Type), event.Livemode, payload, created)
+	if err != nil {
+		log.Printf("❌ Failed to record Stripe event %s: %v", event.ID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to record event")
+		return
+	}
+	if !claimed {
+		log.Printf("⏭️  Skipping Stripe event %s (%s), already handled", event.ID, event.Type)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	failure := handleStripeEvent(r, event)
+	if err := repository.FinishStripeEvent(r.Context(), event.ID, failure); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	if failure != nil {
+		// Stripe retries the event, which claims it again
+		log.Printf("❌ Failed to handle Stripe event %s (%s): %v", event.ID, event.Type, failure)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to handle event")
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-func handleStripeEvent(event stripe.Event) {
+// handleStripeEvent applies a webhook event; r is the webhook request, for its context and the audit log
+func handleStripeEvent(r *http.Request, event stripe.Event) error {
 	log.Printf("📥 Received Stripe webhook: %s", event.Type)
+	ctx := r.Context()
 
 	switch event.Type {
 	case "checkout.session.completed":
 		var session stripe.CheckoutSession
 		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-			log.Printf("❌ Error parsing checkout.session.completed: %v", err)
-			return
+			return fmt.Errorf("error parsing checkout.session.completed: %w", err)
 		}
 
 		// Extract user email and tier from metadata
 		userEmail := session.Metadata["user_email"]
 		tier := session.Metadata["tier"]
 
-		if userEmail == "" || tier == "" {
-			log.Printf("⚠️  Missing metadata in checkout session")
-			return
+		// Payments and checkouts created outside the plan checkout are acknowledged, or Stripe retries them for days
+		if session.Mode != stripe.CheckoutSessionModeSubscription || (userEmail == "" && tier == "") {
+			log.Printf("ℹ️  Ignoring checkout session %s (mode %s), not a plan checkout", session.ID, session.Mode)
+			return nil
+		}
+		if userEmail == "" || tier == "" || session.Subscription == nil || session.Customer == nil {
+			return fmt.Errorf("missing metadata in checkout session %s", session.ID)
 		}
 
-		// Update user subscription
-		err := repository.UpdateUserSubscription(nil, userEmail, map[string]interface{}{
-			"subscription_tier":          tier,
+		// Update user subscription, starting a credit period or prorating the credits of a tier change
+		_, err := changeSubscriptionTier(ctx, userEmail, tier, map[string]interface{}{
 			"subscription_status":        "active",
 			"stripe_subscription_id":     session.Subscription.ID,
 			"stripe_customer_id":         session.Customer.ID,
-			"subscription_start_date":    time.Now(),
-			"subscription_end_date":      time.Now().AddDate(0, 1, 0), // 1 month from now
-			"training_credits":           trainingCredits[tier],
 		})
 
 		if err != nil {
-			log.Printf("❌ Failed to update user subscription: %v", err)
-			return
+			return fmt.Errorf("failed to update user subscription: %w", err)
 		}
 
 		log.Printf("✅ Subscription activated for %s: %s tier", userEmail, tier)
+		if user, err := repository.GetUserByEmail(ctx, userEmail); err == nil && user != nil {
+			redeemPaymentCoupon(r, getIntField(*user, "id", 0), session.Metadata, repository.CouponAppliesSubscription, session.ID)
+		}
+		recordSubscriptionAudit(r, userEmail, map[string]interface{}{"source": "stripe", "event": event.Type, "tier": tier, "status": "active"})
 
 	case "customer.subscription.updated":
 		var subscription stripe.Subscription
 		if err := json.Unmarshal(event.Data.Raw, &subscription); err != nil {
-			log.Printf("❌ Error parsing customer.subscription.updated: %v", err)
-			return
+			return fmt.Errorf("error parsing customer.subscription.updated: %w", err)
 		}
 
 		// Find user by stripe customer ID
-		userEmail, err := repository.GetUserEmailByStripeCustomer(nil, subscription.Customer.ID)
+		userEmail, err := repository.GetUserEmailByStripeCustomer(ctx, subscription.Customer.ID)
 		if err != nil {
-			log.Printf("❌ Failed to find user for customer %s: %v", subscription.Customer.ID, err)
-			return
+			return fmt.Errorf("failed to find user for customer %s: %w", subscription.Customer.ID, err)
 		}
 
 		// Update subscription status
@@ -385,74 +450,73 @@ func handleStripeEvent(event stripe.Event) {
 			status = string(subscription.Status)
 		}
 
-		err = repository.UpdateUserSubscriptionStatus(nil, userEmail, status)
+		err = repository.UpdateUserSubscriptionStatus(ctx, userEmail, status)
 		if err != nil {
-			log.Printf("❌ Failed to update subscription status: %v", err)
-			return
+			return fmt.Errorf("failed to update subscription status: %w", err)
 		}
 
 		log.Printf("✅ Subscription updated for %s: %s", userEmail, status)
+		recordSubscriptionAudit(r, userEmail, map[string]interface{}{"source": "stripe", "event": event.Type, "status": status})
 
 	case "customer.subscription.deleted":
 		var subscription stripe.Subscription
 		if err := json.Unmarshal(event.Data.Raw, &subscription); err != nil {
-			log.Printf("❌ Error parsing customer.subscription.deleted: %v", err)
-			return
+			return fmt.Errorf("error parsing customer.subscription.deleted: %w", err)
 		}
 
 		// Find user by stripe customer ID
-		userEmail, err := repository.GetUserEmailByStripeCustomer(nil, subscription.Customer.ID)
+		userEmail, err := repository.GetUserEmailByStripeCustomer(ctx, subscription.Customer.ID)
 		if err != nil {
-			log.Printf("❌ Failed to find user for customer %s: %v", subscription.Customer.ID, err)
-			return
+			return fmt.Errorf("failed to find user for customer %s: %w", subscription.Customer.ID, err)
 		}
 
 		// Downgrade to free tier
-		err = repository.UpdateUserSubscription(nil, userEmail, map[string]interface{}{
-			"subscription_tier":   "free",
+		_, err = changeSubscriptionTier(ctx, userEmail, TierFree, map[string]interface{}{
 			"subscription_status": "canceled",
-			"training_credits":    0,
 		})
 
 		if err != nil {
-			log.Printf("❌ Failed to cancel subscription: %v", err)
-			return
+			return fmt.Errorf("failed to cancel subscription: %w", err)
 		}
 
 		log.Printf("✅ Subscription canceled for %s", userEmail)
+		recordSubscriptionAudit(r, userEmail, map[string]interface{}{"source": "stripe", "event": event.Type, "tier": TierFree, "status": "canceled"})
 
 	case "invoice.payment_succeeded":
 		var invoice stripe.Invoice
 		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
-			log.Printf("❌ Error parsing invoice.payment_succeeded: %v", err)
-			return
+			return fmt.Errorf("error parsing invoice.payment_succeeded: %w", err)
 		}
 
 		log.Printf("✅ Payment succeeded for customer %s", invoice.Customer.ID)
+		if userEmail, err := repository.GetUserEmailByStripeCustomer(ctx, invoice.Customer.ID); err == nil {
+			cacheWebhookInvoice(r, userEmail, &invoice)
+		}
 
 	case "invoice.payment_failed":
 		var invoice stripe.Invoice
 		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
-			log.Printf("❌ Error parsing invoice.payment_failed: %v", err)
-			return
+			return fmt.Errorf("error parsing invoice.payment_failed: %w", err)
 		}
 
 		// Find user by stripe customer ID
-		userEmail, err := repository.GetUserEmailByStripeCustomer(nil, invoice.Customer.ID)
+		userEmail, err := repository.GetUserEmailByStripeCustomer(ctx, invoice.Customer.ID)
 		if err != nil {
-			log.Printf("❌ Failed to find user for customer %s: %v", invoice.Customer.ID, err)
-			return
+			return fmt.Errorf("failed to find user for customer %s: %w", invoice.Customer.ID, err)
 		}
 
 		// Mark subscription as past_due
-		err = repository.UpdateUserSubscriptionStatus(nil, userEmail, "past_due")
+		err = repository.UpdateUserSubscriptionStatus(ctx, userEmail, "past_due")
 		if err != nil {
-			log.Printf("❌ Failed to update subscription status: %v", err)
-			return
+			return fmt.Errorf("failed to update subscription status: %w", err)
 		}
 
 		log.Printf("⚠️  Payment failed for %s", userEmail)
+		cacheWebhookInvoice(r, userEmail, &invoice)
+		recordSubscriptionAudit(r, userEmail, map[string]interface{}{"source": "stripe", "event": event.Type, "status": "past_due"})
 	}
+
+	return nil
 }
 
 // GetPricingHandler returns available subscription tiers and pricing
@@ -520,23 +584,28 @@ func GetPricingHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ResetMonthlyCredits resets training credits for all users (run monthly via cron)
+// ResetMonthlyCredits runs the credit resets of subscription anniversaries that are due now, without
+// waiting for the hourly job (admin only)
 func ResetMonthlyCreditsHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Add admin authentication
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	log.Println("Resetting monthly training credits for all users...")
+	log.Println("Resetting due monthly training credits...")
 
-	// TODO: Implement in repository
-	// Update all users with their tier's monthly credits
+	reset, err := resetDueCredits(r.Context())
+	if err != nil {
+		log.Printf("❌ Failed to reset monthly credits: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to reset monthly credits")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": "Monthly credits reset successfully",
+		"reset": reset,
 		"timestamp": time.Now(),
 	})
 }
@@ -545,13 +614,13 @@ func ResetMonthlyCreditsHandler(w http.ResponseWriter, r *http.Request) {
 // This should only be used in development - remove or disable in production
 func MockUpgradeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -560,40 +629,37 @@ func MockUpgradeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	// Validate tier
 	if req.Tier != TierBasic && req.Tier != TierPro && req.Tier != TierEnterprise && req.Tier != TierFree {
-		http.Error(w, "Invalid subscription tier", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid subscription tier")
 		return
 	}
 
 	log.Printf("🎭 Mock upgrade: %s -> %s tier", userEmail, req.Tier)
 
 	// Update user subscription in database
-	err := repository.UpdateUserSubscription(r.Context(), userEmail, map[string]interface{}{
-		"subscription_tier":       req.Tier,
-		"subscription_status":     "active",
-		"subscription_start_date": time.Now(),
-		"subscription_end_date":   time.Now().AddDate(0, 1, 0), // 1 month from now
-		"training_credits":        trainingCredits[req.Tier],
+	plan, err := changeSubscriptionTier(r.Context(), userEmail, req.Tier, map[string]interface{}{
+		"subscription_status": "active",
 	})
 
 	if err != nil {
 		log.Printf("❌ Failed to update subscription: %v", err)
-		http.Error(w, "Failed to update subscription", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update subscription")
 		return
 	}
 
 	log.Printf("✅ Mock upgrade successful: %s is now on %s tier", userEmail, req.Tier)
+	recordSubscriptionAudit(r, userEmail, map[string]interface{}{"source": "mock_upgrade", "tier": req.Tier, "status": "active"})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": fmt.Sprintf("Successfully upgraded to %s tier (MOCK)", req.Tier),
 		"tier":    req.Tier,
-		"credits": trainingCredits[req.Tier],
+		"credits": plan.Credits,
 	})
 }
@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Marketplace listing types
+const (
+	ListingTypeModel            = "model"
+	ListingTypePipelineTemplate = "pipeline_template"
+	// ListingTypeWeightsOnly ships the trained model without the training script or data,
+	// for publishers whose pipeline is proprietary
+	ListingTypeWeightsOnly = "weights_only"
+)
+
+// listingTypes are the listing types a listing can be published as and searched by
+var listingTypes = map[string]bool{
+	ListingTypeModel:            true,
+	ListingTypePipelineTemplate: true,
+	ListingTypeWeightsOnly:      true,
+}
+
+const invalidListingTypeMessage = "listing_type must be 'model', 'pipeline_template' or 'weights_only'"
+
+// templatesDir is where template archives are stored, relative to the uploads directory
+const templatesDir = "templates"
+
+// maxTemplateSize limits the uncompressed size of a pipeline template
+const maxTemplateSize = 20 << 20 // 20 MB
+
+// Licenses a pipeline template can be published under
+var templateLicenses = map[string]bool{
+	"mit":          true,
+	"apache-2.0":   true,
+	"bsd-3-clause": true,
+	"gpl-3.0":      true,
+	"cc-by-4.0":    true,
+	"cc-by-nc-4.0": true,
+	"personal_use": true,
+	"commercial":   true,
+	"proprietary":  true,
+}
+
+// Files that make up a template: scripts, pipeline config and requirements.
+// Weights, datasets and anything else are left out.
+var templateFileExtensions = map[string]bool{
+	".py":    true,
+	".ipynb": true,
+	".sh":    true,
+	".json":  true,
+	".yaml":  true,
+	".yml":   true,
+	".toml":  true,
+	".cfg":   true,
+	".ini":   true,
+	".txt":   true,
+	".md":    true,
+}
+
+// Directories never included in a template
+var templateSkipDirs = map[string]bool{
+	"saved_models": true,
+	"checkpoints":  true,
+	"data":         true,
+	"datasets":     true,
+	"__pycache__":  true,
+	".git":         true,
+	".venv":        true,
+	"venv":         true,
+	"node_modules": true,
+}
+
+var templateNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func uploadsBaseDir() string {
+	if dir := os.Getenv("UPLOADS_PATH"); dir != "" {
+		return dir
+	}
+	return "./uploads"
+}
+
+// packagePipelineTemplate zips the scripts, config and requirements of a model folder.
+// It returns the archive path relative to the uploads directory.
+func packagePipelineTemplate(modelFolder, trainingScript string, publisherID, modelID int) (string, error) {
+	info, err := os.Stat(modelFolder)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("model folder is not available on the server")
+	}
+	if trainingScript == "" {
+		trainingScript = "train.py"
+	}
+	if _, err := os.Stat(filepath.Join(modelFolder, trainingScript)); err != nil {
+		if config, _ := aiAgent.LoadModelConfig(modelFolder); config == nil || config.Pipeline == nil {
+			return "", fmt.Errorf("model folder has neither %s nor a pipeline in %s", trainingScript, aiAgent.ModelConfigFile)
+		}
+	}
+
+	relPath := filepath.Join(templatesDir, fmt.Sprintf("%d_%d_%d.zip", publisherID, modelID, time.Now().Unix()))
+	archivePath := filepath.Join(uploadsBaseDir(), relPath)
+	if err := os.MkdirAll(filepath.Dir(archivePath), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create templates directory: %w", err)
+	}
+
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create template archive: %w", err)
+	}
+
+	var total int64
+	files := 0
+	zw := zip.NewWriter(out)
+	err = filepath.WalkDir(modelFolder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != modelFolder && templateSkipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !templateFileExtensions[strings.ToLower(filepath.Ext(d.Name()))] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		if total > maxTemplateSize {
+			return fmt.Errorf("template is larger than %d MB", maxTemplateSize>>20)
+		}
+
+		rel, err := filepath.Rel(modelFolder, path)
+		if err != nil {
+			return err
+		}
+		dst, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		files++
+		return err
+	})
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && files == 0 {
+		err = fmt.Errorf("model folder has no template files")
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return "", err
+	}
+
+	log.Printf("✅ Packaged pipeline template with %d files (%d bytes): %s", files, total, archivePath)
+	return relPath, nil
+}
+
+// extractPipelineTemplate unpacks a template archive into dest, rejecting entries that escape it
+func extractPipelineTemplate(archivePath, dest string) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range r.File {
+		target := filepath.Join(absDest, filepath.FromSlash(f.Name))
+		if target != absDest && !strings.HasPrefix(target, absDest+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in template: %s", f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			rc.Close()
+			return err
+		}
+		_, err = io.Copy(out, io.LimitReader(rc, maxTemplateSize))
+		out.Close()
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueModelDir returns an unused "./uploads/<name>" folder and the model name it maps to
+func uniqueModelDir(name string) (string, string) {
+	name = strings.Trim(templateNameSanitizer.ReplaceAllString(name, "_"), "._")
+	if name == "" {
+		name = "template"
+	}
+	candidate := name
+	for i := 2; ; i++ {
+		dir := "./uploads/" + candidate
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return dir, candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// InstallTemplateHandler installs a pipeline template into the user's workspace as a new model
+func InstallTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Template not found")
+			return
+		}
+		log.Printf("❌ Failed to get published model %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve template")
+		return
+	}
+
+	if listingType, _ := listing["listing_type"].(string); listingType != ListingTypePipelineTemplate {
+		apierrors.Respond(w, http.StatusBadRequest, "Only pipeline templates can be installed, use download for models")
+		return
+	}
+	if isActive, _ := listing["is_active"].(bool); !isActive {
+		// Templates past their end of life stay installable by their buyers
+		if !listingEndedLife(listing) || listingIsRemoved(listing) {
+			apierrors.Respond(w, http.StatusForbidden, "This template is not available")
+			return
+		}
+		if allowed, err := canDownloadAfterEndOfLife(r, listing, listingID, userID); err != nil || !allowed {
+			apierrors.Respond(w, http.StatusGone, "This template has reached its end of life and is no longer available")
+			return
+		}
+	}
+	if allowed, err := canDownloadPublishedModel(r, listing, listingID, userID); err != nil || !allowed {
+		apierrors.Respond(w, http.StatusPaymentRequired, "Purchase this template (or a bundle containing it) to install it")
+		return
+	}
+
+	templatePath, _ := listing["template_path"].(string)
+	archivePath, err := resolveUploadsPath(templatePath)
+	if err != nil {
+		log.Printf("❌ Template %d has an invalid archive path: %v", listingID, err)
+		apierrors.Respond(w, http.StatusNotFound, "Template archive not available")
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name, _ = listing["name"].(string)
+	}
+	modelDir, modelName := uniqueModelDir(name)
+	if err := os.MkdirAll(modelDir, os.ModePerm); err != nil {
+		log.Println("❌ Failed to create model directory:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not create model directory")
+		return
+	}
+	if err := extractPipelineTemplate(archivePath, modelDir); err != nil {
+		os.RemoveAll(modelDir)
+		log.Printf("❌ Failed to extract template %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not install template: "+err.Error())
+		return
+	}
+
+	trainingScript, _ := listing["training_script"].(string)
+	modelID, err := repository.InsertModel(r.Context(), userID, modelName, "", []string{modelDir}, trainingScript)
+	if err != nil {
+		os.RemoveAll(modelDir)
+		log.Println("❌ PostgreSQL insert failed:", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create model")
+		return
+	}
+
+	if err := repository.RecordTemplateInstall(r.Context(), listingID, userID, modelID); err != nil {
+		log.Printf("⚠️ Failed to record install of template %d: %v", listingID, err)
+	}
+
+	log.Printf("✅ User %d installed template %d as model %d (%s)", userID, listingID, modelID, modelDir)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"message":      "Template installed successfully",
+		"model_id":     modelID,
+		"name":         modelName,
+		"license_type": listing["license_type"],
+		"deprecation":  listingDeprecation(listing),
+	})
+}
+
+// GetTemplateInstallsHandler lists who installed a pipeline template. Only the publisher can see it.
+func GetTemplateInstallsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Template not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve template")
+		return
+	}
+	if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher can see template installs")
+		return
+	}
+
+	installs, err := repository.GetTemplateInstalls(r.Context(), listingID)
+	if err != nil {
+		log.Printf("❌ Failed to get installs for template %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve installs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"installs":       installs,
+		"installs_count": listing["installs_count"],
+	})
+}
+
+// resolveUploadsPath joins a stored path with the uploads directory and makes sure the file exists inside it
+func resolveUploadsPath(relPath string) (string, error) {
+	if relPath == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	absUploadsDir, err := filepath.Abs(uploadsBaseDir())
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(filepath.Join(absUploadsDir, relPath))
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(absPath, absUploadsDir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path escapes uploads directory: %s", relPath)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return "", err
+	}
+	return absPath, nil
+}
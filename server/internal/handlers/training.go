@@ -3,9 +3,11 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"server/aiAgent"
+	"server/internal/apierrors"
 	"server/internal/middlewares"
 	"server/internal/repository"
 	"strings"
@@ -24,12 +26,30 @@ func NewTrainingHandler(agent *aiAgent.Agent) *TrainingHandler {
 	}
 }
 
+// trainingStartError is why a training could not be started. Code defaults to the generic code
+// of Status; Details are sent along when set.
+type trainingStartError struct {
+	Status  int
+	Code    string
+	Message string
+	Details map[string]interface{}
+}
+
+// write sends the error response
+func (e *trainingStartError) write(w http.ResponseWriter) {
+	code := e.Code
+	if code == "" {
+		code = apierrors.CodeForStatus(e.Status)
+	}
+	apierrors.Write(w, apierrors.New(e.Status, code, e.Message).WithDetails(e.Details))
+}
+
 // StartTraining handles requests to start model training
 func (h *TrainingHandler) StartTraining(w http.ResponseWriter, r *http.Request) {
 	println("🚀 [TRAINING] Received start training request")
 
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -37,52 +57,44 @@ func (h *TrainingHandler) StartTraining(w http.ResponseWriter, r *http.Request)
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
 		println("❌ [TRAINING] No user email in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	println("👤 [TRAINING] User email:", userEmail)
 
-	// Check if user has an agent connected (free local training)
-	hasAgent := IsAgentConnected(userEmail)
-	println("🔍 [TRAINING] Agent connected for", userEmail, ":", hasAgent)
-
-	// If no agent, check if user can train on server (paid)
-	if !hasAgent {
-		canTrain, message := CanUserTrainOnServer(r)
-		if !canTrain {
-			println("❌ [TRAINING] Permission denied:", message)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusForbidden)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"error":   message,
-				"message": "Connect your training agent or upgrade to a paid subscription",
-			})
-			return
-		}
-		println("✅ [TRAINING] User has paid subscription, training on server")
-	} else {
-		println("✅ [TRAINING] User has agent connected, training locally")
-	}
-
 	var req aiAgent.TrainingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		println("❌ [TRAINING] Failed to decode request:", err.Error())
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, startErr := h.startTraining(r, userEmail, req)
+	if startErr != nil {
+		startErr.write(w)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// startTraining starts a training of one of the user's models, or of a model shared with them, on
+// the agent or server choosePlacement picks. r carries the user's email in its context and is
+// used for the subscription check.
+func (h *TrainingHandler) startTraining(r *http.Request, userEmail string, req aiAgent.TrainingRequest) (map[string]interface{}, *trainingStartError) {
+	println("🔍 [TRAINING] Agent connected for", userEmail, ":", IsAgentConnected(userEmail))
+
 	println("📋 [TRAINING] Request details:")
 	println("   - Model Name:", req.FolderName)
 	println("   - Script:", req.ScriptName)
 	println("   - Python:", req.PythonCommand)
 
 	// Validate required fields
-	if req.FolderName == "" {
+	if req.FolderName == "" && req.ModelID == 0 {
 		println("❌ [TRAINING] Missing folder_name")
-		http.Error(w, "folder_name is required", http.StatusBadRequest)
-		return
+		return nil, &trainingStartError{Status: http.StatusBadRequest, Message: "folder_name or model_id is required"}
 	}
 	if req.ScriptName == "" {
 		req.ScriptName = "train.py" // Default to train.py
@@ -92,35 +104,67 @@ func (h *TrainingHandler) StartTraining(w http.ResponseWriter, r *http.Request)
 		req.PythonCommand = "python3" // Default to python3
 		println("   - Using default Python: python3")
 	}
+	hyperparameters, err := aiAgent.ValidateHyperparameters(req.Hyperparameters, req.HyperparameterFormat)
+	if err != nil {
+		println("❌ [TRAINING] Invalid hyperparameters:", err.Error())
+		return nil, &trainingStartError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	req.Hyperparameters = hyperparameters
+	if req.EarlyStopping != nil {
+		if err := req.EarlyStopping.Validate(); err != nil {
+			println("❌ [TRAINING] Invalid early stopping:", err.Error())
+			return nil, &trainingStartError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+	}
 
 	// Get the actual folder path from the database
 	println("🔍 [TRAINING] Looking up model in database...")
 	user, err := repository.GetUserByEmail(r.Context(), userEmail)
 	if err != nil || user == nil {
 		println("❌ [TRAINING] Failed to get user")
-		http.Error(w, "User not found", http.StatusInternalServerError)
-		return
+		return nil, &trainingStartError{Status: http.StatusInternalServerError, Message: "User not found"}
 	}
 
 	userID, ok := (*user)["id"].(int32)
 	if !ok {
 		println("❌ [TRAINING] Failed to get user ID")
-		http.Error(w, "Invalid user ID", http.StatusInternalServerError)
-		return
+		return nil, &trainingStartError{Status: http.StatusInternalServerError, Message: "Invalid user ID"}
 	}
 
-	models, err := repository.GetModelsByUserID(r.Context(), int(userID))
+	models, err := repository.GetModelsByUserID(r.Context(), int(userID), "")
 	if err != nil {
 		println("❌ [TRAINING] Failed to get models:", err.Error())
-		http.Error(w, "Failed to get models", http.StatusInternalServerError)
-		return
+		return nil, &trainingStartError{Status: http.StatusInternalServerError, Message: "Failed to get models"}
 	}
 
-	// Find the model by name
+	// Models shared with the user can be trained too, subject to the owner's settings
+	sharedModels, err := repository.GetTrainableModelsForMember(r.Context(), int(userID))
+	if err != nil {
+		println("⚠️  [TRAINING] Failed to get shared models:", err.Error())
+	}
+	models = append(models, sharedModels...)
+	collaboratorModels, err := repository.GetCollaboratorModels(r.Context(), int(userID))
+	if err != nil {
+		println("⚠️  [TRAINING] Failed to get collaborator models:", err.Error())
+	}
+	models = append(models, collaboratorModels...)
+
+	// Find the model by ID or name
 	var modelFolder string
+	var trainedModel map[string]interface{}
 	modelName := req.FolderName // Save the original model name for training ID
 	for _, model := range models {
-		if name, ok := model["name"].(string); ok && name == req.FolderName {
+		matches := false
+		if req.ModelID != 0 {
+			matches = getIntField(model, "id", 0) == req.ModelID
+		} else if name, ok := model["name"].(string); ok && name == req.FolderName {
+			matches = true
+		}
+		if matches {
+			trainedModel = model
+			if name, ok := model["name"].(string); ok {
+				modelName = name
+			}
 			// Get the folder path from the model
 			if folder, ok := model["folder"].([]interface{}); ok && len(folder) > 0 {
 				if folderPath, ok := folder[0].(string); ok {
@@ -134,8 +178,7 @@ func (h *TrainingHandler) StartTraining(w http.ResponseWriter, r *http.Request)
 
 	if modelFolder == "" {
 		println("❌ [TRAINING] Model not found or has no folder path")
-		http.Error(w, "Model not found", http.StatusNotFound)
-		return
+		return nil, &trainingStartError{Status: http.StatusNotFound, Message: "Model not found"}
 	}
 
 	// Update the request to use the actual folder path
@@ -144,6 +187,37 @@ func (h *TrainingHandler) StartTraining(w http.ResponseWriter, r *http.Request)
 	req.FolderName = strings.TrimPrefix(req.FolderName, "uploads/")
 	println("📂 [TRAINING] Using folder path:", req.FolderName)
 
+	// Datasets that look broken are refused unless the user confirms them
+	datasetWarnings, datasetErr := checkTrainingDataset(r.Context(), trainedModel, req.IgnoreDatasetWarnings)
+	if datasetErr != nil {
+		println("❌ [TRAINING] Dataset looks broken")
+		return nil, datasetErr
+	}
+
+	// Agents whose hardware suits the training are free; the server needs a paid subscription
+	placement, placementErr := choosePlacement(r, userEmail, req, h.agent.GetTrainer())
+	if placementErr != nil {
+		println("❌ [TRAINING] No place to train:", placementErr.Message)
+		return nil, placementErr
+	}
+	hasAgent := placement.Target == PlacementAgent
+	println("📍 [TRAINING] Placement:", placement.Target, placement.AgentID, "-", placement.Reason)
+
+	// Check the owner's training settings for shared models
+	trainingType := TrainingTypeServer
+	if hasAgent {
+		trainingType = TrainingTypeAgent
+	}
+	approvalID, permErr := authorizeModelTraining(r.Context(), trainedModel, int(userID), trainingType)
+	if permErr != nil {
+		println("❌ [TRAINING] Training not allowed:", permErr.Message)
+		return nil, &trainingStartError{Status: permErr.Status, Code: apierrors.CodeTrainingNotAllowed, Message: permErr.Message,
+			Details: map[string]interface{}{"approval_required": permErr.ApprovalRequired}}
+	}
+	trainedModelID := getIntField(trainedModel, "id", 0)
+	anomalyPolicy := modelAnomalyPolicy(r.Context(), trainedModelID)
+	metricPatterns := modelMetricPatterns(r.Context(), trainedModelID)
+
 	// Start training
 	println("🔄 [TRAINING] Starting training process...")
 
@@ -155,32 +229,70 @@ func (h *TrainingHandler) StartTraining(w http.ResponseWriter, r *http.Request)
 		trainingID := fmt.Sprintf("%s_%d", modelName, time.Now().Unix())
 		println("🆔 [TRAINING] Training ID:", trainingID)
 
+		// Tell the script which PROGRESS protocol versions the server understands
+		if req.Env == nil {
+			req.Env = map[string]string{}
+		}
+		req.Env[aiAgent.ProgressProtocolEnv] = fmt.Sprintf("%d", aiAgent.LatestProgressProtocol)
+		args, hyperparametersErr := agentHyperparameters(&req)
+		if hyperparametersErr != nil {
+			return nil, hyperparametersErr
+		}
+
 		trainingData := map[string]interface{}{
 			"training_id":    trainingID,
 			"folder_path":    req.FolderName, // Agent expects folder_path, not folder_name
 			"script_name":    req.ScriptName,
 			"python_command": req.PythonCommand,
-			"args":           req.Args,
+			"args":           args,
 			"env":            req.Env,
 		}
+		// Agents download the model folder from the server, only moving files that changed
+		if syncSpec := grantAgentSync(trainingID, int(userID), req.FolderName); syncSpec != nil {
+			trainingData["sync"] = syncSpec
+		}
+
+		// The agent's progress is tracked once it reports the training started
+		pendingAnomalyPolicies.Store(trainingID, anomalyPolicy)
+		if len(metricPatterns) > 0 {
+			pendingMetricPatterns.Store(trainingID, metricPatterns)
+		}
+		if len(req.Hyperparameters) > 0 {
+			pendingHyperparameters.Store(trainingID, req.Hyperparameters)
+		}
+		if req.EarlyStopping != nil {
+			pendingEarlyStopping.Store(trainingID, *req.EarlyStopping)
+		}
 
-		err := StartRemoteTraining(userEmail, trainingData)
+		chosenAgent, err := StartRemoteTraining(userEmail, placement.AgentID, trainingData)
 		if err != nil {
+			pendingAnomalyPolicies.Delete(trainingID)
+			pendingMetricPatterns.Delete(trainingID)
+			pendingHyperparameters.Delete(trainingID)
+			pendingEarlyStopping.Delete(trainingID)
+			agentSyncGrants.Delete(trainingID)
 			println("❌ [TRAINING] Failed to start remote training:", err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, &trainingStartError{Status: http.StatusInternalServerError, Message: err.Error()}
+		}
+
+		if err := repository.RecordModelTrainingRun(r.Context(), trainedModelID, int(userID), trainingID, trainingType, "", approvalID); err != nil {
+			println("⚠️  [TRAINING] Failed to record training run:", err.Error())
+		} else {
+			recordRunSnapshot(trainingID, req.FolderName, trainingHyperparameters(req))
 		}
 
-		println("✅ [TRAINING] Training request sent to agent successfully!")
+		println("✅ [TRAINING] Training request sent to agent", chosenAgent, "successfully!")
 		println("🆔 [TRAINING] Training ID:", trainingID)
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success":     true,
-			"message":     "Training started on your local agent",
-			"remote":      true,
-			"training_id": trainingID,
-		})
+		return map[string]interface{}{
+			"success":          true,
+			"message":          "Training started on your local agent",
+			"remote":           true,
+			"agent_id":         chosenAgent,
+			"training_id":      trainingID,
+			"placement":        placement,
+			"dataset_warnings": datasetWarnings,
+		}, nil
 	} else {
 		// Server training: use server's trainer
 		println("🖥️  [TRAINING] Starting training on server...")
@@ -188,29 +300,103 @@ func (h *TrainingHandler) StartTraining(w http.ResponseWriter, r *http.Request)
 		trainer := h.agent.GetTrainer()
 		// Set user ID in request
 		req.UserID = int(userID)
+		req.AnomalyPolicy = &anomalyPolicy
+		req.MetricPatterns = metricPatterns
+		// Trainings never run with more network than the user's organizations allow
+		networkPolicy, err := trainingNetworkPolicy(r.Context(), int(userID))
+		if err != nil {
+			println("❌ [TRAINING] Failed to load the network policy:", err.Error())
+			return nil, &trainingStartError{Status: http.StatusInternalServerError, Message: "Failed to load the training network policy"}
+		}
+		req.NetworkPolicy = &networkPolicy
+
+		// Credits are metered when the training ends; refuse trainings the balance is not expected to cover
+		estimate, err := estimateTrainingCredits(r.Context(), trainer, trainedModelID, req.ExecutionMode)
+		if err != nil {
+			println("❌ [TRAINING] Failed to estimate credits:", err.Error())
+			return nil, &trainingStartError{Status: http.StatusInternalServerError, Message: "Failed to estimate the training cost"}
+		}
+		// The estimate is held from the balance until the training ends and its credits are metered
+		reservationID := 0
+		if getStringField(*user, "subscription_tier", TierFree) != TierEnterprise {
+			// Models shared with one of the user's organizations are paid from its credit pool first
+			orgID, err := trainingCreditOrganization(r.Context(), trainedModelID, int(userID))
+			if err != nil {
+				println("⚠️  [TRAINING] Failed to check the organization credit pool:", err.Error())
+			}
+			reservationID, err = reserveTrainingCredits(r.Context(), int(userID), orgID, estimate)
+			if errors.Is(err, repository.ErrInsufficientCredits) {
+				println("❌ [TRAINING] Estimated credits exceed the balance")
+				remaining := getIntField(*user, "training_credits", 0)
+				return nil, &trainingStartError{Status: http.StatusForbidden, Code: apierrors.CodeInsufficientCredits,
+					Message: fmt.Sprintf("This training is estimated to cost %.2f credits and you have %d left", estimate.Credits, remaining),
+					Details: map[string]interface{}{"credit_estimate": estimate, "remaining_credits": remaining}}
+			}
+			if err != nil {
+				println("❌ [TRAINING] Failed to reserve credits:", err.Error())
+				return nil, &trainingStartError{Status: http.StatusInternalServerError, Message: "Failed to reserve training credits"}
+			}
+		}
+
+		// Read before the trainer starts, which may add to req.Env
+		hyperparameters := trainingHyperparameters(req)
 		progress, err := trainer.StartTraining(ctx, req)
 		if err != nil {
 			println("❌ [TRAINING] Failed to start:", err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			refundTrainingCredits(reservationID, "Training failed to start")
+			status := http.StatusInternalServerError
+			if errors.Is(err, aiAgent.ErrShuttingDown) {
+				status = http.StatusServiceUnavailable
+			}
+			return nil, &trainingStartError{Status: status, Message: err.Error()}
+		}
+		if reservationID != 0 {
+			if err := repository.AttachCreditReservation(r.Context(), reservationID, progress.TrainingID); err != nil {
+				println("⚠️  [TRAINING] Failed to attach the credit reservation:", err.Error())
+			}
+		}
+
+		if err := repository.RecordModelTrainingRun(r.Context(), trainedModelID, int(userID), progress.TrainingID, trainingType, progress.ExecutionMode, approvalID); err != nil {
+			println("⚠️  [TRAINING] Failed to record training run:", err.Error())
+			// Unrecorded runs are never metered, so they cost nothing
+			refundTrainingCredits(reservationID, "Training was not recorded")
+		} else {
+			recordRunSnapshot(progress.TrainingID, req.FolderName, hyperparameters)
+			// Kept so the training can be restarted from one of its checkpoints
+			if request, err := json.Marshal(req); err == nil {
+				if err := repository.SetTrainingRunRequest(r.Context(), progress.TrainingID, request); err != nil {
+					println("⚠️  [TRAINING] Failed to record the request:", err.Error())
+				}
+			}
+			if policy := progress.NetworkPolicy; policy != nil {
+				if err := repository.SetTrainingRunNetworkPolicy(r.Context(), progress.TrainingID, policy.Mode, policy.AllowedHosts); err != nil {
+					println("⚠️  [TRAINING] Failed to record the network policy:", err.Error())
+				}
+			}
+		}
+		if err := repository.SetTrainingRunCreditEstimate(r.Context(), progress.TrainingID, estimate.HardwareTier, estimate.Credits); err != nil {
+			println("⚠️  [TRAINING] Failed to record the credit estimate:", err.Error())
 		}
 
 		println("✅ [TRAINING] Training started successfully on server!")
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success":  true,
-			"message":  "Training started on server",
-			"progress": progress,
-			"remote":   false,
-		})
+		return map[string]interface{}{
+			"success":          true,
+			"message":          "Training started on server",
+			"progress":         progress,
+			"remote":           false,
+			"training_id":      progress.TrainingID,
+			"credit_estimate":  estimate,
+			"placement":        placement,
+			"dataset_warnings": datasetWarnings,
+		}, nil
 	}
 }
 
 // GetTrainingProgress handles requests to get training progress
 func (h *TrainingHandler) GetTrainingProgress(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -225,39 +411,39 @@ func (h *TrainingHandler) GetTrainingProgress(w http.ResponseWriter, r *http.Req
 	// Get authenticated user
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Get user from database
 	user, err := repository.GetUserByEmail(r.Context(), userEmail)
 	if err != nil || user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
 	userID, ok := (*user)["id"].(int32)
 	if !ok {
-		http.Error(w, "Invalid user ID", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Invalid user ID")
 		return
 	}
 
 	trainer := GetGlobalTrainer()
 	if trainer == nil {
-		http.Error(w, "Training system not initialized", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Training system not initialized")
 		return
 	}
 	progress, err := trainer.GetProgress(trainingID)
 	if err != nil {
 		println("❌ [PROGRESS] Training not found:", trainingID)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, err.Error())
 		return
 	}
 
 	// Security check: ensure user owns this training
 	if progress.UserID != int(userID) {
 		println("❌ [PROGRESS] User", userID, "attempted to access training", trainingID, "owned by user", progress.UserID)
-		http.Error(w, "Forbidden: You don't have permission to access this training", http.StatusForbidden)
+		apierrors.Respond(w, http.StatusForbidden, "Forbidden: You don't have permission to access this training")
 		return
 	}
 
@@ -278,20 +464,20 @@ func (h *TrainingHandler) getAllTrainings(w http.ResponseWriter, r *http.Request
 	// Get authenticated user
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Get user from database
 	user, err := repository.GetUserByEmail(r.Context(), userEmail)
 	if err != nil || user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
 	userID, ok := (*user)["id"].(int32)
 	if !ok {
-		http.Error(w, "Invalid user ID", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Invalid user ID")
 		return
 	}
 
@@ -320,7 +506,7 @@ func (h *TrainingHandler) getAllTrainings(w http.ResponseWriter, r *http.Request
 // AnalyzeResults handles requests to analyze training results
 func (h *TrainingHandler) AnalyzeResults(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -330,57 +516,57 @@ func (h *TrainingHandler) AnalyzeResults(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if requestBody.TrainingID == "" {
-		http.Error(w, "training_id is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "training_id is required")
 		return
 	}
 
 	// Get authenticated user
 	userEmail, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Get user from database
 	user, err := repository.GetUserByEmail(r.Context(), userEmail)
 	if err != nil || user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
 	userID, ok := (*user)["id"].(int32)
 	if !ok {
-		http.Error(w, "Invalid user ID", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Invalid user ID")
 		return
 	}
 
 	// Get training progress
 	trainer := GetGlobalTrainer()
 	if trainer == nil {
-		http.Error(w, "Training system not initialized", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Training system not initialized")
 		return
 	}
 	progress, err := trainer.GetProgress(requestBody.TrainingID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, err.Error())
 		return
 	}
 
 	// Security check: ensure user owns this training
 	if progress.UserID != int(userID) {
 		println("❌ [ANALYZE] User", userID, "attempted to analyze training", requestBody.TrainingID, "owned by user", progress.UserID)
-		http.Error(w, "Forbidden: You don't have permission to analyze this training", http.StatusForbidden)
+		apierrors.Respond(w, http.StatusForbidden, "Forbidden: You don't have permission to analyze this training")
 		return
 	}
 
 	// Check if training is complete
 	if progress.Status != aiAgent.StatusCompleted && progress.Status != aiAgent.StatusFailed {
-		http.Error(w, "Training is still in progress", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Training is still in progress")
 		return
 	}
 
@@ -426,7 +612,7 @@ func (h *TrainingHandler) AnalyzeResults(w http.ResponseWriter, r *http.Request)
 // CleanupOldTrainings handles cleanup of old training records
 func (h *TrainingHandler) CleanupOldTrainings(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -442,3 +628,14 @@ func (h *TrainingHandler) CleanupOldTrainings(w http.ResponseWriter, r *http.Req
 		"message": "Cleanup completed",
 	})
 }
+
+// GetGPUStatus returns the server GPUs and how many trainings each one is running
+func (h *TrainingHandler) GetGPUStatus(w http.ResponseWriter, r *http.Request) {
+	gpus := h.agent.GetTrainer().GPUStatus()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"gpus":    gpus,
+	})
+}
@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+	"server/internal/ws"
+)
+
+// Training types used by training permissions
+const (
+	TrainingTypeServer = "server"
+	TrainingTypeAgent  = "agent"
+)
+
+// Training policies for model_training_settings
+const (
+	TrainingPolicyOwner   = "owner"
+	TrainingPolicyMembers = "members"
+)
+
+// trainingPermissionError describes why a training was not allowed
+type trainingPermissionError struct {
+	Status           int
+	Message          string
+	ApprovalRequired bool
+}
+
+// authorizeModelTraining checks whether userID may start a training of the given type on a model.
+// Owners are always allowed. Members are checked against the model's policy and, for server
+// trainings, their monthly cap. Collaborators with the train role skip the policy but not the cap. If the cap is reached an approved request is needed; its ID is returned
+// and it is only used up once the training starts and its run is recorded.
+func authorizeModelTraining(ctx context.Context, model map[string]interface{}, userID int, trainingType string) (*int, *trainingPermissionError) {
+	modelID := getIntField(model, "id", 0)
+	if getIntField(model, "user_id", 0) == userID {
+		return nil, nil
+	}
+
+	member, err := repository.GetModelTrainingMember(ctx, modelID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to check training membership for model %d: %v", modelID, err)
+		return nil, &trainingPermissionError{Status: http.StatusInternalServerError, Message: "Failed to check training permissions"}
+	}
+	collaborator := false
+	if member == nil {
+		role, err := repository.GetModelCollaboratorRole(ctx, modelID, userID)
+		if err != nil {
+			log.Printf("❌ Failed to check collaborator role for model %d: %v", modelID, err)
+			return nil, &trainingPermissionError{Status: http.StatusInternalServerError, Message: "Failed to check training permissions"}
+		}
+		switch role {
+		case CollaboratorRoleTrain:
+			// The owner granted training explicitly, only the default monthly cap applies
+			member = map[string]interface{}{}
+			collaborator = true
+		case CollaboratorRoleRead:
+			return nil, &trainingPermissionError{Status: http.StatusForbidden, Message: "You can only view this model; ask the owner for train access"}
+		default:
+			return nil, &trainingPermissionError{Status: http.StatusForbidden, Message: "You don't have access to train this model"}
+		}
+	}
+
+	settings, err := repository.GetModelTrainingSettings(ctx, modelID)
+	if err != nil {
+		log.Printf("❌ Failed to get training settings for model %d: %v", modelID, err)
+		return nil, &trainingPermissionError{Status: http.StatusInternalServerError, Message: "Failed to check training permissions"}
+	}
+
+	policy := getStringField(settings, trainingType+"_training_policy", TrainingPolicyOwner)
+	if !collaborator && policy != TrainingPolicyMembers {
+		return nil, &trainingPermissionError{
+			Status:  http.StatusForbidden,
+			Message: fmt.Sprintf("Only the model owner can start %s trainings on this model", trainingType),
+		}
+	}
+
+	// Monthly caps only apply to server trainings, which consume credits
+	if trainingType != TrainingTypeServer {
+		return nil, nil
+	}
+
+	monthlyCap := getIntField(member, "monthly_cap", -1)
+	if monthlyCap < 0 {
+		monthlyCap = getIntField(settings, "default_monthly_cap", -1)
+	}
+	if monthlyCap < 0 {
+		return nil, nil
+	}
+
+	used, err := repository.CountMonthlyTrainingRuns(ctx, modelID, userID, trainingType)
+	if err != nil {
+		log.Printf("❌ Failed to count training runs for model %d: %v", modelID, err)
+		return nil, &trainingPermissionError{Status: http.StatusInternalServerError, Message: "Failed to check training permissions"}
+	}
+	if used < monthlyCap {
+		return nil, nil
+	}
+
+	approvalID, err := repository.FindTrainingApproval(ctx, modelID, userID, trainingType)
+	if err != nil {
+		log.Printf("❌ Failed to find training approval for model %d: %v", modelID, err)
+		return nil, &trainingPermissionError{Status: http.StatusInternalServerError, Message: "Failed to check training permissions"}
+	}
+	if approvalID != nil {
+		log.Printf("✅ Using approval %d for user %d over cap on model %d", *approvalID, userID, modelID)
+		return approvalID, nil
+	}
+
+	return nil, &trainingPermissionError{
+		Status:           http.StatusForbidden,
+		Message:          fmt.Sprintf("You've reached your monthly cap of %d server trainings for this model. Request approval from the owner to continue.", monthlyCap),
+		ApprovalRequired: true,
+	}
+}
+
+// getModelForOwner loads the model from the URL and verifies the current user owns it
+func getModelForOwner(w http.ResponseWriter, r *http.Request) (map[string]interface{}, int, bool) {
+	model, userID, ok := getModelForTrainer(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+	if getIntField(model, "user_id", 0) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the model owner can manage training permissions")
+		return nil, 0, false
+	}
+	return model, userID, true
+}
+
+// getModelForTrainer loads the model from the URL and verifies the current user owns it, is a member
+// or collaborates on it with the train role
+func getModelForTrainer(w http.ResponseWriter, r *http.Request) (map[string]interface{}, int, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, 0, false
+	}
+
+	modelID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return nil, 0, false
+	}
+
+	model, err := repository.GetModelByID(r.Context(), modelID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return nil, 0, false
+		}
+		log.Printf("❌ Failed to get model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get model")
+		return nil, 0, false
+	}
+
+	if getIntField(*model, "user_id", 0) != userID {
+		member, err := repository.GetModelTrainingMember(r.Context(), modelID, userID)
+		if err != nil {
+			log.Printf("❌ Failed to check training membership for model %d: %v", modelID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to check training permissions")
+			return nil, 0, false
+		}
+		if member == nil {
+			role, err := repository.GetModelCollaboratorRole(r.Context(), modelID, userID)
+			if err != nil {
+				log.Printf("❌ Failed to check collaborator role for model %d: %v", modelID, err)
+				apierrors.Respond(w, http.StatusInternalServerError, "Failed to check training permissions")
+				return nil, 0, false
+			}
+			if role == CollaboratorRoleRead {
+				apierrors.Respond(w, http.StatusForbidden, "You can only view this model; ask the owner for train access")
+				return nil, 0, false
+			}
+			if role != CollaboratorRoleTrain {
+				apierrors.Respond(w, http.StatusNotFound, "Model not found")
+				return nil, 0, false
+			}
+		}
+	}
+
+	return *model, userID, true
+}
+
+// GetModelTrainingSettingsHandler returns training settings, members and pending approvals for a model
+func GetModelTrainingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	settings, err := repository.GetModelTrainingSettings(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to get training settings for model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get training settings")
+		return
+	}
+
+	members, err := repository.GetModelTrainingMembers(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to get training members for model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get training members")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"settings": settings,
+		"members":  members,
+	})
+}
+
+// UpdateModelTrainingSettingsHandler updates who may start trainings on a model and how the
+// anomaly detector treats its trainings
+func UpdateModelTrainingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	var req struct {
+		ServerTrainingPolicy string `json:"server_training_policy"`
+		AgentTrainingPolicy  string `json:"agent_training_policy"`
+		DefaultMonthlyCap    *int   `json:"default_monthly_cap"`
+
+		AnomalyAutoStop        *bool    `json:"anomaly_auto_stop"`
+		AnomalyFrozenEpochs    *int     `json:"anomaly_frozen_epochs"`
+		AnomalyExplodingFactor *float64 `json:"anomaly_exploding_factor"`
+		AnomalyAccuracyDrop    *float64 `json:"anomaly_accuracy_drop"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	current, err := repository.GetModelTrainingSettings(r.Context(), modelID)
+	if err != nil {
+		log.Printf("❌ Failed to get training settings for model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get training settings")
+		return
+	}
+	if req.ServerTrainingPolicy == "" {
+		req.ServerTrainingPolicy = getStringField(current, "server_training_policy", TrainingPolicyOwner)
+	}
+	if req.AgentTrainingPolicy == "" {
+		req.AgentTrainingPolicy = getStringField(current, "agent_training_policy", TrainingPolicyMembers)
+	}
+
+	for _, policy := range []string{req.ServerTrainingPolicy, req.AgentTrainingPolicy} {
+		if policy != TrainingPolicyOwner && policy != TrainingPolicyMembers {
+			apierrors.Respond(w, http.StatusBadRequest, "Training policy must be 'owner' or 'members'")
+			return
+		}
+	}
+	if req.DefaultMonthlyCap != nil && *req.DefaultMonthlyCap < 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "default_monthly_cap cannot be negative")
+		return
+	}
+	if req.AnomalyFrozenEpochs != nil && *req.AnomalyFrozenEpochs < 2 {
+		apierrors.Respond(w, http.StatusBadRequest, "anomaly_frozen_epochs must be at least 2")
+		return
+	}
+	if req.AnomalyExplodingFactor != nil && *req.AnomalyExplodingFactor <= 1 {
+		apierrors.Respond(w, http.StatusBadRequest, "anomaly_exploding_factor must be greater than 1")
+		return
+	}
+	if req.AnomalyAccuracyDrop != nil && (*req.AnomalyAccuracyDrop <= 0 || *req.AnomalyAccuracyDrop >= 1) {
+		apierrors.Respond(w, http.StatusBadRequest, "anomaly_accuracy_drop must be between 0 and 1")
+		return
+	}
+
+	if err := repository.UpsertModelTrainingSettings(r.Context(), modelID, req.ServerTrainingPolicy, req.AgentTrainingPolicy, req.DefaultMonthlyCap); err != nil {
+		log.Printf("❌ Failed to update training settings for model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update training settings")
+		return
+	}
+
+	if req.AnomalyAutoStop != nil || req.AnomalyFrozenEpochs != nil || req.AnomalyExplodingFactor != nil || req.AnomalyAccuracyDrop != nil {
+		policy := modelAnomalyPolicy(r.Context(), modelID)
+		if req.AnomalyAutoStop != nil {
+			policy.AutoStop = *req.AnomalyAutoStop
+		}
+		if req.AnomalyFrozenEpochs != nil {
+			policy.FrozenEpochs = *req.AnomalyFrozenEpochs
+		}
+		if req.AnomalyExplodingFactor != nil {
+			policy.ExplodingFactor = *req.AnomalyExplodingFactor
+		}
+		if req.AnomalyAccuracyDrop != nil {
+			policy.AccuracyDrop = *req.AnomalyAccuracyDrop
+		}
+		if err := repository.UpsertModelAnomalyPolicy(r.Context(), modelID, policy.AutoStop, policy.FrozenEpochs, policy.ExplodingFactor, policy.AccuracyDrop); err != nil {
+			log.Printf("❌ Failed to update anomaly policy for model %d: %v", modelID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to update training settings")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Training settings updated",
+	})
+}
+
+// AddModelTrainingMemberHandler lets another user train a model, optionally with a monthly cap
+func AddModelTrainingMemberHandler(w http.ResponseWriter, r *http.Request) {
+	model, ownerID, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	var req struct {
+		Email      string `json:"email"`
+		Username   string `json:"username"`
+		MonthlyCap *int   `json:"monthly_cap"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.MonthlyCap != nil && *req.MonthlyCap < 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "monthly_cap cannot be negative")
+		return
+	}
+
+	var member *map[string]interface{}
+	var err error
+	switch {
+	case req.Email != "":
+		member, err = repository.GetUserByEmail(r.Context(), req.Email)
+	case req.Username != "":
+		member, err = repository.GetUserByUsername(r.Context(), req.Username)
+	default:
+		apierrors.Respond(w, http.StatusBadRequest, "email or username is required")
+		return
+	}
+	if err != nil || member == nil {
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	memberID := getIntField(*member, "id", 0)
+	if memberID == ownerID {
+		apierrors.Respond(w, http.StatusBadRequest, "You already own this model")
+		return
+	}
+
+	if err := repository.UpsertModelTrainingMember(r.Context(), modelID, memberID, req.MonthlyCap); err != nil {
+		log.Printf("❌ Failed to add training member to model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to add member")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"user_id": memberID,
+	})
+}
+
+// UpdateModelTrainingMemberHandler changes a member's monthly training cap
+func UpdateModelTrainingMemberHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	memberID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req struct {
+		MonthlyCap *int `json:"monthly_cap"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.MonthlyCap != nil && *req.MonthlyCap < 0 {
+		apierrors.Respond(w, http.StatusBadRequest, "monthly_cap cannot be negative")
+		return
+	}
+
+	existing, err := repository.GetModelTrainingMember(r.Context(), modelID, memberID)
+	if err != nil {
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get member")
+		return
+	}
+	if existing == nil {
+		apierrors.Respond(w, http.StatusNotFound, "Member not found")
+		return
+	}
+
+	if err := repository.UpsertModelTrainingMember(r.Context(), modelID, memberID, req.MonthlyCap); err != nil {
+		log.Printf("❌ Failed to update training member on model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update member")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Member updated",
+	})
+}
+
+// RemoveModelTrainingMemberHandler revokes a member's access to train a model
+func RemoveModelTrainingMemberHandler(w http.ResponseWriter, r *http.Request) {
+	model, _, ok := getModelForOwner(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	memberID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := repository.RemoveModelTrainingMember(r.Context(), modelID, memberID); err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Member not found")
+			return
+		}
+		log.Printf("❌ Failed to remove training member from model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Member removed",
+	})
+}
+
+// CreateTrainingApprovalHandler lets a member ask the owner for a training over their cap
+func CreateTrainingApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	model, userID, ok := getModelForTrainer(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+	ownerID := getIntField(model, "user_id", 0)
+
+	if ownerID == userID {
+		apierrors.Respond(w, http.StatusBadRequest, "Owners don't need approval to train their models")
+		return
+	}
+
+	var req struct {
+		TrainingType string `json:"training_type"`
+		Reason       string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.TrainingType == "" {
+		req.TrainingType = TrainingTypeServer
+	}
+	if req.TrainingType != TrainingTypeServer && req.TrainingType != TrainingTypeAgent {
+		apierrors.Respond(w, http.StatusBadRequest, "training_type must be 'server' or 'agent'")
+		return
+	}
+
+	pending, err := repository.HasPendingTrainingApproval(r.Context(), modelID, userID, req.TrainingType)
+	if err != nil {
+		log.Printf("❌ Failed to check pending approvals for model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create approval request")
+		return
+	}
+	if pending {
+		apierrors.Respond(w, http.StatusConflict, "You already have a pending approval request for this model")
+		return
+	}
+
+	requestID, err := repository.CreateTrainingApprovalRequest(r.Context(), modelID, userID, req.TrainingType, req.Reason)
+	if err != nil {
+		log.Printf("❌ Failed to create approval request for model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create approval request")
+		return
+	}
+
+	ws.BroadcastToUser(ownerID, map[string]interface{}{
+		"type": "training_approval_requested",
+		"data": map[string]interface{}{
+			"request_id":    requestID,
+			"model_id":      modelID,
+			"model_name":    model["name"],
+			"requester_id":  userID,
+			"training_type": req.TrainingType,
+			"reason":        req.Reason,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"request_id": requestID,
+	})
+}
+
+// GetTrainingApprovalsHandler lists approval requests for a model.
+// Owners see every request, members only see their own.
+func GetTrainingApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	model, userID, ok := getModelForTrainer(w, r)
+	if !ok {
+		return
+	}
+	modelID := getIntField(model, "id", 0)
+
+	requesterID := userID
+	if getIntField(model, "user_id", 0) == userID {
+		requesterID = 0
+	}
+
+	requests, err := repository.GetTrainingApprovalRequests(r.Context(), modelID, requesterID)
+	if err != nil {
+		log.Printf("❌ Failed to get approval requests for model %d: %v", modelID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get approval requests")
+		return
+	}
+	if requests == nil {
+		requests = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"requests": requests,
+	})
+}
+
+// ApproveTrainingRequestHandler approves a pending training approval request
+func ApproveTrainingRequestHandler(w http.ResponseWriter, r *http.Request) {
+	decideTrainingRequest(w, r, "approved")
+}
+
+// RejectTrainingRequestHandler rejects a pending training approval request
+func RejectTrainingRequestHandler(w http.ResponseWriter, r *http.Request) {
+	decideTrainingRequest(w, r, "rejected")
+}
+
+func decideTrainingRequest(w http.ResponseWriter, r *http.Request, status string) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	requestID, err := strconv.Atoi(chi.URLParam(r, "requestId"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request ID")
+		return
+	}
+
+	request, err := repository.GetTrainingApprovalRequest(r.Context(), requestID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Approval request not found")
+			return
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get approval request")
+		return
+	}
+
+	modelID := getIntField(request, "model_id", 0)
+	model, err := repository.GetModelByID(r.Context(), modelID)
+	if err != nil || getIntField(*model, "user_id", 0) != userID {
+		apierrors.Respond(w, http.StatusNotFound, "Approval request not found")
+		return
+	}
+
+	if err := repository.DecideTrainingApprovalRequest(r.Context(), requestID, userID, status); err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusConflict, "Approval request has already been decided")
+			return
+		}
+		log.Printf("❌ Failed to decide approval request %d: %v", requestID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to update approval request")
+		return
+	}
+
+	ws.BroadcastToUser(getIntField(request, "requester_id", 0), map[string]interface{}{
+		"type": "training_approval_decided",
+		"data": map[string]interface{}{
+			"request_id": requestID,
+			"model_id":   modelID,
+			"model_name": (*model)["name"],
+			"status":     status,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"status":  status,
+	})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// restartableTraining reports whether a training can be restarted from a checkpoint: it must have
+// stopped without completing. Trainings the server no longer tracks stopped long ago.
+func restartableTraining(trainingID string) bool {
+	trainer := GetGlobalTrainer()
+	if trainer == nil {
+		return true
+	}
+	progress, err := trainer.GetProgress(trainingID)
+	if err != nil {
+		return true
+	}
+	status := progress.Snapshot().Status
+	return status == aiAgent.StatusFailed || status == aiAgent.StatusInterrupted
+}
+
+// GetTrainingCheckpointsHandler lists the kept checkpoints of one of the user's server trainings,
+// oldest first
+func GetTrainingCheckpointsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	trainingID := chi.URLParam(r, "id")
+
+	if _, err := repository.GetTrainingRunRequest(r.Context(), trainingID, userID); err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Training not found")
+		return
+	} else if err != nil {
+		log.Printf("❌ Failed to get training %s: %v", trainingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve checkpoints")
+		return
+	}
+
+	checkpoints, err := repository.GetTrainingCheckpoints(r.Context(), trainingID)
+	if err != nil {
+		log.Printf("❌ Failed to get checkpoints of training %s: %v", trainingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve checkpoints")
+		return
+	}
+	if checkpoints == nil {
+		checkpoints = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"training_id": trainingID,
+		"checkpoints": checkpoints,
+		"restartable": len(checkpoints) > 0 && restartableTraining(trainingID),
+	})
+}
+
+// RestartTrainingHandler starts a failed or cancelled server training again from one of its
+// checkpoints, the latest unless the body names one: {"checkpoint": "<path>"}. The script gets the
+// checkpoint in CHECKPOINT_PATH and AIMANAGE_RESUME_CHECKPOINT. The restarted training is a new
+// training that is authorized and charged like any other.
+func (h *TrainingHandler) RestartTrainingHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	userEmail, _ := r.Context().Value(middlewares.UserEmailKey).(string)
+	trainingID := chi.URLParam(r, "id")
+
+	var body struct {
+		Checkpoint string `json:"checkpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	run, err := repository.GetTrainingRunRequest(r.Context(), trainingID, userID)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "Training not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get training %s: %v", trainingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to restart training")
+		return
+	}
+	if !restartableTraining(trainingID) {
+		apierrors.Respond(w, http.StatusConflict, "Only failed or cancelled trainings can be restarted")
+		return
+	}
+
+	checkpoints, err := repository.GetTrainingCheckpoints(r.Context(), trainingID)
+	if err != nil {
+		log.Printf("❌ Failed to get checkpoints of training %s: %v", trainingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to restart training")
+		return
+	}
+	checkpoint := ""
+	for _, c := range checkpoints {
+		path := getStringField(c, "path", "")
+		if body.Checkpoint == "" || path == body.Checkpoint {
+			checkpoint = path
+		}
+	}
+	if checkpoint == "" {
+		apierrors.Respond(w, http.StatusNotFound, "Checkpoint not found")
+		return
+	}
+
+	var req aiAgent.TrainingRequest
+	raw, err := json.Marshal(run["request"])
+	if err == nil && run["request"] != nil {
+		err = json.Unmarshal(raw, &req)
+	}
+	modelID := getIntField(run, "model_id", 0)
+	if run["request"] == nil || err != nil || modelID == 0 {
+		apierrors.Respond(w, http.StatusConflict, "This training cannot be restarted, start a new one")
+		return
+	}
+	req.ModelID = modelID
+	req.FolderName = ""
+
+	env := make(map[string]string, len(req.Env)+3)
+	for key, val := range req.Env {
+		env[key] = val
+	}
+	resumes, _ := strconv.Atoi(env[aiAgent.ResumeCountEnv])
+	env[aiAgent.CheckpointPathEnv] = checkpoint
+	env[aiAgent.ResumeCheckpointEnv] = checkpoint
+	env[aiAgent.ResumeCountEnv] = strconv.Itoa(resumes + 1)
+	req.Env = env
+	// The checkpoint is a file on the server
+	req.Placement = PlacementServer
+
+	result, startErr := h.startTraining(r, userEmail, req)
+	if startErr != nil {
+		startErr.write(w)
+		return
+	}
+	log.Printf("▶️  User %d restarted training %s from checkpoint %s as %s", userID, trainingID, checkpoint, getStringField(result, "training_id", ""))
+
+	result["restarted_from"] = trainingID
+	result["checkpoint"] = checkpoint
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+)
+
+const (
+	// defaultLogPageLines and maxLogPageLines bound the lines of a page of training logs
+	defaultLogPageLines = 500
+	maxLogPageLines     = 5000
+	// logStreamPoll is how often a log stream checks for new lines
+	logStreamPoll = 500 * time.Millisecond
+	// logStreamKeepAlive is how often an idle log stream sends a comment to keep its connection open
+	logStreamKeepAlive = 15 * time.Second
+)
+
+// trainingFinished reports whether a training will not log any more lines
+func trainingFinished(status aiAgent.TrainingStatus) bool {
+	return status == aiAgent.StatusCompleted || status == aiAgent.StatusFailed
+}
+
+// GetTrainingLogsHandler returns the log lines of one of the user's trainings, a page at a time:
+// ?since=N starts at line N (0 is the first) and ?limit caps the lines (500 by default, at most 5000).
+// ?tail=N returns the last N lines instead. Follow "next" to get the lines logged since.
+// With ?stream=true, or an Accept header of text/event-stream, the lines are sent as server-sent
+// events until the training ends, resuming after the Last-Event-ID header on reconnects.
+func GetTrainingLogsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	trainingID := chi.URLParam(r, "id")
+
+	trainer := GetGlobalTrainer()
+	if trainer == nil {
+		apierrors.Respond(w, http.StatusInternalServerError, "Training system not initialized")
+		return
+	}
+	progress, err := trainer.GetProgress(trainingID)
+	if err != nil || progress.UserID != userID {
+		apierrors.Respond(w, http.StatusNotFound, "Training not found")
+		return
+	}
+
+	query := r.URL.Query()
+	since := 0
+	if value := query.Get("since"); value != "" {
+		if since, err = strconv.Atoi(value); err != nil || since < 0 {
+			apierrors.Respond(w, http.StatusBadRequest, "since must be a line number")
+			return
+		}
+	}
+	limit := defaultLogPageLines
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			apierrors.Respond(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		if limit > maxLogPageLines {
+			limit = maxLogPageLines
+		}
+	}
+	if value := query.Get("tail"); value != "" {
+		tail, err := strconv.Atoi(value)
+		if err != nil || tail < 1 {
+			apierrors.Respond(w, http.StatusBadRequest, "tail must be a positive number")
+			return
+		}
+		if tail < limit {
+			limit = tail
+		}
+		if since = progress.LogLines() - limit; since < 0 {
+			since = 0
+		}
+	}
+
+	if query.Get("stream") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		if lastID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && lastID >= 0 {
+			since = lastID
+		}
+		streamTrainingLogs(w, r, trainingID, progress, since)
+		return
+	}
+
+	status := progress.Snapshot().Status
+	lines, total, err := progress.ReadLogs(since, limit)
+	if err != nil {
+		log.Printf("❌ Failed to read the logs of training %s: %v", trainingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to read the training logs")
+		return
+	}
+	next := since + len(lines)
+	if since > total {
+		next = total
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"training_id": trainingID,
+		"lines":       lines,
+		"since":       since,
+		"next":        next,
+		"total":       total,
+		"status":      status,
+		"done":        trainingFinished(status) && next >= total,
+	})
+}
+
+// streamTrainingLogs sends the log lines of a training from line since as server-sent "log"
+// events whose ID is the number of the next line, then an "end" event once the training ended
+func streamTrainingLogs(w http.ResponseWriter, r *http.Request, trainingID string, progress *aiAgent.TrainingProgress, since int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierrors.Respond(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Proxies must not buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(logStreamPoll)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	next := since
+	for {
+		// Read the status first so that lines logged before the training ended are all sent
+		status := progress.Snapshot().Status
+		lines, total, err := progress.ReadLogs(next, maxLogPageLines)
+		if err != nil {
+			log.Printf("❌ Failed to stream the logs of training %s: %v", trainingID, err)
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", "Failed to read the training logs")
+			flusher.Flush()
+			return
+		}
+		for _, line := range lines {
+			next++
+			fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", next, strings.ReplaceAll(line, "\r", ""))
+		}
+		if len(lines) > 0 {
+			flusher.Flush()
+			lastWrite = time.Now()
+			if next < total {
+				continue
+			}
+		}
+		if trainingFinished(status) && next >= total {
+			data, _ := json.Marshal(map[string]interface{}{"status": status, "total": total})
+			fmt.Fprintf(w, "event: end\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
+		}
+		if time.Since(lastWrite) >= logStreamKeepAlive {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+			lastWrite = time.Now()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
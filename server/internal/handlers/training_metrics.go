@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+// customMetricName keeps custom metric names usable as label values in PromQL queries
+var customMetricName = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// trainingStatuses are reported as one series each so dashboards can count runs per status
+var trainingStatuses = []aiAgent.TrainingStatus{
+	aiAgent.StatusPending,
+	aiAgent.StatusRunning,
+	aiAgent.StatusCompleted,
+	aiAgent.StatusFailed,
+	aiAgent.StatusPreempted,
+}
+
+// promGauge is one gauge family of the exposition: its help text and a sample per training
+type promGauge struct {
+	name    string
+	help    string
+	samples []string
+}
+
+func (g *promGauge) add(labels string, value float64) {
+	g.samples = append(g.samples, fmt.Sprintf("%s{%s} %s", g.name, labels, strconv.FormatFloat(value, 'g', -1, 64)))
+}
+
+// promLabelValue escapes a label value for the Prometheus text format
+func promLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// readAPIKeyUser authenticates a read-only integration by the account or read-only API key, or a
+// named key with the read-models scope, sent as a Bearer token. It writes the error response and
+// returns false when the key is invalid.
+func readAPIKeyUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	apiKey := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if apiKey == "" {
+		apierrors.Respond(w, http.StatusUnauthorized, "API key required")
+		return 0, false
+	}
+	userID, err := repository.GetUserIDByReadAPIKey(r.Context(), apiKey)
+	if err != nil {
+		log.Printf("❌ Failed to check API key: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to check API key")
+		return 0, false
+	}
+	if userID == 0 {
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid API key")
+		return 0, false
+	}
+	return userID, true
+}
+
+// GetTrainingMetricsHandler exposes the caller's trainings as Prometheus gauges labeled by
+// training_id and model. Scrapers authenticate with an account or read-only API key as a Bearer token.
+func GetTrainingMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := readAPIKeyUser(w, r)
+	if !ok {
+		return
+	}
+
+	trainer := GetGlobalTrainer()
+	if trainer == nil {
+		apierrors.Respond(w, http.StatusInternalServerError, "Training system not initialized")
+		return
+	}
+
+	epoch := &promGauge{name: "aimanage_training_epoch", help: "Current epoch of the training."}
+	totalEpochs := &promGauge{name: "aimanage_training_total_epochs", help: "Number of epochs the training will run."}
+	trainLoss := &promGauge{name: "aimanage_training_train_loss", help: "Latest reported training loss."}
+	valLoss := &promGauge{name: "aimanage_training_val_loss", help: "Latest reported validation loss."}
+	trainAccuracy := &promGauge{name: "aimanage_training_train_accuracy", help: "Latest reported training accuracy."}
+	valAccuracy := &promGauge{name: "aimanage_training_val_accuracy", help: "Latest reported validation accuracy."}
+	testAccuracy := &promGauge{name: "aimanage_training_test_accuracy", help: "Latest reported test accuracy."}
+	custom := &promGauge{name: "aimanage_training_custom_metric", help: "Latest numeric custom metric reported by the training script."}
+	status := &promGauge{name: "aimanage_training_status", help: "1 for the current status of the training, 0 for the others."}
+	startTime := &promGauge{name: "aimanage_training_start_time_seconds", help: "Unix time the training started."}
+	preemptions := &promGauge{name: "aimanage_training_preemptions", help: "Times a preemptible training was evicted."}
+
+	trainings := trainer.GetTrainingsByUserID(userID)
+	ids := make([]string, 0, len(trainings))
+	for id := range trainings {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		snapshot := trainings[id].Snapshot()
+		labels := fmt.Sprintf(`training_id="%s",model="%s"`, promLabelValue(id), promLabelValue(aiAgent.ModelNameFromTrainingID(id)))
+
+		epoch.add(labels, float64(snapshot.CurrentEpoch))
+		totalEpochs.add(labels, float64(snapshot.TotalEpochs))
+		startTime.add(labels, float64(snapshot.StartTime.Unix()))
+		preemptions.add(labels, float64(snapshot.Preemptions))
+		for _, s := range trainingStatuses {
+			value := 0.0
+			if snapshot.Status == s {
+				value = 1
+			}
+			status.add(fmt.Sprintf(`%s,status="%s"`, labels, s), value)
+		}
+
+		// Metrics a script never reported are left out rather than exported as zero
+		if m := snapshot.Latest; m != nil {
+			for gauge, value := range map[*promGauge]float64{
+				trainLoss:     m.TrainLoss,
+				valLoss:       m.ValLoss,
+				trainAccuracy: m.TrainAccuracy,
+				valAccuracy:   m.ValAccuracy,
+				testAccuracy:  m.TestAccuracy,
+			} {
+				if value != 0 {
+					gauge.add(labels, value)
+				}
+			}
+
+			names := make([]string, 0, len(m.CustomMetrics))
+			for name := range m.CustomMetrics {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if value, ok := m.CustomMetrics[name].(float64); ok {
+					custom.add(fmt.Sprintf(`%s,name="%s"`, labels, customMetricName.ReplaceAllString(name, "_")), value)
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, gauge := range []*promGauge{epoch, totalEpochs, trainLoss, valLoss, trainAccuracy, valAccuracy, testAccuracy, custom, status, startTime, preemptions} {
+		if len(gauge.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, sample := range gauge.samples {
+			fmt.Fprintln(w, sample)
+		}
+	}
+}
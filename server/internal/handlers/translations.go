@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/aiAgent"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+const (
+	// TranslationLanguagesEnv lists the locales listing descriptions are machine translated into on
+	// publish, e.g. "fr,de,es,ja". Machine translation is off when it is empty or GEMINI_API_KEY is unset.
+	TranslationLanguagesEnv = "TRANSLATION_LANGUAGES"
+	// TranslationSourceLanguageEnv is the locale publishers write descriptions in (default "en")
+	TranslationSourceLanguageEnv = "TRANSLATION_SOURCE_LANGUAGE"
+)
+
+// localePattern matches the BCP 47 tags accepted for translations: a language with an optional region or script
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// normalizeLocale lowercases a locale tag and uses "-" as separator. It returns "" for invalid tags.
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if !localePattern.MatchString(locale) {
+		return ""
+	}
+	return locale
+}
+
+// translationSourceLanguage returns the locale listing descriptions are written in
+func translationSourceLanguage() string {
+	if locale := normalizeLocale(os.Getenv(TranslationSourceLanguageEnv)); locale != "" {
+		return locale
+	}
+	return "en"
+}
+
+// translationLanguages returns the configured target locales, without the source language
+func translationLanguages() []string {
+	source := translationSourceLanguage()
+	var locales []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(os.Getenv(TranslationLanguagesEnv), ",") {
+		locale := normalizeLocale(part)
+		if locale == "" || locale == source || seen[locale] {
+			continue
+		}
+		seen[locale] = true
+		locales = append(locales, locale)
+	}
+	return locales
+}
+
+// machineTranslator returns the Gemini client used for listing translations, or nil when machine translation is off
+func machineTranslator() *aiAgent.GeminiClient {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" || len(translationLanguages()) == 0 {
+		return nil
+	}
+	return aiAgent.NewGeminiClient(apiKey)
+}
+
+// translateListing machine translates a listing's descriptions into the given locales, or every
+// configured locale when none are given. Publisher translations are left untouched.
+func translateListing(listingID int, description, shortDescription string, locales ...string) {
+	client := machineTranslator()
+	if client == nil {
+		return
+	}
+	if len(locales) == 0 {
+		locales = translationLanguages()
+	}
+
+	ctx := context.Background()
+	source := translationSourceLanguage()
+	text := aiAgent.ListingText{Description: description, ShortDescription: shortDescription}
+	translated := 0
+	for _, locale := range locales {
+		result, err := client.TranslateListing(text, source, locale)
+		if err != nil {
+			log.Printf("⚠️ Failed to translate listing %d into %s: %v", listingID, locale, err)
+			continue
+		}
+		if err := repository.SaveMachineTranslation(ctx, listingID, locale, result.Description, result.ShortDescription); err != nil {
+			log.Printf("❌ Failed to save %s translation of listing %d: %v", locale, listingID, err)
+			continue
+		}
+		translated++
+	}
+	log.Printf("🌐 Translated listing %d into %d/%d locales", listingID, translated, len(locales))
+}
+
+// requestedLocales returns the locales a request asks for, best first: the "locale" query
+// parameter if set, otherwise the Accept-Language header ordered by quality
+func requestedLocales(r *http.Request) []string {
+	if locale := normalizeLocale(r.URL.Query().Get("locale")); locale != "" {
+		return []string{locale}
+	}
+
+	type weighted struct {
+		locale  string
+		quality float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+		locale := normalizeLocale(fields[0])
+		if locale == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if v, err := strconv.ParseFloat(q, 64); err == nil {
+					quality = v
+				}
+			}
+		}
+		if quality > 0 {
+			tags = append(tags, weighted{locale, quality})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+
+	locales := make([]string, len(tags))
+	for i, tag := range tags {
+		locales[i] = tag.locale
+	}
+	return locales
+}
+
+// negotiateLocale picks the best of the available translation locales for a request. It returns
+// "" when the request prefers the source language or none of the available locales.
+func negotiateLocale(r *http.Request, available []string) string {
+	source := translationSourceLanguage()
+	primary := func(locale string) string {
+		language, _, _ := strings.Cut(locale, "-")
+		return language
+	}
+	for _, requested := range requestedLocales(r) {
+		if requested == source || primary(requested) == source {
+			return ""
+		}
+		for _, locale := range available {
+			if locale == requested {
+				return locale
+			}
+		}
+		// "fr-ch" falls back to "fr"
+		for _, locale := range available {
+			if locale == primary(requested) {
+				return locale
+			}
+		}
+	}
+	return ""
+}
+
+// applyTranslation replaces a listing's descriptions with a translation and records its locale
+func applyTranslation(listing map[string]interface{}, translation map[string]interface{}) {
+	if translation == nil {
+		listing["locale"] = translationSourceLanguage()
+		listing["translated"] = false
+		return
+	}
+	listing["description"] = translation["description"]
+	if short, ok := translation["short_description"].(string); ok && short != "" {
+		listing["short_description"] = short
+	}
+	listing["locale"] = translation["locale"]
+	listing["translated"] = true
+	listing["translation_source"] = translation["source"]
+}
+
+// localizeListing serves a listing in the best locale for the request, listing the available locales
+func localizeListing(w http.ResponseWriter, r *http.Request, listing map[string]interface{}) {
+	w.Header().Add("Vary", "Accept-Language")
+
+	listingID := getIntField(listing, "id", 0)
+	translations, err := repository.GetListingTranslations(r.Context(), listingID)
+	if err != nil {
+		log.Printf("⚠️ Failed to get translations of listing %d: %v", listingID, err)
+	}
+
+	available := make([]string, 0, len(translations))
+	for _, translation := range translations {
+		available = append(available, getStringField(translation, "locale", ""))
+	}
+	listing["available_locales"] = append([]string{translationSourceLanguage()}, available...)
+
+	var chosen map[string]interface{}
+	if locale := negotiateLocale(r, available); locale != "" {
+		for _, translation := range translations {
+			if translation["locale"] == locale {
+				chosen = translation
+			}
+		}
+	}
+	applyTranslation(listing, chosen)
+}
+
+// localizeListings serves marketplace listings in the best locale for the request
+func localizeListings(w http.ResponseWriter, r *http.Request, listings []map[string]interface{}) {
+	w.Header().Add("Vary", "Accept-Language")
+
+	available, err := repository.GetTranslationLocales(r.Context())
+	if err != nil {
+		log.Printf("⚠️ Failed to get translation locales: %v", err)
+	}
+	locale := negotiateLocale(r, available)
+
+	var translations map[int]map[string]interface{}
+	if locale != "" {
+		if translations, err = repository.GetTranslationsByLocale(r.Context(), locale); err != nil {
+			log.Printf("⚠️ Failed to get %s translations: %v", locale, err)
+		}
+	}
+	for _, listing := range listings {
+		applyTranslation(listing, translations[getIntField(listing, "id", 0)])
+	}
+}
+
+// publisherListing loads the listing in the URL and checks the caller published it
+func publisherListing(w http.ResponseWriter, r *http.Request) (int, map[string]interface{}, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return 0, nil, false
+	}
+
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return 0, nil, false
+	}
+
+	listing, err := repository.GetPublishedModelByID(r.Context(), listingID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			apierrors.Respond(w, http.StatusNotFound, "Model not found")
+			return 0, nil, false
+		}
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve model")
+		return 0, nil, false
+	}
+	if publisherID, _ := listing["publisher_id"].(int32); int(publisherID) != userID {
+		apierrors.Respond(w, http.StatusForbidden, "Only the publisher can manage translations of this listing")
+		return 0, nil, false
+	}
+	return listingID, listing, true
+}
+
+// GetListingTranslationsHandler lists a listing's translations for its publisher
+func GetListingTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, _, ok := publisherListing(w, r)
+	if !ok {
+		return
+	}
+
+	translations, err := repository.GetListingTranslations(r.Context(), listingID)
+	if err != nil {
+		log.Printf("❌ Failed to get translations of listing %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve translations")
+		return
+	}
+	if translations == nil {
+		translations = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":             true,
+		"source_locale":       translationSourceLanguage(),
+		"configured_locales":  translationLanguages(),
+		"machine_translation": machineTranslator() != nil,
+		"translations":        translations,
+	})
+}
+
+// PutListingTranslationHandler saves the publisher's own translation for a locale. Publisher
+// translations replace machine translations and are never regenerated.
+func PutListingTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, _, ok := publisherListing(w, r)
+	if !ok {
+		return
+	}
+
+	locale := normalizeLocale(chi.URLParam(r, "locale"))
+	if locale == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid locale")
+		return
+	}
+	if locale == translationSourceLanguage() {
+		apierrors.Respond(w, http.StatusBadRequest, "Edit the listing itself to change the source language description")
+		return
+	}
+
+	var req struct {
+		Description      string `json:"description"`
+		ShortDescription string `json:"short_description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Description) == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "description is required")
+		return
+	}
+	if len(req.ShortDescription) > 500 {
+		apierrors.Respond(w, http.StatusBadRequest, "short_description must be at most 500 characters")
+		return
+	}
+
+	if err := repository.SavePublisherTranslation(r.Context(), listingID, locale, req.Description, req.ShortDescription); err != nil {
+		log.Printf("❌ Failed to save %s translation of listing %d: %v", locale, listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save translation")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"model_id": listingID,
+		"locale":   locale,
+		"source":   repository.TranslationSourcePublisher,
+	})
+}
+
+// DeleteListingTranslationHandler deletes a listing's translation for a locale. Configured
+// locales are machine translated again.
+func DeleteListingTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, listing, ok := publisherListing(w, r)
+	if !ok {
+		return
+	}
+
+	locale := normalizeLocale(chi.URLParam(r, "locale"))
+	if locale == "" {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid locale")
+		return
+	}
+
+	deleted, err := repository.DeleteListingTranslation(r.Context(), listingID, locale)
+	if err != nil {
+		log.Printf("❌ Failed to delete %s translation of listing %d: %v", locale, listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to delete translation")
+		return
+	}
+	if !deleted {
+		apierrors.Respond(w, http.StatusNotFound, "Translation not found")
+		return
+	}
+
+	retranslating := false
+	for _, configured := range translationLanguages() {
+		if configured == locale && machineTranslator() != nil {
+			retranslating = true
+			go translateListing(listingID, getStringField(listing, "description", ""), getStringField(listing, "short_description", ""), locale)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"model_id":      listingID,
+		"locale":        locale,
+		"retranslating": retranslating,
+	})
+}
+
+// RefreshListingTranslationsHandler machine translates a listing again into every configured locale
+func RefreshListingTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, listing, ok := publisherListing(w, r)
+	if !ok {
+		return
+	}
+	if machineTranslator() == nil {
+		apierrors.Respond(w, http.StatusServiceUnavailable, "Machine translation is not enabled")
+		return
+	}
+
+	go translateListing(listingID, getStringField(listing, "description", ""), getStringField(listing, "short_description", ""))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"model_id": listingID,
+		"locales":  translationLanguages(),
+	})
+}
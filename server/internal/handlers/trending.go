@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Trending score settings
+const (
+	// TrendingIntervalEnv is how often, in minutes, trending scores are recomputed (default 30)
+	TrendingIntervalEnv = "TRENDING_INTERVAL_MINUTES"
+	// TrendingHalfLifeEnv is after how many hours a download, like or view counts half (default 48)
+	TrendingHalfLifeEnv = "TRENDING_HALF_LIFE_HOURS"
+	// TrendingWindowEnv is after how many days events stop counting (default 14)
+	TrendingWindowEnv = "TRENDING_WINDOW_DAYS"
+)
+
+const (
+	defaultSimilarListings = 6
+	maxSimilarListings     = 20
+)
+
+// trendingWeights are the weights of the trending score: a download is worth three views, a like
+// two, and a release starts at the weight of a few downloads
+func trendingWeights() repository.TrendingWeights {
+	return repository.TrendingWeights{
+		Download:      3,
+		Like:          2,
+		View:          1,
+		Release:       10,
+		HalfLifeHours: float64(envInt(TrendingHalfLifeEnv, 48)),
+		WindowDays:    envInt(TrendingWindowEnv, 14),
+	}
+}
+
+// StartTrendingScores computes the trending score of listings at startup and then every
+// TRENDING_INTERVAL_MINUTES
+func StartTrendingScores() {
+	interval := time.Duration(envInt(TrendingIntervalEnv, 30)) * time.Minute
+	go func() {
+		for {
+			updated, err := repository.RefreshTrendingScores(context.Background(), trendingWeights())
+			if err != nil {
+				log.Printf("⚠️  Trending scores failed: %v", err)
+			} else {
+				log.Printf("📈 Refreshed trending scores of %d listings", updated)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Marketplace orders of the sort query parameter
+var marketplaceSorts = map[string]func(a, b map[string]interface{}) bool{
+	"trending": func(a, b map[string]interface{}) bool {
+		return getFloatField(a, "trending_score", 0) > getFloatField(b, "trending_score", 0)
+	},
+	"newest": func(a, b map[string]interface{}) bool {
+		at, _ := a["published_at"].(time.Time)
+		bt, _ := b["published_at"].(time.Time)
+		return at.After(bt)
+	},
+	"rating": func(a, b map[string]interface{}) bool {
+		return getFloatField(a, "rating_average", 0) > getFloatField(b, "rating_average", 0)
+	},
+	"downloads": func(a, b map[string]interface{}) bool {
+		return getIntField(a, "downloads_count", 0) > getIntField(b, "downloads_count", 0)
+	},
+}
+
+// sortListings orders marketplace listings by ?sort= (trending, newest, rating or downloads).
+// Listings come most trending first, so the default keeps their order.
+func sortListings(r *http.Request, listings []map[string]interface{}) error {
+	order := r.URL.Query().Get("sort")
+	if order == "" || order == "trending" {
+		return nil
+	}
+	less, ok := marketplaceSorts[order]
+	if !ok {
+		return fmt.Errorf("sort must be trending, newest, rating or downloads")
+	}
+	sort.SliceStable(listings, func(i, j int) bool { return less(listings[i], listings[j]) })
+	return nil
+}
+
+// GetTrendingModelsHandler returns a page of the marketplace listings with the highest trending
+// score: recent downloads, likes and views, and recent releases, weighted by how recent they are.
+// ?category= narrows it down.
+func GetTrendingModelsHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+	category := r.URL.Query().Get("category")
+
+	page, pageSize := parsePagination(r)
+	listings, total, err := repository.GetTrendingListings(r.Context(), viewerID, category, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("❌ Failed to get trending models: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve trending models")
+		return
+	}
+	if listings == nil {
+		listings = []map[string]interface{}{}
+	}
+	markSavedListings(r, listings, viewerID)
+	localizeListings(w, r, listings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"models":    listings,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// GetSimilarModelsHandler returns the listings most similar to a listing by shared tags,
+// category, framework and model type (?limit=, 6 by default)
+func GetSimilarModelsHandler(w http.ResponseWriter, r *http.Request) {
+	listingID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+	limit := defaultSimilarListings
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			apierrors.Respond(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		if limit > maxSimilarListings {
+			limit = maxSimilarListings
+		}
+	}
+	viewerID, _ := r.Context().Value(middlewares.UserIDKey).(int)
+
+	listings, err := repository.GetSimilarListings(r.Context(), listingID, viewerID, limit)
+	if err != nil {
+		log.Printf("❌ Failed to get models similar to %d: %v", listingID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve similar models")
+		return
+	}
+	if listings == nil {
+		listings = []map[string]interface{}{}
+	}
+	markSavedListings(r, listings, viewerID)
+	localizeListings(w, r, listings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"model_id": listingID,
+		"models":   listings,
+	})
+}
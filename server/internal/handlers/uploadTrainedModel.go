@@ -8,14 +8,16 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"server/internal/apierrors"
 	"server/internal/repository"
 )
 
 // UploadTrainedModelHandler handles uploading trained model files from agents
 func UploadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -25,7 +27,7 @@ func UploadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		log.Println("❌ [UPLOAD] No Authorization header")
-		http.Error(w, "API key required", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "API key required")
 		return
 	}
 
@@ -35,30 +37,55 @@ func UploadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 		apiKey = authHeader[7:]
 	}
 
-	// Validate API key
-	user, err := repository.GetUserByApiKey(r.Context(), apiKey)
-	if err != nil || user == nil {
-		log.Printf("❌ [UPLOAD] Invalid API key")
-		http.Error(w, "Invalid API key", http.StatusUnauthorized)
-		return
+	// Project tokens from CI pipelines may only upload their own model
+	tokenModel := ""
+	if strings.HasPrefix(apiKey, projectTokenPrefix) {
+		token, ok := authenticateProjectToken(r.Context(), w, apiKey, ProjectScopeModelUpload)
+		if !ok {
+			log.Printf("❌ [UPLOAD] Invalid project token")
+			return
+		}
+		tokenModel = getStringField(token, "model_name", "")
+		log.Printf("✅ [UPLOAD] Authenticated project token %d for model: %s", getIntField(token, "id", 0), tokenModel)
+	} else {
+		// Validate API key
+		user, err := repository.GetUserByApiKey(r.Context(), apiKey)
+		if err != nil || user == nil {
+			log.Printf("❌ [UPLOAD] Invalid API key")
+			apierrors.Respond(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		if !apiKeyHasScope(*user, APIKeyScopeAgentConnect) {
+			log.Printf("❌ [UPLOAD] API key lacks the %s scope", APIKeyScopeAgentConnect)
+			apierrors.Respond(w, http.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", APIKeyScopeAgentConnect))
+			return
+		}
+
+		userEmail, _ := (*user)["email"].(string)
+		log.Printf("✅ [UPLOAD] Authenticated user: %s", userEmail)
 	}
 
-	userEmail, _ := (*user)["email"].(string)
-	log.Printf("✅ [UPLOAD] Authenticated user: %s", userEmail)
-
 	// Parse multipart form (max 500MB for model files)
-	err = r.ParseMultipartForm(500 << 20)
+	err := r.ParseMultipartForm(500 << 20)
 	if err != nil {
 		log.Printf("❌ [UPLOAD] Failed to parse form: %v", err)
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "Failed to parse form")
 		return
 	}
 
 	// Get model name
 	modelName := r.FormValue("model_name")
+	if tokenModel != "" {
+		if modelName != "" && modelName != tokenModel {
+			log.Printf("❌ [UPLOAD] Project token of %s cannot upload %s", tokenModel, modelName)
+			apierrors.Respond(w, http.StatusForbidden, "Project token cannot upload this model")
+			return
+		}
+		modelName = tokenModel
+	}
 	if modelName == "" {
 		log.Println("❌ [UPLOAD] Model name is required")
-		http.Error(w, "model_name is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model_name is required")
 		return
 	}
 
@@ -70,18 +97,25 @@ func UploadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	file, header, err := r.FormFile("model_file")
 	if err != nil {
 		log.Printf("❌ [UPLOAD] No file uploaded: %v", err)
-		http.Error(w, "model_file is required", http.StatusBadRequest)
+		apierrors.Respond(w, http.StatusBadRequest, "model_file is required")
 		return
 	}
 	defer file.Close()
 
 	log.Printf("📦 [UPLOAD] File: %s (%.2f MB)", header.Filename, float64(header.Size)/(1024*1024))
 
+	// ONNX exports of a trained model are stored next to it and leave its path as it is
+	isONNXExport := r.FormValue("format") == DownloadFormatONNX
+	if isONNXExport && !strings.EqualFold(filepath.Ext(header.Filename), ".onnx") {
+		apierrors.Respond(w, http.StatusBadRequest, "ONNX exports must be .onnx files")
+		return
+	}
+
 	// Create uploads directory for this model
 	modelDir := filepath.Join("./uploads", modelName)
 	if err := os.MkdirAll(modelDir, os.ModePerm); err != nil {
 		log.Printf("❌ [UPLOAD] Failed to create directory: %v", err)
-		http.Error(w, "Failed to create directory", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to create directory")
 		return
 	}
 
@@ -90,7 +124,7 @@ func UploadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	destFile, err := os.Create(destPath)
 	if err != nil {
 		log.Printf("❌ [UPLOAD] Failed to create file: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save file")
 		return
 	}
 	defer destFile.Close()
@@ -99,7 +133,7 @@ func UploadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 	bytesWritten, err := io.Copy(destFile, file)
 	if err != nil {
 		log.Printf("❌ [UPLOAD] Failed to write file: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to save file")
 		return
 	}
 
@@ -111,7 +145,9 @@ func UploadTrainedModelHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Update database with trained model path
 	ctx := context.Background()
-	if err := repository.UpdateTrainedModelPath(ctx, modelName, relativePath); err != nil {
+	if isONNXExport {
+		log.Printf("✅ [UPLOAD] Stored ONNX export of model: %s", modelName)
+	} else if err := repository.UpdateTrainedModelPath(ctx, modelName, relativePath); err != nil {
 		log.Printf("⚠️  [UPLOAD] Failed to update database: %v", err)
 		// Don't fail the request - file is already uploaded
 	} else {
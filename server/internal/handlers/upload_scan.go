@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"server/helpers"
+	"server/internal/apierrors"
+	"server/internal/repository"
+)
+
+const (
+	// ClamAVAddressEnv is the clamd daemon uploads are scanned with, host:port or a unix socket path.
+	// Without it only file types are checked.
+	ClamAVAddressEnv = "CLAMAV_ADDRESS"
+	// ClamAVMaxFileMBEnv is the largest file sent to clamd, in MB (default 100). It must not exceed
+	// clamd's StreamMaxLength; larger files are only checked for their type.
+	ClamAVMaxFileMBEnv = "CLAMAV_MAX_FILE_MB"
+	// UploadBlockedExtensionsEnv replaces the default comma-separated list of file extensions
+	// rejected in uploaded archives
+	UploadBlockedExtensionsEnv = "UPLOAD_BLOCKED_EXTENSIONS"
+	// UploadMaxUncompressedMBEnv and UploadMaxFilesEnv bound what an uploaded archive may extract
+	// to (default 10240 MB and 100000 entries)
+	UploadMaxUncompressedMBEnv = "UPLOAD_MAX_UNCOMPRESSED_MB"
+	UploadMaxFilesEnv          = "UPLOAD_MAX_FILES"
+)
+
+// clamdTimeout bounds the scan of a single file
+const clamdTimeout = 2 * time.Minute
+
+// uploadQuarantineDir holds rejected archives for admins to inspect. Like staging it starts with
+// a dot, so storage reconciliation leaves it alone.
+var uploadQuarantineDir = filepath.Join("./uploads", ".quarantine")
+
+// defaultBlockedExtensions are executables and scripts for other platforms than the Python
+// trainings, which have no place in a model archive
+var defaultBlockedExtensions = []string{
+	".exe", ".dll", ".so", ".dylib", ".scr", ".com", ".msi", ".bat", ".cmd",
+	".ps1", ".vbs", ".vbe", ".wsf", ".hta", ".lnk", ".jar", ".apk",
+}
+
+// executableMagics are the first bytes of native executables, whatever their file name
+var executableMagics = map[string][]byte{
+	"ELF executable":     {0x7f, 'E', 'L', 'F'},
+	"Windows executable": {'M', 'Z'},
+	"Mach-O executable":  {0xcf, 0xfa, 0xed, 0xfe},
+	"Mach-O binary":      {0xce, 0xfa, 0xed, 0xfe},
+}
+
+// UploadScanner checks uploaded files for malware
+type UploadScanner interface {
+	// Name identifies the scanner in the scan results of models, e.g. "clamav"
+	Name() string
+	// ScanFile returns the name of the threat found in the file, empty if none was
+	ScanFile(ctx context.Context, path string) (string, error)
+}
+
+var (
+	uploadScanner     UploadScanner
+	uploadScannerOnce sync.Once
+)
+
+// SetUploadScanner replaces the scanner configured by CLAMAV_ADDRESS; nil only checks file types
+func SetUploadScanner(scanner UploadScanner) {
+	uploadScannerOnce.Do(func() {})
+	uploadScanner = scanner
+}
+
+// configuredUploadScanner returns the scanner uploads are checked with, nil if there is none
+func configuredUploadScanner() UploadScanner {
+	uploadScannerOnce.Do(func() {
+		address := os.Getenv(ClamAVAddressEnv)
+		if address == "" {
+			log.Printf("⚠️  %s not set, uploaded archives are only checked for dangerous file types", ClamAVAddressEnv)
+			return
+		}
+		network := "tcp"
+		if strings.HasPrefix(address, "/") {
+			network = "unix"
+		}
+		uploadScanner = &clamdScanner{network: network, address: address}
+	})
+	return uploadScanner
+}
+
+// clamdScanner streams files to a clamd daemon with its INSTREAM command
+type clamdScanner struct {
+	network string
+	address string
+}
+
+func (s *clamdScanner) Name() string { return "clamav" }
+
+func (s *clamdScanner) ScanFile(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clamdTimeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	// The stream is a sequence of chunks, each preceded by its big-endian length, ended by an empty one
+	chunk := make([]byte, 64<<10)
+	for {
+		n, err := file.Read(chunk)
+		if n > 0 {
+			if err := binary.Write(conn, binary.BigEndian, uint32(n)); err != nil {
+				return "", fmt.Errorf("failed to send to clamd: %w", err)
+			}
+			if _, err := conn.Write(chunk[:n]); err != nil {
+				return "", fmt.Errorf("failed to send to clamd: %w", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := binary.Write(conn, binary.BigEndian, uint32(0)); err != nil {
+		return "", fmt.Errorf("failed to send to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	// Replies are "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+	reply = strings.TrimPrefix(strings.TrimRight(reply, "\x00\n"), "stream: ")
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd failed: %s", reply)
+	}
+}
+
+// uploadScan is the outcome recorded on the model an archive was uploaded for
+type uploadScan struct {
+	Status string
+	Engine string
+}
+
+// blockedExtensions returns the file extensions rejected in uploaded archives
+func blockedExtensions() []string {
+	raw := os.Getenv(UploadBlockedExtensionsEnv)
+	if raw == "" {
+		return defaultBlockedExtensions
+	}
+	var extensions []string
+	for _, ext := range strings.Split(raw, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+// uploadUnzipLimits returns the extraction limits of uploaded archives
+func uploadUnzipLimits() helpers.UnzipLimits {
+	return helpers.UnzipLimits{
+		MaxBytes: int64(envInt(UploadMaxUncompressedMBEnv, helpers.DefaultMaxUnzipBytes>>20)) << 20,
+		MaxFiles: envInt(UploadMaxFilesEnv, helpers.DefaultMaxUnzipFiles),
+	}
+}
+
+// inspectArchive returns why an archive must not be extracted: blocked file types or native
+// executables. It is empty for archives that pass. Paths, links and sizes are checked by
+// helpers.ValidateZip.
+func inspectArchive(zipPath string) (string, error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid zip: %w", err)
+	}
+	defer r.Close()
+
+	blocked := blockedExtensions()
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(filepath.ToSlash(f.Name)))
+		for _, b := range blocked {
+			if ext == b {
+				return fmt.Sprintf("%s has a blocked file type (%s)", f.Name, ext), nil
+			}
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		head := make([]byte, 4)
+		n, _ := io.ReadFull(rc, head)
+		rc.Close()
+		for kind, magic := range executableMagics {
+			if n >= len(magic) && string(head[:len(magic)]) == string(magic) {
+				return fmt.Sprintf("%s is a %s", f.Name, kind), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// quarantineUpload moves a rejected archive out of staging into the quarantine folder
+func quarantineUpload(zipPath string, userID int) (string, error) {
+	if err := os.MkdirAll(uploadQuarantineDir, 0o700); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(uploadQuarantineDir, fmt.Sprintf("%d-%d-%s", time.Now().Unix(), userID, filepath.Base(zipPath)))
+	if err := os.Rename(zipPath, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// rejectUpload quarantines an archive, records why in the audit log and answers 422, with the
+// validation report if the archive failed helpers.ValidateZip
+func rejectUpload(w http.ResponseWriter, r *http.Request, zipPath string, userID int, name, reason string, report *helpers.ZipReport) {
+	details := map[string]interface{}{"reason": reason, "filename": filepath.Base(zipPath)}
+	if report != nil {
+		details["issues"] = report.Issues
+	}
+	if dest, err := quarantineUpload(zipPath, userID); err != nil {
+		log.Printf("⚠️  Failed to quarantine %s: %v", zipPath, err)
+	} else {
+		details["quarantined_as"] = dest
+	}
+	log.Printf("🦠 Rejected upload of model %s by user %d: %s", name, userID, reason)
+	recordAudit(r, AuditUploadQuarantined, AuditTargetModel, name, details)
+
+	apiErr := apierrors.New(http.StatusUnprocessableEntity, apierrors.CodeUploadRejected, "Upload rejected: "+reason)
+	if report != nil {
+		apiErr = apiErr.WithDetails(map[string]interface{}{"validation": report})
+	}
+	apierrors.Write(w, apiErr)
+}
+
+// screenUploadedArchive checks an archive before it is extracted, answering the request and
+// returning false if it is rejected
+func screenUploadedArchive(w http.ResponseWriter, r *http.Request, zipPath string, userID int, name string) bool {
+	report, err := helpers.ValidateZip(zipPath, uploadUnzipLimits())
+	if err != nil {
+		log.Printf("❌ Could not read %s: %v", zipPath, err)
+		apierrors.Respond(w, http.StatusBadRequest, "Could not read model zip: "+err.Error())
+		return false
+	}
+	if !report.Valid() {
+		reason := report.Issues[0].Problem
+		if entry := report.Issues[0].Entry; entry != "" {
+			reason = entry + ": " + reason
+		}
+		rejectUpload(w, r, zipPath, userID, name, reason, report)
+		return false
+	}
+
+	reason, err := inspectArchive(zipPath)
+	if err != nil {
+		log.Printf("❌ Could not inspect %s: %v", zipPath, err)
+		apierrors.Respond(w, http.StatusBadRequest, "Could not read model zip: "+err.Error())
+		return false
+	}
+	if reason != "" {
+		rejectUpload(w, r, zipPath, userID, name, reason, nil)
+		return false
+	}
+	return true
+}
+
+// scanUploadedFiles runs the configured scanner over the files extracted from an archive to dir.
+// If it finds a threat, or is unavailable, the request is answered and ok is false.
+func scanUploadedFiles(w http.ResponseWriter, r *http.Request, zipPath, dir string, userID int, name string) (scan uploadScan, ok bool) {
+	scanner := configuredUploadScanner()
+	if scanner == nil {
+		return uploadScan{Status: repository.ModelScanUnscanned}, true
+	}
+
+	maxBytes := int64(envInt(ClamAVMaxFileMBEnv, 100)) << 20
+	var threat string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || path == zipPath {
+			return err
+		}
+		if info, err := d.Info(); err == nil && info.Size() > maxBytes {
+			log.Printf("ℹ️  %s is larger than %s, not scanned", path, ClamAVMaxFileMBEnv)
+			return nil
+		}
+		found, err := scanner.ScanFile(r.Context(), path)
+		if err != nil {
+			return err
+		}
+		if found != "" {
+			rel, _ := filepath.Rel(dir, path)
+			threat = fmt.Sprintf("%s contains %s", rel, found)
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Malware scan of model %s failed: %v", name, err)
+		apierrors.Respond(w, http.StatusServiceUnavailable, "Malware scanner unavailable, try again later")
+		return uploadScan{}, false
+	}
+	if threat != "" {
+		rejectUpload(w, r, zipPath, userID, name, threat, nil)
+		return uploadScan{}, false
+	}
+	return uploadScan{Status: repository.ModelScanClean, Engine: scanner.Name()}, true
+}
+
+// recordUploadScan stores the scan result on the model created from an upload
+func recordUploadScan(modelID int, scan uploadScan) {
+	if scan.Status == "" {
+		return
+	}
+	if err := repository.SetModelScanResult(context.Background(), modelID, scan.Status, scan.Engine); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+}
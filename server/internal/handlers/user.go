@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 
+	"server/internal/apierrors"
 	"server/internal/middlewares"
 	"server/internal/repository"
 )
@@ -17,7 +19,7 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 	email, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok || email == "" {
 		log.Println("❌ User email not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -25,12 +27,12 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := repository.GetUserByEmail(r.Context(), email)
 	if err != nil {
 		log.Println("❌ Failed to get user:", err)
-		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get user")
 		return
 	}
 	if user == nil {
 		log.Println("❌ User not found")
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
@@ -45,32 +47,35 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 			userID = int32(v)
 		default:
 			log.Println("❌ Invalid user ID type")
-			http.Error(w, "Invalid user ID", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Invalid user ID")
 			return
 		}
 	}
 
-	apiKey, ok := (*user)["api_key"].(string)
-	if !ok || apiKey == "" {
+	// API keys are only stored hashed, so the key itself is only returned when it is generated here
+	apiKey := ""
+	apiKeyPrefix, ok := (*user)["api_key_prefix"].(string)
+	if !ok || apiKeyPrefix == "" {
 		// Generate API key if missing
 		log.Printf("⚠️  User %s doesn't have an API key, generating one...", email)
 		newKey, err := repository.EnsureUserHasAPIKey(r.Context(), int(userID))
 		if err != nil {
 			log.Printf("❌ Failed to generate API key: %v", err)
 			// Continue with empty key rather than failing the request
-			apiKey = ""
-		} else {
+		} else if newKey != "" {
 			apiKey = newKey
+			apiKeyPrefix = repository.APIKeyPrefix(newKey)
 			log.Printf("✅ Generated API key for user: %s", email)
 		}
 	}
 
 	// Return user info (without password)
 	userInfo := map[string]interface{}{
-		"id":       (*user)["id"],
-		"email":    (*user)["email"],
-		"username": (*user)["username"],
-		"api_key":  apiKey,
+		"id":             (*user)["id"],
+		"email":          (*user)["email"],
+		"username":       (*user)["username"],
+		"api_key":        apiKey,
+		"api_key_prefix": apiKeyPrefix,
 	}
 
 	log.Printf("✅ Retrieved user info for: %s", email)
@@ -82,7 +87,7 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 // RegenerateAPIKeyHandler handles API key regeneration requests
 func RegenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -91,14 +96,14 @@ func RegenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user
 	email, ok := r.Context().Value(middlewares.UserEmailKey).(string)
 	if !ok || email == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Get user from database
 	user, err := repository.GetUserByEmail(r.Context(), email)
 	if err != nil || user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
 		return
 	}
 
@@ -112,7 +117,7 @@ func RegenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 			userID = int32(v)
 		default:
 			log.Println("❌ Invalid user ID type")
-			http.Error(w, "Invalid user ID", http.StatusInternalServerError)
+			apierrors.Respond(w, http.StatusInternalServerError, "Invalid user ID")
 			return
 		}
 	}
@@ -121,11 +126,12 @@ func RegenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 	newAPIKey, err := repository.RegenerateAPIKey(r.Context(), int(userID))
 	if err != nil {
 		log.Printf("❌ Failed to regenerate API key: %v", err)
-		http.Error(w, "Failed to regenerate API key", http.StatusInternalServerError)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to regenerate API key")
 		return
 	}
 
 	log.Printf("✅ Regenerated API key for user: %s", email)
+	recordAudit(r, AuditAPIKeyRegenerated, AuditTargetUser, strconv.Itoa(int(userID)), map[string]interface{}{"key": "full"})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -134,3 +140,51 @@ func RegenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 		"message": "API key regenerated successfully",
 	})
 }
+
+// GetReadOnlyAPIKeyHandler returns the prefix identifying the user's read-only API key ("" until
+// one is created). The key itself is only returned when it is regenerated.
+func GetReadOnlyAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	prefix, err := repository.GetReadOnlyAPIKeyPrefix(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get read-only API key: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to get read-only API key")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":                  true,
+		"read_only_api_key_prefix": prefix,
+	})
+}
+
+// RegenerateReadOnlyAPIKeyHandler creates or replaces the user's read-only API key.
+// Read-only keys can query training data (metrics, Grafana) but cannot upload models or connect agents.
+func RegenerateReadOnlyAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	apiKey, err := repository.RegenerateReadOnlyAPIKey(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to regenerate read-only API key: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to regenerate read-only API key")
+		return
+	}
+	recordAudit(r, AuditAPIKeyRegenerated, AuditTargetUser, strconv.Itoa(userID), map[string]interface{}{"key": "read_only"})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":           true,
+		"read_only_api_key": apiKey,
+		"message":           "Read-only API key regenerated successfully",
+	})
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/repository"
+)
+
+// Profile limits
+const (
+	maxBioLength  = 500
+	maxAvatarSize = 2 << 20 // 2 MB
+)
+
+// profileResponse renders the public fields of a user's profile
+func profileResponse(profile map[string]interface{}) map[string]interface{} {
+	avatarURL := ""
+	if avatar := getStringField(profile, "avatar_path", ""); avatar != "" {
+		avatarURL = "/uploads/" + avatar
+	}
+	return map[string]interface{}{
+		"id":           getIntField(profile, "id", 0),
+		"username":     profile["username"],
+		"bio":          getStringField(profile, "bio", ""),
+		"avatar_url":   avatarURL,
+		"member_since": profile["created_at"],
+	}
+}
+
+// GetUserProfileHandler returns a user's public profile: bio, avatar, member-since, their active
+// public listings in storefront order, and totals of downloads, ratings and followers. No
+// authentication is required; signed-in visitors also see whether they follow the user.
+func GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	profile, err := repository.GetPublicProfile(r.Context(), username)
+	if err == pgx.ErrNoRows {
+		apierrors.Respond(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to get profile of %s: %v", username, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve profile")
+		return
+	}
+	userID := getIntField(profile, "id", 0)
+
+	stats, err := repository.GetPublisherStats(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get publisher stats of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve profile")
+		return
+	}
+	listings, err := repository.GetStorefrontListings(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get listings of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve profile")
+		return
+	}
+	if stats["followers_count"], err = repository.CountFollowers(r.Context(), userID); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	// Signed-in visitors see whether they follow the user
+	following := false
+	if viewerID, ok := r.Context().Value(middlewares.UserIDKey).(int); ok && viewerID != userID {
+		if following, err = repository.IsFollowing(r.Context(), viewerID, userID); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+	published := []map[string]interface{}{}
+	for _, listing := range listings {
+		// Organization and private listings are not shown on the public profile
+		if getStringField(listing, "visibility", repository.ListingVisibilityPublic) == repository.ListingVisibilityPublic {
+			published = append(published, listing)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":          true,
+		"profile":          profileResponse(profile),
+		"stats":            stats,
+		"following":        following,
+		"published_models": published,
+	})
+}
+
+// GetMyProfileHandler returns the caller's profile for editing
+func GetMyProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	profile, err := repository.GetOwnProfile(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to get profile of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to retrieve profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"profile": profileResponse(profile),
+	})
+}
+
+// UpdateMyProfileHandler sets the caller's bio: {"bio": "..."}. An empty bio clears it.
+func UpdateMyProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Bio *string `json:"bio"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			apierrors.Respond(w, http.StatusBadRequest, fmt.Sprintf("bio cannot be longer than %d characters", maxBioLength))
+			return
+		}
+		if err := repository.UpdateUserBio(r.Context(), userID, bio); err != nil {
+			log.Printf("❌ Failed to update bio of user %d: %v", userID, err)
+			apierrors.Respond(w, http.StatusInternalServerError, "Failed to update profile")
+			return
+		}
+	}
+
+	GetMyProfileHandler(w, r)
+}
+
+// UploadAvatarHandler replaces the caller's avatar (multipart field "avatar")
+func UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+1<<20)
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		apierrors.Respond(w, http.StatusBadRequest, "An avatar image is required in the 'avatar' field (max 2 MB)")
+		return
+	}
+	defer file.Close()
+
+	// Avatars accept the same image types as storefront banners
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !bannerExtensions[ext] {
+		apierrors.Respond(w, http.StatusBadRequest, "avatar must be a JPEG, PNG or WebP image")
+		return
+	}
+	if header.Size > maxAvatarSize {
+		apierrors.Respond(w, http.StatusBadRequest, "avatar cannot be larger than 2 MB")
+		return
+	}
+
+	relDir := filepath.Join("avatars", fmt.Sprintf("%d", userID))
+	if err := os.MkdirAll(filepath.Join(uploadsBaseDir(), relDir), os.ModePerm); err != nil {
+		log.Printf("❌ Failed to create avatar directory: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not save avatar")
+		return
+	}
+	// A new name on every upload so CDNs and browsers do not serve the old avatar
+	relPath := filepath.Join(relDir, fmt.Sprintf("avatar-%d%s", time.Now().Unix(), ext))
+	out, err := os.Create(filepath.Join(uploadsBaseDir(), relPath))
+	if err != nil {
+		log.Printf("❌ Failed to create avatar file: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not save avatar")
+		return
+	}
+	if _, err := io.Copy(out, file); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		log.Printf("❌ Failed to write avatar file: %v", err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not save avatar")
+		return
+	}
+	out.Close()
+
+	relPath = filepath.ToSlash(relPath)
+	previous, err := repository.SetUserAvatar(r.Context(), userID, relPath)
+	if err != nil {
+		os.Remove(filepath.Join(uploadsBaseDir(), relPath))
+		log.Printf("❌ Failed to save avatar of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Could not save avatar")
+		return
+	}
+	if previous != "" && previous != relPath {
+		os.Remove(filepath.Join(uploadsBaseDir(), previous))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"avatar_url": "/uploads/" + relPath,
+	})
+}
+
+// DeleteAvatarHandler removes the caller's avatar
+func DeleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDKey).(int)
+	if !ok {
+		apierrors.Respond(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	previous, err := repository.SetUserAvatar(r.Context(), userID, "")
+	if err != nil {
+		log.Printf("❌ Failed to remove avatar of user %d: %v", userID, err)
+		apierrors.Respond(w, http.StatusInternalServerError, "Failed to remove avatar")
+		return
+	}
+	if previous != "" {
+		os.Remove(filepath.Join(uploadsBaseDir(), previous))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
@@ -0,0 +1,97 @@
+package metricparse
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Limits of a model's custom patterns
+const (
+	MaxPatterns      = 20
+	MaxPatternLength = 500
+)
+
+// Pattern is a custom regular expression of a model. Its named groups are the metrics it reads:
+// "epoch" and "total_epochs" are the epoch, names such as "val_loss" or "val_acc" fill the
+// standard metrics (see StandardName), and any other name is a custom metric. For example
+// `step (?P<epoch>\d+) .* mAP@0.5 (?P<map50>[0-9.]+)`.
+type Pattern struct {
+	Name    string `json:"name,omitempty"`
+	Pattern string `json:"pattern"`
+}
+
+// ValidatePatterns checks that custom patterns compile and read at least one metric
+func ValidatePatterns(patterns []Pattern) error {
+	_, err := compilePatterns(patterns)
+	return err
+}
+
+func compilePatterns(patterns []Pattern) ([]Parser, error) {
+	if len(patterns) > MaxPatterns {
+		return nil, fmt.Errorf("at most %d metric patterns are allowed", MaxPatterns)
+	}
+	parsers := make([]Parser, 0, len(patterns))
+	for i, pattern := range patterns {
+		name := pattern.Name
+		if name == "" {
+			name = fmt.Sprintf("pattern %d", i+1)
+		}
+		if pattern.Pattern == "" {
+			return nil, fmt.Errorf("%s: pattern is empty", name)
+		}
+		if len(pattern.Pattern) > MaxPatternLength {
+			return nil, fmt.Errorf("%s: pattern is longer than %d characters", name, MaxPatternLength)
+		}
+		re, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		metrics := 0
+		for _, group := range re.SubexpNames() {
+			if group != "" {
+				metrics++
+			}
+		}
+		if metrics == 0 {
+			return nil, fmt.Errorf("%s: pattern has no named group such as (?P<val_loss>[0-9.]+)", name)
+		}
+		parsers = append(parsers, &customParser{name: name, re: re})
+	}
+	return parsers, nil
+}
+
+// customParser reads the named groups of a model's pattern
+type customParser struct {
+	name string
+	re   *regexp.Regexp
+}
+
+func (p *customParser) Name() string { return "custom: " + p.name }
+
+func (p *customParser) Parse(line string) (*Result, bool) {
+	matches := p.re.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, false
+	}
+	result := &Result{Values: map[string]float64{}}
+	for i, group := range p.re.SubexpNames() {
+		if group == "" || matches[i] == "" {
+			continue
+		}
+		switch group {
+		case "epoch":
+			result.Epoch, _ = strconv.Atoi(matches[i])
+		case "total_epochs":
+			result.TotalEpochs, _ = strconv.Atoi(matches[i])
+		default:
+			if v, ok := parseValue(matches[i]); ok {
+				result.Values[StandardName(group)] = v
+			}
+		}
+	}
+	if result.Epoch == 0 && len(result.Values) == 0 {
+		return nil, false
+	}
+	return result, true
+}
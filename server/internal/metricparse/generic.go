@@ -0,0 +1,52 @@
+package metricparse
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	// Epoch 1/10 or Epoch 1:10
+	genericEpochPattern = regexp.MustCompile(`Epoch\s+(\d+)[/:](\d+)`)
+	// Train Loss: 0.5432 or loss: 0.5432
+	genericLossPattern = regexp.MustCompile(`(?i)(train\s*)?loss[:\s]+([0-9.]+)`)
+	// Val Loss: 0.4321 or validation loss: 0.4321
+	genericValLossPattern = regexp.MustCompile(`(?i)(val|validation)\s*loss[:\s]+([0-9.]+)`)
+	// Accuracy: 0.95 or Train Accuracy: 95%
+	genericAccuracyPattern = regexp.MustCompile(`(?i)(train\s*)?acc(?:uracy)?[:\s]+([0-9.]+)%?`)
+	// Val Accuracy: 0.93
+	genericValAccuracyPattern = regexp.MustCompile(`(?i)(val|validation)\s*acc(?:uracy)?[:\s]+([0-9.]+)%?`)
+)
+
+// genericParser reads lines like "Epoch 1/10, Train Loss: 0.5432, Val Accuracy: 93%" that
+// hand-written training loops print
+type genericParser struct{}
+
+func (genericParser) Name() string { return "generic" }
+
+func (genericParser) Parse(line string) (*Result, bool) {
+	result := &Result{Values: map[string]float64{}}
+
+	if matches := genericEpochPattern.FindStringSubmatch(line); len(matches) == 3 {
+		result.Epoch, _ = strconv.Atoi(matches[1])
+		result.TotalEpochs, _ = strconv.Atoi(matches[2])
+	}
+	for name, pattern := range map[string]*regexp.Regexp{
+		TrainLoss:     genericLossPattern,
+		ValLoss:       genericValLossPattern,
+		TrainAccuracy: genericAccuracyPattern,
+		ValAccuracy:   genericValAccuracyPattern,
+	} {
+		if matches := pattern.FindStringSubmatch(line); len(matches) == 3 {
+			if v, err := strconv.ParseFloat(matches[2], 64); err == nil {
+				result.Values[name] = v
+			}
+		}
+	}
+
+	// Only lines with something useful are metrics
+	if result.Epoch > 0 || result.Values[TrainLoss] > 0 || result.Values[TrainAccuracy] > 0 {
+		return result, true
+	}
+	return nil, false
+}
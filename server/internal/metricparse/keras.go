@@ -0,0 +1,51 @@
+package metricparse
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	// Epoch 3/10, on a line of its own
+	kerasEpochPattern = regexp.MustCompile(`^Epoch (\d+)/(\d+)\s*$`)
+	// 469/469 [======] - 3s 6ms/step - loss: 0.29 - accuracy: 0.91, or with Keras 3's bar
+	kerasStepPattern  = regexp.MustCompile(`^\s*(\d+)/(\d+)\s`)
+	kerasValuePattern = regexp.MustCompile(`\s-\s(\w+):\s+([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?|nan|-?inf)`)
+)
+
+// kerasParser reads the output of Keras' fit with verbose 1 or 2: an "Epoch 3/10" line, then step
+// lines whose last one holds the metrics of the epoch
+type kerasParser struct {
+	epoch, totalEpochs int
+}
+
+func (p *kerasParser) Name() string { return "keras" }
+
+func (p *kerasParser) Parse(line string) (*Result, bool) {
+	if matches := kerasEpochPattern.FindStringSubmatch(line); matches != nil {
+		p.epoch, _ = strconv.Atoi(matches[1])
+		p.totalEpochs, _ = strconv.Atoi(matches[2])
+		return &Result{Epoch: p.epoch, TotalEpochs: p.totalEpochs}, true
+	}
+
+	step := kerasStepPattern.FindStringSubmatch(line)
+	if step == nil {
+		return nil, false
+	}
+	pairs := kerasValuePattern.FindAllStringSubmatch(line, -1)
+	if len(pairs) == 0 {
+		return nil, false
+	}
+	// Steps before the last one report running averages
+	if step[1] != step[2] {
+		return nil, true
+	}
+
+	result := &Result{Epoch: p.epoch, TotalEpochs: p.totalEpochs, Values: map[string]float64{}}
+	for _, pair := range pairs {
+		if v, ok := parseValue(pair[2]); ok {
+			result.Values[StandardName(pair[1])] = v
+		}
+	}
+	return result, true
+}
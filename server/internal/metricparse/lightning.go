@@ -0,0 +1,78 @@
+package metricparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Epoch 2: 100%|██████████| 938/938 [00:12<00:00, 75.12it/s, v_num=0, train_loss=0.123, val_acc=0.956]
+	lightningEpochPattern = regexp.MustCompile(`^\s*Epoch (\d+):\s+(\d+)%\|`)
+	lightningValuePattern = regexp.MustCompile(`(\w+)=([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?|nan|-?inf)`)
+	// `Trainer.fit` stopped: `max_epochs=10` reached.
+	lightningStoppedPattern = regexp.MustCompile("`Trainer.fit` stopped(?:: `max_epochs=(\\d+)`)?")
+)
+
+// lightningParser reads the epoch progress bar of PyTorch Lightning. The bar reaches 100% once the
+// training batches are done and is rewritten with the validation metrics after validation, so an
+// epoch is reported once its validation metrics appear, or once the next epoch starts when the
+// model is not validated.
+type lightningParser struct {
+	pending *Result
+	// reported is the last epoch reported, later rewrites of its bar are ignored
+	reported int
+}
+
+func (p *lightningParser) Name() string { return "lightning" }
+
+func (p *lightningParser) Parse(line string) (*Result, bool) {
+	if matches := lightningStoppedPattern.FindStringSubmatch(line); matches != nil {
+		pending := p.pending
+		p.pending = nil
+		if pending != nil {
+			p.reported = pending.Epoch
+			pending.TotalEpochs, _ = strconv.Atoi(matches[1])
+		}
+		return pending, true
+	}
+
+	matches := lightningEpochPattern.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, false
+	}
+	index, _ := strconv.Atoi(matches[1])
+	// Lightning counts epochs from 0
+	epoch := index + 1
+	percent, _ := strconv.Atoi(matches[2])
+
+	var finished *Result
+	if p.pending != nil && p.pending.Epoch != epoch {
+		finished, p.pending = p.pending, nil
+		p.reported = finished.Epoch
+	}
+	if percent < 100 || epoch == p.reported {
+		return finished, true
+	}
+
+	result := &Result{Epoch: epoch, Values: map[string]float64{}}
+	validated := false
+	for _, pair := range lightningValuePattern.FindAllStringSubmatch(line, -1) {
+		if pair[1] == "v_num" || strings.HasSuffix(pair[1], "_step") {
+			continue
+		}
+		if v, ok := parseValue(pair[2]); ok {
+			name := StandardName(pair[1])
+			result.Values[name] = v
+			validated = validated || strings.HasPrefix(name, "val_")
+		}
+	}
+	if !validated || finished != nil {
+		// Reported on a later rewrite of the bar, or once the next epoch starts
+		p.pending = result
+		return finished, true
+	}
+	p.pending = nil
+	p.reported = epoch
+	return result, true
+}
@@ -0,0 +1,146 @@
+// Package metricparse reads training metrics from the output of training scripts. A Chain tries
+// the model's custom patterns, then the built-in parsers for PROGRESS lines, Keras, PyTorch
+// Lightning, YOLO and plain "Epoch 1/10, loss: 0.5" output, on every line.
+package metricparse
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProgressPrefix starts the lines of the PROGRESS protocol
+const ProgressPrefix = "PROGRESS:"
+
+// Names of the standard metrics in Result.Values. Accuracies may be fractions or percentages.
+// Other names are custom metrics.
+const (
+	TrainLoss     = "train_loss"
+	ValLoss       = "val_loss"
+	TestLoss      = "test_loss"
+	TrainAccuracy = "train_accuracy"
+	ValAccuracy   = "val_accuracy"
+	TestAccuracy  = "test_accuracy"
+)
+
+// Result is what a parser read from a line of output
+type Result struct {
+	// Parser is the name of the parser that read the line
+	Parser string
+	// Progress is the JSON payload of a PROGRESS line, which the progress protocol validates.
+	// The other fields are empty then.
+	Progress string
+	// Epoch and TotalEpochs are 0 when the line does not tell
+	Epoch       int
+	TotalEpochs int
+	Values      map[string]float64
+}
+
+// Parser reads the metrics of one kind of output. Parse returns ok for lines it recognizes, with
+// a nil result for lines that report no complete metrics yet, such as progress bar updates.
+// Parsers may keep state between lines; they are used for one training at a time.
+type Parser interface {
+	Name() string
+	Parse(line string) (result *Result, ok bool)
+}
+
+// Builtin are the names of the built-in parsers in the order they are tried
+var Builtin = []string{"progress", "keras", "lightning", "yolo", "generic"}
+
+// Chain tries its parsers in order on each line of a training's output. It is safe for concurrent
+// use, so stdout and stderr can share it.
+type Chain struct {
+	mu      sync.Mutex
+	parsers []Parser
+}
+
+// New returns a chain for one training: the PROGRESS parser, then the given custom patterns, then
+// the other built-in parsers
+func New(patterns []Pattern) (*Chain, error) {
+	custom, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	parsers := []Parser{progressParser{}}
+	parsers = append(parsers, custom...)
+	parsers = append(parsers, &kerasParser{}, &lightningParser{}, &yoloParser{}, genericParser{})
+	return &Chain{parsers: parsers}, nil
+}
+
+// Parse returns the metrics of a line. Progress bars rewrite their line with carriage returns, so
+// each rewrite is parsed in turn and a line can report several results.
+func (c *Chain) Parse(line string) []Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []Result
+	for _, segment := range strings.Split(line, "\r") {
+		if strings.TrimSpace(segment) == "" {
+			continue
+		}
+		for _, parser := range c.parsers {
+			result, ok := parser.Parse(segment)
+			if !ok {
+				continue
+			}
+			if result != nil {
+				result.Parser = parser.Name()
+				results = append(results, *result)
+			}
+			break
+		}
+	}
+	return results
+}
+
+// progressParser passes the payload of PROGRESS lines on to the progress protocol
+type progressParser struct{}
+
+func (progressParser) Name() string { return "progress" }
+
+func (progressParser) Parse(line string) (*Result, bool) {
+	payload, ok := strings.CutPrefix(line, ProgressPrefix)
+	if !ok {
+		return nil, false
+	}
+	return &Result{Progress: strings.TrimSpace(payload)}, true
+}
+
+// parseValue reads a finite number. Non-finite losses are flagged by the anomaly detector from
+// the raw line instead.
+func parseValue(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// StandardName maps the metric names frameworks print to the standard names, e.g. "loss" and
+// "training_loss" to train_loss or "val_acc" to val_accuracy. Other names are returned unchanged.
+func StandardName(name string) string {
+	lower := strings.ToLower(name)
+	lower = strings.TrimSuffix(lower, "_epoch")
+
+	split := "train"
+	for _, prefix := range []struct{ prefix, split string }{
+		{"train_", "train"}, {"training_", "train"},
+		{"val_", "val"}, {"valid_", "val"}, {"validation_", "val"},
+		{"test_", "test"},
+	} {
+		if rest, ok := strings.CutPrefix(lower, prefix.prefix); ok {
+			lower, split = rest, prefix.split
+			break
+		}
+	}
+
+	switch {
+	case lower == "loss":
+		return split + "_loss"
+	case lower == "acc" || lower == "accuracy" || lower == "binary_accuracy" ||
+		lower == "categorical_accuracy" || lower == "sparse_categorical_accuracy":
+		return split + "_accuracy"
+	}
+	return name
+}
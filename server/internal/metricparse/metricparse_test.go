@@ -0,0 +1,198 @@
+package metricparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseLines feeds the lines to a new chain and returns every result
+func parseLines(t *testing.T, patterns []Pattern, lines ...string) []Result {
+	t.Helper()
+	chain, err := New(patterns)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var results []Result
+	for _, line := range lines {
+		results = append(results, chain.Parse(line)...)
+	}
+	return results
+}
+
+func TestChainDefaultPatterns(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []Result
+	}{
+		{
+			name:  "progress line",
+			lines: []string{`PROGRESS: {"epoch": 1, "total_epochs": 5}`},
+			want:  []Result{{Parser: "progress", Progress: `{"epoch": 1, "total_epochs": 5}`}},
+		},
+		{
+			name: "keras",
+			lines: []string{
+				"Epoch 3/10",
+				"100/469 [====>.........] - ETA: 2s - loss: 0.5012 - accuracy: 0.8123",
+				"469/469 [==============] - 3s 6ms/step - loss: 0.29 - accuracy: 0.91 - val_loss: 0.31 - val_accuracy: 0.9",
+			},
+			want: []Result{
+				{Parser: "keras", Epoch: 3, TotalEpochs: 10},
+				{Parser: "keras", Epoch: 3, TotalEpochs: 10, Values: map[string]float64{
+					TrainLoss: 0.29, TrainAccuracy: 0.91, ValLoss: 0.31, ValAccuracy: 0.9,
+				}},
+			},
+		},
+		{
+			name: "lightning bar rewritten with carriage returns",
+			lines: []string{
+				"Epoch 0:  50%|█████     | 469/938 [00:06<00:06, 75.12it/s, v_num=0, train_loss_step=0.301]\r" +
+					"Epoch 0: 100%|██████████| 938/938 [00:12<00:00, 75.12it/s, v_num=0, train_loss_step=0.2, train_loss=0.123, val_acc=0.956]",
+			},
+			want: []Result{
+				{Parser: "lightning", Epoch: 1, Values: map[string]float64{TrainLoss: 0.123, ValAccuracy: 0.956}},
+			},
+		},
+		{
+			name:  "generic",
+			lines: []string{"Epoch 2/10, Train Loss: 0.5432, Train Accuracy: 81%, Val Loss: 0.4321, Val Accuracy: 93%"},
+			want: []Result{
+				{Parser: "generic", Epoch: 2, TotalEpochs: 10, Values: map[string]float64{
+					TrainLoss: 0.5432, TrainAccuracy: 81, ValLoss: 0.4321, ValAccuracy: 93,
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLines(t, nil, tt.lines...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainCustomPatterns(t *testing.T) {
+	patterns := []Pattern{
+		{Name: "detector", Pattern: `step (?P<epoch>\d+)/(?P<total_epochs>\d+) .* mAP@0.5 (?P<map50>[0-9.]+) val_acc (?P<val_acc>[0-9.]+)`},
+		{Pattern: `Epoch (?P<epoch>\d+)/\d+, Train Loss: (?P<my_loss>[0-9.]+)`},
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want []Result
+	}{
+		{
+			name: "custom and standard metrics",
+			line: "step 4/20 lr 0.01 mAP@0.5 0.61 val_acc 0.88",
+			want: []Result{{Parser: "custom: detector", Epoch: 4, TotalEpochs: 20, Values: map[string]float64{"map50": 0.61, ValAccuracy: 0.88}}},
+		},
+		{
+			name: "custom pattern before the built-in parsers",
+			line: "Epoch 2/10, Train Loss: 0.5",
+			want: []Result{{Parser: "custom: pattern 2", Epoch: 2, Values: map[string]float64{"my_loss": 0.5}}},
+		},
+		{
+			name: "built-in parsers when no pattern matches",
+			line: "Epoch 1/3 loss: 0.7",
+			want: []Result{{Parser: "generic", Epoch: 1, TotalEpochs: 3, Values: map[string]float64{TrainLoss: 0.7}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLines(t, patterns, tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainMalformedLines(t *testing.T) {
+	patterns := []Pattern{{Name: "loss", Pattern: `custom_loss=(?P<custom_loss>\S+)`}}
+	for _, line := range []string{
+		"",
+		"   \r  ",
+		"Downloading dataset...",
+		"loss: abc",
+		"Train Loss: ...",
+		"custom_loss=oops",
+		"Epoch three/ten",
+		"12/469 [==>....]",
+	} {
+		if got := parseLines(t, patterns, line); len(got) != 0 {
+			t.Errorf("Parse(%q) = %+v, want no results", line, got)
+		}
+	}
+}
+
+func TestChainNonFiniteValues(t *testing.T) {
+	patterns := []Pattern{{Name: "loss", Pattern: `custom_loss=(?P<custom_loss>\S+)`}}
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  []Result
+	}{
+		{
+			name:  "keras nan loss",
+			lines: []string{"Epoch 1/2", "10/10 [======] - 1s - loss: nan - accuracy: 0.5"},
+			want: []Result{
+				{Parser: "keras", Epoch: 1, TotalEpochs: 2},
+				{Parser: "keras", Epoch: 1, TotalEpochs: 2, Values: map[string]float64{TrainAccuracy: 0.5}},
+			},
+		},
+		{
+			name:  "lightning infinite loss",
+			lines: []string{"Epoch 0: 100%|██████████| 10/10 [00:01<00:00, v_num=0, train_loss=inf, val_loss=-inf, val_acc=0.5]"},
+			want:  []Result{{Parser: "lightning", Epoch: 1, Values: map[string]float64{ValAccuracy: 0.5}}},
+		},
+		{
+			name:  "custom NaN and Inf",
+			lines: []string{"custom_loss=NaN", "custom_loss=+Inf"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLines(t, patterns, tt.lines...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	tooMany := make([]Pattern, MaxPatterns+1)
+	for i := range tooMany {
+		tooMany[i] = Pattern{Pattern: `(?P<loss>\d+)`}
+	}
+
+	tests := []struct {
+		name     string
+		patterns []Pattern
+		err      string // Part of the error, "" when the patterns are valid
+	}{
+		{name: "valid", patterns: []Pattern{{Pattern: `loss (?P<loss>[0-9.]+)`}}},
+		{name: "empty", patterns: []Pattern{{Name: "mine"}}, err: "mine: pattern is empty"},
+		{name: "invalid regexp", patterns: []Pattern{{Pattern: `(?P<loss>[0-9.]+`}}, err: "pattern 1"},
+		{name: "no named group", patterns: []Pattern{{Pattern: `loss ([0-9.]+)`}}, err: "no named group"},
+		{name: "too long", patterns: []Pattern{{Pattern: "(?P<loss>" + strings.Repeat("a", MaxPatternLength) + ")"}}, err: "longer than"},
+		{name: "too many", patterns: tooMany, err: "at most"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePatterns(tt.patterns)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("ValidatePatterns = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ValidatePatterns = %v, want an error about %q", err, tt.err)
+			}
+		})
+	}
+}
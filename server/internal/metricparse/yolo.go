@@ -0,0 +1,165 @@
+package metricparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	//       1/100      3.52G      1.229      1.532      1.213        217        640: 100%|█████| 8/8 [...]
+	yoloEpochPattern = regexp.MustCompile(`^\s*(\d+)/(\d+)\s+(\S+G)\s+(.*?)(?::\s+(\d+)%\|.*)?$`)
+	//                  all        128        929      0.649      0.559      0.617      0.451
+	yoloValidationPattern = regexp.MustCompile(`^\s*all\s+(.*)$`)
+)
+
+// yoloColumns names the validation columns of Ultralytics YOLO, per box and mask
+var yoloColumns = map[string]string{"p": "precision", "r": "recall", "map50": "mAP50", "map50-95": "mAP50-95"}
+
+// yoloParser reads the training table of Ultralytics YOLO: a header naming the loss columns, one
+// row per epoch and, unless validation is off, the "all" row of its validation. The losses are
+// custom metrics, their sum is the train loss, and top-1 accuracy of classifiers is the validation
+// accuracy.
+type yoloParser struct {
+	losses     []string
+	validation []string
+	// YOLOv5 counts epochs from 0
+	zeroBased bool
+	pending   *Result
+	// reported is the last epoch reported, later rewrites of its row are ignored
+	reported int
+}
+
+func (p *yoloParser) Name() string { return "yolo" }
+
+func (p *yoloParser) Parse(line string) (*Result, bool) {
+	fields := strings.Fields(line)
+	if len(fields) > 2 && fields[0] == "Epoch" && fields[1] == "GPU_mem" {
+		p.losses = nil
+		for _, column := range fields[2:] {
+			if column == "Instances" || column == "Size" || column == "labels" || column == "img_size" {
+				break
+			}
+			p.losses = append(p.losses, column)
+		}
+		return nil, true
+	}
+	if len(fields) > 1 && (fields[0] == "Class" || fields[0] == "classes") && p.losses != nil {
+		p.validation = yoloValidationColumns(fields)
+		return nil, true
+	}
+	if p.losses == nil {
+		return nil, false
+	}
+	if strings.Contains(line, "epochs completed in") {
+		return p.report(), true
+	}
+
+	if matches := yoloValidationPattern.FindStringSubmatch(line); matches != nil {
+		pending := p.report()
+		if pending == nil {
+			// The validation of the best model after training
+			return nil, true
+		}
+		values := strings.Fields(matches[1])
+		// Detection and segmentation rows start with the image and instance counts
+		if len(values) > len(p.validation) {
+			values = values[len(values)-len(p.validation):]
+		}
+		for i, name := range p.validation {
+			if i < len(values) {
+				if v, ok := parseValue(values[i]); ok {
+					pending.Values[name] = v
+				}
+			}
+		}
+		if top1, ok := pending.Values["top1_acc"]; ok {
+			pending.Values[ValAccuracy] = top1
+		}
+		return pending, true
+	}
+
+	matches := yoloEpochPattern.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, false
+	}
+	epoch, _ := strconv.Atoi(matches[1])
+	total, _ := strconv.Atoi(matches[2])
+	if epoch == 0 {
+		p.zeroBased = true
+	}
+	if p.zeroBased {
+		epoch++
+	}
+
+	// Without validation an epoch is reported once the next one starts
+	var finished *Result
+	if p.pending != nil && p.pending.Epoch != epoch {
+		finished = p.report()
+	}
+	if (matches[5] != "" && matches[5] != "100") || epoch == p.reported {
+		return finished, true
+	}
+
+	result := &Result{Epoch: epoch, TotalEpochs: total, Values: map[string]float64{}}
+	values := strings.Fields(matches[4])
+	sum, losses := 0.0, 0
+	for i, name := range p.losses {
+		if i >= len(values) {
+			break
+		}
+		if v, ok := parseValue(values[i]); ok {
+			if name == "loss" {
+				name = TrainLoss
+			}
+			result.Values[name] = v
+			sum += v
+			losses++
+		}
+	}
+	if losses > 1 {
+		result.Values[TrainLoss] = sum
+	}
+	p.pending = result
+	return finished, true
+}
+
+// report returns the pending epoch, if any, and marks it reported
+func (p *yoloParser) report() *Result {
+	pending := p.pending
+	p.pending = nil
+	if pending != nil {
+		p.reported = pending.Epoch
+	}
+	return pending
+}
+
+// yoloValidationColumns names the values of the "all" row from the validation header, e.g.
+// "Class Images Instances Box(P R mAP50 mAP50-95): 100%|..." gives precision, recall, mAP50 and
+// mAP50-95, with mask_ names for the Mask( columns of segmentation models
+func yoloValidationColumns(header []string) []string {
+	var columns []string
+	prefix := ""
+	for _, field := range header[1:] {
+		last := strings.HasSuffix(field, "):") || strings.HasSuffix(field, ":")
+		field = strings.TrimRight(field, "):")
+		if group, name, ok := strings.Cut(field, "("); ok {
+			prefix = ""
+			if strings.EqualFold(group, "Mask") {
+				prefix = "mask_"
+			}
+			field = name
+		}
+		switch {
+		case field == "Images" || field == "Instances":
+		case yoloColumns[strings.ToLower(field)] != "":
+			columns = append(columns, prefix+yoloColumns[strings.ToLower(field)])
+		default:
+			columns = append(columns, field)
+		}
+		if last {
+			break
+		}
+	}
+	return columns
+}
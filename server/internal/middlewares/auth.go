@@ -3,6 +3,7 @@ import (
 	"context"
 	"net/http"
 	"server/helpers"
+	"server/internal/apierrors"
 	"strconv"
 	"strings"
 )
@@ -13,11 +14,14 @@ const UserEmailKey contextKey = "userEmail"
 
 const UserIDKey contextKey = "userID"
 
+// SessionIDKey holds the sign-in session of the request's token, when it was issued for one
+const SessionIDKey contextKey = "sessionID"
+
 func JWTGuard(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+			apierrors.Respond(w, http.StatusUnauthorized, "Missing or invalid token")
 			return
 		}
 
@@ -26,19 +30,53 @@ func JWTGuard(next http.Handler) http.Handler {
 		claims, err := helpers.ValidateJWT(tokenStr)
 
 		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			apierrors.Respond(w, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
 
 		// Convert UserID from string to int
 		userID, err := strconv.Atoi(claims.UserID)
 		if err != nil {
-			http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+			apierrors.Respond(w, http.StatusUnauthorized, "Invalid user ID in token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserEmailKey, claims.Email)
+		ctx = context.WithValue(ctx, UserIDKey, userID)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// OptionalJWT adds the user to the request context when a valid token is sent, but lets
+// anonymous requests through
+func OptionalJWT(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := helpers.ValidateJWT(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			apierrors.Respond(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+		userID, err := strconv.Atoi(claims.UserID)
+		if err != nil {
+			apierrors.Respond(w, http.StatusUnauthorized, "Invalid user ID in token")
+			return
+		}
+		// The token of a revoked session is ignored, as if none was sent
+		if SessionRevoked(r.Context(), userID, claims.SessionID) {
+			next.ServeHTTP(w, r)
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), UserEmailKey, claims.Email)
 		ctx = context.WithValue(ctx, UserIDKey, userID)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,215 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"server/internal/apierrors"
+)
+
+// RateLimiter rejects clients making more than a number of requests per fixed window with 429.
+// Counters are kept in memory per key, so limits apply per server instance.
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*apiUsage
+}
+
+// NewRateLimiter creates a limiter allowing limit requests per window
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, clients: make(map[string]*apiUsage)}
+}
+
+// rateLimiterSweepSize is the number of tracked clients above which expired windows are dropped
+const rateLimiterSweepSize = 10000
+
+// Allow counts a request of the client and reports whether it is within the limit, how many
+// requests are left in the window and when the window resets
+func (l *RateLimiter) Allow(key string) (bool, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.clients) > rateLimiterSweepSize {
+		for k, usage := range l.clients {
+			if now.Sub(usage.windowStart) >= l.window {
+				delete(l.clients, k)
+			}
+		}
+	}
+
+	usage, ok := l.clients[key]
+	if !ok || now.Sub(usage.windowStart) >= l.window {
+		usage = &apiUsage{windowStart: now}
+		l.clients[key] = usage
+	}
+	usage.count++
+	reset := usage.windowStart.Add(l.window)
+	if usage.count > l.limit {
+		return false, 0, reset
+	}
+	return true, l.limit - usage.count, reset
+}
+
+// Middleware limits requests per client as identified by key, e.g. its IP address. Responses carry
+// X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset; rejected ones also Retry-After.
+func (l *RateLimiter) Middleware(key func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, remaining, reset := l.Allow(key(r))
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			if !allowed {
+				retryAfter := int(time.Until(reset).Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				apierrors.Respond(w, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TokenBucketLimiter lets each key spend up to burst requests at once, refilled at a steady rate
+// per minute. Buckets are kept in memory, so limits apply per server instance.
+type TokenBucketLimiter struct {
+	name      string
+	perMinute int
+	burst     int
+
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	allowed  int64
+	rejected int64
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimitStats reports how a limiter has answered requests since the server started
+type RateLimitStats struct {
+	Name        string `json:"name"`
+	PerMinute   int    `json:"per_minute"`
+	Burst       int    `json:"burst"`
+	Allowed     int64  `json:"allowed"`
+	Rejected    int64  `json:"rejected"`
+	TrackedKeys int    `json:"tracked_keys"`
+}
+
+var (
+	tokenBucketLimitersMutex sync.Mutex
+	tokenBucketLimiters      []*TokenBucketLimiter
+)
+
+// NewTokenBucketLimiter creates a named limiter refilling perMinute requests per minute up to burst.
+// A perMinute of 0 or less disables it. The limiter is listed by GetRateLimitStats.
+func NewTokenBucketLimiter(name string, perMinute, burst int) *TokenBucketLimiter {
+	if burst < 1 {
+		burst = max(perMinute, 1)
+	}
+	l := &TokenBucketLimiter{name: name, perMinute: perMinute, burst: burst, buckets: make(map[string]*tokenBucket)}
+	tokenBucketLimitersMutex.Lock()
+	tokenBucketLimiters = append(tokenBucketLimiters, l)
+	tokenBucketLimitersMutex.Unlock()
+	return l
+}
+
+// GetRateLimitStats returns the counters of every token bucket limiter
+func GetRateLimitStats() []RateLimitStats {
+	tokenBucketLimitersMutex.Lock()
+	limiters := append([]*TokenBucketLimiter(nil), tokenBucketLimiters...)
+	tokenBucketLimitersMutex.Unlock()
+
+	stats := make([]RateLimitStats, 0, len(limiters))
+	for _, l := range limiters {
+		l.mu.Lock()
+		stats = append(stats, RateLimitStats{
+			Name:        l.name,
+			PerMinute:   l.perMinute,
+			Burst:       l.burst,
+			Allowed:     l.allowed,
+			Rejected:    l.rejected,
+			TrackedKeys: len(l.buckets),
+		})
+		l.mu.Unlock()
+	}
+	return stats
+}
+
+// Allow takes a token from the bucket of every key, or from none of them when one is empty. It
+// reports whether the request is allowed, the tokens left in the emptiest bucket and, when
+// rejected, how long until a token is available.
+func (l *TokenBucketLimiter) Allow(keys ...string) (bool, int, time.Duration) {
+	if l.perMinute <= 0 {
+		return true, l.burst, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	perSecond := float64(l.perMinute) / 60
+	// A bucket idle long enough to refill is the same as a missing one
+	full := time.Duration(float64(l.burst) / perSecond * float64(time.Second))
+	if len(l.buckets) > rateLimiterSweepSize {
+		for k, bucket := range l.buckets {
+			if now.Sub(bucket.updated) >= full {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	buckets := make([]*tokenBucket, 0, len(keys))
+	lowest := float64(l.burst)
+	for _, key := range keys {
+		bucket, ok := l.buckets[key]
+		if !ok {
+			bucket = &tokenBucket{tokens: float64(l.burst)}
+			l.buckets[key] = bucket
+		} else {
+			bucket.tokens = min(float64(l.burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*perSecond)
+		}
+		bucket.updated = now
+		buckets = append(buckets, bucket)
+		lowest = min(lowest, bucket.tokens)
+	}
+
+	if lowest < 1 {
+		l.rejected++
+		wait := time.Duration((1 - lowest) / perSecond * float64(time.Second))
+		return false, 0, wait
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	l.allowed++
+	return true, int(lowest - 1), 0
+}
+
+// Middleware limits requests by every key returned for them, e.g. the client IP and the user.
+// Responses carry X-RateLimit-Limit and X-RateLimit-Remaining; rejected ones also Retry-After.
+func (l *TokenBucketLimiter) Middleware(keys func(r *http.Request) []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l.perMinute <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			allowed, remaining, wait := l.Allow(keys(r)...)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				apierrors.Respond(w, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middlewares
+
+import "testing"
+
+func TestTokenBucketLimiterAllow(t *testing.T) {
+	l := NewTokenBucketLimiter("test", 1, 3)
+
+	for i := 0; i < 3; i++ {
+		allowed, remaining, _ := l.Allow("ip:a")
+		if !allowed {
+			t.Fatalf("request %d within the burst was rejected", i+1)
+		}
+		if want := 2 - i; remaining != want {
+			t.Errorf("request %d left %d tokens, want %d", i+1, remaining, want)
+		}
+	}
+	allowed, _, wait := l.Allow("ip:a")
+	if allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+	if wait <= 0 {
+		t.Errorf("rejected request waits %v, want a positive wait", wait)
+	}
+
+	if allowed, _, _ := l.Allow("ip:b"); !allowed {
+		t.Error("another key was rejected, want buckets kept per key")
+	}
+}
+
+func TestTokenBucketLimiterAllowTakesFromEveryKey(t *testing.T) {
+	l := NewTokenBucketLimiter("test", 1, 2)
+
+	l.Allow("ip:a", "user:1")
+	l.Allow("ip:b", "user:1")
+	// user:1 is empty, so ip:c must not lose a token either
+	if allowed, _, _ := l.Allow("ip:c", "user:1"); allowed {
+		t.Fatal("request of an exhausted user was allowed from a new IP")
+	}
+	if allowed, remaining, _ := l.Allow("ip:c"); !allowed || remaining != 1 {
+		t.Errorf("ip:c allowed=%t with %d tokens left, want allowed with 1", allowed, remaining)
+	}
+}
+
+func TestTokenBucketLimiterDisabled(t *testing.T) {
+	l := NewTokenBucketLimiter("test", 0, 1)
+	for i := 0; i < 10; i++ {
+		if allowed, _, _ := l.Allow("ip:a"); !allowed {
+			t.Fatal("disabled limiter rejected a request")
+		}
+	}
+}
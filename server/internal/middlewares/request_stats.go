@@ -0,0 +1,63 @@
+package middlewares
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestStats counts the requests served in an hour and how many failed
+type RequestStats struct {
+	Requests     int64
+	ClientErrors int64
+	ServerErrors int64
+}
+
+var (
+	requestStatsMutex sync.Mutex
+	requestStats      = make(map[time.Time]*RequestStats) // key: hour, in UTC
+)
+
+// TrackRequestStatus counts requests and their 4xx and 5xx responses per hour
+func TrackRequestStatus(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The wrapper keeps http.Hijacker, so websocket upgrades still work
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		hour := time.Now().UTC().Truncate(time.Hour)
+
+		requestStatsMutex.Lock()
+		stats, ok := requestStats[hour]
+		if !ok {
+			stats = &RequestStats{}
+			requestStats[hour] = stats
+		}
+		stats.Requests++
+		switch {
+		case status >= 500:
+			stats.ServerErrors++
+		case status >= 400:
+			stats.ClientErrors++
+		}
+		requestStatsMutex.Unlock()
+	})
+}
+
+// TakeRequestStats returns the counts collected since the last call, by hour, and resets them
+func TakeRequestStats() map[time.Time]RequestStats {
+	requestStatsMutex.Lock()
+	defer requestStatsMutex.Unlock()
+	taken := make(map[time.Time]RequestStats, len(requestStats))
+	for hour, stats := range requestStats {
+		taken[hour] = *stats
+	}
+	requestStats = make(map[time.Time]*RequestStats)
+	return taken
+}
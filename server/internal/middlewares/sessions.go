@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"server/internal/apierrors"
+)
+
+// SessionActiveFunc reports whether a user's sign-in session still exists
+type SessionActiveFunc func(ctx context.Context, userID int, sessionID string) (bool, error)
+
+var isSessionActive SessionActiveFunc
+
+// SetSessionActiveFunc sets how RejectRevokedSessions finds revoked sessions
+func SetSessionActiveFunc(fn SessionActiveFunc) {
+	isSessionActive = fn
+}
+
+// SessionRevoked reports whether the sign-in session of an access token was revoked or signed out.
+// Tokens not tied to a session and errors looking up the session count as not revoked.
+func SessionRevoked(ctx context.Context, userID int, sessionID string) bool {
+	if sessionID == "" || isSessionActive == nil {
+		return false
+	}
+	active, err := isSessionActive(ctx, userID, sessionID)
+	if err != nil {
+		log.Printf("⚠️  Failed to check session of user %d: %v", userID, err)
+		return false
+	}
+	return !active
+}
+
+// RejectRevokedSessions answers 401 to access tokens whose sign-in session was revoked or signed
+// out, without waiting for the tokens to expire. It must run after JWTGuard.
+func RejectRevokedSessions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(UserIDKey).(int)
+		sessionID, _ := r.Context().Value(SessionIDKey).(string)
+		if ok && SessionRevoked(r.Context(), userID, sessionID) {
+			apierrors.Write(w, apierrors.New(http.StatusUnauthorized, apierrors.CodeSessionRevoked, "Session has been revoked"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
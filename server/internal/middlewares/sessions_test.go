@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"server/helpers"
+)
+
+func TestOptionalJWTIgnoresRevokedSessions(t *testing.T) {
+	previous := isSessionActive
+	SetSessionActiveFunc(func(ctx context.Context, userID int, sessionID string) (bool, error) {
+		return sessionID == "active", nil
+	})
+	t.Cleanup(func() { isSessionActive = previous })
+
+	var gotUser bool
+	handler := OptionalJWT(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, gotUser = r.Context().Value(UserIDKey).(int)
+	}))
+
+	for _, tt := range []struct {
+		session  string
+		wantUser bool
+	}{
+		{session: "active", wantUser: true},
+		{session: "revoked", wantUser: false},
+		{session: "", wantUser: true}, // Tokens issued before sessions
+	} {
+		token, err := helpers.GenerateSessionJWT("user@example.com", 7, tt.session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/v1/published-models/1", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		gotUser = false
+		handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK || gotUser != tt.wantUser {
+			t.Errorf("session %q: status %d, user set %t, want 200 and %t", tt.session, rec.Code, gotUser, tt.wantUser)
+		}
+	}
+}
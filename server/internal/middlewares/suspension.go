@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"server/internal/apierrors"
+)
+
+// SuspendedFunc reports whether a user's account is suspended
+type SuspendedFunc func(ctx context.Context, userID int) (bool, error)
+
+var isSuspended SuspendedFunc
+
+// SetSuspendedFunc sets how RejectSuspendedUsers finds suspended accounts
+func SetSuspendedFunc(fn SuspendedFunc) {
+	isSuspended = fn
+}
+
+// RejectSuspendedUsers answers 403 to users whose account was suspended, including with access
+// tokens issued before the suspension. It must run after JWTGuard. Errors looking up the account
+// let the request through.
+func RejectSuspendedUsers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(UserIDKey).(int)
+		if !ok || isSuspended == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		suspended, err := isSuspended(r.Context(), userID)
+		if err != nil {
+			log.Printf("⚠️  Failed to check suspension of user %d: %v", userID, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !suspended {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		apierrors.Write(w, apierrors.New(http.StatusForbidden, apierrors.CodeAccountSuspended, "This account has been suspended"))
+	})
+}
@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	"server/internal/apierrors"
+)
+
+// TERMS_ENFORCEMENT decides what happens to users who have not accepted the current terms
+// of service or privacy policy: "block" (default) rejects their requests, "warn" only sets
+// the TermsRequiredHeader, and "off" disables the check.
+const TermsEnforcementEnv = "TERMS_ENFORCEMENT"
+
+// Values of TERMS_ENFORCEMENT
+const (
+	TermsEnforcementBlock = "block"
+	TermsEnforcementWarn  = "warn"
+	TermsEnforcementOff   = "off"
+)
+
+// TermsRequiredHeader is set on responses to users who have documents to accept
+const TermsRequiredHeader = "X-Terms-Acceptance-Required"
+
+// PendingTermsFunc returns the legal documents a user still has to accept
+type PendingTermsFunc func(ctx context.Context, userID int) ([]map[string]interface{}, error)
+
+var pendingTerms PendingTermsFunc
+
+// SetPendingTermsFunc sets how RequireTermsAcceptance finds the documents a user has to accept
+func SetPendingTermsFunc(fn PendingTermsFunc) {
+	pendingTerms = fn
+}
+
+// TermsEnforcement returns the configured TERMS_ENFORCEMENT mode
+func TermsEnforcement() string {
+	switch mode := os.Getenv(TermsEnforcementEnv); mode {
+	case "":
+		return TermsEnforcementBlock
+	case TermsEnforcementBlock, TermsEnforcementWarn, TermsEnforcementOff:
+		return mode
+	default:
+		log.Printf("⚠️  Invalid %s %q, using %s", TermsEnforcementEnv, mode, TermsEnforcementBlock)
+		return TermsEnforcementBlock
+	}
+}
+
+// RequireTermsAcceptance makes users accept new versions of the terms and privacy policy before
+// using the API. It must run after JWTGuard. Errors looking up the documents let the request through.
+func RequireTermsAcceptance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := TermsEnforcement()
+		userID, ok := r.Context().Value(UserIDKey).(int)
+		if mode == TermsEnforcementOff || !ok || pendingTerms == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pending, err := pendingTerms(r.Context(), userID)
+		if err != nil {
+			log.Printf("⚠️  Failed to check terms acceptance of user %d: %v", userID, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(pending) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(TermsRequiredHeader, "true")
+		if mode == TermsEnforcementWarn {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		apierrors.Write(w, apierrors.New(http.StatusForbidden, apierrors.CodeTermsRequired, "Please accept the updated terms to continue").
+			WithDetails(map[string]interface{}{"pending_documents": pending}))
+	})
+}
@@ -0,0 +1,98 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// APIUsageWindow is the length of the fixed window used for soft API rate limits
+const APIUsageWindow = time.Minute
+
+// defaultSoftAPIRateLimit is the number of requests per window before warnings are sent
+const defaultSoftAPIRateLimit = 120
+
+type apiUsage struct {
+	windowStart time.Time
+	count       int
+}
+
+var (
+	apiUsageMutex  sync.Mutex
+	apiUsageByUser = make(map[int]*apiUsage)
+	apiUsageHook   func(userID, count, limit int)
+)
+
+// SetAPIUsageHook sets the callback invoked when a user crosses a soft API rate threshold.
+// The hook is called once per window when usage reaches 80% of the limit and once when it
+// reaches the limit itself. Requests are never rejected by this middleware.
+func SetAPIUsageHook(hook func(userID, count, limit int)) {
+	apiUsageMutex.Lock()
+	defer apiUsageMutex.Unlock()
+	apiUsageHook = hook
+}
+
+// SoftAPIRateLimit returns the configured soft API rate limit (requests per window)
+func SoftAPIRateLimit() int {
+	if raw := os.Getenv("API_SOFT_RATE_LIMIT"); raw != "" {
+		if limit, err := strconv.Atoi(raw); err == nil && limit > 0 {
+			return limit
+		}
+		log.Printf("⚠️  Invalid API_SOFT_RATE_LIMIT %q, using default %d", raw, defaultSoftAPIRateLimit)
+	}
+	return defaultSoftAPIRateLimit
+}
+
+// GetAPIUsage returns the request count for the current window and when the window resets
+func GetAPIUsage(userID int) (int, time.Time) {
+	apiUsageMutex.Lock()
+	defer apiUsageMutex.Unlock()
+
+	usage, ok := apiUsageByUser[userID]
+	if !ok || time.Since(usage.windowStart) >= APIUsageWindow {
+		return 0, time.Now().Add(APIUsageWindow)
+	}
+	return usage.count, usage.windowStart.Add(APIUsageWindow)
+}
+
+// TrackAPIUsage counts requests per authenticated user. It must run after JWTGuard.
+func TrackAPIUsage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(UserIDKey).(int)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit := SoftAPIRateLimit()
+		warnAt := limit * 8 / 10
+
+		apiUsageMutex.Lock()
+		now := time.Now()
+		if len(apiUsageByUser) > rateLimiterSweepSize {
+			for id, usage := range apiUsageByUser {
+				if now.Sub(usage.windowStart) >= APIUsageWindow {
+					delete(apiUsageByUser, id)
+				}
+			}
+		}
+		usage, exists := apiUsageByUser[userID]
+		if !exists || now.Sub(usage.windowStart) >= APIUsageWindow {
+			usage = &apiUsage{windowStart: now}
+			apiUsageByUser[userID] = usage
+		}
+		usage.count++
+		count := usage.count
+		hook := apiUsageHook
+		apiUsageMutex.Unlock()
+
+		if hook != nil && (count == warnAt || count == limit) {
+			go hook(userID, count, limit)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
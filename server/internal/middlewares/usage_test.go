@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTrackAPIUsageDropsExpiredWindows(t *testing.T) {
+	apiUsageMutex.Lock()
+	previous := apiUsageByUser
+	apiUsageByUser = make(map[int]*apiUsage)
+	expired := time.Now().Add(-2 * APIUsageWindow)
+	for id := 1; id <= rateLimiterSweepSize+1; id++ {
+		apiUsageByUser[id] = &apiUsage{windowStart: expired, count: 1}
+	}
+	apiUsageByUser[0] = &apiUsage{windowStart: time.Now(), count: 1}
+	apiUsageMutex.Unlock()
+	t.Cleanup(func() {
+		apiUsageMutex.Lock()
+		apiUsageByUser = previous
+		apiUsageMutex.Unlock()
+	})
+
+	handler := TrackAPIUsage(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest("GET", "/v1/models", nil)
+	r = r.WithContext(context.WithValue(r.Context(), UserIDKey, -1))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	apiUsageMutex.Lock()
+	defer apiUsageMutex.Unlock()
+	if len(apiUsageByUser) != 2 {
+		t.Errorf("%d users tracked, want the 2 with a current window", len(apiUsageByUser))
+	}
+}
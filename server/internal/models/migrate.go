@@ -0,0 +1,274 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"server/migrations"
+)
+
+// migrationLockID is the advisory lock that keeps two servers from migrating the database at once
+const migrationLockID = 7316054925
+
+// migrationFilePattern matches migration files, like 000012_add_api_keys.up.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+var (
+	// ErrDirtyDatabase is returned when a migration failed halfway and the schema must be fixed by hand
+	ErrDirtyDatabase = errors.New("database is dirty, fix the failed migration and run `server migrate force <version>`")
+	// ErrUnversionedDatabase is returned for databases that have tables but no recorded migration
+	// version, e.g. ones migrated by hand
+	ErrUnversionedDatabase = errors.New("database has no migration version, run `server migrate force <version>` with the last migration it has")
+)
+
+// Migration is a numbered schema change with the SQL that applies and reverts it
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// LoadMigrations reads the migrations of fsys sorted by version. Every migration needs both an
+// up and a down file.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := map[uint64]*Migration{}
+	for _, file := range files {
+		match := migrationFilePattern.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", file.Name(), err)
+		}
+		sql, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", migration.Name, match[2], version)
+		}
+		if match[3] == "up" {
+			migration.Up = string(sql)
+		} else {
+			migration.Down = string(sql)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %06d_%s needs an up and a down file", migration.Version, migration.Name)
+		}
+		list = append(list, *migration)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// withMigrationLock runs fn on a connection holding the migration lock, after creating the table
+// the version is recorded in. The table has the layout golang-migrate uses, so databases migrated
+// with its CLI keep their version.
+func withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	if Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	conn, err := Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// readMigrationVersion returns the recorded migration version, 0 when none was applied
+func readMigrationVersion(ctx context.Context, conn *pgxpool.Conn) (uint64, bool, error) {
+	var version int64
+	var dirty bool
+	err := conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == pgx.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read the migration version: %w", err)
+	}
+	return uint64(version), dirty, nil
+}
+
+// writeMigrationVersion records the migration version, or that none is applied for version 0
+func writeMigrationVersion(ctx context.Context, tx pgx.Tx, version uint64) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return fmt.Errorf("failed to clear the migration version: %w", err)
+	}
+	if version == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, FALSE)`, int64(version)); err != nil {
+		return fmt.Errorf("failed to record the migration version: %w", err)
+	}
+	return nil
+}
+
+// runMigration runs a migration's SQL and records the version it leaves the database at in one
+// transaction, so a failed migration changes nothing
+func runMigration(ctx context.Context, conn *pgxpool.Conn, sql string, version uint64) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Without arguments pgx uses the simple protocol, which runs multiple statements
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if err := writeMigrationVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// MigrationVersion returns the version the database was migrated to, 0 when none was applied,
+// and whether a migration failed halfway
+func MigrationVersion(ctx context.Context) (version uint64, dirty bool, err error) {
+	err = withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err = readMigrationVersion(ctx, conn)
+		return err
+	})
+	return version, dirty, err
+}
+
+// Migrate applies the embedded migrations newer than the database's version and returns how
+// many it applied
+func Migrate(ctx context.Context) (int, error) {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err := readMigrationVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirtyDatabase
+		}
+		if version == 0 {
+			var hasTables bool
+			if err := conn.QueryRow(ctx, `SELECT to_regclass('public.users') IS NOT NULL`).Scan(&hasTables); err != nil {
+				return fmt.Errorf("failed to inspect the database: %w", err)
+			}
+			if hasTables {
+				return ErrUnversionedDatabase
+			}
+		}
+
+		for _, migration := range list {
+			if migration.Version <= version {
+				continue
+			}
+			if err := runMigration(ctx, conn, migration.Up, migration.Version); err != nil {
+				return fmt.Errorf("migration %06d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			log.Printf("✅ Applied migration %06d_%s", migration.Version, migration.Name)
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the last steps migrations applied and returns how many it reverted
+func MigrateDown(ctx context.Context, steps int) (int, error) {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	err = withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err := readMigrationVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirtyDatabase
+		}
+
+		for ; reverted < steps && version > 0; reverted++ {
+			index := sort.Search(len(list), func(i int) bool { return list[i].Version >= version })
+			if index == len(list) || list[index].Version != version {
+				return fmt.Errorf("database is at version %d, which has no migration", version)
+			}
+			previous := uint64(0)
+			if index > 0 {
+				previous = list[index-1].Version
+			}
+			migration := list[index]
+			if err := runMigration(ctx, conn, migration.Down, previous); err != nil {
+				return fmt.Errorf("reverting migration %06d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			log.Printf("↩️  Reverted migration %06d_%s", migration.Version, migration.Name)
+			version = previous
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// ForceMigrationVersion records version as applied without running anything, to adopt a database
+// migrated by hand or clear the dirty flag after fixing a failed migration
+func ForceMigrationVersion(ctx context.Context, version uint64) error {
+	return withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to start transaction: %w", err)
+		}
+		defer tx.Rollback(ctx)
+
+		if err := writeMigrationVersion(ctx, tx, version); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	})
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -140,6 +141,31 @@ func IsConnected() bool {
 	return err == nil
 }
 
+// migrateOnStartup applies pending migrations unless DB_AUTO_MIGRATE=false. A database that was
+// migrated by hand only logs a warning, so upgrading does not stop the server.
+func migrateOnStartup() error {
+	if os.Getenv("DB_AUTO_MIGRATE") == "false" {
+		log.Println("⏭️  DB_AUTO_MIGRATE=false, skipping migrations")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	applied, err := Migrate(ctx)
+	if errors.Is(err, ErrUnversionedDatabase) {
+		log.Printf("⚠️  Skipping migrations: %v", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if applied > 0 {
+		log.Printf("✅ Applied %d migrations", applied)
+	}
+	return nil
+}
+
 // ConnectWithRetry attempts to connect to PostgreSQL with retry logic
 func ConnectWithRetry() error {
 	maxRetries := 5
@@ -150,7 +176,7 @@ func ConnectWithRetry() error {
 
 		err := Connect()
 		if err == nil {
-			return nil // Success!
+			return migrateOnStartup()
 		}
 
 		log.Printf("Connection failed: %v", err)
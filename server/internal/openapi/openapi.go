@@ -0,0 +1,460 @@
+// Package openapi describes the API in OpenAPI 3 from the router itself: every route is listed
+// with its path parameters and the authentication its middlewares require, so the document
+// cannot miss or keep a route. Operations documented with Go types add a summary and request and
+// response schemas reflected from those types.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"server/internal/apierrors"
+)
+
+// Version of the OpenAPI specification the document follows
+const Version = "3.0.3"
+
+// Security schemes of the API
+const (
+	SchemeJWT          = "bearerAuth"   // Access token of a signed-in user
+	SchemeAPIKey       = "apiKey"       // API key of the user's settings, sent as a bearer token
+	SchemeProjectToken = "projectToken" // Project token of a model, sent as a bearer token
+)
+
+// Operation documents a route. Every field is optional.
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string    // Defaults to the tag of the route's path
+	Request     interface{} // JSON request body, described by the Go type of the value
+	Multipart   bool        // The request body is a multipart/form-data upload
+	Response    interface{} // JSON response, described by the Go type of the value
+	Scheme      string      // Security scheme of handlers that authenticate the request themselves
+}
+
+// Middleware tells what a middleware means for API clients
+type Middleware struct {
+	Func     func(http.Handler) http.Handler
+	Scheme   string // Security scheme the middleware checks
+	Optional bool   // Requests without credentials are let through
+	Note     string // Appended to the description of the routes using it
+}
+
+// TagPrefix tags the routes whose path starts with Prefix
+type TagPrefix struct {
+	Prefix string
+	Tag    string
+}
+
+// Spec is what Build needs besides the router
+type Spec struct {
+	Title       string
+	Version     string
+	Description string
+	Operations  map[string]Operation // Keyed by method and path, like "POST /v1/login"
+	Middlewares []Middleware
+	Tags        []TagPrefix // The first matching prefix wins; the first path segment otherwise
+}
+
+// routeParam matches the parameters of chi route patterns, with an optional regexp
+var routeParam = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// nonWord matches what operation IDs made of paths leave out
+var nonWord = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Build returns the OpenAPI document of the routes. It also returns the documented operations
+// that match no route, which are out of date.
+func Build(routes chi.Routes, spec Spec) (map[string]interface{}, []string, error) {
+	schemas := newSchemas()
+	paths := map[string]map[string]interface{}{}
+	operationIDs := map[string]int{}
+	documented := map[string]bool{}
+	anyMethod := map[string]bool{}
+
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, mws ...func(http.Handler) http.Handler) error {
+		path, params := openAPIPath(route)
+		// Routes of Handle and HandleFunc match any method, listed here as GET only
+		if method == http.MethodConnect || method == http.MethodTrace {
+			anyMethod[path] = true
+		}
+		if method != http.MethodGet && method != http.MethodPost && method != http.MethodPut &&
+			method != http.MethodPatch && method != http.MethodDelete {
+			return nil
+		}
+		key := method + " " + path
+		doc, ok := spec.Operations[key]
+		documented[key] = ok
+
+		name, summary := handlerName(handler), doc.Summary
+		if summary == "" {
+			summary = summaryOf(name)
+		}
+		if name == "" {
+			name, summary = pathOperationID(method, path), key
+		}
+		operationID := name
+		if operationIDs[name]++; operationIDs[name] > 1 {
+			operationID = fmt.Sprintf("%s%d", name, operationIDs[name])
+		}
+		op := map[string]interface{}{
+			"operationId": operationID,
+			"summary":     summary,
+			"tags":        doc.Tags,
+			"responses":   responses(method, doc, schemas),
+		}
+		if len(doc.Tags) == 0 {
+			op["tags"] = []string{tagOf(path, spec.Tags)}
+		}
+
+		description := doc.Description
+		var security []map[string][]string
+		for _, mw := range mws {
+			m, ok := findMiddleware(spec.Middlewares, mw)
+			if !ok {
+				continue
+			}
+			if m.Scheme != "" {
+				security = append(security, map[string][]string{m.Scheme: {}})
+				if m.Optional {
+					security = append(security, map[string][]string{})
+				}
+			}
+			if m.Note != "" {
+				description = strings.TrimSpace(description + " " + m.Note)
+			}
+		}
+		if security == nil && doc.Scheme != "" {
+			security = []map[string][]string{{doc.Scheme: {}}}
+		}
+		if security == nil {
+			security = []map[string][]string{}
+		}
+		op["security"] = security
+		if description != "" {
+			op["description"] = description
+		}
+
+		var parameters []map[string]interface{}
+		for _, param := range params {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     param,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		if parameters != nil {
+			op["parameters"] = parameters
+		}
+
+		switch {
+		case doc.Multipart:
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"multipart/form-data": map[string]interface{}{"schema": map[string]interface{}{"type": "object"}},
+				},
+			}
+		case doc.Request != nil:
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.of(reflect.TypeOf(doc.Request))},
+				},
+			}
+		case method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch:
+			op["requestBody"] = map[string]interface{}{
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]interface{}{"type": "object"}},
+				},
+			}
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(method)] = op
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for path := range anyMethod {
+		for method := range paths[path] {
+			if method != "get" {
+				delete(paths[path], method)
+			}
+		}
+	}
+
+	var stale []string
+	for key := range spec.Operations {
+		if !documented[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+
+	return map[string]interface{}{
+		"openapi": Version,
+		"info": map[string]interface{}{
+			"title":       spec.Title,
+			"version":     spec.Version,
+			"description": spec.Description,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				SchemeJWT: map[string]interface{}{
+					"type": "http", "scheme": "bearer", "bearerFormat": "JWT",
+					"description": "Access token returned by the sign-in and refresh endpoints",
+				},
+				SchemeAPIKey: map[string]interface{}{
+					"type": "http", "scheme": "bearer",
+					"description": "API key of the user's settings (sk_live_...)",
+				},
+				SchemeProjectToken: map[string]interface{}{
+					"type": "http", "scheme": "bearer",
+					"description": "Project token of a model, for CI",
+				},
+			},
+		},
+	}, stale, nil
+}
+
+// openAPIPath converts a chi route pattern to an OpenAPI path and returns its parameters.
+// Wildcards become a "path" parameter.
+func openAPIPath(route string) (string, []string) {
+	var params []string
+	path := routeParam.ReplaceAllStringFunc(route, func(m string) string {
+		name := routeParam.FindStringSubmatch(m)[1]
+		params = append(params, name)
+		return "{" + name + "}"
+	})
+	if strings.HasSuffix(path, "/*") {
+		path = strings.TrimSuffix(path, "*") + "{path}"
+		params = append(params, "path")
+	}
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path, params
+}
+
+// handlerName returns the name of a handler's function, like "GetSessionsHandler" or
+// "StartTraining" for a method value, or "" for closures and other handlers
+func handlerName(handler http.Handler) string {
+	v := reflect.ValueOf(handler)
+	if v.Kind() != reflect.Func {
+		return ""
+	}
+	name := runtime.FuncForPC(v.Pointer()).Name()
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+	if strings.HasPrefix(name, "func") {
+		return ""
+	}
+	return name
+}
+
+// pathOperationID makes an operation ID of a method and path: GET /uploads/{path} is
+// "getUploadsPath"
+func pathOperationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, word := range nonWord.Split(path, -1) {
+		if word != "" {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+// summaryOf turns a handler name into a summary: "GetMyModelsHandler" is "Get my models"
+func summaryOf(name string) string {
+	name = strings.TrimSuffix(name, "Handler")
+	var words []string
+	start := 0
+	runes := []rune(name)
+	for i := 1; i < len(runes); i++ {
+		// A word starts at an upper case letter after a lower case one, or before one in acronyms
+		if unicode.IsUpper(runes[i]) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	words = append(words, string(runes[start:]))
+	for i, word := range words {
+		if i > 0 && strings.ToUpper(word) != word {
+			words[i] = strings.ToLower(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// tagOf returns the tag of a path
+func tagOf(path string, tags []TagPrefix) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(path, tag.Prefix) {
+			return tag.Tag
+		}
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/v1"), "/")
+	if len(segments) > 1 && segments[1] != "" && !strings.HasPrefix(segments[1], "{") {
+		return segments[1]
+	}
+	return "other"
+}
+
+// findMiddleware returns the description of a middleware
+func findMiddleware(known []Middleware, mw func(http.Handler) http.Handler) (Middleware, bool) {
+	ptr := reflect.ValueOf(mw).Pointer()
+	for _, m := range known {
+		if reflect.ValueOf(m.Func).Pointer() == ptr {
+			return m, true
+		}
+	}
+	return Middleware{}, false
+}
+
+// responses returns the responses of an operation: its documented response, or any JSON object,
+// and the error envelope of apierrors for the other statuses
+func responses(method string, doc Operation, schemas *schemas) map[string]interface{} {
+	success := map[string]interface{}{"type": "object"}
+	if doc.Response != nil {
+		success = schemas.of(reflect.TypeOf(doc.Response))
+	}
+	status := "200"
+	if method == http.MethodPost && doc.Response == nil {
+		status = "2XX"
+	}
+	return map[string]interface{}{
+		status: map[string]interface{}{
+			"description": "Success",
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": success}},
+		},
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.errorEnvelope()},
+			},
+		},
+	}
+}
+
+// schemas reflects Go types into JSON schemas. Named struct types are shared as components.
+type schemas struct {
+	components map[string]interface{}
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]interface{}{}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// of returns the schema of a type
+func (s *schemas) of(t reflect.Type) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case t == timeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := s.components[t.Name()]; !ok {
+			s.components[t.Name()] = map[string]interface{}{} // Placeholder against recursive types
+			s.components[t.Name()] = s.object(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if nullable {
+			return map[string]interface{}{"allOf": []interface{}{ref}, "nullable": true}
+		}
+		return ref
+	case t.Kind() == reflect.Struct:
+		schema = s.object(t)
+	case t.Kind() == reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		schema = map[string]interface{}{"type": "string", "format": "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	default:
+		schema = map[string]interface{}{}
+	}
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// object returns the schema of a struct's JSON fields, including those of embedded structs
+func (s *schemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	s.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (s *schemas) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+	}
+}
+
+// errorEnvelope returns the schema of the error responses of apierrors
+func (s *schemas) errorEnvelope() map[string]interface{} {
+	if _, ok := s.components["ErrorResponse"]; !ok {
+		apiError := s.object(reflect.TypeOf(apierrors.Error{}))
+		apiError["properties"].(map[string]interface{})["request_id"] = map[string]interface{}{"type": "string"}
+		apiError["required"] = []string{"code", "message"}
+		s.components["Error"] = apiError
+		s.components["ErrorResponse"] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"success": map[string]interface{}{"type": "boolean"},
+				"error":   map[string]interface{}{"$ref": "#/components/schemas/Error"},
+			},
+		}
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/ErrorResponse"}
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Kinds of admin reports
+const (
+	AdminReportWeekly = "weekly"
+)
+
+// AddRequestStats adds request counts to an hour's totals
+func AddRequestStats(ctx context.Context, hour time.Time, requests, clientErrors, serverErrors int64) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO request_stats (hour, requests, client_errors, server_errors)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (hour) DO UPDATE
+		SET requests = request_stats.requests + EXCLUDED.requests,
+			client_errors = request_stats.client_errors + EXCLUDED.client_errors,
+			server_errors = request_stats.server_errors + EXCLUDED.server_errors
+	`, hour, requests, clientErrors, serverErrors); err != nil {
+		return fmt.Errorf("failed to store request stats: %w", err)
+	}
+	return nil
+}
+
+// GetRequestStats returns the requests, client_errors and server_errors counted in [from, to)
+func GetRequestStats(ctx context.Context, from, to time.Time) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT COALESCE(SUM(requests), 0)::BIGINT AS requests,
+			COALESCE(SUM(client_errors), 0)::BIGINT AS client_errors,
+			COALESCE(SUM(server_errors), 0)::BIGINT AS server_errors
+		FROM request_stats
+		WHERE hour >= $1 AND hour < $2
+	`, from, to)
+}
+
+// GetGrowthCounts returns the users, models and trainings created in [from, to) and the totals at to
+func GetGrowthCounts(ctx context.Context, from, to time.Time) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM users WHERE created_at >= $1 AND created_at < $2) AS new_users,
+			(SELECT COUNT(*) FROM users WHERE created_at < $2) AS total_users,
+			(SELECT COUNT(*) FROM models WHERE created_at >= $1 AND created_at < $2) AS new_models,
+			(SELECT COUNT(*) FROM models WHERE created_at < $2) AS total_models,
+			(SELECT COUNT(*) FROM model_training_runs WHERE created_at >= $1 AND created_at < $2 AND training_type = 'server') AS server_trainings,
+			(SELECT COUNT(*) FROM model_training_runs WHERE created_at >= $1 AND created_at < $2 AND training_type = 'agent') AS agent_trainings
+	`, from, to)
+}
+
+// GetActiveSubscriptionCounts returns how many users have an active paid subscription, by tier
+func GetActiveSubscriptionCounts(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT subscription_tier AS tier, COUNT(*) AS subscribers
+		FROM users
+		WHERE subscription_status = 'active' AND COALESCE(subscription_tier, 'free') <> 'free'
+		GROUP BY subscription_tier
+	`)
+}
+
+// GetModelFoldersByOwner returns the folders of every model with its owner
+func GetModelFoldersByOwner(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT m.user_id, u.email, u.username, m.folder
+		FROM models m
+		JOIN users u ON u.id = m.user_id
+	`)
+}
+
+// GetAdminUsers returns the email and username of every platform administrator
+func GetAdminUsers(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `SELECT id, email, username FROM users WHERE role = 'admin' ORDER BY id`)
+}
+
+// SaveAdminReport stores a report of the period starting at periodStart and returns its ID, or 0
+// when a report of that period already exists
+func SaveAdminReport(ctx context.Context, kind string, periodStart, periodEnd time.Time, report interface{}) (int, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode admin report: %w", err)
+	}
+	rows, err := Query(ctx, `
+		INSERT INTO admin_reports (kind, period_start, period_end, report)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (kind, period_start) DO NOTHING
+		RETURNING id
+	`, kind, periodStart, periodEnd, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save admin report: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	id, _ := rows[0]["id"].(int32)
+	return int(id), nil
+}
+
+// GetAdminReport returns the report of the period starting at periodStart, or pgx.ErrNoRows
+func GetAdminReport(ctx context.Context, kind string, periodStart time.Time) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, kind, period_start, period_end, report, emailed_at, created_at
+		FROM admin_reports
+		WHERE kind = $1 AND period_start = $2
+	`, kind, periodStart)
+}
+
+// GetAdminReports returns the latest reports of a kind, newest first
+func GetAdminReports(ctx context.Context, kind string, limit int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, kind, period_start, period_end, report, emailed_at, created_at
+		FROM admin_reports
+		WHERE kind = $1
+		ORDER BY period_start DESC
+		LIMIT $2
+	`, kind, limit)
+}
+
+// MarkAdminReportEmailed records that a report was sent to the admins
+func MarkAdminReportEmailed(ctx context.Context, reportID int) error {
+	if _, err := Exec(ctx, `UPDATE admin_reports SET emailed_at = NOW() WHERE id = $1`, reportID); err != nil {
+		return fmt.Errorf("failed to mark admin report emailed: %w", err)
+	}
+	return nil
+}
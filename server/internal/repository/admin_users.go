@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/models"
+)
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// ErrInsufficientCredits is returned when a credit adjustment would make a balance negative
+var ErrInsufficientCredits = errors.New("adjustment would make the credit balance negative")
+
+// AdminUserFilter narrows the users listed for admins. Zero values match every user.
+type AdminUserFilter struct {
+	Query     string // Part of the email or username
+	Role      string
+	Suspended *bool
+}
+
+// GetUsersForAdmin returns a page of users matching the filter, newest first, and the total count
+func GetUsersForAdmin(ctx context.Context, filter AdminUserFilter, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	where := `
+		WHERE ($1 = '' OR email ILIKE '%' || $1 || '%' OR username ILIKE '%' || $1 || '%')
+			AND ($2 = '' OR role = $2)
+			AND ($3::BOOLEAN IS NULL OR (suspended_at IS NOT NULL) = $3)
+	`
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM users`+where,
+		filter.Query, filter.Role, filter.Suspended).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	users, err := Query(ctx, `
+		SELECT id, email, username, role, email_verified, subscription_tier, subscription_status,
+			training_credits, suspended_at, suspension_reason, created_at
+		FROM users`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4 OFFSET $5
+	`, filter.Query, filter.Role, filter.Suspended, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// SetUserRole changes a user's role and returns false when the user does not exist
+func SetUserRole(ctx context.Context, userID int, role string) (bool, error) {
+	affected, err := Exec(ctx, `UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1`, userID, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to set user role: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// SuspendUser suspends an account and signs out all its sessions. Returns the user's contact
+// details, or pgx.ErrNoRows when the user does not exist.
+func SuspendUser(ctx context.Context, userID, adminID int, reason string) (map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var email, username string
+	err = tx.QueryRow(ctx, `
+		UPDATE users
+		SET suspended_at = COALESCE(suspended_at, NOW()), suspension_reason = $3, suspended_by = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING email, username
+	`, userID, adminID, reason).Scan(&email, &username)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return map[string]interface{}{"id": userID, "email": email, "username": username}, nil
+}
+
+// UnsuspendUser lifts the suspension of an account and returns false when it was not suspended
+func UnsuspendUser(ctx context.Context, userID int) (bool, error) {
+	affected, err := Exec(ctx, `
+		UPDATE users
+		SET suspended_at = NULL, suspension_reason = NULL, suspended_by = NULL, updated_at = NOW()
+		WHERE id = $1 AND suspended_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unsuspend user: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// IsUserSuspended reports whether a user's account is suspended
+func IsUserSuspended(ctx context.Context, userID int) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var suspended bool
+	err := models.Pool.QueryRow(ctx, `SELECT suspended_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&suspended)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check suspension: %w", err)
+	}
+	return suspended, nil
+}
+
+// AdjustTrainingCredits adds delta (negative to remove) to a user's training credits and records
+// why. Returns the new balance, pgx.ErrNoRows when the user does not exist, or
+// ErrInsufficientCredits when the balance would drop below zero.
+func AdjustTrainingCredits(ctx context.Context, userID, adminID, delta int, reason string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var balance int
+	if err := tx.QueryRow(ctx, `
+		SELECT COALESCE(training_credits, 0) FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(&balance); err != nil {
+		return 0, err
+	}
+	balance += delta
+	if balance < 0 {
+		return 0, ErrInsufficientCredits
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE users SET training_credits = $2, updated_at = NOW() WHERE id = $1
+	`, userID, balance); err != nil {
+		return 0, fmt.Errorf("failed to update training credits: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO credit_adjustments (user_id, admin_id, delta, balance_after, reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`, userID, adminID, delta, balance, reason); err != nil {
+		return 0, fmt.Errorf("failed to record credit adjustment: %w", err)
+	}
+	if _, err := insertCreditTransaction(ctx, tx, userID, CreditAdjustment, delta, "", reason); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return balance, nil
+}
+
+// GetCreditAdjustments returns the credit adjustments of a user, newest first
+func GetCreditAdjustments(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT c.id, c.delta, c.balance_after, c.reason, c.admin_id, a.username AS admin_username, c.created_at
+		FROM credit_adjustments c
+		LEFT JOIN users a ON a.id = c.admin_id
+		WHERE c.user_id = $1
+		ORDER BY c.created_at DESC, c.id DESC
+	`, userID)
+}
+
+// AdminTrainingFilter narrows the trainings listed for admins. Zero values match every training.
+type AdminTrainingFilter struct {
+	UserID       int
+	ModelID      int
+	TrainingType string
+}
+
+// GetTrainingRunsForAdmin returns a page of the trainings of every user, newest first, with the
+// time of their last reported metrics, and the total count
+func GetTrainingRunsForAdmin(ctx context.Context, filter AdminTrainingFilter, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	where := `
+		WHERE ($1 = 0 OR r.user_id = $1)
+			AND ($2 = 0 OR r.model_id = $2)
+			AND ($3 = '' OR r.training_type = $3)
+	`
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM model_training_runs r`+where,
+		filter.UserID, filter.ModelID, filter.TrainingType).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count trainings: %w", err)
+	}
+
+	runs, err := Query(ctx, `
+		SELECT r.id, r.training_id, r.model_id, m.name AS model_name, r.user_id, u.email AS user_email,
+			u.username, r.training_type, r.execution_mode, r.hardware_tier, r.estimated_credits::FLOAT8 AS estimated_credits,
+			r.metered_credits::FLOAT8 AS metered_credits, r.charged_credits, r.created_at AS started_at,
+			(SELECT MAX(t.recorded_at) FROM training_metric_history t
+				WHERE t.training_id = r.training_id AND t.user_id = r.user_id) AS last_reported_at
+		FROM model_training_runs r
+		JOIN models m ON m.id = r.model_id
+		JOIN users u ON u.id = r.user_id`+where+`
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT $4 OFFSET $5
+	`, filter.UserID, filter.ModelID, filter.TrainingType, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// SaveAgentBenchmark stores a benchmark result of one of the user's agents. A CNN throughput of 0
+// means the agent could not run that workload.
+func SaveAgentBenchmark(ctx context.Context, userID int, agentName, suite, device string, matmulGFLOPS, cnnSamplesPerSec, durationSeconds, score float64, systemInfo map[string]interface{}) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	var info []byte
+	if systemInfo != nil {
+		var err error
+		if info, err = json.Marshal(systemInfo); err != nil {
+			return fmt.Errorf("failed to encode system info: %w", err)
+		}
+	}
+
+	_, err := models.Pool.Exec(ctx, `
+		INSERT INTO agent_benchmarks (user_id, agent_name, suite, device, matmul_gflops, cnn_samples_per_sec, duration_seconds, score, system_info)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0::double precision), $7, $8, $9)
+	`, userID, agentName, suite, device, matmulGFLOPS, cnnSamplesPerSec, durationSeconds, score, info)
+	if err != nil {
+		return fmt.Errorf("failed to save agent benchmark: %w", err)
+	}
+	return nil
+}
+
+// GetLatestAgentBenchmark returns the most recent benchmark of one of the user's agents in a suite version
+func GetLatestAgentBenchmark(ctx context.Context, userID int, agentName, suite string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, agent_name, suite, device, matmul_gflops, cnn_samples_per_sec, duration_seconds, score, created_at
+		FROM agent_benchmarks
+		WHERE user_id = $1 AND agent_name = $2 AND suite = $3
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID, agentName, suite)
+}
+
+// GetAgentBenchmarks returns the user's agent benchmarks, newest first
+func GetAgentBenchmarks(ctx context.Context, userID, limit int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, agent_name, suite, device, matmul_gflops, cnn_samples_per_sec, duration_seconds, score, created_at
+		FROM agent_benchmarks
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+}
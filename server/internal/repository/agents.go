@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// RegisterAgent records that one of the user's agents connected and returns its ID. Agents are
+// identified by the hostname they report, so a reconnecting machine keeps its ID.
+func RegisterAgent(ctx context.Context, userID int, name string, systemInfo map[string]interface{}) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	info, err := json.Marshal(systemInfo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode system info: %w", err)
+	}
+
+	var agentID int
+	if err := models.Pool.QueryRow(ctx, `
+		INSERT INTO agents (user_id, name, system_info)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, name) DO UPDATE
+		SET system_info = EXCLUDED.system_info, last_connected_at = CURRENT_TIMESTAMP, last_seen_at = CURRENT_TIMESTAMP
+		RETURNING id
+	`, userID, name, info).Scan(&agentID); err != nil {
+		return 0, fmt.Errorf("failed to register agent: %w", err)
+	}
+	return agentID, nil
+}
+
+// GetUserAgents returns the agents the user has connected, most recently seen first
+func GetUserAgents(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT a.id, a.name, a.system_info, a.last_connected_at, a.last_seen_at, a.inventory_reported_at, a.created_at,
+			(SELECT COUNT(*) FROM agent_trainings t WHERE t.agent_id = a.id) AS trainings_count,
+			(SELECT COUNT(*) FROM agent_artifacts ar WHERE ar.agent_id = a.id) AS artifacts_count
+		FROM agents a
+		WHERE a.user_id = $1
+		ORDER BY a.last_seen_at DESC
+	`, userID)
+}
+
+// GetAgent returns one of the user's agents, or pgx.ErrNoRows
+func GetAgent(ctx context.Context, agentID, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, name, system_info, last_connected_at, last_seen_at, inventory_reported_at, created_at
+		FROM agents
+		WHERE id = $1 AND user_id = $2
+	`, agentID, userID)
+}
+
+// ReplaceAgentInventory replaces an agent's training history and artifacts with what it reported.
+// trainings and artifacts are JSON arrays of the agent's records. An artifact keeps the server path
+// it was uploaded to as long as its checksum is unchanged.
+func ReplaceAgentInventory(ctx context.Context, agentID int, trainings, artifacts []byte) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM agent_trainings
+		WHERE agent_id = $1
+			AND training_id NOT IN (SELECT t.training_id FROM jsonb_to_recordset($2::jsonb) AS t(training_id TEXT))
+	`, agentID, trainings); err != nil {
+		return fmt.Errorf("failed to prune agent trainings: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO agent_trainings (agent_id, training_id, folder_path, script_name, status, model_path, started_at, finished_at)
+		SELECT $1, t.training_id, COALESCE(t.folder_path, ''), COALESCE(t.script_name, ''), t.status, NULLIF(t.model_path, ''),
+			to_timestamp(t.started_at)::timestamp, to_timestamp(t.finished_at)::timestamp
+		FROM jsonb_to_recordset($2::jsonb) AS t(training_id TEXT, folder_path TEXT, script_name TEXT, status TEXT,
+			model_path TEXT, started_at DOUBLE PRECISION, finished_at DOUBLE PRECISION)
+		ON CONFLICT (agent_id, training_id) DO UPDATE
+		SET folder_path = EXCLUDED.folder_path,
+			script_name = EXCLUDED.script_name,
+			status = EXCLUDED.status,
+			model_path = EXCLUDED.model_path,
+			started_at = EXCLUDED.started_at,
+			finished_at = EXCLUDED.finished_at
+	`, agentID, trainings); err != nil {
+		return fmt.Errorf("failed to save agent trainings: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM agent_artifacts
+		WHERE agent_id = $1
+			AND path NOT IN (SELECT a.path FROM jsonb_to_recordset($2::jsonb) AS a(path TEXT))
+	`, agentID, artifacts); err != nil {
+		return fmt.Errorf("failed to prune agent artifacts: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO agent_artifacts (agent_id, path, size_bytes, sha256, modified_at, training_id, server_path)
+		SELECT $1, a.path, a.size_bytes, a.sha256, to_timestamp(a.modified_at)::timestamp, NULLIF(a.training_id, ''), NULLIF(a.server_path, '')
+		FROM jsonb_to_recordset($2::jsonb) AS a(path TEXT, size_bytes BIGINT, sha256 TEXT, modified_at DOUBLE PRECISION,
+			training_id TEXT, server_path TEXT)
+		ON CONFLICT (agent_id, path) DO UPDATE
+		SET size_bytes = EXCLUDED.size_bytes,
+			modified_at = EXCLUDED.modified_at,
+			training_id = EXCLUDED.training_id,
+			server_path = CASE WHEN agent_artifacts.sha256 = EXCLUDED.sha256
+				THEN COALESCE(EXCLUDED.server_path, agent_artifacts.server_path)
+				ELSE EXCLUDED.server_path END,
+			sha256 = EXCLUDED.sha256,
+			reported_at = CURRENT_TIMESTAMP
+	`, agentID, artifacts); err != nil {
+		return fmt.Errorf("failed to save agent artifacts: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE agents SET inventory_reported_at = CURRENT_TIMESTAMP WHERE id = $1`, agentID); err != nil {
+		return fmt.Errorf("failed to update agent: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetAgentTrainings returns the training history an agent reported, newest first
+func GetAgentTrainings(ctx context.Context, agentID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT training_id, folder_path, script_name, status, model_path, started_at, finished_at
+		FROM agent_trainings
+		WHERE agent_id = $1
+		ORDER BY started_at DESC NULLS LAST
+	`, agentID)
+}
+
+// GetAgentArtifacts returns the model files on an agent's machine. An artifact is on the server once
+// it, or a file with the same checksum, was uploaded from any of the user's agents or published by
+// the user; other_agents counts the user's other agents holding a copy.
+func GetAgentArtifacts(ctx context.Context, agentID, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT a.id, a.path, a.size_bytes, a.sha256, a.modified_at, a.training_id, a.server_path, a.reported_at,
+			(
+				a.server_path IS NOT NULL
+				OR EXISTS (
+					SELECT 1 FROM agent_artifacts o JOIN agents oa ON oa.id = o.agent_id
+					WHERE oa.user_id = $2 AND o.sha256 = a.sha256 AND o.server_path IS NOT NULL
+				)
+				OR EXISTS (SELECT 1 FROM published_models pm WHERE pm.publisher_id = $2 AND pm.artifact_sha256 = a.sha256)
+			) AS on_server,
+			(
+				SELECT COUNT(DISTINCT o.agent_id) FROM agent_artifacts o JOIN agents oa ON oa.id = o.agent_id
+				WHERE oa.user_id = $2 AND o.agent_id <> a.agent_id AND o.sha256 = a.sha256
+			) AS other_agents
+		FROM agent_artifacts a
+		WHERE a.agent_id = $1
+		ORDER BY a.modified_at DESC NULLS LAST, a.path
+	`, agentID, userID)
+}
+
+// SetAgentArtifactServerPath records where an agent uploaded one of its artifacts
+func SetAgentArtifactServerPath(ctx context.Context, agentID int, path, serverPath string) error {
+	if _, err := Exec(ctx, `
+		UPDATE agent_artifacts SET server_path = $3 WHERE agent_id = $1 AND path = $2
+	`, agentID, path, serverPath); err != nil {
+		return fmt.Errorf("failed to save artifact server path: %w", err)
+	}
+	return nil
+}
+
+// TouchAgent records that an agent is still connected
+func TouchAgent(ctx context.Context, agentID int) error {
+	if _, err := Exec(ctx, `UPDATE agents SET last_seen_at = CURRENT_TIMESTAMP WHERE id = $1`, agentID); err != nil {
+		return fmt.Errorf("failed to update agent last seen: %w", err)
+	}
+	return nil
+}
+
+// DeleteAgent forgets one of the user's agents with its inventory. It returns the rows deleted.
+func DeleteAgent(ctx context.Context, agentID, userID int) (int64, error) {
+	deleted, err := Exec(ctx, `DELETE FROM agents WHERE id = $1 AND user_id = $2`, agentID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete agent: %w", err)
+	}
+	return deleted, nil
+}
+
+// PurgeStaleAgents forgets the agents not seen since before and returns how many were deleted
+func PurgeStaleAgents(ctx context.Context, before time.Time) (int64, error) {
+	deleted, err := Exec(ctx, `DELETE FROM agents WHERE last_seen_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge stale agents: %w", err)
+	}
+	return deleted, nil
+}
+
+// GetAgentStalenessPolicy returns the user's agent staleness settings; NULL columns keep the defaults
+func GetAgentStalenessPolicy(ctx context.Context, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT agent_stale_after_days, agent_offline_alert_minutes FROM users WHERE id = $1
+	`, userID)
+}
+
+// SetAgentStalenessPolicy sets the user's agent staleness settings; nil restores a default
+func SetAgentStalenessPolicy(ctx context.Context, userID int, staleAfterDays, offlineAlertMinutes *int) error {
+	if _, err := Exec(ctx, `
+		UPDATE users SET agent_stale_after_days = $2, agent_offline_alert_minutes = $3 WHERE id = $1
+	`, userID, staleAfterDays, offlineAlertMinutes); err != nil {
+		return fmt.Errorf("failed to set agent staleness policy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"server/helpers"
+	"server/internal/models"
+)
+
+// readOnlyAPIKeyPrefix tells read-only keys apart from account keys (sk_live_)
+const readOnlyAPIKeyPrefix = "sk_read_"
+
+// apiKeyPrefixLength is how much of an account or read-only API key is stored in clear to
+// identify it, the key type and 4 characters of the secret
+const apiKeyPrefixLength = 12
+
+// readModelsScope is the scope of the named API keys that read-only integrations accept
+const readModelsScope = "read-models"
+
+// HashAPIKey returns the hash an API key is stored and looked up by
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetUserIDByReadAPIKey returns the user owning an account or read-only API key, or a named key
+// with the read-models scope, or 0 if none does or the account is suspended
+func GetUserIDByReadAPIKey(ctx context.Context, apiKey string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var userID int
+	var legacy bool
+	err := models.Pool.QueryRow(ctx, `
+		SELECT id, api_key IS NOT NULL OR read_only_api_key IS NOT NULL FROM users
+		WHERE (api_key_hash = $1 OR read_only_api_key_hash = $1 OR api_key = $2 OR read_only_api_key = $2)
+			AND suspended_at IS NULL
+		LIMIT 1
+	`, HashAPIKey(apiKey), apiKey).Scan(&userID, &legacy)
+	if err == pgx.ErrNoRows {
+		key, keyErr := UseAPIKey(ctx, HashAPIKey(apiKey))
+		if keyErr == pgx.ErrNoRows {
+			return 0, nil
+		}
+		if keyErr != nil {
+			return 0, keyErr
+		}
+		if !slices.Contains(key.Scopes, readModelsScope) {
+			return 0, nil
+		}
+		return key.UserID, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	if legacy {
+		rehashLegacyAPIKeys(ctx, userID)
+	}
+	return userID, nil
+}
+
+// hashUserAPIKey hashes a generated account API key, or returns "" when none could be generated
+func hashUserAPIKey(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	return HashAPIKey(apiKey)
+}
+
+// APIKeyPrefix is the start of an API key that is stored to identify it
+func APIKeyPrefix(apiKey string) string {
+	if len(apiKey) > apiKeyPrefixLength {
+		return apiKey[:apiKeyPrefixLength]
+	}
+	return apiKey
+}
+
+// rehashLegacyAPIKeys moves the account and read-only API keys a user got before keys were hashed
+// to the hash columns and clears them. Failures are logged: the keys keep working in plaintext
+// and are rehashed on their next use.
+func rehashLegacyAPIKeys(ctx context.Context, userID int) {
+	_, err := Exec(ctx, `
+		UPDATE users SET
+			api_key_hash = COALESCE(encode(sha256(convert_to(api_key, 'UTF8')), 'hex'), api_key_hash),
+			api_key_prefix = COALESCE(LEFT(api_key, $2), api_key_prefix),
+			read_only_api_key_hash = COALESCE(encode(sha256(convert_to(read_only_api_key, 'UTF8')), 'hex'), read_only_api_key_hash),
+			read_only_api_key_prefix = COALESCE(LEFT(read_only_api_key, $2), read_only_api_key_prefix),
+			api_key = NULL,
+			read_only_api_key = NULL
+		WHERE id = $1 AND (api_key IS NOT NULL OR read_only_api_key IS NOT NULL)
+	`, userID, apiKeyPrefixLength)
+	if err != nil {
+		log.Printf("❌ Failed to rehash API keys of user %d: %v", userID, err)
+		return
+	}
+	log.Printf("🔐 Rehashed the plaintext API keys of user %d", userID)
+}
+
+// GetReadOnlyAPIKeyPrefix returns the prefix identifying a user's read-only API key, or "" if
+// they never created one. The key itself is only shown when it is generated.
+func GetReadOnlyAPIKeyPrefix(ctx context.Context, userID int) (string, error) {
+	if models.Pool == nil {
+		return "", fmt.Errorf("database connection not initialized")
+	}
+
+	var prefix *string
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COALESCE(read_only_api_key_prefix, LEFT(read_only_api_key, $2)) FROM users WHERE id = $1
+	`, userID, apiKeyPrefixLength).Scan(&prefix); err != nil {
+		return "", fmt.Errorf("failed to get read-only API key: %w", err)
+	}
+	if prefix == nil {
+		return "", nil
+	}
+	return *prefix, nil
+}
+
+// RegenerateReadOnlyAPIKey creates or replaces a user's read-only API key. Only its hash is
+// stored, so the returned key cannot be retrieved again.
+func RegenerateReadOnlyAPIKey(ctx context.Context, userID int) (string, error) {
+	if models.Pool == nil {
+		return "", fmt.Errorf("database connection not initialized")
+	}
+
+	const maxRetries = 3
+	for i := 0; i < maxRetries; i++ {
+		key, err := helpers.GenerateAPIKey(fmt.Sprintf("%d", userID))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate API key: %w", err)
+		}
+		key = readOnlyAPIKeyPrefix + strings.TrimPrefix(key, "sk_live_")
+
+		_, err = Exec(ctx, `
+			UPDATE users SET read_only_api_key = NULL, read_only_api_key_hash = $1, read_only_api_key_prefix = $2
+			WHERE id = $3
+		`, HashAPIKey(key), APIKeyPrefix(key), userID)
+		if err == nil {
+			log.Printf("✅ Regenerated read-only API key for user ID: %d", userID)
+			return key, nil
+		}
+		if !strings.Contains(err.Error(), "duplicate key") {
+			return "", fmt.Errorf("failed to update read-only API key: %w", err)
+		}
+		log.Printf("⚠️  Read-only API key collision (attempt %d/%d), generating new key...", i+1, maxRetries)
+	}
+	return "", fmt.Errorf("failed to regenerate read-only API key after %d attempts", maxRetries)
+}
+
+// APIKey is a named API key that was looked up to authenticate a request, with its owner
+type APIKey struct {
+	ID                 int
+	Scopes             []string
+	UserID             int
+	Email              string
+	Username           string
+	SubscriptionTier   *string
+	SubscriptionStatus *string
+	TrainingCredits    *int
+}
+
+// CreateAPIKey stores a named API key of a user by the hash of its secret. A nil expiresAt
+// means the key does not expire.
+func CreateAPIKey(ctx context.Context, userID int, name, keyHash, keyPrefix string, scopes []string, expiresAt *time.Time) (map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	key, err := QueryRow(ctx, `
+		INSERT INTO api_keys (user_id, name, key_hash, key_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, name, key_prefix, scopes, expires_at, created_at
+	`, userID, name, keyHash, keyPrefix, scopes, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	return key, nil
+}
+
+// GetAPIKeys returns the user's named API keys that were not revoked, newest first. Expired keys
+// are listed so they can be told apart from revoked ones.
+func GetAPIKeys(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, name, key_prefix, scopes, last_used_at, expires_at, created_at,
+			COALESCE(expires_at <= NOW(), FALSE) AS expired
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+}
+
+// RevokeAPIKey revokes one of the user's named API keys. It reports whether the key existed.
+func RevokeAPIKey(ctx context.Context, keyID, userID int) (bool, error) {
+	revoked, err := Exec(ctx, `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, keyID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return revoked > 0, nil
+}
+
+// UseAPIKey looks up a named API key by its hash and records that it was used. It returns
+// pgx.ErrNoRows for unknown, revoked or expired keys and keys of suspended users.
+func UseAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	var key APIKey
+	err := models.Pool.QueryRow(ctx, `
+		UPDATE api_keys k SET last_used_at = NOW()
+		FROM users u
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > NOW())
+			AND u.id = k.user_id AND u.suspended_at IS NULL
+		RETURNING k.id, k.scopes, u.id, u.email, u.username, u.subscription_tier, u.subscription_status, u.training_credits
+	`, keyHash).Scan(&key.ID, &key.Scopes, &key.UserID, &key.Email, &key.Username,
+		&key.SubscriptionTier, &key.SubscriptionStatus, &key.TrainingCredits)
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	return &key, nil
+}
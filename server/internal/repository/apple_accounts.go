@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAppleAccountLinked is returned when linking an Apple ID to a user already linked to another
+var ErrAppleAccountLinked = errors.New("this account is already linked to another Apple ID")
+
+// GetUserByAppleSub returns the ID and email of the user linked to an Apple ID, or pgx.ErrNoRows
+func GetUserByAppleSub(ctx context.Context, appleSub string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `SELECT id, email FROM users WHERE apple_sub = $1`, appleSub)
+}
+
+// LinkAppleAccount links an Apple ID to a user. Linking the same Apple ID again is a no-op.
+func LinkAppleAccount(ctx context.Context, userID int, appleSub string) error {
+	linked, err := Exec(ctx, `
+		UPDATE users SET apple_sub = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (apple_sub IS NULL OR apple_sub = $2)
+	`, userID, appleSub)
+	if isUniqueViolation(err) {
+		return ErrAppleAccountLinked
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link Apple account: %w", err)
+	}
+	if linked == 0 {
+		return ErrAppleAccountLinked
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// AuditEntry is a security-relevant action. ActorID is 0 when no user is known, e.g. for failed logins.
+type AuditEntry struct {
+	ActorID    int
+	ActorEmail string
+	Action     string
+	TargetType string
+	TargetID   string
+	IPAddress  string
+	UserAgent  string
+	Details    map[string]interface{}
+}
+
+// InsertAuditEntry appends an entry to the audit log
+func InsertAuditEntry(ctx context.Context, entry AuditEntry) error {
+	var details interface{}
+	if len(entry.Details) > 0 {
+		data, err := json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		details = data
+	}
+	if _, err := Exec(ctx, `
+		INSERT INTO audit_log (actor_id, actor_email, action, target_type, target_id, ip_address, user_agent, details)
+		VALUES (NULLIF($1, 0), NULLIF($2, ''), $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8)
+	`, entry.ActorID, entry.ActorEmail, entry.Action, entry.TargetType, entry.TargetID, entry.IPAddress, entry.UserAgent, details); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// AuditLogFilter narrows down the audit log. Zero values match everything.
+type AuditLogFilter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   string
+	IPAddress  string
+	Since      time.Time
+	Until      time.Time
+}
+
+// GetAuditLog returns a page of the audit log, newest first, and the total count
+func GetAuditLog(ctx context.Context, filter AuditLogFilter, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var since, until *time.Time
+	if !filter.Since.IsZero() {
+		since = &filter.Since
+	}
+	if !filter.Until.IsZero() {
+		until = &filter.Until
+	}
+	where := `
+		WHERE ($1 = 0 OR actor_id = $1)
+			AND ($2 = '' OR action = $2)
+			AND ($3 = '' OR target_type = $3)
+			AND ($4 = '' OR target_id = $4)
+			AND ($5 = '' OR ip_address = $5)
+			AND ($6::TIMESTAMP IS NULL OR created_at >= $6)
+			AND ($7::TIMESTAMP IS NULL OR created_at < $7)
+	`
+	args := []interface{}{filter.ActorID, filter.Action, filter.TargetType, filter.TargetID, filter.IPAddress, since, until}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	entries, err := Query(ctx, `
+		SELECT id, actor_id, actor_email, action, target_type, target_id, ip_address, user_agent, details, created_at
+		FROM audit_log`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $8 OFFSET $9
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// AddBookmark bookmarks a published model, updating the alert preference if it is already bookmarked
+func AddBookmark(ctx context.Context, userID, publishedModelID int, emailAlerts bool) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO model_bookmarks (user_id, published_model_id, email_alerts)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, published_model_id) DO UPDATE SET email_alerts = EXCLUDED.email_alerts
+	`, userID, publishedModelID, emailAlerts); err != nil {
+		return fmt.Errorf("failed to bookmark model: %w", err)
+	}
+	return nil
+}
+
+// RemoveBookmark removes a bookmark and reports whether there was one
+func RemoveBookmark(ctx context.Context, userID, publishedModelID int) (bool, error) {
+	deleted, err := Exec(ctx, `
+		DELETE FROM model_bookmarks WHERE user_id = $1 AND published_model_id = $2
+	`, userID, publishedModelID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove bookmark: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// GetBookmarks returns a page of a user's bookmarked models, most recently bookmarked first, and the total count.
+// Listings the user can no longer see are left out.
+func GetBookmarks(ctx context.Context, userID, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM model_bookmarks b
+		JOIN published_models pm ON pm.id = b.published_model_id
+		WHERE b.user_id = $1 AND `+listingVisibleTo("$1"), userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count bookmarks: %w", err)
+	}
+
+	bookmarks, err := Query(ctx, `
+		SELECT pm.id, pm.name, pm.picture, pm.short_description, pm.price, pm.listing_type, pm.version,
+			pm.rating_average, pm.downloads_count, pm.is_active, u.username AS publisher_username,
+			b.email_alerts, b.created_at AS bookmarked_at
+		FROM model_bookmarks b
+		JOIN published_models pm ON pm.id = b.published_model_id
+		LEFT JOIN users u ON pm.publisher_id = u.id
+		WHERE b.user_id = $1 AND `+listingVisibleTo("$1")+`
+		ORDER BY b.created_at DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bookmarks, total, nil
+}
+
+// GetBookmarkers returns the users who bookmarked a published model with their email and alert
+// preference, leaving out those who can no longer see it
+func GetBookmarkers(ctx context.Context, publishedModelID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT u.id, u.email, u.username, b.email_alerts
+		FROM model_bookmarks b
+		JOIN users u ON u.id = b.user_id
+		JOIN published_models pm ON pm.id = b.published_model_id
+		WHERE b.published_model_id = $1 AND `+listingVisibleTo("b.user_id"), publishedModelID)
+}
+
+// ListingUpdate holds the editable fields of a listing. Nil fields are left unchanged; an empty
+// category clears it and empty tags remove them.
+type ListingUpdate struct {
+	Price            *int
+	Description      *string
+	ShortDescription *string
+	Category         *string
+	Tags             *[]string
+	IsFeatured       *bool
+}
+
+// UpdatePublishedModelListing updates a listing's editable fields and records a price change made by changedBy
+func UpdatePublishedModelListing(ctx context.Context, publishedModelID int, update ListingUpdate, changedBy int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var tags interface{}
+	if update.Tags != nil {
+		tags = *update.Tags
+	}
+	var oldPrice int
+	if err := tx.QueryRow(ctx, `SELECT price FROM published_models WHERE id = $1 FOR UPDATE`, publishedModelID).Scan(&oldPrice); err != nil {
+		return fmt.Errorf("failed to update listing: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE published_models
+		SET price = COALESCE($2, price),
+			description = COALESCE($3, description),
+			short_description = COALESCE($4, short_description),
+			category = CASE WHEN $5::TEXT IS NULL THEN category ELSE NULLIF($5, '') END,
+			tags = COALESCE($6::TEXT[], tags),
+			is_featured = COALESCE($7, is_featured)
+		WHERE id = $1
+	`, publishedModelID, update.Price, update.Description, update.ShortDescription, update.Category, tags, update.IsFeatured); err != nil {
+		return fmt.Errorf("failed to update listing: %w", err)
+	}
+	if update.Price != nil && *update.Price != oldPrice {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO listing_price_history (published_model_id, old_price, new_price, changed_by)
+			VALUES ($1, $2, $3, $4)
+		`, publishedModelID, oldPrice, *update.Price, changedBy); err != nil {
+			return fmt.Errorf("failed to record price change: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetListingPriceHistory returns the price changes of a listing, newest first
+func GetListingPriceHistory(ctx context.Context, publishedModelID int) ([]map[string]interface{}, error) {
+	rows, err := Query(ctx, `
+		SELECT old_price, new_price, changed_at
+		FROM listing_price_history
+		WHERE published_model_id = $1
+		ORDER BY changed_at DESC, id DESC
+	`, publishedModelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+	return rows, nil
+}
+
+// UpdatePublishedModelRental changes a listing's rental price and period. A rental price of 0 stops
+// new rentals; nil fields are left unchanged.
+func UpdatePublishedModelRental(ctx context.Context, publishedModelID int, rentalPrice, rentalDays *int) error {
+	if _, err := Exec(ctx, `
+		UPDATE published_models
+		SET rental_price = CASE WHEN $2::INTEGER IS NULL THEN rental_price ELSE NULLIF($2, 0) END,
+			rental_days = COALESCE($3, rental_days)
+		WHERE id = $1
+	`, publishedModelID, rentalPrice, rentalDays); err != nil {
+		return fmt.Errorf("failed to update rental terms: %w", err)
+	}
+	return nil
+}
+
+// UpdatePublishedModelArtifact points a listing at a new model file or template archive and bumps its version.
+// It returns the new version.
+func UpdatePublishedModelArtifact(ctx context.Context, publishedModelID int, trainedModelPath, templatePath interface{}) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var version int
+	err := models.Pool.QueryRow(ctx, `
+		UPDATE published_models
+		SET trained_model_path = COALESCE($2, trained_model_path),
+			template_path = COALESCE($3, template_path),
+			version = version + 1,
+			version_published_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING version
+	`, publishedModelID, trainedModelPath, templatePath).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update listing artifact: %w", err)
+	}
+	return version, nil
+}
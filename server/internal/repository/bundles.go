@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"server/internal/models"
+)
+
+// bundleSelect returns bundles with statistics aggregated over their items
+const bundleSelect = `
+	SELECT b.id, b.publisher_id, u.username AS publisher_username, b.name, b.description, b.price,
+		b.is_active, b.created_at, b.updated_at,
+		COUNT(pm.id) AS items_count,
+		COALESCE(SUM(pm.price), 0) AS items_total_price,
+		COALESCE(SUM(pm.downloads_count), 0) AS downloads_count,
+		COALESCE(SUM(pm.views_count), 0) AS views_count,
+		COALESCE(SUM(pm.rating_count), 0) AS rating_count,
+		COALESCE(SUM(pm.rating_average * pm.rating_count) / NULLIF(SUM(pm.rating_count), 0), 0)::float8 AS rating_average,
+		(SELECT COUNT(*) FROM bundle_purchases bp WHERE bp.bundle_id = b.id) AS purchases_count
+	FROM marketplace_bundles b
+	LEFT JOIN users u ON b.publisher_id = u.id
+	LEFT JOIN marketplace_bundle_items bi ON bi.bundle_id = b.id
+	LEFT JOIN published_models pm ON pm.id = bi.published_model_id
+`
+
+// CreateBundle creates a bundle of published listings and returns its ID
+func CreateBundle(ctx context.Context, publisherID int, name, description string, price int, listingIDs []int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var bundleID int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO marketplace_bundles (publisher_id, name, description, price)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, publisherID, name, description, price).Scan(&bundleID); err != nil {
+		return 0, fmt.Errorf("failed to create bundle: %w", err)
+	}
+
+	for position, listingID := range listingIDs {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO marketplace_bundle_items (bundle_id, published_model_id, position)
+			VALUES ($1, $2, $3)
+		`, bundleID, listingID, position); err != nil {
+			return 0, fmt.Errorf("failed to add listing %d to bundle: %w", listingID, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("✅ Created bundle %d with %d listings for publisher %d", bundleID, len(listingIDs), publisherID)
+	return bundleID, nil
+}
+
+// GetBundleByID returns a bundle with its aggregated statistics (pgx.ErrNoRows if it does not exist)
+func GetBundleByID(ctx context.Context, bundleID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, bundleSelect+`
+		WHERE b.id = $1
+		GROUP BY b.id, u.username
+	`, bundleID)
+}
+
+// GetBundleItems returns the listings in a bundle in the publisher's order
+func GetBundleItems(ctx context.Context, bundleID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT pm.id, pm.name, pm.picture, pm.short_description, pm.price, pm.listing_type,
+			pm.license_type, pm.downloads_count, pm.views_count, pm.rating_average, pm.rating_count, pm.is_active
+		FROM marketplace_bundle_items bi
+		JOIN published_models pm ON pm.id = bi.published_model_id
+		WHERE bi.bundle_id = $1
+		ORDER BY bi.position
+	`, bundleID)
+}
+
+// GetBundles returns active bundles, or every bundle of a publisher when publisherID is set
+func GetBundles(ctx context.Context, publisherID int) ([]map[string]interface{}, error) {
+	if publisherID > 0 {
+		return Query(ctx, bundleSelect+`
+			WHERE b.publisher_id = $1
+			GROUP BY b.id, u.username
+			ORDER BY b.created_at DESC
+		`, publisherID)
+	}
+	return Query(ctx, bundleSelect+`
+		WHERE b.is_active = true
+		GROUP BY b.id, u.username
+		ORDER BY b.created_at DESC
+	`)
+}
+
+// SetBundleActive publishes or unpublishes a bundle
+func SetBundleActive(ctx context.Context, bundleID int, active bool) error {
+	if _, err := Exec(ctx, `UPDATE marketplace_bundles SET is_active = $2 WHERE id = $1`, bundleID, active); err != nil {
+		return fmt.Errorf("failed to update bundle: %w", err)
+	}
+	return nil
+}
+
+// RecordBundlePurchase records a completed bundle purchase. Buying the same bundle twice is a no-op.
+func RecordBundlePurchase(ctx context.Context, bundleID, buyerID, pricePaid int, paymentMethod, transactionID string) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+	if _, err := recordBundlePurchase(ctx, models.Pool, bundleID, buyerID, pricePaid, paymentMethod, transactionID); err != nil {
+		return err
+	}
+	log.Printf("✅ Recorded purchase of bundle %d by user %d", bundleID, buyerID)
+	return nil
+}
+
+// recordBundlePurchase records a bundle purchase and reports whether the buyer did not own it yet
+func recordBundlePurchase(ctx context.Context, q querier, bundleID, buyerID, pricePaid int, paymentMethod, transactionID string) (bool, error) {
+	tag, err := q.Exec(ctx, `
+		INSERT INTO bundle_purchases (bundle_id, buyer_id, price_paid, payment_method, transaction_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (buyer_id, bundle_id) DO NOTHING
+	`, bundleID, buyerID, pricePaid, paymentMethod, transactionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record bundle purchase: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// HasPurchasedBundle reports whether a user bought a bundle
+func HasPurchasedBundle(ctx context.Context, bundleID, buyerID int) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var exists bool
+	err := models.Pool.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM bundle_purchases WHERE bundle_id = $1 AND buyer_id = $2)
+	`, bundleID, buyerID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check bundle purchase: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// CI run statuses. Pending and running runs are reported once their training ends.
+const (
+	CIRunPending = "pending"
+	CIRunRunning = "running"
+	CIRunSuccess = "success"
+	CIRunFailure = "failure"
+	CIRunError   = "error"
+)
+
+// UpsertCIIntegration creates or updates the CI integration of a model. The secret is only set
+// when the integration is created, or when rotate is true.
+func UpsertCIIntegration(ctx context.Context, modelID, userID int, secret string, rotate bool, repositoryURL, githubRepository, githubToken, callbackURL *string) (map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	integration, err := QueryRow(ctx, `
+		INSERT INTO ci_integrations (model_id, user_id, secret, repository_url, github_repository, github_token, callback_url)
+		VALUES ($1, $2, $3, $5, $6, $7, $8)
+		ON CONFLICT (model_id) DO UPDATE
+		SET secret = CASE WHEN $4 THEN EXCLUDED.secret ELSE ci_integrations.secret END,
+			repository_url = EXCLUDED.repository_url,
+			github_repository = EXCLUDED.github_repository,
+			github_token = EXCLUDED.github_token,
+			callback_url = EXCLUDED.callback_url,
+			updated_at = NOW()
+		RETURNING id, model_id, secret, repository_url, github_repository, github_token IS NOT NULL AS has_github_token,
+			callback_url, created_at, updated_at
+	`, modelID, userID, secret, rotate, repositoryURL, githubRepository, githubToken, callbackURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save CI integration: %w", err)
+	}
+	return integration, nil
+}
+
+// GetCIIntegration returns the CI integration of a model with the owner's email. It returns
+// pgx.ErrNoRows when the model has none.
+func GetCIIntegration(ctx context.Context, modelID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT c.id, c.model_id, c.user_id, u.email, c.secret, c.repository_url, c.github_repository, c.github_token,
+			c.github_token IS NOT NULL AS has_github_token, c.callback_url, c.created_at, c.updated_at,
+			m.folder, m.training_script
+		FROM ci_integrations c
+		JOIN users u ON u.id = c.user_id
+		JOIN models m ON m.id = c.model_id
+		WHERE c.model_id = $1
+	`, modelID)
+}
+
+// DeleteCIIntegration removes the CI integration of a model. It reports whether there was one.
+func DeleteCIIntegration(ctx context.Context, modelID int) (bool, error) {
+	deleted, err := Exec(ctx, `DELETE FROM ci_integrations WHERE model_id = $1`, modelID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete CI integration: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// CreateCIRun records a CI dispatch of a commit. It returns 0 when a run of the same commit is
+// still pending or running.
+func CreateCIRun(ctx context.Context, integrationID int, commitSHA string) (int, error) {
+	run, err := Query(ctx, `
+		INSERT INTO ci_runs (integration_id, commit_sha)
+		SELECT $1, $2
+		WHERE NOT EXISTS (
+			SELECT 1 FROM ci_runs
+			WHERE integration_id = $1 AND commit_sha = $2 AND status IN ('pending', 'running')
+		)
+		RETURNING id
+	`, integrationID, commitSHA)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create CI run: %w", err)
+	}
+	if len(run) == 0 {
+		return 0, nil
+	}
+	id, _ := run[0]["id"].(int32)
+	return int(id), nil
+}
+
+// UpdateCIRun sets the status of a CI run, and its training once one was started
+func UpdateCIRun(ctx context.Context, runID int, status, trainingID, message string) error {
+	_, err := Exec(ctx, `
+		UPDATE ci_runs
+		SET status = $2, training_id = COALESCE(NULLIF($3, ''), training_id), message = NULLIF($4, ''),
+			finished_at = CASE WHEN $2 IN ('pending', 'running') THEN NULL ELSE NOW() END
+		WHERE id = $1
+	`, runID, status, trainingID, message)
+	if err != nil {
+		return fmt.Errorf("failed to update CI run %d: %w", runID, err)
+	}
+	return nil
+}
+
+// GetActiveCIRuns returns the CI runs that were not reported yet, with where to report them
+func GetActiveCIRuns(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT r.id, r.commit_sha, r.training_id, r.status, r.created_at,
+			c.model_id, c.secret, c.github_repository, c.github_token, c.callback_url
+		FROM ci_runs r
+		JOIN ci_integrations c ON c.id = r.integration_id
+		WHERE r.status IN ('pending', 'running')
+	`)
+}
+
+// GetCIRuns returns the latest CI runs of an integration, newest first
+func GetCIRuns(ctx context.Context, integrationID, limit int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, commit_sha, training_id, status, message, created_at, finished_at
+		FROM ci_runs
+		WHERE integration_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, integrationID, limit)
+}
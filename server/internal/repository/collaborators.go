@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/models"
+)
+
+// CreateModelCollaboratorInvitation invites an email address to collaborate on a model. A pending
+// invitation of the same address is replaced.
+func CreateModelCollaboratorInvitation(ctx context.Context, modelID int, email, role string, invitedBy int, expiresAt time.Time) (map[string]interface{}, error) {
+	invitation, err := QueryRow(ctx, `
+		INSERT INTO model_collaborator_invitations (model_id, email, role, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (model_id, LOWER(email)) WHERE status = 'pending'
+		DO UPDATE SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by,
+			expires_at = EXCLUDED.expires_at, created_at = CURRENT_TIMESTAMP
+		RETURNING id, model_id, email, role, status, expires_at, created_at
+	`, modelID, email, role, invitedBy, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+	return invitation, nil
+}
+
+// GetModelCollaborators lists the collaborators of a model
+func GetModelCollaborators(ctx context.Context, modelID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT c.user_id, u.username, u.email, c.role, c.created_at, c.updated_at
+		FROM model_collaborators c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.model_id = $1
+		ORDER BY c.created_at ASC
+	`, modelID)
+}
+
+// GetPendingModelCollaboratorInvitations lists the invitations of a model that were not answered yet
+func GetPendingModelCollaboratorInvitations(ctx context.Context, modelID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, email, role, expires_at, created_at, expires_at <= NOW() AS expired
+		FROM model_collaborator_invitations
+		WHERE model_id = $1 AND status = 'pending'
+		ORDER BY created_at DESC
+	`, modelID)
+}
+
+// GetUserCollaboratorInvitations lists the unexpired pending invitations sent to an email address
+func GetUserCollaboratorInvitations(ctx context.Context, email string) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT i.id, i.model_id, m.name AS model_name, i.role, u.username AS invited_by, i.expires_at, i.created_at
+		FROM model_collaborator_invitations i
+		JOIN models m ON m.id = i.model_id
+		LEFT JOIN users u ON u.id = i.invited_by
+		WHERE LOWER(i.email) = LOWER($1) AND i.status = 'pending' AND i.expires_at > NOW()
+		ORDER BY i.created_at DESC
+	`, email)
+}
+
+// AcceptModelCollaboratorInvitation makes userID a collaborator with the role of an unexpired
+// pending invitation sent to email. It returns the model ID and role, or pgx.ErrNoRows.
+func AcceptModelCollaboratorInvitation(ctx context.Context, invitationID, userID int, email string) (int, string, error) {
+	if models.Pool == nil {
+		return 0, "", fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var modelID int
+	var role string
+	var invitedBy *int
+	err = tx.QueryRow(ctx, `
+		UPDATE model_collaborator_invitations
+		SET status = 'accepted', responded_at = NOW()
+		WHERE id = $1 AND LOWER(email) = LOWER($2) AND status = 'pending' AND expires_at > NOW()
+		RETURNING model_id, role, invited_by
+	`, invitationID, email).Scan(&modelID, &role, &invitedBy)
+	if err != nil {
+		return 0, "", err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO model_collaborators (model_id, user_id, role, invited_by)
+		SELECT $1, $2, $3, $4
+		FROM models WHERE id = $1 AND user_id <> $2
+		ON CONFLICT (model_id, user_id) DO UPDATE SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by
+	`, modelID, userID, role, invitedBy); err != nil {
+		return 0, "", fmt.Errorf("failed to add collaborator: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return modelID, role, nil
+}
+
+// DeclineModelCollaboratorInvitation declines a pending invitation sent to email and returns false
+// when there is none
+func DeclineModelCollaboratorInvitation(ctx context.Context, invitationID int, email string) (bool, error) {
+	affected, err := Exec(ctx, `
+		UPDATE model_collaborator_invitations
+		SET status = 'declined', responded_at = NOW()
+		WHERE id = $1 AND LOWER(email) = LOWER($2) AND status = 'pending'
+	`, invitationID, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to decline invitation: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RevokeModelCollaboratorInvitation withdraws a pending invitation of a model and returns false
+// when there is none
+func RevokeModelCollaboratorInvitation(ctx context.Context, modelID, invitationID int) (bool, error) {
+	affected, err := Exec(ctx, `
+		UPDATE model_collaborator_invitations
+		SET status = 'revoked', responded_at = NOW()
+		WHERE id = $1 AND model_id = $2 AND status = 'pending'
+	`, invitationID, modelID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// GetModelCollaboratorRole returns the role of a user on a model they collaborate on, or "" if they
+// don't. Members of the organization a model is shared with collaborate on it with the train role.
+func GetModelCollaboratorRole(ctx context.Context, modelID, userID int) (string, error) {
+	row, err := QueryRow(ctx, `
+		SELECT role FROM (
+			SELECT role FROM model_collaborators WHERE model_id = $1 AND user_id = $2
+			UNION ALL
+			SELECT 'train' FROM models md
+			JOIN organization_members om ON om.organization_id = md.organization_id
+			WHERE md.id = $1 AND om.user_id = $2 AND md.user_id <> $2
+		) roles
+		ORDER BY role = 'train' DESC
+		LIMIT 1
+	`, modelID, userID)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get collaborator role: %w", err)
+	}
+	role, _ := row["role"].(string)
+	return role, nil
+}
+
+// UpdateModelCollaboratorRole changes the role of a collaborator and returns false when the user
+// does not collaborate on the model
+func UpdateModelCollaboratorRole(ctx context.Context, modelID, userID int, role string) (bool, error) {
+	affected, err := Exec(ctx, `
+		UPDATE model_collaborators SET role = $3 WHERE model_id = $1 AND user_id = $2
+	`, modelID, userID, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to update collaborator: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RemoveModelCollaborator revokes a collaborator's access to a model and returns false when the
+// user does not collaborate on it
+func RemoveModelCollaborator(ctx context.Context, modelID, userID int) (bool, error) {
+	affected, err := Exec(ctx, `
+		DELETE FROM model_collaborators WHERE model_id = $1 AND user_id = $2
+	`, modelID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove collaborator: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// GetCollaboratorModels lists the models shared with a user, directly or through one of their
+// organizations, and their role on each
+func GetCollaboratorModels(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT md.id, md.user_id, md.name, md.picture, md.folder, md.training_script, md.trained_model_path,
+			md.trained_at, md.accuracy_score, md.created_at, md.updated_at, md.organization_id,
+			c.role AS collaborator_role, u.username AS owner_username
+		FROM models md
+		JOIN model_collaborators c ON c.model_id = md.id
+		JOIN users u ON u.id = md.user_id
+		WHERE c.user_id = $1
+		UNION ALL
+		SELECT md.id, md.user_id, md.name, md.picture, md.folder, md.training_script, md.trained_model_path,
+			md.trained_at, md.accuracy_score, md.created_at, md.updated_at, md.organization_id,
+			'train' AS collaborator_role, u.username AS owner_username
+		FROM models md
+		JOIN organization_members om ON om.organization_id = md.organization_id
+		JOIN users u ON u.id = md.user_id
+		WHERE om.user_id = $1 AND md.user_id <> $1
+			AND NOT EXISTS (SELECT 1 FROM model_collaborators c WHERE c.model_id = md.id AND c.user_id = $1)
+		ORDER BY created_at DESC
+	`, userID)
+}
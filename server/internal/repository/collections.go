@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// ErrCollectionExists is returned when a user already has a collection with the same name
+var ErrCollectionExists = errors.New("you already have a collection with this name")
+
+// CreateCollection creates a named collection for a user and returns its ID
+func CreateCollection(ctx context.Context, userID int, name, description string, public bool, slug string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var id int
+	err := models.Pool.QueryRow(ctx, `
+		INSERT INTO collections (user_id, name, description, is_public, slug)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, userID, name, description, public, slug).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrCollectionExists
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to create collection: %w", err)
+	}
+	return id, nil
+}
+
+// CountCollections counts a user's collections
+func CountCollections(ctx context.Context, userID int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var count int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM collections WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count collections: %w", err)
+	}
+	return count, nil
+}
+
+// GetCollections returns a user's collections with the number of listings in each, most recently
+// updated first
+func GetCollections(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT c.id, c.name, c.description, c.is_public, c.slug, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM collection_items i WHERE i.collection_id = c.id)::int AS item_count
+		FROM collections c
+		WHERE c.user_id = $1
+		ORDER BY c.updated_at DESC, c.id DESC
+	`, userID)
+}
+
+// GetCollection returns one of a user's collections, or pgx.ErrNoRows
+func GetCollection(ctx context.Context, userID, collectionID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, user_id, name, description, is_public, slug, created_at, updated_at
+		FROM collections
+		WHERE id = $1 AND user_id = $2
+	`, collectionID, userID)
+}
+
+// GetPublicCollection returns a public collection by slug with its owner's username, or pgx.ErrNoRows
+func GetPublicCollection(ctx context.Context, slug string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT c.id, c.user_id, c.name, c.description, c.is_public, c.slug, c.created_at, c.updated_at,
+			u.username AS owner_username
+		FROM collections c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.slug = $1 AND c.is_public = true AND u.suspended_at IS NULL
+	`, slug)
+}
+
+// UpdateCollection updates a user's collection. Nil fields are left unchanged. It reports whether
+// the collection exists.
+func UpdateCollection(ctx context.Context, userID, collectionID int, name, description *string, public *bool) (bool, error) {
+	updated, err := Exec(ctx, `
+		UPDATE collections
+		SET name = COALESCE($3, name),
+			description = COALESCE($4, description),
+			is_public = COALESCE($5, is_public)
+		WHERE id = $1 AND user_id = $2
+	`, collectionID, userID, name, description, public)
+	if isUniqueViolation(err) {
+		return false, ErrCollectionExists
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update collection: %w", err)
+	}
+	return updated > 0, nil
+}
+
+// DeleteCollection deletes a user's collection and reports whether it existed
+func DeleteCollection(ctx context.Context, userID, collectionID int) (bool, error) {
+	deleted, err := Exec(ctx, `DELETE FROM collections WHERE id = $1 AND user_id = $2`, collectionID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete collection: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// AddCollectionItem adds a listing to a collection. Adding it twice is a no-op.
+func AddCollectionItem(ctx context.Context, collectionID, listingID int) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO collection_items (collection_id, published_model_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, collectionID, listingID); err != nil {
+		return fmt.Errorf("failed to add listing to collection: %w", err)
+	}
+	if _, err := Exec(ctx, `UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, collectionID); err != nil {
+		return fmt.Errorf("failed to update collection: %w", err)
+	}
+	return nil
+}
+
+// RemoveCollectionItem removes a listing from a collection and reports whether it was in it
+func RemoveCollectionItem(ctx context.Context, collectionID, listingID int) (bool, error) {
+	removed, err := Exec(ctx, `
+		DELETE FROM collection_items WHERE collection_id = $1 AND published_model_id = $2
+	`, collectionID, listingID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove listing from collection: %w", err)
+	}
+	return removed > 0, nil
+}
+
+// GetCollectionItems returns the active listings of a collection the viewer (0 for anonymous
+// visitors) can see, most recently added first
+func GetCollectionItems(ctx context.Context, collectionID, viewerID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT pm.id, pm.name, pm.picture, pm.short_description, pm.price, pm.category, pm.listing_type,
+			pm.version, pm.rating_average, pm.downloads_count, u.username AS publisher_username,
+			i.added_at
+		FROM collection_items i
+		JOIN published_models pm ON pm.id = i.published_model_id
+		LEFT JOIN users u ON u.id = pm.publisher_id
+		WHERE i.collection_id = $1 AND pm.is_active = true AND `+listingVisibleTo("$2")+`
+		ORDER BY i.added_at DESC, pm.id DESC
+	`, collectionID, viewerID)
+}
+
+// GetSavedListingIDs returns the listings a user saved in any of their collections
+func GetSavedListingIDs(ctx context.Context, userID int) (map[int]bool, error) {
+	rows, err := Query(ctx, `
+		SELECT DISTINCT i.published_model_id
+		FROM collection_items i
+		JOIN collections c ON c.id = i.collection_id
+		WHERE c.user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved listings: %w", err)
+	}
+	saved := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		if id, ok := row["published_model_id"].(int32); ok {
+			saved[int(id)] = true
+		}
+	}
+	return saved, nil
+}
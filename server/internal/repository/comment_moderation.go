@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"server/internal/models"
+)
+
+// Statuses of a comment report
+const (
+	CommentReportOpen      = "open"
+	CommentReportResolved  = "resolved"
+	CommentReportDismissed = "dismissed"
+)
+
+// ErrCommentAlreadyReported is returned when a user reports the same comment twice
+var ErrCommentAlreadyReported = errors.New("you already reported this comment")
+
+// GetListingComment returns a comment on a listing, or pgx.ErrNoRows
+func GetListingComment(ctx context.Context, listingID, commentID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, user_id, published_model_id, parent_comment_id, comment_text, edited, hidden,
+			created_at, updated_at
+		FROM model_comments
+		WHERE id = $1 AND published_model_id = $2
+	`, commentID, listingID)
+}
+
+// UpdateCommentText replaces the text of a comment and marks it edited. Returns the comment, or
+// pgx.ErrNoRows when the user did not write it.
+func UpdateCommentText(ctx context.Context, commentID, userID int, text string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		UPDATE model_comments
+		SET comment_text = $3, edited = true
+		WHERE id = $1 AND user_id = $2
+		RETURNING id, user_id, published_model_id, parent_comment_id, comment_text, edited, hidden,
+			created_at, updated_at
+	`, commentID, userID, text)
+}
+
+// SetCommentHidden hides or shows a comment. Hiding resolves its open reports.
+func SetCommentHidden(ctx context.Context, commentID, moderatorID int, hidden bool) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE model_comments
+		SET hidden = $2,
+			hidden_by = CASE WHEN $2 THEN $3::int END,
+			hidden_at = CASE WHEN $2 THEN NOW() END
+		WHERE id = $1
+	`, commentID, hidden, moderatorID)
+	if err != nil {
+		return fmt.Errorf("failed to hide comment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	if hidden {
+		if _, err := tx.Exec(ctx, `
+			UPDATE comment_reports
+			SET status = 'resolved', resolved_by = $2, resolved_at = NOW()
+			WHERE comment_id = $1 AND status = 'open'
+		`, commentID, moderatorID); err != nil {
+			return fmt.Errorf("failed to resolve comment reports: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteListingComment deletes a comment on a listing with its replies and reports, for moderators.
+// Returns pgx.ErrNoRows when the listing has no such comment.
+func DeleteListingComment(ctx context.Context, listingID, commentID int) error {
+	n, err := Exec(ctx, `DELETE FROM model_comments WHERE id = $1 AND published_model_id = $2`, commentID, listingID)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	if n == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ReportComment records a user's report of a comment. Returns ErrCommentAlreadyReported when the
+// user reported it before.
+func ReportComment(ctx context.Context, commentID, reporterID int, reason string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var id int
+	err := models.Pool.QueryRow(ctx, `
+		INSERT INTO comment_reports (comment_id, reporter_id, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (comment_id, reporter_id) DO NOTHING
+		RETURNING id
+	`, commentID, reporterID, reason).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return 0, ErrCommentAlreadyReported
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to report comment: %w", err)
+	}
+	return id, nil
+}
+
+// DismissCommentReports closes the open reports of a comment without acting on it.
+// Returns how many reports were dismissed.
+func DismissCommentReports(ctx context.Context, commentID, moderatorID int) (int64, error) {
+	n, err := Exec(ctx, `
+		UPDATE comment_reports
+		SET status = 'dismissed', resolved_by = $2, resolved_at = NOW()
+		WHERE comment_id = $1 AND status = 'open'
+	`, commentID, moderatorID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to dismiss comment reports: %w", err)
+	}
+	return n, nil
+}
+
+// GetListingCommentReports returns the reports of the comments on a listing, oldest first.
+// An empty status returns every report.
+func GetListingCommentReports(ctx context.Context, listingID int, status string) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT r.id, r.comment_id, r.reason, r.status, r.created_at, r.resolved_at,
+			r.reporter_id, reporter.username AS reporter_username,
+			c.comment_text, c.hidden, c.user_id AS author_id, author.username AS author_username
+		FROM comment_reports r
+		JOIN model_comments c ON c.id = r.comment_id
+		LEFT JOIN users reporter ON reporter.id = r.reporter_id
+		LEFT JOIN users author ON author.id = c.user_id
+		WHERE c.published_model_id = $1 AND ($2 = '' OR r.status = $2)
+		ORDER BY r.created_at, r.id
+	`, listingID, status)
+}
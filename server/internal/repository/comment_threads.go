@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// commentThreadColumns are the columns of a comment c in a thread with its author u. reply_count
+// counts the replies the viewer $2 can see, all of them with $3 set for moderators.
+var commentThreadColumns = `
+	c.id, c.user_id, c.published_model_id, c.parent_comment_id, c.comment_text, c.edited, c.hidden,
+	c.created_at, c.updated_at, u.username,
+	(SELECT COUNT(*) FROM model_comments r
+		WHERE r.parent_comment_id = c.id AND ` + commentVisibleTo("r") + `) AS reply_count`
+
+// commentVisibleTo is the condition showing a comment to the viewer $2: hidden comments are only
+// shown to their author and, with $3 set, to moderators
+func commentVisibleTo(alias string) string {
+	return fmt.Sprintf("(NOT %[1]s.hidden OR $3 OR %[1]s.user_id = $2)", alias)
+}
+
+// GetCommentThreads returns a page of the top-level comments of a listing, oldest first, with the
+// total number of them. Each has its reply_count and, under "replies", its first replyLimit replies.
+// Hidden comments are only returned to their author and, with moderator set, to moderators.
+func GetCommentThreads(ctx context.Context, listingID, viewerID int, moderator bool, limit, offset, replyLimit int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM model_comments c
+		WHERE c.published_model_id = $1 AND c.parent_comment_id IS NULL AND `+commentVisibleTo("c"),
+		listingID, viewerID, moderator).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count comment threads: %w", err)
+	}
+
+	threads, err := Query(ctx, `
+		SELECT `+commentThreadColumns+`
+		FROM model_comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.published_model_id = $1 AND c.parent_comment_id IS NULL AND `+commentVisibleTo("c")+`
+		ORDER BY c.created_at, c.id
+		LIMIT $4 OFFSET $5
+	`, listingID, viewerID, moderator, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get comment threads: %w", err)
+	}
+	if len(threads) == 0 {
+		return threads, total, nil
+	}
+
+	parentIDs := make([]int32, 0, len(threads))
+	byID := make(map[int32]map[string]interface{}, len(threads))
+	for _, thread := range threads {
+		id, _ := thread["id"].(int32)
+		parentIDs = append(parentIDs, id)
+		byID[id] = thread
+		thread["replies"] = []map[string]interface{}{}
+	}
+	if replyLimit <= 0 {
+		return threads, total, nil
+	}
+
+	replies, err := Query(ctx, `
+		SELECT * FROM (
+			SELECT `+commentThreadColumns+`,
+				ROW_NUMBER() OVER (PARTITION BY c.parent_comment_id ORDER BY c.created_at, c.id) AS position
+			FROM model_comments c
+			LEFT JOIN users u ON u.id = c.user_id
+			WHERE c.parent_comment_id = ANY($1) AND `+commentVisibleTo("c")+`
+		) replies
+		WHERE position <= $4
+		ORDER BY parent_comment_id, position
+	`, parentIDs, viewerID, moderator, replyLimit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get comment replies: %w", err)
+	}
+	for _, reply := range replies {
+		delete(reply, "position")
+		parentID, _ := reply["parent_comment_id"].(int32)
+		if thread, ok := byID[parentID]; ok {
+			thread["replies"] = append(thread["replies"].([]map[string]interface{}), reply)
+		}
+	}
+	return threads, total, nil
+}
+
+// GetCommentReplies returns a page of the direct replies to a comment on a listing, oldest first,
+// with the total number of them. Each has its own reply_count to load deeper replies.
+func GetCommentReplies(ctx context.Context, listingID, commentID, viewerID int, moderator bool, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM model_comments c
+		WHERE c.published_model_id = $1 AND c.parent_comment_id = $4 AND `+commentVisibleTo("c"),
+		listingID, viewerID, moderator, commentID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count comment replies: %w", err)
+	}
+
+	replies, err := Query(ctx, `
+		SELECT `+commentThreadColumns+`
+		FROM model_comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.published_model_id = $1 AND c.parent_comment_id = $4 AND `+commentVisibleTo("c")+`
+		ORDER BY c.created_at, c.id
+		LIMIT $5 OFFSET $6
+	`, listingID, viewerID, moderator, commentID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get comment replies: %w", err)
+	}
+	return replies, total, nil
+}
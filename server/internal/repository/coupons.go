@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"server/internal/models"
+)
+
+// Coupon discount types
+const (
+	CouponPercent = "percent" // discount_value percent off
+	CouponFixed   = "fixed"   // discount_value cents off
+)
+
+// What a coupon applies to
+const (
+	CouponAppliesAll          = "all"
+	CouponAppliesSubscription = "subscription"
+	CouponAppliesPurchase     = "purchase"
+)
+
+var (
+	// ErrCouponExists is returned when another coupon already has the code
+	ErrCouponExists = errors.New("a coupon with this code already exists")
+	// ErrCouponRedeemed is returned when deleting a coupon that was already used
+	ErrCouponRedeemed = errors.New("this coupon was already redeemed, deactivate it instead")
+	// ErrCouponFullyRedeemed is returned when a coupon reached its max_redemptions
+	ErrCouponFullyRedeemed = errors.New("this coupon has been fully redeemed")
+	// ErrCouponUsedByUser is returned when a user reached the max_per_user of a coupon
+	ErrCouponUsedByUser = errors.New("you have already used this coupon")
+)
+
+// CouponFields are the settings of a coupon an admin creates or updates
+type CouponFields struct {
+	Code           string
+	Description    string
+	DiscountType   string
+	DiscountValue  int
+	AppliesTo      string
+	ExpiresAt      *time.Time // Nil for no expiry
+	MaxRedemptions *int       // Nil for no limit
+	MaxPerUser     int
+	IsActive       bool
+}
+
+const couponColumns = `id, code, description, discount_type, discount_value, applies_to, expires_at,
+	max_redemptions, max_per_user, redemptions_count, is_active, stripe_coupon_id, created_by,
+	created_at, updated_at`
+
+// CreateCoupon creates a coupon and returns its ID
+func CreateCoupon(ctx context.Context, fields CouponFields, adminID int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var id int
+	err := models.Pool.QueryRow(ctx, `
+		INSERT INTO coupons (code, description, discount_type, discount_value, applies_to, expires_at,
+			max_redemptions, max_per_user, is_active, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, fields.Code, fields.Description, fields.DiscountType, fields.DiscountValue, fields.AppliesTo,
+		fields.ExpiresAt, fields.MaxRedemptions, fields.MaxPerUser, fields.IsActive, adminID).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrCouponExists
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to create coupon: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateCoupon replaces the settings of a coupon and reports whether it exists. A changed discount
+// needs a new Stripe coupon, so the cached one is dropped.
+func UpdateCoupon(ctx context.Context, couponID int, fields CouponFields) (bool, error) {
+	updated, err := Exec(ctx, `
+		UPDATE coupons
+		SET code = $2, description = $3, discount_type = $4, discount_value = $5, applies_to = $6,
+			expires_at = $7, max_redemptions = $8, max_per_user = $9, is_active = $10,
+			stripe_coupon_id = CASE WHEN discount_type = $4 AND discount_value = $5 THEN stripe_coupon_id END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, couponID, fields.Code, fields.Description, fields.DiscountType, fields.DiscountValue, fields.AppliesTo,
+		fields.ExpiresAt, fields.MaxRedemptions, fields.MaxPerUser, fields.IsActive)
+	if isUniqueViolation(err) {
+		return false, ErrCouponExists
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update coupon: %w", err)
+	}
+	return updated > 0, nil
+}
+
+// DeleteCoupon deletes a coupon that was never redeemed and reports whether it existed
+func DeleteCoupon(ctx context.Context, couponID int) (bool, error) {
+	deleted, err := Exec(ctx, `DELETE FROM coupons WHERE id = $1 AND redemptions_count = 0`, couponID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete coupon: %w", err)
+	}
+	if deleted > 0 {
+		return true, nil
+	}
+	if _, err := GetCoupon(ctx, couponID); err != nil {
+		return false, nil
+	}
+	return false, ErrCouponRedeemed
+}
+
+// GetCoupons returns a page of coupons, newest first, with the total number of them
+func GetCoupons(ctx context.Context, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM coupons`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count coupons: %w", err)
+	}
+	coupons, err := Query(ctx, `
+		SELECT `+couponColumns+`
+		FROM coupons
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get coupons: %w", err)
+	}
+	return coupons, total, nil
+}
+
+// GetCoupon returns a coupon, or pgx.ErrNoRows
+func GetCoupon(ctx context.Context, couponID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `SELECT `+couponColumns+` FROM coupons WHERE id = $1`, couponID)
+}
+
+// GetCouponByCode returns the coupon with a code, ignoring case, or pgx.ErrNoRows
+func GetCouponByCode(ctx context.Context, code string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `SELECT `+couponColumns+` FROM coupons WHERE code = UPPER($1)`, code)
+}
+
+// CountUserRedemptions counts how many times a user redeemed a coupon
+func CountUserRedemptions(ctx context.Context, couponID, userID int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var count int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2
+	`, couponID, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count coupon redemptions: %w", err)
+	}
+	return count, nil
+}
+
+// RedeemCoupon records that a completed payment used a coupon. Recording the same payment again
+// is a no-op. It fails with ErrCouponFullyRedeemed or ErrCouponUsedByUser past the coupon's limits.
+func RedeemCoupon(ctx context.Context, couponID, userID int, kind, reference string, discount int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := redeemCoupon(ctx, tx, couponID, userID, kind, reference, discount); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// redeemCoupon records a redemption in tx and reports whether it is new. Counting it locks the
+// coupon until tx ends, so concurrent redemptions check max_redemptions and max_per_user one after
+// the other.
+func redeemCoupon(ctx context.Context, tx pgx.Tx, couponID, userID int, kind, reference string, discount int) (bool, error) {
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO coupon_redemptions (coupon_id, user_id, kind, reference, discount)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (coupon_id, reference) DO NOTHING
+	`, couponID, userID, kind, reference, discount)
+	if err != nil {
+		return false, fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	var maxPerUser int
+	err = tx.QueryRow(ctx, `
+		UPDATE coupons SET redemptions_count = redemptions_count + 1
+		WHERE id = $1 AND (COALESCE(max_redemptions, 0) <= 0 OR redemptions_count < max_redemptions)
+		RETURNING max_per_user
+	`, couponID).Scan(&maxPerUser)
+	if err == pgx.ErrNoRows {
+		return false, ErrCouponFullyRedeemed
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+
+	var used int
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2
+	`, couponID, userID).Scan(&used); err != nil {
+		return false, fmt.Errorf("failed to count coupon redemptions: %w", err)
+	}
+	if used > maxPerUser {
+		return false, ErrCouponUsedByUser
+	}
+	return true, nil
+}
+
+// CouponPurchase is a marketplace purchase a coupon makes free: a bundle when BundleID is set,
+// otherwise a model, rented when RentalDays is set
+type CouponPurchase struct {
+	CouponID         int
+	Discount         int // Cents
+	BuyerID          int
+	BundleID         int
+	PublishedModelID int
+	PublisherID      int
+	RentalDays       int
+	Reference        string
+}
+
+// RecordCouponPurchase redeems a coupon and grants the purchase it made free in one transaction,
+// so nothing is granted past the coupon's limits. It reports false, without redeeming the coupon,
+// when the buyer already owns what they bought.
+func RecordCouponPurchase(ctx context.Context, purchase CouponPurchase) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	granted := false
+	switch {
+	case purchase.BundleID > 0:
+		granted, err = recordBundlePurchase(ctx, tx, purchase.BundleID, purchase.BuyerID, 0, "coupon", purchase.Reference)
+	case purchase.RentalDays > 0:
+		_, err = recordModelRental(ctx, tx, purchase.BuyerID, purchase.PublishedModelID, purchase.PublisherID, 0, purchase.RentalDays, "coupon", purchase.Reference)
+		granted = err == nil
+		if err == pgx.ErrNoRows {
+			err = nil
+		}
+	default:
+		granted, err = recordModelPurchase(ctx, tx, purchase.BuyerID, purchase.PublishedModelID, purchase.PublisherID, 0, "coupon", purchase.Reference)
+	}
+	if err != nil || !granted {
+		return false, err
+	}
+
+	if _, err := redeemCoupon(ctx, tx, purchase.CouponID, purchase.BuyerID, CouponAppliesPurchase, purchase.Reference, purchase.Discount); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit coupon purchase: %w", err)
+	}
+	return true, nil
+}
+
+// SetStripeCoupon saves the ID of the Stripe coupon created for a coupon
+func SetStripeCoupon(ctx context.Context, couponID int, stripeCouponID string) error {
+	if _, err := Exec(ctx, `UPDATE coupons SET stripe_coupon_id = $2 WHERE id = $1`, couponID, stripeCouponID); err != nil {
+		return fmt.Errorf("failed to save stripe coupon: %w", err)
+	}
+	return nil
+}
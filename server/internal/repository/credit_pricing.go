@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// GetCreditPricing returns the credit price of every hardware tier
+func GetCreditPricing(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT hardware_tier, credits_per_hour::FLOAT8 AS credits_per_hour, minimum_credits::FLOAT8 AS minimum_credits,
+			preemptible_multiplier::FLOAT8 AS preemptible_multiplier, updated_by, updated_at
+		FROM training_credit_pricing
+		ORDER BY credits_per_hour, hardware_tier
+	`)
+}
+
+// GetCreditPrice returns the credit price of a hardware tier, or pgx.ErrNoRows
+func GetCreditPrice(ctx context.Context, hardwareTier string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT hardware_tier, credits_per_hour::FLOAT8 AS credits_per_hour, minimum_credits::FLOAT8 AS minimum_credits,
+			preemptible_multiplier::FLOAT8 AS preemptible_multiplier, updated_by, updated_at
+		FROM training_credit_pricing
+		WHERE hardware_tier = $1
+	`, hardwareTier)
+}
+
+// SetCreditPrice creates or replaces the credit price of a hardware tier
+func SetCreditPrice(ctx context.Context, hardwareTier string, creditsPerHour, minimumCredits, preemptibleMultiplier float64, adminID int) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO training_credit_pricing (hardware_tier, credits_per_hour, minimum_credits, preemptible_multiplier, updated_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (hardware_tier) DO UPDATE SET
+			credits_per_hour = EXCLUDED.credits_per_hour,
+			minimum_credits = EXCLUDED.minimum_credits,
+			preemptible_multiplier = EXCLUDED.preemptible_multiplier,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = CURRENT_TIMESTAMP
+	`, hardwareTier, creditsPerHour, minimumCredits, preemptibleMultiplier, adminID); err != nil {
+		return fmt.Errorf("failed to set credit price: %w", err)
+	}
+	return nil
+}
+
+// GetAverageTrainingRunSeconds returns the average running time of the last finished server
+// trainings of a model, and false when it has none
+func GetAverageTrainingRunSeconds(ctx context.Context, modelID int) (float64, bool, error) {
+	if models.Pool == nil {
+		return 0, false, fmt.Errorf("database connection not initialized")
+	}
+
+	var average *float64
+	err := models.Pool.QueryRow(ctx, `
+		SELECT AVG(run_seconds)::FLOAT8 FROM (
+			SELECT run_seconds FROM model_training_runs
+			WHERE model_id = $1 AND training_type = 'server' AND finalized_at IS NOT NULL AND run_seconds IS NOT NULL
+			ORDER BY finalized_at DESC
+			LIMIT 10
+		) recent
+	`, modelID).Scan(&average)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get average training time: %w", err)
+	}
+	if average == nil {
+		return 0, false, nil
+	}
+	return *average, true, nil
+}
+
+// SetTrainingRunCreditEstimate records the hardware tier and credit estimate a server training started with
+func SetTrainingRunCreditEstimate(ctx context.Context, trainingID, hardwareTier string, credits float64) error {
+	if _, err := Exec(ctx, `
+		UPDATE model_training_runs SET hardware_tier = $2, estimated_credits = $3 WHERE training_id = $1
+	`, trainingID, hardwareTier, credits); err != nil {
+		return fmt.Errorf("failed to record credit estimate: %w", err)
+	}
+	return nil
+}
+
+// FinalizeTrainingRunCredits records the metered credits of a finished training and, when charge
+// is set, takes the whole credits it adds to the user's metered total this month from their balance.
+// Credits reserved when the training started are settled: what the training did not use is refunded.
+// An empty hardwareTier finalizes a training that never ran.
+// It returns the credits taken, and pgx.ErrNoRows when the run is not recorded yet. A run is only
+// finalized once; later calls take nothing.
+func FinalizeTrainingRunCredits(ctx context.Context, trainingID, hardwareTier string, runTime time.Duration, credits float64, charge bool) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID      int
+		finalizedAt *time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT user_id, finalized_at FROM model_training_runs WHERE training_id = $1 FOR UPDATE
+	`, trainingID).Scan(&userID, &finalizedAt)
+	if err != nil {
+		return 0, err
+	}
+	if finalizedAt != nil {
+		return 0, nil
+	}
+
+	// Lock the user so concurrent finalizations see each other's credits
+	if _, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return 0, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	charged := 0
+	if charge {
+		err = tx.QueryRow(ctx, `
+			SELECT (CEIL(total + $2::NUMERIC) - CEIL(total))::INT FROM (
+				SELECT COALESCE(SUM(metered_credits), 0) AS total FROM model_training_runs
+				WHERE user_id = $1 AND finalized_at >= date_trunc('month', CURRENT_TIMESTAMP)
+			) totals
+		`, userID, credits).Scan(&charged)
+		if err != nil {
+			return 0, fmt.Errorf("failed to meter credits: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE model_training_runs
+		SET hardware_tier = COALESCE(NULLIF($2, ''), hardware_tier), run_seconds = CASE WHEN $2 = '' THEN NULL ELSE $3::INT END,
+			metered_credits = $4, charged_credits = $5, finalized_at = CURRENT_TIMESTAMP
+		WHERE training_id = $1
+	`, trainingID, hardwareTier, int(runTime.Seconds()), credits, charged); err != nil {
+		return 0, fmt.Errorf("failed to finalize training run: %w", err)
+	}
+
+	var (
+		reserved int
+		orgID    *int
+	)
+	if err := tx.QueryRow(ctx, `
+		SELECT COALESCE(-SUM(amount), 0)::INT, MAX(organization_id) FROM credit_transactions
+		WHERE training_id = $1 AND kind IN ('reservation', 'refund')
+	`, trainingID).Scan(&reserved, &orgID); err != nil {
+		return 0, fmt.Errorf("failed to get credit reservation: %w", err)
+	}
+	if settle := reserved - charged; settle != 0 {
+		kind, description := CreditCharge, fmt.Sprintf("Training used %.2f credits", credits)
+		if settle > 0 {
+			kind, description = CreditRefund, fmt.Sprintf("Training used %.2f credits of the %d reserved", credits, reserved)
+		}
+		// Trainings reserved from an organization's pool are settled with it
+		if orgID != nil {
+			if _, err := tx.Exec(ctx, `
+				UPDATE organizations SET training_credits = GREATEST(training_credits + $2, 0) WHERE id = $1
+			`, *orgID, settle); err != nil {
+				return 0, fmt.Errorf("failed to charge training credits: %w", err)
+			}
+			if _, err := insertOrganizationCreditTransaction(ctx, tx, *orgID, userID, kind, settle, trainingID, description); err != nil {
+				return 0, err
+			}
+		} else {
+			if _, err := tx.Exec(ctx, `
+				UPDATE users SET training_credits = GREATEST(training_credits + $2, 0), updated_at = CURRENT_TIMESTAMP WHERE id = $1
+			`, userID, settle); err != nil {
+				return 0, fmt.Errorf("failed to charge training credits: %w", err)
+			}
+			if _, err := insertCreditTransaction(ctx, tx, userID, kind, settle, trainingID, description); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return charged, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// Reasons of credit resets
+const (
+	CreditResetAnniversary = "anniversary"
+	CreditResetSubscribed  = "subscribed"
+	CreditResetTierChange  = "tier_change"
+	CreditResetCanceled    = "canceled"
+)
+
+// SubscriptionCredits is the subscription and training credit balance of a user
+type SubscriptionCredits struct {
+	UserID      int
+	Tier        string
+	Status      string
+	Credits     int
+	StartDate   *time.Time
+	NextResetAt *time.Time
+}
+
+// CreditResetPlan is the change ResetSubscriptionCredits makes to a user's subscription
+type CreditResetPlan struct {
+	Reason      string
+	Tier        string
+	Credits     int
+	NextResetAt *time.Time
+	// Fields are other users columns to update, such as the subscription status and dates
+	Fields map[string]interface{}
+}
+
+// ResetSubscriptionCredits sets the subscription credits of a user to the result of plan, which is
+// called with the user's row locked. A nil plan leaves the user untouched. The change is recorded in
+// credit_resets and, when the balance moves, in the credit ledger.
+func ResetSubscriptionCredits(ctx context.Context, email string, plan func(SubscriptionCredits) *CreditResetPlan) (*CreditResetPlan, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current SubscriptionCredits
+	if err := tx.QueryRow(ctx, `
+		SELECT id, COALESCE(subscription_tier, 'free'), COALESCE(subscription_status, ''),
+			COALESCE(training_credits, 0), subscription_start_date, next_credit_reset_at
+		FROM users WHERE email = $1
+		FOR UPDATE
+	`, email).Scan(&current.UserID, &current.Tier, &current.Status, &current.Credits,
+		&current.StartDate, &current.NextResetAt); err != nil {
+		return nil, fmt.Errorf("failed to get user subscription: %w", err)
+	}
+
+	change := plan(current)
+	if change == nil {
+		return nil, nil
+	}
+
+	query := "UPDATE users SET updated_at = CURRENT_TIMESTAMP, subscription_tier = $2, training_credits = $3, next_credit_reset_at = $4"
+	args := []interface{}{current.UserID, change.Tier, change.Credits, change.NextResetAt}
+	for field, value := range change.Fields {
+		args = append(args, value)
+		query += fmt.Sprintf(", %s = $%d", field, len(args))
+	}
+	if _, err := tx.Exec(ctx, query+" WHERE id = $1", args...); err != nil {
+		return nil, fmt.Errorf("failed to reset training credits: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO credit_resets (user_id, reason, previous_tier, tier, previous_credits, credits, next_reset_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, current.UserID, change.Reason, current.Tier, change.Tier, current.Credits, change.Credits,
+		change.NextResetAt); err != nil {
+		return nil, fmt.Errorf("failed to record credit reset: %w", err)
+	}
+	if amount := change.Credits - current.Credits; amount != 0 {
+		description := fmt.Sprintf("%s credit reset (%s tier)", change.Reason, change.Tier)
+		if _, err := insertCreditTransaction(ctx, tx, current.UserID, CreditReset, amount, "", description); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return change, nil
+}
+
+// GetDueCreditResets returns the emails of active paid subscribers whose credits are due for a reset
+// at now, or who have no reset scheduled yet
+func GetDueCreditResets(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := Query(ctx, `
+		SELECT email FROM users
+		WHERE COALESCE(subscription_tier, 'free') != 'free' AND subscription_status = 'active'
+			AND (next_credit_reset_at IS NULL OR next_credit_reset_at <= $1)
+		ORDER BY next_credit_reset_at NULLS FIRST
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due credit resets: %w", err)
+	}
+
+	emails := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if email, ok := row["email"].(string); ok {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
+// GetCreditResets returns the most recent credit resets of a user
+func GetCreditResets(ctx context.Context, userID, limit int) ([]map[string]interface{}, error) {
+	rows, err := Query(ctx, `
+		SELECT id, reason, previous_tier, tier, previous_credits, credits, next_reset_at, created_at
+		FROM credit_resets
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit resets: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/models"
+)
+
+// Kinds of credit transactions
+const (
+	CreditReservation = "reservation"
+	CreditRefund      = "refund"
+	CreditCharge      = "charge"
+	CreditAdjustment  = "adjustment"
+	CreditReset       = "reset"
+	CreditTransfer    = "transfer"
+)
+
+// insertCreditTransaction records a change of amount credits made to a user's balance within tx,
+// after the balance was updated
+func insertCreditTransaction(ctx context.Context, tx pgx.Tx, userID int, kind string, amount int, trainingID, description string) (int, error) {
+	var id int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO credit_transactions (user_id, kind, amount, balance_after, training_id, description)
+		SELECT id, $2, $3, COALESCE(training_credits, 0), NULLIF($4, ''), $5 FROM users WHERE id = $1
+		RETURNING id
+	`, userID, kind, amount, trainingID, description).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to record credit transaction: %w", err)
+	}
+	return id, nil
+}
+
+// insertOrganizationCreditTransaction records a change of amount credits made by userID to an
+// organization's pool within tx, after the pool was updated
+func insertOrganizationCreditTransaction(ctx context.Context, tx pgx.Tx, orgID, userID int, kind string, amount int, trainingID, description string) (int, error) {
+	var id int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO credit_transactions (user_id, organization_id, kind, amount, balance_after, training_id, description)
+		SELECT $2, id, $3, $4, training_credits, NULLIF($5, ''), $6 FROM organizations WHERE id = $1
+		RETURNING id
+	`, orgID, userID, kind, amount, trainingID, description).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to record credit transaction: %w", err)
+	}
+	return id, nil
+}
+
+// ReserveTrainingCredits takes credits from a user's balance before a server training starts, only
+// if the balance covers them. It returns the reservation's transaction ID, or ErrInsufficientCredits.
+func ReserveTrainingCredits(ctx context.Context, userID, credits int, description string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET training_credits = training_credits - $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND training_credits >= $2
+	`, userID, credits)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve training credits: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, ErrInsufficientCredits
+	}
+	id, err := insertCreditTransaction(ctx, tx, userID, CreditReservation, -credits, "", description)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, nil
+}
+
+// ReserveOrganizationTrainingCredits takes credits from an organization's pool before a member's
+// server training starts, only if the pool covers them. It returns the reservation's transaction ID,
+// or ErrInsufficientCredits.
+func ReserveOrganizationTrainingCredits(ctx context.Context, orgID, userID, credits int, description string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE organizations SET training_credits = training_credits - $2
+		WHERE id = $1 AND training_credits >= $2
+	`, orgID, credits)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve training credits: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, ErrInsufficientCredits
+	}
+	id, err := insertOrganizationCreditTransaction(ctx, tx, orgID, userID, CreditReservation, -credits, "", description)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, nil
+}
+
+// TransferCreditsToOrganization moves credits from a member's balance to an organization's pool,
+// only if the balance covers them. It returns the pool's new balance, or ErrInsufficientCredits.
+func TransferCreditsToOrganization(ctx context.Context, orgID, userID, credits int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET training_credits = training_credits - $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND training_credits >= $2
+	`, userID, credits)
+	if err != nil {
+		return 0, fmt.Errorf("failed to transfer training credits: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, ErrInsufficientCredits
+	}
+	var balance int
+	if err := tx.QueryRow(ctx, `
+		UPDATE organizations SET training_credits = training_credits + $2 WHERE id = $1 RETURNING training_credits
+	`, orgID, credits).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("failed to transfer training credits: %w", err)
+	}
+
+	description := fmt.Sprintf("Transferred to organization #%d", orgID)
+	if _, err := insertCreditTransaction(ctx, tx, userID, CreditTransfer, -credits, "", description); err != nil {
+		return 0, err
+	}
+	if _, err := insertOrganizationCreditTransaction(ctx, tx, orgID, userID, CreditTransfer, credits, "", "Transferred by a member"); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return balance, nil
+}
+
+// AttachCreditReservation links a reservation to the training it was made for, so that finalizing
+// the training settles it
+func AttachCreditReservation(ctx context.Context, transactionID int, trainingID string) error {
+	if _, err := Exec(ctx, `
+		UPDATE credit_transactions SET training_id = $2 WHERE id = $1 AND kind = 'reservation'
+	`, transactionID, trainingID); err != nil {
+		return fmt.Errorf("failed to attach credit reservation: %w", err)
+	}
+	return nil
+}
+
+// RefundCreditReservation gives back the credits of a reservation whose training did not start
+func RefundCreditReservation(ctx context.Context, transactionID int, description string) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID     int
+		orgID      *int
+		amount     int
+		trainingID *string
+	)
+	if err := tx.QueryRow(ctx, `
+		SELECT user_id, organization_id, amount, training_id FROM credit_transactions
+		WHERE id = $1 AND kind = 'reservation'
+		FOR UPDATE
+	`, transactionID).Scan(&userID, &orgID, &amount, &trainingID); err != nil {
+		return fmt.Errorf("failed to get credit reservation: %w", err)
+	}
+	id := ""
+	if trainingID != nil {
+		id = *trainingID
+	}
+	if orgID != nil {
+		if _, err := tx.Exec(ctx, `
+			UPDATE organizations SET training_credits = training_credits + $2 WHERE id = $1
+		`, *orgID, -amount); err != nil {
+			return fmt.Errorf("failed to refund training credits: %w", err)
+		}
+		if _, err := insertOrganizationCreditTransaction(ctx, tx, *orgID, userID, CreditRefund, -amount, id, description); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.Exec(ctx, `
+			UPDATE users SET training_credits = training_credits + $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+		`, userID, -amount); err != nil {
+			return fmt.Errorf("failed to refund training credits: %w", err)
+		}
+		if _, err := insertCreditTransaction(ctx, tx, userID, CreditRefund, -amount, id, description); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetCreditTransactions returns a page of the transactions of a user's own balance, newest first, and
+// the total count
+func GetCreditTransactions(ctx context.Context, userID, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM credit_transactions WHERE user_id = $1 AND organization_id IS NULL
+	`, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count credit transactions: %w", err)
+	}
+
+	transactions, err := Query(ctx, `
+		SELECT id, kind, amount, balance_after, training_id, description, created_at
+		FROM credit_transactions
+		WHERE user_id = $1 AND organization_id IS NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return transactions, total, nil
+}
+
+// GetMonthlyCreditUsage returns the credits a user's trainings consumed from their own balance and the
+// credits admins added or removed in each of the last months, newest first
+func GetMonthlyCreditUsage(ctx context.Context, userID, months int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT date_trunc('month', created_at) AS month,
+			(-COALESCE(SUM(amount) FILTER (WHERE kind IN ('reservation', 'refund', 'charge')), 0))::INT AS consumed,
+			COALESCE(SUM(amount) FILTER (WHERE kind = 'adjustment'), 0)::INT AS adjusted,
+			COUNT(DISTINCT training_id) AS trainings
+		FROM credit_transactions
+		WHERE user_id = $1 AND organization_id IS NULL AND created_at >= date_trunc('month', CURRENT_TIMESTAMP) - make_interval(months => $2 - 1)
+		GROUP BY 1
+		ORDER BY 1 DESC
+	`, userID, months)
+}
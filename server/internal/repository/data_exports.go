@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Kinds of data exports
+const (
+	DataExportTrainingRuns       = "training_runs"
+	DataExportPublisherAnalytics = "publisher_analytics"
+)
+
+// Statuses of data exports
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// maxExportRows caps the rows of a single export
+const maxExportRows = 100000
+
+// GetTrainingRunsForExport returns a user's training runs started in [from, to) with their
+// configuration, duration, final metrics and the training credits they cost: the metered credits of
+// server trainings (one per on-demand and half per preemptible training before metering), none for
+// agent trainings
+func GetTrainingRunsForExport(ctx context.Context, userID int, from, to time.Time) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT r.training_id, r.model_id, m.name AS model_name, r.training_type, r.execution_mode,
+			m.training_script, m.primary_metric, m.primary_metric_direction,
+			r.created_at AS started_at, h.ended_at,
+			EXTRACT(EPOCH FROM h.ended_at - r.created_at)::FLOAT8 AS duration_seconds,
+			h.epochs, h.total_epochs, h.train_loss, h.val_loss, h.train_accuracy, h.val_accuracy,
+			h.test_accuracy, h.custom_metrics,
+			CASE WHEN r.training_type = 'agent' THEN 0
+				WHEN r.metered_credits IS NOT NULL THEN r.metered_credits
+				WHEN r.execution_mode = 'preemptible' THEN 0.5
+				ELSE 1 END::FLOAT8 AS credits,
+			r.hardware_tier,
+			r.network_mode
+		FROM model_training_runs r
+		JOIN models m ON m.id = r.model_id
+		LEFT JOIN LATERAL (
+			SELECT MAX(t.recorded_at) AS ended_at, MAX(t.epoch) AS epochs, MAX(t.total_epochs) AS total_epochs,
+				(array_agg(t.train_loss ORDER BY t.recorded_at DESC) FILTER (WHERE t.train_loss IS NOT NULL))[1] AS train_loss,
+				(array_agg(t.val_loss ORDER BY t.recorded_at DESC) FILTER (WHERE t.val_loss IS NOT NULL))[1] AS val_loss,
+				(array_agg(t.train_accuracy ORDER BY t.recorded_at DESC) FILTER (WHERE t.train_accuracy IS NOT NULL))[1] AS train_accuracy,
+				(array_agg(t.val_accuracy ORDER BY t.recorded_at DESC) FILTER (WHERE t.val_accuracy IS NOT NULL))[1] AS val_accuracy,
+				(array_agg(t.test_accuracy ORDER BY t.recorded_at DESC) FILTER (WHERE t.test_accuracy IS NOT NULL))[1] AS test_accuracy,
+				(array_agg(t.custom_metrics ORDER BY t.recorded_at DESC) FILTER (WHERE t.custom_metrics IS NOT NULL))[1] AS custom_metrics
+			FROM training_metric_history t
+			WHERE t.training_id = r.training_id AND t.user_id = r.user_id
+		) h ON true
+		WHERE r.user_id = $1 AND r.created_at >= $2 AND r.created_at < $3
+		ORDER BY r.created_at
+		LIMIT $4
+	`, userID, from, to, maxExportRows)
+}
+
+// GetPublisherDailyStatsForExport returns the views, downloads and revenue (in cents) of each of a
+// publisher's listings per day in [from, to)
+func GetPublisherDailyStatsForExport(ctx context.Context, publisherID int, from, to time.Time) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		WITH events AS (
+			SELECT v.model_id AS listing_id, v.viewed_at::DATE AS day, COUNT(*) AS views, 0 AS downloads, 0 AS revenue
+			FROM model_views v
+			JOIN published_models p ON p.id = v.model_id
+			WHERE p.publisher_id = $1 AND v.viewed_at >= $2 AND v.viewed_at < $3
+			GROUP BY 1, 2
+			UNION ALL
+			SELECT l.published_model_id, l.downloaded_at::DATE, 0, COUNT(*), SUM(l.price_paid)
+			FROM model_download_ledger l
+			WHERE l.publisher_id = $1 AND l.downloaded_at >= $2 AND l.downloaded_at < $3
+			GROUP BY 1, 2
+		)
+		SELECT e.day, e.listing_id, p.name AS listing_name,
+			SUM(e.views)::INT AS views, SUM(e.downloads)::INT AS downloads, SUM(e.revenue)::INT AS revenue_cents
+		FROM events e
+		JOIN published_models p ON p.id = e.listing_id
+		GROUP BY e.day, e.listing_id, p.name
+		ORDER BY e.day, e.listing_id
+		LIMIT $4
+	`, publisherID, from, to, maxExportRows)
+}
+
+// CreateDataExport queues a background export and returns its ID
+func CreateDataExport(ctx context.Context, userID int, kind, format string, from, to, expiresAt time.Time) (int, error) {
+	row, err := QueryRow(ctx, `
+		INSERT INTO data_exports (user_id, kind, format, range_from, range_to, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, userID, kind, format, from, to, expiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create data export: %w", err)
+	}
+	id, _ := row["id"].(int32)
+	return int(id), nil
+}
+
+// CompleteDataExport marks an export ready to download from filePath
+func CompleteDataExport(ctx context.Context, exportID int, filePath string, rowCount int) error {
+	if _, err := Exec(ctx, `
+		UPDATE data_exports SET status = 'ready', file_path = $2, row_count = $3, completed_at = NOW()
+		WHERE id = $1
+	`, exportID, filePath, rowCount); err != nil {
+		return fmt.Errorf("failed to complete data export: %w", err)
+	}
+	return nil
+}
+
+// FailDataExport marks an export failed with the reason
+func FailDataExport(ctx context.Context, exportID int, reason string) error {
+	if _, err := Exec(ctx, `
+		UPDATE data_exports SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE id = $1
+	`, exportID, reason); err != nil {
+		return fmt.Errorf("failed to fail data export: %w", err)
+	}
+	return nil
+}
+
+// GetDataExport returns one of the user's exports, or pgx.ErrNoRows
+func GetDataExport(ctx context.Context, exportID, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, kind, format, range_from, range_to, status, file_path, row_count, error,
+			created_at, completed_at, expires_at
+		FROM data_exports
+		WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+	`, exportID, userID)
+}
+
+// GetDataExports lists the user's exports that have not expired, newest first
+func GetDataExports(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, kind, format, range_from, range_to, status, row_count, error, created_at, completed_at, expires_at
+		FROM data_exports
+		WHERE user_id = $1 AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`, userID)
+}
+
+// DeleteExpiredDataExports deletes expired exports and returns the files they leave behind
+func DeleteExpiredDataExports(ctx context.Context) ([]string, error) {
+	rows, err := Query(ctx, `DELETE FROM data_exports WHERE expires_at <= NOW() RETURNING file_path`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired data exports: %w", err)
+	}
+	var paths []string
+	for _, row := range rows {
+		if path, ok := row["file_path"].(string); ok && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
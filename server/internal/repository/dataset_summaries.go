@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SaveDatasetSummary stores the dataset summary of a model, inspected from its folder as it was
+// at folderModifiedAt
+func SaveDatasetSummary(ctx context.Context, modelID int, folderModifiedAt time.Time, summary interface{}) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode dataset summary: %w", err)
+	}
+	if _, err := Exec(ctx, `
+		INSERT INTO model_dataset_summaries (model_id, summary, folder_modified_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (model_id) DO UPDATE
+		SET summary = EXCLUDED.summary, folder_modified_at = EXCLUDED.folder_modified_at, inspected_at = CURRENT_TIMESTAMP
+	`, modelID, data, folderModifiedAt); err != nil {
+		return fmt.Errorf("failed to save dataset summary: %w", err)
+	}
+	return nil
+}
+
+// GetDatasetSummary returns the stored dataset summary of a model, as JSON text, or pgx.ErrNoRows
+func GetDatasetSummary(ctx context.Context, modelID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT model_id, summary::TEXT AS summary, folder_modified_at, inspected_at
+		FROM model_dataset_summaries
+		WHERE model_id = $1
+	`, modelID)
+}
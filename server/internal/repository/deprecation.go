@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DeprecateListing marks a listing deprecated, or updates its successor, sunset and message when it
+// already is. Listings past their end of life cannot be changed.
+func DeprecateListing(ctx context.Context, listingID int, successorID *int, sunsetAt time.Time, message string) error {
+	updated, err := Exec(ctx, `
+		UPDATE published_models
+		SET deprecated_at = COALESCE(deprecated_at, NOW()), successor_id = $2, sunset_at = $3,
+			deprecation_message = NULLIF($4, '')
+		WHERE id = $1 AND end_of_life_at IS NULL
+	`, listingID, successorID, sunsetAt, message)
+	if err != nil {
+		return fmt.Errorf("failed to deprecate listing: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("listing %d has reached its end of life", listingID)
+	}
+	return nil
+}
+
+// CancelListingDeprecation undoes the deprecation of a listing that has not reached its end of life.
+// It reports whether the listing was deprecated.
+func CancelListingDeprecation(ctx context.Context, listingID int) (bool, error) {
+	updated, err := Exec(ctx, `
+		UPDATE published_models
+		SET deprecated_at = NULL, successor_id = NULL, sunset_at = NULL, deprecation_message = NULL
+		WHERE id = $1 AND deprecated_at IS NOT NULL AND end_of_life_at IS NULL
+	`, listingID)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel listing deprecation: %w", err)
+	}
+	return updated > 0, nil
+}
+
+// GetListingsPastSunset returns the deprecated listings whose sunset has passed and that are not
+// unlisted yet, with their publisher's contact details
+func GetListingsPastSunset(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT pm.id, pm.name, pm.publisher_id, pm.successor_id, pm.sunset_at, u.email, u.username
+		FROM published_models pm
+		JOIN users u ON u.id = pm.publisher_id
+		WHERE pm.deprecated_at IS NOT NULL AND pm.end_of_life_at IS NULL AND pm.sunset_at <= NOW()
+	`)
+}
+
+// EndListingLife unlists a deprecated listing at its sunset. The listing and its files are kept.
+// It reports whether the listing was unlisted by this call.
+func EndListingLife(ctx context.Context, listingID int) (bool, error) {
+	updated, err := Exec(ctx, `
+		UPDATE published_models SET is_active = false, end_of_life_at = NOW()
+		WHERE id = $1 AND deprecated_at IS NOT NULL AND end_of_life_at IS NULL
+	`, listingID)
+	if err != nil {
+		return false, fmt.Errorf("failed to end life of listing %d: %w", listingID, err)
+	}
+	if updated > 0 {
+		log.Printf("🏁 Listing %d reached its end of life and was unlisted", listingID)
+	}
+	return updated > 0, nil
+}
+
+// GetListingPurchasers returns the users who bought or rented a listing, or a bundle containing it,
+// with their contact details
+func GetListingPurchasers(ctx context.Context, listingID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT u.id, u.email, u.username
+		FROM users u
+		WHERE u.id IN (
+			SELECT buyer_id FROM model_purchases
+			WHERE published_model_id = $1 AND payment_status = 'completed'
+			UNION
+			SELECT bp.buyer_id FROM bundle_purchases bp
+			JOIN marketplace_bundle_items bi ON bi.bundle_id = bp.bundle_id
+			WHERE bi.published_model_id = $1
+		)
+	`, listingID)
+}
+
+// HasDownloadedListing reports whether the user's downloads of a listing are in its ledger
+func HasDownloadedListing(ctx context.Context, userID, listingID int) (bool, error) {
+	rows, err := Query(ctx, `
+		SELECT 1 FROM model_download_ledger WHERE buyer_id = $1 AND published_model_id = $2 LIMIT 1
+	`, userID, listingID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check downloads: %w", err)
+	}
+	return len(rows) > 0, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"server/internal/models"
+)
+
+// RecordDownloadLedgerEntry appends a download to a listing's ledger.
+// The buyer's share_download_identity setting is snapshotted so later changes do not expose past downloads.
+func RecordDownloadLedgerEntry(ctx context.Context, publishedModelID, publisherID, buyerID int, buyerRef, version, country string, pricePaid int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		INSERT INTO model_download_ledger
+			(published_model_id, publisher_id, buyer_id, buyer_ref, identity_shared, version, country, price_paid)
+		VALUES ($1, $2, $3, $4,
+			COALESCE((SELECT share_download_identity FROM users WHERE id = $3), false),
+			NULLIF($5, ''), NULLIF($6, ''), $7)
+	`
+
+	if _, err := models.Pool.Exec(ctx, query, publishedModelID, publisherID, buyerID, buyerRef, version, country, pricePaid); err != nil {
+		return fmt.Errorf("failed to record download: %w", err)
+	}
+	return nil
+}
+
+// GetDownloadLedger returns a listing's downloads between two times, newest first.
+// The username is only returned for buyers who shared their identity.
+func GetDownloadLedger(ctx context.Context, publishedModelID int, from, to time.Time) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT l.id, l.buyer_ref,
+			CASE WHEN l.identity_shared THEN u.username END AS buyer_username,
+			l.version, l.country, l.price_paid, l.downloaded_at
+		FROM model_download_ledger l
+		LEFT JOIN users u ON l.buyer_id = u.id
+		WHERE l.published_model_id = $1 AND l.downloaded_at >= $2 AND l.downloaded_at < $3
+		ORDER BY l.downloaded_at DESC
+	`, publishedModelID, from, to)
+}
+
+// PruneDownloadLedger deletes ledger entries older than the retention period and returns how many were removed
+func PruneDownloadLedger(ctx context.Context, retention time.Duration) (int64, error) {
+	deleted, err := Exec(ctx, `DELETE FROM model_download_ledger WHERE downloaded_at < $1`, time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune download ledger: %w", err)
+	}
+	if deleted > 0 {
+		log.Printf("✅ Pruned %d download ledger entries", deleted)
+	}
+	return deleted, nil
+}
+
+// SetShareDownloadIdentity sets whether publishers see the user's username in their download ledgers
+func SetShareDownloadIdentity(ctx context.Context, userID int, share bool) error {
+	if _, err := Exec(ctx, `UPDATE users SET share_download_identity = $2 WHERE id = $1`, userID, share); err != nil {
+		return fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+	return nil
+}
+
+// GetShareDownloadIdentity reports whether the user shares their username with publishers
+func GetShareDownloadIdentity(ctx context.Context, userID int) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var share bool
+	if err := models.Pool.QueryRow(ctx, `SELECT share_download_identity FROM users WHERE id = $1`, userID).Scan(&share); err != nil {
+		return false, fmt.Errorf("failed to get privacy settings: %w", err)
+	}
+	return share, nil
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// Reasons a listing is flagged as a likely duplicate
+const (
+	DuplicateReasonChecksum    = "checksum"
+	DuplicateReasonDescription = "description"
+)
+
+// Statuses of a duplicate flag
+const (
+	DuplicatePending   = "pending"
+	DuplicateConfirmed = "confirmed"
+	DuplicateDismissed = "dismissed"
+)
+
+// SetListingFingerprints stores a listing's artifact checksum and description MinHash signature.
+// An empty checksum or nil signature leaves the stored value unchanged.
+func SetListingFingerprints(ctx context.Context, listingID int, artifactSHA256 string, minhash []int64) error {
+	if _, err := Exec(ctx, `
+		UPDATE published_models
+		SET artifact_sha256 = COALESCE(NULLIF($2, ''), artifact_sha256),
+			description_minhash = COALESCE($3, description_minhash)
+		WHERE id = $1
+	`, listingID, artifactSHA256, minhash); err != nil {
+		return fmt.Errorf("failed to store listing fingerprints: %w", err)
+	}
+	return nil
+}
+
+// GetListingsByArtifactChecksum returns the other public listings published with the same model file, oldest first
+func GetListingsByArtifactChecksum(ctx context.Context, listingID int, artifactSHA256 string) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, name, publisher_id, published_at
+		FROM published_models
+		WHERE artifact_sha256 = $2 AND id <> $1 AND visibility = 'public'
+		ORDER BY published_at
+	`, listingID, artifactSHA256)
+}
+
+// GetDescriptionSignatures returns the MinHash signature of every other public listing's description
+func GetDescriptionSignatures(ctx context.Context, listingID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, name, publisher_id, published_at, description_minhash
+		FROM published_models
+		WHERE description_minhash IS NOT NULL AND id <> $1 AND visibility = 'public'
+	`, listingID)
+}
+
+// GetListingsWithoutFingerprints returns the listings published before fingerprints were recorded
+func GetListingsWithoutFingerprints(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, listing_type, trained_model_path, description
+		FROM published_models
+		WHERE description_minhash IS NULL
+		ORDER BY id
+	`)
+}
+
+// FlagDuplicateListing records that a listing is likely a duplicate of an older one. It reports
+// whether the flag is new; a pair that was already flagged is left as it is.
+func FlagDuplicateListing(ctx context.Context, listingID, originalID int, reason string, similarity float64) (bool, error) {
+	created, err := Exec(ctx, `
+		INSERT INTO listing_duplicate_flags (published_model_id, original_id, reason, similarity)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (published_model_id, original_id) DO NOTHING
+	`, listingID, originalID, reason, similarity)
+	if err != nil {
+		return false, fmt.Errorf("failed to flag duplicate listing: %w", err)
+	}
+	return created > 0, nil
+}
+
+// GetDuplicateFlags returns a page of duplicate flags for admin review, oldest first, and the total count.
+// An empty status returns every flag.
+func GetDuplicateFlags(ctx context.Context, status string, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM listing_duplicate_flags WHERE $1 = '' OR status = $1
+	`, status).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count duplicate flags: %w", err)
+	}
+
+	flags, err := Query(ctx, `
+		SELECT f.id, f.published_model_id, pm.name AS listing_name, pm.publisher_id,
+			u.username AS publisher_username, f.original_id, o.name AS original_name,
+			o.publisher_id AS original_publisher_id, ou.username AS original_publisher_username,
+			f.reason, f.similarity, f.status, f.admin_id, f.created_at, f.resolved_at
+		FROM listing_duplicate_flags f
+		JOIN published_models pm ON pm.id = f.published_model_id
+		JOIN published_models o ON o.id = f.original_id
+		LEFT JOIN users u ON u.id = pm.publisher_id
+		LEFT JOIN users ou ON ou.id = o.publisher_id
+		WHERE $1 = '' OR f.status = $1
+		ORDER BY f.created_at ASC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return flags, total, nil
+}
+
+// ResolveDuplicateFlag closes a pending duplicate flag. Confirming it links the listing to the
+// original. Returns the flag with the publisher's contact details, or pgx.ErrNoRows when there is
+// no pending flag with this ID.
+func ResolveDuplicateFlag(ctx context.Context, flagID, adminID int, status string) (map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var listingID, originalID int
+	err = tx.QueryRow(ctx, `
+		UPDATE listing_duplicate_flags
+		SET status = $2, admin_id = $3, resolved_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING published_model_id, original_id
+	`, flagID, status, adminID).Scan(&listingID, &originalID)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == DuplicateConfirmed {
+		if _, err := tx.Exec(ctx, `
+			UPDATE published_models SET duplicate_of = $2, updated_at = NOW() WHERE id = $1
+		`, listingID, originalID); err != nil {
+			return nil, fmt.Errorf("failed to link duplicate listing: %w", err)
+		}
+	}
+
+	var name, originalName, email, username string
+	var publisherID int
+	if err := tx.QueryRow(ctx, `
+		SELECT pm.name, o.name, pm.publisher_id, u.email, u.username
+		FROM published_models pm
+		JOIN published_models o ON o.id = $2
+		JOIN users u ON u.id = pm.publisher_id
+		WHERE pm.id = $1
+	`, listingID, originalID).Scan(&name, &originalName, &publisherID, &email, &username); err != nil {
+		return nil, fmt.Errorf("failed to get listing: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return map[string]interface{}{
+		"id":                 flagID,
+		"published_model_id": listingID,
+		"listing_name":       name,
+		"original_id":        originalID,
+		"original_name":      originalName,
+		"publisher_id":       publisherID,
+		"publisher_email":    email,
+		"publisher_username": username,
+		"status":             status,
+	}, nil
+}
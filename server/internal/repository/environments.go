@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"server/internal/models"
+)
+
+// SaveTrainingEnvironment stores the environment captured for a training run.
+// The model and user are taken from the run recorded when the training started.
+func SaveTrainingEnvironment(ctx context.Context, trainingID, source, pythonVersion, cudaVersion, platform string, packages []string) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		INSERT INTO training_environments (training_id, model_id, user_id, source, python_version, cuda_version, platform, packages)
+		VALUES (
+			$1,
+			(SELECT model_id FROM model_training_runs WHERE training_id = $1 ORDER BY created_at DESC LIMIT 1),
+			(SELECT user_id FROM model_training_runs WHERE training_id = $1 ORDER BY created_at DESC LIMIT 1),
+			$2, $3, NULLIF($4, ''), $5, $6
+		)
+		ON CONFLICT (training_id) DO UPDATE
+		SET source = EXCLUDED.source,
+			python_version = EXCLUDED.python_version,
+			cuda_version = EXCLUDED.cuda_version,
+			platform = EXCLUDED.platform,
+			packages = EXCLUDED.packages,
+			captured_at = CURRENT_TIMESTAMP
+	`
+
+	if _, err := models.Pool.Exec(ctx, query, trainingID, source, pythonVersion, cudaVersion, platform, packages); err != nil {
+		return fmt.Errorf("failed to save training environment: %w", err)
+	}
+
+	log.Printf("✅ Saved environment for training %s (%d packages)", trainingID, len(packages))
+	return nil
+}
+
+// GetTrainingEnvironment returns the environment captured for a training run
+func GetTrainingEnvironment(ctx context.Context, trainingID string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT training_id, model_id, user_id, source, python_version, cuda_version, platform, packages, captured_at
+		FROM training_environments
+		WHERE training_id = $1
+	`, trainingID)
+}
+
+// GetLatestModelEnvironment returns the environment of a model's most recent successful training
+func GetLatestModelEnvironment(ctx context.Context, modelID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT training_id, model_id, user_id, source, python_version, cuda_version, platform, packages, captured_at
+		FROM training_environments
+		WHERE model_id = $1
+		ORDER BY captured_at DESC
+		LIMIT 1
+	`, modelID)
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// Events of the follow feed
+const (
+	FeedEventPublished  = "published"
+	FeedEventNewVersion = "new_version"
+)
+
+// FollowPublisher makes a user follow a publisher. Following twice is a no-op.
+func FollowPublisher(ctx context.Context, followerID, publisherID int) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO user_follows (follower_id, publisher_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, followerID, publisherID); err != nil {
+		return fmt.Errorf("failed to follow publisher: %w", err)
+	}
+	return nil
+}
+
+// UnfollowPublisher stops a user following a publisher and reports whether they did
+func UnfollowPublisher(ctx context.Context, followerID, publisherID int) (bool, error) {
+	n, err := Exec(ctx, `DELETE FROM user_follows WHERE follower_id = $1 AND publisher_id = $2`, followerID, publisherID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unfollow publisher: %w", err)
+	}
+	return n > 0, nil
+}
+
+// IsFollowing reports whether a user follows a publisher
+func IsFollowing(ctx context.Context, followerID, publisherID int) (bool, error) {
+	rows, err := Query(ctx, `SELECT 1 FROM user_follows WHERE follower_id = $1 AND publisher_id = $2`, followerID, publisherID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check follow: %w", err)
+	}
+	return len(rows) > 0, nil
+}
+
+// CountFollowers returns how many users follow a publisher
+func CountFollowers(ctx context.Context, publisherID int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var count int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM user_follows WHERE publisher_id = $1`, publisherID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count followers: %w", err)
+	}
+	return count, nil
+}
+
+// GetFollowedPublishers returns a page of the publishers a user follows, most recently followed
+// first, with the total number of them
+func GetFollowedPublishers(ctx context.Context, followerID, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM user_follows WHERE follower_id = $1`, followerID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count followed publishers: %w", err)
+	}
+
+	publishers, err := Query(ctx, `
+		SELECT u.id, u.username, COALESCE(u.avatar_path, '') AS avatar_path, f.created_at AS followed_at
+		FROM user_follows f
+		JOIN users u ON u.id = f.publisher_id
+		WHERE f.follower_id = $1
+		ORDER BY f.created_at DESC
+		LIMIT $2 OFFSET $3
+	`, followerID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return publishers, total, nil
+}
+
+// GetFollowers returns the users following a publisher who can see a listing, to notify them
+// of its release
+func GetFollowers(ctx context.Context, publisherID, listingID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT u.id, u.username
+		FROM user_follows f
+		JOIN users u ON u.id = f.follower_id
+		JOIN published_models pm ON pm.id = $2
+		WHERE f.publisher_id = $1 AND `+listingVisibleTo("f.follower_id"), publisherID, listingID)
+}
+
+// GetFollowFeed returns a page of the releases of the publishers a user follows, newest first,
+// with the total number of them. Each event is a listing being published or shipping a new version.
+func GetFollowFeed(ctx context.Context, userID, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	events := `
+		SELECT '` + FeedEventPublished + `' AS event, pm.published_at AS event_at, pm.id AS listing_id
+		FROM published_models pm
+		JOIN user_follows f ON f.publisher_id = pm.publisher_id AND f.follower_id = $1
+		WHERE pm.is_active = true AND ` + listingVisibleTo("$1") + `
+		UNION ALL
+		SELECT '` + FeedEventNewVersion + `', pm.version_published_at, pm.id
+		FROM published_models pm
+		JOIN user_follows f ON f.publisher_id = pm.publisher_id AND f.follower_id = $1
+		WHERE pm.is_active = true AND pm.version > 1 AND ` + listingVisibleTo("$1")
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM (`+events+`) events`, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count feed events: %w", err)
+	}
+
+	feed, err := Query(ctx, `
+		SELECT e.event, e.event_at, pm.id, pm.name, pm.picture, pm.short_description, pm.price,
+			pm.category, pm.listing_type, pm.version, pm.rating_average, pm.downloads_count,
+			pm.publisher_id, u.username AS publisher_username
+		FROM (`+events+`) e
+		JOIN published_models pm ON pm.id = e.listing_id
+		LEFT JOIN users u ON u.id = pm.publisher_id
+		ORDER BY e.event_at DESC, pm.id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get feed: %w", err)
+	}
+	return feed, total, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// RecordInterruptedTraining stores a server training stopped by a shutdown so it can be resumed.
+// The model is taken from the training's recorded run.
+func RecordInterruptedTraining(ctx context.Context, trainingID string, userID int, request []byte, checkpointPath string, runSeconds int) error {
+	_, err := Exec(ctx, `
+		INSERT INTO interrupted_trainings (training_id, user_id, model_id, request, checkpoint_path, run_seconds)
+		VALUES ($1, $2, (SELECT model_id FROM model_training_runs WHERE training_id = $1 LIMIT 1), $3, NULLIF($4, ''), $5)
+		ON CONFLICT (training_id) DO UPDATE SET
+			request = EXCLUDED.request, checkpoint_path = EXCLUDED.checkpoint_path,
+			run_seconds = EXCLUDED.run_seconds, interrupted_at = CURRENT_TIMESTAMP
+	`, trainingID, userID, request, checkpointPath, runSeconds)
+	if err != nil {
+		return fmt.Errorf("failed to record interrupted training: %w", err)
+	}
+	log.Printf("✅ Recorded interrupted training %s", trainingID)
+	return nil
+}
+
+// GetInterruptedTrainings lists a user's interrupted trainings that were not resumed, newest first
+func GetInterruptedTrainings(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT i.training_id, i.model_id, m.name AS model_name, i.checkpoint_path, i.run_seconds, i.interrupted_at
+		FROM interrupted_trainings i
+		LEFT JOIN models m ON m.id = i.model_id
+		WHERE i.user_id = $1 AND i.resumed_at IS NULL
+		ORDER BY i.interrupted_at DESC
+	`, userID)
+}
+
+// ClaimInterruptedTraining marks one of a user's interrupted trainings resumed and returns it, so
+// that it is only resumed once. It returns pgx.ErrNoRows when there is none to resume.
+func ClaimInterruptedTraining(ctx context.Context, trainingID string, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		UPDATE interrupted_trainings SET resumed_at = CURRENT_TIMESTAMP
+		WHERE training_id = $1 AND user_id = $2 AND resumed_at IS NULL
+		RETURNING training_id, model_id, request, checkpoint_path, run_seconds
+	`, trainingID, userID)
+}
+
+// ReleaseInterruptedTraining makes a claimed interrupted training resumable again, after resuming it failed
+func ReleaseInterruptedTraining(ctx context.Context, trainingID string) error {
+	if _, err := Exec(ctx, `
+		UPDATE interrupted_trainings SET resumed_at = NULL WHERE training_id = $1 AND resumed_training_id IS NULL
+	`, trainingID); err != nil {
+		return fmt.Errorf("failed to release interrupted training: %w", err)
+	}
+	return nil
+}
+
+// SetInterruptedTrainingResumedAs records the training a claimed interrupted training was resumed as
+func SetInterruptedTrainingResumedAs(ctx context.Context, trainingID, resumedTrainingID string) error {
+	if _, err := Exec(ctx, `
+		UPDATE interrupted_trainings SET resumed_training_id = $2 WHERE training_id = $1
+	`, trainingID, resumedTrainingID); err != nil {
+		return fmt.Errorf("failed to record resumed training: %w", err)
+	}
+	return nil
+}
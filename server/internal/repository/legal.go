@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// Kinds of legal documents users must accept
+const (
+	LegalTerms   = "terms"
+	LegalPrivacy = "privacy"
+)
+
+// ErrLegalVersionExists is returned when a document version was already published
+var ErrLegalVersionExists = errors.New("this version was already published")
+
+// PublishLegalDocument publishes a new version of the terms or privacy policy. It becomes the
+// current version, so every user has to accept it again.
+func PublishLegalDocument(ctx context.Context, kind, version, content string, publishedBy int) (map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	var id int
+	var publishedAt time.Time
+	err := models.Pool.QueryRow(ctx, `
+		INSERT INTO legal_documents (kind, version, content, published_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, published_at
+	`, kind, version, content, publishedBy).Scan(&id, &publishedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrLegalVersionExists
+		}
+		return nil, fmt.Errorf("failed to publish legal document: %w", err)
+	}
+	return map[string]interface{}{
+		"id":           id,
+		"kind":         kind,
+		"version":      version,
+		"published_at": publishedAt,
+	}, nil
+}
+
+// GetCurrentLegalDocuments returns the current version of each kind of document, without content
+func GetCurrentLegalDocuments(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT DISTINCT ON (kind) id, kind, version, published_at
+		FROM legal_documents
+		ORDER BY kind, published_at DESC, id DESC
+	`)
+}
+
+// GetLegalDocument returns a version of a document with its content, the current one when
+// version is empty, or pgx.ErrNoRows
+func GetLegalDocument(ctx context.Context, kind, version string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, kind, version, content, published_at
+		FROM legal_documents
+		WHERE kind = $1 AND ($2 = '' OR version = $2)
+		ORDER BY published_at DESC, id DESC
+		LIMIT 1
+	`, kind, version)
+}
+
+// GetLegalAcceptances returns every document version a user accepted, newest first
+func GetLegalAcceptances(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT d.id AS document_id, d.kind, d.version, a.accepted_at
+		FROM legal_acceptances a
+		JOIN legal_documents d ON d.id = a.document_id
+		WHERE a.user_id = $1
+		ORDER BY a.accepted_at DESC, d.kind
+	`, userID)
+}
+
+// AcceptLegalDocuments records that a user accepted document versions. Accepting a version twice keeps the first time.
+func AcceptLegalDocuments(ctx context.Context, userID int, documentIDs []int) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO legal_acceptances (user_id, document_id)
+		SELECT $1, unnest($2::INT[])
+		ON CONFLICT (user_id, document_id) DO NOTHING
+	`, userID, documentIDs); err != nil {
+		return fmt.Errorf("failed to record acceptance: %w", err)
+	}
+	return nil
+}
+
+// GetAcceptedLegalDocumentIDs returns which of the given documents a user accepted
+func GetAcceptedLegalDocumentIDs(ctx context.Context, userID int, documentIDs []int) (map[int]bool, error) {
+	rows, err := Query(ctx, `
+		SELECT document_id FROM legal_acceptances WHERE user_id = $1 AND document_id = ANY($2)
+	`, userID, documentIDs)
+	if err != nil {
+		return nil, err
+	}
+	accepted := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		if id, ok := row["document_id"].(int32); ok {
+			accepted[int(id)] = true
+		}
+	}
+	return accepted, nil
+}
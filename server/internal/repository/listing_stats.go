@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AggregateListingDailyStats recomputes listing_daily_stats for the days [from, to) from
+// model_views, model_download_ledger, model_likes and completed model_purchases, and returns how
+// many rows were written. Recomputing a day is idempotent, and days whose events all went away
+// (an unlike, a refund) are removed. publisherID limits it to one publisher's listings when it is
+// not 0.
+func AggregateListingDailyStats(ctx context.Context, publisherID int, from, to time.Time) (int64, error) {
+	written, err := Exec(ctx, `
+		WITH events AS (
+			SELECT v.model_id AS listing_id, v.viewed_at::date AS day,
+				1 AS views, 0 AS downloads, 0 AS likes, 0 AS purchases, 0 AS revenue
+			FROM model_views v
+			WHERE v.viewed_at >= $2::date AND v.viewed_at < $3::date
+			UNION ALL
+			SELECT l.published_model_id, l.downloaded_at::date, 0, 1, 0, 0, 0
+			FROM model_download_ledger l
+			WHERE l.downloaded_at >= $2::date AND l.downloaded_at < $3::date
+			UNION ALL
+			SELECT k.published_model_id, k.created_at::date, 0, 0, 1, 0, 0
+			FROM model_likes k
+			WHERE k.created_at >= $2::date AND k.created_at < $3::date
+			UNION ALL
+			SELECT p.published_model_id, p.purchased_at::date, 0, 0, 0, 1, p.price_paid
+			FROM model_purchases p
+			WHERE p.payment_status = 'completed'
+			  AND p.purchased_at >= $2::date AND p.purchased_at < $3::date
+		),
+		stats AS (
+			SELECT e.listing_id, pm.publisher_id, e.day,
+				SUM(e.views)::int AS views, SUM(e.downloads)::int AS downloads, SUM(e.likes)::int AS likes,
+				SUM(e.purchases)::int AS purchases, SUM(e.revenue)::int AS revenue
+			FROM events e
+			JOIN published_models pm ON pm.id = e.listing_id
+			WHERE pm.publisher_id IS NOT NULL AND ($1 = 0 OR pm.publisher_id = $1)
+			GROUP BY e.listing_id, pm.publisher_id, e.day
+		),
+		stale AS (
+			DELETE FROM listing_daily_stats d
+			WHERE d.day >= $2::date AND d.day < $3::date AND ($1 = 0 OR d.publisher_id = $1)
+			  AND NOT EXISTS (SELECT 1 FROM stats s WHERE s.listing_id = d.published_model_id AND s.day = d.day)
+		)
+		INSERT INTO listing_daily_stats (published_model_id, publisher_id, day, views, downloads, likes, purchases, revenue)
+		SELECT listing_id, publisher_id, day, views, downloads, likes, purchases, revenue FROM stats
+		ON CONFLICT (published_model_id, day) DO UPDATE
+		SET publisher_id = EXCLUDED.publisher_id,
+			views = EXCLUDED.views,
+			downloads = EXCLUDED.downloads,
+			likes = EXCLUDED.likes,
+			purchases = EXCLUDED.purchases,
+			revenue = EXCLUDED.revenue
+	`, publisherID, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to aggregate listing stats: %w", err)
+	}
+	return written, nil
+}
+
+// GetPublisherDailyStats returns the daily stats of a publisher's listings for the days
+// [from, to), by listing and day. Days without activity have no row. listingID limits the stats
+// to one listing when it is not 0.
+func GetPublisherDailyStats(ctx context.Context, publisherID, listingID int, from, to time.Time) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT published_model_id, day, views, downloads, likes, purchases, revenue
+		FROM listing_daily_stats
+		WHERE publisher_id = $1 AND ($2 = 0 OR published_model_id = $2)
+		  AND day >= $3::date AND day < $4::date
+		ORDER BY published_model_id, day
+	`, publisherID, listingID, from, to)
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"testing"
+
+	"server/internal/testutil/pgtest"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"server/internal/metricparse"
+)
+
+// SetModelMetricPatterns replaces the custom metric patterns of a model
+func SetModelMetricPatterns(ctx context.Context, modelID int, patterns []metricparse.Pattern) error {
+	if patterns == nil {
+		patterns = []metricparse.Pattern{}
+	}
+	raw, err := json.Marshal(patterns)
+	if err != nil {
+		return fmt.Errorf("failed to encode metric patterns: %w", err)
+	}
+	if _, err := Exec(ctx, `UPDATE models SET metric_patterns = $2 WHERE id = $1`, modelID, raw); err != nil {
+		return fmt.Errorf("failed to set metric patterns: %w", err)
+	}
+	return nil
+}
+
+// GetModelMetricPatterns returns the custom metric patterns of a model, in the order they are tried
+func GetModelMetricPatterns(ctx context.Context, modelID int) ([]metricparse.Pattern, error) {
+	row, err := QueryRow(ctx, `SELECT metric_patterns::text AS metric_patterns FROM models WHERE id = $1`, modelID)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []metricparse.Pattern
+	raw, _ := row["metric_patterns"].(string)
+	if err := json.Unmarshal([]byte(raw), &patterns); err != nil {
+		return nil, fmt.Errorf("failed to decode metric patterns: %w", err)
+	}
+	return patterns, nil
+}
@@ -13,20 +13,22 @@ import (
 	"server/internal/models"
 )
 
-// GetModelsByUserID retrieves all models for a specific user
-func GetModelsByUserID(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+// GetModelsByUserID retrieves all models for a specific user. A non-empty tag only returns the models tagged with it.
+func GetModelsByUserID(ctx context.Context, userID int, tag string) ([]map[string]interface{}, error) {
 	if models.Pool == nil {
 		return nil, fmt.Errorf("database connection not initialized")
 	}
 
 	query := `
-		SELECT id, user_id, name, picture, folder, training_script, trained_model_path, trained_at, accuracy_score, created_at, updated_at
+		SELECT id, user_id, name, picture, folder, training_script, trained_model_path, trained_at, accuracy_score, tags, notes,
+			primary_metric, primary_metric_direction, primary_metric_value, scan_status, scan_engine, scanned_at,
+			created_at, updated_at
 		FROM models
-		WHERE user_id = $1
+		WHERE user_id = $1 AND ($2 = '' OR LOWER($2) = ANY(tags))
 		ORDER BY created_at DESC
 	`
 
-	rows, err := models.Pool.Query(ctx, query, userID)
+	rows, err := models.Pool.Query(ctx, query, userID, tag)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -179,6 +181,61 @@ func InsertModel(ctx context.Context, userID int, name, picture string, folder [
 	return id, nil
 }
 
+// InsertModelWithFiles inserts a model like InsertModel, calling commitFiles inside the
+// transaction to move its staged files into place. If commitFiles fails the insert is rolled
+// back; if the commit fails after the files moved, the caller must move them back.
+func InsertModelWithFiles(ctx context.Context, userID int, name, picture string, folder []string, trainingScript string, commitFiles func() error) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+	if trainingScript == "" {
+		trainingScript = "train.py"
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO models (user_id, name, picture, folder, training_script)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, userID, name, picture, folder, trainingScript).Scan(&id); err != nil {
+		return 0, fmt.Errorf("insert failed: %w", err)
+	}
+	if err := commitFiles(); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Inserted model with ID: %d (training_script: %s)", id, trainingScript)
+	return id, nil
+}
+
+// ModelFilesInUse reports whether a model stores its folder or picture in the uploads directory dir
+func ModelFilesInUse(ctx context.Context, dir string) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var inUse bool
+	err := models.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM models
+			WHERE $1 = ANY(folder) OR starts_with(picture, '/' || ltrim($1, './') || '/')
+		)
+	`, dir).Scan(&inUse)
+	if err != nil {
+		return false, fmt.Errorf("failed to check model files: %w", err)
+	}
+	return inUse, nil
+}
+
 // Query executes a generic SELECT query and returns results as maps
 func Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
 	if models.Pool == nil {
@@ -263,10 +320,10 @@ func GetUserByEmail(ctx context.Context, email string) (*map[string]interface{},
 		return nil, fmt.Errorf("database connection not initialized")
 	}
 
-	query := `SELECT id, email, password, username, api_key, created_at, updated_at,
+	query := `SELECT id, email, password, username, COALESCE(api_key_prefix, LEFT(api_key, 12)) AS api_key_prefix, created_at, updated_at,
 		subscription_tier, subscription_status, training_credits,
 		stripe_customer_id, stripe_subscription_id, subscription_start_date, subscription_end_date,
-		email_verified, verification_token, verification_token_expires_at
+		next_credit_reset_at, email_verified, verification_token, verification_token_expires_at
 		FROM users WHERE email = $1`
 
 	rows, err := models.Pool.Query(ctx, query, email)
@@ -528,7 +585,9 @@ func GetModelByID(ctx context.Context, modelID int) (*map[string]interface{}, er
 	}
 
 	query := `
-		SELECT id, user_id, name, picture, folder, training_script, trained_model_path, trained_at, accuracy_score, created_at, updated_at
+		SELECT id, user_id, name, picture, folder, training_script, trained_model_path, trained_at, accuracy_score, tags, notes,
+			primary_metric, primary_metric_direction, primary_metric_value, scan_status, scan_engine, scanned_at,
+			created_at, updated_at
 		FROM models
 		WHERE id = $1
 		LIMIT 1
@@ -567,9 +626,12 @@ func InsertPublishedModel(ctx context.Context, req map[string]interface{}) (int,
 	query := `
 		INSERT INTO published_models (
 			model_id, publisher_id, name, picture, trained_model_path, training_script,
-			description, price, license_type, category, tags, model_type, framework, accuracy_score
+			description, price, license_type, category, tags, model_type, framework, accuracy_score,
+			listing_type, template_path, rental_price, rental_days, visibility, organization_id,
+			primary_metric, primary_metric_direction, primary_metric_value
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, COALESCE($15, 'model'), $16, $17, COALESCE($18, 30), COALESCE($19, 'public'), $20,
+			COALESCE($21, 'accuracy'), COALESCE($22, 'higher'), $23)
 		RETURNING id
 	`
 
@@ -589,6 +651,15 @@ func InsertPublishedModel(ctx context.Context, req map[string]interface{}) (int,
 		req["model_type"],
 		req["framework"],
 		req["accuracy_score"],
+		req["listing_type"],
+		req["template_path"],
+		req["rental_price"],
+		req["rental_days"],
+		req["visibility"],
+		req["organization_id"],
+		req["primary_metric"],
+		req["primary_metric_direction"],
+		req["primary_metric_value"],
 	).Scan(&id)
 
 	if err != nil {
@@ -599,8 +670,9 @@ func InsertPublishedModel(ctx context.Context, req map[string]interface{}) (int,
 	return id, nil
 }
 
-// GetPublishedModels retrieves all active published models for community marketplace
-func GetPublishedModels(ctx context.Context) ([]map[string]interface{}, error) {
+// GetPublishedModels retrieves all active published models for community marketplace that the
+// viewer can see (see listingVisibleTo), most trending first. An empty listingType returns every listing type.
+func GetPublishedModels(ctx context.Context, listingType string, viewerID int) ([]map[string]interface{}, error) {
 	if models.Pool == nil {
 		return nil, fmt.Errorf("database connection not initialized")
 	}
@@ -609,16 +681,19 @@ func GetPublishedModels(ctx context.Context) ([]map[string]interface{}, error) {
 		SELECT
 			pm.id, pm.model_id, pm.publisher_id, pm.name, pm.picture, pm.trained_model_path, pm.training_script,
 			pm.description, pm.short_description, pm.price, pm.category, pm.tags, pm.model_type, pm.framework,
-			pm.file_size, pm.accuracy_score, pm.license_type, pm.downloads_count, pm.views_count,
+			pm.file_size, pm.accuracy_score, pm.primary_metric, pm.primary_metric_direction, pm.primary_metric_value,
+			pm.license_type, pm.downloads_count, pm.views_count,
 			pm.rating_average, pm.rating_count, pm.is_active, pm.is_featured, pm.published_at, pm.updated_at,
-			u.username as publisher_username
+			pm.listing_type, pm.template_path, pm.installs_count, pm.version, pm.rental_price, pm.rental_days,
+			pm.visibility, pm.organization_id, pm.deprecated_at, pm.successor_id, pm.sunset_at,
+			pm.trending_score, u.username as publisher_username
 		FROM published_models pm
 		LEFT JOIN users u ON pm.publisher_id = u.id
-		WHERE pm.is_active = true
-		ORDER BY pm.published_at DESC
+		WHERE pm.is_active = true AND ($1 = '' OR pm.listing_type = $1) AND ` + listingVisibleTo("$2") + `
+		ORDER BY pm.trending_score DESC, pm.published_at DESC
 	`
 
-	rows, err := models.Pool.Query(ctx, query)
+	rows, err := models.Pool.Query(ctx, query, listingType, viewerID)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -665,8 +740,12 @@ func GetPublishedModelByID(ctx context.Context, modelID int) (map[string]interfa
 		SELECT
 			pm.id, pm.model_id, pm.publisher_id, pm.name, pm.picture, pm.trained_model_path, pm.training_script,
 			pm.description, pm.short_description, pm.price, pm.category, pm.tags, pm.model_type, pm.framework,
-			pm.file_size, pm.accuracy_score, pm.license_type, pm.downloads_count, pm.views_count,
+			pm.file_size, pm.accuracy_score, pm.primary_metric, pm.primary_metric_direction, pm.primary_metric_value,
+			pm.license_type, pm.downloads_count, pm.views_count,
 			pm.rating_average, pm.rating_count, pm.is_active, pm.is_featured, pm.published_at, pm.updated_at,
+			pm.listing_type, pm.template_path, pm.installs_count, pm.version, pm.rental_price, pm.rental_days,
+			pm.moderation_status, pm.removal_reason, pm.removed_at, pm.duplicate_of, pm.visibility, pm.organization_id,
+			pm.deprecated_at, pm.deprecation_message, pm.successor_id, pm.sunset_at, pm.end_of_life_at,
 			u.username as publisher_username
 		FROM published_models pm
 		LEFT JOIN users u ON pm.publisher_id = u.id
@@ -707,9 +786,11 @@ func GetPublishedModelByID(ctx context.Context, modelID int) (map[string]interfa
 	return row, nil
 }
 
-// IncrementModelViews increments the view count for a published model (one view per user)
-// userID can be nil for anonymous users, ipAddress is used as fallback
-func IncrementModelViews(ctx context.Context, modelID int, userID *int, ipAddress string) error {
+// IncrementModelViews increments the view count for a published model (one view per person)
+// userID can be nil for anonymous users, who are tracked by their anonymousID cookie or,
+// without one, by ipAddress. A logged-in user who viewed the model anonymously from the same
+// browser takes over that view instead of counting again. country is the viewer's ISO code, "" when unknown.
+func IncrementModelViews(ctx context.Context, modelID int, userID *int, anonymousID string, ipAddress string, country string) error {
 	if models.Pool == nil {
 		return fmt.Errorf("database connection not initialized")
 	}
@@ -721,6 +802,24 @@ func IncrementModelViews(ctx context.Context, modelID int, userID *int, ipAddres
 	}
 	defer tx.Rollback(ctx)
 
+	if userID != nil && anonymousID != "" {
+		// Claim the anonymous view of this browser, unless the user already has a view of their own
+		claimQuery := `
+			UPDATE model_views
+			SET user_id = $2
+			WHERE model_id = $1 AND anonymous_id = $3 AND user_id IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM model_views WHERE model_id = $1 AND user_id = $2)
+		`
+		result, err := tx.Exec(ctx, claimQuery, modelID, *userID, anonymousID)
+		if err != nil {
+			return fmt.Errorf("failed to link anonymous view: %w", err)
+		}
+		if result.RowsAffected() > 0 {
+			log.Printf("Linked anonymous view of model ID: %d to user %d (skipping increment)", modelID, *userID)
+			return tx.Commit(ctx)
+		}
+	}
+
 	// Try to insert a new view record
 	// If it already exists (user already viewed), it will fail silently
 	var insertQuery string
@@ -729,19 +828,29 @@ func IncrementModelViews(ctx context.Context, modelID int, userID *int, ipAddres
 	if userID != nil {
 		// Authenticated user - track by user_id
 		insertQuery = `
-			INSERT INTO model_views (model_id, user_id, ip_address)
-			VALUES ($1, $2, $3)
-			ON CONFLICT (model_id, user_id) DO NOTHING
+			INSERT INTO model_views (model_id, user_id, ip_address, country)
+			VALUES ($1, $2, $3, NULLIF($4, ''))
+			ON CONFLICT (model_id, user_id) WHERE user_id IS NOT NULL DO NOTHING
 		`
-		args = []interface{}{modelID, *userID, ipAddress}
+		args = []interface{}{modelID, *userID, ipAddress, country}
+	} else if anonymousID != "" {
+		// Anonymous user - track by session cookie. The cookie may already belong to a view
+		// that was linked to an account, so the person logged out after viewing.
+		insertQuery = `
+			INSERT INTO model_views (model_id, user_id, ip_address, anonymous_id, country)
+			SELECT $1, NULL, $2, $3, NULLIF($4, '')
+			WHERE NOT EXISTS (SELECT 1 FROM model_views WHERE model_id = $1 AND anonymous_id = $3)
+			ON CONFLICT DO NOTHING
+		`
+		args = []interface{}{modelID, ipAddress, anonymousID, country}
 	} else {
-		// Anonymous user - track by IP address
+		// Anonymous user without a cookie - track by IP address
 		insertQuery = `
-			INSERT INTO model_views (model_id, user_id, ip_address)
-			VALUES ($1, NULL, $2)
-			ON CONFLICT (model_id, ip_address) WHERE user_id IS NULL DO NOTHING
+			INSERT INTO model_views (model_id, user_id, ip_address, country)
+			VALUES ($1, NULL, $2, NULLIF($3, ''))
+			ON CONFLICT (model_id, ip_address) WHERE user_id IS NULL AND anonymous_id IS NULL DO NOTHING
 		`
-		args = []interface{}{modelID, ipAddress}
+		args = []interface{}{modelID, ipAddress, country}
 	}
 
 	result, err := tx.Exec(ctx, insertQuery, args...)
@@ -778,6 +887,72 @@ func IncrementModelViews(ctx context.Context, modelID int, userID *int, ipAddres
 	return nil
 }
 
+// MergeAnonymousViews links the views recorded under an anonymous session cookie to the user
+// who just logged in. Anonymous views of models the user had already viewed were counted twice,
+// so they are removed and the view counts corrected. Returns the number of views linked.
+func MergeAnonymousViews(ctx context.Context, anonymousID string, userID int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		DELETE FROM model_views a
+		WHERE a.anonymous_id = $1 AND a.user_id IS NULL
+		  AND EXISTS (SELECT 1 FROM model_views u WHERE u.model_id = a.model_id AND u.user_id = $2)
+		RETURNING a.model_id
+	`, anonymousID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove duplicate views: %w", err)
+	}
+	var duplicated []int32
+	for rows.Next() {
+		var modelID int32
+		if err := rows.Scan(&modelID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan duplicate view: %w", err)
+		}
+		duplicated = append(duplicated, modelID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to remove duplicate views: %w", err)
+	}
+
+	if len(duplicated) > 0 {
+		if _, err := tx.Exec(ctx, `
+			UPDATE published_models
+			SET views_count = GREATEST(views_count - 1, 0)
+			WHERE id = ANY($1)
+		`, duplicated); err != nil {
+			return 0, fmt.Errorf("failed to correct view counts: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE model_views
+		SET user_id = $2
+		WHERE anonymous_id = $1 AND user_id IS NULL
+	`, anonymousID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to link anonymous views: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if len(duplicated) > 0 || result.RowsAffected() > 0 {
+		log.Printf("Merged anonymous views into user %d: %d linked, %d duplicates removed", userID, result.RowsAffected(), len(duplicated))
+	}
+	return int(result.RowsAffected()), nil
+}
+
 // IncrementModelDownloads increments the download count for a published model
 func IncrementModelDownloads(ctx context.Context, modelID int) error {
 	if models.Pool == nil {
@@ -946,8 +1121,9 @@ func AddComment(ctx context.Context, userID int, modelID int, commentText string
 	return commentID, nil
 }
 
-// GetModelComments retrieves all comments for a model (with user info)
-func GetModelComments(ctx context.Context, modelID int) ([]map[string]interface{}, error) {
+// GetModelComments retrieves all comments for a model (with user info).
+// Hidden comments are only returned to their author and, with moderator set, to moderators.
+func GetModelComments(ctx context.Context, modelID int, viewerID int, moderator bool) ([]map[string]interface{}, error) {
 	if models.Pool == nil {
 		return nil, fmt.Errorf("database connection not initialized")
 	}
@@ -955,15 +1131,15 @@ func GetModelComments(ctx context.Context, modelID int) ([]map[string]interface{
 	query := `
 		SELECT
 			c.id, c.user_id, c.published_model_id, c.parent_comment_id,
-			c.comment_text, c.edited, c.created_at, c.updated_at,
+			c.comment_text, c.edited, c.hidden, c.created_at, c.updated_at,
 			u.username, u.email
 		FROM model_comments c
 		LEFT JOIN users u ON c.user_id = u.id
-		WHERE c.published_model_id = $1
+		WHERE c.published_model_id = $1 AND (NOT c.hidden OR $2 OR c.user_id = $3)
 		ORDER BY c.created_at ASC
 	`
 
-	rows, err := models.Pool.Query(ctx, query, modelID)
+	rows, err := models.Pool.Query(ctx, query, modelID, moderator, viewerID)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -1028,8 +1204,11 @@ func GetPublishedModelsByPublisher(ctx context.Context, publisherID int) ([]map[
 		SELECT
 			pm.id, pm.model_id, pm.publisher_id, pm.name, pm.picture, pm.trained_model_path, pm.training_script,
 			pm.description, pm.short_description, pm.price, pm.category, pm.tags, pm.model_type, pm.framework,
-			pm.file_size, pm.accuracy_score, pm.license_type, pm.downloads_count, pm.views_count,
+			pm.file_size, pm.accuracy_score, pm.primary_metric, pm.primary_metric_direction, pm.primary_metric_value,
+			pm.license_type, pm.downloads_count, pm.views_count,
 			pm.rating_average, pm.rating_count, pm.is_active, pm.is_featured, pm.published_at, pm.updated_at,
+			pm.listing_type, pm.template_path, pm.installs_count, pm.version, pm.rental_price, pm.rental_days,
+			pm.moderation_status, pm.removal_reason, pm.removed_at, pm.duplicate_of, pm.visibility, pm.organization_id,
 			u.username as publisher_username
 		FROM published_models pm
 		LEFT JOIN users u ON pm.publisher_id = u.id
@@ -1106,32 +1285,38 @@ func GetUserByApiKey(ctx context.Context, apiKey string) (*map[string]interface{
 		return nil, fmt.Errorf("database connection not initialized")
 	}
 
-	query := `SELECT id, email, username, api_key, subscription_tier, subscription_status, training_credits FROM users WHERE api_key = $1`
+	// Keys created before keys were hashed are still in api_key until their first use
+	query := `SELECT id, email, username, api_key IS NOT NULL, subscription_tier, subscription_status, training_credits FROM users WHERE (api_key_hash = $1 OR api_key = $2) AND suspended_at IS NULL`
 
-	rows, err := models.Pool.Query(ctx, query, apiKey)
+	rows, err := models.Pool.Query(ctx, query, HashAPIKey(apiKey), apiKey)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
-		return nil, nil
+		return getUserByNamedAPIKey(ctx, apiKey)
 	}
 
 	var user map[string]interface{} = make(map[string]interface{})
 	var id int
-	var email, username, apiKeyDb string
+	var email, username string
+	var legacy bool
 	var subscriptionTier, subscriptionStatus *string
 	var trainingCredits *int
 
-	if err := rows.Scan(&id, &email, &username, &apiKeyDb, &subscriptionTier, &subscriptionStatus, &trainingCredits); err != nil {
+	if err := rows.Scan(&id, &email, &username, &legacy, &subscriptionTier, &subscriptionStatus, &trainingCredits); err != nil {
 		return nil, fmt.Errorf("failed to scan row: %w", err)
 	}
+	rows.Close()
+	if legacy {
+		rehashLegacyAPIKeys(ctx, id)
+	}
 
 	user["id"] = id
 	user["email"] = email
 	user["username"] = username
-	user["api_key"] = apiKeyDb
+	user["api_key"] = apiKey
 	if subscriptionTier != nil {
 		user["subscription_tier"] = *subscriptionTier
 	}
@@ -1145,6 +1330,37 @@ func GetUserByApiKey(ctx context.Context, apiKey string) (*map[string]interface{
 	return &user, nil
 }
 
+// getUserByNamedAPIKey returns the owner of a named API key like GetUserByApiKey, with the key's
+// "api_key_id" and "scopes". Account keys have no "scopes" and are granted every scope.
+func getUserByNamedAPIKey(ctx context.Context, apiKey string) (*map[string]interface{}, error) {
+	key, err := UseAPIKey(ctx, HashAPIKey(apiKey))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user := map[string]interface{}{
+		"id":         key.UserID,
+		"email":      key.Email,
+		"username":   key.Username,
+		"api_key":    apiKey,
+		"api_key_id": key.ID,
+		"scopes":     key.Scopes,
+	}
+	if key.SubscriptionTier != nil {
+		user["subscription_tier"] = *key.SubscriptionTier
+	}
+	if key.SubscriptionStatus != nil {
+		user["subscription_status"] = *key.SubscriptionStatus
+	}
+	if key.TrainingCredits != nil {
+		user["training_credits"] = *key.TrainingCredits
+	}
+	return &user, nil
+}
+
 func GetUserByUsername(ctx context.Context, username string) (*map[string]interface{}, error) {
 	if models.Pool == nil {
 		return nil, fmt.Errorf("database connection not initialized")
@@ -1195,21 +1411,22 @@ func InsertUser(ctx context.Context, email, password, username string) (int, err
 		apiKey = ""
 	}
 
+	// Only the hash of the key is stored; the user sees the key when they regenerate it
 	query := `
-		INSERT INTO users (email, password, username, api_key)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (email, password, username, api_key_hash, api_key_prefix)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
 		RETURNING id
 	`
 
 	var id int
-	err = models.Pool.QueryRow(ctx, query, email, password, username, apiKey).Scan(&id)
+	err = models.Pool.QueryRow(ctx, query, email, password, username, hashUserAPIKey(apiKey), APIKeyPrefix(apiKey)).Scan(&id)
 	if err != nil {
 		// If insertion fails due to unique constraint on api_key, retry with a new key
 		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
 			log.Printf("⚠️  API key collision, retrying with new key...")
 			apiKey, retryErr := helpers.GenerateAPIKey(email + time.Now().String())
 			if retryErr == nil {
-				err = models.Pool.QueryRow(ctx, query, email, password, username, apiKey).Scan(&id)
+				err = models.Pool.QueryRow(ctx, query, email, password, username, hashUserAPIKey(apiKey), APIKeyPrefix(apiKey)).Scan(&id)
 			}
 		}
 		if err != nil {
@@ -1225,7 +1442,8 @@ func InsertUser(ctx context.Context, email, password, username string) (int, err
 	return id, nil
 }
 
-// RegenerateAPIKey generates and updates a user's API key
+// RegenerateAPIKey generates and updates a user's API key. Only its hash is stored, so the returned
+// key cannot be retrieved again.
 func RegenerateAPIKey(ctx context.Context, userID int) (string, error) {
 	if models.Pool == nil {
 		return "", fmt.Errorf("database connection not initialized")
@@ -1251,13 +1469,12 @@ func RegenerateAPIKey(ctx context.Context, userID int) (string, error) {
 	// Retry logic for unique constraint violations
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		query := `UPDATE users SET api_key = $1 WHERE id = $2 RETURNING api_key`
-		var updatedKey string
-		err = models.Pool.QueryRow(ctx, query, apiKey, userID).Scan(&updatedKey)
+		query := `UPDATE users SET api_key = NULL, api_key_hash = $1, api_key_prefix = $2 WHERE id = $3`
+		_, err = models.Pool.Exec(ctx, query, HashAPIKey(apiKey), APIKeyPrefix(apiKey), userID)
 		
 		if err == nil {
 			log.Printf("✅ Regenerated API key for user ID: %d", userID)
-			return updatedKey, nil
+			return apiKey, nil
 		}
 
 		// If unique constraint violation, generate a new key and retry
@@ -1277,7 +1494,8 @@ func RegenerateAPIKey(ctx context.Context, userID int) (string, error) {
 	return "", fmt.Errorf("failed to regenerate API key after %d attempts", maxRetries)
 }
 
-// EnsureUserHasAPIKey ensures a user has an API key, generating one if missing
+// EnsureUserHasAPIKey generates an API key for a user who has none and returns it. It returns ""
+// when the user already has one, since only its hash is stored.
 func EnsureUserHasAPIKey(ctx context.Context, userID int) (string, error) {
 	if models.Pool == nil {
 		return "", fmt.Errorf("database connection not initialized")
@@ -1289,9 +1507,9 @@ func EnsureUserHasAPIKey(ctx context.Context, userID int) (string, error) {
 		return "", fmt.Errorf("user not found: %w", err)
 	}
 
-	existingKey, ok := (*user)["api_key"].(string)
-	if ok && existingKey != "" {
-		return existingKey, nil
+	existingPrefix, ok := (*user)["api_key_prefix"].(string)
+	if ok && existingPrefix != "" {
+		return "", nil
 	}
 
 	// User doesn't have an API key, generate one
@@ -1305,7 +1523,7 @@ func GetUserByID(ctx context.Context, userID int) (*map[string]interface{}, erro
 		return nil, fmt.Errorf("database connection not initialized")
 	}
 
-	query := `SELECT id, email, username, api_key, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT id, email, username, COALESCE(api_key_prefix, LEFT(api_key, 12)) AS api_key_prefix, created_at, updated_at FROM users WHERE id = $1`
 
 	rows, err := models.Pool.Query(ctx, query, userID)
 	if err != nil {
@@ -1362,7 +1580,7 @@ func GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*map[st
 	query := `
 		SELECT id, user_id, email, refresh_token, expires_at, created_at
 		FROM sessions
-		WHERE refresh_token = $1 AND expires_at > NOW()
+		WHERE refresh_token = $1 AND expires_at > NOW() AND rotated_at IS NULL
 	`
 
 	rows, err := models.Pool.Query(ctx, query, refreshToken)
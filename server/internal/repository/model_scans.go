@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// Scan statuses of uploaded model archives
+const (
+	ModelScanClean     = "clean"
+	ModelScanUnscanned = "unscanned"
+)
+
+// SetModelScanResult records the outcome of the scan of a model's uploaded archive. engine is the
+// scanner that checked it, empty when only file types were checked.
+func SetModelScanResult(ctx context.Context, modelID int, status, engine string) error {
+	if _, err := Exec(ctx, `
+		UPDATE models SET scan_status = $2, scan_engine = NULLIF($3, ''), scanned_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, modelID, status, engine); err != nil {
+		return fmt.Errorf("failed to record scan result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// UpdateModelTagsAndNotes sets the tags and notes of a model. A nil tags or notes is left unchanged,
+// and empty notes are cleared.
+func UpdateModelTagsAndNotes(ctx context.Context, modelID int, tags []string, notes *string) error {
+	if _, err := Exec(ctx, `
+		UPDATE models
+		SET tags = COALESCE($2, tags),
+			notes = CASE WHEN $3::TEXT IS NULL THEN notes ELSE NULLIF($3, '') END
+		WHERE id = $1
+	`, modelID, tags, notes); err != nil {
+		return fmt.Errorf("failed to update model tags and notes: %w", err)
+	}
+	return nil
+}
+
+// GetUserModelTags returns the tags used on the user's models with how many models have each
+func GetUserModelTags(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT tag, COUNT(*) AS models_count
+		FROM models, unnest(tags) AS tag
+		WHERE user_id = $1
+		GROUP BY tag
+		ORDER BY models_count DESC, tag
+	`, userID)
+}
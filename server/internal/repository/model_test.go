@@ -0,0 +1,1698 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"server/internal/metricparse"
+	"server/internal/testutil/pgtest"
+)
+
+func TestInsertUserAndLookups(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+
+	id, err := InsertUser(ctx, "ada@example.com", "hash", "ada")
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+
+	byEmail, err := GetUserByEmail(ctx, "ada@example.com")
+	if err != nil || byEmail == nil {
+		t.Fatalf("GetUserByEmail = %v, %v", byEmail, err)
+	}
+	if got := (*byEmail)["id"]; got != int32(id) {
+		t.Errorf("GetUserByEmail id = %v, want %d", got, id)
+	}
+	if prefix, _ := (*byEmail)["api_key_prefix"].(string); !strings.HasPrefix(prefix, "sk_live_") {
+		t.Errorf("GetUserByEmail api_key_prefix = %q, want an account key prefix", prefix)
+	}
+	apiKey, err := RegenerateAPIKey(ctx, id)
+	if err != nil {
+		t.Fatalf("RegenerateAPIKey: %v", err)
+	}
+	if byKey, err := GetUserByApiKey(ctx, apiKey); err != nil || byKey == nil || (*byKey)["id"] != id {
+		t.Errorf("GetUserByApiKey of the regenerated key = %v, %v, want user %d", byKey, err, id)
+	}
+	if stored, err := QueryRow(ctx, `SELECT api_key, api_key_hash FROM users WHERE id = $1`, id); err != nil || stored["api_key"] != nil || stored["api_key_hash"] != HashAPIKey(apiKey) {
+		t.Errorf("stored API key = %v, %v, want only its hash", stored, err)
+	}
+
+	byUsername, err := GetUserByUsername(ctx, "ada")
+	if err != nil || byUsername == nil {
+		t.Fatalf("GetUserByUsername = %v, %v", byUsername, err)
+	}
+	byID, err := GetUserByID(ctx, id)
+	if err != nil || byID == nil || (*byID)["email"] != "ada@example.com" {
+		t.Fatalf("GetUserByID = %v, %v", byID, err)
+	}
+
+	if missing, err := GetUserByEmail(ctx, "nobody@example.com"); err != nil || missing != nil {
+		t.Errorf("GetUserByEmail of unknown email = %v, %v, want nil, nil", missing, err)
+	}
+	if _, err := InsertUser(ctx, "ada@example.com", "hash", "ada2"); err == nil {
+		t.Error("InsertUser accepted a duplicate email")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+
+	if _, err := InsertSession(ctx, user.ID, user.Email, "valid-token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("InsertSession: %v", err)
+	}
+	session, err := GetSessionByRefreshToken(ctx, "valid-token")
+	if err != nil || session == nil {
+		t.Fatalf("GetSessionByRefreshToken = %v, %v", session, err)
+	}
+	if got := (*session)["user_id"]; got != int32(user.ID) {
+		t.Errorf("session user_id = %v, want %d", got, user.ID)
+	}
+
+	expired := pgtest.CreateSession(t, user, -time.Minute)
+	if session, err := GetSessionByRefreshToken(ctx, expired); err != nil || session != nil {
+		t.Errorf("GetSessionByRefreshToken of expired session = %v, %v, want nil, nil", session, err)
+	}
+}
+
+func TestModelsCRUD(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+
+	id, err := InsertModel(ctx, owner.ID, "digits", "./uploads/digits.png", []string{"./uploads/digits"}, "")
+	if err != nil {
+		t.Fatalf("InsertModel: %v", err)
+	}
+
+	list, err := GetModelsByUserID(ctx, owner.ID, "")
+	if err != nil {
+		t.Fatalf("GetModelsByUserID: %v", err)
+	}
+	if len(list) != 1 || list[0]["training_script"] != "train.py" {
+		t.Fatalf("GetModelsByUserID = %v, want one model with the default training script", list)
+	}
+	if list, _ := GetModelsByUserID(ctx, other.ID, ""); len(list) != 0 {
+		t.Errorf("GetModelsByUserID of another user = %v, want none", list)
+	}
+
+	if err := UpdateModelAccuracy(ctx, "digits", 0.93); err != nil {
+		t.Fatalf("UpdateModelAccuracy: %v", err)
+	}
+	model, err := GetModelByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetModelByID: %v", err)
+	}
+	if (*model)["accuracy_score"] == nil {
+		t.Error("UpdateModelAccuracy did not store the accuracy")
+	}
+
+	notes := "baseline before augmentation"
+	if err := UpdateModelTagsAndNotes(ctx, id, []string{"vision", "mnist"}, &notes); err != nil {
+		t.Fatalf("UpdateModelTagsAndNotes: %v", err)
+	}
+	if tagged, _ := GetModelsByUserID(ctx, owner.ID, "Vision"); len(tagged) != 1 || tagged[0]["notes"] != notes {
+		t.Errorf("GetModelsByUserID(vision) = %v, want the tagged model with its notes", tagged)
+	}
+	if untagged, _ := GetModelsByUserID(ctx, owner.ID, "nlp"); len(untagged) != 0 {
+		t.Errorf("GetModelsByUserID(nlp) = %v, want none", untagged)
+	}
+	if err := UpdateModelTagsAndNotes(ctx, id, nil, nil); err != nil {
+		t.Fatalf("UpdateModelTagsAndNotes: %v", err)
+	}
+	if tags, _ := GetUserModelTags(ctx, owner.ID); len(tags) != 2 {
+		t.Errorf("GetUserModelTags = %v, want the two tags left unchanged", tags)
+	}
+
+	if name, direction, err := GetModelPrimaryMetric(ctx, id); err != nil || name != "accuracy" || direction != "higher" {
+		t.Errorf("GetModelPrimaryMetric = %q, %q, %v, want accuracy, higher", name, direction, err)
+	}
+	if err := SetModelPrimaryMetric(ctx, id, "rmse", "lower"); err != nil {
+		t.Fatalf("SetModelPrimaryMetric: %v", err)
+	}
+	if err := UpdateModelPrimaryMetricValue(ctx, "digits", 0.42); err != nil {
+		t.Fatalf("UpdateModelPrimaryMetricValue: %v", err)
+	}
+	if model, _ := GetModelByID(ctx, id); (*model)["primary_metric"] != "rmse" || (*model)["primary_metric_value"] != 0.42 {
+		t.Errorf("GetModelByID = %v, want rmse 0.42 as primary metric", *model)
+	}
+
+	if patterns, err := GetModelMetricPatterns(ctx, id); err != nil || len(patterns) != 0 {
+		t.Errorf("GetModelMetricPatterns = %v, %v, want none", patterns, err)
+	}
+	want := []metricparse.Pattern{{Name: "detection", Pattern: `mAP (?P<map50>[0-9.]+)`}}
+	if err := SetModelMetricPatterns(ctx, id, want); err != nil {
+		t.Fatalf("SetModelMetricPatterns: %v", err)
+	}
+	if patterns, err := GetModelMetricPatterns(ctx, id); err != nil || !slices.Equal(patterns, want) {
+		t.Errorf("GetModelMetricPatterns = %v, %v, want %v", patterns, err, want)
+	}
+
+	if _, err := DeleteModel(ctx, id, other.ID); err == nil {
+		t.Error("DeleteModel let another user delete the model")
+	}
+	if _, err := DeleteModel(ctx, id, owner.ID); err != nil {
+		t.Fatalf("DeleteModel: %v", err)
+	}
+	if _, err := GetModelByID(ctx, id); err != pgx.ErrNoRows {
+		t.Errorf("GetModelByID after delete error = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func TestInsertModelWithFiles(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+
+	if _, err := InsertModelWithFiles(ctx, owner.ID, "staged", "", []string{"./uploads/staged"}, "", func() error {
+		return errors.New("rename failed")
+	}); err == nil {
+		t.Fatal("InsertModelWithFiles succeeded although the files could not be committed")
+	}
+	if inUse, err := ModelFilesInUse(ctx, "./uploads/staged"); err != nil || inUse {
+		t.Fatalf("ModelFilesInUse after a failed commit = %v, %v, want the insert rolled back", inUse, err)
+	}
+
+	committed := false
+	if _, err := InsertModelWithFiles(ctx, owner.ID, "staged", "/uploads/staged/cover.png", []string{"./uploads/staged"}, "", func() error {
+		committed = true
+		return nil
+	}); err != nil || !committed {
+		t.Fatalf("InsertModelWithFiles = %v (files committed: %v)", err, committed)
+	}
+	if inUse, err := ModelFilesInUse(ctx, "./uploads/staged"); err != nil || !inUse {
+		t.Errorf("ModelFilesInUse = %v, %v, want the model's folder in use", inUse, err)
+	}
+	if inUse, _ := ModelFilesInUse(ctx, "./uploads/stage"); inUse {
+		t.Error("ModelFilesInUse matched a folder that is a prefix of the model's")
+	}
+}
+
+func TestPublishedModels(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, publisher.ID)
+
+	id, err := InsertPublishedModel(ctx, map[string]interface{}{
+		"model_id":           modelID,
+		"publisher_id":       publisher.ID,
+		"name":               "Digits classifier",
+		"trained_model_path": "./uploads/trained/digits.pt",
+		"description":        "Recognizes handwritten digits",
+		"price":              0,
+	})
+	if err != nil {
+		t.Fatalf("InsertPublishedModel: %v", err)
+	}
+
+	listing, err := GetPublishedModelByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetPublishedModelByID: %v", err)
+	}
+	if listing["publisher_username"] != publisher.Username || listing["listing_type"] != "model" {
+		t.Errorf("GetPublishedModelByID = %v", listing)
+	}
+	if _, err := GetPublishedModelByID(ctx, id+1000); err != pgx.ErrNoRows {
+		t.Errorf("GetPublishedModelByID of unknown listing error = %v, want pgx.ErrNoRows", err)
+	}
+
+	if active, _ := GetPublishedModels(ctx, "", 0); len(active) != 1 {
+		t.Fatalf("GetPublishedModels = %d listings, want 1", len(active))
+	}
+	if templates, _ := GetPublishedModels(ctx, "pipeline_template", 0); len(templates) != 0 {
+		t.Errorf("GetPublishedModels(pipeline_template) = %d listings, want 0", len(templates))
+	}
+
+	other := pgtest.CreateUser(t)
+	if err := SetListingVisibility(ctx, id, ListingVisibilityPrivate, nil); err != nil {
+		t.Fatalf("SetListingVisibility: %v", err)
+	}
+	if visible, _ := GetPublishedModels(ctx, "", other.ID); len(visible) != 0 {
+		t.Errorf("GetPublishedModels showed a private listing to another user")
+	}
+	if own, _ := GetPublishedModels(ctx, "", publisher.ID); len(own) != 1 {
+		t.Errorf("GetPublishedModels hid a private listing from its publisher")
+	}
+	if ok, _ := CanViewListing(ctx, id, other.ID); ok {
+		t.Error("CanViewListing let another user view a private listing")
+	}
+	if err := SetListingVisibility(ctx, id, ListingVisibilityPublic, nil); err != nil {
+		t.Fatalf("SetListingVisibility: %v", err)
+	}
+
+	if err := UnpublishModel(ctx, id, other.ID); err == nil {
+		t.Error("UnpublishModel let another user unpublish the listing")
+	}
+	if err := UnpublishModel(ctx, id, publisher.ID); err != nil {
+		t.Fatalf("UnpublishModel: %v", err)
+	}
+	if active, _ := GetPublishedModels(ctx, "", 0); len(active) != 0 {
+		t.Errorf("GetPublishedModels after unpublish = %d listings, want 0", len(active))
+	}
+	if own, _ := GetPublishedModelsByPublisher(ctx, publisher.ID); len(own) != 1 {
+		t.Errorf("GetPublishedModelsByPublisher = %d listings, want the unpublished one", len(own))
+	}
+
+	weightsOnly := map[string]interface{}{
+		"model_id":     modelID,
+		"publisher_id": publisher.ID,
+		"name":         "Digits weights",
+		"description":  "Weights of the digits classifier",
+		"price":        0,
+		"listing_type": "weights_only",
+	}
+	if _, err := InsertPublishedModel(ctx, weightsOnly); err == nil {
+		t.Error("InsertPublishedModel accepted a weights-only listing without weights")
+	}
+	weightsOnly["trained_model_path"] = "./uploads/trained/digits.pt"
+	if _, err := InsertPublishedModel(ctx, weightsOnly); err != nil {
+		t.Fatalf("InsertPublishedModel of a weights-only listing: %v", err)
+	}
+	if listings, _ := GetPublishedModels(ctx, "weights_only", 0); len(listings) != 1 {
+		t.Errorf("GetPublishedModels(weights_only) = %d listings, want 1", len(listings))
+	}
+}
+
+func TestGetPublicListings(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, publisher.ID)
+
+	var ids []int
+	for _, visibility := range []string{ListingVisibilityPublic, ListingVisibilityPublic, ListingVisibilityPublic, ListingVisibilityPrivate} {
+		id, err := InsertPublishedModel(ctx, map[string]interface{}{
+			"model_id":           modelID,
+			"publisher_id":       publisher.ID,
+			"name":               "Digits " + visibility,
+			"trained_model_path": "./uploads/trained/digits.pt",
+			"price":              0,
+			"visibility":         visibility,
+		})
+		if err != nil {
+			t.Fatalf("InsertPublishedModel: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	first, err := GetPublicListings(ctx, "", "", nil, 2)
+	if err != nil {
+		t.Fatalf("GetPublicListings: %v", err)
+	}
+	if len(first) != 2 || first[0]["id"] != int32(ids[2]) || first[0]["trained_model_path"] != nil {
+		t.Fatalf("GetPublicListings = %v, want the two newest public listings without file paths", first)
+	}
+	last := first[1]
+	rest, err := GetPublicListings(ctx, "", "", &PublicListingCursor{PublishedAt: last["published_at"].(time.Time), ID: int(last["id"].(int32))}, 2)
+	if err != nil {
+		t.Fatalf("GetPublicListings after cursor: %v", err)
+	}
+	if len(rest) != 1 || rest[0]["id"] != int32(ids[0]) {
+		t.Errorf("GetPublicListings after cursor = %v, want the oldest public listing only", rest)
+	}
+	if _, err := GetPublicListing(ctx, ids[3]); err != pgx.ErrNoRows {
+		t.Errorf("GetPublicListing of a private listing error = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func TestSearchPublishedModels(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, publisher.ID)
+
+	for _, listing := range []map[string]interface{}{
+		{"name": "Digits classifier", "description": "Recognizes handwritten digits", "category": "vision"},
+		{"name": "Sentiment model", "description": "Classifies the sentiment of reviews", "category": "nlp"},
+	} {
+		listing["model_id"] = modelID
+		listing["publisher_id"] = publisher.ID
+		listing["price"] = 0
+		if _, err := InsertPublishedModel(ctx, listing); err != nil {
+			t.Fatalf("InsertPublishedModel: %v", err)
+		}
+	}
+
+	results, total, err := SearchPublishedModels(ctx, "handwritten digit", ListingSearchFilters{}, 0, 10, 0)
+	if err != nil {
+		t.Fatalf("SearchPublishedModels: %v", err)
+	}
+	if total != 1 || len(results) != 1 || results[0]["name"] != "Digits classifier" {
+		t.Errorf("SearchPublishedModels = %d results (%v), want the digits classifier", total, results)
+	}
+	if _, total, _ := SearchPublishedModels(ctx, "sentiment", ListingSearchFilters{Category: "vision"}, 0, 10, 0); total != 0 {
+		t.Errorf("SearchPublishedModels ignored the category filter: %d results", total)
+	}
+}
+
+func TestSearchUserWorkspace(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, owner.ID)
+	pgtest.CreateModel(t, other.ID)
+	if err := RecordModelTrainingRun(ctx, modelID, owner.ID, "train_abc123", "server", "", nil); err != nil {
+		t.Fatalf("RecordModelTrainingRun: %v", err)
+	}
+
+	results, err := SearchUserWorkspace(ctx, owner.ID, "model-", 10)
+	if err != nil {
+		t.Fatalf("SearchUserWorkspace: %v", err)
+	}
+	if len(results) != 1 || results[0]["type"] != SearchResultModel || results[0]["id"] != int32(modelID) {
+		t.Errorf("SearchUserWorkspace(model-) = %v, want only the owner's model", results)
+	}
+	if runs, _ := SearchUserWorkspace(ctx, owner.ID, "abc1", 10); len(runs) != 1 || runs[0]["type"] != SearchResultRun {
+		t.Errorf("SearchUserWorkspace(abc1) = %v, want the training run", runs)
+	}
+	if none, _ := SearchUserWorkspace(ctx, owner.ID, "100%", 10); len(none) != 0 {
+		t.Errorf("SearchUserWorkspace treated %% as a wildcard: %v", none)
+	}
+}
+
+func TestLikes(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	fan := pgtest.CreateUser(t)
+	listingID := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+
+	for i := 0; i < 2; i++ {
+		if err := LikeModel(ctx, fan.ID, listingID); err != nil {
+			t.Fatalf("LikeModel: %v", err)
+		}
+	}
+	if count, err := GetModelLikesCount(ctx, listingID); err != nil || count != 1 {
+		t.Errorf("GetModelLikesCount after liking twice = %d, %v, want 1", count, err)
+	}
+	if liked, err := HasUserLikedModel(ctx, fan.ID, listingID); err != nil || !liked {
+		t.Errorf("HasUserLikedModel = %t, %v, want true", liked, err)
+	}
+	if liked, _ := HasUserLikedModel(ctx, publisher.ID, listingID); liked {
+		t.Error("HasUserLikedModel = true for a user who did not like the listing")
+	}
+
+	if err := UnlikeModel(ctx, fan.ID, listingID); err != nil {
+		t.Fatalf("UnlikeModel: %v", err)
+	}
+	if count, _ := GetModelLikesCount(ctx, listingID); count != 0 {
+		t.Errorf("GetModelLikesCount after unlike = %d, want 0", count)
+	}
+}
+
+func TestCommentModeration(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	author := pgtest.CreateUser(t)
+	reporter := pgtest.CreateUser(t)
+	listingID := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+
+	commentID, err := AddComment(ctx, author.ID, listingID, "first", nil)
+	if err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+
+	if _, err := UpdateCommentText(ctx, commentID, reporter.ID, "hijacked"); err != pgx.ErrNoRows {
+		t.Errorf("UpdateCommentText by another user error = %v, want pgx.ErrNoRows", err)
+	}
+	updated, err := UpdateCommentText(ctx, commentID, author.ID, "edited")
+	if err != nil {
+		t.Fatalf("UpdateCommentText: %v", err)
+	}
+	if updated["comment_text"] != "edited" || updated["edited"] != true {
+		t.Errorf("UpdateCommentText = %v, want the edited text marked edited", updated)
+	}
+
+	if _, err := ReportComment(ctx, commentID, reporter.ID, "spam"); err != nil {
+		t.Fatalf("ReportComment: %v", err)
+	}
+	if _, err := ReportComment(ctx, commentID, reporter.ID, "spam"); !errors.Is(err, ErrCommentAlreadyReported) {
+		t.Errorf("second ReportComment error = %v, want ErrCommentAlreadyReported", err)
+	}
+	if reports, _ := GetListingCommentReports(ctx, listingID, CommentReportOpen); len(reports) != 1 {
+		t.Errorf("GetListingCommentReports(open) returned %d reports, want 1", len(reports))
+	}
+
+	if err := SetCommentHidden(ctx, commentID, publisher.ID, true); err != nil {
+		t.Fatalf("SetCommentHidden: %v", err)
+	}
+	if reports, _ := GetListingCommentReports(ctx, listingID, CommentReportResolved); len(reports) != 1 {
+		t.Errorf("hiding a comment resolved %d reports, want 1", len(reports))
+	}
+	if comments, _ := GetModelComments(ctx, listingID, reporter.ID, false); len(comments) != 0 {
+		t.Errorf("GetModelComments showed %d hidden comments to another user, want 0", len(comments))
+	}
+	if comments, _ := GetModelComments(ctx, listingID, author.ID, false); len(comments) != 1 {
+		t.Errorf("GetModelComments showed %d comments to the author of a hidden comment, want 1", len(comments))
+	}
+	if comments, _ := GetModelComments(ctx, listingID, publisher.ID, true); len(comments) != 1 {
+		t.Errorf("GetModelComments showed %d comments to a moderator, want 1", len(comments))
+	}
+	if err := SetCommentHidden(ctx, commentID, publisher.ID, false); err != nil {
+		t.Fatalf("SetCommentHidden(false): %v", err)
+	}
+	if comments, _ := GetModelComments(ctx, listingID, reporter.ID, false); len(comments) != 1 {
+		t.Errorf("GetModelComments after unhiding returned %d comments, want 1", len(comments))
+	}
+
+	other := pgtest.CreateUser(t)
+	if _, err := ReportComment(ctx, commentID, other.ID, "rude"); err != nil {
+		t.Fatalf("ReportComment: %v", err)
+	}
+	if n, err := DismissCommentReports(ctx, commentID, publisher.ID); err != nil || n != 1 {
+		t.Errorf("DismissCommentReports = %d, %v, want 1", n, err)
+	}
+
+	if err := DeleteListingComment(ctx, listingID+1, commentID); err != pgx.ErrNoRows {
+		t.Errorf("DeleteListingComment on another listing error = %v, want pgx.ErrNoRows", err)
+	}
+	if err := DeleteListingComment(ctx, listingID, commentID); err != nil {
+		t.Fatalf("DeleteListingComment: %v", err)
+	}
+	if _, err := GetListingComment(ctx, listingID, commentID); err != pgx.ErrNoRows {
+		t.Errorf("GetListingComment after delete error = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func TestCommentThreads(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	user := pgtest.CreateUser(t)
+	listingID := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+
+	add := func(text string, parentID *int) int {
+		t.Helper()
+		id, err := AddComment(ctx, user.ID, listingID, text, parentID)
+		if err != nil {
+			t.Fatalf("AddComment: %v", err)
+		}
+		return id
+	}
+	first := add("first", nil)
+	add("second", nil)
+	var replies []int
+	for i := 0; i < 4; i++ {
+		replies = append(replies, add("reply", &first))
+	}
+	add("nested", &replies[0])
+	if err := SetCommentHidden(ctx, replies[3], publisher.ID, true); err != nil {
+		t.Fatalf("SetCommentHidden: %v", err)
+	}
+
+	threads, total, err := GetCommentThreads(ctx, listingID, 0, false, 1, 0, 2)
+	if err != nil {
+		t.Fatalf("GetCommentThreads: %v", err)
+	}
+	if total != 2 || len(threads) != 1 {
+		t.Fatalf("GetCommentThreads returned %d of %d threads, want 1 of 2", len(threads), total)
+	}
+	if threads[0]["id"] != int32(first) || threads[0]["reply_count"] != int64(3) {
+		t.Errorf("first thread = %v, want comment %d with 3 visible replies", threads[0], first)
+	}
+	shown := threads[0]["replies"].([]map[string]interface{})
+	if len(shown) != 2 || shown[0]["id"] != int32(replies[0]) || shown[0]["reply_count"] != int64(1) {
+		t.Errorf("first thread replies = %v, want the first 2 with the nested reply counted", shown)
+	}
+
+	if _, total, _ := GetCommentThreads(ctx, listingID, 0, true, 10, 0, 0); total != 2 {
+		t.Errorf("GetCommentThreads total = %d, want 2", total)
+	}
+	page, total, err := GetCommentReplies(ctx, listingID, first, 0, false, 2, 2)
+	if err != nil {
+		t.Fatalf("GetCommentReplies: %v", err)
+	}
+	if total != 3 || len(page) != 1 || page[0]["id"] != int32(replies[2]) {
+		t.Errorf("GetCommentReplies second page = %v of %d, want reply %d of 3", page, total, replies[2])
+	}
+	if _, total, _ := GetCommentReplies(ctx, listingID, first, 0, true, 10, 0); total != 4 {
+		t.Errorf("GetCommentReplies for moderators total = %d, want 4 with the hidden reply", total)
+	}
+}
+
+func TestUserProfiles(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	first := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	second := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	if _, err := Exec(ctx, `UPDATE published_models SET downloads_count = 10, rating_average = 4, rating_count = 3 WHERE id = $1`, first); err != nil {
+		t.Fatalf("failed to rate listing: %v", err)
+	}
+	if _, err := Exec(ctx, `UPDATE published_models SET downloads_count = 5, rating_average = 2, rating_count = 1 WHERE id = $1`, second); err != nil {
+		t.Fatalf("failed to rate listing: %v", err)
+	}
+
+	if err := UpdateUserBio(ctx, publisher.ID, "Computer vision models"); err != nil {
+		t.Fatalf("UpdateUserBio: %v", err)
+	}
+	if previous, err := SetUserAvatar(ctx, publisher.ID, "avatars/1/a.png"); err != nil || previous != "" {
+		t.Fatalf("SetUserAvatar = %q, %v, want no previous avatar", previous, err)
+	}
+	if previous, _ := SetUserAvatar(ctx, publisher.ID, "avatars/1/b.png"); previous != "avatars/1/a.png" {
+		t.Errorf("SetUserAvatar previous = %q, want avatars/1/a.png", previous)
+	}
+
+	profile, err := GetPublicProfile(ctx, publisher.Username)
+	if err != nil {
+		t.Fatalf("GetPublicProfile: %v", err)
+	}
+	if profile["bio"] != "Computer vision models" || profile["avatar_path"] != "avatars/1/b.png" {
+		t.Errorf("GetPublicProfile = %v, want the bio and latest avatar", profile)
+	}
+	if _, err := GetPublicProfile(ctx, "no-such-user"); err != pgx.ErrNoRows {
+		t.Errorf("GetPublicProfile of a missing user error = %v, want pgx.ErrNoRows", err)
+	}
+
+	stats, err := GetPublisherStats(ctx, publisher.ID)
+	if err != nil {
+		t.Fatalf("GetPublisherStats: %v", err)
+	}
+	if stats["listings_count"] != int32(2) || stats["downloads_count"] != int32(15) || stats["rating_count"] != int32(4) || stats["rating_average"] != 3.5 {
+		t.Errorf("GetPublisherStats = %v, want 2 listings, 15 downloads and 3.5 over 4 ratings", stats)
+	}
+
+	if err := SetListingVisibility(ctx, second, ListingVisibilityPrivate, nil); err != nil {
+		t.Fatalf("SetListingVisibility: %v", err)
+	}
+	if stats, _ := GetPublisherStats(ctx, publisher.ID); stats["listings_count"] != int32(1) {
+		t.Errorf("GetPublisherStats counted %v listings with a private one, want 1", stats["listings_count"])
+	}
+}
+
+func TestFollows(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	follower := pgtest.CreateUser(t)
+	listingID := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	hidden := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	if err := SetListingVisibility(ctx, hidden, ListingVisibilityPrivate, nil); err != nil {
+		t.Fatalf("SetListingVisibility: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := FollowPublisher(ctx, follower.ID, publisher.ID); err != nil {
+			t.Fatalf("FollowPublisher: %v", err)
+		}
+	}
+	if err := FollowPublisher(ctx, publisher.ID, publisher.ID); err == nil {
+		t.Error("FollowPublisher let a user follow themselves")
+	}
+	if count, err := CountFollowers(ctx, publisher.ID); err != nil || count != 1 {
+		t.Errorf("CountFollowers = %d, %v, want 1", count, err)
+	}
+	if following, _ := IsFollowing(ctx, follower.ID, publisher.ID); !following {
+		t.Error("IsFollowing = false after following")
+	}
+	if publishers, total, _ := GetFollowedPublishers(ctx, follower.ID, 10, 0); total != 1 || len(publishers) != 1 {
+		t.Errorf("GetFollowedPublishers returned %d of %d, want 1", len(publishers), total)
+	}
+
+	if followers, _ := GetFollowers(ctx, publisher.ID, listingID); len(followers) != 1 {
+		t.Errorf("GetFollowers of a public listing = %d, want 1", len(followers))
+	}
+	if followers, _ := GetFollowers(ctx, publisher.ID, hidden); len(followers) != 0 {
+		t.Errorf("GetFollowers of a private listing = %d, want 0", len(followers))
+	}
+
+	if _, err := UpdatePublishedModelArtifact(ctx, listingID, "./uploads/trained/v2.pt", nil); err != nil {
+		t.Fatalf("UpdatePublishedModelArtifact: %v", err)
+	}
+	feed, total, err := GetFollowFeed(ctx, follower.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("GetFollowFeed: %v", err)
+	}
+	if total != 2 || len(feed) != 2 || feed[0]["event"] != FeedEventNewVersion || feed[1]["event"] != FeedEventPublished {
+		t.Errorf("GetFollowFeed = %v, want the new version then the publication of the public listing", feed)
+	}
+
+	if removed, err := UnfollowPublisher(ctx, follower.ID, publisher.ID); err != nil || !removed {
+		t.Errorf("UnfollowPublisher = %t, %v, want true", removed, err)
+	}
+	if _, total, _ := GetFollowFeed(ctx, follower.ID, 10, 0); total != 0 {
+		t.Errorf("GetFollowFeed after unfollowing has %d events, want 0", total)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	owner := pgtest.CreateUser(t)
+	listingID := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	private := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+
+	collectionID, err := CreateCollection(ctx, owner.ID, "Vision", "", false, fmt.Sprintf("vision-%d", owner.ID))
+	if err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	if _, err := CreateCollection(ctx, owner.ID, "Vision", "", false, fmt.Sprintf("vision-2-%d", owner.ID)); err != ErrCollectionExists {
+		t.Errorf("CreateCollection with a taken name error = %v, want ErrCollectionExists", err)
+	}
+
+	for _, id := range []int{listingID, listingID, private} {
+		if err := AddCollectionItem(ctx, collectionID, id); err != nil {
+			t.Fatalf("AddCollectionItem: %v", err)
+		}
+	}
+	if err := SetListingVisibility(ctx, private, ListingVisibilityPrivate, nil); err != nil {
+		t.Fatalf("SetListingVisibility: %v", err)
+	}
+	if items, _ := GetCollectionItems(ctx, collectionID, owner.ID); len(items) != 1 || items[0]["id"] != int32(listingID) {
+		t.Errorf("GetCollectionItems = %v, want only the listing still visible", items)
+	}
+	if saved, _ := GetSavedListingIDs(ctx, owner.ID); !saved[listingID] || saved[listingID+1000] {
+		t.Errorf("GetSavedListingIDs = %v, want listing %d", saved, listingID)
+	}
+	if collections, _ := GetCollections(ctx, owner.ID); len(collections) != 1 || collections[0]["item_count"] != int32(2) {
+		t.Errorf("GetCollections = %v, want one collection of 2 items", collections)
+	}
+
+	if _, err := GetPublicCollection(ctx, fmt.Sprintf("vision-%d", owner.ID)); err != pgx.ErrNoRows {
+		t.Errorf("GetPublicCollection of a private collection error = %v, want pgx.ErrNoRows", err)
+	}
+	public := true
+	if updated, err := UpdateCollection(ctx, owner.ID, collectionID, nil, nil, &public); err != nil || !updated {
+		t.Fatalf("UpdateCollection = %t, %v", updated, err)
+	}
+	if collection, err := GetPublicCollection(ctx, fmt.Sprintf("vision-%d", owner.ID)); err != nil || collection["owner_username"] != owner.Username {
+		t.Errorf("GetPublicCollection = %v, %v, want the shared collection", collection, err)
+	}
+	if updated, _ := UpdateCollection(ctx, publisher.ID, collectionID, nil, nil, &public); updated {
+		t.Error("UpdateCollection updated another user's collection")
+	}
+
+	if removed, _ := RemoveCollectionItem(ctx, collectionID, listingID); !removed {
+		t.Error("RemoveCollectionItem = false for a saved listing")
+	}
+	if deleted, err := DeleteCollection(ctx, owner.ID, collectionID); err != nil || !deleted {
+		t.Errorf("DeleteCollection = %t, %v, want true", deleted, err)
+	}
+}
+
+func TestTrendingAndSimilarListings(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	fan := pgtest.CreateUser(t)
+	quiet := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	liked := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	category := fmt.Sprintf("trending-%d", liked)
+	if _, err := Exec(ctx, `
+		UPDATE published_models SET category = $2, tags = $3, framework = 'pytorch' WHERE id = ANY($1)
+	`, []int{quiet, liked}, category, []string{"vision", "Detection"}); err != nil {
+		t.Fatalf("failed to tag listings: %v", err)
+	}
+	if err := LikeModel(ctx, fan.ID, liked); err != nil {
+		t.Fatalf("LikeModel: %v", err)
+	}
+
+	weights := TrendingWeights{Download: 3, Like: 2, View: 1, Release: 10, HalfLifeHours: 48, WindowDays: 14}
+	if _, err := RefreshTrendingScores(ctx, weights); err != nil {
+		t.Fatalf("RefreshTrendingScores: %v", err)
+	}
+	trending, total, err := GetTrendingListings(ctx, fan.ID, category, 10, 0)
+	if err != nil {
+		t.Fatalf("GetTrendingListings: %v", err)
+	}
+	if total != 2 || len(trending) != 2 || trending[0]["id"] != int32(liked) {
+		t.Errorf("GetTrendingListings = %v, want the liked listing first", trending)
+	}
+	if score, _ := trending[0]["trending_score"].(float64); score <= 10 {
+		t.Errorf("trending score of a new liked listing = %v, want more than its release weight", score)
+	}
+
+	similar, err := GetSimilarListings(ctx, liked, fan.ID, 5)
+	if err != nil {
+		t.Fatalf("GetSimilarListings: %v", err)
+	}
+	if len(similar) == 0 || similar[0]["id"] != int32(quiet) || similar[0]["similarity"] != int32(10) {
+		t.Errorf("GetSimilarListings = %v, want listing %d first with 2 tags, the category and framework shared", similar, quiet)
+	}
+	for _, listing := range similar {
+		if listing["id"] == int32(liked) {
+			t.Error("GetSimilarListings returned the listing itself")
+		}
+	}
+}
+
+func TestListingDailyStats(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	buyer := pgtest.CreateUser(t)
+	listing := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	if err := LikeModel(ctx, buyer.ID, listing); err != nil {
+		t.Fatalf("LikeModel: %v", err)
+	}
+	if _, err := Exec(ctx, `
+		INSERT INTO model_purchases (published_model_id, buyer_id, publisher_id, price_paid)
+		VALUES ($1, $2, $3, 499)
+	`, listing, buyer.ID, publisher.ID); err != nil {
+		t.Fatalf("failed to insert purchase: %v", err)
+	}
+
+	today := time.Now()
+	from, to := today.AddDate(0, 0, -1), today.AddDate(0, 0, 1)
+	for i := 0; i < 2; i++ {
+		if _, err := AggregateListingDailyStats(ctx, publisher.ID, from, to); err != nil {
+			t.Fatalf("AggregateListingDailyStats: %v", err)
+		}
+	}
+	rows, err := GetPublisherDailyStats(ctx, publisher.ID, 0, from, to)
+	if err != nil {
+		t.Fatalf("GetPublisherDailyStats: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["likes"] != int32(1) || rows[0]["purchases"] != int32(1) || rows[0]["revenue"] != int32(499) {
+		t.Errorf("GetPublisherDailyStats = %v, want one day with a like and a 499 purchase", rows)
+	}
+
+	// A day whose events went away is removed on the next aggregation
+	if _, err := Exec(ctx, `DELETE FROM model_purchases WHERE published_model_id = $1`, listing); err != nil {
+		t.Fatalf("failed to delete purchase: %v", err)
+	}
+	if err := UnlikeModel(ctx, buyer.ID, listing); err != nil {
+		t.Fatalf("UnlikeModel: %v", err)
+	}
+	if _, err := AggregateListingDailyStats(ctx, publisher.ID, from, to); err != nil {
+		t.Fatalf("AggregateListingDailyStats: %v", err)
+	}
+	if rows, err = GetPublisherDailyStats(ctx, publisher.ID, listing, from, to); err != nil || len(rows) != 0 {
+		t.Errorf("GetPublisherDailyStats after removing the events = %v, %v, want no rows", rows, err)
+	}
+}
+
+func TestStripeEvents(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	id := fmt.Sprintf("evt_test_%d", time.Now().UnixNano())
+	payload := []byte(`{"id": "` + id + `", "type": "invoice.payment_failed"}`)
+
+	claimed, err := ClaimStripeEvent(ctx, id, "invoice.payment_failed", false, payload, time.Now())
+	if err != nil || !claimed {
+		t.Fatalf("ClaimStripeEvent = %v, %v, want the new event claimed", claimed, err)
+	}
+	if claimed, err = ClaimStripeEvent(ctx, id, "invoice.payment_failed", false, payload, time.Now()); err != nil || claimed {
+		t.Errorf("ClaimStripeEvent while processing = %v, %v, want false", claimed, err)
+	}
+
+	// A failed event is claimed again by the retry, a processed one is not
+	if err := FinishStripeEvent(ctx, id, fmt.Errorf("no user for customer")); err != nil {
+		t.Fatalf("FinishStripeEvent: %v", err)
+	}
+	failed, total, err := GetStripeEvents(ctx, StripeEventFailed, "invoice.payment_failed", 100, 0)
+	if err != nil || total == 0 {
+		t.Fatalf("GetStripeEvents = %v, %d, %v", failed, total, err)
+	}
+	if claimed, err = ClaimStripeEvent(ctx, id, "invoice.payment_failed", false, payload, time.Now()); err != nil || !claimed {
+		t.Errorf("ClaimStripeEvent of a failed event = %v, %v, want true", claimed, err)
+	}
+	if err := FinishStripeEvent(ctx, id, nil); err != nil {
+		t.Fatalf("FinishStripeEvent: %v", err)
+	}
+	if claimed, err = ClaimStripeEvent(ctx, id, "invoice.payment_failed", false, payload, time.Now()); err != nil || claimed {
+		t.Errorf("ClaimStripeEvent of a processed event = %v, %v, want false", claimed, err)
+	}
+
+	event, err := GetStripeEvent(ctx, id)
+	if err != nil {
+		t.Fatalf("GetStripeEvent: %v", err)
+	}
+	if event["status"] != StripeEventProcessed || event["attempts"] != int32(2) || event["error"] != nil {
+		t.Errorf("GetStripeEvent = %v, want processed after 2 attempts without an error", event)
+	}
+}
+
+func TestStripeInvoices(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+	prefix := fmt.Sprintf("in_test_%d", user.ID)
+	now := time.Now().Truncate(time.Second)
+
+	if fresh, err := InvoicesSyncedSince(ctx, user.ID, now.Add(-time.Hour)); err != nil || fresh {
+		t.Errorf("InvoicesSyncedSince before any sync = %v, %v, want false", fresh, err)
+	}
+	invoices := []StripeInvoice{
+		{ID: prefix + "_old", Status: "paid", Currency: "usd", AmountDue: 999, AmountPaid: 999, Total: 999, CreatedAt: now.AddDate(0, -1, 0)},
+		{ID: prefix + "_new", Status: "open", Currency: "usd", AmountDue: 2999, Total: 2999, InvoicePDF: "https://example.com/in.pdf", CreatedAt: now},
+	}
+	if err := UpsertStripeInvoices(ctx, user.ID, invoices); err != nil {
+		t.Fatalf("UpsertStripeInvoices: %v", err)
+	}
+	if err := MarkInvoicesSynced(ctx, user.ID); err != nil {
+		t.Fatalf("MarkInvoicesSynced: %v", err)
+	}
+	if fresh, err := InvoicesSyncedSince(ctx, user.ID, now.Add(-time.Hour)); err != nil || !fresh {
+		t.Errorf("InvoicesSyncedSince after a sync = %v, %v, want true", fresh, err)
+	}
+
+	// A webhook updates the cached copy of the open invoice
+	invoices[1].Status, invoices[1].AmountPaid = "paid", 2999
+	if err := UpsertStripeInvoices(ctx, user.ID, invoices[1:]); err != nil {
+		t.Fatalf("UpsertStripeInvoices: %v", err)
+	}
+	rows, total, err := GetUserInvoices(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("GetUserInvoices: %v", err)
+	}
+	if total != 2 || len(rows) != 2 || rows[0]["id"] != prefix+"_new" || rows[0]["status"] != "paid" || rows[0]["amount_paid"] != int64(2999) {
+		t.Errorf("GetUserInvoices = %v, %d, want the paid new invoice first of 2", rows, total)
+	}
+	if rows[1]["invoice_pdf"] != nil || rows[1]["period_start"] != nil {
+		t.Errorf("old invoice = %v, want no PDF link or period", rows[1])
+	}
+}
+
+func TestCoupons(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	admin := pgtest.CreateUser(t)
+	buyer := pgtest.CreateUser(t)
+	code := fmt.Sprintf("TEST%d", buyer.ID)
+	limit := 1
+
+	fields := CouponFields{Code: code, DiscountType: CouponPercent, DiscountValue: 20, AppliesTo: CouponAppliesAll, MaxRedemptions: &limit, MaxPerUser: 1, IsActive: true}
+	id, err := CreateCoupon(ctx, fields, admin.ID)
+	if err != nil {
+		t.Fatalf("CreateCoupon: %v", err)
+	}
+	if _, err := CreateCoupon(ctx, fields, admin.ID); err != ErrCouponExists {
+		t.Errorf("CreateCoupon with a taken code error = %v, want ErrCouponExists", err)
+	}
+	coupon, err := GetCouponByCode(ctx, strings.ToLower(code))
+	if err != nil || coupon["id"] != int32(id) {
+		t.Fatalf("GetCouponByCode = %v, %v, want coupon %d ignoring case", coupon, err, id)
+	}
+
+	// Redeeming the same payment twice counts once
+	for i := 0; i < 2; i++ {
+		if err := RedeemCoupon(ctx, id, buyer.ID, CouponAppliesPurchase, "pi_test_"+code, 200); err != nil {
+			t.Fatalf("RedeemCoupon: %v", err)
+		}
+	}
+	if used, err := CountUserRedemptions(ctx, id, buyer.ID); err != nil || used != 1 {
+		t.Errorf("CountUserRedemptions = %d, %v, want 1", used, err)
+	}
+	if coupon, _ = GetCoupon(ctx, id); coupon["redemptions_count"] != int32(1) {
+		t.Errorf("redemptions_count = %v, want 1", coupon["redemptions_count"])
+	}
+	if _, err := DeleteCoupon(ctx, id); err != ErrCouponRedeemed {
+		t.Errorf("DeleteCoupon of a redeemed coupon error = %v, want ErrCouponRedeemed", err)
+	}
+
+	// A new discount drops the Stripe coupon made for the old one
+	if err := SetStripeCoupon(ctx, id, "stripe_"+code); err != nil {
+		t.Fatalf("SetStripeCoupon: %v", err)
+	}
+	fields.IsActive = false
+	if _, err := UpdateCoupon(ctx, id, fields); err != nil {
+		t.Fatalf("UpdateCoupon: %v", err)
+	}
+	if coupon, _ = GetCoupon(ctx, id); coupon["stripe_coupon_id"] != "stripe_"+code || coupon["is_active"] != false {
+		t.Errorf("coupon after deactivating = %v, want the Stripe coupon kept", coupon)
+	}
+	fields.DiscountValue = 30
+	if _, err := UpdateCoupon(ctx, id, fields); err != nil {
+		t.Fatalf("UpdateCoupon: %v", err)
+	}
+	if coupon, _ = GetCoupon(ctx, id); coupon["stripe_coupon_id"] != nil {
+		t.Errorf("stripe_coupon_id after changing the discount = %v, want nil", coupon["stripe_coupon_id"])
+	}
+}
+
+func TestCouponPurchaseLimits(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	listingID := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+	limit := 1
+	couponID, err := CreateCoupon(ctx, CouponFields{Code: fmt.Sprintf("FREE%d", listingID), DiscountType: CouponPercent,
+		DiscountValue: 100, AppliesTo: CouponAppliesPurchase, MaxRedemptions: &limit, MaxPerUser: 1, IsActive: true}, publisher.ID)
+	if err != nil {
+		t.Fatalf("CreateCoupon: %v", err)
+	}
+
+	// Concurrent purchases with a single-use coupon grant one model
+	const buyers = 5
+	results := make(chan error, buyers)
+	for i := 0; i < buyers; i++ {
+		buyer := pgtest.CreateUser(t)
+		go func() {
+			_, err := RecordCouponPurchase(ctx, CouponPurchase{CouponID: couponID, Discount: 1000, BuyerID: buyer.ID,
+				PublishedModelID: listingID, PublisherID: publisher.ID, Reference: fmt.Sprintf("coupon-%d", buyer.ID)})
+			results <- err
+		}()
+	}
+	granted := 0
+	for i := 0; i < buyers; i++ {
+		switch err := <-results; err {
+		case nil:
+			granted++
+		case ErrCouponFullyRedeemed:
+		default:
+			t.Errorf("RecordCouponPurchase error = %v, want nil or ErrCouponFullyRedeemed", err)
+		}
+	}
+	if granted != 1 {
+		t.Errorf("single-use coupon granted %d purchases, want 1", granted)
+	}
+	if purchases, err := Query(ctx, `SELECT id FROM model_purchases WHERE published_model_id = $1`, listingID); err != nil || len(purchases) != 1 {
+		t.Errorf("model_purchases = %d, %v, want 1", len(purchases), err)
+	}
+
+	// Buying a model the user owns redeems nothing
+	unlimited, err := CreateCoupon(ctx, CouponFields{Code: fmt.Sprintf("MANY%d", listingID), DiscountType: CouponPercent,
+		DiscountValue: 100, AppliesTo: CouponAppliesPurchase, MaxPerUser: 5, IsActive: true}, publisher.ID)
+	if err != nil {
+		t.Fatalf("CreateCoupon: %v", err)
+	}
+	owner := pgtest.CreateUser(t)
+	purchase := CouponPurchase{CouponID: unlimited, BuyerID: owner.ID, PublishedModelID: listingID, PublisherID: publisher.ID}
+	for i, want := range []bool{true, false} {
+		purchase.Reference = fmt.Sprintf("coupon-owner-%d", i)
+		if ok, err := RecordCouponPurchase(ctx, purchase); err != nil || ok != want {
+			t.Errorf("RecordCouponPurchase #%d = %t, %v, want %t", i+1, ok, err, want)
+		}
+	}
+	if used, _ := CountUserRedemptions(ctx, unlimited, owner.ID); used != 1 {
+		t.Errorf("CountUserRedemptions = %d, want 1 for the purchase that granted the model", used)
+	}
+}
+
+func TestAppleAccounts(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+	sub := fmt.Sprintf("apple.%d", user.ID)
+
+	if _, err := GetUserByAppleSub(ctx, sub); err != pgx.ErrNoRows {
+		t.Errorf("GetUserByAppleSub before linking error = %v, want pgx.ErrNoRows", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := LinkAppleAccount(ctx, user.ID, sub); err != nil {
+			t.Fatalf("LinkAppleAccount: %v", err)
+		}
+	}
+	linked, err := GetUserByAppleSub(ctx, sub)
+	if err != nil || linked["id"] != int32(user.ID) || linked["email"] != user.Email {
+		t.Errorf("GetUserByAppleSub = %v, %v, want user %d", linked, err, user.ID)
+	}
+	if err := LinkAppleAccount(ctx, other.ID, sub); err != ErrAppleAccountLinked {
+		t.Errorf("LinkAppleAccount of a taken Apple ID error = %v, want ErrAppleAccountLinked", err)
+	}
+	if err := LinkAppleAccount(ctx, user.ID, sub+".other"); err != ErrAppleAccountLinked {
+		t.Errorf("LinkAppleAccount of a second Apple ID error = %v, want ErrAppleAccountLinked", err)
+	}
+}
+
+func TestDataExports(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+	to := time.Now()
+
+	id, err := CreateDataExport(ctx, owner.ID, DataExportTrainingRuns, "csv", to.AddDate(0, -3, 0), to, to.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateDataExport: %v", err)
+	}
+	if _, err := GetDataExport(ctx, id, other.ID); err != pgx.ErrNoRows {
+		t.Errorf("GetDataExport of another user error = %v, want pgx.ErrNoRows", err)
+	}
+	if err := CompleteDataExport(ctx, id, "1/1.csv", 3); err != nil {
+		t.Fatalf("CompleteDataExport: %v", err)
+	}
+	if export, err := GetDataExport(ctx, id, owner.ID); err != nil || export["status"] != DataExportReady {
+		t.Errorf("GetDataExport = %v, %v, want a ready export", export, err)
+	}
+
+	expired, err := CreateDataExport(ctx, owner.ID, DataExportPublisherAnalytics, "json", to.AddDate(0, -1, 0), to, to.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("CreateDataExport: %v", err)
+	}
+	if err := CompleteDataExport(ctx, expired, "1/2.json", 0); err != nil {
+		t.Fatalf("CompleteDataExport: %v", err)
+	}
+	if paths, err := DeleteExpiredDataExports(ctx); err != nil || len(paths) != 1 || paths[0] != "1/2.json" {
+		t.Errorf("DeleteExpiredDataExports = %v, %v, want the expired export's file", paths, err)
+	}
+	if exports, _ := GetDataExports(ctx, owner.ID); len(exports) != 1 {
+		t.Errorf("GetDataExports = %d exports, want 1", len(exports))
+	}
+}
+
+func TestModelUploads(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+	sum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	expiresAt := time.Now().Add(time.Hour)
+
+	if err := CreateModelUpload(ctx, "upload-1", owner.ID, "model.zip", 20, 8, 3, sum, expiresAt); err != nil {
+		t.Fatalf("CreateModelUpload: %v", err)
+	}
+	if _, err := GetModelUpload(ctx, "upload-1", other.ID); err != pgx.ErrNoRows {
+		t.Errorf("GetModelUpload of another user error = %v, want pgx.ErrNoRows", err)
+	}
+	for _, index := range []int{2, 0, 2} {
+		if err := RecordModelUploadChunk(ctx, "upload-1", index, 8, sum, expiresAt); err != nil {
+			t.Fatalf("RecordModelUploadChunk(%d): %v", index, err)
+		}
+	}
+	chunks, err := GetModelUploadChunks(ctx, "upload-1")
+	if err != nil || len(chunks) != 2 || chunks[0]["chunk_index"] != int32(0) {
+		t.Errorf("GetModelUploadChunks = %v, %v, want chunks 0 and 2", chunks, err)
+	}
+
+	if claimed, err := ClaimModelUpload(ctx, "upload-1", ModelUploadUploading, ModelUploadCompleting); err != nil || !claimed {
+		t.Fatalf("ClaimModelUpload = %v, %v, want true", claimed, err)
+	}
+	if claimed, _ := ClaimModelUpload(ctx, "upload-1", ModelUploadUploading, ModelUploadCompleting); claimed {
+		t.Error("ClaimModelUpload claimed an upload being completed")
+	}
+	if deleted, err := DeleteModelUpload(ctx, "upload-1", other.ID); err != nil || deleted != 0 {
+		t.Errorf("DeleteModelUpload of another user = %d, %v, want 0", deleted, err)
+	}
+
+	if err := CreateModelUpload(ctx, "upload-2", owner.ID, "old.zip", 20, 8, 3, sum, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("CreateModelUpload: %v", err)
+	}
+	if ids, err := DeleteExpiredModelUploads(ctx); err != nil || len(ids) != 1 || ids[0] != "upload-2" {
+		t.Errorf("DeleteExpiredModelUploads = %v, %v, want the expired upload", ids, err)
+	}
+}
+
+func TestTrainingRunSnapshots(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	member := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, owner.ID)
+
+	if err := RecordModelTrainingRun(ctx, modelID, member.ID, "run_a", "agent", "", nil); err != nil {
+		t.Fatalf("RecordModelTrainingRun: %v", err)
+	}
+	sum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	err := SetTrainingRunSnapshot(ctx, "run_a", map[string]string{"lr": "0.01"},
+		map[string]string{"train.py": "print(1)\n"}, map[string]string{"data.csv": sum}, sum)
+	if err != nil {
+		t.Fatalf("SetTrainingRunSnapshot: %v", err)
+	}
+
+	run, err := GetTrainingRunForDiff(ctx, "run_a", owner.ID)
+	if err != nil {
+		t.Fatalf("GetTrainingRunForDiff of the model owner: %v", err)
+	}
+	if params, _ := run["hyperparameters"].(map[string]interface{}); params["lr"] != "0.01" {
+		t.Errorf("hyperparameters = %v, want lr 0.01", run["hyperparameters"])
+	}
+	if run["dataset_hash"] != sum {
+		t.Errorf("dataset_hash = %v, want %s", run["dataset_hash"], sum)
+	}
+	if _, err := GetTrainingRunForDiff(ctx, "run_a", member.ID); err != nil {
+		t.Errorf("GetTrainingRunForDiff of the member who ran it: %v", err)
+	}
+	if _, err := GetTrainingRunForDiff(ctx, "run_a", other.ID); err != pgx.ErrNoRows {
+		t.Errorf("GetTrainingRunForDiff of another user error = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func TestTrainingApprovalUsedWhenRunRecorded(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	member := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, owner.ID)
+
+	requestID, err := CreateTrainingApprovalRequest(ctx, modelID, member.ID, "server", "one more run")
+	if err != nil {
+		t.Fatalf("CreateTrainingApprovalRequest: %v", err)
+	}
+	if err := DecideTrainingApprovalRequest(ctx, requestID, owner.ID, "approved"); err != nil {
+		t.Fatalf("DecideTrainingApprovalRequest: %v", err)
+	}
+
+	// Finding the approval for a start that then fails leaves it available
+	for i := 0; i < 2; i++ {
+		if approvalID, err := FindTrainingApproval(ctx, modelID, member.ID, "server"); err != nil || approvalID == nil || *approvalID != requestID {
+			t.Fatalf("FindTrainingApproval = %v, %v, want request %d", approvalID, err, requestID)
+		}
+	}
+
+	approvalID := requestID
+	if err := RecordModelTrainingRun(ctx, modelID, member.ID, "run_approved", "server", "", &approvalID); err != nil {
+		t.Fatalf("RecordModelTrainingRun: %v", err)
+	}
+	if approvalID, err := FindTrainingApproval(ctx, modelID, member.ID, "server"); err != nil || approvalID != nil {
+		t.Errorf("FindTrainingApproval after the run = %v, %v, want none", approvalID, err)
+	}
+	if request, err := GetTrainingApprovalRequest(ctx, requestID); err != nil || request["status"] != "used" {
+		t.Errorf("approval request = %v, %v, want status used", request, err)
+	}
+
+	// A concurrent start that found the same approval is recorded without it
+	if err := RecordModelTrainingRun(ctx, modelID, member.ID, "run_late", "server", "", &approvalID); err != nil {
+		t.Fatalf("RecordModelTrainingRun with a used approval: %v", err)
+	}
+	if runs, err := Query(ctx, "SELECT approval_request_id FROM model_training_runs WHERE approval_request_id = $1", requestID); err != nil || len(runs) != 1 {
+		t.Errorf("runs with the approval = %v, %v, want 1", runs, err)
+	}
+}
+
+func TestAdminReports(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	hour := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if err := AddRequestStats(ctx, hour, 50, 4, 1); err != nil {
+			t.Fatalf("AddRequestStats: %v", err)
+		}
+	}
+	stats, err := GetRequestStats(ctx, hour, hour.Add(time.Hour))
+	if err != nil || stats["requests"] != int64(100) || stats["server_errors"] != int64(2) {
+		t.Errorf("GetRequestStats = %v, %v, want 100 requests and 2 server errors", stats, err)
+	}
+
+	week := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	id, err := SaveAdminReport(ctx, AdminReportWeekly, week, week.AddDate(0, 0, 7), map[string]int{"new_users": 3})
+	if err != nil || id == 0 {
+		t.Fatalf("SaveAdminReport = %d, %v", id, err)
+	}
+	if again, err := SaveAdminReport(ctx, AdminReportWeekly, week, week.AddDate(0, 0, 7), map[string]int{}); err != nil || again != 0 {
+		t.Errorf("SaveAdminReport of a reported week = %d, %v, want 0", again, err)
+	}
+	if reports, err := GetAdminReports(ctx, AdminReportWeekly, 10); err != nil || len(reports) != 1 {
+		t.Errorf("GetAdminReports = %d reports, %v, want 1", len(reports), err)
+	}
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	admin := pgtest.CreateUser(t)
+	user := pgtest.CreateUser(t)
+
+	if found, err := SetUserRole(ctx, admin.ID, RoleAdmin); err != nil || !found {
+		t.Fatalf("SetUserRole = %v, %v", found, err)
+	}
+	if isAdmin, err := IsAdmin(ctx, admin.ID); err != nil || !isAdmin {
+		t.Errorf("IsAdmin = %v, %v, want true", isAdmin, err)
+	}
+
+	pgtest.CreateSession(t, user, time.Hour)
+	if _, err := SuspendUser(ctx, user.ID, admin.ID, "spam"); err != nil {
+		t.Fatalf("SuspendUser: %v", err)
+	}
+	if suspended, err := IsUserSuspended(ctx, user.ID); err != nil || !suspended {
+		t.Errorf("IsUserSuspended = %v, %v, want true", suspended, err)
+	}
+	if id, err := GetUserIDByReadAPIKey(ctx, user.APIKey); err != nil || id != 0 {
+		t.Errorf("GetUserIDByReadAPIKey of a suspended user = %d, %v, want 0", id, err)
+	}
+	if lifted, err := UnsuspendUser(ctx, user.ID); err != nil || !lifted {
+		t.Errorf("UnsuspendUser = %v, %v, want true", lifted, err)
+	}
+
+	if balance, err := AdjustTrainingCredits(ctx, user.ID, admin.ID, 5, "goodwill"); err != nil || balance != 5 {
+		t.Fatalf("AdjustTrainingCredits = %d, %v, want 5", balance, err)
+	}
+	if _, err := AdjustTrainingCredits(ctx, user.ID, admin.ID, -6, "too many"); !errors.Is(err, ErrInsufficientCredits) {
+		t.Errorf("AdjustTrainingCredits below zero = %v, want ErrInsufficientCredits", err)
+	}
+	if adjustments, err := GetCreditAdjustments(ctx, user.ID); err != nil || len(adjustments) != 1 {
+		t.Errorf("GetCreditAdjustments = %d adjustments, %v, want 1", len(adjustments), err)
+	}
+}
+
+func TestRotateSession(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	if _, err := InsertSession(ctx, user.ID, user.Email, "first-token", expiresAt); err != nil {
+		t.Fatalf("InsertSession: %v", err)
+	}
+	session, err := RotateSession(ctx, "first-token", "second-token", expiresAt)
+	if err != nil || session == nil || session["user_id"] != user.ID {
+		t.Fatalf("RotateSession = %v, %v, want the user's session", session, err)
+	}
+	if old, _ := GetSessionByRefreshToken(ctx, "first-token"); old != nil {
+		t.Error("GetSessionByRefreshToken accepted a rotated token")
+	}
+	if session, err := RotateSession(ctx, "unknown-token", "other-token", expiresAt); err != nil || session != nil {
+		t.Errorf("RotateSession of unknown token = %v, %v, want nil, nil", session, err)
+	}
+
+	if _, err := RotateSession(ctx, "first-token", "third-token", expiresAt); err != ErrRefreshTokenReused {
+		t.Fatalf("RotateSession of a rotated token error = %v, want ErrRefreshTokenReused", err)
+	}
+	if current, _ := GetSessionByRefreshToken(ctx, "second-token"); current != nil {
+		t.Error("reusing a rotated token did not revoke the session family")
+	}
+
+	if _, err := InsertSession(ctx, user.ID, user.Email, "logout-token", expiresAt); err != nil {
+		t.Fatalf("InsertSession: %v", err)
+	}
+	if deleted, err := DeleteSession(ctx, "logout-token"); err != nil || !deleted {
+		t.Errorf("DeleteSession = %v, %v, want true", deleted, err)
+	}
+}
+
+func TestUserSessions(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	laptop, err := StartSession(ctx, user.ID, user.Email, "laptop-token", expiresAt, "Laptop Browser", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	phone, err := StartSession(ctx, user.ID, user.Email, "phone-token", expiresAt, "Phone App", "")
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	session, err := RotateSession(ctx, "laptop-token", "laptop-token-2", expiresAt)
+	if err != nil || session["family_id"] != laptop {
+		t.Fatalf("RotateSession = %v, %v, want the laptop session", session, err)
+	}
+
+	sessions, err := GetUserSessions(ctx, user.ID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("GetUserSessions = %d sessions, %v, want 2", len(sessions), err)
+	}
+	if sessions[0]["id"] != laptop || sessions[0]["user_agent"] != "Laptop Browser" || sessions[0]["ip_address"] != "192.0.2.1" {
+		t.Errorf("most recent session = %v, want the refreshed laptop session", sessions[0])
+	}
+	if active, err := IsSessionActive(ctx, other.ID, laptop); err != nil || active {
+		t.Errorf("IsSessionActive of another user = %v, %v, want false", active, err)
+	}
+
+	if revoked, err := RevokeUserSession(ctx, other.ID, laptop); err != nil || revoked {
+		t.Errorf("RevokeUserSession of another user = %v, %v, want false", revoked, err)
+	}
+	if revoked, err := RevokeUserSession(ctx, user.ID, laptop); err != nil || !revoked {
+		t.Fatalf("RevokeUserSession = %v, %v, want true", revoked, err)
+	}
+	if active, err := IsSessionActive(ctx, user.ID, laptop); err != nil || active {
+		t.Errorf("IsSessionActive of a revoked session = %v, %v, want false", active, err)
+	}
+	if session, _ := RotateSession(ctx, "laptop-token-2", "laptop-token-3", expiresAt); session != nil {
+		t.Error("RotateSession accepted the token of a revoked session")
+	}
+
+	if _, err := StartSession(ctx, user.ID, user.Email, "tablet-token", expiresAt, "", ""); err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	if revoked, err := RevokeUserSessions(ctx, user.ID, phone); err != nil || revoked != 1 {
+		t.Errorf("RevokeUserSessions keeping the phone = %d, %v, want 1", revoked, err)
+	}
+	if active, err := IsSessionActive(ctx, user.ID, phone); err != nil || !active {
+		t.Errorf("IsSessionActive of the kept session = %v, %v, want true", active, err)
+	}
+	if revoked, err := RevokeUserSessions(ctx, user.ID, ""); err != nil || revoked != 1 {
+		t.Errorf("RevokeUserSessions = %d, %v, want 1", revoked, err)
+	}
+}
+
+func TestModelVersions(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+
+	id, err := InsertModel(ctx, owner.ID, "versioned", "./uploads/versioned.png", []string{"./uploads/versioned"}, "")
+	if err != nil {
+		t.Fatalf("InsertModel: %v", err)
+	}
+	first, second := 0.81, 0.74
+	created, err := CreateModelVersions(ctx, "versioned", NewModelVersion{TrainingID: "run-1", AccuracyScore: &first})
+	if err != nil || len(created) != 1 || created[0]["version"] != 1 {
+		t.Fatalf("CreateModelVersions = %v, %v, want version 1", created, err)
+	}
+	if err := SetModelVersionArtifact(ctx, created[0]["id"].(int), "model_versions/1/1/model.pkl", 10, "abc"); err != nil {
+		t.Fatalf("SetModelVersionArtifact: %v", err)
+	}
+	if created, err := CreateModelVersions(ctx, "versioned", NewModelVersion{TrainingID: "run-2", AccuracyScore: &second}); err != nil || len(created) != 1 || created[0]["version"] != 2 {
+		t.Fatalf("CreateModelVersions = %v, %v, want version 2", created, err)
+	}
+
+	versions, err := GetModelVersions(ctx, id)
+	if err != nil || len(versions) != 2 || versions[0]["version"] != int32(2) || versions[0]["is_active"] != true {
+		t.Fatalf("GetModelVersions = %v, %v, want version 2 active first", versions, err)
+	}
+	if err := ActivateModelVersion(ctx, id, 2); err != ErrModelVersionNoArtifact {
+		t.Errorf("ActivateModelVersion without artifact error = %v, want ErrModelVersionNoArtifact", err)
+	}
+
+	previous, err := GetRollbackModelVersion(ctx, id)
+	if err != nil || previous["version"] != int32(1) {
+		t.Fatalf("GetRollbackModelVersion = %v, %v, want version 1", previous, err)
+	}
+	if err := ActivateModelVersion(ctx, id, 1); err != nil {
+		t.Fatalf("ActivateModelVersion: %v", err)
+	}
+	model, err := GetModelByID(ctx, id)
+	if err != nil || (*model)["trained_model_path"] != "model_versions/1/1/model.pkl" {
+		t.Errorf("GetModelByID = %v, %v, want the rolled back version's trained model", model, err)
+	}
+	if _, err := GetRollbackModelVersion(ctx, id); err != pgx.ErrNoRows {
+		t.Errorf("GetRollbackModelVersion of the first version error = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func TestFinalizeTrainingRunCredits(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, owner.ID)
+	if _, err := Exec(ctx, `UPDATE users SET training_credits = 10 WHERE id = $1`, owner.ID); err != nil {
+		t.Fatalf("set credits: %v", err)
+	}
+	for _, id := range []string{"credits_a", "credits_b"} {
+		if err := RecordModelTrainingRun(ctx, modelID, owner.ID, id, "server", "preemptible", nil); err != nil {
+			t.Fatalf("RecordModelTrainingRun: %v", err)
+		}
+	}
+
+	// Two half credit runs take one whole credit between them
+	if charged, err := FinalizeTrainingRunCredits(ctx, "credits_a", "cpu", 30*time.Minute, 0.5, true); err != nil || charged != 1 {
+		t.Errorf("FinalizeTrainingRunCredits(a) = %d, %v, want 1", charged, err)
+	}
+	if charged, err := FinalizeTrainingRunCredits(ctx, "credits_b", "cpu", 30*time.Minute, 0.5, true); err != nil || charged != 0 {
+		t.Errorf("FinalizeTrainingRunCredits(b) = %d, %v, want 0", charged, err)
+	}
+	if charged, err := FinalizeTrainingRunCredits(ctx, "credits_a", "cpu", 30*time.Minute, 0.5, true); err != nil || charged != 0 {
+		t.Errorf("FinalizeTrainingRunCredits(a) again = %d, %v, want 0", charged, err)
+	}
+	if _, err := FinalizeTrainingRunCredits(ctx, "credits_unknown", "cpu", time.Minute, 1, true); err != pgx.ErrNoRows {
+		t.Errorf("FinalizeTrainingRunCredits(unknown) error = %v, want pgx.ErrNoRows", err)
+	}
+
+	if user, err := GetUserByEmail(ctx, owner.Email); err != nil || (*user)["training_credits"] != int32(9) {
+		t.Errorf("training_credits after metering = %v, %v, want 9", user, err)
+	}
+	if seconds, ok, err := GetAverageTrainingRunSeconds(ctx, modelID); err != nil || !ok || seconds != 1800 {
+		t.Errorf("GetAverageTrainingRunSeconds = %v, %v, %v, want 1800", seconds, ok, err)
+	}
+}
+
+func TestCreditReservations(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, owner.ID)
+	if _, err := Exec(ctx, `UPDATE users SET training_credits = 5 WHERE id = $1`, owner.ID); err != nil {
+		t.Fatalf("set credits: %v", err)
+	}
+
+	reservationID, err := ReserveTrainingCredits(ctx, owner.ID, 3, "test")
+	if err != nil {
+		t.Fatalf("ReserveTrainingCredits: %v", err)
+	}
+	if _, err := ReserveTrainingCredits(ctx, owner.ID, 3, "test"); !errors.Is(err, ErrInsufficientCredits) {
+		t.Errorf("ReserveTrainingCredits beyond the balance = %v, want ErrInsufficientCredits", err)
+	}
+
+	// The training used 2 of the 3 reserved credits, the third is refunded
+	if err := AttachCreditReservation(ctx, reservationID, "reserved_a"); err != nil {
+		t.Fatalf("AttachCreditReservation: %v", err)
+	}
+	if err := RecordModelTrainingRun(ctx, modelID, owner.ID, "reserved_a", "server", "on_demand", nil); err != nil {
+		t.Fatalf("RecordModelTrainingRun: %v", err)
+	}
+	if charged, err := FinalizeTrainingRunCredits(ctx, "reserved_a", "cpu", time.Hour, 1.5, true); err != nil || charged != 2 {
+		t.Errorf("FinalizeTrainingRunCredits = %d, %v, want 2", charged, err)
+	}
+
+	// A training that did not start gets its reservation back
+	reservationID, err = ReserveTrainingCredits(ctx, owner.ID, 1, "test")
+	if err != nil {
+		t.Fatalf("ReserveTrainingCredits: %v", err)
+	}
+	if err := RefundCreditReservation(ctx, reservationID, "did not start"); err != nil {
+		t.Fatalf("RefundCreditReservation: %v", err)
+	}
+
+	transactions, total, err := GetCreditTransactions(ctx, owner.ID, 10, 0)
+	if err != nil || total != 4 || transactions[0]["balance_after"] != int32(3) {
+		t.Errorf("GetCreditTransactions = %v, %d, %v, want 4 ending with a balance of 3", transactions, total, err)
+	}
+	if usage, err := GetMonthlyCreditUsage(ctx, owner.ID, 1); err != nil || len(usage) != 1 || usage[0]["consumed"] != int32(2) {
+		t.Errorf("GetMonthlyCreditUsage = %v, %v, want 2 credits consumed", usage, err)
+	}
+}
+
+func TestCreditResets(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+	now := time.Now().UTC()
+	if _, err := Exec(ctx, `
+		UPDATE users SET subscription_tier = 'pro', subscription_status = 'active', training_credits = 7,
+			subscription_start_date = $2, next_credit_reset_at = $3
+		WHERE id = $1
+	`, user.ID, now.AddDate(0, -1, -1), now.Add(-time.Hour)); err != nil {
+		t.Fatalf("set subscription: %v", err)
+	}
+
+	due, err := GetDueCreditResets(ctx, now)
+	if err != nil || !slices.Contains(due, user.Email) {
+		t.Fatalf("GetDueCreditResets = %v, %v, want %s", due, err, user.Email)
+	}
+
+	if plan, err := ResetSubscriptionCredits(ctx, user.Email, func(SubscriptionCredits) *CreditResetPlan { return nil }); err != nil || plan != nil {
+		t.Errorf("ResetSubscriptionCredits with no plan = %v, %v, want nothing", plan, err)
+	}
+
+	next := now.AddDate(0, 1, 0)
+	if _, err := ResetSubscriptionCredits(ctx, user.Email, func(current SubscriptionCredits) *CreditResetPlan {
+		if current.Tier != "pro" || current.Credits != 7 {
+			t.Errorf("current subscription = %+v, want pro with 7 credits", current)
+		}
+		return &CreditResetPlan{Reason: CreditResetAnniversary, Tier: current.Tier, Credits: 50, NextResetAt: &next}
+	}); err != nil {
+		t.Fatalf("ResetSubscriptionCredits: %v", err)
+	}
+
+	if due, err := GetDueCreditResets(ctx, now); err != nil || slices.Contains(due, user.Email) {
+		t.Errorf("GetDueCreditResets after the reset = %v, %v, want %s no longer due", due, err, user.Email)
+	}
+	resets, err := GetCreditResets(ctx, user.ID, 10)
+	if err != nil || len(resets) != 1 || resets[0]["previous_credits"] != int32(7) || resets[0]["credits"] != int32(50) {
+		t.Errorf("GetCreditResets = %v, %v, want one reset from 7 to 50 credits", resets, err)
+	}
+	transactions, total, err := GetCreditTransactions(ctx, user.ID, 10, 0)
+	if err != nil || total != 1 || transactions[0]["kind"] != CreditReset || transactions[0]["amount"] != int32(43) {
+		t.Errorf("GetCreditTransactions = %v, %d, %v, want one reset of 43 credits", transactions, total, err)
+	}
+}
+
+func TestDatasetSummaries(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	owner := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, owner.ID)
+
+	if _, err := GetDatasetSummary(ctx, modelID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("GetDatasetSummary before inspection = %v, want pgx.ErrNoRows", err)
+	}
+
+	modifiedAt := time.Now().UTC().Truncate(time.Microsecond)
+	for _, samples := range []int{10, 12} {
+		if err := SaveDatasetSummary(ctx, modelID, modifiedAt, map[string]interface{}{"type": "csv", "samples": samples}); err != nil {
+			t.Fatalf("SaveDatasetSummary: %v", err)
+		}
+	}
+	stored, err := GetDatasetSummary(ctx, modelID)
+	if err != nil || !strings.Contains(stored["summary"].(string), `"samples": 12`) || !stored["folder_modified_at"].(time.Time).Equal(modifiedAt) {
+		t.Errorf("GetDatasetSummary = %v, %v, want the latest summary of 12 samples", stored, err)
+	}
+}
+
+func TestNamedAPIKeys(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+
+	if _, err := CreateAPIKey(ctx, user.ID, "ci", HashAPIKey("sk_key_ci"), "sk_key_ci", []string{"agent-connect"}, nil); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	expired := time.Now().Add(-time.Hour)
+	if _, err := CreateAPIKey(ctx, user.ID, "old", HashAPIKey("sk_key_old"), "sk_key_old", []string{"read-models"}, &expired); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if _, err := CreateAPIKey(ctx, user.ID, "bad", HashAPIKey("sk_key_bad"), "sk_key_bad", []string{"admin"}, nil); err == nil {
+		t.Error("CreateAPIKey with an unknown scope succeeded")
+	}
+
+	found, err := GetUserByApiKey(ctx, "sk_key_ci")
+	if err != nil || found == nil || (*found)["id"] != user.ID {
+		t.Fatalf("GetUserByApiKey = %v, %v, want user %d", found, err, user.ID)
+	}
+	if scopes := (*found)["scopes"]; !slices.Equal(scopes.([]string), []string{"agent-connect"}) {
+		t.Errorf("GetUserByApiKey scopes = %v, want [agent-connect]", scopes)
+	}
+	if legacy, err := GetUserByApiKey(ctx, user.APIKey); err != nil || legacy == nil || (*legacy)["scopes"] != nil {
+		t.Errorf("GetUserByApiKey of the account key = %v, %v, want no scopes", legacy, err)
+	}
+	if expiredUser, err := GetUserByApiKey(ctx, "sk_key_old"); err != nil || expiredUser != nil {
+		t.Errorf("GetUserByApiKey of an expired key = %v, %v, want nil", expiredUser, err)
+	}
+	prefix, err := QueryRow(ctx, `SELECT api_key, api_key_prefix FROM users WHERE id = $1`, user.ID)
+	if err != nil || prefix["api_key"] != nil || prefix["api_key_prefix"] != APIKeyPrefix(user.APIKey) {
+		t.Errorf("account key after its first use = %v, %v, want it rehashed", prefix, err)
+	}
+	if id, err := GetUserIDByReadAPIKey(ctx, user.APIKey); err != nil || id != user.ID {
+		t.Errorf("GetUserIDByReadAPIKey of the rehashed account key = %d, %v, want %d", id, err, user.ID)
+	}
+	if id, err := GetUserIDByReadAPIKey(ctx, "sk_key_ci"); err != nil || id != 0 {
+		t.Errorf("GetUserIDByReadAPIKey without read-models = %d, %v, want 0", id, err)
+	}
+
+	keys, err := GetAPIKeys(ctx, user.ID)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("GetAPIKeys = %v, %v, want 2 keys", keys, err)
+	}
+	var ciID int
+	for _, key := range keys {
+		if key["name"] == "ci" {
+			ciID = int(key["id"].(int32))
+			if key["last_used_at"] == nil {
+				t.Error("GetUserByApiKey did not record that the key was used")
+			}
+		}
+	}
+	if revoked, err := RevokeAPIKey(ctx, ciID, user.ID); err != nil || !revoked {
+		t.Fatalf("RevokeAPIKey = %v, %v, want true", revoked, err)
+	}
+	if revokedUser, err := GetUserByApiKey(ctx, "sk_key_ci"); err != nil || revokedUser != nil {
+		t.Errorf("GetUserByApiKey of a revoked key = %v, %v, want nil", revokedUser, err)
+	}
+}
+
+func TestInterruptedTrainings(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, user.ID)
+
+	if err := RecordModelTrainingRun(ctx, modelID, user.ID, "run-interrupted", "server", "on_demand", nil); err != nil {
+		t.Fatalf("RecordModelTrainingRun: %v", err)
+	}
+	if err := RecordInterruptedTraining(ctx, "run-interrupted", user.ID, []byte(`{"script_name":"train.py"}`), "checkpoints/epoch_3.pt", 120); err != nil {
+		t.Fatalf("RecordInterruptedTraining: %v", err)
+	}
+
+	trainings, err := GetInterruptedTrainings(ctx, user.ID)
+	if err != nil || len(trainings) != 1 || trainings[0]["model_id"] != int32(modelID) {
+		t.Fatalf("GetInterruptedTrainings = %v, %v, want the run of model %d", trainings, err, modelID)
+	}
+
+	claimed, err := ClaimInterruptedTraining(ctx, "run-interrupted", user.ID)
+	if err != nil || claimed["checkpoint_path"] != "checkpoints/epoch_3.pt" {
+		t.Fatalf("ClaimInterruptedTraining = %v, %v", claimed, err)
+	}
+	if _, err := ClaimInterruptedTraining(ctx, "run-interrupted", user.ID); err != pgx.ErrNoRows {
+		t.Errorf("second ClaimInterruptedTraining error = %v, want pgx.ErrNoRows", err)
+	}
+	if err := ReleaseInterruptedTraining(ctx, "run-interrupted"); err != nil {
+		t.Fatalf("ReleaseInterruptedTraining: %v", err)
+	}
+	if _, err := ClaimInterruptedTraining(ctx, "run-interrupted", user.ID); err != nil {
+		t.Fatalf("ClaimInterruptedTraining after release: %v", err)
+	}
+	if err := SetInterruptedTrainingResumedAs(ctx, "run-interrupted", "run-resumed"); err != nil {
+		t.Fatalf("SetInterruptedTrainingResumedAs: %v", err)
+	}
+	if trainings, err := GetInterruptedTrainings(ctx, user.ID); err != nil || len(trainings) != 0 {
+		t.Errorf("GetInterruptedTrainings after resuming = %v, %v, want none", trainings, err)
+	}
+}
+
+func TestTrainingCheckpoints(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	user := pgtest.CreateUser(t)
+	other := pgtest.CreateUser(t)
+	modelID := pgtest.CreateModel(t, user.ID)
+
+	if err := RecordModelTrainingRun(ctx, modelID, user.ID, "run-failed", "server", "on_demand", nil); err != nil {
+		t.Fatalf("RecordModelTrainingRun: %v", err)
+	}
+	if err := SetTrainingRunRequest(ctx, "run-failed", []byte(`{"script_name":"train.py"}`)); err != nil {
+		t.Fatalf("SetTrainingRunRequest: %v", err)
+	}
+	run, err := GetTrainingRunRequest(ctx, "run-failed", user.ID)
+	if err != nil || run["model_id"] != int32(modelID) || run["request"] == nil {
+		t.Fatalf("GetTrainingRunRequest = %v, %v, want the run of model %d with its request", run, err, modelID)
+	}
+	if _, err := GetTrainingRunRequest(ctx, "run-failed", other.ID); err != pgx.ErrNoRows {
+		t.Errorf("GetTrainingRunRequest of another user error = %v, want pgx.ErrNoRows", err)
+	}
+
+	for epoch, path := range []string{"checkpoints/epoch_1.pt", "checkpoints/epoch_2.pt"} {
+		if err := RecordTrainingCheckpoint(ctx, "run-failed", path, epoch+1, false, 1024); err != nil {
+			t.Fatalf("RecordTrainingCheckpoint(%s): %v", path, err)
+		}
+	}
+	// Saving a checkpoint again updates it
+	if err := RecordTrainingCheckpoint(ctx, "run-failed", "checkpoints/epoch_2.pt", 2, true, 2048); err != nil {
+		t.Fatalf("RecordTrainingCheckpoint again: %v", err)
+	}
+	if err := DeleteTrainingCheckpoint(ctx, "run-failed", "checkpoints/epoch_1.pt"); err != nil {
+		t.Fatalf("DeleteTrainingCheckpoint: %v", err)
+	}
+
+	checkpoints, err := GetTrainingCheckpoints(ctx, "run-failed")
+	if err != nil || len(checkpoints) != 1 {
+		t.Fatalf("GetTrainingCheckpoints = %v, %v, want 1 checkpoint", checkpoints, err)
+	}
+	if checkpoints[0]["path"] != "checkpoints/epoch_2.pt" || checkpoints[0]["is_best"] != true || checkpoints[0]["size_bytes"] != int64(2048) {
+		t.Errorf("checkpoint = %v, want epoch_2.pt, best, 2048 bytes", checkpoints[0])
+	}
+}
+
+func TestPrivateListingVisibleWhileRented(t *testing.T) {
+	pgtest.Require(t)
+	ctx := context.Background()
+	publisher := pgtest.CreateUser(t)
+	renter := pgtest.CreateUser(t)
+	listingID := pgtest.CreatePublishedModel(t, pgtest.CreateModel(t, publisher.ID), publisher.ID)
+
+	if _, err := RecordModelRental(ctx, renter.ID, listingID, publisher.ID, 500, 7, "stripe", "pi_rental"); err != nil {
+		t.Fatalf("RecordModelRental: %v", err)
+	}
+	if err := SetListingVisibility(ctx, listingID, ListingVisibilityPrivate, nil); err != nil {
+		t.Fatalf("SetListingVisibility: %v", err)
+	}
+	if ok, _ := CanViewListing(ctx, listingID, renter.ID); !ok {
+		t.Error("CanViewListing hid a private listing from a user renting it")
+	}
+
+	if _, err := Exec(ctx, `UPDATE model_purchases SET expires_at = CURRENT_TIMESTAMP - INTERVAL '1 day' WHERE buyer_id = $1`, renter.ID); err != nil {
+		t.Fatalf("failed to expire rental: %v", err)
+	}
+	if ok, _ := CanViewListing(ctx, listingID, renter.ID); ok {
+		t.Error("CanViewListing showed a private listing to a user whose rental expired")
+	}
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// Statuses of chunked model uploads
+const (
+	ModelUploadUploading  = "uploading"
+	ModelUploadCompleting = "completing"
+	ModelUploadCompleted  = "completed"
+)
+
+// CreateModelUpload starts a chunked upload of a model zip
+func CreateModelUpload(ctx context.Context, uploadID string, userID int, filename string, size int64, chunkSize, totalChunks int, sha256 string, expiresAt time.Time) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO model_uploads (id, user_id, filename, size_bytes, chunk_size, total_chunks, sha256, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, uploadID, userID, filename, size, chunkSize, totalChunks, sha256, expiresAt); err != nil {
+		return fmt.Errorf("failed to create model upload: %w", err)
+	}
+	return nil
+}
+
+// GetModelUpload returns one of the user's uploads that has not expired, or pgx.ErrNoRows
+func GetModelUpload(ctx context.Context, uploadID string, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, filename, size_bytes, chunk_size, total_chunks, sha256, status, model_id,
+			created_at, updated_at, expires_at
+		FROM model_uploads
+		WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+	`, uploadID, userID)
+}
+
+// GetModelUploadChunks returns the chunks received for an upload, by index
+func GetModelUploadChunks(ctx context.Context, uploadID string) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT chunk_index, size_bytes, sha256, received_at
+		FROM model_upload_chunks
+		WHERE upload_id = $1
+		ORDER BY chunk_index
+	`, uploadID)
+}
+
+// RecordModelUploadChunk records a received chunk, replacing an earlier copy, and keeps the
+// upload alive until expiresAt
+func RecordModelUploadChunk(ctx context.Context, uploadID string, index, size int, sha256 string, expiresAt time.Time) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO model_upload_chunks (upload_id, chunk_index, size_bytes, sha256)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (upload_id, chunk_index) DO UPDATE
+		SET size_bytes = EXCLUDED.size_bytes, sha256 = EXCLUDED.sha256, received_at = CURRENT_TIMESTAMP
+	`, uploadID, index, size, sha256); err != nil {
+		return fmt.Errorf("failed to record upload chunk: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE model_uploads SET updated_at = CURRENT_TIMESTAMP, expires_at = $2 WHERE id = $1
+	`, uploadID, expiresAt); err != nil {
+		return fmt.Errorf("failed to extend model upload: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ClaimModelUpload moves an upload from one status to another and reports whether it was in
+// the from status, so only one request completes an upload
+func ClaimModelUpload(ctx context.Context, uploadID, from, to string) (bool, error) {
+	count, err := Exec(ctx, `
+		UPDATE model_uploads SET status = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $2
+	`, uploadID, from, to)
+	if err != nil {
+		return false, fmt.Errorf("failed to update model upload: %w", err)
+	}
+	return count > 0, nil
+}
+
+// CompleteModelUpload marks an upload completed into a model
+func CompleteModelUpload(ctx context.Context, uploadID string, modelID int) error {
+	if _, err := Exec(ctx, `
+		UPDATE model_uploads SET status = 'completed', model_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, uploadID, modelID); err != nil {
+		return fmt.Errorf("failed to complete model upload: %w", err)
+	}
+	return nil
+}
+
+// DeleteModelUpload deletes one of the user's uploads and its chunk records
+func DeleteModelUpload(ctx context.Context, uploadID string, userID int) (int64, error) {
+	count, err := Exec(ctx, `DELETE FROM model_uploads WHERE id = $1 AND user_id = $2`, uploadID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete model upload: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteExpiredModelUploads deletes expired uploads and returns their IDs, whose chunk folders
+// are left behind
+func DeleteExpiredModelUploads(ctx context.Context) ([]string, error) {
+	rows, err := Query(ctx, `DELETE FROM model_uploads WHERE expires_at <= NOW() RETURNING id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired model uploads: %w", err)
+	}
+	var ids []string
+	for _, row := range rows {
+		if id, ok := row["id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// ErrModelVersionNoArtifact is returned when activating a version whose trained model was never
+// copied to the server
+var ErrModelVersionNoArtifact = errors.New("this version has no trained model on the server")
+
+// NewModelVersion is a completed training to record as a version of its model
+type NewModelVersion struct {
+	TrainingID         string
+	SourcePath         string
+	AccuracyScore      *float64
+	PrimaryMetric      string
+	PrimaryMetricValue *float64
+	Metrics            map[string]interface{}
+}
+
+// CreateModelVersions records a completed training as the new active version of the models named
+// modelName, like the trained model path updates do. It returns the id, model_id and version of
+// each created version.
+func CreateModelVersions(ctx context.Context, modelName string, v NewModelVersion) ([]map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE model_versions SET is_active = false
+		WHERE is_active AND model_id IN (SELECT id FROM models WHERE name = $1)
+	`, modelName); err != nil {
+		return nil, fmt.Errorf("failed to deactivate model versions: %w", err)
+	}
+
+	metrics := v.Metrics
+	if metrics == nil {
+		metrics = map[string]interface{}{}
+	}
+	rows, err := tx.Query(ctx, `
+		INSERT INTO model_versions (model_id, version, training_id, source_path, accuracy_score, primary_metric,
+			primary_metric_value, metrics, is_active, activated_at)
+		SELECT m.id, COALESCE((SELECT MAX(v.version) FROM model_versions v WHERE v.model_id = m.id), 0) + 1,
+			NULLIF($2, ''), NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7, true, NOW()
+		FROM models m
+		WHERE m.name = $1
+		RETURNING id, model_id, version
+	`, modelName, v.TrainingID, v.SourcePath, v.AccuracyScore, v.PrimaryMetric, v.PrimaryMetricValue, metrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create model versions: %w", err)
+	}
+	var created []map[string]interface{}
+	for rows.Next() {
+		var id, modelID, version int
+		if err := rows.Scan(&id, &modelID, &version); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan model version: %w", err)
+		}
+		created = append(created, map[string]interface{}{"id": id, "model_id": modelID, "version": version})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to create model versions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return created, nil
+}
+
+// SetModelVersionArtifact stores where the copy of a version's trained model was saved
+func SetModelVersionArtifact(ctx context.Context, versionID int, artifactPath string, size int64, sha256 string) error {
+	if _, err := Exec(ctx, `
+		UPDATE model_versions SET artifact_path = $2, file_size = $3, artifact_sha256 = $4 WHERE id = $1
+	`, versionID, artifactPath, size, sha256); err != nil {
+		return fmt.Errorf("failed to set model version artifact: %w", err)
+	}
+	return nil
+}
+
+// GetModelVersions lists the versions of a model, newest first
+func GetModelVersions(ctx context.Context, modelID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, version, training_id, artifact_path IS NOT NULL AS downloadable, file_size, artifact_sha256,
+			accuracy_score, primary_metric, primary_metric_value, metrics, is_active, activated_at, created_at
+		FROM model_versions
+		WHERE model_id = $1
+		ORDER BY version DESC
+	`, modelID)
+}
+
+// GetModelVersion returns one version of a model, or pgx.ErrNoRows
+func GetModelVersion(ctx context.Context, modelID, version int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, version, training_id, source_path, artifact_path, file_size, artifact_sha256, accuracy_score,
+			primary_metric, primary_metric_value, metrics, is_active, activated_at, created_at
+		FROM model_versions
+		WHERE model_id = $1 AND version = $2
+	`, modelID, version)
+}
+
+// GetRollbackModelVersion returns the newest version older than the active one that can be
+// activated, or pgx.ErrNoRows
+func GetRollbackModelVersion(ctx context.Context, modelID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT version
+		FROM model_versions
+		WHERE model_id = $1 AND artifact_path IS NOT NULL
+			AND version < COALESCE((SELECT version FROM model_versions WHERE model_id = $1 AND is_active), 2147483647)
+		ORDER BY version DESC
+		LIMIT 1
+	`, modelID)
+}
+
+// ActivateModelVersion makes a version the model's trained model: its copy becomes the model's
+// trained_model_path and its accuracy and primary metric the model's. Returns pgx.ErrNoRows for an
+// unknown version and ErrModelVersionNoArtifact for one without a copy on the server.
+func ActivateModelVersion(ctx context.Context, modelID, version int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var artifactPath *string
+	if err := tx.QueryRow(ctx, `
+		SELECT artifact_path FROM model_versions WHERE model_id = $1 AND version = $2 FOR UPDATE
+	`, modelID, version).Scan(&artifactPath); err != nil {
+		return err
+	}
+	if artifactPath == nil {
+		return ErrModelVersionNoArtifact
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE model_versions SET is_active = false WHERE model_id = $1 AND is_active
+	`, modelID); err != nil {
+		return fmt.Errorf("failed to deactivate model versions: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE model_versions SET is_active = true, activated_at = NOW() WHERE model_id = $1 AND version = $2
+	`, modelID, version); err != nil {
+		return fmt.Errorf("failed to activate model version: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE models m
+		SET trained_model_path = v.artifact_path, accuracy_score = v.accuracy_score,
+			primary_metric_value = v.primary_metric_value, updated_at = NOW()
+		FROM model_versions v
+		WHERE m.id = $1 AND v.model_id = m.id AND v.version = $2
+	`, modelID, version); err != nil {
+		return fmt.Errorf("failed to update model: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"server/internal/models"
+)
+
+// Moderation states of a published model
+const (
+	ModerationActive  = "active"
+	ModerationRemoved = "removed"
+)
+
+// Statuses of a listing appeal
+const (
+	AppealPending    = "pending"
+	AppealUpheld     = "upheld"
+	AppealReinstated = "reinstated"
+)
+
+// ErrAppealPending is returned when a listing already has an appeal waiting for review
+var ErrAppealPending = errors.New("an appeal of this listing is already pending")
+
+// IsAdmin reports whether a user is a platform administrator
+func IsAdmin(ctx context.Context, userID int) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var isAdmin bool
+	err := models.Pool.QueryRow(ctx, `SELECT role = 'admin' FROM users WHERE id = $1`, userID).Scan(&isAdmin)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check admin role: %w", err)
+	}
+	return isAdmin, nil
+}
+
+// RemoveListing unlists a published model for a policy reason. The listing is kept in the
+// "removed" state so its publisher can still see it and appeal. Returns the listing with its
+// publisher's contact details, or pgx.ErrNoRows.
+func RemoveListing(ctx context.Context, listingID, adminID int, reason string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		UPDATE published_models pm
+		SET is_active = false, moderation_status = 'removed', removal_reason = $3,
+			removed_at = NOW(), removed_by = $2, updated_at = NOW()
+		FROM users u
+		WHERE pm.id = $1 AND u.id = pm.publisher_id
+		RETURNING pm.id, pm.name, pm.publisher_id, u.email AS publisher_email, u.username AS publisher_username
+	`, listingID, adminID, reason)
+}
+
+// GetListingModeration returns the moderation state of a listing, or pgx.ErrNoRows
+func GetListingModeration(ctx context.Context, listingID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, name, publisher_id, is_active, moderation_status, removal_reason, removed_at
+		FROM published_models
+		WHERE id = $1
+	`, listingID)
+}
+
+// GetListingAppeals returns the appeals of a listing, newest first
+func GetListingAppeals(ctx context.Context, listingID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, published_model_id, removal_reason, statement, status, admin_response, created_at, resolved_at
+		FROM listing_appeals
+		WHERE published_model_id = $1
+		ORDER BY created_at DESC
+	`, listingID)
+}
+
+// CreateListingAppeal records a publisher's appeal of a removed listing.
+// Returns ErrAppealPending when an earlier appeal has not been resolved yet.
+func CreateListingAppeal(ctx context.Context, listingID, publisherID int, removalReason, statement string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var id int
+	err := models.Pool.QueryRow(ctx, `
+		INSERT INTO listing_appeals (published_model_id, publisher_id, removal_reason, statement)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		ON CONFLICT (published_model_id) WHERE status = 'pending' DO NOTHING
+		RETURNING id
+	`, listingID, publisherID, removalReason, statement).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return 0, ErrAppealPending
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to create appeal: %w", err)
+	}
+	return id, nil
+}
+
+// GetAppealsByStatus returns a page of appeals for admin review, oldest first, and the total count.
+// An empty status returns every appeal.
+func GetAppealsByStatus(ctx context.Context, status string, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM listing_appeals WHERE $1 = '' OR status = $1
+	`, status).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count appeals: %w", err)
+	}
+
+	appeals, err := Query(ctx, `
+		SELECT a.id, a.published_model_id, pm.name AS listing_name, a.publisher_id,
+			u.username AS publisher_username, a.removal_reason, a.statement, a.status,
+			a.admin_id, a.admin_response, a.created_at, a.resolved_at
+		FROM listing_appeals a
+		JOIN published_models pm ON pm.id = a.published_model_id
+		LEFT JOIN users u ON u.id = a.publisher_id
+		WHERE $1 = '' OR a.status = $1
+		ORDER BY a.created_at ASC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return appeals, total, nil
+}
+
+// ResolveListingAppeal closes a pending appeal as upheld or reinstated. Reinstating puts the
+// listing back on the marketplace. Returns the appeal with its publisher's contact details,
+// or pgx.ErrNoRows when there is no pending appeal with this ID.
+func ResolveListingAppeal(ctx context.Context, appealID, adminID int, status, response string) (map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var listingID, publisherID int
+	err = tx.QueryRow(ctx, `
+		UPDATE listing_appeals
+		SET status = $2, admin_id = $3, admin_response = NULLIF($4, ''), resolved_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING published_model_id, publisher_id
+	`, appealID, status, adminID, response).Scan(&listingID, &publisherID)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == AppealReinstated {
+		if _, err := tx.Exec(ctx, `
+			UPDATE published_models
+			SET is_active = true, moderation_status = 'active', removal_reason = NULL,
+				removed_at = NULL, removed_by = NULL, updated_at = NOW()
+			WHERE id = $1
+		`, listingID); err != nil {
+			return nil, fmt.Errorf("failed to reinstate listing: %w", err)
+		}
+	}
+
+	var name, email, username string
+	if err := tx.QueryRow(ctx, `
+		SELECT pm.name, u.email, u.username
+		FROM published_models pm
+		JOIN users u ON u.id = pm.publisher_id
+		WHERE pm.id = $1
+	`, listingID).Scan(&name, &email, &username); err != nil {
+		return nil, fmt.Errorf("failed to get listing: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return map[string]interface{}{
+		"id":                 appealID,
+		"published_model_id": listingID,
+		"listing_name":       name,
+		"publisher_id":       publisherID,
+		"publisher_email":    email,
+		"publisher_username": username,
+		"status":             status,
+	}, nil
+}
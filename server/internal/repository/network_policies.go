@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// GetOrganizationNetworkPolicy returns the training network mode (nil when the organization keeps
+// the deployment's) and allowed hosts of an organization, or pgx.ErrNoRows
+func GetOrganizationNetworkPolicy(ctx context.Context, orgID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, training_network_mode, training_allowed_hosts FROM organizations WHERE id = $1
+	`, orgID)
+}
+
+// SetOrganizationNetworkPolicy sets the training network mode and allowed hosts of an organization.
+// An empty mode restores the deployment's.
+func SetOrganizationNetworkPolicy(ctx context.Context, orgID int, mode string, allowedHosts []string) error {
+	if allowedHosts == nil {
+		allowedHosts = []string{}
+	}
+	if _, err := Exec(ctx, `
+		UPDATE organizations SET training_network_mode = NULLIF($2, ''), training_allowed_hosts = $3 WHERE id = $1
+	`, orgID, mode, allowedHosts); err != nil {
+		return fmt.Errorf("failed to set organization network policy: %w", err)
+	}
+	return nil
+}
+
+// GetUserNetworkPolicies returns the training network policies of the organizations the user belongs to
+func GetUserNetworkPolicies(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT o.id, o.training_network_mode, o.training_allowed_hosts
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1 AND o.training_network_mode IS NOT NULL
+		ORDER BY o.id
+	`, userID)
+}
+
+// SetTrainingRunNetworkPolicy records the network access a server training runs with
+func SetTrainingRunNetworkPolicy(ctx context.Context, trainingID, mode string, allowedHosts []string) error {
+	if _, err := Exec(ctx, `
+		UPDATE model_training_runs SET network_mode = $2, allowed_hosts = $3 WHERE training_id = $1
+	`, trainingID, mode, allowedHosts); err != nil {
+		return fmt.Errorf("failed to record training network policy: %w", err)
+	}
+	return nil
+}
+
+// SaveTrainingRunEgressAttempts stores the destinations a finished training reached or was blocked from
+func SaveTrainingRunEgressAttempts(ctx context.Context, trainingID string, attempts interface{}) error {
+	data, err := json.Marshal(attempts)
+	if err != nil {
+		return fmt.Errorf("failed to encode egress attempts: %w", err)
+	}
+	if _, err := Exec(ctx, `
+		UPDATE model_training_runs SET egress_attempts = $2 WHERE training_id = $1
+	`, trainingID, data); err != nil {
+		return fmt.Errorf("failed to store egress attempts: %w", err)
+	}
+	return nil
+}
+
+// GetTrainingRunNetwork returns the network mode, allowed hosts and egress attempts recorded for a
+// training of the user, or pgx.ErrNoRows
+func GetTrainingRunNetwork(ctx context.Context, trainingID string, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT training_id, training_type, network_mode, allowed_hosts, egress_attempts
+		FROM model_training_runs
+		WHERE training_id = $1 AND user_id = $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, trainingID, userID)
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// CreateNotification stores a notification for a user and returns its ID
+func CreateNotification(ctx context.Context, userID int, notificationType, title, message string, data map[string]interface{}, emailed bool) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var payload []byte
+	if data != nil {
+		var err error
+		if payload, err = json.Marshal(data); err != nil {
+			return 0, fmt.Errorf("invalid notification data: %w", err)
+		}
+	}
+
+	var id int
+	err := models.Pool.QueryRow(ctx, `
+		INSERT INTO notifications (user_id, type, title, message, data, emailed)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, userID, notificationType, title, message, payload, emailed).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create notification: %w", err)
+	}
+	return id, nil
+}
+
+// GetNotifications returns a user's notifications, newest first
+func GetNotifications(ctx context.Context, userID int, unreadOnly bool, limit, offset int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, type, title, message, data, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`, userID, unreadOnly, limit, offset)
+}
+
+// CountUnreadNotifications counts a user's unread notifications
+func CountUnreadNotifications(ctx context.Context, userID int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var count int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationsRead marks the given notifications as read, or all of them when ids is empty
+func MarkNotificationsRead(ctx context.Context, userID int, ids []int) (int64, error) {
+	if len(ids) == 0 {
+		return Exec(ctx, `
+			UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND read_at IS NULL
+		`, userID)
+	}
+	return Exec(ctx, `
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND id = ANY($2) AND read_at IS NULL
+	`, userID, ids)
+}
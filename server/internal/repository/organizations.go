@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"server/internal/models"
+)
+
+// Listing visibilities
+const (
+	ListingVisibilityPublic  = "public"
+	ListingVisibilityOrg     = "org"
+	ListingVisibilityPrivate = "private"
+)
+
+// Organization member roles. Owners and admins manage members.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// listingVisibleTo is the condition under which the listing aliased pm is visible to the user in
+// the query parameter userParam (0 for anonymous visitors): public listings, the publisher's own,
+// listings of the user's organizations, and listings the user bought, or rented for as long as the
+// rental lasts, before they were made private.
+func listingVisibleTo(userParam string) string {
+	return fmt.Sprintf(`(pm.visibility = 'public' OR pm.publisher_id = %[1]s
+		OR (pm.visibility = 'org' AND EXISTS (
+			SELECT 1 FROM organization_members om WHERE om.organization_id = pm.organization_id AND om.user_id = %[1]s))
+		OR EXISTS (
+			SELECT 1 FROM model_purchases vp WHERE vp.published_model_id = pm.id AND vp.buyer_id = %[1]s
+				AND (vp.expires_at IS NULL OR vp.expires_at > CURRENT_TIMESTAMP)))`, userParam)
+}
+
+// CanViewListing reports whether a listing exists and is visible to the user (0 for anonymous visitors)
+func CanViewListing(ctx context.Context, listingID, userID int) (bool, error) {
+	rows, err := Query(ctx, `SELECT 1 FROM published_models pm WHERE pm.id = $1 AND `+listingVisibleTo("$2"), listingID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check listing visibility: %w", err)
+	}
+	return len(rows) > 0, nil
+}
+
+// SetListingVisibility changes who can see a listing. organizationID is only kept for org listings.
+func SetListingVisibility(ctx context.Context, listingID int, visibility string, organizationID *int) error {
+	if visibility != ListingVisibilityOrg {
+		organizationID = nil
+	}
+	if _, err := Exec(ctx, `
+		UPDATE published_models SET visibility = $2, organization_id = $3 WHERE id = $1
+	`, listingID, visibility, organizationID); err != nil {
+		return fmt.Errorf("failed to update listing visibility: %w", err)
+	}
+	return nil
+}
+
+// CreateOrganization creates an organization owned by the user and returns its ID
+func CreateOrganization(ctx context.Context, userID int, name string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var orgID int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO organizations (name, created_by) VALUES ($1, $2) RETURNING id
+	`, name, userID).Scan(&orgID); err != nil {
+		return 0, fmt.Errorf("failed to create organization: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)
+	`, orgID, userID, OrgRoleOwner); err != nil {
+		return 0, fmt.Errorf("failed to add organization owner: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("✅ Created organization %d for user %d", orgID, userID)
+	return orgID, nil
+}
+
+// GetUserOrganizations returns the organizations the user belongs to with their role
+func GetUserOrganizations(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT o.id, o.name, m.role, o.training_credits, o.created_at,
+			(SELECT COUNT(*) FROM organization_members c WHERE c.organization_id = o.id) AS members_count,
+			(SELECT COUNT(*) FROM models md WHERE md.organization_id = o.id) AS models_count
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1
+		ORDER BY o.name
+	`, userID)
+}
+
+// GetOrganizationRole returns the user's role in an organization, or "" when they are not a member
+func GetOrganizationRole(ctx context.Context, orgID, userID int) (string, error) {
+	row, err := QueryRow(ctx, `
+		SELECT role FROM organization_members WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get organization role: %w", err)
+	}
+	role, _ := row["role"].(string)
+	return role, nil
+}
+
+// GetOrganizationMembers returns the members of an organization, owners first
+func GetOrganizationMembers(ctx context.Context, orgID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT u.id, u.username, u.email, m.role, m.created_at AS joined_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, u.username
+	`, orgID)
+}
+
+// SetOrganizationMember adds a user to an organization, or changes their role
+func SetOrganizationMember(ctx context.Context, orgID, userID int, role string) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role
+	`, orgID, userID, role); err != nil {
+		return fmt.Errorf("failed to save organization member: %w", err)
+	}
+	return nil
+}
+
+// RemoveOrganizationMember removes a user from an organization and stops sharing their models with
+// it. It reports whether they were a member.
+func RemoveOrganizationMember(ctx context.Context, orgID, userID int) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove organization member: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE models SET organization_id = NULL WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID); err != nil {
+		return false, fmt.Errorf("failed to unshare member models: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CountOrganizationOwners returns how many owners an organization has
+func CountOrganizationOwners(ctx context.Context, orgID int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var owners int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM organization_members WHERE organization_id = $1 AND role = 'owner'
+	`, orgID).Scan(&owners); err != nil {
+		return 0, fmt.Errorf("failed to count organization owners: %w", err)
+	}
+	return owners, nil
+}
+
+// GetOrganizationListings returns the active listings published to an organization, newest first
+func GetOrganizationListings(ctx context.Context, orgID int, listingType string) ([]map[string]interface{}, error) {
+	listings, err := Query(ctx, `
+		SELECT pm.id, pm.model_id, pm.publisher_id, pm.name, pm.picture, pm.description, pm.short_description,
+			pm.category, pm.tags, pm.model_type, pm.framework, pm.file_size, pm.accuracy_score, pm.license_type,
+			pm.downloads_count, pm.views_count, pm.rating_average, pm.rating_count, pm.published_at, pm.updated_at,
+			pm.listing_type, pm.installs_count, pm.version, pm.visibility, pm.organization_id,
+			u.username AS publisher_username
+		FROM published_models pm
+		LEFT JOIN users u ON pm.publisher_id = u.id
+		WHERE pm.organization_id = $1 AND pm.visibility = 'org' AND pm.is_active = true
+			AND ($2 = '' OR pm.listing_type = $2)
+		ORDER BY pm.published_at DESC
+	`, orgID, listingType)
+	if err != nil {
+		return nil, err
+	}
+	// Convert picture paths from "./uploads/..." to "/uploads/..." like the marketplace does
+	for _, listing := range listings {
+		if picture, ok := listing["picture"].(string); ok {
+			listing["picture"] = strings.TrimPrefix(picture, ".")
+		}
+	}
+	return listings, nil
+}
+
+// SetModelOrganization shares a model with an organization, or stops sharing it when orgID is nil
+func SetModelOrganization(ctx context.Context, modelID int, orgID *int) error {
+	if _, err := Exec(ctx, `
+		UPDATE models SET organization_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+	`, modelID, orgID); err != nil {
+		return fmt.Errorf("failed to share model with organization: %w", err)
+	}
+	return nil
+}
+
+// GetModelOrganizationID returns the organization a model is shared with, or 0 when it is not shared
+func GetModelOrganizationID(ctx context.Context, modelID int) (int, error) {
+	row, err := QueryRow(ctx, `SELECT organization_id FROM models WHERE id = $1`, modelID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get model organization: %w", err)
+	}
+	orgID, _ := row["organization_id"].(int32)
+	return int(orgID), nil
+}
+
+// GetOrganizationSharedModels returns the models members shared with an organization, newest first
+func GetOrganizationSharedModels(ctx context.Context, orgID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT md.id, md.user_id, md.name, md.picture, md.trained_model_path, md.trained_at, md.accuracy_score,
+			md.tags, md.created_at, md.updated_at, u.username AS owner_username
+		FROM models md
+		JOIN users u ON u.id = md.user_id
+		WHERE md.organization_id = $1
+		ORDER BY md.created_at DESC
+	`, orgID)
+}
+
+// GetOrganizationCredits returns the credits in an organization's pool
+func GetOrganizationCredits(ctx context.Context, orgID int) (int, error) {
+	row, err := QueryRow(ctx, `SELECT training_credits FROM organizations WHERE id = $1`, orgID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get organization credits: %w", err)
+	}
+	credits, _ := row["training_credits"].(int32)
+	return int(credits), nil
+}
+
+// GetOrganizationCreditTransactions returns a page of the transactions of an organization's credit
+// pool, newest first, and the total count
+func GetOrganizationCreditTransactions(ctx context.Context, orgID, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM credit_transactions WHERE organization_id = $1
+	`, orgID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count credit transactions: %w", err)
+	}
+
+	transactions, err := Query(ctx, `
+		SELECT t.id, t.kind, t.amount, t.balance_after, t.training_id, t.description, t.created_at,
+			t.user_id, u.username
+		FROM credit_transactions t
+		LEFT JOIN users u ON u.id = t.user_id
+		WHERE t.organization_id = $1
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT $2 OFFSET $3
+	`, orgID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return transactions, total, nil
+}
+
+// GetOrganizationTrainingRuns returns a page of the trainings of models shared with an organization,
+// newest first, and the total count
+func GetOrganizationTrainingRuns(ctx context.Context, orgID, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM model_training_runs WHERE organization_id = $1
+	`, orgID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count training runs: %w", err)
+	}
+
+	runs, err := Query(ctx, `
+		SELECT r.training_id, r.model_id, md.name AS model_name, r.user_id, u.username, r.training_type,
+			r.execution_mode, r.hardware_tier, r.run_seconds, r.metered_credits::FLOAT8 AS metered_credits, r.charged_credits,
+			r.created_at AS started_at, r.finalized_at
+		FROM model_training_runs r
+		JOIN models md ON md.id = r.model_id
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.organization_id = $1
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT $2 OFFSET $3
+	`, orgID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// SetPasswordResetToken stores the hash of a password reset token for the user with this email.
+// Returns false when no user has this email.
+func SetPasswordResetToken(ctx context.Context, email, tokenHash string, expiresAt time.Time) (bool, error) {
+	affected, err := Exec(ctx, `
+		UPDATE users
+		SET password_reset_token_hash = $2, password_reset_expires_at = $3, updated_at = NOW()
+		WHERE email = $1
+	`, email, tokenHash, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to set password reset token: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// GetUserByPasswordResetToken returns the user a reset token hash was issued to while it is
+// still valid, or pgx.ErrNoRows
+func GetUserByPasswordResetToken(ctx context.Context, tokenHash string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, email, username
+		FROM users
+		WHERE password_reset_token_hash = $1 AND password_reset_expires_at > NOW()
+	`, tokenHash)
+}
+
+// ResetPassword replaces a user's password hash, clears the reset token and deletes every session
+// so the user is signed out on all devices
+func ResetPassword(ctx context.Context, userID int, passwordHash string) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE users
+		SET password = $2, password_reset_token_hash = NULL, password_reset_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, userID, passwordHash); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"server/internal/models"
+)
+
+// RecordTrainingPreemption stores the eviction of a preemptible training and returns its ID
+func RecordTrainingPreemption(ctx context.Context, trainingID, checkpointPath, reason string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		INSERT INTO training_preemptions (training_id, reason, checkpoint_path)
+		VALUES ($1, $2, NULLIF($3, ''))
+		RETURNING id
+	`
+
+	var id int
+	if err := models.Pool.QueryRow(ctx, query, trainingID, reason, checkpointPath).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to record preemption: %w", err)
+	}
+
+	log.Printf("✅ Recorded preemption %d of training %s", id, trainingID)
+	return id, nil
+}
+
+// MarkTrainingPreemptionResumed sets when an evicted training was resumed
+func MarkTrainingPreemptionResumed(ctx context.Context, preemptionID int) error {
+	if _, err := Exec(ctx, `UPDATE training_preemptions SET resumed_at = CURRENT_TIMESTAMP WHERE id = $1`, preemptionID); err != nil {
+		return fmt.Errorf("failed to mark preemption resumed: %w", err)
+	}
+	return nil
+}
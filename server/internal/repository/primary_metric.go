@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetModelPrimaryMetric declares the metric of record of a model and whether higher or lower is
+// better. The value of the previous metric is cleared.
+func SetModelPrimaryMetric(ctx context.Context, modelID int, name, direction string) error {
+	if _, err := Exec(ctx, `
+		UPDATE models
+		SET primary_metric = $2, primary_metric_direction = $3,
+			primary_metric_value = CASE WHEN primary_metric = $2 THEN primary_metric_value END
+		WHERE id = $1
+	`, modelID, name, direction); err != nil {
+		return fmt.Errorf("failed to set primary metric: %w", err)
+	}
+	return nil
+}
+
+// GetModelPrimaryMetric returns the metric of record of a model and its direction
+func GetModelPrimaryMetric(ctx context.Context, modelID int) (string, string, error) {
+	row, err := QueryRow(ctx, `SELECT primary_metric, primary_metric_direction FROM models WHERE id = $1`, modelID)
+	if err != nil {
+		return "", "", err
+	}
+	name, _ := row["primary_metric"].(string)
+	direction, _ := row["primary_metric_direction"].(string)
+	return name, direction, nil
+}
+
+// UpdateModelPrimaryMetricValue stores the primary metric reached by the latest training of a model
+func UpdateModelPrimaryMetricValue(ctx context.Context, modelName string, value float64) error {
+	if _, err := Exec(ctx, `UPDATE models SET primary_metric_value = $1 WHERE name = $2`, value, modelName); err != nil {
+		return fmt.Errorf("failed to update primary metric: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// CreateProjectToken stores a project token of one of the user's models by the hash of its secret
+func CreateProjectToken(ctx context.Context, userID, modelID int, name, tokenHash, tokenPrefix string, scopes []string, trainingProfile []byte) (map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	token, err := QueryRow(ctx, `
+		INSERT INTO project_tokens (user_id, model_id, name, token_hash, token_prefix, scopes, training_profile)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, model_id, name, token_prefix, scopes, training_profile, created_at
+	`, userID, modelID, name, tokenHash, tokenPrefix, scopes, trainingProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create project token: %w", err)
+	}
+	return token, nil
+}
+
+// GetProjectTokens returns the user's project tokens that were not revoked, newest first
+func GetProjectTokens(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT t.id, t.model_id, m.name AS model_name, t.name, t.token_prefix, t.scopes, t.training_profile,
+			t.last_used_at, t.created_at
+		FROM project_tokens t
+		JOIN models m ON m.id = t.model_id
+		WHERE t.user_id = $1 AND t.revoked_at IS NULL
+		ORDER BY t.created_at DESC
+	`, userID)
+}
+
+// RevokeProjectToken revokes one of the user's project tokens. It reports whether the token existed.
+func RevokeProjectToken(ctx context.Context, tokenID, userID int) (bool, error) {
+	revoked, err := Exec(ctx, `
+		UPDATE project_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, tokenID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke project token: %w", err)
+	}
+	return revoked > 0, nil
+}
+
+// UseProjectToken looks up a token that was not revoked by its hash, with the model it belongs to,
+// and records that it was used. It returns pgx.ErrNoRows for unknown or revoked tokens.
+func UseProjectToken(ctx context.Context, tokenHash string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		WITH token AS (
+			UPDATE project_tokens SET last_used_at = NOW()
+			WHERE token_hash = $1 AND revoked_at IS NULL
+			RETURNING id, user_id, model_id, name, scopes, training_profile
+		)
+		SELECT token.id, token.user_id, token.model_id, token.name, token.scopes, token.training_profile,
+			m.name AS model_name, m.folder, m.training_script
+		FROM token
+		JOIN models m ON m.id = token.model_id
+	`, tokenHash)
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// publicListingColumns are the listing fields exposed by the public marketplace API: no file
+// paths, moderation details or anything specific to a viewer
+const publicListingColumns = `pm.id, pm.name, pm.picture, pm.short_description, pm.price, pm.category, pm.tags,
+	pm.model_type, pm.framework, pm.file_size, pm.accuracy_score, pm.primary_metric, pm.primary_metric_direction,
+	pm.primary_metric_value, pm.license_type, pm.downloads_count, pm.rating_average, pm.rating_count,
+	pm.listing_type, pm.version, pm.rental_price, pm.rental_days, pm.published_at, pm.updated_at,
+	pm.deprecated_at, pm.successor_id, pm.sunset_at, u.username AS publisher_username`
+
+// publicListingFilter selects the listings anyone can see
+const publicListingFilter = `pm.is_active = true AND pm.visibility = 'public' AND pm.moderation_status = 'active'`
+
+// PublicListingCursor is the position after the last listing of a page of the public API
+type PublicListingCursor struct {
+	PublishedAt time.Time
+	ID          int
+}
+
+// GetPublicListings returns a page of public listings, newest first, starting after the cursor (nil
+// for the first page). listingType and category narrow the results when set.
+func GetPublicListings(ctx context.Context, listingType, category string, after *PublicListingCursor, limit int) ([]map[string]interface{}, error) {
+	var afterTime *time.Time
+	afterID := 0
+	if after != nil {
+		afterTime, afterID = &after.PublishedAt, after.ID
+	}
+	listings, err := Query(ctx, `
+		SELECT `+publicListingColumns+`
+		FROM published_models pm
+		LEFT JOIN users u ON pm.publisher_id = u.id
+		WHERE `+publicListingFilter+`
+			AND ($1 = '' OR pm.listing_type = $1)
+			AND ($2 = '' OR LOWER(pm.category) = LOWER($2))
+			AND ($3::TIMESTAMP IS NULL OR (pm.published_at, pm.id) < ($3::TIMESTAMP, $4))
+		ORDER BY pm.published_at DESC, pm.id DESC
+		LIMIT $5
+	`, listingType, category, afterTime, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public listings: %w", err)
+	}
+	trimPicturePaths(listings)
+	return listings, nil
+}
+
+// GetPublicListing returns a public listing with its description, or pgx.ErrNoRows
+func GetPublicListing(ctx context.Context, listingID int) (map[string]interface{}, error) {
+	listing, err := QueryRow(ctx, `
+		SELECT `+publicListingColumns+`, pm.description, pm.deprecation_message
+		FROM published_models pm
+		LEFT JOIN users u ON pm.publisher_id = u.id
+		WHERE pm.id = $1 AND `+publicListingFilter, listingID)
+	if err != nil {
+		return nil, err
+	}
+	trimPicturePaths([]map[string]interface{}{listing})
+	return listing, nil
+}
+
+// trimPicturePaths converts picture paths from "./uploads/..." to "/uploads/..." like the marketplace does
+func trimPicturePaths(listings []map[string]interface{}) {
+	for _, listing := range listings {
+		if picture, ok := listing["picture"].(string); ok {
+			listing["picture"] = strings.TrimPrefix(picture, ".")
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// GetPublisherCountryStats counts a publisher's marketplace views and downloads per country,
+// for the period [from, to) and for the equally long period before it. Unknown countries are
+// returned as NULL. listingID limits the stats to one listing when it is not 0.
+func GetPublisherCountryStats(ctx context.Context, publisherID, listingID int, from, to time.Time) ([]map[string]interface{}, error) {
+	previousFrom := from.Add(-to.Sub(from))
+	return Query(ctx, `
+		WITH events AS (
+			SELECT v.country, v.viewed_at AS at, 1 AS views, 0 AS downloads
+			FROM model_views v
+			JOIN published_models p ON p.id = v.model_id
+			WHERE p.publisher_id = $1 AND ($2 = 0 OR v.model_id = $2)
+			  AND v.viewed_at >= $3 AND v.viewed_at < $5
+			UNION ALL
+			SELECT l.country, l.downloaded_at, 0, 1
+			FROM model_download_ledger l
+			WHERE l.publisher_id = $1 AND ($2 = 0 OR l.published_model_id = $2)
+			  AND l.downloaded_at >= $3 AND l.downloaded_at < $5
+		)
+		SELECT country,
+			COALESCE(SUM(views) FILTER (WHERE at >= $4), 0)::INT AS views,
+			COALESCE(SUM(downloads) FILTER (WHERE at >= $4), 0)::INT AS downloads,
+			COALESCE(SUM(views) FILTER (WHERE at < $4), 0)::INT AS previous_views,
+			COALESCE(SUM(downloads) FILTER (WHERE at < $4), 0)::INT AS previous_downloads
+		FROM events
+		GROUP BY country
+	`, publisherID, listingID, previousFrom, from, to)
+}
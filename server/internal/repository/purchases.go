@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"server/internal/models"
+)
+
+// querier runs statements on the pool or in a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// RecordModelPurchase records a completed purchase of a published model. Buying the same model twice is a no-op;
+// buying a rented model turns the rental into a purchase.
+func RecordModelPurchase(ctx context.Context, buyerID, publishedModelID, publisherID, pricePaid int, paymentMethod, transactionID string) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+	if _, err := recordModelPurchase(ctx, models.Pool, buyerID, publishedModelID, publisherID, pricePaid, paymentMethod, transactionID); err != nil {
+		return err
+	}
+	log.Printf("✅ Recorded purchase of model %d by user %d", publishedModelID, buyerID)
+	return nil
+}
+
+// recordModelPurchase records a purchase like RecordModelPurchase and reports whether it granted
+// anything, which it does not when the buyer already owns the model
+func recordModelPurchase(ctx context.Context, q querier, buyerID, publishedModelID, publisherID, pricePaid int, paymentMethod, transactionID string) (bool, error) {
+	tag, err := q.Exec(ctx, `
+		INSERT INTO model_purchases (published_model_id, buyer_id, publisher_id, price_paid, is_free, payment_method, transaction_id)
+		VALUES ($1, $2, $3, $4, $4 = 0, $5, $6)
+		ON CONFLICT (buyer_id, published_model_id) DO UPDATE
+		SET is_rental = false, expires_at = NULL, rental_reminder_sent_at = NULL,
+			price_paid = model_purchases.price_paid + EXCLUDED.price_paid,
+			payment_method = EXCLUDED.payment_method, transaction_id = EXCLUDED.transaction_id,
+			payment_status = 'completed', purchased_at = CURRENT_TIMESTAMP
+		WHERE model_purchases.is_rental
+	`, publishedModelID, buyerID, publisherID, pricePaid, paymentMethod, transactionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record purchase: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetModelPurchaseTime returns when a buyer acquired a published model, directly or through a bundle
+// (pgx.ErrNoRows if they never did)
+func GetModelPurchaseTime(ctx context.Context, buyerID, publishedModelID int) (time.Time, error) {
+	if models.Pool == nil {
+		return time.Time{}, fmt.Errorf("database connection not initialized")
+	}
+
+	var purchasedAt time.Time
+	err := models.Pool.QueryRow(ctx, `
+		SELECT purchased_at FROM model_purchases
+		WHERE buyer_id = $1 AND published_model_id = $2 AND payment_status = 'completed'
+			AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		UNION ALL
+		SELECT bp.purchased_at FROM bundle_purchases bp
+		JOIN marketplace_bundle_items bi ON bi.bundle_id = bp.bundle_id
+		WHERE bp.buyer_id = $1 AND bi.published_model_id = $2
+		ORDER BY purchased_at
+		LIMIT 1
+	`, buyerID, publishedModelID).Scan(&purchasedAt)
+	return purchasedAt, err
+}
+
+// HasPublishedModelAccess reports whether a user bought a published model, directly or through a bundle,
+// or has an unexpired rental of it
+func HasPublishedModelAccess(ctx context.Context, userID, publishedModelID int) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var exists bool
+	err := models.Pool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM model_purchases
+			WHERE buyer_id = $1 AND published_model_id = $2 AND payment_status = 'completed'
+				AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		) OR EXISTS(
+			SELECT 1 FROM bundle_purchases bp
+			JOIN marketplace_bundle_items bi ON bi.bundle_id = bp.bundle_id
+			WHERE bp.buyer_id = $1 AND bi.published_model_id = $2
+		)
+	`, userID, publishedModelID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check purchase: %w", err)
+	}
+	return exists, nil
+}
+
+// RecordModelRental records a paid rental of a published model for days days and returns when it expires.
+// Renting again extends an unexpired rental from its current expiry. Confirming the same payment twice
+// extends it once, and renting a model the user bought is a no-op (pgx.ErrNoRows).
+func RecordModelRental(ctx context.Context, buyerID, publishedModelID, publisherID, pricePaid, days int, paymentMethod, transactionID string) (time.Time, error) {
+	if models.Pool == nil {
+		return time.Time{}, fmt.Errorf("database connection not initialized")
+	}
+
+	expiresAt, err := recordModelRental(ctx, models.Pool, buyerID, publishedModelID, publisherID, pricePaid, days, paymentMethod, transactionID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	log.Printf("✅ Recorded %d-day rental of model %d by user %d", days, publishedModelID, buyerID)
+	return expiresAt, nil
+}
+
+// recordModelRental records a rental like RecordModelRental
+func recordModelRental(ctx context.Context, q querier, buyerID, publishedModelID, publisherID, pricePaid, days int, paymentMethod, transactionID string) (time.Time, error) {
+	var expiresAt time.Time
+	err := q.QueryRow(ctx, `
+		INSERT INTO model_purchases (published_model_id, buyer_id, publisher_id, price_paid, is_free, payment_method,
+			transaction_id, is_rental, expires_at)
+		VALUES ($1, $2, $3, $4, false, $5, $6, true, CURRENT_TIMESTAMP + make_interval(days => $7))
+		ON CONFLICT (buyer_id, published_model_id) DO UPDATE
+		SET expires_at = GREATEST(model_purchases.expires_at, CURRENT_TIMESTAMP) + make_interval(days => $7),
+			price_paid = model_purchases.price_paid + EXCLUDED.price_paid,
+			payment_method = EXCLUDED.payment_method, transaction_id = EXCLUDED.transaction_id,
+			payment_status = 'completed', rental_reminder_sent_at = NULL
+		WHERE model_purchases.is_rental AND model_purchases.transaction_id IS DISTINCT FROM EXCLUDED.transaction_id
+		RETURNING expires_at
+	`, publishedModelID, buyerID, publisherID, pricePaid, paymentMethod, transactionID, days).Scan(&expiresAt)
+	return expiresAt, err
+}
+
+// GetModelRental returns a user's rental of a published model, expired or not (pgx.ErrNoRows if there is none)
+func GetModelRental(ctx context.Context, buyerID, publishedModelID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, published_model_id, price_paid, purchased_at, expires_at, expires_at > CURRENT_TIMESTAMP AS active
+		FROM model_purchases
+		WHERE buyer_id = $1 AND published_model_id = $2 AND is_rental
+	`, buyerID, publishedModelID)
+}
+
+// GetUserRentals returns a user's rentals, soonest expiry first
+func GetUserRentals(ctx context.Context, buyerID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT mp.published_model_id, pm.name, pm.picture, pm.rental_price, pm.rental_days, pm.is_active,
+			mp.price_paid, mp.purchased_at, mp.expires_at, mp.expires_at > CURRENT_TIMESTAMP AS active
+		FROM model_purchases mp
+		JOIN published_models pm ON pm.id = mp.published_model_id
+		WHERE mp.buyer_id = $1 AND mp.is_rental
+		ORDER BY mp.expires_at
+	`, buyerID)
+}
+
+// GetRentalsToRemind returns the unexpired rentals that expire within the next window and were not
+// reminded about yet, with the renter's contact details
+func GetRentalsToRemind(ctx context.Context, window time.Duration) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT mp.id, mp.buyer_id, mp.published_model_id, mp.expires_at, pm.name, pm.rental_price, pm.rental_days,
+			pm.is_active, u.email, u.username
+		FROM model_purchases mp
+		JOIN published_models pm ON pm.id = mp.published_model_id
+		JOIN users u ON u.id = mp.buyer_id
+		WHERE mp.is_rental AND mp.rental_reminder_sent_at IS NULL
+			AND mp.expires_at > CURRENT_TIMESTAMP
+			AND mp.expires_at <= CURRENT_TIMESTAMP + make_interval(secs => $1)
+	`, window.Seconds())
+}
+
+// MarkRentalReminded records that the renter was reminded of a rental's expiry
+func MarkRentalReminded(ctx context.Context, purchaseID int) error {
+	if _, err := Exec(ctx, `
+		UPDATE model_purchases SET rental_reminder_sent_at = CURRENT_TIMESTAMP WHERE id = $1
+	`, purchaseID); err != nil {
+		return fmt.Errorf("failed to mark rental reminded: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SetTrainingRunSnapshot records the hyperparameters, source files and dataset a training started
+// with. datasetFiles may be nil when the dataset has too many files to list.
+func SetTrainingRunSnapshot(ctx context.Context, trainingID string, hyperparameters map[string]string, sourceFiles, datasetFiles map[string]string, datasetHash string) error {
+	params, err := json.Marshal(hyperparameters)
+	if err != nil {
+		return fmt.Errorf("failed to encode hyperparameters: %w", err)
+	}
+	sources, err := json.Marshal(sourceFiles)
+	if err != nil {
+		return fmt.Errorf("failed to encode source files: %w", err)
+	}
+	var dataset interface{}
+	if datasetFiles != nil {
+		if dataset, err = json.Marshal(datasetFiles); err != nil {
+			return fmt.Errorf("failed to encode dataset files: %w", err)
+		}
+	}
+
+	if _, err := Exec(ctx, `
+		UPDATE model_training_runs
+		SET hyperparameters = $2, source_files = $3, dataset_hash = NULLIF($4, ''), dataset_files = $5
+		WHERE training_id = $1
+	`, trainingID, params, sources, datasetHash, dataset); err != nil {
+		return fmt.Errorf("failed to record training run snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetTrainingRunForDiff returns a training run of the user, or of one of their models, with its
+// snapshot, captured environment and final metrics, or pgx.ErrNoRows
+func GetTrainingRunForDiff(ctx context.Context, trainingID string, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT r.training_id, r.model_id, m.name AS model_name, r.training_type, r.execution_mode,
+			r.hardware_tier, r.network_mode, r.created_at AS started_at,
+			r.hyperparameters, r.source_files, r.dataset_hash, r.dataset_files,
+			e.python_version, e.cuda_version, e.platform, e.packages, e.captured_at AS environment_captured_at,
+			h.ended_at, h.epochs, h.train_loss, h.val_loss, h.train_accuracy, h.val_accuracy,
+			h.test_accuracy, h.custom_metrics
+		FROM model_training_runs r
+		JOIN models m ON m.id = r.model_id
+		LEFT JOIN training_environments e ON e.training_id = r.training_id
+		LEFT JOIN LATERAL (
+			SELECT MAX(t.recorded_at) AS ended_at, MAX(t.epoch) AS epochs,
+				(array_agg(t.train_loss ORDER BY t.recorded_at DESC) FILTER (WHERE t.train_loss IS NOT NULL))[1] AS train_loss,
+				(array_agg(t.val_loss ORDER BY t.recorded_at DESC) FILTER (WHERE t.val_loss IS NOT NULL))[1] AS val_loss,
+				(array_agg(t.train_accuracy ORDER BY t.recorded_at DESC) FILTER (WHERE t.train_accuracy IS NOT NULL))[1] AS train_accuracy,
+				(array_agg(t.val_accuracy ORDER BY t.recorded_at DESC) FILTER (WHERE t.val_accuracy IS NOT NULL))[1] AS val_accuracy,
+				(array_agg(t.test_accuracy ORDER BY t.recorded_at DESC) FILTER (WHERE t.test_accuracy IS NOT NULL))[1] AS test_accuracy,
+				(array_agg(t.custom_metrics ORDER BY t.recorded_at DESC) FILTER (WHERE t.custom_metrics IS NOT NULL))[1] AS custom_metrics
+			FROM training_metric_history t
+			WHERE t.training_id = r.training_id AND t.user_id = r.user_id
+		) h ON true
+		WHERE r.training_id = $1 AND (r.user_id = $2 OR m.user_id = $2)
+		ORDER BY r.created_at DESC
+		LIMIT 1
+	`, trainingID, userID)
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// CreateSavedSearch saves a marketplace search for a user and returns its ID
+func CreateSavedSearch(ctx context.Context, userID int, name string, filters interface{}, alertsEnabled, emailAlerts bool) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	payload, err := json.Marshal(filters)
+	if err != nil {
+		return 0, fmt.Errorf("invalid search filters: %w", err)
+	}
+
+	var id int
+	if err := models.Pool.QueryRow(ctx, `
+		INSERT INTO saved_searches (user_id, name, filters, alerts_enabled, email_alerts)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, userID, name, payload, alertsEnabled, emailAlerts).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to save search: %w", err)
+	}
+	return id, nil
+}
+
+// CountSavedSearches counts a user's saved searches
+func CountSavedSearches(ctx context.Context, userID int) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var count int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM saved_searches WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count saved searches: %w", err)
+	}
+	return count, nil
+}
+
+// GetSavedSearches returns a user's saved searches, most recently created first
+func GetSavedSearches(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, name, filters, alerts_enabled, email_alerts, last_alerted_at, created_at, updated_at
+		FROM saved_searches
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+}
+
+// GetSavedSearch returns one of a user's saved searches, or pgx.ErrNoRows
+func GetSavedSearch(ctx context.Context, userID, searchID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, name, filters, alerts_enabled, email_alerts, last_alerted_at, created_at, updated_at
+		FROM saved_searches
+		WHERE id = $1 AND user_id = $2
+	`, searchID, userID)
+}
+
+// UpdateSavedSearch updates a user's saved search. Nil fields are left unchanged.
+// Turning alerts on only alerts about listings published from now on. It reports whether the search exists.
+func UpdateSavedSearch(ctx context.Context, userID, searchID int, name *string, filters interface{}, alertsEnabled, emailAlerts *bool) (bool, error) {
+	var payload []byte
+	if filters != nil {
+		var err error
+		if payload, err = json.Marshal(filters); err != nil {
+			return false, fmt.Errorf("invalid search filters: %w", err)
+		}
+	}
+
+	updated, err := Exec(ctx, `
+		UPDATE saved_searches
+		SET name = COALESCE($3, name),
+			filters = COALESCE($4, filters),
+			last_checked_at = CASE WHEN $5 AND NOT alerts_enabled THEN CURRENT_TIMESTAMP ELSE last_checked_at END,
+			alerts_enabled = COALESCE($5, alerts_enabled),
+			email_alerts = COALESCE($6, email_alerts),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+	`, searchID, userID, name, payload, alertsEnabled, emailAlerts)
+	if err != nil {
+		return false, fmt.Errorf("failed to update saved search: %w", err)
+	}
+	return updated > 0, nil
+}
+
+// DeleteSavedSearch deletes a user's saved search and reports whether there was one
+func DeleteSavedSearch(ctx context.Context, userID, searchID int) (bool, error) {
+	deleted, err := Exec(ctx, `DELETE FROM saved_searches WHERE id = $1 AND user_id = $2`, searchID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// GetAlertingSavedSearches returns the saved searches with alerts on, with their owner's email and username
+func GetAlertingSavedSearches(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT s.id, s.user_id, s.name, s.filters, s.email_alerts, s.last_checked_at, u.email, u.username
+		FROM saved_searches s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.alerts_enabled
+	`)
+}
+
+// SavedSearchCheckpoint returns the database's current time, up to which the alert job checks new listings
+func SavedSearchCheckpoint(ctx context.Context) (time.Time, error) {
+	if models.Pool == nil {
+		return time.Time{}, fmt.Errorf("database connection not initialized")
+	}
+
+	var now time.Time
+	if err := models.Pool.QueryRow(ctx, `SELECT LOCALTIMESTAMP`).Scan(&now); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read database time: %w", err)
+	}
+	return now, nil
+}
+
+// GetPublishedModelsBetween returns the active public listings published after after and up to until, oldest first
+func GetPublishedModelsBetween(ctx context.Context, after, until time.Time) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT pm.id, pm.publisher_id, pm.name, pm.description, pm.short_description, pm.price, pm.category,
+			pm.tags, pm.model_type, pm.framework, pm.accuracy_score, pm.license_type, pm.rating_average,
+			pm.listing_type, pm.published_at
+		FROM published_models pm
+		WHERE pm.is_active = true AND pm.visibility = 'public' AND pm.published_at > $1 AND pm.published_at <= $2
+		ORDER BY pm.published_at
+	`, after, until)
+}
+
+// MarkSavedSearchesChecked records that listings published up to checkedAt were checked against the searches
+func MarkSavedSearchesChecked(ctx context.Context, searchIDs []int, checkedAt time.Time) error {
+	if _, err := Exec(ctx, `
+		UPDATE saved_searches SET last_checked_at = $2 WHERE id = ANY($1) AND last_checked_at < $2
+	`, searchIDs, checkedAt); err != nil {
+		return fmt.Errorf("failed to mark saved searches checked: %w", err)
+	}
+	return nil
+}
+
+// MarkSavedSearchAlerted records that a saved search just sent an alert
+func MarkSavedSearchAlerted(ctx context.Context, searchID int) error {
+	if _, err := Exec(ctx, `UPDATE saved_searches SET last_alerted_at = CURRENT_TIMESTAMP WHERE id = $1`, searchID); err != nil {
+		return fmt.Errorf("failed to mark saved search alerted: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"server/internal/models"
+)
+
+// ListingSearchFilters narrows a full-text marketplace search. Empty and nil fields match every listing.
+type ListingSearchFilters struct {
+	ListingType string
+	Category    string
+	ModelType   string
+	Framework   string
+	LicenseType string
+	Tags        []string // The listing must have every tag
+	MaxPrice    *int
+	MinRating   *float64
+	MinAccuracy *float64
+}
+
+// SearchPublishedModels runs a full-text search of the active listings the viewer can see, best
+// matches first. query uses web search syntax: quoted phrases, "or" and -excluded words. It also
+// returns how many listings match.
+func SearchPublishedModels(ctx context.Context, query string, filters ListingSearchFilters, viewerID, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	tags := make([]string, len(filters.Tags))
+	for i, tag := range filters.Tags {
+		tags[i] = strings.ToLower(tag)
+	}
+	where := `
+		FROM published_models pm
+		CROSS JOIN websearch_to_tsquery('english', $1) AS query
+		LEFT JOIN users u ON pm.publisher_id = u.id
+		WHERE pm.is_active = true AND pm.search_vector @@ query AND ` + listingVisibleTo("$2") + `
+			AND ($3 = '' OR pm.listing_type = $3)
+			AND ($4 = '' OR LOWER(pm.category) = LOWER($4))
+			AND ($5 = '' OR LOWER(pm.model_type) = LOWER($5))
+			AND ($6 = '' OR LOWER(pm.framework) = LOWER($6))
+			AND ($7 = '' OR LOWER(pm.license_type) = LOWER($7))
+			AND (cardinality($8::TEXT[]) = 0
+				OR $8::TEXT[] <@ ARRAY(SELECT LOWER(t) FROM unnest(pm.tags) AS t))
+			AND ($9::INT IS NULL OR pm.price <= $9)
+			AND ($10::FLOAT8 IS NULL OR pm.rating_average >= $10)
+			AND ($11::FLOAT8 IS NULL OR pm.accuracy_score >= $11)`
+	args := []interface{}{query, viewerID, filters.ListingType, filters.Category, filters.ModelType,
+		filters.Framework, filters.LicenseType, tags, filters.MaxPrice, filters.MinRating, filters.MinAccuracy}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	results, err := Query(ctx, `
+		SELECT pm.id, pm.model_id, pm.publisher_id, pm.name, pm.picture, pm.description, pm.short_description,
+			pm.price, pm.category, pm.tags, pm.model_type, pm.framework, pm.file_size, pm.accuracy_score,
+			pm.primary_metric, pm.primary_metric_direction, pm.primary_metric_value,
+			pm.license_type, pm.downloads_count, pm.views_count, pm.rating_average, pm.rating_count,
+			pm.is_featured, pm.published_at, pm.updated_at, pm.listing_type, pm.installs_count, pm.version,
+			pm.rental_price, pm.rental_days, pm.visibility, pm.organization_id, pm.deprecated_at, pm.successor_id,
+			pm.sunset_at, u.username AS publisher_username,
+			ts_rank_cd(pm.search_vector, query) AS rank,
+			ts_headline('english', COALESCE(NULLIF(pm.short_description, ''), pm.description, ''), query,
+				'MaxWords=30, MinWords=10') AS headline
+		`+where+`
+		ORDER BY rank DESC, pm.downloads_count DESC, pm.published_at DESC
+		LIMIT $12 OFFSET $13
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search published models: %w", err)
+	}
+	// Convert picture paths from "./uploads/..." to "/uploads/..." like the marketplace does
+	for _, result := range results {
+		if picture, ok := result["picture"].(string); ok {
+			result["picture"] = strings.TrimPrefix(picture, ".")
+		}
+	}
+	return results, total, nil
+}
+
+// Types of dashboard search results
+const (
+	SearchResultModel   = "model"
+	SearchResultRun     = "run"
+	SearchResultListing = "listing"
+)
+
+// likeEscaper escapes the LIKE wildcards of a search query so they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUserWorkspace searches the user's own models (by name, training script, tags and notes),
+// training runs (by ID) and published listings (by name and tags) for the dashboard quick switcher. Substrings and
+// close misspellings match; results are typed and sorted by trigram similarity.
+func SearchUserWorkspace(ctx context.Context, userID int, query string, limit int) ([]map[string]interface{}, error) {
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+	results, err := Query(ctx, `
+		SELECT type, id, title, subtitle, model_id, score, updated_at FROM (
+			SELECT 'model' AS type, m.id, m.name AS title, m.training_script AS subtitle, m.id AS model_id,
+				GREATEST(similarity(m.name, $2), similarity(COALESCE(m.training_script, ''), $2),
+					word_similarity($2, COALESCE(m.notes, '')),
+					COALESCE((SELECT MAX(similarity(t, $2)) FROM unnest(m.tags) AS t), 0)) AS score,
+				m.updated_at
+			FROM models m
+			WHERE m.user_id = $1 AND (m.name ILIKE $3 OR m.training_script ILIKE $3 OR m.name % $2
+				OR m.notes ILIKE $3 OR EXISTS (SELECT 1 FROM unnest(m.tags) AS t WHERE t ILIKE $3))
+			UNION ALL
+			SELECT 'run', r.id, r.training_id, m.name, r.model_id, similarity(r.training_id, $2), r.created_at
+			FROM model_training_runs r
+			JOIN models m ON m.id = r.model_id
+			WHERE r.user_id = $1 AND r.training_id ILIKE $3
+			UNION ALL
+			SELECT 'listing', pm.id, pm.name, pm.short_description, pm.model_id,
+				GREATEST(similarity(pm.name, $2),
+					COALESCE((SELECT MAX(similarity(t, $2)) FROM unnest(pm.tags) AS t), 0)),
+				pm.updated_at
+			FROM published_models pm
+			WHERE pm.publisher_id = $1 AND (pm.name ILIKE $3 OR pm.name % $2
+				OR EXISTS (SELECT 1 FROM unnest(pm.tags) AS t WHERE t ILIKE $3))
+		) results
+		ORDER BY score DESC, updated_at DESC
+		LIMIT $4
+	`, userID, query, pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search workspace: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"server/internal/models"
+)
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+// Its whole session family is revoked since the token was likely stolen.
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+// StartSession saves the session of a user signing in from a device, with refreshToken valid until
+// expiresAt, and returns the ID of its family. Tokens the session is later rotated into keep the
+// family ID, which identifies the session to the user.
+func StartSession(ctx context.Context, userID int, email, refreshToken string, expiresAt time.Time, userAgent, ipAddress string) (string, error) {
+	if models.Pool == nil {
+		return "", fmt.Errorf("database connection not initialized")
+	}
+
+	var familyID string
+	err := models.Pool.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, email, refresh_token, expires_at, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+		RETURNING family_id::TEXT
+	`, userID, email, refreshToken, expiresAt, userAgent, ipAddress).Scan(&familyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert session: %w", err)
+	}
+	return familyID, nil
+}
+
+// RotateSession exchanges a refresh token for a new one: the old session is marked rotated and a
+// session of the same family is created with newToken until expiresAt. It returns the user_id,
+// email and family_id of the session, nil when the token is unknown or expired, or ErrRefreshTokenReused after
+// revoking the family when the token was already rotated.
+func RotateSession(ctx context.Context, refreshToken, newToken string, expiresAt time.Time) (map[string]interface{}, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		sessionID int
+		userID    int
+		email     string
+		familyID  string
+		rotatedAt *time.Time
+		expired   bool
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id, email, family_id::TEXT, rotated_at, expires_at <= NOW()
+		FROM sessions
+		WHERE refresh_token = $1
+		FOR UPDATE
+	`, refreshToken).Scan(&sessionID, &userID, &email, &familyID, &rotatedAt, &expired)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if rotatedAt != nil {
+		if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE family_id = $1::UUID`, familyID); err != nil {
+			return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return map[string]interface{}{"user_id": userID, "email": email}, ErrRefreshTokenReused
+	}
+	if expired {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE sessions SET rotated_at = NOW() WHERE id = $1`, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to rotate session: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO sessions (user_id, email, refresh_token, expires_at, family_id, user_agent, ip_address)
+		SELECT user_id, email, $2, $3, family_id, user_agent, ip_address
+		FROM sessions
+		WHERE id = $1
+	`, sessionID, newToken, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to insert session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return map[string]interface{}{"user_id": userID, "email": email, "family_id": familyID}, nil
+}
+
+// DeleteSession signs out the session of a refresh token, including the tokens it was rotated
+// from. It returns false when the token is unknown.
+func DeleteSession(ctx context.Context, refreshToken string) (bool, error) {
+	affected, err := Exec(ctx, `
+		DELETE FROM sessions
+		WHERE family_id = (SELECT family_id FROM sessions WHERE refresh_token = $1)
+	`, refreshToken)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete session: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// IsSessionActive reports whether a session family of a user can still be refreshed, that is it
+// was neither signed out, revoked nor left to expire
+func IsSessionActive(ctx context.Context, userID int, familyID string) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var active bool
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE user_id = $1 AND family_id::TEXT = $2 AND rotated_at IS NULL AND expires_at > NOW()
+		)
+	`, userID, familyID).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return active, nil
+}
+
+// GetUserSessions returns the active sessions of a user, one per family, most recently used
+// first: when it was signed in and last refreshed, when it expires and the device it was signed
+// in from
+func GetUserSessions(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	sessions, err := Query(ctx, `
+		SELECT s.family_id::TEXT AS id, s.user_agent, s.ip_address,
+			(SELECT MIN(f.created_at) FROM sessions f WHERE f.family_id = s.family_id) AS created_at,
+			s.created_at AS last_used_at, s.expires_at
+		FROM sessions s
+		WHERE s.user_id = $1 AND s.rotated_at IS NULL AND s.expires_at > NOW()
+		ORDER BY s.created_at DESC, s.id DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeUserSession signs a user out of a session family and reports whether the user had it
+func RevokeUserSession(ctx context.Context, userID int, familyID string) (bool, error) {
+	affected, err := Exec(ctx, `DELETE FROM sessions WHERE user_id = $1 AND family_id::TEXT = $2`, userID, familyID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RevokeUserSessions signs a user out of every session family except keepFamilyID, which may be
+// empty, and returns how many active sessions were revoked
+func RevokeUserSessions(ctx context.Context, userID int, keepFamilyID string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var revoked int
+	if err := models.Pool.QueryRow(ctx, `
+		WITH deleted AS (
+			DELETE FROM sessions
+			WHERE user_id = $1 AND family_id::TEXT <> $2
+			RETURNING rotated_at, expires_at
+		)
+		SELECT COUNT(*) FROM deleted WHERE rotated_at IS NULL AND expires_at > NOW()
+	`, userID, keepFamilyID).Scan(&revoked); err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return revoked, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// storagePathColumns are the columns holding paths of uploaded files, by table
+var storagePathColumns = map[string]map[string]bool{
+	"models":                {"picture": true, "trained_model_path": true},
+	"published_models":      {"picture": true, "trained_model_path": true, "template_path": true},
+	"publisher_storefronts": {"banner_path": true},
+	"model_versions":        {"artifact_path": true},
+}
+
+// GetStorageReferences returns every file path stored in the database: model folders, pictures
+// and trained models, listing pictures, models and template archives, storefront banners and the
+// trained models of model versions.
+// model_folder is the first folder of the model the row belongs to, if any.
+func GetStorageReferences(ctx context.Context) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT 'models' AS source, m.id, 'folder' AS field, f.path, m.folder[1] AS model_folder, NULL::text AS checksum
+		FROM models m, unnest(m.folder) AS f(path)
+		UNION ALL
+		SELECT 'models', m.id, 'picture', m.picture, m.folder[1], NULL FROM models m WHERE COALESCE(m.picture, '') <> ''
+		UNION ALL
+		SELECT 'models', m.id, 'trained_model_path', m.trained_model_path, m.folder[1], NULL FROM models m WHERE COALESCE(m.trained_model_path, '') <> ''
+		UNION ALL
+		SELECT 'published_models', pm.id, 'picture', pm.picture, m.folder[1], NULL
+		FROM published_models pm LEFT JOIN models m ON m.id = pm.model_id WHERE COALESCE(pm.picture, '') <> ''
+		UNION ALL
+		SELECT 'published_models', pm.id, 'trained_model_path', pm.trained_model_path, m.folder[1], pm.artifact_sha256
+		FROM published_models pm LEFT JOIN models m ON m.id = pm.model_id WHERE COALESCE(pm.trained_model_path, '') <> ''
+		UNION ALL
+		SELECT 'published_models', pm.id, 'template_path', pm.template_path, m.folder[1], NULL
+		FROM published_models pm LEFT JOIN models m ON m.id = pm.model_id WHERE COALESCE(pm.template_path, '') <> ''
+		UNION ALL
+		SELECT 'publisher_storefronts', s.publisher_id, 'banner_path', s.banner_path, NULL, NULL
+		FROM publisher_storefronts s WHERE COALESCE(s.banner_path, '') <> ''
+		UNION ALL
+		SELECT 'model_versions', v.id, 'artifact_path', v.artifact_path, NULL, v.artifact_sha256
+		FROM model_versions v WHERE v.artifact_path IS NOT NULL
+	`)
+}
+
+// RelinkStoragePath points a file column of a row at a new path, as long as it still holds oldPath.
+// Storefronts are identified by their publisher.
+func RelinkStoragePath(ctx context.Context, table, column string, id int, oldPath, newPath string) error {
+	if !storagePathColumns[table][column] {
+		return fmt.Errorf("%s.%s is not a file path column", table, column)
+	}
+	key := "id"
+	if table == "publisher_storefronts" {
+		key = "publisher_id"
+	}
+
+	updated, err := Exec(ctx, fmt.Sprintf(`UPDATE %s SET %s = $3 WHERE %s = $1 AND %s = $2`, table, column, key, column), id, oldPath, newPath)
+	if err != nil {
+		return fmt.Errorf("failed to relink %s.%s of %d: %w", table, column, id, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%s %d no longer references %s", table, id, oldPath)
+	}
+	return nil
+}
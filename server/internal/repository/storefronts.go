@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"server/internal/models"
+)
+
+// GetStorefront returns a publisher's storefront settings, or nil if they never customized it
+func GetStorefront(ctx context.Context, publisherID int) (map[string]interface{}, error) {
+	row, err := QueryRow(ctx, `
+		SELECT tagline, banner_path, updated_at FROM publisher_storefronts WHERE publisher_id = $1
+	`, publisherID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return row, err
+}
+
+// UpsertStorefront sets a publisher's tagline. A nil tagline leaves it unchanged.
+func UpsertStorefront(ctx context.Context, publisherID int, tagline *string) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO publisher_storefronts (publisher_id, tagline)
+		VALUES ($1, $2)
+		ON CONFLICT (publisher_id) DO UPDATE SET tagline = COALESCE(EXCLUDED.tagline, publisher_storefronts.tagline)
+	`, publisherID, tagline); err != nil {
+		return fmt.Errorf("failed to update storefront: %w", err)
+	}
+	return nil
+}
+
+// SetStorefrontBanner stores the path of a publisher's banner image and returns the previous one
+func SetStorefrontBanner(ctx context.Context, publisherID int, bannerPath string) (string, error) {
+	if models.Pool == nil {
+		return "", fmt.Errorf("database connection not initialized")
+	}
+
+	var previous *string
+	err := models.Pool.QueryRow(ctx, `
+		WITH old AS (SELECT banner_path FROM publisher_storefronts WHERE publisher_id = $1)
+		INSERT INTO publisher_storefronts (publisher_id, banner_path)
+		VALUES ($1, $2)
+		ON CONFLICT (publisher_id) DO UPDATE SET banner_path = EXCLUDED.banner_path
+		RETURNING (SELECT banner_path FROM old)
+	`, publisherID, bannerPath).Scan(&previous)
+	if err != nil {
+		return "", fmt.Errorf("failed to update banner: %w", err)
+	}
+	if previous == nil {
+		return "", nil
+	}
+	return *previous, nil
+}
+
+// SetStorefrontListings replaces a publisher's listing order. Listings are shown in the given
+// order, pinned ones first; pinned listings missing from the order are placed before it.
+func SetStorefrontListings(ctx context.Context, publisherID int, order, pinned []int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM storefront_listings WHERE publisher_id = $1`, publisherID); err != nil {
+		return fmt.Errorf("failed to clear storefront order: %w", err)
+	}
+
+	isPinned := make(map[int]bool, len(pinned))
+	for _, id := range pinned {
+		isPinned[id] = true
+	}
+	position := 0
+	add := func(listingID int) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO storefront_listings (publisher_id, published_model_id, position, pinned)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (publisher_id, published_model_id) DO NOTHING
+		`, publisherID, listingID, position, isPinned[listingID])
+		position++
+		return err
+	}
+	for _, listingID := range pinned {
+		if err := add(listingID); err != nil {
+			return fmt.Errorf("failed to pin listing %d: %w", listingID, err)
+		}
+	}
+	for _, listingID := range order {
+		if err := add(listingID); err != nil {
+			return fmt.Errorf("failed to order listing %d: %w", listingID, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("✅ Updated storefront order of publisher %d (%d pinned)", publisherID, len(pinned))
+	return nil
+}
+
+// GetStorefrontListings returns a publisher's active listings in storefront order:
+// pinned first, then the custom order, then the rest newest first
+func GetStorefrontListings(ctx context.Context, publisherID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT pm.id, pm.name, pm.picture, pm.short_description, pm.price, pm.category, pm.tags,
+			pm.listing_type, pm.license_type, pm.version, pm.downloads_count, pm.views_count,
+			pm.rating_average, pm.rating_count, pm.published_at, pm.visibility,
+			COALESCE(sl.pinned, false) AS pinned
+		FROM published_models pm
+		LEFT JOIN storefront_listings sl
+			ON sl.publisher_id = pm.publisher_id AND sl.published_model_id = pm.id
+		WHERE pm.publisher_id = $1 AND pm.is_active = true
+		ORDER BY COALESCE(sl.pinned, false) DESC, sl.position ASC NULLS LAST, pm.published_at DESC
+	`, publisherID)
+}
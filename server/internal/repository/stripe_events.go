@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"server/internal/models"
+)
+
+// Statuses of a Stripe webhook event
+const (
+	StripeEventProcessing = "processing"
+	StripeEventProcessed  = "processed"
+	StripeEventFailed     = "failed"
+)
+
+// stripeEventStaleAfter is how long an event can stay processing before a retry may claim it,
+// for a server that stopped while applying it
+const stripeEventStaleAfter = 10 * time.Minute
+
+// ClaimStripeEvent records a received Stripe event and reports whether the caller should apply it.
+// It is false when the event was already processed, or is being processed by another request; a
+// failed event is claimed again so that Stripe retries can apply it.
+func ClaimStripeEvent(ctx context.Context, id, eventType string, livemode bool, payload []byte, created time.Time) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var attempts int
+	err := models.Pool.QueryRow(ctx, `
+		INSERT INTO stripe_events (id, type, livemode, payload, stripe_created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE
+		SET status = 'processing', error = NULL, attempts = stripe_events.attempts + 1,
+			last_attempt_at = CURRENT_TIMESTAMP
+		WHERE stripe_events.status = 'failed'
+		   OR (stripe_events.status = 'processing' AND stripe_events.last_attempt_at < $6)
+		RETURNING attempts
+	`, id, eventType, livemode, payload, created, time.Now().Add(-stripeEventStaleAfter)).Scan(&attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record stripe event: %w", err)
+	}
+	return true, nil
+}
+
+// FinishStripeEvent marks a claimed event processed, or failed with the error that stopped it
+func FinishStripeEvent(ctx context.Context, id string, failure error) error {
+	status, message := StripeEventProcessed, ""
+	if failure != nil {
+		status, message = StripeEventFailed, failure.Error()
+	}
+	if _, err := Exec(ctx, `
+		UPDATE stripe_events
+		SET status = $2, error = NULLIF($3, ''),
+			processed_at = CASE WHEN $2 = 'processed' THEN CURRENT_TIMESTAMP ELSE processed_at END
+		WHERE id = $1
+	`, id, status, message); err != nil {
+		return fmt.Errorf("failed to update stripe event: %w", err)
+	}
+	return nil
+}
+
+// GetStripeEvents returns a page of webhook events, most recently received first, without their
+// payload, with the total number of them. Empty status and eventType match every event.
+func GetStripeEvents(ctx context.Context, status, eventType string, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	where := ` WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)`
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM stripe_events`+where, status, eventType).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count stripe events: %w", err)
+	}
+
+	events, err := Query(ctx, `
+		SELECT id, type, livemode, status, error, attempts, stripe_created_at, received_at,
+			last_attempt_at, processed_at
+		FROM stripe_events`+where+`
+		ORDER BY received_at DESC, id
+		LIMIT $3 OFFSET $4
+	`, status, eventType, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get stripe events: %w", err)
+	}
+	return events, total, nil
+}
+
+// GetStripeEvent returns a webhook event with its payload, or pgx.ErrNoRows
+func GetStripeEvent(ctx context.Context, id string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, type, livemode, payload, status, error, attempts, stripe_created_at, received_at,
+			last_attempt_at, processed_at
+		FROM stripe_events
+		WHERE id = $1
+	`, id)
+}
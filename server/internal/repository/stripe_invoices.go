@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"server/internal/models"
+)
+
+// StripeInvoice is the cached copy of a user's Stripe invoice. Amounts are in cents.
+type StripeInvoice struct {
+	ID               string
+	Number           string
+	Status           string
+	Currency         string
+	AmountDue        int64
+	AmountPaid       int64
+	Total            int64
+	HostedInvoiceURL string
+	InvoicePDF       string
+	PeriodStart      time.Time
+	PeriodEnd        time.Time
+	CreatedAt        time.Time
+}
+
+// nullTime is nil for the zero time, for optional timestamp columns
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// UpsertStripeInvoices stores a user's invoices as Stripe returned them
+func UpsertStripeInvoices(ctx context.Context, userID int, invoices []StripeInvoice) error {
+	for _, invoice := range invoices {
+		if _, err := Exec(ctx, `
+			INSERT INTO stripe_invoices (id, user_id, number, status, currency, amount_due, amount_paid, total,
+				hosted_invoice_url, invoice_pdf, period_start, period_end, created_at)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), $11, $12, $13)
+			ON CONFLICT (id) DO UPDATE
+			SET user_id = EXCLUDED.user_id,
+				number = EXCLUDED.number,
+				status = EXCLUDED.status,
+				currency = EXCLUDED.currency,
+				amount_due = EXCLUDED.amount_due,
+				amount_paid = EXCLUDED.amount_paid,
+				total = EXCLUDED.total,
+				hosted_invoice_url = EXCLUDED.hosted_invoice_url,
+				invoice_pdf = EXCLUDED.invoice_pdf,
+				period_start = EXCLUDED.period_start,
+				period_end = EXCLUDED.period_end,
+				synced_at = CURRENT_TIMESTAMP
+		`, invoice.ID, userID, invoice.Number, invoice.Status, invoice.Currency, invoice.AmountDue,
+			invoice.AmountPaid, invoice.Total, invoice.HostedInvoiceURL, invoice.InvoicePDF,
+			nullTime(invoice.PeriodStart), nullTime(invoice.PeriodEnd), invoice.CreatedAt); err != nil {
+			return fmt.Errorf("failed to save invoice %s: %w", invoice.ID, err)
+		}
+	}
+	return nil
+}
+
+// MarkInvoicesSynced records that a user's invoices were just fetched from Stripe
+func MarkInvoicesSynced(ctx context.Context, userID int) error {
+	if _, err := Exec(ctx, `UPDATE users SET invoices_synced_at = CURRENT_TIMESTAMP WHERE id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to mark invoices synced: %w", err)
+	}
+	return nil
+}
+
+// InvoicesSyncedSince reports whether a user's invoices were fetched from Stripe after since
+func InvoicesSyncedSince(ctx context.Context, userID int, since time.Time) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	var fresh bool
+	if err := models.Pool.QueryRow(ctx, `
+		SELECT COALESCE(invoices_synced_at > $2, false) FROM users WHERE id = $1
+	`, userID, since).Scan(&fresh); err != nil {
+		return false, fmt.Errorf("failed to get invoice sync time: %w", err)
+	}
+	return fresh, nil
+}
+
+// GetUserInvoices returns a page of a user's cached invoices, newest first, with the total number
+// of them
+func GetUserInvoices(ctx context.Context, userID, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM stripe_invoices WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count invoices: %w", err)
+	}
+
+	invoices, err := Query(ctx, `
+		SELECT id, number, status, currency, amount_due, amount_paid, total, hosted_invoice_url,
+			invoice_pdf, period_start, period_end, created_at
+		FROM stripe_invoices
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get invoices: %w", err)
+	}
+	return invoices, total, nil
+}
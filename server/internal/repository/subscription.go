@@ -116,65 +116,3 @@ func GetUserEmailByStripeCustomer(ctx context.Context, stripeCustomerID string)
 
 	return email, nil
 }
-
-// DecrementUserTrainingCredits decrements training credits for a user
-func DecrementUserTrainingCredits(ctx context.Context, userEmail string) error {
-	if models.Pool == nil {
-		return fmt.Errorf("database connection not initialized")
-	}
-
-	if ctx == nil {
-		ctx = context.Background()
-	}
-
-	query := `
-		UPDATE users
-		SET training_credits = GREATEST(training_credits - 1, 0), updated_at = $1
-		WHERE email = $2 AND training_credits > 0
-	`
-
-	result, err := models.Pool.Exec(ctx, query, time.Now(), userEmail)
-	if err != nil {
-		return fmt.Errorf("failed to decrement training credits: %w", err)
-	}
-
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("no credits to decrement or user not found")
-	}
-
-	log.Printf("✅ Decremented training credits for user: %s", userEmail)
-	return nil
-}
-
-// ResetMonthlyCreditsForAllUsers resets training credits for all users based on their tier
-func ResetMonthlyCreditsForAllUsers(ctx context.Context) error {
-	if models.Pool == nil {
-		return fmt.Errorf("database connection not initialized")
-	}
-
-	if ctx == nil {
-		ctx = context.Background()
-	}
-
-	query := `
-		UPDATE users
-		SET training_credits = CASE
-			WHEN subscription_tier = 'basic' THEN 10
-			WHEN subscription_tier = 'pro' THEN 50
-			WHEN subscription_tier = 'enterprise' THEN 999
-			ELSE 0
-		END,
-		updated_at = $1
-		WHERE subscription_tier != 'free'
-	`
-
-	result, err := models.Pool.Exec(ctx, query, time.Now())
-	if err != nil {
-		return fmt.Errorf("failed to reset monthly credits: %w", err)
-	}
-
-	rowsAffected := result.RowsAffected()
-	log.Printf("✅ Reset monthly credits for %d users", rowsAffected)
-	return nil
-}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"server/internal/models"
+)
+
+// RecordTemplateInstall records a pipeline template install and bumps the listing's install and download counters
+func RecordTemplateInstall(ctx context.Context, publishedModelID, userID, modelID int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	tx, err := models.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO template_installs (published_model_id, user_id, model_id)
+		VALUES ($1, $2, $3)
+	`, publishedModelID, userID, modelID); err != nil {
+		return fmt.Errorf("failed to record template install: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE published_models
+		SET installs_count = installs_count + 1,
+			downloads_count = downloads_count + 1
+		WHERE id = $1
+	`, publishedModelID); err != nil {
+		return fmt.Errorf("failed to increment installs: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("✅ Recorded install of template %d by user %d (model %d)", publishedModelID, userID, modelID)
+	return nil
+}
+
+// GetTemplateInstalls returns the installs of a pipeline template, newest first
+func GetTemplateInstalls(ctx context.Context, publishedModelID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT ti.id, ti.user_id, u.username, ti.model_id, ti.installed_at
+		FROM template_installs ti
+		LEFT JOIN users u ON ti.user_id = u.id
+		WHERE ti.published_model_id = $1
+		ORDER BY ti.installed_at DESC
+	`, publishedModelID)
+}
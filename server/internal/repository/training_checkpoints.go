@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// RecordTrainingCheckpoint stores a checkpoint a training saved, updating it if it was saved again
+func RecordTrainingCheckpoint(ctx context.Context, trainingID, path string, epoch int, isBest bool, sizeBytes int64) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO training_checkpoints (training_id, path, epoch, is_best, size_bytes)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (training_id, path) DO UPDATE SET
+			epoch = EXCLUDED.epoch, is_best = EXCLUDED.is_best, size_bytes = EXCLUDED.size_bytes,
+			created_at = CURRENT_TIMESTAMP
+	`, trainingID, path, epoch, isBest, sizeBytes); err != nil {
+		return fmt.Errorf("failed to record checkpoint: %w", err)
+	}
+	return nil
+}
+
+// DeleteTrainingCheckpoint forgets a checkpoint that was pruned
+func DeleteTrainingCheckpoint(ctx context.Context, trainingID, path string) error {
+	if _, err := Exec(ctx, `
+		DELETE FROM training_checkpoints WHERE training_id = $1 AND path = $2
+	`, trainingID, path); err != nil {
+		return fmt.Errorf("failed to delete checkpoint: %w", err)
+	}
+	return nil
+}
+
+// GetTrainingCheckpoints lists the kept checkpoints of a training, oldest first
+func GetTrainingCheckpoints(ctx context.Context, trainingID string) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT path, epoch, is_best, size_bytes, created_at
+		FROM training_checkpoints
+		WHERE training_id = $1
+		ORDER BY created_at, id
+	`, trainingID)
+}
+
+// SetTrainingRunRequest stores the request a server training was started with
+func SetTrainingRunRequest(ctx context.Context, trainingID string, request []byte) error {
+	if _, err := Exec(ctx, `
+		UPDATE model_training_runs SET request = $2 WHERE training_id = $1
+	`, trainingID, request); err != nil {
+		return fmt.Errorf("failed to record training request: %w", err)
+	}
+	return nil
+}
+
+// GetTrainingRunRequest returns the model and request of one of a user's server trainings.
+// It returns pgx.ErrNoRows when the user has no such training.
+func GetTrainingRunRequest(ctx context.Context, trainingID string, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT training_id, model_id, request
+		FROM model_training_runs
+		WHERE training_id = $1 AND user_id = $2 AND training_type = 'server'
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, trainingID, userID)
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxMetricHistoryRows caps how many metric rows a single history query returns
+const maxMetricHistoryRows = 50000
+
+// RecordTrainingMetrics stores one metrics line of a training. Metrics that were not reported
+// (zero) are stored as NULL so charts do not drop to zero.
+func RecordTrainingMetrics(ctx context.Context, trainingID string, userID int, model string, epoch, totalEpochs int,
+	trainLoss, valLoss, trainAccuracy, valAccuracy, testAccuracy float64, customMetrics map[string]interface{}, recordedAt time.Time) error {
+	if len(customMetrics) == 0 {
+		customMetrics = nil
+	}
+	if _, err := Exec(ctx, `
+		INSERT INTO training_metric_history
+			(training_id, user_id, model, epoch, total_epochs, train_loss, val_loss, train_accuracy, val_accuracy, test_accuracy, custom_metrics, recorded_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), NULLIF($8, 0), NULLIF($9, 0), NULLIF($10, 0), $11, $12)
+	`, trainingID, userID, model, epoch, totalEpochs, trainLoss, valLoss, trainAccuracy, valAccuracy, testAccuracy, customMetrics, recordedAt); err != nil {
+		return fmt.Errorf("failed to record training metrics: %w", err)
+	}
+	return nil
+}
+
+// GetTrainingMetricModels returns the models a user has metric history for
+func GetTrainingMetricModels(ctx context.Context, userID int) ([]string, error) {
+	rows, err := Query(ctx, `
+		SELECT DISTINCT model FROM training_metric_history WHERE user_id = $1 ORDER BY model
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if name, ok := row["model"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// GetCustomMetricNames returns the custom metric names a user's trainings reported
+func GetCustomMetricNames(ctx context.Context, userID int) ([]string, error) {
+	rows, err := Query(ctx, `
+		SELECT DISTINCT jsonb_object_keys(custom_metrics) AS name
+		FROM training_metric_history
+		WHERE user_id = $1 AND custom_metrics IS NOT NULL
+		ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if name, ok := row["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// GetTrainingMetricHistory returns the metrics a user's trainings reported between from and to,
+// ordered by training and time. An empty model returns every model.
+func GetTrainingMetricHistory(ctx context.Context, userID int, model string, from, to time.Time) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT training_id, model, epoch, total_epochs, train_loss, val_loss, train_accuracy, val_accuracy, test_accuracy,
+			custom_metrics, recorded_at
+		FROM training_metric_history
+		WHERE user_id = $1 AND ($2 = '' OR model = $2) AND recorded_at BETWEEN $3 AND $4
+		ORDER BY training_id, recorded_at
+		LIMIT $5
+	`, userID, model, from, to, maxMetricHistoryRows)
+}
+
+// GetTrainingRunSpans returns when each of a user's trainings reported its first and last metrics,
+// for trainings that overlap from and to
+func GetTrainingRunSpans(ctx context.Context, userID int, from, to time.Time) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT training_id, model, MIN(recorded_at) AS started_at, MAX(recorded_at) AS ended_at, MAX(epoch) AS epochs
+		FROM training_metric_history
+		WHERE user_id = $1
+		GROUP BY training_id, model
+		HAVING MAX(recorded_at) >= $2 AND MIN(recorded_at) <= $3
+		ORDER BY started_at
+	`, userID, from, to)
+}
+
+// GetListingDeployments returns the listings a publisher first published or shipped a new version of
+// between from and to
+func GetListingDeployments(ctx context.Context, publisherID int, from, to time.Time) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT id, name, version, published_at, version_published_at
+		FROM published_models
+		WHERE publisher_id = $1
+			AND (published_at BETWEEN $2 AND $3 OR version_published_at BETWEEN $2 AND $3)
+		ORDER BY version_published_at
+	`, publisherID, from, to)
+}
@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"server/internal/models"
+)
+
+// GetModelTrainingSettings returns the training settings for a model, falling back to defaults
+func GetModelTrainingSettings(ctx context.Context, modelID int) (map[string]interface{}, error) {
+	settings, err := QueryRow(ctx, `
+		SELECT model_id, server_training_policy, agent_training_policy, default_monthly_cap,
+			anomaly_auto_stop, anomaly_frozen_epochs, anomaly_exploding_factor, anomaly_accuracy_drop, updated_at
+		FROM model_training_settings
+		WHERE model_id = $1
+	`, modelID)
+	if err == pgx.ErrNoRows {
+		return map[string]interface{}{
+			"model_id":                 int32(modelID),
+			"server_training_policy":   "owner",
+			"agent_training_policy":    "members",
+			"default_monthly_cap":      nil,
+			"anomaly_auto_stop":        false,
+			"anomaly_frozen_epochs":    int32(5),
+			"anomaly_exploding_factor": float64(10),
+			"anomaly_accuracy_drop":    0.5,
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get training settings: %w", err)
+	}
+	return settings, nil
+}
+
+// UpsertModelTrainingSettings creates or updates the training settings for a model
+func UpsertModelTrainingSettings(ctx context.Context, modelID int, serverPolicy, agentPolicy string, defaultCap *int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		INSERT INTO model_training_settings (model_id, server_training_policy, agent_training_policy, default_monthly_cap)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (model_id) DO UPDATE
+		SET server_training_policy = EXCLUDED.server_training_policy,
+			agent_training_policy = EXCLUDED.agent_training_policy,
+			default_monthly_cap = EXCLUDED.default_monthly_cap
+	`
+
+	if _, err := models.Pool.Exec(ctx, query, modelID, serverPolicy, agentPolicy, defaultCap); err != nil {
+		return fmt.Errorf("failed to save training settings: %w", err)
+	}
+
+	log.Printf("✅ Updated training settings for model %d", modelID)
+	return nil
+}
+
+// UpsertModelAnomalyPolicy sets how the anomaly detector treats a model's trainings
+func UpsertModelAnomalyPolicy(ctx context.Context, modelID int, autoStop bool, frozenEpochs int, explodingFactor, accuracyDrop float64) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO model_training_settings (model_id, anomaly_auto_stop, anomaly_frozen_epochs, anomaly_exploding_factor, anomaly_accuracy_drop)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (model_id) DO UPDATE
+		SET anomaly_auto_stop = EXCLUDED.anomaly_auto_stop,
+			anomaly_frozen_epochs = EXCLUDED.anomaly_frozen_epochs,
+			anomaly_exploding_factor = EXCLUDED.anomaly_exploding_factor,
+			anomaly_accuracy_drop = EXCLUDED.anomaly_accuracy_drop
+	`, modelID, autoStop, frozenEpochs, explodingFactor, accuracyDrop); err != nil {
+		return fmt.Errorf("failed to save anomaly policy: %w", err)
+	}
+	return nil
+}
+
+// GetModelTrainingMember returns a member's entry for a model, or nil if the user is not a member
+func GetModelTrainingMember(ctx context.Context, modelID, userID int) (map[string]interface{}, error) {
+	member, err := QueryRow(ctx, `
+		SELECT model_id, user_id, monthly_cap, created_at
+		FROM model_training_members
+		WHERE model_id = $1 AND user_id = $2
+	`, modelID, userID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return member, err
+}
+
+// GetModelTrainingMembers lists the members of a model with their server trainings this month
+func GetModelTrainingMembers(ctx context.Context, modelID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT m.user_id, u.username, u.email, m.monthly_cap, m.created_at,
+			(SELECT COUNT(*) FROM model_training_runs r
+			 WHERE r.model_id = m.model_id AND r.user_id = m.user_id AND r.training_type = 'server'
+			 AND r.created_at >= date_trunc('month', CURRENT_TIMESTAMP)) AS trainings_this_month
+		FROM model_training_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.model_id = $1
+		ORDER BY m.created_at ASC
+	`, modelID)
+}
+
+// UpsertModelTrainingMember adds a member to a model or updates their monthly cap
+func UpsertModelTrainingMember(ctx context.Context, modelID, userID int, monthlyCap *int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		INSERT INTO model_training_members (model_id, user_id, monthly_cap)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (model_id, user_id) DO UPDATE
+		SET monthly_cap = EXCLUDED.monthly_cap
+	`
+
+	if _, err := models.Pool.Exec(ctx, query, modelID, userID, monthlyCap); err != nil {
+		return fmt.Errorf("failed to save training member: %w", err)
+	}
+
+	log.Printf("✅ User %d can now train model %d", userID, modelID)
+	return nil
+}
+
+// RemoveModelTrainingMember removes a member from a model
+func RemoveModelTrainingMember(ctx context.Context, modelID, userID int) error {
+	affected, err := Exec(ctx, `DELETE FROM model_training_members WHERE model_id = $1 AND user_id = $2`, modelID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove training member: %w", err)
+	}
+	if affected == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetTrainableModelsForMember returns models owned by others that the user is a member of
+func GetTrainableModelsForMember(ctx context.Context, userID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT md.id, md.user_id, md.name, md.picture, md.folder, md.training_script, md.trained_model_path,
+			md.trained_at, md.accuracy_score, md.created_at, md.updated_at
+		FROM models md
+		JOIN model_training_members m ON m.model_id = md.id
+		WHERE m.user_id = $1
+		ORDER BY md.created_at DESC
+	`, userID)
+}
+
+// CountMonthlyTrainingRuns counts the trainings of a given type a user started on a model this month
+func CountMonthlyTrainingRuns(ctx context.Context, modelID, userID int, trainingType string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		SELECT COUNT(*) FROM model_training_runs
+		WHERE model_id = $1 AND user_id = $2 AND training_type = $3
+		AND created_at >= date_trunc('month', CURRENT_TIMESTAMP)
+	`
+
+	var count int
+	if err := models.Pool.QueryRow(ctx, query, modelID, userID, trainingType).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count training runs: %w", err)
+	}
+	return count, nil
+}
+
+// RecordModelTrainingRun stores a started training so it counts towards monthly caps.
+// An empty executionMode is stored as on_demand. The approval request the training was
+// allowed with is marked used in the same statement; if a concurrent start used it first,
+// the run is stored without it.
+func RecordModelTrainingRun(ctx context.Context, modelID, userID int, trainingID, trainingType, executionMode string, approvalRequestID *int) error {
+	if models.Pool == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+
+	var id interface{}
+	if trainingID != "" {
+		id = trainingID
+	}
+
+	query := `
+		WITH approval AS (
+			UPDATE training_approval_requests SET status = 'used'
+			WHERE id = $5 AND status = 'approved'
+			RETURNING id
+		)
+		INSERT INTO model_training_runs (model_id, user_id, training_id, training_type, approval_request_id, execution_mode, organization_id)
+		VALUES ($1, $2, $3, $4, (SELECT id FROM approval), COALESCE(NULLIF($6, ''), 'on_demand'), (SELECT organization_id FROM models WHERE id = $1))
+	`
+
+	if _, err := models.Pool.Exec(ctx, query, modelID, userID, id, trainingType, approvalRequestID, executionMode); err != nil {
+		return fmt.Errorf("failed to record training run: %w", err)
+	}
+	return nil
+}
+
+// CreateTrainingApprovalRequest creates a pending approval request for a training over the cap
+func CreateTrainingApprovalRequest(ctx context.Context, modelID, requesterID int, trainingType, reason string) (int, error) {
+	if models.Pool == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		INSERT INTO training_approval_requests (model_id, requester_id, training_type, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	var id int
+	if err := models.Pool.QueryRow(ctx, query, modelID, requesterID, trainingType, reason).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create approval request: %w", err)
+	}
+
+	log.Printf("✅ Created training approval request %d for model %d by user %d", id, modelID, requesterID)
+	return id, nil
+}
+
+// GetTrainingApprovalRequest retrieves an approval request by ID
+func GetTrainingApprovalRequest(ctx context.Context, requestID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, model_id, requester_id, training_type, reason, status, decided_by, decided_at, created_at
+		FROM training_approval_requests
+		WHERE id = $1
+	`, requestID)
+}
+
+// GetTrainingApprovalRequests lists approval requests for a model. If requesterID is non-zero
+// only that user's requests are returned.
+func GetTrainingApprovalRequests(ctx context.Context, modelID, requesterID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT a.id, a.model_id, a.requester_id, u.username AS requester_username, a.training_type,
+			a.reason, a.status, a.decided_by, a.decided_at, a.created_at
+		FROM training_approval_requests a
+		JOIN users u ON u.id = a.requester_id
+		WHERE a.model_id = $1 AND ($2 = 0 OR a.requester_id = $2)
+		ORDER BY a.created_at DESC
+	`, modelID, requesterID)
+}
+
+// HasPendingTrainingApproval reports whether the user already has a pending request for a model
+func HasPendingTrainingApproval(ctx context.Context, modelID, requesterID int, trainingType string) (bool, error) {
+	if models.Pool == nil {
+		return false, fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM training_approval_requests
+			WHERE model_id = $1 AND requester_id = $2 AND training_type = $3 AND status = 'pending'
+		)
+	`
+
+	var exists bool
+	if err := models.Pool.QueryRow(ctx, query, modelID, requesterID, trainingType).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check pending approvals: %w", err)
+	}
+	return exists, nil
+}
+
+// DecideTrainingApprovalRequest approves or rejects a pending approval request
+func DecideTrainingApprovalRequest(ctx context.Context, requestID, decidedBy int, status string) error {
+	affected, err := Exec(ctx, `
+		UPDATE training_approval_requests
+		SET status = $1, decided_by = $2, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = 'pending'
+	`, status, decidedBy, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to update approval request: %w", err)
+	}
+	if affected == 0 {
+		return pgx.ErrNoRows
+	}
+
+	log.Printf("✅ Training approval request %d %s by user %d", requestID, status, decidedBy)
+	return nil
+}
+
+// FindTrainingApproval returns the ID of the user's oldest approved request for the model,
+// or nil if they have none left. The request is used when a run is recorded with it.
+func FindTrainingApproval(ctx context.Context, modelID, requesterID int, trainingType string) (*int, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	query := `
+		SELECT id FROM training_approval_requests
+		WHERE model_id = $1 AND requester_id = $2 AND training_type = $3 AND status = 'approved'
+		ORDER BY decided_at ASC
+		LIMIT 1
+	`
+
+	var id int
+	err := models.Pool.QueryRow(ctx, query, modelID, requesterID, trainingType).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find approval: %w", err)
+	}
+	return &id, nil
+}
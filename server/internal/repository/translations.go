@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+const (
+	// TranslationSourceMachine marks a translation generated with Gemini
+	TranslationSourceMachine = "machine"
+	// TranslationSourcePublisher marks a translation written by the publisher, which machine translations never overwrite
+	TranslationSourcePublisher = "publisher"
+)
+
+// SaveMachineTranslation stores a generated translation of a listing unless the publisher wrote one for that locale
+func SaveMachineTranslation(ctx context.Context, publishedModelID int, locale, description, shortDescription string) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO published_model_translations (published_model_id, locale, description, short_description, source)
+		VALUES ($1, $2, $3, NULLIF($4, ''), 'machine')
+		ON CONFLICT (published_model_id, locale) DO UPDATE
+		SET description = EXCLUDED.description,
+			short_description = EXCLUDED.short_description,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE published_model_translations.source = 'machine'
+	`, publishedModelID, locale, description, shortDescription); err != nil {
+		return fmt.Errorf("failed to save translation: %w", err)
+	}
+	return nil
+}
+
+// SavePublisherTranslation stores the publisher's own translation of a listing, replacing any machine translation
+func SavePublisherTranslation(ctx context.Context, publishedModelID int, locale, description, shortDescription string) error {
+	if _, err := Exec(ctx, `
+		INSERT INTO published_model_translations (published_model_id, locale, description, short_description, source)
+		VALUES ($1, $2, $3, NULLIF($4, ''), 'publisher')
+		ON CONFLICT (published_model_id, locale) DO UPDATE
+		SET description = EXCLUDED.description,
+			short_description = EXCLUDED.short_description,
+			source = 'publisher',
+			updated_at = CURRENT_TIMESTAMP
+	`, publishedModelID, locale, description, shortDescription); err != nil {
+		return fmt.Errorf("failed to save translation: %w", err)
+	}
+	return nil
+}
+
+// DeleteListingTranslation deletes a listing's translation for a locale and reports whether there was one
+func DeleteListingTranslation(ctx context.Context, publishedModelID int, locale string) (bool, error) {
+	deleted, err := Exec(ctx, `
+		DELETE FROM published_model_translations WHERE published_model_id = $1 AND locale = $2
+	`, publishedModelID, locale)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete translation: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// GetListingTranslations returns every translation of a listing ordered by locale
+func GetListingTranslations(ctx context.Context, publishedModelID int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT locale, description, short_description, source, created_at, updated_at
+		FROM published_model_translations
+		WHERE published_model_id = $1
+		ORDER BY locale
+	`, publishedModelID)
+}
+
+// GetTranslationsByLocale returns the translations into a locale keyed by published model ID
+func GetTranslationsByLocale(ctx context.Context, locale string) (map[int]map[string]interface{}, error) {
+	rows, err := Query(ctx, `
+		SELECT published_model_id, locale, description, short_description, source
+		FROM published_model_translations
+		WHERE locale = $1
+	`, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	translations := make(map[int]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		if id, ok := row["published_model_id"].(int32); ok {
+			translations[int(id)] = row
+		}
+	}
+	return translations, nil
+}
+
+// GetTranslationLocales returns the locales any listing is translated into
+func GetTranslationLocales(ctx context.Context) ([]string, error) {
+	if models.Pool == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	rows, err := models.Pool.Query(ctx, `SELECT DISTINCT locale FROM published_model_translations ORDER BY locale`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get translation locales: %w", err)
+	}
+	defer rows.Close()
+
+	var locales []string
+	for rows.Next() {
+		var locale string
+		if err := rows.Scan(&locale); err != nil {
+			return nil, fmt.Errorf("failed to scan locale: %w", err)
+		}
+		locales = append(locales, locale)
+	}
+	return locales, rows.Err()
+}
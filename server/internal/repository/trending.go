@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// TrendingWeights are how much each recent event adds to a listing's trending score. Events lose
+// half their weight every HalfLifeHours and are ignored after WindowDays.
+type TrendingWeights struct {
+	Download      float64
+	Like          float64
+	View          float64
+	Release       float64 // The listing being published or shipping a new version
+	HalfLifeHours float64
+	WindowDays    int
+}
+
+// decayed sums the decayed weight of the events of a listing pm in a table with its event time
+// column, using the half-life $5 and window $6 of RefreshTrendingScores
+func decayed(table, listingColumn, timeColumn string) string {
+	return fmt.Sprintf(`COALESCE((
+		SELECT SUM(POWER(0.5, EXTRACT(EPOCH FROM NOW() - e.%[3]s)::float8 / 3600 / $5))
+		FROM %[1]s e
+		WHERE e.%[2]s = pm.id AND e.%[3]s > NOW() - make_interval(days => $6::int)
+	), 0)`, table, listingColumn, timeColumn)
+}
+
+// RefreshTrendingScores recomputes the trending score of every active listing and returns how many
+// were updated
+func RefreshTrendingScores(ctx context.Context, weights TrendingWeights) (int64, error) {
+	updated, err := Exec(ctx, `
+		UPDATE published_models pm
+		SET trending_score =
+				$1 * `+decayed("model_download_ledger", "published_model_id", "downloaded_at")+`
+				+ $2 * `+decayed("model_likes", "published_model_id", "created_at")+`
+				+ $3 * `+decayed("model_views", "model_id", "viewed_at")+`
+				+ $4 * CASE WHEN pm.version_published_at > NOW() - make_interval(days => $6::int)
+					THEN POWER(0.5, EXTRACT(EPOCH FROM NOW() - pm.version_published_at)::float8 / 3600 / $5)
+					ELSE 0 END,
+			trending_computed_at = NOW()
+		WHERE pm.is_active = true
+	`, weights.Download, weights.Like, weights.View, weights.Release, weights.HalfLifeHours, weights.WindowDays)
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh trending scores: %w", err)
+	}
+	return updated, nil
+}
+
+// GetTrendingListings returns a page of the active listings the viewer can see, highest trending
+// score first, with the total number of them. An empty category matches every listing.
+func GetTrendingListings(ctx context.Context, viewerID int, category string, limit, offset int) ([]map[string]interface{}, int, error) {
+	if models.Pool == nil {
+		return nil, 0, fmt.Errorf("database connection not initialized")
+	}
+
+	where := `pm.is_active = true AND ($2 = '' OR pm.category = $2) AND ` + listingVisibleTo("$1")
+	var total int
+	if err := models.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM published_models pm WHERE `+where, viewerID, category).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count trending listings: %w", err)
+	}
+
+	listings, err := Query(ctx, `
+		SELECT pm.id, pm.name, pm.picture, pm.short_description, pm.price, pm.category, pm.tags,
+			pm.framework, pm.listing_type, pm.version, pm.rating_average, pm.rating_count,
+			pm.downloads_count, pm.views_count, pm.published_at, pm.trending_score,
+			u.username AS publisher_username
+		FROM published_models pm
+		LEFT JOIN users u ON u.id = pm.publisher_id
+		WHERE `+where+`
+		ORDER BY pm.trending_score DESC, pm.published_at DESC, pm.id DESC
+		LIMIT $3 OFFSET $4
+	`, viewerID, category, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get trending listings: %w", err)
+	}
+	return listings, total, nil
+}
+
+// GetSimilarListings returns up to limit active listings the viewer can see that share tags, the
+// category, framework or model type of a listing, most similar first. Each shared tag counts 3,
+// a shared category or framework 2 and a shared model type 1; ties go to the trending listing.
+func GetSimilarListings(ctx context.Context, listingID, viewerID, limit int) ([]map[string]interface{}, error) {
+	return Query(ctx, `
+		SELECT * FROM (
+			SELECT pm.id, pm.name, pm.picture, pm.short_description, pm.price, pm.category, pm.tags,
+				pm.framework, pm.model_type, pm.listing_type, pm.rating_average, pm.downloads_count,
+				pm.trending_score, u.username AS publisher_username,
+				(3 * COALESCE(cardinality(ARRAY(
+					SELECT LOWER(t) FROM unnest(pm.tags) t
+					INTERSECT
+					SELECT LOWER(t) FROM unnest(src.tags) t)), 0)
+				+ CASE WHEN pm.category IS NOT NULL AND pm.category = src.category THEN 2 ELSE 0 END
+				+ CASE WHEN pm.framework IS NOT NULL AND LOWER(pm.framework) = LOWER(src.framework) THEN 2 ELSE 0 END
+				+ CASE WHEN pm.model_type IS NOT NULL AND LOWER(pm.model_type) = LOWER(src.model_type) THEN 1 ELSE 0 END
+				) AS similarity
+			FROM published_models src
+			JOIN published_models pm ON pm.id <> src.id
+			LEFT JOIN users u ON u.id = pm.publisher_id
+			WHERE src.id = $1 AND pm.is_active = true AND `+listingVisibleTo("$2")+`
+		) candidates
+		WHERE similarity > 0
+		ORDER BY similarity DESC, trending_score DESC, id DESC
+		LIMIT $3
+	`, listingID, viewerID, limit)
+}
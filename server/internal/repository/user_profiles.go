@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// GetPublicProfile returns the public fields of a user found by username, or pgx.ErrNoRows.
+// Suspended users have no public profile.
+func GetPublicProfile(ctx context.Context, username string) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, username, COALESCE(bio, '') AS bio, COALESCE(avatar_path, '') AS avatar_path, created_at
+		FROM users
+		WHERE username = $1 AND suspended_at IS NULL
+	`, username)
+}
+
+// GetOwnProfile returns the editable profile fields of a user
+func GetOwnProfile(ctx context.Context, userID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT id, username, COALESCE(bio, '') AS bio, COALESCE(avatar_path, '') AS avatar_path, created_at
+		FROM users
+		WHERE id = $1
+	`, userID)
+}
+
+// GetPublisherStats sums up a publisher's active public listings: how many there are, their
+// downloads, and their average rating weighted by the number of ratings (nil without ratings)
+func GetPublisherStats(ctx context.Context, publisherID int) (map[string]interface{}, error) {
+	return QueryRow(ctx, `
+		SELECT COUNT(*)::int AS listings_count,
+			COALESCE(SUM(downloads_count), 0)::int AS downloads_count,
+			COALESCE(SUM(rating_count), 0)::int AS rating_count,
+			ROUND(SUM(rating_average * rating_count) / NULLIF(SUM(rating_count), 0), 2)::float8 AS rating_average
+		FROM published_models
+		WHERE publisher_id = $1 AND is_active = true AND visibility = $2
+	`, publisherID, ListingVisibilityPublic)
+}
+
+// UpdateUserBio sets the bio of a user; an empty bio clears it
+func UpdateUserBio(ctx context.Context, userID int, bio string) error {
+	if _, err := Exec(ctx, `UPDATE users SET bio = NULLIF($2, '') WHERE id = $1`, userID, bio); err != nil {
+		return fmt.Errorf("failed to update bio: %w", err)
+	}
+	return nil
+}
+
+// SetUserAvatar stores the path of a user's avatar image and returns the previous one.
+// An empty path removes the avatar.
+func SetUserAvatar(ctx context.Context, userID int, avatarPath string) (string, error) {
+	if models.Pool == nil {
+		return "", fmt.Errorf("database connection not initialized")
+	}
+
+	var previous *string
+	err := models.Pool.QueryRow(ctx, `
+		UPDATE users new SET avatar_path = NULLIF($2, '')
+		FROM users old
+		WHERE new.id = $1 AND old.id = new.id
+		RETURNING old.avatar_path
+	`, userID, avatarPath).Scan(&previous)
+	if err != nil {
+		return "", fmt.Errorf("failed to update avatar: %w", err)
+	}
+	if previous == nil {
+		return "", nil
+	}
+	return *previous, nil
+}
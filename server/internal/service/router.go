@@ -3,6 +3,7 @@ package service
 import (
 	"net/http"
 	"server/aiAgent"
+	"server/internal/apierrors"
 	"server/internal/handlers"
 	"server/internal/middlewares"
 
@@ -14,12 +15,30 @@ import (
 func NewRouter() http.Handler {
     r := chi.NewRouter()
 
+	// Tag every request with an ID, returned in X-Request-ID and error responses
+	r.Use(middlewares.RequestID)
 	r.Use(middlewares.WithCORS)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		apierrors.Respond(w, http.StatusNotFound, "Not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		apierrors.Respond(w, http.StatusMethodNotAllowed, "Method not allowed")
+	})
+	// Count requests and error responses for the admin reports
+	r.Use(middlewares.TrackRequestStatus)
 
 	// Serve static files from uploads directory
 	fileServer := http.FileServer(http.Dir("./uploads"))
 	r.Handle("/uploads/*", http.StripPrefix("/uploads/", fileServer))
 
+	// OpenAPI description of the routes, for generating clients, and Swagger UI to browse it
+	r.Get("/api/openapi.json", handlers.OpenAPISpecHandler(r))
+	r.Get("/api/docs", handlers.SwaggerUIHandler("/api/openapi.json"))
+
+	// Python SDK for PROGRESS/CHECKPOINT/ARTIFACT reporting
+	r.Get("/sdk/python/aimanage-progress.zip", handlers.PythonSDKArchiveHandler)
+	r.Handle("/sdk/python/*", http.StripPrefix("/sdk/python/", http.FileServer(http.Dir(handlers.PythonSDKPath))))
+
 	// Initialize AI Agent Handler (optional)
 	aiAgentHandler, err := handlers.NewAIAgentHandler()
 	if err != nil {
@@ -32,6 +51,69 @@ func NewRouter() http.Handler {
 	navigator := aiAgent.NewDirectoryNavigator("./uploads")
 	trainer := aiAgent.NewTrainer(navigator)
 	handlers.SetGlobalTrainer(trainer)
+	serverTrainers = append(serverTrainers, trainer)
+
+	// Notify users about anomalies in their trainings' metrics
+	aiAgent.SetAnomalyCallback(handlers.HandleTrainingAnomaly)
+	// Stop agent trainings whose early stopping options are met
+	aiAgent.SetEarlyStopCallback(handlers.HandleTrainingEarlyStop)
+	// Meter the credits of server trainings once they end
+	aiAgent.SetUsageCallback(handlers.FinalizeTrainingCharge)
+
+	// Push quota warnings when users approach the soft API rate limit
+	middlewares.SetAPIUsageHook(handlers.WarnAPIRateUsage)
+
+	// Block users who have not accepted the current terms of service and privacy policy
+	middlewares.SetPendingTermsFunc(handlers.PendingLegalDocuments)
+	// Refuse requests of suspended accounts, even with tokens issued before the suspension
+	middlewares.SetSuspendedFunc(handlers.IsUserSuspended)
+	// Reject access tokens of sessions that were signed out or revoked, before they expire
+	middlewares.SetSessionActiveFunc(handlers.IsSessionActive)
+
+	// Drop download ledger entries past their retention period
+	handlers.StartDownloadLedgerRetention()
+
+	// Alert users of new listings matching their saved searches
+	handlers.StartSavedSearchAlerts()
+
+	// Fingerprint listings published before duplicate detection
+	handlers.StartDuplicateFingerprintBackfill()
+
+	// Remind renters of model rentals about to expire
+	handlers.StartRentalReminders()
+
+	// Remove model uploads abandoned by failed requests or crashes
+	handlers.StartStagingCleanup()
+
+	// Log files in uploads that drifted from the database
+	handlers.StartStorageReconciliation()
+
+	// Report the results of trainings started by CI back to GitHub and callbacks
+	handlers.StartCIStatusReporter()
+
+	// Unlist deprecated marketplace listings once their sunset has passed
+	handlers.StartListingSunset()
+
+	// Rank marketplace listings by recent downloads, likes and views
+	handlers.StartTrendingScores()
+
+	// Aggregate the daily marketplace stats of listings for publisher analytics
+	handlers.StartListingStatsAggregation()
+
+	// Delete background data exports once they expire
+	handlers.StartDataExportCleanup()
+
+	// Delete chunked model uploads that were abandoned
+	handlers.StartModelUploadCleanup()
+
+	// Store request counts and send admins a usage report every week
+	handlers.StartAdminReports()
+
+	// Forget agents that have not connected for a long time
+	handlers.StartAgentPurge()
+
+	// Reset subscribers' training credits on the monthly anniversary of their subscription
+	handlers.StartCreditResets()
 
 	// Initialize Training Handler (always available, even without AI Agent)
 	trainingHandler := handlers.NewTrainingHandler(nil)
@@ -41,6 +123,7 @@ func NewRouter() http.Handler {
 	if aiAgentHandler != nil {
 		agent := aiAgentHandler.GetAgent()
 		deleteModelHandler = handlers.NewDeleteModelHandler(agent)
+		serverTrainers = append(serverTrainers, agent.GetTrainer())
 
 		// Set up broadcast callback for training updates
 		broadcaster := GetTrainingBroadcaster()
@@ -59,50 +142,243 @@ func NewRouter() http.Handler {
 		// Agent model upload (uses API key auth, not JWT)
 		r.Post("/agent/upload-model", handlers.UploadTrainedModelHandler)
 
-		r.Post("/register", handlers.RegisterHandler)
-		r.Post("/login", handlers.LoginHandler)
-		r.Get("/refresh", handlers.RefreshHandler)
+		// CI configuration for a model (uses project token auth, not JWT)
+		r.Get("/ci/config", handlers.GetCIConfigHandler)
 
-		// Email verification routes
-		r.Get("/verify-email", handlers.VerifyEmailHandler)
-		r.Post("/resend-verification", handlers.ResendVerificationEmailHandler)
+		// CI retraining dispatches (signed with the model's CI integration secret, not JWT)
+		r.Post("/ci/dispatch", trainingHandler.CIDispatchHandler)
 
-		// OAuth routes
-		r.Post("/auth/google", handlers.GoogleOAuthHandler)
-		r.Post("/auth/github", handlers.GitHubOAuthHandler)
-		r.Post("/auth/apple", handlers.AppleOAuthHandler)
+		// Model folder sync for agent trainings (uses API key auth, not JWT)
+		r.Get("/agent/sync/{trainingId}/manifest", handlers.AgentSyncManifestHandler)
+		r.Get("/agent/sync/{trainingId}/files/*", handlers.AgentSyncFileHandler)
+
+		// Credential routes are rate limited per client IP against brute forcing
+		r.Group(func(auth chi.Router) {
+			auth.Use(handlers.AuthRateLimit)
+			auth.Post("/register", handlers.RegisterHandler)
+			auth.Post("/login", handlers.LoginHandler)
+			auth.Post("/auth/refresh", handlers.RefreshHandler)
+			auth.Post("/auth/logout", handlers.LogoutHandler)
+
+			// Email verification routes
+			auth.Get("/verify-email", handlers.VerifyEmailHandler)
+			auth.Post("/resend-verification", handlers.ResendVerificationEmailHandler)
+
+			// OAuth routes
+			auth.Post("/auth/google", handlers.GoogleOAuthHandler)
+			auth.Post("/auth/github", handlers.GitHubOAuthHandler)
+			auth.Post("/auth/apple", handlers.AppleOAuthHandler)
+
+			// Password reset
+			auth.Post("/password/forgot", handlers.ForgotPasswordHandler)
+			auth.Post("/password/reset", handlers.ResetPasswordHandler)
+		})
+
+		// Password policy, checked as the user types
+		r.Post("/password/strength", handlers.PasswordStrengthHandler)
+
+		// Terms of service and privacy policy, usable before the current versions are accepted
+		r.Get("/legal/{kind}", handlers.GetLegalDocumentHandler)
+		r.Group(func(legal chi.Router) {
+			legal.Use(middlewares.JWTGuard)
+			legal.Use(middlewares.RejectRevokedSessions)
+			legal.Get("/me/legal", handlers.GetLegalStatusHandler)
+			legal.Post("/me/legal/accept", handlers.AcceptLegalDocumentsHandler)
+		})
 		r.Group(func(protected chi.Router) {
 			protected.Use(middlewares.JWTGuard)
+			protected.Use(middlewares.RejectRevokedSessions)
+			protected.Use(middlewares.RejectSuspendedUsers)
+			protected.Use(middlewares.TrackAPIUsage)
+			protected.Use(middlewares.RequireTermsAcceptance)
 			protected.Get("/health", handlers.HealthCheckHandler)
 			protected.Get("/me", handlers.GetCurrentUserHandler)
+			protected.Get("/auth/sessions", handlers.GetSessionsHandler)
+			protected.Delete("/auth/sessions", handlers.RevokeAllSessionsHandler)
+			protected.Delete("/auth/sessions/{sessionId}", handlers.RevokeSessionHandler)
 			protected.Post("/regenerate-api-key", handlers.RegenerateAPIKeyHandler)
+			protected.Get("/read-only-api-key", handlers.GetReadOnlyAPIKeyHandler)
+			protected.Post("/regenerate-read-only-api-key", handlers.RegenerateReadOnlyAPIKeyHandler)
+			protected.Get("/project-tokens", handlers.GetProjectTokensHandler)
+			protected.Post("/project-tokens", handlers.CreateProjectTokenHandler)
+			protected.Delete("/project-tokens/{tokenId}", handlers.RevokeProjectTokenHandler)
+			protected.Get("/api-keys", handlers.GetAPIKeysHandler)
+			protected.Post("/api-keys", handlers.CreateAPIKeyHandler)
+			protected.Delete("/api-keys/{keyId}", handlers.RevokeAPIKeyHandler)
+			protected.Get("/me/privacy", handlers.GetDownloadPrivacyHandler)
+			protected.Put("/me/privacy", handlers.UpdateDownloadPrivacyHandler)
 
 			protected.Post("/insert", handlers.InsertHandler)
+			protected.Post("/models/uploads", handlers.CreateModelUploadHandler)
+			protected.Get("/models/uploads/{uploadId}", handlers.GetModelUploadHandler)
+			protected.Put("/models/uploads/{uploadId}/chunks/{index}", handlers.UploadModelChunkHandler)
+			protected.Post("/models/uploads/{uploadId}/complete", handlers.CompleteModelUploadHandler)
+			protected.Delete("/models/uploads/{uploadId}", handlers.DeleteModelUploadHandler)
 			protected.Get("/getModels", handlers.ReadHandler)
+			protected.Get("/models/tags", handlers.GetModelTagsHandler)
+			protected.Patch("/models/{id}", handlers.UpdateModelTagsHandler)
+			protected.Put("/models/{id}/primary-metric", handlers.UpdateModelPrimaryMetricHandler)
+			protected.Get("/models/{id}/versions", handlers.GetModelVersionsHandler)
+			protected.Post("/models/{id}/versions/rollback", handlers.RollbackModelVersionHandler)
+			protected.Get("/models/{id}/versions/{version}/download", handlers.DownloadModelVersionHandler)
+			protected.Post("/models/{id}/versions/{version}/activate", handlers.ActivateModelVersionHandler)
 			if deleteModelHandler != nil {
 				protected.Delete("/deleteModel", deleteModelHandler.DeleteModel)
 			}
 			protected.Get("/downloadModel", handlers.DownloadTrainedModelHandler)
 
-			// Community marketplace routes
-			protected.Post("/publish", handlers.PubHandler)
-			protected.Post("/published-models/{id}/unpublish", handlers.UnPublishModel)
-			protected.Get("/published-models", handlers.GetPublishedModelsHandler)
+			// Community marketplace routes, rate limited per client IP and user
+			protected.Group(func(community chi.Router) {
+				community.Use(handlers.CommunityRateLimit)
+				community.Post("/publish", handlers.PubHandler)
+				community.Post("/published-models/{id}/unpublish", handlers.UnPublishModel)
+				community.Patch("/published-models/{id}", handlers.UpdatePublishedModelHandler)
+				community.Put("/community/models/{id}", handlers.UpdatePublishedModelHandler)
+				community.With(handlers.RequireListingAccess).Get("/community/models/{id}/price-history", handlers.GetListingPriceHistoryHandler)
+				community.Post("/published-models/{id}/deprecate", handlers.DeprecateListingHandler)
+				community.Delete("/published-models/{id}/deprecate", handlers.CancelListingDeprecationHandler)
+				community.With(handlers.RequireListingAccess).Get("/published-models/{id}/translations", handlers.GetListingTranslationsHandler)
+				community.Post("/published-models/{id}/translations/refresh", handlers.RefreshListingTranslationsHandler)
+				community.Put("/published-models/{id}/translations/{locale}", handlers.PutListingTranslationHandler)
+				community.Delete("/published-models/{id}/translations/{locale}", handlers.DeleteListingTranslationHandler)
+				community.Get("/published-models", handlers.GetPublishedModelsHandler)
+				community.Get("/community/models/search", handlers.SearchPublishedModelsHandler)
+				community.Get("/community/models/trending", handlers.GetTrendingModelsHandler)
+				community.Get("/community/my/analytics", handlers.GetMyMarketplaceAnalyticsHandler)
+				community.With(handlers.RequireListingAccess).Get("/community/models/{id}/similar", handlers.GetSimilarModelsHandler)
+				community.With(handlers.RequireListingAccess).Post("/community/models/{id}/bookmark", handlers.BookmarkModelHandler)
+				community.Delete("/community/models/{id}/bookmark", handlers.RemoveBookmarkHandler)
+			})
+			protected.Get("/search", handlers.DashboardSearchHandler)
+
+			// CSV/JSON exports of training history and publisher analytics
+			protected.Get("/exports", handlers.GetDataExportsHandler)
+			protected.Get("/exports/training-runs", handlers.ExportTrainingRunsHandler)
+			protected.Get("/exports/publisher-analytics", handlers.ExportPublisherAnalyticsHandler)
+			protected.Get("/exports/{id}/download", handlers.DownloadDataExportHandler)
 			protected.Get("/my-published-models", handlers.GetMyPublishedModelsHandler)
-			protected.Get("/published-models/{id}", handlers.GetPublishedModelByIDHandler)
-			protected.Post("/published-models/{id}/download", handlers.DownloadPublishedModelHandler)
+			protected.With(handlers.RequireListingAccess).Post("/published-models/{id}/download", handlers.DownloadPublishedModelHandler)
+			protected.With(handlers.RequireListingAccess).Post("/published-models/{id}/install", handlers.InstallTemplateHandler)
+			protected.Get("/published-models/{id}/installs", handlers.GetTemplateInstallsHandler)
+			protected.Get("/published-models/{id}/downloads", handlers.GetDownloadLedgerHandler)
+			protected.With(handlers.RequireListingAccess).Get("/published-models/{id}/requirements.lock", handlers.GetPublishedModelRequirementsLockHandler)
 			protected.Post("/published-models/payment-intent", handlers.CreateModelPaymentIntentHandler)
 			protected.Post("/published-models/confirm-purchase", handlers.ConfirmModelPurchaseHandler)
 
+			// Publisher storefront
+			protected.Get("/storefront", handlers.GetMyStorefrontHandler)
+			protected.Put("/storefront", handlers.UpdateStorefrontHandler)
+			protected.Post("/storefront/banner", handlers.UploadStorefrontBannerHandler)
+
+			// Public profile fields
+			protected.Get("/account/profile", handlers.GetMyProfileHandler)
+			protected.Put("/account/profile", handlers.UpdateMyProfileHandler)
+			protected.Post("/account/profile/avatar", handlers.UploadAvatarHandler)
+			protected.Delete("/account/profile/avatar", handlers.DeleteAvatarHandler)
+
+			// Following publishers
+			protected.Post("/users/{username}/follow", handlers.FollowPublisherHandler)
+			protected.Delete("/users/{username}/follow", handlers.UnfollowPublisherHandler)
+			protected.Get("/account/following", handlers.GetFollowingHandler)
+			protected.Get("/community/feed", handlers.GetFeedHandler)
+			protected.Get("/publisher/analytics", handlers.GetPublisherAnalyticsHandler)
+
+			// Moderation of marketplace listings
+			protected.Get("/published-models/{id}/moderation", handlers.GetListingModerationHandler)
+			protected.Post("/published-models/{id}/appeals", handlers.CreateListingAppealHandler)
+			protected.Post("/admin/published-models/{id}/remove", handlers.RemoveListingHandler)
+			protected.Get("/admin/appeals", handlers.GetAppealsHandler)
+			protected.Post("/admin/appeals/{appealId}/resolve", handlers.ResolveAppealHandler)
+			protected.Put("/admin/credit-pricing/{tier}", handlers.UpdateCreditPriceHandler)
+			protected.Get("/admin/reports/weekly", handlers.GetWeeklyReportsHandler)
+			protected.Get("/admin/rate-limits", handlers.GetRateLimitStatsHandler)
+
+			// User management, trainings of every user and credit adjustments
+			protected.Group(func(admin chi.Router) {
+				admin.Use(handlers.RequireAdmin)
+				admin.Get("/admin/users", handlers.GetAdminUsersHandler)
+				admin.Put("/admin/users/{userId}/role", handlers.UpdateUserRoleHandler)
+				admin.Post("/admin/users/{userId}/suspend", handlers.SuspendUserHandler)
+				admin.Delete("/admin/users/{userId}/suspend", handlers.UnsuspendUserHandler)
+				admin.Get("/admin/users/{userId}/credits", handlers.GetUserCreditAdjustmentsHandler)
+				admin.Post("/admin/users/{userId}/credits", handlers.AdjustUserCreditsHandler)
+				admin.Post("/admin/credits/reset-monthly", handlers.ResetMonthlyCreditsHandler)
+				admin.Get("/admin/trainings", handlers.GetAdminTrainingsHandler)
+				admin.Get("/admin/audit-log", handlers.GetAuditLogHandler)
+				admin.Get("/admin/stripe-events", handlers.GetStripeEventsHandler)
+				admin.Get("/admin/stripe-events/{eventId}", handlers.GetStripeEventHandler)
+				admin.Get("/admin/coupons", handlers.GetCouponsHandler)
+				admin.Post("/admin/coupons", handlers.CreateCouponHandler)
+				admin.Put("/admin/coupons/{couponId}", handlers.UpdateCouponHandler)
+				admin.Delete("/admin/coupons/{couponId}", handlers.DeleteCouponHandler)
+			})
+			protected.Get("/admin/storage/reconcile", handlers.ReconcileStorageHandler)
+			protected.Post("/admin/storage/reconcile", handlers.ReconcileStorageHandler)
+			protected.Get("/admin/duplicate-flags", handlers.GetDuplicateFlagsHandler)
+			protected.Post("/admin/duplicate-flags/{flagId}/resolve", handlers.ResolveDuplicateFlagHandler)
+			protected.Post("/admin/legal/{kind}", handlers.PublishLegalDocumentHandler)
+
+			// Synthetic load generator, only served when LOAD_TEST_ENABLED is set
+			protected.Post("/admin/load-test", handlers.StartLoadTestHandler)
+			protected.Get("/admin/load-test", handlers.GetLoadTestHandler)
+			protected.Delete("/admin/load-test", handlers.StopLoadTestHandler)
+
+			// Wishlist
+			protected.Get("/account/bookmarks", handlers.GetBookmarksHandler)
+			protected.Get("/account/rentals", handlers.GetMyRentalsHandler)
+			protected.Get("/saved-searches", handlers.GetSavedSearchesHandler)
+			protected.Post("/saved-searches", handlers.CreateSavedSearchHandler)
+			protected.Patch("/saved-searches/{id}", handlers.UpdateSavedSearchHandler)
+			protected.Delete("/saved-searches/{id}", handlers.DeleteSavedSearchHandler)
+
+			// Collections of saved listings
+			protected.Get("/collections", handlers.GetCollectionsHandler)
+			protected.Post("/collections", handlers.CreateCollectionHandler)
+			protected.Get("/collections/{id}", handlers.GetCollectionHandler)
+			protected.Patch("/collections/{id}", handlers.UpdateCollectionHandler)
+			protected.Delete("/collections/{id}", handlers.DeleteCollectionHandler)
+			protected.Post("/collections/{id}/items", handlers.AddCollectionItemHandler)
+			protected.Delete("/collections/{id}/items/{modelId}", handlers.RemoveCollectionItemHandler)
+
+			// Bundles of listings sold together
+			protected.Post("/bundles", handlers.CreateBundleHandler)
+			protected.Get("/bundles", handlers.GetBundlesHandler)
+			protected.Get("/bundles/{id}", handlers.GetBundleByIDHandler)
+			protected.Post("/bundles/{id}/unpublish", handlers.UnpublishBundleHandler)
+
+			// Organizations and their private model registry
+			protected.Post("/organizations", handlers.CreateOrganizationHandler)
+			protected.Get("/organizations", handlers.GetOrganizationsHandler)
+			protected.Get("/organizations/{orgId}/members", handlers.GetOrganizationMembersHandler)
+			protected.Post("/organizations/{orgId}/members", handlers.AddOrganizationMemberHandler)
+			protected.Delete("/organizations/{orgId}/members/{userId}", handlers.RemoveOrganizationMemberHandler)
+			protected.Get("/organizations/{orgId}/models", handlers.GetOrganizationModelsHandler)
+			protected.Get("/organizations/{orgId}/shared-models", handlers.GetOrganizationSharedModelsHandler)
+			protected.Get("/organizations/{orgId}/credits", handlers.GetOrganizationCreditsHandler)
+			protected.Post("/organizations/{orgId}/credits", handlers.TransferOrganizationCreditsHandler)
+			protected.Get("/organizations/{orgId}/trainings", handlers.GetOrganizationTrainingsHandler)
+			protected.Put("/models/{id}/organization", handlers.ShareModelWithOrganizationHandler)
+			protected.Get("/organizations/{orgId}/network-policy", handlers.GetOrganizationNetworkPolicyHandler)
+			protected.Put("/organizations/{orgId}/network-policy", handlers.UpdateOrganizationNetworkPolicyHandler)
+
 			// Likes
-			protected.Post("/published-models/{id}/like", handlers.LikeModelHandler)
-			protected.Delete("/published-models/{id}/like", handlers.UnlikeModelHandler)
-			protected.Get("/published-models/{id}/likes", handlers.GetModelLikesHandler)
+			protected.With(handlers.RequireListingAccess).Post("/published-models/{id}/like", handlers.LikeModelHandler)
+			protected.With(handlers.RequireListingAccess).Delete("/published-models/{id}/like", handlers.UnlikeModelHandler)
+			protected.With(handlers.RequireListingAccess).Get("/published-models/{id}/likes", handlers.GetModelLikesHandler)
 
 			// Comments
-			protected.Get("/published-models/{id}/comments", handlers.GetModelCommentsHandler)
-			protected.Post("/published-models/{id}/comments", handlers.AddModelCommentHandler)
+			protected.With(handlers.RequireListingAccess).Get("/published-models/{id}/comments", handlers.GetModelCommentsHandler)
+			protected.With(handlers.RequireListingAccess).Post("/published-models/{id}/comments", handlers.AddModelCommentHandler)
+			protected.With(handlers.RequireListingAccess).Get("/published-models/{id}/comments/threads", handlers.GetCommentThreadsHandler)
+			protected.With(handlers.RequireListingAccess).Get("/published-models/{id}/comments/{commentId}/replies", handlers.GetCommentRepliesHandler)
 			protected.Delete("/comments/{commentId}", handlers.DeleteModelCommentHandler)
+			protected.With(handlers.RequireListingAccess).Put("/community/models/{id}/comments/{commentId}", handlers.UpdateModelCommentHandler)
+			protected.Delete("/community/models/{id}/comments/{commentId}", handlers.DeleteListingCommentHandler)
+			protected.With(handlers.RequireListingAccess).Post("/community/models/{id}/comments/{commentId}/report", handlers.ReportModelCommentHandler)
+			protected.Post("/community/models/{id}/comments/{commentId}/hide", handlers.HideModelCommentHandler)
+			protected.Delete("/community/models/{id}/comments/{commentId}/hide", handlers.UnhideModelCommentHandler)
+			protected.Post("/community/models/{id}/comments/{commentId}/reports/dismiss", handlers.DismissCommentReportsHandler)
+			protected.Get("/community/models/{id}/comment-reports", handlers.GetCommentReportsHandler)
 
 			// AI Agent routes
 			if aiAgentHandler != nil {
@@ -113,19 +389,83 @@ func NewRouter() http.Handler {
 			}
 
 			// Training routes (always available)
-			protected.Post("/train/start", trainingHandler.StartTraining)
+			protected.With(handlers.TrainingRateLimit).Post("/train/start", trainingHandler.StartTraining)
 			protected.Get("/train/progress", trainingHandler.GetTrainingProgress)
 			protected.Post("/train/analyze", trainingHandler.AnalyzeResults)
 			protected.Post("/train/cleanup", trainingHandler.CleanupOldTrainings)
+			protected.Get("/train/gpus", trainingHandler.GetGPUStatus)
+			protected.Get("/train/interrupted", handlers.GetInterruptedTrainingsHandler)
+			protected.With(handlers.TrainingRateLimit).Post("/train/interrupted/{trainingId}/resume", trainingHandler.ResumeInterruptedTrainingHandler)
+			protected.Get("/models/{id}/training-estimate", trainingHandler.GetTrainingEstimate)
+			protected.Get("/models/{id}/dataset/summary", handlers.GetDatasetSummaryHandler)
+			protected.Get("/credit-pricing", handlers.GetCreditPricingHandler)
+			protected.Post("/train/validate-output", handlers.ValidateTrainingOutputHandler)
+			protected.Get("/train/environment", handlers.GetTrainingEnvironmentHandler)
+			protected.Get("/train/environment/lock", handlers.GetTrainingRequirementsLockHandler)
+			protected.Get("/train/network", handlers.GetTrainingNetworkHandler)
+			protected.Get("/train/diff", handlers.GetTrainingRunDiffHandler)
+			protected.Get("/training/{id}/logs", handlers.GetTrainingLogsHandler)
+			protected.Get("/training/{id}/checkpoints", handlers.GetTrainingCheckpointsHandler)
+			protected.With(handlers.TrainingRateLimit).Post("/training/{id}/restart", trainingHandler.RestartTrainingHandler)
+
+			// Training permissions for shared models
+			protected.Get("/models/{id}/training-settings", handlers.GetModelTrainingSettingsHandler)
+			protected.Put("/models/{id}/training-settings", handlers.UpdateModelTrainingSettingsHandler)
+			protected.Get("/models/{id}/metric-patterns", handlers.GetModelMetricPatternsHandler)
+			protected.Put("/models/{id}/metric-patterns", handlers.UpdateModelMetricPatternsHandler)
+			protected.Get("/models/{id}/ci-integration", handlers.GetCIIntegrationHandler)
+			protected.Put("/models/{id}/ci-integration", handlers.PutCIIntegrationHandler)
+			protected.Delete("/models/{id}/ci-integration", handlers.DeleteCIIntegrationHandler)
+			protected.Post("/models/{id}/training-members", handlers.AddModelTrainingMemberHandler)
+			protected.Put("/models/{id}/training-members/{userId}", handlers.UpdateModelTrainingMemberHandler)
+			protected.Delete("/models/{id}/training-members/{userId}", handlers.RemoveModelTrainingMemberHandler)
+			protected.Get("/models/{id}/training-approvals", handlers.GetTrainingApprovalsHandler)
+			protected.Post("/models/{id}/training-approvals", handlers.CreateTrainingApprovalHandler)
+			protected.Post("/training-approvals/{requestId}/approve", handlers.ApproveTrainingRequestHandler)
+			protected.Post("/training-approvals/{requestId}/reject", handlers.RejectTrainingRequestHandler)
+
+			// Model collaborators
+			protected.Get("/models/shared", handlers.GetSharedModelsHandler)
+			protected.Get("/models/{id}/collaborators", handlers.GetModelCollaboratorsHandler)
+			protected.Post("/models/{id}/collaborators", handlers.InviteModelCollaboratorHandler)
+			protected.Put("/models/{id}/collaborators/{userId}", handlers.UpdateModelCollaboratorHandler)
+			protected.Delete("/models/{id}/collaborators/{userId}", handlers.RemoveModelCollaboratorHandler)
+			protected.Delete("/models/{id}/collaborator-invitations/{invitationId}", handlers.RevokeModelCollaboratorInvitationHandler)
+			protected.Get("/me/collaborator-invitations", handlers.GetMyCollaboratorInvitationsHandler)
+			protected.Post("/collaborator-invitations/{invitationId}/accept", handlers.RespondCollaboratorInvitationHandler(true))
+			protected.Post("/collaborator-invitations/{invitationId}/decline", handlers.RespondCollaboratorInvitationHandler(false))
 
 			// Subscription routes
 			protected.Get("/subscription", handlers.GetSubscriptionHandler)
+			protected.Get("/subscription/usage", handlers.GetCreditUsageHandler)
 			protected.Post("/subscription/checkout", handlers.CreateCheckoutSessionHandler)
+			protected.Post("/subscription/portal", handlers.CreateBillingPortalSessionHandler)
+			protected.Get("/subscription/invoices", handlers.GetInvoicesHandler)
+			protected.Post("/coupons/validate", handlers.ValidateCouponHandler)
 			protected.Post("/subscription/mock-upgrade", handlers.MockUpgradeHandler) // For development/testing only
 			protected.Get("/pricing", handlers.GetPricingHandler)
 
+			// Account limits
+			protected.Get("/account/limits", handlers.GetAccountLimitsHandler)
+
+			// Notifications
+			protected.Get("/notifications", handlers.GetNotificationsHandler)
+			protected.Post("/notifications/read", handlers.MarkNotificationsReadHandler)
+
 			// Agent status
 			protected.Get("/agent/status", handlers.GetAgentStatusHandler)
+			protected.Post("/agent/benchmark", handlers.RunAgentBenchmarkHandler)
+			protected.Get("/agent/benchmarks", handlers.GetAgentBenchmarksHandler)
+			protected.Get("/agent/preview", handlers.GetAgentPreviewHandler)
+			protected.Post("/agent/preview", handlers.StartAgentPreviewHandler)
+			protected.Post("/agent/preview/predict", handlers.AgentPreviewPredictHandler)
+			protected.Delete("/agent/preview", handlers.StopAgentPreviewHandler)
+			protected.Get("/agents", handlers.GetAgentsHandler)
+			protected.Get("/agents/staleness-policy", handlers.GetAgentStalenessPolicyHandler)
+			protected.Put("/agents/staleness-policy", handlers.UpdateAgentStalenessPolicyHandler)
+			protected.Delete("/agent/{id}", handlers.DeleteAgentHandler)
+			protected.Get("/agent/{id}/inventory", handlers.GetAgentInventoryHandler)
+			protected.Post("/agent/{id}/inventory/upload", handlers.UploadAgentArtifactsHandler)
 
 			// HuggingFace integration routes - commented out
 			// protected.Post("/huggingface/push", handlers.PushToHuggingFaceHandler)
@@ -142,6 +482,41 @@ func NewRouter() http.Handler {
 
 		// Public pricing endpoint
 		r.Get("/pricing", handlers.GetPricingHandler)
+
+		// Listing details can be browsed before logging in; views are counted per user or anonymous cookie
+		r.With(middlewares.OptionalJWT, handlers.RequireListingAccess).Get("/published-models/{id}", handlers.GetPublishedModelByIDHandler)
+
+		// Public publisher profiles with their storefront
+		r.Get("/publishers/{username}", handlers.GetPublisherProfileHandler)
+		r.With(middlewares.OptionalJWT).Get("/users/{username}/profile", handlers.GetUserProfileHandler)
+
+		// Collections their owners shared
+		r.With(middlewares.OptionalJWT).Get("/shared/collections/{slug}", handlers.GetSharedCollectionHandler)
+
+		// License manifests of marketplace downloads
+		r.Post("/verify-license", handlers.VerifyLicenseHandler)
+		r.Get("/license-public-key", handlers.GetLicensePublicKeyHandler)
+
+		// PROGRESS protocol schemas for training scripts
+		r.Get("/train/progress-schema", handlers.GetProgressSchemaHandler)
+
+		// Prometheus scrape target for the caller's trainings (uses API key auth, not JWT)
+		r.Get("/train/metrics", handlers.GetTrainingMetricsHandler)
+
+		// Read-only marketplace API for third-party sites: no auth, cacheable, rate limited per IP
+		r.Route("/public", func(r chi.Router) {
+			r.Use(handlers.PublicAPIRateLimit)
+			r.Get("/listings", handlers.PublicListingsHandler)
+			r.Get("/listings/{id}", handlers.PublicListingHandler)
+		})
+
+		// Grafana simple JSON datasource over the stored training history (uses API key auth, not JWT)
+		r.Route("/grafana", func(r chi.Router) {
+			r.Get("/", handlers.GrafanaTestHandler)
+			r.Post("/search", handlers.GrafanaSearchHandler)
+			r.Post("/query", handlers.GrafanaQueryHandler)
+			r.Post("/annotations", handlers.GrafanaAnnotationsHandler)
+		})
 	})
 	return r
 
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"server/aiAgent"
+)
+
+// serverTrainers are the trainers NewRouter created, which StopTrainings interrupts
+var serverTrainers []*aiAgent.Trainer
+
+// StopTrainings interrupts the server trainings so that they can be resumed after a restart. It
+// must run before CloseWebSockets so that frontends are told the trainings were interrupted.
+// Trainings on agents keep running on their machines.
+func StopTrainings(ctx context.Context) {
+	for _, trainer := range serverTrainers {
+		if err := trainer.Shutdown(ctx); err != nil {
+			log.Printf("⚠️  Trainings were not all interrupted cleanly: %v", err)
+		}
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"server/aiAgent"
 	"server/helpers"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
+	"server/internal/ws"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,18 +16,10 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-// TrainingClient represents a WebSocket connection for training updates
-type TrainingClient struct {
-	Conn       *websocket.Conn
-	UserID     int
-	TrainingID string // Optional: filter updates for specific training
-}
-
 // TrainingBroadcaster manages WebSocket connections for training updates
 type TrainingBroadcaster struct {
-	clients      map[*websocket.Conn]*TrainingClient
-	clientsMutex sync.RWMutex
-	upgrader     websocket.Upgrader
+	hub      *ws.Hub
+	upgrader websocket.Upgrader
 }
 
 // Global broadcaster instance
@@ -35,7 +30,7 @@ var broadcasterOnce sync.Once
 func GetTrainingBroadcaster() *TrainingBroadcaster {
 	broadcasterOnce.Do(func() {
 		trainingBroadcaster = &TrainingBroadcaster{
-			clients: make(map[*websocket.Conn]*TrainingClient),
+			hub: ws.NewHub("training"),
 			upgrader: websocket.Upgrader{
 				CheckOrigin: func(r *http.Request) bool {
 					return true
@@ -62,7 +57,7 @@ func TrainingWSHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if token == "" {
-		http.Error(w, "Missing authentication token", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Missing authentication token")
 		return
 	}
 
@@ -70,14 +65,18 @@ func TrainingWSHandler(w http.ResponseWriter, r *http.Request) {
 	claims, err := helpers.ValidateJWT(token)
 	if err != nil {
 		log.Println("Invalid JWT token:", err)
-		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid or expired token")
 		return
 	}
 
 	userID, err = strconv.Atoi(claims.UserID)
 	if err != nil {
 		log.Println("Invalid user ID in token:", err)
-		http.Error(w, "Invalid user ID", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid user ID")
+		return
+	}
+	if middlewares.SessionRevoked(r.Context(), userID, claims.SessionID) {
+		apierrors.Write(w, apierrors.New(http.StatusUnauthorized, apierrors.CodeSessionRevoked, "Session has been revoked"))
 		return
 	}
 
@@ -94,56 +93,37 @@ func TrainingWSHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("🔌 Training WebSocket connected: UserID=%d, TrainingID=%s", userID, trainingID)
 
-	// Register client
-	client := &TrainingClient{
-		Conn:       conn,
-		UserID:     userID,
-		TrainingID: trainingID,
-	}
-
-	broadcaster.clientsMutex.Lock()
-	broadcaster.clients[conn] = client
-	broadcaster.clientsMutex.Unlock()
+	// Register client (optionally filtered to one training)
+	client := ws.NewClient(conn, userID)
+	client.TrainingID = trainingID
+	broadcaster.hub.Register(client)
 
 	// Send initial connection success message
-	conn.WriteJSON(map[string]interface{}{
+	client.Send(map[string]interface{}{
 		"type":    "connected",
 		"message": "Connected to training updates",
 		"user_id": userID,
 	})
 
-	// Keep connection alive
+	// Keep connection alive; pings are answered by the connection itself
 	for {
-		messageType, p, err := conn.ReadMessage()
+		_, p, err := conn.ReadMessage()
 		if err != nil {
 			log.Println("Training WebSocket read error:", err)
 			break
 		}
 
-		// Handle ping/pong
-		if messageType == websocket.PingMessage {
-			if err := conn.WriteMessage(websocket.PongMessage, nil); err != nil {
-				log.Println("Training WebSocket pong error:", err)
-				break
-			}
-		}
-
 		log.Printf("Received training WS message: %s", p)
 	}
 
 	// Unregister client
-	broadcaster.clientsMutex.Lock()
-	delete(broadcaster.clients, conn)
-	broadcaster.clientsMutex.Unlock()
+	broadcaster.hub.Unregister(client)
 
 	log.Printf("🔌 Training WebSocket disconnected: UserID=%d", userID)
 }
 
 // BroadcastTrainingUpdate sends a training update to all connected clients
 func (b *TrainingBroadcaster) BroadcastTrainingUpdate(trainingID string, updateType string, data interface{}) {
-	b.clientsMutex.RLock()
-	defer b.clientsMutex.RUnlock()
-
 	message := map[string]interface{}{
 		"type":        updateType,
 		"training_id": trainingID,
@@ -151,18 +131,14 @@ func (b *TrainingBroadcaster) BroadcastTrainingUpdate(trainingID string, updateT
 	}
 
 	// Send to all clients (or filter by trainingID if they subscribed to specific training)
-	for conn, client := range b.clients {
-		// If client subscribed to specific training, only send updates for that training
-		if client.TrainingID != "" && client.TrainingID != trainingID {
-			continue
-		}
+	b.hub.Broadcast(func(client *ws.Client) bool {
+		return client.TrainingID == "" || client.TrainingID == trainingID
+	}, message)
+}
 
-		if err := conn.WriteJSON(message); err != nil {
-			log.Printf("❌ Error broadcasting training update to client %d: %v", client.UserID, err)
-			conn.Close()
-			delete(b.clients, conn)
-		}
-	}
+// Close disconnects every training updates client
+func (b *TrainingBroadcaster) Close() {
+	b.hub.Close()
 }
 
 // BroadcastLog sends a log message to all connected clients
@@ -3,9 +3,12 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"server/helpers"
+	"server/internal/apierrors"
+	"server/internal/middlewares"
 	"server/internal/models"
 	"server/internal/repository"
 	"server/internal/ws"
@@ -50,7 +53,7 @@ func WsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if token == "" {
-		http.Error(w, "Missing authentication token", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Missing authentication token")
 		return
 	}
 
@@ -58,7 +61,7 @@ func WsHandler(w http.ResponseWriter, r *http.Request) {
 	claims, err := helpers.ValidateJWT(token)
 	if err != nil {
 		log.Println("Invalid JWT token:", err)
-		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid or expired token")
 		return
 	}
 
@@ -66,7 +69,11 @@ func WsHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err = strconv.Atoi(claims.UserID)
 	if err != nil {
 		log.Println("Invalid user ID in token:", err)
-		http.Error(w, "Invalid user ID", http.StatusUnauthorized)
+		apierrors.Respond(w, http.StatusUnauthorized, "Invalid user ID")
+		return
+	}
+	if middlewares.SessionRevoked(r.Context(), userID, claims.SessionID) {
+		apierrors.Write(w, apierrors.New(http.StatusUnauthorized, apierrors.CodeSessionRevoked, "Session has been revoked"))
 		return
 	}
 
@@ -79,16 +86,9 @@ func WsHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("WebSocket client connected: %s (UserID: %d)", r.RemoteAddr, userID)
 
-	// Register client with user ID
-	client := &ws.Client{
-		Conn:   conn,
-		UserID: userID,
-	}
-
-	ws.ClientsMutex.Lock()
-	ws.Clients[conn] = client
-	isFirstClient := len(ws.Clients) == 1
-	ws.ClientsMutex.Unlock()
+	// Register client with user ID; its write pump sends everything queued for it
+	client := ws.NewClient(conn, userID)
+	isFirstClient := ws.FrontendHub.Register(client) == 1
 
 	// Start listener if this is the first client
 	if isFirstClient {
@@ -96,36 +96,32 @@ func WsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send initial data for this user only
-	if err := sendCurrentModels(conn, userID); err != nil {
+	if err := sendCurrentModels(client); err != nil {
 		log.Println("Error sending initial models:", err)
+		ws.FrontendHub.Unregister(client)
 		return
 	}
 
 	// Keep connection alive and handle client messages
 	for {
-		// Read messages from client (or just check if connection is alive)
+		// Read messages from client (or just check if connection is alive); pings are answered
+		// by the connection itself
 		messageType, p, err := conn.ReadMessage()
 		if err != nil {
 			log.Println("WebSocket read error:", err)
 			break
 		}
 
-		// Handle ping/pong or other messages
-		if messageType == websocket.PingMessage {
-			if err := conn.WriteMessage(websocket.PongMessage, nil); err != nil {
-				log.Println("WebSocket pong error:", err)
-				break
-			}
+		if messageType == websocket.TextMessage {
+			handleClientMessage(client, p)
+			continue
 		}
 
 		log.Printf("Received message: %s", p)
 	}
 
 	// Unregister client
-	ws.ClientsMutex.Lock()
-	delete(ws.Clients, conn)
-	shouldStopListener := len(ws.Clients) == 0
-	ws.ClientsMutex.Unlock()
+	shouldStopListener := ws.FrontendHub.Unregister(client) == 0
 
 	// Stop listener if no clients left
 	if shouldStopListener {
@@ -243,17 +239,15 @@ func stopDatabaseListener() {
 
 func broadcastModelsToClients() {
 	ctx := context.Background()
+	wantsModels := func(c *ws.Client) bool { return c.Wants(ws.CategoryModels) }
 
 	// Broadcast to all connected clients - each gets only their own models
-	ws.ClientsMutex.Lock()
-	defer ws.ClientsMutex.Unlock()
-
 	successCount := 0
-	for conn, client := range ws.Clients {
+	for _, userID := range ws.FrontendHub.Users(wantsModels) {
 		// Fetch models for this specific user
-		userModels, err := repository.GetModelsByUserID(ctx, client.UserID)
+		userModels, err := repository.GetModelsByUserID(ctx, userID, "")
 		if err != nil {
-			log.Printf("❌ GetModelsByUserID error for user %d: %v", client.UserID, err)
+			log.Printf("❌ GetModelsByUserID error for user %d: %v", userID, err)
 			continue
 		}
 
@@ -261,21 +255,57 @@ func broadcastModelsToClients() {
 			userModels = []map[string]interface{}{}
 		}
 
-		if err := conn.WriteJSON(userModels); err != nil {
-			log.Println("❌ Error broadcasting to client:", err)
-			conn.Close()
-			delete(ws.Clients, conn)
-		} else {
-			successCount++
-		}
+		successCount += ws.FrontendHub.BroadcastToUser(userID, wantsModels, userModels)
 	}
 
 	log.Printf("✅ Broadcasted models update to %d clients", successCount)
 }
 
-func sendCurrentModels(conn *websocket.Conn, userID int) error {
+// clientMessage is a message sent by a frontend client. {"type": "subscribe", "categories": [...]}
+// selects the event categories the client receives, an empty list restores all of them.
+// Clients receiving agent statuses then get an agent_status_snapshot, which they can also ask
+// for with {"type": "agent_status_snapshot"}.
+type clientMessage struct {
+	Type       string   `json:"type"`
+	Categories []string `json:"categories"`
+}
+
+func handleClientMessage(client *ws.Client, p []byte) {
+	var msg clientMessage
+	if err := json.Unmarshal(p, &msg); err != nil || (msg.Type != "subscribe" && msg.Type != "agent_status_snapshot") {
+		log.Printf("Received message: %s", p)
+		return
+	}
+	if msg.Type == "agent_status_snapshot" {
+		if err := client.SendAgentStatusSnapshot(); err != nil {
+			log.Println("❌ WebSocket send error:", err)
+		}
+		return
+	}
+
+	reply := map[string]interface{}{"type": "subscribed"}
+	categories, err := client.Subscribe(msg.Categories)
+	if err != nil {
+		reply = map[string]interface{}{"type": "subscribe_error", "error": err.Error()}
+	} else {
+		reply["categories"] = categories
+	}
+
+	if err := client.Send(reply); err != nil {
+		log.Println("❌ WebSocket send error:", err)
+		return
+	}
+	if reply["type"] == "subscribed" {
+		if err := client.SendAgentStatusSnapshot(); err != nil {
+			log.Println("❌ WebSocket send error:", err)
+		}
+	}
+}
+
+func sendCurrentModels(client *ws.Client) error {
 	ctx := context.Background()
-	userModels, err := repository.GetModelsByUserID(ctx, userID)
+	userID := client.UserID
+	userModels, err := repository.GetModelsByUserID(ctx, userID, "")
 	if err != nil {
 		log.Printf("❌ GetModelsByUserID error for user %d: %v", userID, err)
 		return err
@@ -285,7 +315,7 @@ func sendCurrentModels(conn *websocket.Conn, userID int) error {
 		userModels = []map[string]interface{}{}
 	}
 
-	if err := conn.WriteJSON(userModels); err != nil {
+	if err := client.Send(userModels); err != nil {
 		log.Println("❌ WebSocket send error:", err)
 		return err
 	}
@@ -293,3 +323,11 @@ func sendCurrentModels(conn *websocket.Conn, userID int) error {
 	log.Printf("✅ Sent initial models to client (UserID: %d, Count: %d)", userID, len(userModels))
 	return nil
 }
+
+// CloseWebSockets disconnects every frontend and training updates client, after sending what they
+// have queued, and stops the database listener
+func CloseWebSockets() {
+	ws.FrontendHub.Close()
+	GetTrainingBroadcaster().Close()
+	stopDatabaseListener()
+}
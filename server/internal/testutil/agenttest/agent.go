@@ -0,0 +1,224 @@
+// Package agenttest has test doubles for both ends of the training agent protocol: Agent
+// plays a local training agent connected to /v1/ws/agent, and Frontend plays a browser
+// receiving the broadcasts meant for one user.
+package agenttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"server/aiAgent"
+)
+
+// Timeout is how long Expect waits for a message
+const Timeout = 5 * time.Second
+
+// Message is a JSON message of the protocol
+type Message map[string]interface{}
+
+// Type returns the message's "type" field
+func (m Message) Type() string {
+	t, _ := m["type"].(string)
+	return t
+}
+
+// inbox collects the messages read from a connection
+type inbox struct {
+	messages chan Message
+	closed   chan struct{}
+}
+
+func newInbox() *inbox {
+	return &inbox{messages: make(chan Message, 256), closed: make(chan struct{})}
+}
+
+// read forwards every JSON message of conn to the inbox until the connection closes.
+// handle, if set, is called with each message before it is forwarded.
+func (in *inbox) read(conn *websocket.Conn, handle func(Message)) {
+	defer close(in.closed)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		if handle != nil {
+			handle(msg)
+		}
+		in.messages <- msg
+	}
+}
+
+// expect returns the next message of type msgType, skipping any other messages
+func (in *inbox) expect(t *testing.T, msgType string) Message {
+	t.Helper()
+	deadline := time.After(Timeout)
+	for {
+		select {
+		case msg := <-in.messages:
+			if msg.Type() == msgType {
+				return msg
+			}
+		case <-in.closed:
+			// Drain what was read before the connection closed
+			for {
+				select {
+				case msg := <-in.messages:
+					if msg.Type() == msgType {
+						return msg
+					}
+				default:
+					t.Fatalf("connection closed before a %q message arrived", msgType)
+				}
+			}
+		case <-deadline:
+			t.Fatalf("no %q message after %v", msgType, Timeout)
+		}
+	}
+}
+
+// Agent is a scripted training agent. It answers system_info_request with its system info and
+// records every message the server sends.
+type Agent struct {
+	conn       *websocket.Conn
+	writeMu    sync.Mutex
+	systemInfo Message
+	in         *inbox
+}
+
+// DefaultSystemInfo is what an Agent reports when no system info is given
+var DefaultSystemInfo = Message{
+	"os":        "linux",
+	"cpu_count": float64(8),
+	"memory_gb": float64(16),
+	"gpu":       "none",
+	"hostname":  "test-agent",
+}
+
+// Dial connects an agent to the agent WebSocket endpoint at serverURL (an http:// URL) with
+// apiKey. On failure the HTTP response, if any, shows why the server refused the connection.
+func Dial(serverURL, apiKey string, systemInfo Message) (*Agent, *http.Response, error) {
+	return DialAs(serverURL, apiKey, "", systemInfo)
+}
+
+// DialAs connects like Dial, sending agentID in the handshake to tell the agent apart from the
+// user's other agents
+func DialAs(serverURL, apiKey, agentID string, systemInfo Message) (*Agent, *http.Response, error) {
+	if systemInfo == nil {
+		systemInfo = DefaultSystemInfo
+	}
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "?api_key=" + url.QueryEscape(apiKey)
+	if agentID != "" {
+		wsURL += "&agent_id=" + url.QueryEscape(agentID)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	a := &Agent{conn: conn, systemInfo: systemInfo, in: newInbox()}
+	go a.in.read(conn, func(msg Message) {
+		if msg.Type() == "system_info_request" {
+			a.Send(Message{"type": "system_info", "data": a.systemInfo})
+		}
+	})
+	return a, resp, nil
+}
+
+// Send writes a message to the server
+func (a *Agent) Send(msg Message) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	return a.conn.WriteJSON(msg)
+}
+
+// Expect returns the next message of type msgType from the server, failing the test after Timeout
+func (a *Agent) Expect(t *testing.T, msgType string) Message {
+	t.Helper()
+	return a.in.expect(t, msgType)
+}
+
+// Start reports that the agent started a training
+func (a *Agent) Start(trainingID string) error {
+	return a.Send(Message{"type": "training_started", "training_id": trainingID})
+}
+
+// Output streams a line the training script printed
+func (a *Agent) Output(trainingID, line string) error {
+	return a.Send(Message{"type": "training_output", "training_id": trainingID, "output": line})
+}
+
+// Progress streams a PROGRESS line with the given fields
+func (a *Agent) Progress(trainingID string, fields Message) error {
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return a.Output(trainingID, aiAgent.ProgressPrefix+" "+string(payload))
+}
+
+// Complete reports that a training finished and saved its model at modelPath
+func (a *Agent) Complete(trainingID, modelPath string) error {
+	return a.Send(Message{"type": "training_completed", "training_id": trainingID, "model_path": modelPath})
+}
+
+// Fail reports that a training failed
+func (a *Agent) Fail(trainingID, errorMessage string) error {
+	return a.Send(Message{"type": "training_failed", "training_id": trainingID, "error": errorMessage})
+}
+
+// BenchmarkResult reports the throughputs the benchmark suite measured
+func (a *Agent) BenchmarkResult(matmulGFLOPS, cnnSamplesPerSec float64) error {
+	return a.Send(Message{"type": "benchmark_result", "data": Message{
+		"suite":               aiAgent.BenchmarkSuiteVersion,
+		"device":              "cpu",
+		"matmul_gflops":       matmulGFLOPS,
+		"cnn_samples_per_sec": cnnSamplesPerSec,
+		"duration_seconds":    float64(12),
+	}})
+}
+
+// Inventory reports the agent's training history and the model files on its machine
+func (a *Agent) Inventory(trainings, artifacts []Message) error {
+	return a.Send(Message{"type": "inventory", "data": Message{"trainings": trainings, "artifacts": artifacts}})
+}
+
+// PreviewReady reports that the agent loaded the model of a preview session
+func (a *Agent) PreviewReady(previewID, framework string) error {
+	return a.Send(Message{"type": "preview_ready", "preview_id": previewID, "framework": framework})
+}
+
+// Prediction answers a preview_predict request with the model's outputs
+func (a *Agent) Prediction(requestID string, outputs interface{}) error {
+	return a.Send(Message{"type": "preview_prediction", "request_id": requestID, "outputs": outputs})
+}
+
+// Run plays a whole training: started, one output message per line, then completed
+func (a *Agent) Run(trainingID string, lines []string, modelPath string) error {
+	if err := a.Start(trainingID); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if err := a.Output(trainingID, line); err != nil {
+			return err
+		}
+	}
+	return a.Complete(trainingID, modelPath)
+}
+
+// Close disconnects the agent with a normal close frame
+func (a *Agent) Close() error {
+	a.writeMu.Lock()
+	a.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	a.writeMu.Unlock()
+	return a.conn.Close()
+}
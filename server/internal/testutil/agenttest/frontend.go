@@ -0,0 +1,63 @@
+package agenttest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"server/internal/ws"
+)
+
+// Frontend receives the WebSocket broadcasts sent to one user, like a logged-in browser tab
+type Frontend struct {
+	in *inbox
+}
+
+// NewFrontend registers a WebSocket client for userID and closes it when the test ends
+func NewFrontend(t *testing.T, userID int) *Frontend {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	registered := make(chan *ws.Client, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := ws.NewClient(conn, userID)
+		ws.FrontendHub.Register(client)
+		registered <- client
+	}))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		server.Close()
+		t.Fatalf("failed to connect frontend: %v", err)
+	}
+	client := <-registered
+
+	f := &Frontend{in: newInbox()}
+	go f.in.read(conn, nil)
+
+	t.Cleanup(func() {
+		ws.FrontendHub.Unregister(client)
+		conn.Close()
+		server.Close()
+	})
+	return f
+}
+
+// Expect returns the next broadcast of type msgType, failing the test after Timeout
+func (f *Frontend) Expect(t *testing.T, msgType string) Message {
+	t.Helper()
+	return f.in.expect(t, msgType)
+}
+
+// ExpectData returns the "data" of the next broadcast of type msgType
+func (f *Frontend) ExpectData(t *testing.T, msgType string) Message {
+	t.Helper()
+	data, _ := f.Expect(t, msgType)["data"].(map[string]interface{})
+	return data
+}
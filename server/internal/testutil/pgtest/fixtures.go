@@ -0,0 +1,88 @@
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"server/internal/models"
+)
+
+// sequence keeps generated emails, usernames and names unique within a test run
+var sequence atomic.Int64
+
+func next() int64 {
+	return sequence.Add(1)
+}
+
+// User is a user created by CreateUser
+type User struct {
+	ID       int
+	Email    string
+	Username string
+	APIKey   string
+}
+
+// CreateUser inserts a user with a unique email, username and API key. The password is not a
+// valid bcrypt hash, so the user cannot log in.
+func CreateUser(t *testing.T) User {
+	t.Helper()
+	n := next()
+	user := User{
+		Email:    fmt.Sprintf("user%d@example.com", n),
+		Username: fmt.Sprintf("user%d", n),
+		APIKey:   fmt.Sprintf("sk_test_%d", n),
+	}
+	if err := models.Pool.QueryRow(context.Background(), `
+		INSERT INTO users (email, password, username, api_key)
+		VALUES ($1, 'not-a-hash', $2, $3)
+		RETURNING id
+	`, user.Email, user.Username, user.APIKey).Scan(&user.ID); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+// CreateModel inserts a model owned by userID and returns its ID
+func CreateModel(t *testing.T, userID int) int {
+	t.Helper()
+	var id int
+	if err := models.Pool.QueryRow(context.Background(), `
+		INSERT INTO models (user_id, name, picture, folder, training_script)
+		VALUES ($1, $2, '', ARRAY['./uploads/dataset'], 'train.py')
+		RETURNING id
+	`, userID, fmt.Sprintf("model-%d", next())).Scan(&id); err != nil {
+		t.Fatalf("failed to create model: %v", err)
+	}
+	return id
+}
+
+// CreatePublishedModel publishes a model of publisherID as a free, active listing and returns its ID
+func CreatePublishedModel(t *testing.T, modelID, publisherID int) int {
+	t.Helper()
+	var id int
+	if err := models.Pool.QueryRow(context.Background(), `
+		INSERT INTO published_models (model_id, publisher_id, name, trained_model_path, description, price, license_type, category)
+		VALUES ($1, $2, $3, './uploads/trained/model.pt', 'A test listing', 0, 'personal_use', 'Computer Vision')
+		RETURNING id
+	`, modelID, publisherID, fmt.Sprintf("listing-%d", next())).Scan(&id); err != nil {
+		t.Fatalf("failed to create published model: %v", err)
+	}
+	return id
+}
+
+// CreateSession inserts a session of user that expires after ttl, negative for an expired one,
+// and returns its refresh token
+func CreateSession(t *testing.T, user User, ttl time.Duration) string {
+	t.Helper()
+	token := fmt.Sprintf("refresh-%d", next())
+	if _, err := models.Pool.Exec(context.Background(), `
+		INSERT INTO sessions (user_id, email, refresh_token, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, user.ID, user.Email, token, time.Now().Add(ttl)); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	return token
+}
@@ -0,0 +1,183 @@
+// Package pgtest runs repository tests against a throwaway PostgreSQL database.
+//
+// Main starts postgres:16-alpine with dockertest, applies every migration and points
+// models.Pool at it. Set TEST_DATABASE_URL to use an existing empty database instead, for
+// example in CI. When neither is available, tests calling Require are skipped.
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"server/internal/models"
+)
+
+// DatabaseURLEnv names an existing database to run the tests against instead of a container
+const DatabaseURLEnv = "TEST_DATABASE_URL"
+
+const (
+	postgresImage = "postgres"
+	postgresTag   = "16-alpine"
+	// containerTTL makes Docker remove the container if the test binary dies before cleaning up
+	containerTTL = 10 * time.Minute
+	startTimeout = 2 * time.Minute
+)
+
+// unavailable is why no database could be started, empty when tests can use models.Pool
+var unavailable string
+
+// Main sets up the database, runs the tests and tears the database down. Call it from TestMain:
+//
+//	func TestMain(m *testing.M) { pgtest.Main(m) }
+func Main(m *testing.M) {
+	cleanup, err := setup()
+	if err != nil {
+		unavailable = err.Error()
+		log.Printf("⚠️  No test database, skipping database tests: %v", err)
+	}
+	code := m.Run()
+	if cleanup != nil {
+		cleanup()
+	}
+	os.Exit(code)
+}
+
+// Require skips the test when no database is available and otherwise empties every table,
+// so each test starts from a clean schema
+func Require(t *testing.T) {
+	t.Helper()
+	if unavailable != "" {
+		t.Skipf("no test database: %s", unavailable)
+	}
+	if err := truncateAll(context.Background()); err != nil {
+		t.Fatalf("failed to reset test database: %v", err)
+	}
+}
+
+// setup connects to TEST_DATABASE_URL or a new container and migrates it
+func setup() (func(), error) {
+	ctx := context.Background()
+
+	if dsn := os.Getenv(DatabaseURLEnv); dsn != "" {
+		pool, err := connect(ctx, dsn)
+		if err != nil {
+			return nil, err
+		}
+		models.Pool = pool
+		if err := migrate(ctx); err != nil {
+			pool.Close()
+			return nil, err
+		}
+		return pool.Close, nil
+	}
+
+	dockerPool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, fmt.Errorf("docker unavailable: %w", err)
+	}
+	if err := dockerPool.Client.Ping(); err != nil {
+		return nil, fmt.Errorf("docker unavailable: %w", err)
+	}
+
+	resource, err := dockerPool.RunWithOptions(&dockertest.RunOptions{
+		Repository: postgresImage,
+		Tag:        postgresTag,
+		Env: []string{
+			"POSTGRES_USER=postgres",
+			"POSTGRES_PASSWORD=postgres",
+			"POSTGRES_DB=ai_db_test",
+		},
+	}, func(config *docker.HostConfig) {
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start postgres container: %w", err)
+	}
+	resource.Expire(uint(containerTTL.Seconds()))
+	purge := func() {
+		if err := dockerPool.Purge(resource); err != nil {
+			log.Printf("⚠️  Failed to remove postgres container: %v", err)
+		}
+	}
+
+	dsn := fmt.Sprintf("postgres://postgres:postgres@%s/ai_db_test?sslmode=disable", resource.GetHostPort("5432/tcp"))
+	dockerPool.MaxWait = startTimeout
+	var pool *pgxpool.Pool
+	if err := dockerPool.Retry(func() error {
+		var err error
+		pool, err = connect(ctx, dsn)
+		return err
+	}); err != nil {
+		purge()
+		return nil, fmt.Errorf("postgres container did not become ready: %w", err)
+	}
+
+	models.Pool = pool
+	if err := migrate(ctx); err != nil {
+		pool.Close()
+		purge()
+		return nil, err
+	}
+	return func() {
+		pool.Close()
+		purge()
+	}, nil
+}
+
+// connect opens a pool and checks that the database answers
+func connect(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connection failed: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping failed: %w", err)
+	}
+	return pool, nil
+}
+
+// migrate applies every migration with the runner the server uses at startup
+func migrate(ctx context.Context) error {
+	_, err := models.Migrate(ctx)
+	return err
+}
+
+// truncateAll empties every table but the migration version and restarts their ID sequences
+func truncateAll(ctx context.Context) error {
+	rows, err := models.Pool.Query(ctx, `
+		SELECT quote_ident(tablename) FROM pg_tables
+		WHERE schemaname = 'public' AND tablename <> 'schema_migrations'
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	_, err = models.Pool.Exec(ctx, "TRUNCATE "+strings.Join(tables, ", ")+" RESTART IDENTITY CASCADE")
+	return err
+}
@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// maxAgentTransitions is how many agent status transitions snapshots carry
+const maxAgentTransitions = 10
+
+// AgentTransition is a change of one agent's status
+type AgentTransition struct {
+	Seq     int64     `json:"seq"`
+	AgentID string    `json:"agent_id"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	At      time.Time `json:"at"`
+}
+
+// agentStatusLog is the latest status of each of a user's agents and their recent transitions
+type agentStatusLog struct {
+	seq         int64
+	current     map[string]map[string]interface{} // key: agent_id
+	transitions []AgentTransition
+}
+
+// agentStatusLogs holds the status log of every user whose agents reported a status since the
+// server started. Guarded by the lock of FrontendHub, so a snapshot and the broadcasts after it are
+// queued in order.
+var agentStatusLogs = make(map[int]*agentStatusLog)
+
+// recordAgentStatus numbers a status and keeps it as the agent's current one. Must be called
+// with the lock of FrontendHub held.
+func recordAgentStatus(userID int, status map[string]interface{}) {
+	statusLog := agentStatusLogs[userID]
+	if statusLog == nil {
+		statusLog = &agentStatusLog{current: make(map[string]map[string]interface{})}
+		agentStatusLogs[userID] = statusLog
+	}
+
+	statusLog.seq++
+	now := time.Now()
+	status["seq"] = statusLog.seq
+	status["at"] = now
+
+	agentID, _ := status["agent_id"].(string)
+	to, _ := status["status"].(string)
+	from := "disconnected"
+	if previous, ok := statusLog.current[agentID]; ok {
+		from, _ = previous["status"].(string)
+	}
+	if from != to {
+		statusLog.transitions = append(statusLog.transitions, AgentTransition{
+			Seq: statusLog.seq, AgentID: agentID, From: from, To: to, At: now,
+		})
+		if len(statusLog.transitions) > maxAgentTransitions {
+			statusLog.transitions = statusLog.transitions[len(statusLog.transitions)-maxAgentTransitions:]
+		}
+	}
+
+	if to == "disconnected" {
+		delete(statusLog.current, agentID)
+	} else {
+		statusLog.current[agentID] = status
+	}
+}
+
+// agentStatusSnapshot returns the current status of the user's agents, their recent transitions and
+// the sequence number of the latest status. Statuses broadcast later have a higher seq. Must be
+// called with the lock of FrontendHub held.
+func agentStatusSnapshot(userID int) map[string]interface{} {
+	snapshot := map[string]interface{}{
+		"seq":         int64(0),
+		"connected":   false,
+		"agents":      []map[string]interface{}{},
+		"transitions": []AgentTransition{},
+	}
+	statusLog := agentStatusLogs[userID]
+	if statusLog == nil {
+		return snapshot
+	}
+
+	agents := make([]map[string]interface{}, 0, len(statusLog.current))
+	for _, status := range statusLog.current {
+		agents = append(agents, status)
+	}
+	snapshot["seq"] = statusLog.seq
+	snapshot["connected"] = len(agents) > 0
+	snapshot["agents"] = agents
+	snapshot["transitions"] = append([]AgentTransition{}, statusLog.transitions...)
+	return snapshot
+}
+
+// AgentStatusSnapshot returns the agent status snapshot of a user, as sent to their clients
+func AgentStatusSnapshot(userID int) map[string]interface{} {
+	FrontendHub.mu.Lock()
+	defer FrontendHub.mu.Unlock()
+	return agentStatusSnapshot(userID)
+}
+
+// SendAgentStatusSnapshot queues the agent status snapshot of its user for a FrontendHub client, if
+// it receives agent statuses
+func (c *Client) SendAgentStatusSnapshot() error {
+	FrontendHub.mu.Lock()
+	defer FrontendHub.mu.Unlock()
+	if !c.wantsAgentStatus() {
+		return nil
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"type": "agent_status_snapshot",
+		"data": agentStatusSnapshot(c.UserID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode agent status snapshot: %w", err)
+	}
+	if !c.enqueue(data) {
+		return fmt.Errorf("client is not connected")
+	}
+	return nil
+}
+
+// wantsAgentStatus reports whether the client receives agent statuses. Must be called with the
+// lock of its hub held.
+func (c *Client) wantsAgentStatus() bool {
+	return c.Wants(CategoryAgent) || c.Wants(CategoryAgentStatus)
+}
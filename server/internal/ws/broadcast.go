@@ -1,73 +1,123 @@
 package ws
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
-	"sync"
+)
 
-	"github.com/gorilla/websocket"
+// Event categories clients can subscribe to
+const (
+	CategoryModels        = "models"        // model list updates
+	CategoryAgent         = "agent"         // agent status, inventory, uploads and benchmarks
+	CategoryAgentStatus   = "agent_status"  // agent status only, with a snapshot on subscribe
+	CategoryTraining      = "training"      // training progress, output and approvals
+	CategoryNotifications = "notifications" // notifications and quota warnings
 )
 
-// Client represents a WebSocket connection with its associated user ID
-type Client struct {
-	Conn   *websocket.Conn
-	UserID int
+// Categories lists every event category
+var Categories = []string{CategoryModels, CategoryAgent, CategoryAgentStatus, CategoryTraining, CategoryNotifications}
+
+// eventCategories maps message types to their category
+var eventCategories = map[string]string{
+	"agent_status":                CategoryAgent,
+	"agent_inventory":             CategoryAgent,
+	"agent_artifact_upload":       CategoryAgent,
+	"agent_benchmark":             CategoryAgent,
+	"agent_preview":               CategoryAgent,
+	"training_update":             CategoryTraining,
+	"training_output":             CategoryTraining,
+	"training_approval_requested": CategoryTraining,
+	"training_approval_decided":   CategoryTraining,
+	"notification":                CategoryNotifications,
+	"quota_warning":               CategoryNotifications,
 }
 
-// Global variables for managing clients
-var (
-	ClientsMutex sync.Mutex
-	Clients      = make(map[*websocket.Conn]*Client)
-)
+// EventCategory returns the category of a message type. Unknown types belong to no category and
+// reach every client.
+func EventCategory(msgType string) string {
+	return eventCategories[msgType]
+}
+
+// Wants reports whether the client subscribed to a category. Must be called with the lock of its
+// hub held, as hub filters are.
+func (c *Client) Wants(category string) bool {
+	return c.Categories == nil || category == "" || c.Categories[category]
+}
+
+// Subscribe limits the events sent to the client to categories; none means all of them.
+// It returns the categories the client now receives.
+func (c *Client) Subscribe(categories []string) ([]string, error) {
+	var selected map[string]bool
+	if len(categories) > 0 {
+		selected = make(map[string]bool, len(categories))
+		for _, category := range categories {
+			if !isCategory(category) {
+				return nil, fmt.Errorf("unknown event category %q", category)
+			}
+			selected[category] = true
+		}
+	}
+
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	if c.removed {
+		return nil, fmt.Errorf("client is not connected")
+	}
+	c.Categories = selected
+
+	subscribed := []string{}
+	for _, category := range Categories {
+		if c.Wants(category) {
+			subscribed = append(subscribed, category)
+		}
+	}
+	return subscribed, nil
+}
 
-// BroadcastAgentStatus broadcasts agent status to all WebSocket clients for a specific user
+func isCategory(category string) bool {
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// BroadcastAgentStatus broadcasts agent status to all WebSocket clients for a specific user that
+// receive agent statuses. The status gets the next seq of the user and is kept for snapshots.
 func BroadcastAgentStatus(userID int, status map[string]interface{}) {
-	ClientsMutex.Lock()
-	defer ClientsMutex.Unlock()
+	FrontendHub.mu.Lock()
+	defer FrontendHub.mu.Unlock()
+
+	recordAgentStatus(userID, status)
 
 	// Add a type field to distinguish from model updates
-	message := map[string]interface{}{
+	message, err := json.Marshal(map[string]interface{}{
 		"type": "agent_status",
 		"data": status,
+	})
+	if err != nil {
+		log.Printf("❌ Error encoding agent status: %v", err)
+		return
 	}
 
-	successCount := 0
-	for conn, client := range Clients {
-		if client.UserID == userID {
-			if err := conn.WriteJSON(message); err != nil {
-				log.Printf("❌ Error broadcasting agent status to client: %v", err)
-				conn.Close()
-				delete(Clients, conn)
-			} else {
-				successCount++
-			}
-		}
-	}
-
+	successCount := FrontendHub.broadcast(FrontendHub.users[userID], (*Client).wantsAgentStatus, message)
 	if successCount > 0 {
 		log.Printf("✅ Broadcasted agent status to %d client(s) for user %d", successCount, userID)
 	}
 }
 
-// BroadcastToUser broadcasts a message to all WebSocket clients for a specific user
+// BroadcastToUser broadcasts a message to all WebSocket clients for a specific user that
+// subscribed to the category of its type
 func BroadcastToUser(userID int, message map[string]interface{}) {
-	ClientsMutex.Lock()
-	defer ClientsMutex.Unlock()
-
-	successCount := 0
-	for conn, client := range Clients {
-		if client.UserID == userID {
-			if err := conn.WriteJSON(message); err != nil {
-				log.Printf("❌ Error broadcasting to client: %v", err)
-				conn.Close()
-				delete(Clients, conn)
-			} else {
-				successCount++
-			}
-		}
-	}
+	msgType, _ := message["type"].(string)
+	category := EventCategory(msgType)
 
+	successCount := FrontendHub.BroadcastToUser(userID, func(c *Client) bool {
+		return c.Wants(category)
+	}, message)
 	if successCount > 0 {
-		msgType := message["type"]
 		log.Printf("✅ Broadcasted %v to %d client(s) for user %d", msgType, successCount, userID)
 	}
 }
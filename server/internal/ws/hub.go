@@ -0,0 +1,258 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sendQueueSize is how many messages a client can fall behind before it is disconnected
+	sendQueueSize = 256
+	// writeWait is how long a write to a client may take
+	writeWait = 10 * time.Second
+	// pingPeriod is how often idle clients are pinged to keep their connection open
+	pingPeriod = 50 * time.Second
+)
+
+// Client represents a WebSocket connection with its associated user ID. Messages reach it through
+// a buffered send queue drained by its write pump, the only goroutine writing to Conn.
+type Client struct {
+	Conn   *websocket.Conn
+	UserID int
+
+	// TrainingID limits a training updates client to the updates of one training, "" for all of them
+	TrainingID string
+
+	// Categories are the event categories the client subscribed to, nil for all of them.
+	// Guarded by the lock of its hub.
+	Categories map[string]bool
+
+	hub  *Hub
+	send chan []byte
+	// removed is set once the client left its hub and its send queue is closed. Guarded by the
+	// lock of its hub.
+	removed bool
+}
+
+// NewClient returns a client of userID for conn, to register with a hub
+func NewClient(conn *websocket.Conn, userID int) *Client {
+	return &Client{Conn: conn, UserID: userID, send: make(chan []byte, sendQueueSize)}
+}
+
+// Hub tracks the WebSocket clients of each user and delivers messages to them. A message is
+// queued on every recipient's send queue, so a slow client never holds up the others: a client
+// whose queue is full is disconnected, and gets the current state again when it reconnects.
+type Hub struct {
+	name    string
+	mu      sync.Mutex
+	users   map[int]map[*Client]bool
+	count   int
+	closed  bool
+	writers sync.WaitGroup
+}
+
+// NewHub returns an empty hub, named in its logs
+func NewHub(name string) *Hub {
+	return &Hub{name: name, users: make(map[int]map[*Client]bool)}
+}
+
+// FrontendHub holds the frontend clients of /ws, which receive model updates, agent events,
+// training events and notifications
+var FrontendHub = NewHub("frontend")
+
+// Register adds a client to the hub and starts its write pump. It returns how many clients the hub
+// has, 0 if the hub is closed, in which case the connection is closed.
+func (h *Hub) Register(c *Client) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		c.Conn.Close()
+		return 0
+	}
+	c.hub = h
+	if h.users[c.UserID] == nil {
+		h.users[c.UserID] = make(map[*Client]bool)
+	}
+	h.users[c.UserID][c] = true
+	h.count++
+
+	h.writers.Add(1)
+	go c.writePump()
+	return h.count
+}
+
+// Unregister removes a client from the hub once its connection ended. The messages it still has
+// queued are sent before the connection is closed. It returns how many clients the hub has left.
+func (h *Hub) Unregister(c *Client) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(c)
+	return h.count
+}
+
+// remove takes a client out of the hub and closes its send queue. Must be called with h.mu held.
+func (h *Hub) remove(c *Client) {
+	if c.removed {
+		return
+	}
+	c.removed = true
+	close(c.send)
+
+	delete(h.users[c.UserID], c)
+	if len(h.users[c.UserID]) == 0 {
+		delete(h.users, c.UserID)
+	}
+	h.count--
+}
+
+// enqueue queues data on the client's send queue, disconnecting the client if the queue is full.
+// Must be called with the hub's lock held.
+func (c *Client) enqueue(data []byte) bool {
+	if c.removed {
+		return false
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		log.Printf("⚠️  Disconnecting slow %s WebSocket client of user %d: %d messages queued",
+			c.hub.name, c.UserID, len(c.send))
+		c.hub.remove(c)
+		c.Conn.Close()
+		return false
+	}
+}
+
+// Send queues a message for the client
+func (c *Client) Send(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	if !c.enqueue(data) {
+		return fmt.Errorf("client is not connected")
+	}
+	return nil
+}
+
+// BroadcastToUser queues a message for the clients of a user accepted by filter, nil for all of
+// them. filter runs with the hub's lock held. It returns how many clients the message was queued for.
+func (h *Hub) BroadcastToUser(userID int, filter func(*Client) bool, message interface{}) int {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("❌ Error encoding %s WebSocket message: %v", h.name, err)
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.broadcast(h.users[userID], filter, data)
+}
+
+// Broadcast queues a message for every client accepted by filter, nil for all of them. filter
+// runs with the hub's lock held. It returns how many clients the message was queued for.
+func (h *Hub) Broadcast(filter func(*Client) bool, message interface{}) int {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("❌ Error encoding %s WebSocket message: %v", h.name, err)
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sent := 0
+	for _, clients := range h.users {
+		sent += h.broadcast(clients, filter, data)
+	}
+	return sent
+}
+
+// broadcast queues data for the clients accepted by filter. Must be called with h.mu held.
+func (h *Hub) broadcast(clients map[*Client]bool, filter func(*Client) bool, data []byte) int {
+	sent := 0
+	for client := range clients {
+		if filter != nil && !filter(client) {
+			continue
+		}
+		if client.enqueue(data) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Users returns the users with at least one client accepted by filter, nil for any client
+func (h *Hub) Users(filter func(*Client) bool) []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	users := make([]int, 0, len(h.users))
+	for userID, clients := range h.users {
+		for client := range clients {
+			if filter == nil || filter(client) {
+				users = append(users, userID)
+				break
+			}
+		}
+	}
+	return users
+}
+
+// Close disconnects every client, after sending what they have queued and a close message, and
+// refuses new ones. It returns once the write pumps have stopped.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	for _, clients := range h.users {
+		for client := range clients {
+			h.remove(client)
+		}
+	}
+	h.mu.Unlock()
+
+	h.writers.Wait()
+}
+
+// writePump writes the client's queued messages to its connection and pings it when idle. It
+// closes the connection once the client is removed from its hub or a write fails.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+		c.hub.writers.Done()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.Conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("❌ Error writing to %s WebSocket client of user %d: %v", c.hub.name, c.UserID, err)
+				c.hub.Unregister(c)
+				return
+			}
+
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.hub.Unregister(c)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,5 @@
+-- Drop training permission tables
+DROP TABLE IF EXISTS model_training_runs;
+DROP TABLE IF EXISTS training_approval_requests;
+DROP TABLE IF EXISTS model_training_members;
+DROP TABLE IF EXISTS model_training_settings;
@@ -0,0 +1,57 @@
+-- Per-model training settings (who may start server and agent trainings)
+CREATE TABLE model_training_settings (
+    model_id INTEGER PRIMARY KEY REFERENCES models(id) ON DELETE CASCADE,
+    server_training_policy VARCHAR(20) NOT NULL DEFAULT 'owner' CHECK (server_training_policy IN ('owner', 'members')),
+    agent_training_policy VARCHAR(20) NOT NULL DEFAULT 'members' CHECK (agent_training_policy IN ('owner', 'members')),
+    default_monthly_cap INTEGER CHECK (default_monthly_cap IS NULL OR default_monthly_cap >= 0), -- NULL means no cap
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Members allowed to train a model they do not own
+CREATE TABLE model_training_members (
+    model_id INTEGER NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    monthly_cap INTEGER CHECK (monthly_cap IS NULL OR monthly_cap >= 0), -- NULL falls back to default_monthly_cap
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (model_id, user_id)
+);
+
+-- Approval requests for trainings over a member's monthly cap
+CREATE TABLE training_approval_requests (
+    id SERIAL PRIMARY KEY,
+    model_id INTEGER NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    requester_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    training_type VARCHAR(20) NOT NULL CHECK (training_type IN ('server', 'agent')),
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'used')),
+    decided_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Trainings started on a model, used to enforce monthly caps
+CREATE TABLE model_training_runs (
+    id SERIAL PRIMARY KEY,
+    model_id INTEGER NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    training_id VARCHAR(255),
+    training_type VARCHAR(20) NOT NULL CHECK (training_type IN ('server', 'agent')),
+    approval_request_id INTEGER REFERENCES training_approval_requests(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_model_training_members_user_id ON model_training_members(user_id);
+CREATE INDEX idx_training_approval_requests_model_id ON training_approval_requests(model_id, status);
+CREATE INDEX idx_training_approval_requests_requester_id ON training_approval_requests(requester_id);
+CREATE INDEX idx_model_training_runs_model_user ON model_training_runs(model_id, user_id, created_at DESC);
+
+CREATE TRIGGER update_model_training_settings_updated_at BEFORE UPDATE ON model_training_settings
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_model_training_members_updated_at BEFORE UPDATE ON model_training_members
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE model_training_settings IS 'Who may start server (credit-consuming) and agent trainings on a model';
+COMMENT ON COLUMN model_training_members.monthly_cap IS 'Server trainings per calendar month before an approval is required';
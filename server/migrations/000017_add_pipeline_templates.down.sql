@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS template_installs;
+
+DROP INDEX IF EXISTS idx_published_models_listing_type;
+
+ALTER TABLE published_models DROP CONSTRAINT IF EXISTS published_models_listing_content_check;
+
+DELETE FROM published_models WHERE listing_type = 'pipeline_template';
+ALTER TABLE published_models ALTER COLUMN trained_model_path SET NOT NULL;
+
+ALTER TABLE published_models
+    DROP COLUMN IF EXISTS installs_count,
+    DROP COLUMN IF EXISTS template_path,
+    DROP COLUMN IF EXISTS listing_type;
@@ -0,0 +1,27 @@
+-- Marketplace listings can be trained models or reusable pipeline templates
+ALTER TABLE published_models
+    ADD COLUMN listing_type VARCHAR(30) NOT NULL DEFAULT 'model' CHECK (listing_type IN ('model', 'pipeline_template')),
+    ADD COLUMN template_path VARCHAR(500), -- Template archive relative to the uploads directory (scripts, config, requirements)
+    ADD COLUMN installs_count INTEGER NOT NULL DEFAULT 0;
+
+-- Pipeline templates ship without weights
+ALTER TABLE published_models ALTER COLUMN trained_model_path DROP NOT NULL;
+
+ALTER TABLE published_models ADD CONSTRAINT published_models_listing_content_check CHECK (
+    (listing_type = 'model' AND trained_model_path IS NOT NULL) OR
+    (listing_type = 'pipeline_template' AND template_path IS NOT NULL)
+);
+
+CREATE INDEX idx_published_models_listing_type ON published_models(listing_type);
+
+-- Installs of pipeline templates into a user's workspace
+CREATE TABLE template_installs (
+    id SERIAL PRIMARY KEY,
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    model_id INTEGER REFERENCES models(id) ON DELETE SET NULL, -- Model created in the user's workspace
+    installed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_template_installs_published_model_id ON template_installs(published_model_id);
+CREATE INDEX idx_template_installs_user_id ON template_installs(user_id);
@@ -0,0 +1,2 @@
+-- Drop training environments table
+DROP TABLE IF EXISTS training_environments;
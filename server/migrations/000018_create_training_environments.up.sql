@@ -0,0 +1,17 @@
+-- Exact environment a successful training ran in, captured on the server or the agent
+CREATE TABLE training_environments (
+    id SERIAL PRIMARY KEY,
+    training_id VARCHAR(255) NOT NULL UNIQUE,
+    model_id INTEGER REFERENCES models(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('server', 'agent')),
+    python_version VARCHAR(50),
+    cuda_version VARCHAR(50), -- NULL when no CUDA toolkit or CUDA build of PyTorch was found
+    platform VARCHAR(255),
+    packages TEXT[] NOT NULL DEFAULT '{}', -- pip freeze output, one requirement per entry
+    captured_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_training_environments_model_id ON training_environments(model_id, captured_at DESC);
+
+COMMENT ON TABLE training_environments IS 'Environment captured after each successful training, used to generate requirements.lock';
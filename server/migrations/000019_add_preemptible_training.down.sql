@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS training_preemptions;
+
+ALTER TABLE model_training_runs DROP COLUMN IF EXISTS execution_mode;
@@ -0,0 +1,15 @@
+-- Server trainings can run on-demand or as cheaper preemptible jobs
+ALTER TABLE model_training_runs
+    ADD COLUMN execution_mode VARCHAR(20) NOT NULL DEFAULT 'on_demand' CHECK (execution_mode IN ('on_demand', 'preemptible'));
+
+-- Evictions of preemptible trainings and when they were resumed
+CREATE TABLE training_preemptions (
+    id SERIAL PRIMARY KEY,
+    training_id VARCHAR(255) NOT NULL,
+    reason TEXT,
+    checkpoint_path VARCHAR(500), -- Last checkpoint the training resumes from, NULL if it restarts from scratch
+    evicted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resumed_at TIMESTAMP
+);
+
+CREATE INDEX idx_training_preemptions_training_id ON training_preemptions(training_id);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS share_download_identity;
+
+DROP TABLE IF EXISTS model_download_ledger;
@@ -0,0 +1,25 @@
+-- Ledger of marketplace downloads shown to publishers.
+-- Raw IP addresses are never stored: only the country resolved by the proxy and an
+-- anonymized buyer reference unless the buyer chose to share their identity.
+CREATE TABLE model_download_ledger (
+    id SERIAL PRIMARY KEY,
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    publisher_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    buyer_id INTEGER REFERENCES users(id) ON DELETE SET NULL, -- NULL once the buyer deletes their account
+    buyer_ref VARCHAR(32) NOT NULL, -- Anonymized buyer ID, stable per listing
+    identity_shared BOOLEAN NOT NULL DEFAULT false, -- Buyer allowed publishers to see their username
+    version VARCHAR(64), -- Revision of the downloaded artifact
+    country CHAR(2), -- ISO 3166-1 alpha-2, NULL when unknown
+    price_paid INTEGER NOT NULL DEFAULT 0,
+    downloaded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_download_ledger_listing ON model_download_ledger(published_model_id, downloaded_at DESC);
+CREATE INDEX idx_download_ledger_publisher ON model_download_ledger(publisher_id);
+CREATE INDEX idx_download_ledger_downloaded_at ON model_download_ledger(downloaded_at);
+
+-- Buyers opt in to showing their username in publishers' download ledgers
+ALTER TABLE users ADD COLUMN share_download_identity BOOLEAN NOT NULL DEFAULT false;
+
+COMMENT ON TABLE model_download_ledger IS 'Per-download audit of marketplace listings for publishers';
+COMMENT ON COLUMN model_download_ledger.buyer_ref IS 'HMAC of the buyer and listing, so buyers cannot be linked across publishers';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS bundle_purchases;
+DROP TABLE IF EXISTS marketplace_bundle_items;
+DROP TABLE IF EXISTS marketplace_bundles;
@@ -0,0 +1,42 @@
+-- Bundles sell several marketplace listings (models, pipeline templates) together for one price
+CREATE TABLE marketplace_bundles (
+    id SERIAL PRIMARY KEY,
+    publisher_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price INTEGER NOT NULL DEFAULT 0, -- Combined price in cents
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT bundle_price_non_negative CHECK (price >= 0)
+);
+
+CREATE TABLE marketplace_bundle_items (
+    bundle_id INTEGER NOT NULL REFERENCES marketplace_bundles(id) ON DELETE CASCADE,
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bundle_id, published_model_id)
+);
+
+-- A bundle purchase grants access to every item in the bundle
+CREATE TABLE bundle_purchases (
+    id SERIAL PRIMARY KEY,
+    bundle_id INTEGER NOT NULL REFERENCES marketplace_bundles(id) ON DELETE CASCADE,
+    buyer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    price_paid INTEGER NOT NULL,
+    payment_method VARCHAR(50),
+    transaction_id VARCHAR(255),
+    purchased_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT unique_user_bundle_purchase UNIQUE(buyer_id, bundle_id)
+);
+
+CREATE INDEX idx_marketplace_bundles_publisher_id ON marketplace_bundles(publisher_id);
+CREATE INDEX idx_marketplace_bundle_items_listing ON marketplace_bundle_items(published_model_id);
+CREATE INDEX idx_bundle_purchases_buyer_id ON bundle_purchases(buyer_id);
+
+CREATE TRIGGER update_marketplace_bundles_updated_at
+    BEFORE UPDATE ON marketplace_bundles
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
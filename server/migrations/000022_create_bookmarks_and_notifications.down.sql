@@ -0,0 +1,4 @@
+ALTER TABLE published_models DROP COLUMN IF EXISTS version;
+
+DROP TABLE IF EXISTS model_bookmarks;
+DROP TABLE IF EXISTS notifications;
@@ -0,0 +1,29 @@
+-- In-app notifications, also pushed over the user's WebSocket and optionally emailed
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL, -- e.g. 'bookmark_price_drop', 'bookmark_new_version'
+    title VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    data JSONB,
+    emailed BOOLEAN NOT NULL DEFAULT false,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notifications_user_created ON notifications(user_id, created_at DESC);
+CREATE INDEX idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+-- Marketplace wishlist
+CREATE TABLE model_bookmarks (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    email_alerts BOOLEAN NOT NULL DEFAULT false, -- Email on price drops and new versions
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, published_model_id)
+);
+
+CREATE INDEX idx_model_bookmarks_listing ON model_bookmarks(published_model_id);
+
+-- Listings get a version that is bumped when the publisher ships a new artifact
+ALTER TABLE published_models ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS storefront_listings;
+DROP TABLE IF EXISTS publisher_storefronts;
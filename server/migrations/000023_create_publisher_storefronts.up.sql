@@ -0,0 +1,22 @@
+-- Branding of a publisher's public storefront
+CREATE TABLE publisher_storefronts (
+    publisher_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    tagline VARCHAR(160),
+    banner_path VARCHAR(500), -- Served from /uploads
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Custom order of a publisher's listings; pinned listings are highlighted at the top.
+-- Listings without a row follow in publishing order.
+CREATE TABLE storefront_listings (
+    publisher_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    pinned BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (publisher_id, published_model_id)
+);
+
+CREATE TRIGGER update_publisher_storefronts_updated_at
+    BEFORE UPDATE ON publisher_storefronts
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
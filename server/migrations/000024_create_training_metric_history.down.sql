@@ -0,0 +1,4 @@
+ALTER TABLE published_models DROP COLUMN IF EXISTS version_published_at;
+DROP INDEX IF EXISTS idx_users_read_only_api_key;
+ALTER TABLE users DROP COLUMN IF EXISTS read_only_api_key;
+DROP TABLE IF EXISTS training_metric_history;
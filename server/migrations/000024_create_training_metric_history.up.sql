@@ -0,0 +1,27 @@
+-- Every metrics line reported by a training, kept for charting historical runs
+CREATE TABLE training_metric_history (
+    id BIGSERIAL PRIMARY KEY,
+    training_id VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    model VARCHAR(255) NOT NULL, -- Model folder the training ran from
+    epoch INTEGER NOT NULL,
+    total_epochs INTEGER NOT NULL DEFAULT 0,
+    train_loss DOUBLE PRECISION,
+    val_loss DOUBLE PRECISION,
+    train_accuracy DOUBLE PRECISION,
+    val_accuracy DOUBLE PRECISION,
+    test_accuracy DOUBLE PRECISION,
+    custom_metrics JSONB,
+    recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_training_metric_history_user_time ON training_metric_history(user_id, recorded_at);
+CREATE INDEX idx_training_metric_history_user_model ON training_metric_history(user_id, model, recorded_at);
+
+-- Read-only API keys can query training data (e.g. from Grafana) but cannot upload models or run agents
+ALTER TABLE users ADD COLUMN read_only_api_key VARCHAR(255);
+CREATE UNIQUE INDEX idx_users_read_only_api_key ON users(read_only_api_key);
+
+-- When the current version of a listing was shipped, shown as a deployment annotation
+ALTER TABLE published_models ADD COLUMN version_published_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+UPDATE published_models SET version_published_at = published_at;
@@ -0,0 +1,5 @@
+ALTER TABLE model_training_settings
+    DROP COLUMN IF EXISTS anomaly_accuracy_drop,
+    DROP COLUMN IF EXISTS anomaly_exploding_factor,
+    DROP COLUMN IF EXISTS anomaly_frozen_epochs,
+    DROP COLUMN IF EXISTS anomaly_auto_stop;
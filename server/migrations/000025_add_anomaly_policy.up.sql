@@ -0,0 +1,6 @@
+-- Per-model policy for the anomaly detector that watches live training metrics
+ALTER TABLE model_training_settings
+    ADD COLUMN anomaly_auto_stop BOOLEAN NOT NULL DEFAULT false, -- Stop a run as soon as an anomaly is detected
+    ADD COLUMN anomaly_frozen_epochs INTEGER NOT NULL DEFAULT 5 CHECK (anomaly_frozen_epochs >= 2),
+    ADD COLUMN anomaly_exploding_factor DOUBLE PRECISION NOT NULL DEFAULT 10 CHECK (anomaly_exploding_factor > 1),
+    ADD COLUMN anomaly_accuracy_drop DOUBLE PRECISION NOT NULL DEFAULT 0.5 CHECK (anomaly_accuracy_drop > 0 AND anomaly_accuracy_drop < 1);
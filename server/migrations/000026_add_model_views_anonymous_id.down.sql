@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS unique_anonymous_id_view;
+DROP INDEX IF EXISTS unique_anonymous_view;
+
+-- Views recorded by cookie may share an IP address
+DELETE FROM model_views a
+USING model_views b
+WHERE a.user_id IS NULL AND b.user_id IS NULL
+  AND a.model_id = b.model_id AND a.ip_address = b.ip_address AND a.id > b.id;
+
+CREATE UNIQUE INDEX unique_anonymous_view ON model_views(model_id, ip_address) WHERE user_id IS NULL;
+ALTER TABLE model_views DROP COLUMN IF EXISTS anonymous_id;
@@ -0,0 +1,9 @@
+-- Identify anonymous viewers by a session cookie so their views can be linked to their account after login
+ALTER TABLE model_views ADD COLUMN anonymous_id VARCHAR(64);
+
+-- IP addresses only identify anonymous viewers without the cookie
+DROP INDEX IF EXISTS unique_anonymous_view;
+CREATE UNIQUE INDEX unique_anonymous_view ON model_views(model_id, ip_address) WHERE user_id IS NULL AND anonymous_id IS NULL;
+CREATE UNIQUE INDEX unique_anonymous_id_view ON model_views(model_id, anonymous_id) WHERE anonymous_id IS NOT NULL;
+
+COMMENT ON COLUMN model_views.anonymous_id IS 'Anonymous session cookie of the viewer, kept after the view is linked to an account';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_download_ledger_publisher_country;
+DROP INDEX IF EXISTS idx_model_views_model_country;
+ALTER TABLE model_views DROP COLUMN IF EXISTS country;
@@ -0,0 +1,5 @@
+-- Country of marketplace viewers for publisher analytics (ISO 3166-1 alpha-2, NULL when unknown)
+ALTER TABLE model_views ADD COLUMN country CHAR(2);
+
+CREATE INDEX idx_model_views_model_country ON model_views(model_id, country);
+CREATE INDEX idx_download_ledger_publisher_country ON model_download_ledger(publisher_id, country);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS listing_appeals;
+
+DROP INDEX IF EXISTS idx_published_models_moderation_status;
+ALTER TABLE published_models
+    DROP COLUMN IF EXISTS removed_by,
+    DROP COLUMN IF EXISTS removed_at,
+    DROP COLUMN IF EXISTS removal_reason,
+    DROP COLUMN IF EXISTS moderation_status;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,32 @@
+-- Platform administrators can remove marketplace listings for policy reasons
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- Removed listings stay in the database, hidden from everyone but their publisher
+ALTER TABLE published_models
+    ADD COLUMN moderation_status VARCHAR(20) NOT NULL DEFAULT 'active'
+        CHECK (moderation_status IN ('active', 'removed')),
+    ADD COLUMN removal_reason TEXT,
+    ADD COLUMN removed_at TIMESTAMP,
+    ADD COLUMN removed_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_published_models_moderation_status ON published_models(moderation_status);
+
+-- Publishers appeal a removal; an admin upholds it or reinstates the listing
+CREATE TABLE listing_appeals (
+    id SERIAL PRIMARY KEY,
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    publisher_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    removal_reason TEXT, -- The reason the appeal answers, kept if the listing is removed again
+    statement TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'upheld', 'reinstated')),
+    admin_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    admin_response TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+-- One open appeal per listing at a time
+CREATE UNIQUE INDEX unique_pending_listing_appeal ON listing_appeals(published_model_id) WHERE status = 'pending';
+CREATE INDEX idx_listing_appeals_status ON listing_appeals(status, created_at);
+
+COMMENT ON TABLE listing_appeals IS 'Appeals of marketplace listings removed by admins';
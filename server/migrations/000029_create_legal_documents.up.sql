@@ -0,0 +1,22 @@
+-- Versioned terms of service and privacy policy. The newest version of each kind is current.
+CREATE TABLE legal_documents (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('terms', 'privacy')),
+    version VARCHAR(32) NOT NULL,
+    content TEXT NOT NULL,
+    published_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    published_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (kind, version)
+);
+
+CREATE INDEX idx_legal_documents_current ON legal_documents(kind, published_at DESC, id DESC);
+
+-- When each user accepted each document version, kept for compliance
+CREATE TABLE legal_acceptances (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    document_id INTEGER NOT NULL REFERENCES legal_documents(id) ON DELETE CASCADE,
+    accepted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, document_id)
+);
+
+COMMENT ON TABLE legal_acceptances IS 'Acceptance of terms of service and privacy policy versions';
@@ -0,0 +1,6 @@
+-- Password reset links. Only a SHA-256 hash of the token is stored.
+ALTER TABLE users
+    ADD COLUMN password_reset_token_hash VARCHAR(64),
+    ADD COLUMN password_reset_expires_at TIMESTAMP;
+
+CREATE INDEX idx_users_password_reset_token_hash ON users(password_reset_token_hash);
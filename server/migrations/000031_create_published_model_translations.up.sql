@@ -0,0 +1,15 @@
+-- Per-locale descriptions of marketplace listings. Machine translations are generated with
+-- Gemini on publish; publisher translations override them and are never regenerated.
+CREATE TABLE published_model_translations (
+    id SERIAL PRIMARY KEY,
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    locale VARCHAR(16) NOT NULL,
+    description TEXT NOT NULL,
+    short_description VARCHAR(500),
+    source VARCHAR(20) NOT NULL DEFAULT 'machine' CHECK (source IN ('machine', 'publisher')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (published_model_id, locale)
+);
+
+CREATE INDEX idx_published_model_translations_locale ON published_model_translations(locale);
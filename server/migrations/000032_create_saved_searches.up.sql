@@ -0,0 +1,17 @@
+-- Marketplace searches saved by users. Alerts notify the user of new listings matching the
+-- filters; last_checked_at is the publish time up to which listings were already checked.
+CREATE TABLE saved_searches (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    filters JSONB NOT NULL DEFAULT '{}',
+    alerts_enabled BOOLEAN NOT NULL DEFAULT true,
+    email_alerts BOOLEAN NOT NULL DEFAULT false,
+    last_checked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_alerted_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_saved_searches_user_id ON saved_searches(user_id);
+CREATE INDEX idx_saved_searches_alerts ON saved_searches(alerts_enabled) WHERE alerts_enabled;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS listing_duplicate_flags;
+DROP INDEX IF EXISTS idx_published_models_artifact_sha256;
+ALTER TABLE published_models
+    DROP COLUMN IF EXISTS duplicate_of,
+    DROP COLUMN IF EXISTS description_minhash,
+    DROP COLUMN IF EXISTS artifact_sha256;
@@ -0,0 +1,24 @@
+-- Fingerprints used to detect re-uploaded marketplace listings: the SHA-256 of the model file
+-- and a MinHash signature of the description's word shingles
+ALTER TABLE published_models
+    ADD COLUMN artifact_sha256 VARCHAR(64),
+    ADD COLUMN description_minhash BIGINT[],
+    ADD COLUMN duplicate_of INTEGER REFERENCES published_models(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_published_models_artifact_sha256 ON published_models(artifact_sha256);
+
+-- Likely duplicates of an older listing, reviewed by admins. Confirmed duplicates are linked to the original.
+CREATE TABLE listing_duplicate_flags (
+    id SERIAL PRIMARY KEY,
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    original_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('checksum', 'description')),
+    similarity REAL NOT NULL, -- 1 for identical files, estimated Jaccard similarity for descriptions
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'confirmed', 'dismissed')),
+    admin_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    UNIQUE (published_model_id, original_id)
+);
+
+CREATE INDEX idx_listing_duplicate_flags_status ON listing_duplicate_flags(status, created_at);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_model_purchases_rental_expiry;
+ALTER TABLE model_purchases
+    DROP COLUMN IF EXISTS rental_reminder_sent_at,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS is_rental;
+ALTER TABLE published_models
+    DROP CONSTRAINT IF EXISTS rental_days_positive,
+    DROP CONSTRAINT IF EXISTS rental_price_positive,
+    DROP COLUMN IF EXISTS rental_days,
+    DROP COLUMN IF EXISTS rental_price;
@@ -0,0 +1,14 @@
+-- Listings can be rented for a fixed number of days instead of bought outright
+ALTER TABLE published_models
+    ADD COLUMN rental_price INTEGER, -- Price in cents of one rental period (NULL = not rentable)
+    ADD COLUMN rental_days INTEGER NOT NULL DEFAULT 30,
+    ADD CONSTRAINT rental_price_positive CHECK (rental_price IS NULL OR rental_price > 0),
+    ADD CONSTRAINT rental_days_positive CHECK (rental_days > 0);
+
+-- A rental is a purchase with an expiry. Renewing extends it; buying the model outright clears it.
+ALTER TABLE model_purchases
+    ADD COLUMN is_rental BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN expires_at TIMESTAMP, -- NULL for purchases
+    ADD COLUMN rental_reminder_sent_at TIMESTAMP;
+
+CREATE INDEX idx_model_purchases_rental_expiry ON model_purchases(expires_at) WHERE is_rental;
@@ -0,0 +1,17 @@
+-- Results of the standardized benchmark run on training agents. An agent is identified by its
+-- owner and the hostname it reports; scores are only comparable within a suite version.
+CREATE TABLE agent_benchmarks (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    agent_name VARCHAR(255) NOT NULL,
+    suite VARCHAR(20) NOT NULL,
+    device VARCHAR(255) NOT NULL DEFAULT '',
+    matmul_gflops DOUBLE PRECISION NOT NULL,
+    cnn_samples_per_sec DOUBLE PRECISION, -- NULL when the agent could not run the CNN workload
+    duration_seconds DOUBLE PRECISION NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    system_info JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_agent_benchmarks_agent ON agent_benchmarks(user_id, agent_name, created_at DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS agent_artifacts;
+DROP TABLE IF EXISTS agent_trainings;
+DROP TABLE IF EXISTS agents;
@@ -0,0 +1,41 @@
+-- Training agents a user has connected, identified by the hostname they report
+CREATE TABLE agents (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    system_info JSONB,
+    inventory_reported_at TIMESTAMP,
+    last_connected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- The training history an agent reports on connect
+CREATE TABLE agent_trainings (
+    id SERIAL PRIMARY KEY,
+    agent_id INTEGER NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    training_id VARCHAR(255) NOT NULL,
+    folder_path TEXT NOT NULL DEFAULT '',
+    script_name VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    model_path TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    UNIQUE (agent_id, training_id)
+);
+
+-- Model files present on an agent's machine. server_path is set once the file was uploaded.
+CREATE TABLE agent_artifacts (
+    id SERIAL PRIMARY KEY,
+    agent_id INTEGER NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    modified_at TIMESTAMP,
+    training_id VARCHAR(255),
+    server_path TEXT,
+    reported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (agent_id, path)
+);
+
+CREATE INDEX idx_agent_artifacts_sha256 ON agent_artifacts(sha256);
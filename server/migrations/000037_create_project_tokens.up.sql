@@ -0,0 +1,17 @@
+-- Tokens that let a CI pipeline act on one model without the owner's personal API key.
+-- Only the SHA-256 of a token is stored; token_prefix identifies it in listings.
+CREATE TABLE project_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    model_id INTEGER NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(16) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    training_profile JSONB NOT NULL DEFAULT '{}',
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_project_tokens_user_id ON project_tokens(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ci_runs;
+DROP TABLE IF EXISTS ci_integrations;
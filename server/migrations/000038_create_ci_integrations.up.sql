@@ -0,0 +1,29 @@
+-- Lets CI retrain a model on a commit. Dispatches are signed with secret (HMAC-SHA256);
+-- results are reported as a GitHub commit status and/or to callback_url.
+CREATE TABLE ci_integrations (
+    id SERIAL PRIMARY KEY,
+    model_id INTEGER NOT NULL UNIQUE REFERENCES models(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    repository_url TEXT,
+    github_repository VARCHAR(255),
+    github_token TEXT,
+    callback_url TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Trainings started by CI dispatches, until their result is reported
+CREATE TABLE ci_runs (
+    id SERIAL PRIMARY KEY,
+    integration_id INTEGER NOT NULL REFERENCES ci_integrations(id) ON DELETE CASCADE,
+    commit_sha CHAR(40) NOT NULL,
+    training_id VARCHAR(255),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    message TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX idx_ci_runs_active ON ci_runs(status) WHERE status IN ('pending', 'running');
+CREATE INDEX idx_ci_runs_integration_id ON ci_runs(integration_id, created_at DESC);
@@ -0,0 +1,4 @@
+ALTER TABLE published_models DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE published_models DROP COLUMN IF EXISTS visibility;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,26 @@
+-- Organizations group users who share an internal model registry
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Owners and admins manage members; every member sees the organization's listings
+CREATE TABLE organization_members (
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+
+-- Who can see a listing: everyone, the members of organization_id, or only its publisher.
+-- Listings of a deleted organization are only visible to their publisher.
+ALTER TABLE published_models
+    ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'org', 'private')),
+    ADD COLUMN organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_published_models_organization_id ON published_models(organization_id) WHERE organization_id IS NOT NULL;
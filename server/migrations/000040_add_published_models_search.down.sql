@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_published_models_search_vector;
+DROP TRIGGER IF EXISTS update_published_models_search_vector ON published_models;
+DROP FUNCTION IF EXISTS published_models_search_vector();
+ALTER TABLE published_models DROP COLUMN IF EXISTS search_vector;
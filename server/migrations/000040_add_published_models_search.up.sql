@@ -0,0 +1,28 @@
+-- Full-text search document of marketplace listings. Names and tags weigh most, then the short
+-- description, then the description.
+ALTER TABLE published_models ADD COLUMN search_vector TSVECTOR;
+
+CREATE OR REPLACE FUNCTION published_models_search_vector()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', COALESCE(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('english', array_to_string(COALESCE(NEW.tags, '{}'), ' ')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(NEW.short_description, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(NEW.description, '')), 'C');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER update_published_models_search_vector
+    BEFORE INSERT OR UPDATE OF name, tags, short_description, description ON published_models
+    FOR EACH ROW
+    EXECUTE FUNCTION published_models_search_vector();
+
+UPDATE published_models SET search_vector =
+    setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+    setweight(to_tsvector('english', array_to_string(COALESCE(tags, '{}'), ' ')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(short_description, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'C');
+
+CREATE INDEX idx_published_models_search_vector ON published_models USING GIN(search_vector);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_published_models_sunset;
+ALTER TABLE published_models
+    DROP COLUMN IF EXISTS end_of_life_at,
+    DROP COLUMN IF EXISTS sunset_at,
+    DROP COLUMN IF EXISTS successor_id,
+    DROP COLUMN IF EXISTS deprecation_message,
+    DROP COLUMN IF EXISTS deprecated_at;
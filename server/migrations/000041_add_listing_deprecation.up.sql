@@ -0,0 +1,11 @@
+-- Deprecation and end of life of marketplace listings. A deprecated listing stays listed until its
+-- sunset, then it is unlisted (end_of_life_at) but kept so past buyers can still download it.
+ALTER TABLE published_models
+    ADD COLUMN deprecated_at TIMESTAMP,
+    ADD COLUMN deprecation_message TEXT,
+    ADD COLUMN successor_id INTEGER REFERENCES published_models(id) ON DELETE SET NULL,
+    ADD COLUMN sunset_at TIMESTAMP,
+    ADD COLUMN end_of_life_at TIMESTAMP;
+
+CREATE INDEX idx_published_models_sunset ON published_models(sunset_at)
+    WHERE deprecated_at IS NOT NULL AND end_of_life_at IS NULL;
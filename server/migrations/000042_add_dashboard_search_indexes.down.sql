@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_published_models_name_trgm;
+DROP INDEX IF EXISTS idx_model_training_runs_training_id_trgm;
+DROP INDEX IF EXISTS idx_models_training_script_trgm;
+DROP INDEX IF EXISTS idx_models_name_trgm;
@@ -0,0 +1,8 @@
+-- Trigram indexes for the dashboard quick switcher, which matches substrings and typos of the
+-- user's model names, training scripts, run IDs and listing names
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_models_name_trgm ON models USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_models_training_script_trgm ON models USING GIN (training_script gin_trgm_ops);
+CREATE INDEX idx_model_training_runs_training_id_trgm ON model_training_runs USING GIN (training_id gin_trgm_ops);
+CREATE INDEX idx_published_models_name_trgm ON published_models USING GIN (name gin_trgm_ops);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_models_notes_trgm;
+DROP INDEX IF EXISTS idx_models_tags;
+ALTER TABLE models
+    DROP COLUMN IF EXISTS notes,
+    DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,7 @@
+-- User-defined tags and free-form notes on private models
+ALTER TABLE models
+    ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN notes TEXT;
+
+CREATE INDEX idx_models_tags ON models USING GIN(tags);
+CREATE INDEX idx_models_notes_trgm ON models USING GIN (notes gin_trgm_ops);
@@ -0,0 +1,9 @@
+ALTER TABLE published_models
+    DROP COLUMN IF EXISTS primary_metric_value,
+    DROP COLUMN IF EXISTS primary_metric_direction,
+    DROP COLUMN IF EXISTS primary_metric;
+
+ALTER TABLE models
+    DROP COLUMN IF EXISTS primary_metric_value,
+    DROP COLUMN IF EXISTS primary_metric_direction,
+    DROP COLUMN IF EXISTS primary_metric;
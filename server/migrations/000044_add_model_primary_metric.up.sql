@@ -0,0 +1,16 @@
+-- The metric of record of a model: the metric its trainings are judged, compared and listed by
+ALTER TABLE models
+    ADD COLUMN primary_metric VARCHAR(64) NOT NULL DEFAULT 'accuracy',
+    ADD COLUMN primary_metric_direction VARCHAR(10) NOT NULL DEFAULT 'higher'
+        CHECK (primary_metric_direction IN ('higher', 'lower')),
+    ADD COLUMN primary_metric_value DOUBLE PRECISION;
+
+ALTER TABLE published_models
+    ADD COLUMN primary_metric VARCHAR(64) NOT NULL DEFAULT 'accuracy',
+    ADD COLUMN primary_metric_direction VARCHAR(10) NOT NULL DEFAULT 'higher'
+        CHECK (primary_metric_direction IN ('higher', 'lower')),
+    ADD COLUMN primary_metric_value DOUBLE PRECISION;
+
+-- Accuracy models keep reporting their accuracy score as their primary metric
+UPDATE models SET primary_metric_value = accuracy_score WHERE accuracy_score IS NOT NULL;
+UPDATE published_models SET primary_metric_value = accuracy_score WHERE accuracy_score IS NOT NULL;
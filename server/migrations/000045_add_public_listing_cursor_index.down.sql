@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_published_models_public_cursor;
@@ -0,0 +1,3 @@
+-- Stable cursor pagination of the public marketplace API: newest first, ties broken by id
+CREATE INDEX idx_published_models_public_cursor ON published_models(published_at DESC, id DESC)
+    WHERE is_active = true AND visibility = 'public' AND moderation_status = 'active';
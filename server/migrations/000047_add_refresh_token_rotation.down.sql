@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_sessions_family_id;
+DELETE FROM sessions WHERE rotated_at IS NOT NULL;
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS family_id;
@@ -0,0 +1,7 @@
+-- Refresh tokens are single use: refreshing rotates the session into a new row of the same family.
+-- Rotated rows are kept until they expire so that reusing a stolen token can be detected.
+ALTER TABLE sessions
+    ADD COLUMN family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+    ADD COLUMN rotated_at TIMESTAMP;
+
+CREATE INDEX idx_sessions_family_id ON sessions(family_id);
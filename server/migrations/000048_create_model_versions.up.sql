@@ -0,0 +1,21 @@
+-- Every completed training of a model is kept as a version; the active one is the model's trained model
+CREATE TABLE model_versions (
+    id SERIAL PRIMARY KEY,
+    model_id INTEGER NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    training_id VARCHAR(255),
+    source_path VARCHAR(500), -- trained_model_path reported by the training
+    artifact_path VARCHAR(500), -- Copy of the trained model relative to the uploads directory, NULL when it stayed on an agent
+    file_size BIGINT,
+    artifact_sha256 CHAR(64),
+    accuracy_score DECIMAL(5, 2),
+    primary_metric VARCHAR(64),
+    primary_metric_value DOUBLE PRECISION,
+    metrics JSONB NOT NULL DEFAULT '{}', -- Final metrics of the training
+    is_active BOOLEAN NOT NULL DEFAULT false,
+    activated_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (model_id, version)
+);
+
+CREATE UNIQUE INDEX idx_model_versions_active ON model_versions(model_id) WHERE is_active;
@@ -0,0 +1,11 @@
+UPDATE published_models SET listing_type = 'model' WHERE listing_type = 'weights_only';
+
+ALTER TABLE published_models DROP CONSTRAINT published_models_listing_content_check;
+ALTER TABLE published_models ADD CONSTRAINT published_models_listing_content_check CHECK (
+    (listing_type = 'model' AND trained_model_path IS NOT NULL) OR
+    (listing_type = 'pipeline_template' AND template_path IS NOT NULL)
+);
+
+ALTER TABLE published_models DROP CONSTRAINT published_models_listing_type_check;
+ALTER TABLE published_models ADD CONSTRAINT published_models_listing_type_check
+    CHECK (listing_type IN ('model', 'pipeline_template'));
@@ -0,0 +1,10 @@
+-- Weights-only listings ship the trained model without its training script or data
+ALTER TABLE published_models DROP CONSTRAINT published_models_listing_type_check;
+ALTER TABLE published_models ADD CONSTRAINT published_models_listing_type_check
+    CHECK (listing_type IN ('model', 'pipeline_template', 'weights_only'));
+
+ALTER TABLE published_models DROP CONSTRAINT published_models_listing_content_check;
+ALTER TABLE published_models ADD CONSTRAINT published_models_listing_content_check CHECK (
+    (listing_type IN ('model', 'weights_only') AND trained_model_path IS NOT NULL) OR
+    (listing_type = 'pipeline_template' AND template_path IS NOT NULL)
+);
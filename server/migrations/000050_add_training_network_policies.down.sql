@@ -0,0 +1,8 @@
+ALTER TABLE model_training_runs
+    DROP COLUMN IF EXISTS egress_attempts,
+    DROP COLUMN IF EXISTS allowed_hosts,
+    DROP COLUMN IF EXISTS network_mode;
+
+ALTER TABLE organizations
+    DROP COLUMN IF EXISTS training_allowed_hosts,
+    DROP COLUMN IF EXISTS training_network_mode;
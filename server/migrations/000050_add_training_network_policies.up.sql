@@ -0,0 +1,10 @@
+-- Organizations can restrict the network of their members' server trainings beyond the deployment's policy
+ALTER TABLE organizations
+    ADD COLUMN training_network_mode VARCHAR(20) CHECK (training_network_mode IN ('open', 'none', 'allowlist')), -- NULL keeps the deployment's mode
+    ADD COLUMN training_allowed_hosts TEXT[] NOT NULL DEFAULT '{}';
+
+-- Network access each server training ran with and the destinations it reached or was blocked from
+ALTER TABLE model_training_runs
+    ADD COLUMN network_mode VARCHAR(20),
+    ADD COLUMN allowed_hosts TEXT[],
+    ADD COLUMN egress_attempts JSONB;
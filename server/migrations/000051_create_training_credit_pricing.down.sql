@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_model_training_runs_finalized;
+
+ALTER TABLE model_training_runs
+    DROP COLUMN IF EXISTS finalized_at,
+    DROP COLUMN IF EXISTS charged_credits,
+    DROP COLUMN IF EXISTS metered_credits,
+    DROP COLUMN IF EXISTS run_seconds,
+    DROP COLUMN IF EXISTS estimated_credits,
+    DROP COLUMN IF EXISTS hardware_tier;
+
+DROP TABLE IF EXISTS training_credit_pricing;
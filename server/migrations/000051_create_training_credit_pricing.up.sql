@@ -0,0 +1,26 @@
+-- Credit cost of server trainings per hardware tier, metered by running time
+CREATE TABLE training_credit_pricing (
+    hardware_tier VARCHAR(20) PRIMARY KEY, -- cpu, mig or gpu
+    credits_per_hour NUMERIC(10, 2) NOT NULL CHECK (credits_per_hour >= 0),
+    minimum_credits NUMERIC(10, 2) NOT NULL DEFAULT 0 CHECK (minimum_credits >= 0), -- Charged for shorter runs
+    preemptible_multiplier NUMERIC(4, 3) NOT NULL DEFAULT 0.5 CHECK (preemptible_multiplier > 0 AND preemptible_multiplier <= 1),
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO training_credit_pricing (hardware_tier, credits_per_hour, minimum_credits) VALUES
+    ('cpu', 1, 1),
+    ('mig', 2, 1),
+    ('gpu', 4, 1);
+
+-- Estimate shown at start and the metered cost once the training ends. Credits are fractional;
+-- the user's balance is charged whole credits as the month's metered total crosses them.
+ALTER TABLE model_training_runs
+    ADD COLUMN hardware_tier VARCHAR(20),
+    ADD COLUMN estimated_credits NUMERIC(10, 2),
+    ADD COLUMN run_seconds INTEGER,
+    ADD COLUMN metered_credits NUMERIC(10, 2),
+    ADD COLUMN charged_credits INTEGER,
+    ADD COLUMN finalized_at TIMESTAMP;
+
+CREATE INDEX idx_model_training_runs_finalized ON model_training_runs(user_id, finalized_at) WHERE finalized_at IS NOT NULL;
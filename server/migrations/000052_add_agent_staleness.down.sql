@@ -0,0 +1,6 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS agent_offline_alert_minutes,
+    DROP COLUMN IF EXISTS agent_stale_after_days;
+
+DROP INDEX IF EXISTS idx_agents_last_seen;
+ALTER TABLE agents DROP COLUMN IF EXISTS last_seen_at;
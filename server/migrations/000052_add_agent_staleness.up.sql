@@ -0,0 +1,13 @@
+-- When an agent was last connected, updated while it stays connected and when it disconnects
+ALTER TABLE agents ADD COLUMN last_seen_at TIMESTAMP;
+UPDATE agents SET last_seen_at = last_connected_at;
+ALTER TABLE agents
+    ALTER COLUMN last_seen_at SET NOT NULL,
+    ALTER COLUMN last_seen_at SET DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_agents_last_seen ON agents(last_seen_at);
+
+-- Per user staleness policy, NULL keeps the deployment's default
+ALTER TABLE users
+    ADD COLUMN agent_stale_after_days INTEGER CHECK (agent_stale_after_days > 0),
+    ADD COLUMN agent_offline_alert_minutes INTEGER CHECK (agent_offline_alert_minutes >= 0);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS model_upload_chunks;
+DROP TABLE IF EXISTS model_uploads;
@@ -0,0 +1,27 @@
+-- Chunked model uploads. Chunks are stored on disk until the upload is completed into a model.
+CREATE TABLE model_uploads (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    chunk_size INTEGER NOT NULL CHECK (chunk_size > 0),
+    total_chunks INTEGER NOT NULL CHECK (total_chunks > 0),
+    sha256 CHAR(64) NOT NULL, -- Of the whole zip, checked before it is assembled into a model
+    status VARCHAR(16) NOT NULL DEFAULT 'uploading' CHECK (status IN ('uploading', 'completing', 'completed')),
+    model_id INTEGER REFERENCES models(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_model_uploads_user ON model_uploads(user_id, created_at DESC);
+CREATE INDEX idx_model_uploads_expires ON model_uploads(expires_at);
+
+CREATE TABLE model_upload_chunks (
+    upload_id VARCHAR(64) NOT NULL REFERENCES model_uploads(id) ON DELETE CASCADE,
+    chunk_index INTEGER NOT NULL CHECK (chunk_index >= 0),
+    size_bytes INTEGER NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (upload_id, chunk_index)
+);
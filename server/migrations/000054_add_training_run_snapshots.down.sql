@@ -0,0 +1,5 @@
+ALTER TABLE model_training_runs
+    DROP COLUMN IF EXISTS dataset_files,
+    DROP COLUMN IF EXISTS dataset_hash,
+    DROP COLUMN IF EXISTS source_files,
+    DROP COLUMN IF EXISTS hyperparameters;
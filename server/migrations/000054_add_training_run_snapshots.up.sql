@@ -0,0 +1,6 @@
+-- What a training started with, so two runs can be compared
+ALTER TABLE model_training_runs
+    ADD COLUMN hyperparameters JSONB, -- Arguments and environment variables the script was started with
+    ADD COLUMN source_files JSONB, -- Path -> content of the model folder's scripts and config files
+    ADD COLUMN dataset_hash CHAR(64), -- SHA-256 over the checksums of the model folder's data files
+    ADD COLUMN dataset_files JSONB; -- Path -> SHA-256 of the data files, NULL when there are too many
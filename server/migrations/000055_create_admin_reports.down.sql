@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS admin_reports;
+DROP TABLE IF EXISTS request_stats;
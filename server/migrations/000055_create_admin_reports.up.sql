@@ -0,0 +1,21 @@
+-- API requests and error responses per hour, for error rates in admin reports
+CREATE TABLE request_stats (
+    hour TIMESTAMP PRIMARY KEY,
+    requests BIGINT NOT NULL DEFAULT 0,
+    client_errors BIGINT NOT NULL DEFAULT 0, -- 4xx responses
+    server_errors BIGINT NOT NULL DEFAULT 0 -- 5xx responses
+);
+
+-- Periodic usage reports for admins, kept as history
+CREATE TABLE admin_reports (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('weekly')),
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    report JSONB NOT NULL,
+    emailed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (kind, period_start)
+);
+
+COMMENT ON TABLE admin_reports IS 'Growth, storage, revenue and error rate summaries emailed to admins';
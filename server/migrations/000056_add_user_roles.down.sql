@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS credit_adjustments;
+
+DROP INDEX IF EXISTS idx_users_role;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS suspended_by,
+    DROP COLUMN IF EXISTS suspension_reason,
+    DROP COLUMN IF EXISTS suspended_at;
+
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+UPDATE users SET is_admin = true WHERE role = 'admin';
+ALTER TABLE users DROP COLUMN role;
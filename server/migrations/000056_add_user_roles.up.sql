@@ -0,0 +1,25 @@
+-- Users have a role instead of the is_admin flag
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+UPDATE users SET role = 'admin' WHERE is_admin;
+ALTER TABLE users DROP COLUMN is_admin;
+
+-- Admins can suspend accounts; suspended users cannot sign in or use the API
+ALTER TABLE users
+    ADD COLUMN suspended_at TIMESTAMP,
+    ADD COLUMN suspension_reason TEXT,
+    ADD COLUMN suspended_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_users_role ON users(role) WHERE role <> 'user';
+
+-- Manual changes of training credits by admins
+CREATE TABLE credit_adjustments (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    admin_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    delta INTEGER NOT NULL,
+    balance_after INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_credit_adjustments_user_id ON credit_adjustments(user_id, created_at DESC);
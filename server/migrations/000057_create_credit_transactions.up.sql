@@ -0,0 +1,16 @@
+-- Every change of a user's training credits, for their usage history
+CREATE TABLE credit_transactions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- A reservation holds whole credits when a server training starts; finalizing the training
+    -- refunds what it did not use or charges what it used beyond the reservation
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('reservation', 'refund', 'charge', 'adjustment')),
+    amount INTEGER NOT NULL, -- Negative when credits are taken
+    balance_after INTEGER NOT NULL,
+    training_id VARCHAR(255),
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_credit_transactions_user_id ON credit_transactions(user_id, created_at DESC);
+CREATE INDEX idx_credit_transactions_training_id ON credit_transactions(training_id) WHERE training_id IS NOT NULL;
@@ -0,0 +1,9 @@
+DELETE FROM credit_transactions WHERE kind = 'reset';
+ALTER TABLE credit_transactions DROP CONSTRAINT credit_transactions_kind_check;
+ALTER TABLE credit_transactions ADD CONSTRAINT credit_transactions_kind_check
+    CHECK (kind IN ('reservation', 'refund', 'charge', 'adjustment'));
+
+DROP TABLE IF EXISTS credit_resets;
+
+DROP INDEX IF EXISTS idx_users_next_credit_reset_at;
+ALTER TABLE users DROP COLUMN IF EXISTS next_credit_reset_at;
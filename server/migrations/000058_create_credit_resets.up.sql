@@ -0,0 +1,33 @@
+-- Training credits are reset to the tier's monthly amount on each anniversary of the subscription
+ALTER TABLE users ADD COLUMN next_credit_reset_at TIMESTAMP;
+
+-- Schedule the next reset of active subscribers on the anniversary of their subscription
+UPDATE users u SET next_credit_reset_at = (
+    SELECT COALESCE(u.subscription_start_date, CURRENT_TIMESTAMP) + make_interval(months => n)
+    FROM generate_series(1, 1200) AS n
+    WHERE COALESCE(u.subscription_start_date, CURRENT_TIMESTAMP) + make_interval(months => n) > CURRENT_TIMESTAMP
+    ORDER BY n
+    LIMIT 1
+)
+WHERE COALESCE(u.subscription_tier, 'free') != 'free' AND u.subscription_status = 'active';
+
+CREATE INDEX idx_users_next_credit_reset_at ON users(next_credit_reset_at) WHERE next_credit_reset_at IS NOT NULL;
+
+-- Resets, prorations on tier changes and cancellations of users' training credits
+CREATE TABLE credit_resets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('anniversary', 'subscribed', 'tier_change', 'canceled')),
+    previous_tier VARCHAR(20),
+    tier VARCHAR(20) NOT NULL,
+    previous_credits INTEGER NOT NULL,
+    credits INTEGER NOT NULL,
+    next_reset_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_credit_resets_user_id ON credit_resets(user_id, created_at DESC);
+
+ALTER TABLE credit_transactions DROP CONSTRAINT credit_transactions_kind_check;
+ALTER TABLE credit_transactions ADD CONSTRAINT credit_transactions_kind_check
+    CHECK (kind IN ('reservation', 'refund', 'charge', 'adjustment', 'reset'));
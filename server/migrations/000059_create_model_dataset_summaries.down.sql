@@ -0,0 +1 @@
+DROP TABLE IF EXISTS model_dataset_summaries;
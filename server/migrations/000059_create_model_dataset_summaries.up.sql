@@ -0,0 +1,7 @@
+-- Dataset summaries of model folders, inspected again when the folder changes
+CREATE TABLE model_dataset_summaries (
+    model_id INTEGER PRIMARY KEY REFERENCES models(id) ON DELETE CASCADE,
+    summary JSONB NOT NULL,
+    folder_modified_at TIMESTAMP NOT NULL,
+    inspected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
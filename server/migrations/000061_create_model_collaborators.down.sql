@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS model_collaborator_invitations;
+DROP TABLE IF EXISTS model_collaborators;
@@ -0,0 +1,30 @@
+-- Users a model is shared with and what they may do with it: read (view and download) or train
+CREATE TABLE model_collaborators (
+    model_id INTEGER NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('read', 'train')),
+    invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (model_id, user_id)
+);
+
+-- Invitations to collaborate on a model, sent to an email address
+CREATE TABLE model_collaborator_invitations (
+    id SERIAL PRIMARY KEY,
+    model_id INTEGER NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('read', 'train')),
+    invited_by INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'revoked')),
+    expires_at TIMESTAMP NOT NULL,
+    responded_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_model_collaborators_user_id ON model_collaborators(user_id);
+CREATE UNIQUE INDEX idx_model_collaborator_invitations_pending ON model_collaborator_invitations(model_id, LOWER(email)) WHERE status = 'pending';
+CREATE INDEX idx_model_collaborator_invitations_email ON model_collaborator_invitations(LOWER(email)) WHERE status = 'pending';
+
+CREATE TRIGGER update_model_collaborators_updated_at BEFORE UPDATE ON model_collaborators
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
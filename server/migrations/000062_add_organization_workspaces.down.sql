@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS idx_model_training_runs_organization_id;
+ALTER TABLE model_training_runs DROP COLUMN IF EXISTS organization_id;
+
+DELETE FROM credit_transactions WHERE kind = 'transfer';
+ALTER TABLE credit_transactions DROP CONSTRAINT credit_transactions_kind_check;
+ALTER TABLE credit_transactions ADD CONSTRAINT credit_transactions_kind_check
+    CHECK (kind IN ('reservation', 'refund', 'charge', 'adjustment', 'reset'));
+
+DELETE FROM credit_transactions WHERE organization_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_credit_transactions_organization_id;
+ALTER TABLE credit_transactions DROP COLUMN IF EXISTS organization_id;
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS training_credits;
+
+DROP INDEX IF EXISTS idx_models_organization_id;
+ALTER TABLE models DROP COLUMN IF EXISTS organization_id;
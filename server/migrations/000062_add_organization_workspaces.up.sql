@@ -0,0 +1,27 @@
+-- Models shared with an organization can be viewed, downloaded and trained by all its members
+ALTER TABLE models ADD COLUMN organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_models_organization_id ON models(organization_id) WHERE organization_id IS NOT NULL;
+
+-- Credits members put in the organization's pool; server trainings of its models are paid from it
+ALTER TABLE organizations
+    ADD COLUMN training_credits INTEGER NOT NULL DEFAULT 0 CHECK (training_credits >= 0);
+
+-- Transactions with an organization_id moved the organization's pool, balance_after is its balance
+-- and user_id is the member who made them
+ALTER TABLE credit_transactions
+    ADD COLUMN organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_credit_transactions_organization_id ON credit_transactions(organization_id, created_at DESC)
+    WHERE organization_id IS NOT NULL;
+
+ALTER TABLE credit_transactions DROP CONSTRAINT credit_transactions_kind_check;
+ALTER TABLE credit_transactions ADD CONSTRAINT credit_transactions_kind_check
+    CHECK (kind IN ('reservation', 'refund', 'charge', 'adjustment', 'reset', 'transfer'));
+
+-- The organization a training's model was shared with when it started, for its training history
+ALTER TABLE model_training_runs
+    ADD COLUMN organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_model_training_runs_organization_id ON model_training_runs(organization_id, created_at DESC)
+    WHERE organization_id IS NOT NULL;
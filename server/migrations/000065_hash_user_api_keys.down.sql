@@ -0,0 +1,6 @@
+-- Hashed keys cannot be restored; their users have to regenerate them
+ALTER TABLE users
+    DROP COLUMN IF EXISTS read_only_api_key_prefix,
+    DROP COLUMN IF EXISTS read_only_api_key_hash,
+    DROP COLUMN IF EXISTS api_key_prefix,
+    DROP COLUMN IF EXISTS api_key_hash;
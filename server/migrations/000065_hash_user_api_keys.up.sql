@@ -0,0 +1,11 @@
+-- Account and read-only API keys are stored as their SHA-256, with a short prefix to identify
+-- them. Keys created before this migration stay in api_key / read_only_api_key until their next
+-- use or regeneration, which moves them to the hash columns and clears the plaintext.
+ALTER TABLE users
+    ADD COLUMN api_key_hash CHAR(64),
+    ADD COLUMN api_key_prefix VARCHAR(16),
+    ADD COLUMN read_only_api_key_hash CHAR(64),
+    ADD COLUMN read_only_api_key_prefix VARCHAR(16);
+
+CREATE UNIQUE INDEX idx_users_api_key_hash ON users(api_key_hash);
+CREATE UNIQUE INDEX idx_users_read_only_api_key_hash ON users(read_only_api_key_hash);
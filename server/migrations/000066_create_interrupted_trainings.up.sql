@@ -0,0 +1,15 @@
+-- Server trainings stopped because the server shut down, with what is needed to resume them:
+-- the original request and the last checkpoint the script reported
+CREATE TABLE interrupted_trainings (
+    training_id VARCHAR(255) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    model_id INTEGER REFERENCES models(id) ON DELETE CASCADE,
+    request JSONB NOT NULL,
+    checkpoint_path VARCHAR(500), -- NULL if the training restarts from scratch
+    run_seconds INTEGER NOT NULL DEFAULT 0,
+    interrupted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resumed_training_id VARCHAR(255),
+    resumed_at TIMESTAMP
+);
+
+CREATE INDEX idx_interrupted_trainings_user_id ON interrupted_trainings(user_id, interrupted_at DESC);
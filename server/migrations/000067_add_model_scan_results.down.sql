@@ -0,0 +1,4 @@
+ALTER TABLE models
+    DROP COLUMN IF EXISTS scanned_at,
+    DROP COLUMN IF EXISTS scan_engine,
+    DROP COLUMN IF EXISTS scan_status;
@@ -0,0 +1,6 @@
+-- Outcome of the malware scan of a model's uploaded archive: clean when a scanner found nothing,
+-- unscanned when none is configured and only file types were checked. NULL for local models.
+ALTER TABLE models
+    ADD COLUMN scan_status VARCHAR(20) CHECK (scan_status IN ('clean', 'unscanned')),
+    ADD COLUMN scan_engine VARCHAR(100),
+    ADD COLUMN scanned_at TIMESTAMP;
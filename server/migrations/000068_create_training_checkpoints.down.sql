@@ -0,0 +1,2 @@
+ALTER TABLE model_training_runs DROP COLUMN IF EXISTS request;
+DROP TABLE IF EXISTS training_checkpoints;
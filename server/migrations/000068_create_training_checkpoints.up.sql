@@ -0,0 +1,15 @@
+-- Checkpoints server trainings saved, so a failed training can be restarted from one of them.
+-- Only the last few of each training are kept; pruned checkpoints are deleted.
+CREATE TABLE training_checkpoints (
+    id SERIAL PRIMARY KEY,
+    training_id VARCHAR(255) NOT NULL,
+    path VARCHAR(500) NOT NULL, -- As given to the script: relative to the model folder, or absolute
+    epoch INTEGER NOT NULL DEFAULT 0,
+    is_best BOOLEAN NOT NULL DEFAULT FALSE,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (training_id, path)
+);
+
+-- The request a server training was started with, to restart it from a checkpoint
+ALTER TABLE model_training_runs ADD COLUMN request JSONB;
@@ -0,0 +1,3 @@
+-- Custom regular expressions reading the metrics of a model's training output, tried before the
+-- built-in parsers: [{"name": "...", "pattern": "..."}], see metricparse.Pattern
+ALTER TABLE models ADD COLUMN metric_patterns JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS comment_reports;
+
+ALTER TABLE model_comments
+    DROP COLUMN IF EXISTS hidden_at,
+    DROP COLUMN IF EXISTS hidden_by,
+    DROP COLUMN IF EXISTS hidden;
@@ -0,0 +1,22 @@
+-- Comments the publisher of a listing or an admin hid. Hidden comments are only shown to their
+-- author and to moderators.
+ALTER TABLE model_comments
+    ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN hidden_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN hidden_at TIMESTAMP;
+
+-- Comments users reported to the publisher and admins. Reports are resolved when a moderator
+-- hides the comment or dismissed, and deleted with it.
+CREATE TABLE comment_reports (
+    id SERIAL PRIMARY KEY,
+    comment_id INTEGER NOT NULL REFERENCES model_comments(id) ON DELETE CASCADE,
+    reporter_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    resolved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (comment_id, reporter_id)
+);
+
+CREATE INDEX idx_comment_reports_open ON comment_reports(comment_id) WHERE status = 'open';
@@ -0,0 +1,4 @@
+-- Public profile of a user, shown on their publisher page
+ALTER TABLE users
+    ADD COLUMN bio TEXT CHECK (LENGTH(bio) <= 500),
+    ADD COLUMN avatar_path VARCHAR(512);
@@ -0,0 +1,10 @@
+-- Users following publishers; followers see their releases in their feed and are notified of them
+CREATE TABLE user_follows (
+    follower_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    publisher_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, publisher_id),
+    CHECK (follower_id <> publisher_id)
+);
+
+CREATE INDEX idx_user_follows_publisher ON user_follows(publisher_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_published_models_trending;
+
+ALTER TABLE published_models
+    DROP COLUMN IF EXISTS trending_computed_at,
+    DROP COLUMN IF EXISTS trending_score;
@@ -0,0 +1,6 @@
+-- Trending score of listings, recomputed on a schedule from recent downloads, likes and views
+ALTER TABLE published_models
+    ADD COLUMN trending_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN trending_computed_at TIMESTAMP;
+
+CREATE INDEX idx_published_models_trending ON published_models(trending_score DESC) WHERE is_active = true;
@@ -0,0 +1,15 @@
+-- Daily marketplace activity of each listing, aggregated from model_views, model_download_ledger,
+-- model_likes and model_purchases for publisher analytics. Revenue is in cents.
+CREATE TABLE listing_daily_stats (
+    published_model_id INTEGER NOT NULL REFERENCES published_models(id) ON DELETE CASCADE,
+    publisher_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    likes INTEGER NOT NULL DEFAULT 0,
+    purchases INTEGER NOT NULL DEFAULT 0,
+    revenue INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (published_model_id, day)
+);
+
+CREATE INDEX idx_listing_daily_stats_publisher ON listing_daily_stats(publisher_id, day);
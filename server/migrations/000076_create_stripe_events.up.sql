@@ -0,0 +1,17 @@
+-- Stripe webhook events, so that a retried or replayed event is applied only once and failed
+-- events can be inspected by admins
+CREATE TABLE stripe_events (
+    id VARCHAR(255) PRIMARY KEY, -- Stripe event ID (evt_...)
+    type VARCHAR(100) NOT NULL,
+    livemode BOOLEAN NOT NULL DEFAULT false,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'processing', -- 'processing', 'processed', 'failed'
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    stripe_created_at TIMESTAMP NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP
+);
+
+CREATE INDEX idx_stripe_events_status ON stripe_events(status, received_at DESC);
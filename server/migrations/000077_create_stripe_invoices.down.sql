@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS invoices_synced_at;
+DROP TABLE IF EXISTS stripe_invoices;
@@ -0,0 +1,22 @@
+-- Local copy of users' Stripe invoices for the invoice history, refreshed from Stripe when it is
+-- older than INVOICE_CACHE_MINUTES and by invoice webhooks
+CREATE TABLE stripe_invoices (
+    id VARCHAR(255) PRIMARY KEY, -- Stripe invoice ID (in_...)
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    number VARCHAR(100),
+    status VARCHAR(30) NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    amount_due BIGINT NOT NULL DEFAULT 0, -- In cents
+    amount_paid BIGINT NOT NULL DEFAULT 0, -- In cents
+    total BIGINT NOT NULL DEFAULT 0, -- In cents
+    hosted_invoice_url TEXT,
+    invoice_pdf TEXT,
+    period_start TIMESTAMP,
+    period_end TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    synced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stripe_invoices_user ON stripe_invoices(user_id, created_at DESC);
+
+ALTER TABLE users ADD COLUMN invoices_synced_at TIMESTAMP;
@@ -0,0 +1,33 @@
+-- Discount codes for subscriptions and marketplace purchases, managed by admins
+CREATE TABLE coupons (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE, -- Stored upper case
+    description TEXT NOT NULL DEFAULT '',
+    discount_type VARCHAR(10) NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+    discount_value INTEGER NOT NULL CHECK (discount_value > 0), -- Percent off, or cents off
+    applies_to VARCHAR(20) NOT NULL DEFAULT 'all' CHECK (applies_to IN ('all', 'subscription', 'purchase')),
+    expires_at TIMESTAMP,
+    max_redemptions INTEGER, -- NULL for no limit
+    max_per_user INTEGER NOT NULL DEFAULT 1,
+    redemptions_count INTEGER NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    stripe_coupon_id VARCHAR(255), -- Created on the first subscription checkout using the code
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (discount_type <> 'percent' OR discount_value <= 100)
+);
+
+-- Completed payments that used a coupon; reference is the payment intent or checkout session
+CREATE TABLE coupon_redemptions (
+    id SERIAL PRIMARY KEY,
+    coupon_id INTEGER NOT NULL REFERENCES coupons(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL, -- 'subscription' or 'purchase'
+    reference VARCHAR(255) NOT NULL,
+    discount INTEGER NOT NULL, -- Cents
+    redeemed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (coupon_id, reference)
+);
+
+CREATE INDEX idx_coupon_redemptions_user ON coupon_redemptions(coupon_id, user_id);
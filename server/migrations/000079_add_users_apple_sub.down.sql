@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_apple_sub;
+ALTER TABLE users DROP COLUMN IF EXISTS apple_sub;
@@ -0,0 +1,5 @@
+-- Stable Apple ID of users who signed in with Apple, which keeps working when they hide or change
+-- their email
+ALTER TABLE users ADD COLUMN apple_sub VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_users_apple_sub ON users(apple_sub) WHERE apple_sub IS NOT NULL;
@@ -0,0 +1,4 @@
+-- The device a session was signed in from, listed on the user's active sessions
+ALTER TABLE sessions
+    ADD COLUMN user_agent TEXT,
+    ADD COLUMN ip_address VARCHAR(45);
@@ -0,0 +1,170 @@
+"""Report training progress to AiManage.
+
+Every function prints a single line to stdout that the AiManage server (or the
+local training agent) parses:
+
+    PROGRESS: {"epoch": 1, "total_epochs": 10, "train_loss": 0.52, "status": "training"}
+    CHECKPOINT: {"path": "checkpoints/epoch_1.pth", "epoch": 1}
+    ARTIFACT: {"path": "model.pth", "type": "model"}
+
+The server advertises the newest PROGRESS protocol it understands in the
+AIMANAGE_PROGRESS_PROTOCOL environment variable. Protocol v2 adds custom
+metrics, training stages and inline artifacts; when the server only speaks v1
+those extras are dropped with a warning on stderr.
+"""
+
+import json
+import os
+import sys
+
+__version__ = "0.2.0"
+
+__all__ = [
+    "protocol_version",
+    "report_progress",
+    "report_completed",
+    "register_checkpoint",
+    "declare_artifact",
+    "is_dry_run",
+    "resume_checkpoint",
+    "ARTIFACT_TYPES",
+]
+
+PROGRESS_PREFIX = "PROGRESS:"
+CHECKPOINT_PREFIX = "CHECKPOINT:"
+ARTIFACT_PREFIX = "ARTIFACT:"
+
+ARTIFACT_TYPES = ("model", "checkpoint", "metrics", "plot", "log", "other")
+
+# Newest PROGRESS protocol this package can emit
+LATEST_PROTOCOL = 2
+
+_LOSS_FIELDS = ("train_loss", "val_loss", "test_loss", "loss")
+_ACCURACY_FIELDS = ("train_accuracy", "val_accuracy", "test_accuracy", "accuracy")
+
+
+def is_dry_run():
+    """Return True when the script is being validated and should train as little as possible."""
+    return os.environ.get("AIMANAGE_DRY_RUN", "") not in ("", "0", "false")
+
+
+def resume_checkpoint():
+    """Return the checkpoint to resume from after a preemption or restart, or None on a fresh start.
+
+    Preemptible trainings receive SIGTERM when they are evicted. Save and register a
+    checkpoint before exiting; the resumed run finds it here. Trainings restarted from a
+    checkpoint find the selected one here too.
+    """
+    return os.environ.get("AIMANAGE_RESUME_CHECKPOINT") or None
+
+
+def protocol_version():
+    """Return the PROGRESS protocol version to emit, negotiated with the server."""
+    try:
+        offered = int(os.environ.get("AIMANAGE_PROGRESS_PROTOCOL", "1"))
+    except ValueError:
+        offered = 1
+    return max(1, min(offered, LATEST_PROTOCOL))
+
+
+def _warn(message):
+    sys.stderr.write("aimanage_progress: %s\n" % message)
+
+
+def _emit(prefix, payload):
+    # Flush so the line reaches the server immediately, even when stdout is a pipe
+    sys.stdout.write("%s %s\n" % (prefix, json.dumps(payload)))
+    sys.stdout.flush()
+
+
+def _percentage(value):
+    value = float(value)
+    if 0 < value <= 1:
+        return round(value * 100, 4)
+    return value
+
+
+def _progress_payload(epoch, total_epochs, status, metrics, stage=None, custom_metrics=None, artifacts=None):
+    version = protocol_version()
+    payload = {}
+    if version >= 2:
+        payload["version"] = version
+    payload["epoch"] = int(epoch)
+    payload["total_epochs"] = int(total_epochs)
+    for field in _LOSS_FIELDS:
+        if metrics.get(field) is not None:
+            payload[field] = float(metrics[field])
+    for field in _ACCURACY_FIELDS:
+        if metrics.get(field) is not None:
+            payload[field] = _percentage(metrics[field])
+    unknown = set(metrics) - set(_LOSS_FIELDS) - set(_ACCURACY_FIELDS)
+    if unknown:
+        raise TypeError("unknown progress fields: %s" % ", ".join(sorted(unknown)))
+    payload["status"] = status
+
+    extras = {}
+    if stage:
+        extras["stage"] = str(stage)
+    if custom_metrics:
+        extras["metrics"] = {str(k): float(v) for k, v in custom_metrics.items()}
+    if artifacts:
+        extras["artifacts"] = [_artifact_payload(**a) if isinstance(a, dict) else _artifact_payload(a) for a in artifacts]
+    if extras and version < 2:
+        _warn("server only supports PROGRESS v1, dropping %s" % ", ".join(sorted(extras)))
+    elif extras:
+        payload.update(extras)
+    return payload
+
+
+def report_progress(epoch, total_epochs, stage=None, custom_metrics=None, artifacts=None, **metrics):
+    """Report metrics for an epoch.
+
+    Keyword arguments may be any of train_loss, val_loss, test_loss, loss,
+    train_accuracy, val_accuracy, test_accuracy and accuracy. Accuracies are
+    percentages; values between 0 and 1 are converted.
+
+    stage (e.g. "preprocessing", "training", "evaluation"), custom_metrics
+    (a dict of name -> number) and artifacts (paths or dicts accepted by
+    declare_artifact) require protocol v2.
+    """
+    _emit(PROGRESS_PREFIX, _progress_payload(epoch, total_epochs, "training", metrics, stage, custom_metrics, artifacts))
+
+
+def report_completed(total_epochs, custom_metrics=None, artifacts=None, **metrics):
+    """Report the final metrics once training has finished.
+
+    Pass test_accuracy (or val_accuracy) so the final accuracy is stored on the model.
+    """
+    _emit(PROGRESS_PREFIX, _progress_payload(total_epochs, total_epochs, "completed", metrics, None, custom_metrics, artifacts))
+
+
+def register_checkpoint(path, epoch=None, is_best=False, metrics=None):
+    """Register a checkpoint file written by the script."""
+    if not path:
+        raise ValueError("checkpoint path is required")
+    payload = {"path": str(path)}
+    if epoch is not None:
+        payload["epoch"] = int(epoch)
+    if is_best:
+        payload["is_best"] = True
+    if metrics:
+        payload["metrics"] = dict(metrics)
+    _emit(CHECKPOINT_PREFIX, payload)
+
+
+def _artifact_payload(path, type="other", name=None, description=None):
+    if not path:
+        raise ValueError("artifact path is required")
+    if type not in ARTIFACT_TYPES:
+        raise ValueError("artifact type must be one of: %s" % ", ".join(ARTIFACT_TYPES))
+    payload = {"path": str(path), "type": type}
+    if name:
+        payload["name"] = name
+    if description:
+        payload["description"] = description
+    return payload
+
+
+def declare_artifact(path, type="other", name=None, description=None):
+    """Declare an output file. Use type="model" for the final trained model."""
+    _emit(ARTIFACT_PREFIX, _artifact_payload(path, type, name, description))
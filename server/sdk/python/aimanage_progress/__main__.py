@@ -0,0 +1,93 @@
+"""Validate a training script's output against the AiManage server schema.
+
+    python -m aimanage_progress validate --server URL --token TOKEN -- python train.py
+    python -m aimanage_progress validate --server URL --token TOKEN --file train.log
+"""
+
+import argparse
+import json
+import os
+import subprocess
+import sys
+import urllib.error
+import urllib.request
+
+
+def _latest_protocol(server):
+    try:
+        with urllib.request.urlopen(server.rstrip("/") + "/v1/train/progress-schema") as response:
+            return int(json.loads(response.read().decode()).get("latest_version", 1))
+    except (urllib.error.URLError, ValueError):
+        return 1
+
+
+def _run_script(command, timeout, protocol):
+    env = dict(os.environ, AIMANAGE_DRY_RUN="1", PYTHONUNBUFFERED="1", AIMANAGE_PROGRESS_PROTOCOL=str(protocol))
+    try:
+        completed = subprocess.run(
+            command, env=env, stdout=subprocess.PIPE, stderr=subprocess.STDOUT,
+            timeout=timeout, universal_newlines=True,
+        )
+        return completed.stdout
+    except subprocess.TimeoutExpired as e:
+        print("Script did not finish within %ds, validating partial output" % timeout, file=sys.stderr)
+        output = e.stdout or ""
+        return output.decode() if isinstance(output, bytes) else output
+
+
+def _validate(server, token, output):
+    request = urllib.request.Request(
+        server.rstrip("/") + "/v1/train/validate-output",
+        data=json.dumps({"output": output}).encode(),
+        headers={"Content-Type": "application/json", "Authorization": "Bearer " + token},
+        method="POST",
+    )
+    with urllib.request.urlopen(request) as response:
+        return json.loads(response.read().decode())
+
+
+def main(argv=None):
+    parser = argparse.ArgumentParser(prog="python -m aimanage_progress")
+    sub = parser.add_subparsers(dest="command")
+    validate = sub.add_parser("validate", help="validate a script's PROGRESS/CHECKPOINT/ARTIFACT lines")
+    validate.add_argument("--server", default=os.environ.get("AIMANAGE_SERVER", ""))
+    validate.add_argument("--token", default=os.environ.get("AIMANAGE_TOKEN", ""))
+    validate.add_argument("--file", help="validate a saved log instead of running a script")
+    validate.add_argument("--timeout", type=int, default=300)
+    validate.add_argument("script", nargs=argparse.REMAINDER, help="command to run, after --")
+    args = parser.parse_args(argv)
+
+    if args.command != "validate":
+        parser.print_help()
+        return 2
+    if not args.server or not args.token:
+        parser.error("--server and --token (or AIMANAGE_SERVER / AIMANAGE_TOKEN) are required")
+
+    if args.file:
+        with open(args.file) as f:
+            output = f.read()
+    else:
+        command = [c for c in args.script if c != "--"]
+        if not command:
+            parser.error("give a command to run after --, or use --file")
+        output = _run_script(command, args.timeout, _latest_protocol(args.server))
+
+    try:
+        result = _validate(args.server, args.token, output)
+    except urllib.error.HTTPError as e:
+        print("Validation request failed: %s %s" % (e.code, e.read().decode()), file=sys.stderr)
+        return 1
+
+    for line in result.get("lines", []):
+        for error in line.get("errors") or []:
+            print("line %d: error: %s" % (line["line_number"], error))
+        for warning in line.get("warnings") or []:
+            print("line %d: warning: %s" % (line["line_number"], warning))
+
+    summary = result.get("summary", {})
+    print(json.dumps(summary, indent=2))
+    return 0 if summary.get("valid") else 1
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -4,10 +4,16 @@ AI Training Agent - Runs on user's machine and connects to server
 This allows users to train models using their own compute resources
 """
 import asyncio
+import hashlib
 import websockets
 import json
 import subprocess
 import os
+import shutil
+import tempfile
+import platform
+import re
+from urllib.parse import quote
 import sys
 from pathlib import Path
 import argparse
@@ -15,21 +21,165 @@ import torch
 import time
 import aiohttp
 
+# Same script the server runs after a training (aiAgent.EnvironmentCaptureScript)
+ENVIRONMENT_CAPTURE_SCRIPT = """
+import json, platform, re, subprocess, sys
+info = {"python_version": platform.python_version(), "platform": platform.platform(), "packages": [], "cuda_version": None}
+try:
+    out = subprocess.run([sys.executable, "-m", "pip", "freeze"], capture_output=True, text=True, timeout=60)
+    info["packages"] = [l.strip() for l in out.stdout.splitlines() if l.strip()]
+except Exception:
+    pass
+try:
+    import torch
+    info["cuda_version"] = torch.version.cuda
+except Exception:
+    pass
+if not info["cuda_version"]:
+    try:
+        out = subprocess.run(["nvcc", "--version"], capture_output=True, text=True, timeout=10)
+        m = re.search(r"release ([0-9.]+)", out.stdout)
+        info["cuda_version"] = m.group(1) if m else None
+    except Exception:
+        pass
+print(json.dumps(info))
+"""
+
+# Same script the server runs on a trained model (aiAgent.ONNXExportScript)
+ONNX_EXPORT_SCRIPT = """
+import json, os, sys
+src, dst = sys.argv[1], sys.argv[2]
+ext = os.path.splitext(src)[1].lower()
+tmp = dst + ".tmp"
+result = {"status": "skipped", "framework": None, "reason": None}
+
+def input_shape(model):
+    shape = os.environ.get("ONNX_INPUT_SHAPE", "").strip()
+    if shape:
+        return tuple(int(d) for d in shape.replace("x", ",").split(",") if d.strip())
+    import torch.nn as nn
+    for layer in model.modules():
+        if isinstance(layer, nn.Linear):
+            return (1, layer.in_features)
+        if isinstance(layer, nn.Conv1d):
+            return (1, layer.in_channels, 128)
+        if isinstance(layer, nn.Conv2d):
+            return (1, layer.in_channels, 224, 224)
+        if isinstance(layer, nn.Conv3d):
+            return (1, layer.in_channels, 16, 112, 112)
+    raise ValueError("cannot tell the input shape of the model, set ONNX_INPUT_SHAPE")
+
+try:
+    if ext in (".pt", ".pth"):
+        result["framework"] = "pytorch"
+        import torch
+        try:
+            model = torch.jit.load(src, map_location="cpu")
+        except Exception:
+            model = torch.load(src, map_location="cpu", weights_only=False)
+        if not isinstance(model, torch.nn.Module):
+            result["reason"] = "the file holds weights only, save the whole model to export it"
+        else:
+            model.eval()
+            dummy = torch.randn(*input_shape(model))
+            torch.onnx.export(model, dummy, tmp, input_names=["input"], output_names=["output"],
+                              dynamic_axes={"input": {0: "batch"}, "output": {0: "batch"}})
+            result["status"] = "exported"
+    elif ext in (".h5", ".keras"):
+        result["framework"] = "tensorflow"
+        import tensorflow as tf, tf2onnx
+        model = tf.keras.models.load_model(src)
+        tf2onnx.convert.from_keras(model, output_path=tmp)
+        result["status"] = "exported"
+    elif ext in (".pkl", ".joblib"):
+        result["framework"] = "sklearn"
+        try:
+            import joblib
+            model = joblib.load(src)
+        except ImportError:
+            import pickle
+            with open(src, "rb") as f:
+                model = pickle.load(f)
+        from skl2onnx import to_onnx
+        from skl2onnx.common.data_types import FloatTensorType
+        features = getattr(model, "n_features_in_", None)
+        if features is None:
+            raise ValueError("the model has no n_features_in_, fit it before saving")
+        onx = to_onnx(model, initial_types=[("input", FloatTensorType([None, int(features)]))])
+        with open(tmp, "wb") as f:
+            f.write(onx.SerializeToString())
+        result["status"] = "exported"
+    else:
+        result["reason"] = "no ONNX converter for %s files" % (ext or "extensionless")
+except Exception as e:
+    result["status"] = "failed"
+    result["reason"] = "%s: %s" % (type(e).__name__, e)
+if result["status"] == "exported":
+    os.replace(tmp, dst)
+elif os.path.exists(tmp):
+    os.remove(tmp)
+print(json.dumps(result))
+"""
+
+# Benchmark suite the server scores (aiAgent.BenchmarkSuiteVersion)
+BENCHMARK_SUITE = "v1"
+
+# Files recognized as trained models
+MODEL_EXTENSIONS = [
+    '.pth', '.pt',           # PyTorch
+    '.h5', '.keras',         # TensorFlow/Keras
+    '.pkl', '.pickle',       # scikit-learn
+    '.ckpt',                 # TensorFlow checkpoints
+    '.pb',                   # TensorFlow protobuf
+    '.onnx',                 # ONNX
+    '.safetensors',          # Hugging Face
+    '.joblib',               # scikit-learn
+    '.model',                # Generic
+]
+
+# Where the agent keeps its training history and the checksums of its artifacts
+AGENT_STATE_DIR = Path.home() / ".aimanage-agent"
+HISTORY_FILE = AGENT_STATE_DIR / "history.json"
+CHECKSUM_CACHE_FILE = AGENT_STATE_DIR / "checksums.json"
+
+# Local copies of server model folders, kept between trainings so only changed files are synced
+WORKSPACES_DIR = AGENT_STATE_DIR / "workspaces"
+SYNC_CACHE_FILE = AGENT_STATE_DIR / "sync-checksums.json"
+
+# Trainings kept in the history
+MAX_HISTORY = 500
+
+# How often the resource usage of a training is reported (aiAgent.TrainingResourceIntervalEnv on the server)
+RESOURCE_INTERVAL_SECONDS = 5
+
+def default_agent_id() -> str:
+    """Names the agent after the machine, in the characters the server accepts"""
+    agent_id = re.sub(r"[^A-Za-z0-9._-]", "-", platform.node())[:64]
+    return agent_id or "agent"
+
 class TrainingAgent:
-    def __init__(self, api_key: str, server_url: str = "ws://109.199.115.1:8081"):
+    def __init__(self, api_key: str, server_url: str = "ws://109.199.115.1:8081", agent_id: str = None):
         self.api_key = api_key
+        # Tells this machine apart from the user's other agents
+        self.agent_id = agent_id or default_agent_id()
         self.server_url = server_url.replace("http://", "ws://").replace("https://", "wss://")
         self.websocket = None
         self.is_training = False
         self.current_process = None
+        self.early_stopped = False
+        self.training_task = None
+        # Model loaded for previews from the web UI, if any
+        self.preview = None
+        self.preview_expiry_task = None
 
     async def connect(self):
         """Connect to the server via WebSocket"""
         print("🔌 Connecting to server...")
         print(f"   Server: {self.server_url}")
+        print(f"   Agent ID: {self.agent_id}")
 
         try:
-            uri = f"{self.server_url}/v1/ws/agent?api_key={self.api_key}"
+            uri = f"{self.server_url}/v1/ws/agent?api_key={self.api_key}&agent_id={quote(self.agent_id)}"
             self.websocket = await websockets.connect(uri)
             print("✅ WebSocket connection established!")
 
@@ -104,10 +254,35 @@ class TrainingAgent:
             print("✅ System information sent to server")
 
         elif msg_type == "train":
-            await self.handle_training(data.get("data", {}))
+            # Run in the background so that stop messages reach the agent during the training
+            self.training_task = asyncio.create_task(self.handle_training(data.get("data", {})))
 
         elif msg_type == "stop":
-            await self.stop_training()
+            await self.stop_training(data.get("reason"))
+
+        elif msg_type == "inventory_request":
+            print("📦 Server requesting artifact inventory...")
+            inventory = await asyncio.to_thread(self.collect_inventory)
+            await self.send_message({
+                "type": "inventory",
+                "data": inventory
+            })
+            print(f"✅ Inventory sent: {len(inventory['trainings'])} trainings, {len(inventory['artifacts'])} artifacts")
+
+        elif msg_type == "upload_artifact":
+            await self.handle_artifact_upload(data.get("data", {}))
+
+        elif msg_type == "benchmark":
+            await self.handle_benchmark(data.get("data", {}))
+
+        elif msg_type == "preview_start":
+            await self.handle_preview_start(data.get("data", {}))
+
+        elif msg_type == "preview_predict":
+            await self.handle_preview_predict(data.get("data", {}))
+
+        elif msg_type == "preview_stop":
+            self.stop_preview()
 
         elif msg_type == "connected":
             # Already handled in connect(), but just in case
@@ -124,7 +299,312 @@ class TrainingAgent:
             "cuda_available": torch.cuda.is_available(),
             "gpu_count": torch.cuda.device_count() if torch.cuda.is_available() else 0,
             "gpu_name": torch.cuda.get_device_name(0) if torch.cuda.is_available() else "None",
+            "gpu_memory_gb": round(torch.cuda.get_device_properties(0).total_memory / 1024**3, 1) if torch.cuda.is_available() else 0,
+            "cpu_count": os.cpu_count() or 0,
+            "memory_gb": self.get_memory_gb(),
             "platform": sys.platform,
+            "hostname": platform.node(),
+        }
+
+    @staticmethod
+    def sample_resources(pid, tracked, gpu=None):
+        """CPU and memory of the training process and its children (with psutil) and usage of its
+        GPU (with nvidia-smi). What cannot be measured is left out."""
+        sample = {}
+        try:
+            import psutil
+            if pid not in tracked:
+                tracked[pid] = psutil.Process(pid)
+                tracked[pid].cpu_percent(None)
+            cpu = memory = 0.0
+            measured = False
+            for proc in [tracked[pid], *tracked[pid].children(recursive=True)]:
+                try:
+                    if proc.pid not in tracked:
+                        # The first reading of a process only starts its CPU counter
+                        tracked[proc.pid] = proc
+                        proc.cpu_percent(None)
+                    else:
+                        cpu += tracked[proc.pid].cpu_percent(None)
+                        measured = True
+                    memory += proc.memory_info().rss
+                except (psutil.NoSuchProcess, psutil.AccessDenied):
+                    pass
+            if measured:
+                sample["cpu_percent"] = round(cpu, 1)
+            sample["memory_mb"] = round(memory / 1024**2, 1)
+        except ImportError:
+            pass
+        except Exception:
+            # The process exited between the poll and the sample
+            pass
+
+        if shutil.which("nvidia-smi"):
+            cmd = ["nvidia-smi", "--query-gpu=utilization.gpu,memory.used", "--format=csv,noheader,nounits"]
+            if gpu:
+                cmd += ["-i", gpu.split(",")[0].strip()]
+            try:
+                output = subprocess.run(cmd, capture_output=True, text=True, timeout=5).stdout
+                utilization, used = output.strip().splitlines()[0].split(",")
+                sample["gpu_utilization"] = float(utilization)
+                sample["gpu_memory_mb"] = float(used)
+            except (subprocess.SubprocessError, OSError, ValueError, IndexError):
+                pass
+        return sample
+
+    @staticmethod
+    def get_memory_gb():
+        """Total RAM in GB, or None when it cannot be read"""
+        try:
+            import psutil
+            return round(psutil.virtual_memory().total / 1024**3, 1)
+        except ImportError:
+            pass
+        try:
+            return round(os.sysconf("SC_PAGE_SIZE") * os.sysconf("SC_PHYS_PAGES") / 1024**3, 1)
+        except (AttributeError, ValueError, OSError):
+            return None
+
+    async def handle_benchmark(self, benchmark_data: dict):
+        """Run the benchmark suite and report the scores"""
+        suite = benchmark_data.get("suite", BENCHMARK_SUITE)
+        if suite != BENCHMARK_SUITE:
+            await self.send_message({
+                "type": "benchmark_failed",
+                "error": f"Unsupported benchmark suite {suite} (agent runs {BENCHMARK_SUITE})"
+            })
+            return
+        if self.is_training:
+            await self.send_message({
+                "type": "benchmark_failed",
+                "error": "Agent is training a model"
+            })
+            return
+
+        print("🏁 Running benchmark...")
+        try:
+            result = await asyncio.to_thread(self.run_benchmark)
+        except Exception as e:
+            print(f"❌ Benchmark failed: {e}")
+            await self.send_message({
+                "type": "benchmark_failed",
+                "error": str(e)
+            })
+            return
+
+        print(f"✅ Benchmark done: {result['matmul_gflops']:.1f} GFLOPS, "
+              f"{result['cnn_samples_per_sec']:.0f} CNN samples/s on {result['device']}")
+        await self.send_message({
+            "type": "benchmark_result",
+            "data": result
+        })
+
+    async def handle_preview_start(self, preview_data: dict):
+        """Load the model of one of this agent's trainings so the web UI can test it.
+        Predictions come back through the server connection, the weights stay on this machine."""
+        preview_id = preview_data.get("preview_id", "")
+        training_id = preview_data.get("training_id", "")
+        ttl = preview_data.get("ttl_seconds", 900)
+        self.stop_preview()
+
+        history = self.load_json_state(HISTORY_FILE, [])
+        entry = next((e for e in history if e.get("training_id") == training_id), None)
+        model_path = entry.get("model_path") if entry else None
+        if not model_path or not os.path.isfile(model_path):
+            await self.send_message({
+                "type": "preview_failed",
+                "preview_id": preview_id,
+                "error": "This agent has no trained model for that training"
+            })
+            return
+
+        print(f"🔮 Loading {model_path} for preview...")
+        try:
+            predict, framework = await asyncio.to_thread(self.load_preview_model, model_path)
+        except Exception as e:
+            print(f"❌ Preview failed: {e}")
+            await self.send_message({
+                "type": "preview_failed",
+                "preview_id": preview_id,
+                "error": str(e)
+            })
+            return
+
+        self.preview = {
+            "id": preview_id,
+            "predict": predict,
+            "ttl": ttl,
+            "expires_at": time.time() + ttl,
+        }
+        self.preview_expiry_task = asyncio.create_task(self.expire_preview(preview_id))
+        print(f"✅ Preview ready ({framework})")
+        await self.send_message({
+            "type": "preview_ready",
+            "preview_id": preview_id,
+            "framework": framework
+        })
+
+    def load_preview_model(self, model_path):
+        """Load a model file and return a function running it on JSON inputs, and its framework"""
+        ext = os.path.splitext(model_path)[1].lower()
+
+        if ext in ('.pt', '.pth'):
+            try:
+                model = torch.jit.load(model_path, map_location="cpu")
+            except Exception:
+                model = torch.load(model_path, map_location="cpu", weights_only=False)
+            if not callable(model):
+                raise ValueError("The file holds weights only (a state dict); save the whole model or a TorchScript model to preview it")
+            model.eval()
+
+            def predict(inputs):
+                with torch.no_grad():
+                    return model(torch.tensor(inputs, dtype=torch.float32)).tolist()
+            return predict, "pytorch"
+
+        if ext in ('.pkl', '.pickle', '.joblib'):
+            try:
+                import joblib
+                model = joblib.load(model_path)
+            except ImportError:
+                import pickle
+                with open(model_path, "rb") as f:
+                    model = pickle.load(f)
+            if not hasattr(model, "predict"):
+                raise ValueError("The pickled object has no predict method")
+
+            def predict(inputs):
+                outputs = model.predict(inputs)
+                return outputs.tolist() if hasattr(outputs, "tolist") else outputs
+            return predict, "scikit-learn"
+
+        if ext == '.onnx':
+            import numpy as np
+            import onnxruntime
+            session = onnxruntime.InferenceSession(model_path)
+            input_name = session.get_inputs()[0].name
+
+            def predict(inputs):
+                outputs = session.run(None, {input_name: np.array(inputs, dtype=np.float32)})
+                return [output.tolist() for output in outputs]
+            return predict, "onnx"
+
+        if ext in ('.h5', '.keras'):
+            from tensorflow import keras
+            model = keras.models.load_model(model_path)
+
+            def predict(inputs):
+                return model.predict(inputs, verbose=0).tolist()
+            return predict, "keras"
+
+        raise ValueError(f"Previews do not support {ext or 'extensionless'} model files")
+
+    async def handle_preview_predict(self, predict_data: dict):
+        """Run the preview model on the inputs of a request relayed by the server"""
+        request_id = predict_data.get("request_id", "")
+        preview = self.preview
+        if not preview or preview["id"] != predict_data.get("preview_id"):
+            await self.send_message({
+                "type": "preview_prediction",
+                "request_id": request_id,
+                "error": "No preview session is running"
+            })
+            return
+
+        preview["expires_at"] = time.time() + preview["ttl"]
+        try:
+            outputs = await asyncio.to_thread(preview["predict"], predict_data.get("inputs"))
+        except Exception as e:
+            await self.send_message({
+                "type": "preview_prediction",
+                "request_id": request_id,
+                "error": str(e)
+            })
+            return
+        await self.send_message({
+            "type": "preview_prediction",
+            "request_id": request_id,
+            "outputs": outputs
+        })
+
+    async def expire_preview(self, preview_id):
+        """Unload the preview model once it went unused for its time to live"""
+        while self.preview and self.preview["id"] == preview_id:
+            remaining = self.preview["expires_at"] - time.time()
+            if remaining <= 0:
+                print("⏱️  Preview expired")
+                self.stop_preview(expired=True)
+                await self.send_message({
+                    "type": "preview_stopped",
+                    "preview_id": preview_id
+                })
+                return
+            await asyncio.sleep(min(remaining, 30))
+
+    def stop_preview(self, expired=False):
+        """Unload the preview model"""
+        if self.preview_expiry_task and not expired:
+            self.preview_expiry_task.cancel()
+        self.preview_expiry_task = None
+        if self.preview:
+            print("🛑 Preview stopped")
+        self.preview = None
+
+    def run_benchmark(self):
+        """Measure FP32 matrix multiply throughput and small CNN training throughput"""
+        started = time.time()
+        device = torch.device("cuda" if torch.cuda.is_available() else "cpu")
+        device_name = torch.cuda.get_device_name(0) if device.type == "cuda" else (platform.processor() or platform.machine())
+
+        def sync():
+            if device.type == "cuda":
+                torch.cuda.synchronize()
+
+        # Matrix multiply: repeat a square FP32 matmul for about 3 seconds after a warm-up
+        size = 4096 if device.type == "cuda" else 1024
+        a = torch.randn(size, size, device=device)
+        b = torch.randn(size, size, device=device)
+        torch.matmul(a, b)
+        sync()
+        runs, matmul_start = 0, time.perf_counter()
+        while time.perf_counter() - matmul_start < 3.0:
+            torch.matmul(a, b)
+            runs += 1
+            sync()
+        matmul_gflops = 2 * size ** 3 * runs / (time.perf_counter() - matmul_start) / 1e9
+
+        # Small CNN: two epochs on 2048 random 28x28 images in batches of 64
+        torch.manual_seed(0)
+        model = torch.nn.Sequential(
+            torch.nn.Conv2d(1, 16, 3, padding=1), torch.nn.ReLU(), torch.nn.MaxPool2d(2),
+            torch.nn.Conv2d(16, 32, 3, padding=1), torch.nn.ReLU(), torch.nn.MaxPool2d(2),
+            torch.nn.Flatten(), torch.nn.Linear(32 * 7 * 7, 10),
+        ).to(device)
+        optimizer = torch.optim.SGD(model.parameters(), lr=0.01)
+        loss_fn = torch.nn.CrossEntropyLoss()
+        images = torch.randn(2048, 1, 28, 28, device=device)
+        labels = torch.randint(0, 10, (2048,), device=device)
+
+        def train_epoch():
+            for i in range(0, len(images), 64):
+                optimizer.zero_grad()
+                loss = loss_fn(model(images[i:i + 64]), labels[i:i + 64])
+                loss.backward()
+                optimizer.step()
+            sync()
+
+        train_epoch()  # warm-up
+        cnn_start = time.perf_counter()
+        for _ in range(2):
+            train_epoch()
+        cnn_samples_per_sec = 2 * len(images) / (time.perf_counter() - cnn_start)
+
+        return {
+            "suite": BENCHMARK_SUITE,
+            "device": device_name,
+            "matmul_gflops": round(matmul_gflops, 2),
+            "cnn_samples_per_sec": round(cnn_samples_per_sec, 1),
+            "duration_seconds": round(time.time() - started, 2),
         }
 
     async def handle_training(self, train_data: dict):
@@ -144,11 +624,30 @@ class TrainingAgent:
         folder_path = train_data.get("folder_path")
         script_name = train_data.get("script_name", "train.py")
         python_cmd = train_data.get("python_command", "python3")
+        extra_env = train_data.get("env") or {}
+        script_args = [str(arg) for arg in train_data.get("args") or []]
 
         print(f"📁 Folder: {folder_path}")
         print(f"📜 Script: {script_name}")
         print(f"🆔 Training ID: {training_id}")
 
+        # Model folders stored on the server are synced into a local workspace first
+        sync_summary = None
+        if train_data.get("sync"):
+            self.is_training = True
+            try:
+                folder_path, sync_summary = await self.sync_model_folder(train_data["sync"])
+            except Exception as e:
+                print(f"❌ Sync failed: {e}")
+                await self.send_message({
+                    "type": "error",
+                    "training_id": training_id,
+                    "message": f"Failed to sync model folder: {e}"
+                })
+                return
+            finally:
+                self.is_training = False
+
         # Validate folder exists
         if not os.path.exists(folder_path):
             await self.send_message({
@@ -168,12 +667,24 @@ class TrainingAgent:
             return
 
         self.is_training = True
+        self.record_training(training_id, {
+            "folder_path": os.path.abspath(folder_path),
+            "script_name": script_name,
+            "status": "running",
+            "started_at": time.time(),
+        })
 
         try:
             await self.send_message({
                 "type": "training_started",
                 "training_id": training_id
             })
+            if sync_summary:
+                await self.send_message({
+                    "type": "training_output",
+                    "training_id": training_id,
+                    "output": sync_summary
+                })
 
             # Capture file snapshot before training
             before_snapshot = self.capture_file_snapshot(folder_path)
@@ -183,14 +694,20 @@ class TrainingAgent:
                 training_id,
                 folder_path,
                 script_path,
-                python_cmd
+                python_cmd,
+                extra_env,
+                script_args
             )
 
             # Detect trained model if training succeeded
             model_path = None
+            onnx_export = None
+            if not success:
+                self.record_training(training_id, {"status": "failed", "finished_at": time.time()})
             if success:
                 after_snapshot = self.capture_file_snapshot(folder_path)
                 model_path = self.detect_trained_model(folder_path, before_snapshot, after_snapshot)
+                server_path = None
                 if model_path:
                     print(f"💾 Detected trained model: {model_path}")
 
@@ -202,19 +719,45 @@ class TrainingAgent:
                         model_path
                     )
 
-                    # Use server path if upload succeeded, otherwise use local path
+                    # Offer the model as ONNX too, stored next to it on the server
                     if server_path:
-                        model_path = server_path
-                        print(f"✅ Model uploaded to server: {server_path}")
+                        onnx_export = self.export_onnx(python_cmd, folder_path, full_model_path, extra_env)
+                        if onnx_export and onnx_export.get("status") == "exported":
+                            onnx_file = os.path.splitext(full_model_path)[0] + ".onnx"
+                            onnx_export["path"] = await self.upload_model_to_server(
+                                training_id,
+                                onnx_file,
+                                os.path.splitext(model_path)[0] + ".onnx",
+                                file_format="onnx"
+                            )
+                            if not onnx_export["path"]:
+                                onnx_export = {"status": "failed", "framework": onnx_export.get("framework"), "reason": "upload of the ONNX export failed"}
+                self.record_training(training_id, {
+                    "status": "completed",
+                    "finished_at": time.time(),
+                    "model_path": os.path.abspath(os.path.join(folder_path, model_path)) if model_path else None,
+                    "server_path": server_path,
+                })
 
-                # Send completion message with model path
+                # Use server path if upload succeeded, otherwise use local path
+                if server_path:
+                    model_path = server_path
+                    print(f"✅ Model uploaded to server: {server_path}")
+
+                # Capture the environment so the run can be reproduced
+                environment = self.capture_environment(python_cmd, folder_path, extra_env)
+
+                # Send completion message with model path and environment
                 await self.send_message({
                     "type": "training_completed",
                     "training_id": training_id,
-                    "model_path": model_path
+                    "model_path": model_path,
+                    "environment": environment,
+                    "onnx_export": onnx_export
                 })
 
         except Exception as e:
+            self.record_training(training_id, {"status": "failed", "finished_at": time.time()})
             await self.send_message({
                 "type": "training_failed",
                 "training_id": training_id,
@@ -224,15 +767,32 @@ class TrainingAgent:
             self.is_training = False
             self.current_process = None
 
-    async def run_training_script(self, training_id, folder_path, script_path, python_cmd):
+    async def run_training_script(self, training_id, folder_path, script_path, python_cmd, extra_env=None, script_args=None):
         """Run the training script and stream output"""
         print(f"\n🔄 Starting training...\n")
 
+        # Environment from the server (e.g. AIMANAGE_PROGRESS_PROTOCOL) on top of ours
+        env = dict(os.environ)
+        env["PYTHONUNBUFFERED"] = "1"
+        env.update({str(k): str(v) for k, v in extra_env.items()} if extra_env else {})
+
+        self.early_stopped = False
+
+        # Hyperparameters are also given to the script as a JSON file
+        params_dir = None
+        if env.get("AIMANAGE_HYPERPARAMETERS"):
+            params_dir = tempfile.mkdtemp(prefix="aimanage-hyperparameters-")
+            params_file = os.path.join(params_dir, "hyperparameters.json")
+            with open(params_file, "w") as f:
+                f.write(env["AIMANAGE_HYPERPARAMETERS"])
+            env["AIMANAGE_HYPERPARAMETERS_FILE"] = params_file
+
         try:
             # Start the training process
             process = subprocess.Popen(
-                [python_cmd, script_path],
+                [python_cmd, script_path, *(script_args or [])],
                 cwd=folder_path,
+                env=env,
                 stdout=subprocess.PIPE,
                 stderr=subprocess.PIPE,
                 text=True,
@@ -240,6 +800,8 @@ class TrainingAgent:
             )
 
             self.current_process = process
+            tracked_processes = {}
+            last_resources = time.monotonic()
 
             # Stream output
             while True:
@@ -247,6 +809,17 @@ class TrainingAgent:
                 if process.poll() is not None:
                     break
 
+                # Report the resource usage of the training every few seconds
+                if time.monotonic() - last_resources >= RESOURCE_INTERVAL_SECONDS:
+                    last_resources = time.monotonic()
+                    resources = self.sample_resources(process.pid, tracked_processes, env.get("CUDA_VISIBLE_DEVICES"))
+                    if resources:
+                        await self.send_message({
+                            "type": "training_resources",
+                            "training_id": training_id,
+                            "resources": resources
+                        })
+
                 # Read stdout
                 output = process.stdout.readline()
                 if output:
@@ -265,6 +838,9 @@ class TrainingAgent:
             if return_code == 0:
                 print("\n✅ Training completed successfully!")
                 return True  # Success
+            elif self.early_stopped:
+                print("\n🏁 Training stopped early")
+                return True  # The server asked to stop, the run counts as completed
             else:
                 stderr = process.stderr.read()
                 print(f"\n❌ Training failed with code {return_code}")
@@ -294,11 +870,15 @@ class TrainingAgent:
             except Exception as send_err:
                 print(f"⚠️  Failed to send error message: {send_err}")
             return False  # Failed
+        finally:
+            if params_dir:
+                shutil.rmtree(params_dir, ignore_errors=True)
 
-    async def stop_training(self):
-        """Stop current training"""
+    async def stop_training(self, reason=None):
+        """Stop current training. Trainings stopped early are still reported as completed."""
         if self.current_process:
             print("\n⚠️  Stopping training...")
+            self.early_stopped = reason == "early_stop"
             self.current_process.terminate()
             self.current_process = None
             self.is_training = False
@@ -316,6 +896,64 @@ class TrainingAgent:
                 print(f"❌ Error sending message: {type(e).__name__}: {str(e)}")
                 raise
 
+    def capture_environment(self, python_cmd, folder_path, extra_env=None):
+        """Capture Python version, platform, CUDA version and pip freeze of the training interpreter"""
+        env = dict(os.environ)
+        env.update({str(k): str(v) for k, v in extra_env.items()} if extra_env else {})
+        try:
+            result = subprocess.run(
+                [python_cmd, "-c", ENVIRONMENT_CAPTURE_SCRIPT],
+                cwd=folder_path,
+                env=env,
+                capture_output=True,
+                text=True,
+                timeout=90
+            )
+            lines = result.stdout.strip().splitlines()
+            if result.returncode != 0 or not lines:
+                print(f"⚠️  Could not capture environment: {result.stderr.strip()}")
+                return None
+            environment = json.loads(lines[-1])
+            print(f"📦 Captured environment: Python {environment.get('python_version')}, {len(environment.get('packages', []))} packages")
+            return environment
+        except Exception as e:
+            print(f"⚠️  Could not capture environment: {e}")
+            return None
+
+    def export_onnx(self, python_cmd, folder_path, model_file, extra_env=None):
+        """Export the trained model to ONNX next to it with the training interpreter"""
+        if os.environ.get("TRAINING_ONNX_EXPORT", "").strip().lower() in ("false", "0"):
+            return None
+        base, ext = os.path.splitext(model_file)
+        if ext.lower() == ".onnx":
+            return {"status": "skipped", "framework": "onnx", "reason": "the model already is ONNX"}
+        onnx_file = base + ".onnx"
+        if os.path.isfile(onnx_file) and os.path.getmtime(onnx_file) >= os.path.getmtime(model_file):
+            return {"status": "exported", "framework": None, "reason": "exported by the training script"}
+        env = dict(os.environ)
+        env.update({str(k): str(v) for k, v in extra_env.items()} if extra_env else {})
+        try:
+            result = subprocess.run(
+                [python_cmd, "-c", ONNX_EXPORT_SCRIPT, model_file, onnx_file],
+                cwd=folder_path,
+                env=env,
+                capture_output=True,
+                text=True,
+                timeout=600
+            )
+            lines = result.stdout.strip().splitlines()
+            if result.returncode != 0 or not lines:
+                return {"status": "failed", "framework": None, "reason": result.stderr.strip()[-500:] or "the export script failed"}
+            export = json.loads(lines[-1])
+            if export.get("status") == "exported":
+                print(f"📦 Exported trained model to ONNX: {onnx_file}")
+            else:
+                print(f"⚠️  Trained model was not exported to ONNX ({export.get('status')}): {export.get('reason')}")
+            return export
+        except Exception as e:
+            print(f"⚠️  Could not export to ONNX: {e}")
+            return {"status": "failed", "framework": None, "reason": str(e)}
+
     def capture_file_snapshot(self, folder_path):
         """Capture snapshot of all files in directory"""
         snapshot = {}
@@ -335,23 +973,11 @@ class TrainingAgent:
 
     def detect_trained_model(self, folder_path, before, after):
         """Detect new or modified model files"""
-        model_extensions = [
-            '.pth', '.pt',           # PyTorch
-            '.h5', '.keras',         # TensorFlow/Keras
-            '.pkl', '.pickle',       # scikit-learn
-            '.ckpt',                 # TensorFlow checkpoints
-            '.pb',                   # TensorFlow protobuf
-            '.onnx',                 # ONNX
-            '.safetensors',          # Hugging Face
-            '.joblib',               # scikit-learn
-            '.model',                # Generic
-        ]
-
         changed_models = []
 
         for file_path, after_info in after.items():
             # Check if it's a model file
-            if not any(file_path.endswith(ext) for ext in model_extensions):
+            if not any(file_path.endswith(ext) for ext in MODEL_EXTENSIONS):
                 continue
 
             # New file or modified file
@@ -396,11 +1022,209 @@ class TrainingAgent:
         print(f"📏 Selected largest file: {os.path.basename(largest)} ({size_mb:.2f} MB)")
         return os.path.relpath(largest, folder_path)
 
-    async def upload_model_to_server(self, training_id, file_path, original_path):
+    def load_json_state(self, path, default):
+        """Read one of the agent's state files"""
+        try:
+            with open(path) as f:
+                return json.load(f)
+        except (OSError, ValueError):
+            return default
+
+    def save_json_state(self, path, data):
+        """Write one of the agent's state files"""
+        try:
+            AGENT_STATE_DIR.mkdir(parents=True, exist_ok=True)
+            tmp = path.with_suffix(".tmp")
+            with open(tmp, "w") as f:
+                json.dump(data, f)
+            os.replace(tmp, path)
+        except OSError as e:
+            print(f"⚠️  Failed to save {path.name}: {e}")
+
+    def record_training(self, training_id, fields):
+        """Add or update a training in the local history"""
+        history = self.load_json_state(HISTORY_FILE, [])
+        for entry in history:
+            if entry.get("training_id") == training_id:
+                entry.update(fields)
+                break
+        else:
+            history.append({"training_id": training_id, **fields})
+        self.save_json_state(HISTORY_FILE, history[-MAX_HISTORY:])
+
+    def file_checksum(self, path, stat, cache):
+        """SHA-256 of a file, reusing the cached one while its size and mtime are unchanged"""
+        cached = cache.get(path)
+        if cached and cached.get("size") == stat.st_size and cached.get("mtime") == stat.st_mtime:
+            return cached["sha256"]
+        digest = hashlib.sha256()
+        with open(path, "rb") as f:
+            for chunk in iter(lambda: f.read(1024 * 1024), b""):
+                digest.update(chunk)
+        cache[path] = {"size": stat.st_size, "mtime": stat.st_mtime, "sha256": digest.hexdigest()}
+        return cache[path]["sha256"]
+
+    def collect_inventory(self):
+        """List the trainings this agent ran and the model files in their folders"""
+        history = self.load_json_state(HISTORY_FILE, [])
+        cache = self.load_json_state(CHECKSUM_CACHE_FILE, {})
+        models_by_path = {entry["model_path"]: entry for entry in history if entry.get("model_path")}
+
+        artifacts, seen = [], set()
+        folders = {entry["folder_path"] for entry in history if entry.get("folder_path")}
+        for folder in sorted(folders):
+            for root, _, files in os.walk(folder):
+                for name in files:
+                    path = os.path.abspath(os.path.join(root, name))
+                    if path in seen or not any(name.endswith(ext) for ext in MODEL_EXTENSIONS):
+                        continue
+                    seen.add(path)
+                    try:
+                        stat = os.stat(path)
+                        checksum = self.file_checksum(path, stat, cache)
+                    except OSError:
+                        continue
+                    training = models_by_path.get(path, {})
+                    artifacts.append({
+                        "path": path,
+                        "size_bytes": stat.st_size,
+                        "sha256": checksum,
+                        "modified_at": stat.st_mtime,
+                        "training_id": training.get("training_id", ""),
+                        "server_path": training.get("server_path") or "",
+                    })
+
+        self.save_json_state(CHECKSUM_CACHE_FILE, {path: cache[path] for path in seen if path in cache})
+        return {"trainings": history, "artifacts": artifacts}
+
+    async def handle_artifact_upload(self, upload_data: dict):
+        """Upload a model file of the inventory the server is missing"""
+        path = upload_data.get("path", "")
+        training_id = upload_data.get("training_id", "")
+        model_name = upload_data.get("model_name", "")
+
+        # Only files the agent reported in its inventory can be requested
+        history = self.load_json_state(HISTORY_FILE, [])
+        folders = [entry["folder_path"] for entry in history if entry.get("folder_path")]
+        real_path = os.path.realpath(path)
+        inside = any(real_path.startswith(os.path.realpath(folder) + os.sep) for folder in folders)
+        if not inside or not os.path.isfile(real_path) or not any(real_path.endswith(ext) for ext in MODEL_EXTENSIONS):
+            await self.send_message({
+                "type": "artifact_upload_failed",
+                "path": path,
+                "error": "Not a model file of this agent's trainings"
+            })
+            return
+
+        server_path = await self.upload_model_to_server(training_id, real_path, path, model_name)
+        if not server_path:
+            await self.send_message({
+                "type": "artifact_upload_failed",
+                "path": path,
+                "error": "Upload failed"
+            })
+            return
+
+        for entry in history:
+            if entry.get("model_path") == path:
+                self.record_training(entry["training_id"], {"server_path": server_path})
+        await self.send_message({
+            "type": "artifact_uploaded",
+            "path": path,
+            "server_path": server_path
+        })
+
+    def changed_sync_files(self, workspace, files, cache):
+        """Manifest entries whose local copy is missing or has a different checksum"""
+        changed = []
+        for entry in files:
+            path = os.path.join(workspace, entry["path"])
+            try:
+                stat = os.stat(path)
+                if stat.st_size == entry["size"] and self.file_checksum(path, stat, cache) == entry["sha256"]:
+                    continue
+            except OSError:
+                pass
+            changed.append(entry)
+        return changed
+
+    async def sync_model_folder(self, sync_spec):
+        """Bring the local copy of a server model folder up to date, downloading only the files
+        whose checksum changed. Returns the local folder and a summary of the transfer."""
+        name = re.sub(r"[^A-Za-z0-9._-]", "_", sync_spec.get("folder") or "model").lstrip(".") or "model"
+        workspace = os.path.realpath(WORKSPACES_DIR / name)
+        os.makedirs(workspace, exist_ok=True)
+
+        http_url = self.server_url.replace('ws://', 'http://').replace('wss://', 'https://')
+        headers = {'Authorization': f'Bearer {self.api_key}'}
+        cache = self.load_json_state(SYNC_CACHE_FILE, {})
+
+        print(f"🔄 Syncing model folder into {workspace}...")
+        async with aiohttp.ClientSession(headers=headers) as session:
+            async with session.get(http_url + sync_spec["manifest_url"]) as response:
+                if response.status != 200:
+                    raise Exception(f"manifest request failed: {response.status} {await response.text()}")
+                manifest = await response.json()
+
+            files = manifest.get("files", [])
+            for entry in files:
+                path = os.path.realpath(os.path.join(workspace, entry["path"]))
+                if not path.startswith(workspace + os.sep):
+                    raise Exception(f"manifest path escapes the workspace: {entry['path']}")
+
+            changed = await asyncio.to_thread(self.changed_sync_files, workspace, files, cache)
+            transferred = 0
+            for entry in changed:
+                path = os.path.join(workspace, entry["path"])
+                os.makedirs(os.path.dirname(path), exist_ok=True)
+                tmp_path = path + ".sync-tmp"
+                digest = hashlib.sha256()
+                async with session.get(http_url + sync_spec["files_url"] + quote(entry["path"])) as response:
+                    if response.status != 200:
+                        raise Exception(f"download of {entry['path']} failed: {response.status}")
+                    with open(tmp_path, "wb") as f:
+                        async for chunk in response.content.iter_chunked(1024 * 1024):
+                            digest.update(chunk)
+                            f.write(chunk)
+                if digest.hexdigest() != entry["sha256"]:
+                    os.remove(tmp_path)
+                    raise Exception(f"checksum mismatch for {entry['path']}")
+                os.chmod(tmp_path, entry.get("mode") or 0o644)
+                os.replace(tmp_path, path)
+                stat = os.stat(path)
+                cache[path] = {"size": stat.st_size, "mtime": stat.st_mtime, "sha256": entry["sha256"]}
+                transferred += entry["size"]
+                print(f"   ⬇️  {entry['path']} ({entry['size'] / (1024 * 1024):.2f} MB)")
+
+        # Files deleted on the server go too, except models trained in the workspace
+        wanted = {os.path.join(workspace, entry["path"]) for entry in files}
+        deleted = 0
+        for root, _, names in os.walk(workspace):
+            for file_name in names:
+                path = os.path.join(root, file_name)
+                if path in wanted or any(file_name.endswith(ext) for ext in MODEL_EXTENSIONS):
+                    continue
+                if "__pycache__" in path.split(os.sep):
+                    continue
+                os.remove(path)
+                cache.pop(path, None)
+                deleted += 1
+
+        self.save_json_state(SYNC_CACHE_FILE, {path: value for path, value in cache.items() if os.path.exists(path)})
+
+        total = manifest.get("total_bytes", 0)
+        summary = (f"📦 Synced model folder: {len(changed)} of {len(files)} files changed, "
+                   f"{transferred / (1024 * 1024):.1f} MB of {total / (1024 * 1024):.1f} MB transferred"
+                   + (f", {deleted} removed" if deleted else ""))
+        print(f"✅ {summary}")
+        return workspace, summary
+
+    async def upload_model_to_server(self, training_id, file_path, original_path, model_name=None, file_format=None):
         """Upload trained model file to server"""
         try:
             # Extract model name from training ID (format: "ModelName_timestamp")
-            model_name = training_id.split('_')[0] if '_' in training_id else training_id
+            if not model_name:
+                model_name = training_id.split('_')[0] if '_' in training_id else training_id
 
             print(f"\n📤 Uploading model to server...")
             print(f"   Model: {model_name}")
@@ -418,6 +1242,8 @@ class TrainingAgent:
             data = aiohttp.FormData()
             data.add_field('model_name', model_name)
             data.add_field('original_path', original_path)
+            if file_format:
+                data.add_field('format', file_format)
             data.add_field('model_file',
                           open(file_path, 'rb'),
                           filename=os.path.basename(file_path))
@@ -461,8 +1287,14 @@ def main():
     parser.add_argument('--server-url', type=str,
                         default='ws://109.199.115.1:8081',
                         help='Server URL (default: ws://109.199.115.1:8081)')
+    parser.add_argument('--agent-id', type=str,
+                        default=os.environ.get('AIMANAGE_AGENT_ID'),
+                        help='Name of this agent among yours, up to 64 letters, digits, dots, dashes or underscores '
+                             '(default: $AIMANAGE_AGENT_ID or the hostname)')
 
     args = parser.parse_args()
+    if args.agent_id and not re.fullmatch(r"[A-Za-z0-9._-]{1,64}", args.agent_id):
+        parser.error("--agent-id must be 1 to 64 letters, digits, dots, dashes or underscores")
 
     print("="*60)
     print("🤖 AI Training Agent")
@@ -479,7 +1311,7 @@ def main():
 
     print("\n")
 
-    agent = TrainingAgent(args.api_key, args.server_url)
+    agent = TrainingAgent(args.api_key, args.server_url, args.agent_id)
 
     try:
         asyncio.run(agent.run())